@@ -159,6 +159,9 @@ func (m *MockAutoscaling) TerminateInstanceInAutoScalingGroup(input *autoscaling
 		for i := range group.Instances {
 			if aws.StringValue(group.Instances[i].InstanceId) == aws.StringValue(input.InstanceId) {
 				group.Instances = append(group.Instances[:i], group.Instances[i+1:]...)
+				if aws.BoolValue(input.ShouldDecrementDesiredCapacity) && group.DesiredCapacity != nil {
+					group.DesiredCapacity = aws.Int64(aws.Int64Value(group.DesiredCapacity) - 1)
+				}
 				return &autoscaling.TerminateInstanceInAutoScalingGroupOutput{
 					Activity: nil, // TODO
 				}, nil
@@ -169,6 +172,33 @@ func (m *MockAutoscaling) TerminateInstanceInAutoScalingGroup(input *autoscaling
 	return nil, fmt.Errorf("Instance not found")
 }
 
+func (m *MockAutoscaling) UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	glog.V(2).Infof("UpdateAutoScalingGroup %v", input)
+
+	g := m.Groups[aws.StringValue(input.AutoScalingGroupName)]
+	if g == nil {
+		return nil, fmt.Errorf("AutoScaling Group not found")
+	}
+
+	if input.DesiredCapacity != nil {
+		g.DesiredCapacity = input.DesiredCapacity
+	}
+	if input.MinSize != nil {
+		g.MinSize = input.MinSize
+	}
+	if input.MaxSize != nil {
+		g.MaxSize = input.MaxSize
+	}
+	if input.LaunchConfigurationName != nil {
+		g.LaunchConfigurationName = input.LaunchConfigurationName
+	}
+
+	return &autoscaling.UpdateAutoScalingGroupOutput{}, nil
+}
+
 func (m *MockAutoscaling) DescribeAutoScalingGroupsWithContext(aws.Context, *autoscaling.DescribeAutoScalingGroupsInput, ...request.Option) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
 	glog.Fatalf("Not implemented")
 	return nil, nil
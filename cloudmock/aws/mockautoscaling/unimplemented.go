@@ -624,10 +624,6 @@ func (m *MockAutoscaling) TerminateInstanceInAutoScalingGroupRequest(*autoscalin
 	return nil, nil
 }
 
-func (m *MockAutoscaling) UpdateAutoScalingGroup(*autoscaling.UpdateAutoScalingGroupInput) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
-	glog.Fatalf("Not implemented")
-	return nil, nil
-}
 func (m *MockAutoscaling) UpdateAutoScalingGroupWithContext(aws.Context, *autoscaling.UpdateAutoScalingGroupInput, ...request.Option) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
 	glog.Fatalf("Not implemented")
 	return nil, nil
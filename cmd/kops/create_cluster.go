@@ -254,7 +254,7 @@ func NewCmdCreateCluster(f *util.Factory, out io.Writer) *cobra.Command {
 	}
 
 	cmd.Flags().BoolVarP(&options.Yes, "yes", "y", options.Yes, "Specify --yes to immediately create the cluster")
-	cmd.Flags().StringVar(&options.Target, "target", options.Target, fmt.Sprintf("Valid targets: %s, %s, %s. Set this flag to %s if you want kops to generate terraform", cloudup.TargetDirect, cloudup.TargetTerraform, cloudup.TargetCloudformation, cloudup.TargetTerraform))
+	cmd.Flags().StringVar(&options.Target, "target", options.Target, fmt.Sprintf("Valid targets: %s, %s, %s, %s. Set this flag to %s if you want kops to generate terraform, or %s for terraform in the JSON syntax", cloudup.TargetDirect, cloudup.TargetTerraform, cloudup.TargetTerraformJSON, cloudup.TargetCloudformation, cloudup.TargetTerraform, cloudup.TargetTerraformJSON))
 	cmd.Flags().StringVar(&options.Models, "model", options.Models, "Models to apply (separate multiple models with commas)")
 
 	// Configuration / state location
@@ -375,7 +375,7 @@ func RunCreateCluster(f *util.Factory, out io.Writer, c *CreateClusterOptions) e
 	// TODO: Reuse rootCommand stateStore logic?
 
 	if c.OutDir == "" {
-		if c.Target == cloudup.TargetTerraform {
+		if c.Target == cloudup.TargetTerraform || c.Target == cloudup.TargetTerraformJSON {
 			c.OutDir = "out/terraform"
 		} else if c.Target == cloudup.TargetCloudformation {
 			c.OutDir = "out/cloudformation"
@@ -1111,7 +1111,11 @@ func RunCreateCluster(f *util.Factory, out io.Writer, c *CreateClusterOptions) e
 		return fmt.Errorf("error writing updated configuration: %v", err)
 	}
 
-	err = registry.WriteConfigDeprecated(cluster, configBase.Join(registry.PathClusterCompleted), fullCluster)
+	secretStore, err := clientset.SecretStore(cluster)
+	if err != nil {
+		return err
+	}
+	err = cloudup.WriteCompletedCluster(cluster, configBase, secretStore, fullCluster)
 	if err != nil {
 		return fmt.Errorf("error writing completed cluster spec: %v", err)
 	}
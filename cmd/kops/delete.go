@@ -87,6 +87,7 @@ func NewCmdDelete(f *util.Factory, out io.Writer) *cobra.Command {
 	// create subcommands
 	cmd.AddCommand(NewCmdDeleteCluster(f, out))
 	cmd.AddCommand(NewCmdDeleteInstanceGroup(f, out))
+	cmd.AddCommand(NewCmdDeleteLock(f, out))
 	cmd.AddCommand(NewCmdDeleteSecret(f, out))
 
 	return cmd
@@ -41,6 +41,8 @@ type DeleteClusterOptions struct {
 	External    bool
 	Unregister  bool
 	ClusterName string
+	// Lock is true if the cluster is locked in the state store while it is deleted
+	Lock bool
 }
 
 var (
@@ -60,7 +62,7 @@ var (
 )
 
 func NewCmdDeleteCluster(f *util.Factory, out io.Writer) *cobra.Command {
-	options := &DeleteClusterOptions{}
+	options := &DeleteClusterOptions{Lock: true}
 
 	cmd := &cobra.Command{
 		Use:     "cluster CLUSTERNAME [--yes]",
@@ -86,6 +88,7 @@ func NewCmdDeleteCluster(f *util.Factory, out io.Writer) *cobra.Command {
 	cmd.Flags().BoolVarP(&options.Yes, "yes", "y", options.Yes, "Specify --yes to delete the cluster")
 	cmd.Flags().BoolVar(&options.Unregister, "unregister", options.Unregister, "Don't delete cloud resources, just unregister the cluster")
 	cmd.Flags().BoolVar(&options.External, "external", options.External, "Delete an external cluster")
+	cmd.Flags().BoolVar(&options.Lock, "lock", options.Lock, "Lock the cluster in the state store while it is changed; --lock=false is for state stores that cannot hold the lock")
 
 	cmd.Flags().StringVar(&options.Region, "region", options.Region, "region")
 	return cmd
@@ -119,6 +122,14 @@ func RunDeleteCluster(f *util.Factory, out io.Writer, options *DeleteClusterOpti
 		if err != nil {
 			return err
 		}
+
+		if options.Yes {
+			unlock, err := LockCluster(cluster, "delete cluster", options.Lock)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+		}
 	}
 
 	wouldDeleteCloudResources := false
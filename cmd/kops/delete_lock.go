@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/statelock"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	deleteLockLong = templates.LongDesc(i18n.T(`
+	Remove the state store lock on a cluster.
+
+	Use this to recover when a kops command that held the lock was interrupted, so that
+	other commands can change the cluster without waiting for the lock to expire.
+	Removing a lock that is held by a command that is still running allows another
+	command to change the cluster at the same time, so check with kops get locks first.`))
+
+	deleteLockExample = templates.Examples(i18n.T(`
+	# Remove the lock on a cluster
+	kops delete lock --name k8s-cluster.example.com --force
+	`))
+
+	deleteLockShort = i18n.T(`Remove the state store lock on a cluster`)
+)
+
+type DeleteLockOptions struct {
+	ClusterName string
+
+	// Force removes the lock even if it has not expired
+	Force bool
+}
+
+func NewCmdDeleteLock(f *util.Factory, out io.Writer) *cobra.Command {
+	options := &DeleteLockOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "lock",
+		Short:   deleteLockShort,
+		Long:    deleteLockLong,
+		Example: deleteLockExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rootCommand.ProcessArgs(args); err != nil {
+				exitWithError(err)
+			}
+
+			options.ClusterName = rootCommand.ClusterName()
+
+			err := RunDeleteLock(f, out, options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&options.Force, "force", options.Force, "Remove the lock even if it is held by a command that may still be running")
+
+	return cmd
+}
+
+func RunDeleteLock(f *util.Factory, out io.Writer, options *DeleteLockOptions) error {
+	if options.ClusterName == "" {
+		return fmt.Errorf("ClusterName is required")
+	}
+
+	cluster, err := GetCluster(f, options.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	lock, err := statelock.Read(cluster)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		fmt.Fprintf(out, "Cluster %q is not locked\n", options.ClusterName)
+		return nil
+	}
+
+	if !lock.IsExpired(time.Now()) && !options.Force {
+		return fmt.Errorf("cluster %q is locked by %s for %q, which has not expired; specify --force to remove the lock", options.ClusterName, lock.Owner, lock.Operation)
+	}
+
+	if err := statelock.Delete(cluster); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Removed the lock on cluster %q held by %s for %q\n", options.ClusterName, lock.Owner, lock.Operation)
+	return nil
+}
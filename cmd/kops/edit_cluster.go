@@ -26,12 +26,16 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/kops/cmd/kops/util"
 	api "k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/apis/kops/registry"
 	"k8s.io/kops/pkg/apis/kops/validation"
 	"k8s.io/kops/pkg/assets"
 	"k8s.io/kops/pkg/commands"
+	"k8s.io/kops/pkg/diff"
 	"k8s.io/kops/pkg/edit"
 	"k8s.io/kops/pkg/kopscodecs"
 	"k8s.io/kops/upup/pkg/fi/cloudup"
@@ -243,10 +247,27 @@ func RunEditCluster(f *util.Factory, cmd *cobra.Command, args []string, out io.W
 		// Note we perform as much validation as we can, before writing a bad config
 		_, err = clientset.UpdateCluster(newCluster, status)
 		if err != nil {
+			if errors.IsConflict(err) {
+				current, getErr := clientset.GetCluster(oldCluster.ObjectMeta.Name)
+				if getErr == nil {
+					getErr = current.FillDefaults()
+				}
+				if getErr != nil {
+					return preservedFile(fmt.Errorf("%v (error reading current configuration: %v)", err, getErr), file, out)
+				}
+				if writeErr := writeConflictDiff(out, fmt.Sprintf("Cluster %q was changed while you were editing it, by these changes", oldCluster.ObjectMeta.Name), oldCluster, current); writeErr != nil {
+					return preservedFile(writeErr, file, out)
+				}
+				return preservedFile(fmt.Errorf("%v\nrun kops edit cluster again to apply your changes to the current configuration", err), file, out)
+			}
 			return preservedFile(err, file, out)
 		}
 
-		err = registry.WriteConfigDeprecated(newCluster, configBase.Join(registry.PathClusterCompleted), fullCluster)
+		secretStore, err := clientset.SecretStore(newCluster)
+		if err != nil {
+			return preservedFile(err, file, out)
+		}
+		err = cloudup.WriteCompletedCluster(newCluster, configBase, secretStore, fullCluster)
 		if err != nil {
 			return preservedFile(fmt.Errorf("error writing completed cluster spec: %v", err), file, out)
 		}
@@ -332,6 +353,28 @@ func hasLines(r io.Reader) (bool, error) {
 	return false, nil
 }
 
+// writeConflictDiff writes the changes between two versions of an object that could not be updated because of a conflict.
+// The resourceVersion is not included in the diff, as it always differs.
+func writeConflictDiff(out io.Writer, description string, from runtime.Object, to runtime.Object) error {
+	var yamls []string
+	for _, o := range []runtime.Object{from, to} {
+		o = o.DeepCopyObject()
+		objectMeta, err := meta.Accessor(o)
+		if err != nil {
+			return err
+		}
+		objectMeta.SetResourceVersion("")
+		b, err := kopscodecs.ToVersionedYaml(o)
+		if err != nil {
+			return fmt.Errorf("error serializing %T: %v", o, err)
+		}
+		yamls = append(yamls, string(b))
+	}
+
+	fmt.Fprintf(out, "%s:\n\n%s\n", description, diff.FormatDiff(yamls[0], yamls[1]))
+	return nil
+}
+
 // preservedFile writes out a message about the provided file if it exists to the
 // provided output stream when an error happens. Used to notify the user where
 // their updates were preserved.
@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/kops/cmd/kops/util"
 	api "k8s.io/kops/pkg/apis/kops"
@@ -127,8 +128,9 @@ func RunEditInstanceGroup(f *util.Factory, cmd *cobra.Command, args []string, ou
 
 	// launch the editor
 	edited, file, err := edit.LaunchTempFile(fmt.Sprintf("%s-edit-", filepath.Base(os.Args[0])), ext, bytes.NewReader(raw))
+	preserveFile := false
 	defer func() {
-		if file != "" {
+		if file != "" && !preserveFile {
 			os.Remove(file)
 		}
 	}()
@@ -182,6 +184,17 @@ func RunEditInstanceGroup(f *util.Factory, cmd *cobra.Command, args []string, ou
 	// Note we perform as much validation as we can, before writing a bad config
 	_, err = clientset.InstanceGroupsFor(cluster).Update(fullGroup)
 	if err != nil {
+		if errors.IsConflict(err) {
+			current, getErr := clientset.InstanceGroupsFor(cluster).Get(groupName, metav1.GetOptions{})
+			if getErr != nil {
+				return fmt.Errorf("%v (error reading current configuration: %v)", err, getErr)
+			}
+			if err := writeConflictDiff(out, fmt.Sprintf("InstanceGroup %q was changed while you were editing it, by these changes", groupName), oldGroup, current); err != nil {
+				return err
+			}
+			preserveFile = true
+			return preservedFile(fmt.Errorf("%v\nrun kops edit ig again to apply your changes to the current configuration", err), file, out)
+		}
 		return err
 	}
 
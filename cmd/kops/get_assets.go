@@ -0,0 +1,203 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/assets"
+	"k8s.io/kops/util/pkg/tables"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	getAssetsLong = templates.LongDesc(i18n.T(`
+	Display the container images and files used by a cluster.
+
+	Every image (including those of the addons) and file (including kubelet, kubectl, the CNI plugins,
+	nodeup and protokube) the cluster uses is listed with the location it is published at, the location
+	the cluster uses after spec.assets is applied, its SHA-256 hash, and the components and addons that use it.
+	The SHA-256 hash of an image is the digest of its manifest, or of its manifest list for multi-architecture
+	images.  Hashes are read from the location the cluster uses, falling back to the published location.
+
+	In addition to table, yaml and json, the output can be csv, or a software bill of materials
+	in SPDX 2.2 (spdx) or CycloneDX 1.4 (cyclonedx) JSON format.`))
+
+	getAssetsExample = templates.Examples(i18n.T(`
+	# Get the images and files used by a cluster
+	kops get assets --name k8s-cluster.example.com
+
+	# Write a CycloneDX software bill of materials for a cluster
+	kops get assets --name k8s-cluster.example.com -o cyclonedx > sbom.json`))
+
+	getAssetsShort = i18n.T(`Get the images and files used by a cluster.`)
+)
+
+// Output formats that are only supported by kops get assets
+const (
+	OutputCSV       = "csv"
+	OutputSPDX      = "spdx"
+	OutputCycloneDX = "cyclonedx"
+)
+
+type GetAssetsOptions struct {
+	*GetOptions
+
+	ClusterName string
+}
+
+func NewCmdGetAssets(f *util.Factory, out io.Writer, getOptions *GetOptions) *cobra.Command {
+	options := GetAssetsOptions{
+		GetOptions: getOptions,
+	}
+
+	cmd := &cobra.Command{
+		Use:     "assets",
+		Aliases: []string{"asset"},
+		Short:   getAssetsShort,
+		Long:    getAssetsLong,
+		Example: getAssetsExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rootCommand.ProcessArgs(args); err != nil {
+				exitWithError(err)
+			}
+
+			options.ClusterName = rootCommand.ClusterName()
+
+			err := RunGetAssets(f, out, &options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func RunGetAssets(f *util.Factory, out io.Writer, options *GetAssetsOptions) error {
+	if options.ClusterName == "" {
+		return fmt.Errorf("ClusterName is required")
+	}
+
+	switch options.output {
+	case OutputTable, OutputYaml, OutputJSON, OutputCSV, OutputSPDX, OutputCycloneDX:
+	default:
+		return fmt.Errorf("Unknown output format: %q", options.output)
+	}
+
+	assetBuilder, err := resolveClusterAssets(f, options.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	list, err := assets.ListAssets(assetBuilder)
+	if err != nil {
+		return err
+	}
+
+	sbomOptions := &assets.SBOMOptions{
+		Name:    options.ClusterName,
+		Created: time.Now(),
+	}
+
+	switch options.output {
+	case OutputTable:
+		return assetsOutputTable(list, out)
+
+	case OutputYaml:
+		b, err := api.ToRawYaml(list)
+		if err != nil {
+			return fmt.Errorf("error marshaling yaml: %v", err)
+		}
+		if _, err := out.Write(b); err != nil {
+			return fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return nil
+
+	case OutputJSON:
+		if list == nil {
+			// Print an empty list rather than null
+			list = []*assets.Asset{}
+		}
+		b, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling json: %v", err)
+		}
+		if _, err := out.Write(b); err != nil {
+			return fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return nil
+
+	case OutputCSV:
+		return assetsOutputCSV(list, out)
+
+	case OutputSPDX:
+		return assets.WriteSPDX(out, list, sbomOptions)
+
+	case OutputCycloneDX:
+		return assets.WriteCycloneDX(out, list, sbomOptions)
+
+	default:
+		return fmt.Errorf("Unknown output format: %q", options.output)
+	}
+}
+
+func assetsOutputTable(list []*assets.Asset, out io.Writer) error {
+	t := &tables.Table{}
+	t.AddColumn("TYPE", func(a *assets.Asset) string {
+		return a.Type
+	})
+	t.AddColumn("SOURCE", func(a *assets.Asset) string {
+		return a.Source
+	})
+	t.AddColumn("LOCATION", func(a *assets.Asset) string {
+		return a.Location
+	})
+	t.AddColumn("SHA256", func(a *assets.Asset) string {
+		return a.SHA256
+	})
+	t.AddColumn("USED BY", func(a *assets.Asset) string {
+		return strings.Join(a.UsedBy, ",")
+	})
+	return t.Render(list, out, "TYPE", "SOURCE", "LOCATION", "SHA256", "USED BY")
+}
+
+func assetsOutputCSV(list []*assets.Asset, out io.Writer) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"type", "source", "location", "sha256", "usedBy"}); err != nil {
+		return fmt.Errorf("error writing to stdout: %v", err)
+	}
+	for _, a := range list {
+		if err := w.Write([]string{a.Type, a.Source, a.Location, a.SHA256, strings.Join(a.UsedBy, ";")}); err != nil {
+			return fmt.Errorf("error writing to stdout: %v", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing to stdout: %v", err)
+	}
+	return nil
+}
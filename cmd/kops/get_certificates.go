@@ -0,0 +1,202 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/certificates"
+	"k8s.io/kops/util/pkg/tables"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	getCertificatesLong = templates.LongDesc(i18n.T(`
+	Display the certificates in the cluster keystore, with their subject, alternate names,
+	issuer and expiry.
+
+	Every certificate in each keyset is listed; the primary certificate is the one that is in use.
+	Certificates can be reissued before they expire by setting spec.certificates.renewalWindow
+	and running kops update cluster.`))
+
+	getCertificatesExample = templates.Examples(i18n.T(`
+	# Get the certificates of a cluster
+	kops get certificates --name k8s-cluster.example.com
+
+	# Get the certificates that expire in the next 30 days
+	kops get certificates --name k8s-cluster.example.com --expiring-within=30d`))
+
+	getCertificatesShort = i18n.T(`Get the certificates in the cluster keystore.`)
+)
+
+type GetCertificatesOptions struct {
+	*GetOptions
+
+	// ExpiringWithin only lists certificates that expire within this duration, for example 30d or 12h
+	ExpiringWithin string
+}
+
+func NewCmdGetCertificates(f *util.Factory, out io.Writer, getOptions *GetOptions) *cobra.Command {
+	options := GetCertificatesOptions{
+		GetOptions: getOptions,
+	}
+
+	cmd := &cobra.Command{
+		Use:     "certificates",
+		Aliases: []string{"certificate", "certs"},
+		Short:   getCertificatesShort,
+		Long:    getCertificatesLong,
+		Example: getCertificatesExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunGetCertificates(f, &options, out)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&options.ExpiringWithin, "expiring-within", options.ExpiringWithin, "Only list certificates that expire within this duration, for example 30d or 12h")
+
+	return cmd
+}
+
+func RunGetCertificates(f *util.Factory, options *GetCertificatesOptions, out io.Writer) error {
+	var expiringWithin time.Duration
+	if options.ExpiringWithin != "" {
+		d, err := parseDurationWithDays(options.ExpiringWithin)
+		if err != nil {
+			return fmt.Errorf("invalid --expiring-within %q: %v", options.ExpiringWithin, err)
+		}
+		expiringWithin = d
+	}
+
+	cluster, err := rootCommand.Cluster()
+	if err != nil {
+		return err
+	}
+
+	clientset, err := f.Clientset()
+	if err != nil {
+		return err
+	}
+
+	keyStore, err := clientset.KeyStore(cluster)
+	if err != nil {
+		return err
+	}
+
+	all, err := certificates.ListCertificates(keyStore)
+	if err != nil {
+		return err
+	}
+
+	var certs []*certificates.CertificateInfo
+	now := time.Now()
+	for _, c := range all {
+		if options.ExpiringWithin != "" && !c.ExpiresWithin(now, expiringWithin) {
+			continue
+		}
+		certs = append(certs, c)
+	}
+
+	switch options.output {
+	case OutputTable:
+		if len(certs) == 0 {
+			if options.ExpiringWithin != "" {
+				fmt.Fprintf(out, "No certificates expire within %s\n", options.ExpiringWithin)
+			} else {
+				fmt.Fprintf(out, "No certificates found\n")
+			}
+			return nil
+		}
+		return certificatesOutputTable(certs, out)
+
+	case OutputYaml:
+		b, err := api.ToRawYaml(certs)
+		if err != nil {
+			return fmt.Errorf("error marshaling yaml: %v", err)
+		}
+		if _, err := out.Write(b); err != nil {
+			return fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return nil
+
+	case OutputJSON:
+		if certs == nil {
+			// Print an empty list rather than null
+			certs = []*certificates.CertificateInfo{}
+		}
+		b, err := json.MarshalIndent(certs, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling json: %v", err)
+		}
+		if _, err := out.Write(b); err != nil {
+			return fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("Unknown output format: %q", options.output)
+	}
+}
+
+func certificatesOutputTable(certs []*certificates.CertificateInfo, out io.Writer) error {
+	t := &tables.Table{}
+	t.AddColumn("NAME", func(c *certificates.CertificateInfo) string {
+		return c.Keyset
+	})
+	t.AddColumn("ID", func(c *certificates.CertificateInfo) string {
+		return c.ID
+	})
+	t.AddColumn("PRIMARY", func(c *certificates.CertificateInfo) string {
+		return strconv.FormatBool(c.Primary)
+	})
+	t.AddColumn("SUBJECT", func(c *certificates.CertificateInfo) string {
+		return c.Subject
+	})
+	t.AddColumn("ALTERNATE NAMES", func(c *certificates.CertificateInfo) string {
+		return strings.Join(c.AlternateNames, ",")
+	})
+	t.AddColumn("ISSUER", func(c *certificates.CertificateInfo) string {
+		return c.Issuer
+	})
+	t.AddColumn("NOT AFTER", func(c *certificates.CertificateInfo) string {
+		return c.NotAfter.UTC().Format(time.RFC3339)
+	})
+	return t.Render(certs, out, "NAME", "ID", "PRIMARY", "SUBJECT", "ALTERNATE NAMES", "ISSUER", "NOT AFTER")
+}
+
+// parseDurationWithDays parses a duration, also accepting a number of days such as 30d
+func parseDurationWithDays(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse number of days")
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
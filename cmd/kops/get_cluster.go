@@ -29,6 +29,8 @@ import (
 	"k8s.io/kops/cmd/kops/util"
 	api "k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/upup/pkg/fi/cloudup"
 	"k8s.io/kops/util/pkg/tables"
 	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
 	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
@@ -50,6 +52,9 @@ var (
 
 	# Save a cluster desired configuration to YAML file
 	kops get cluster k8s-cluster.example.com -o yaml > cluster-desired-config.yaml
+
+	# Get a cluster YAML desired configuration, as it was at revision 3
+	kops get cluster k8s-cluster.example.com --revision 3 -o yaml
 	`))
 
 	getClusterShort = i18n.T(`Get one or many clusters.`)
@@ -78,6 +83,9 @@ type GetClusterOptions struct {
 
 	// ClusterNames is a list of cluster names to show; if not specified all clusters will be shown
 	ClusterNames []string
+
+	// Revision is the recorded revision of the cluster to show; if not specified the current configuration is shown
+	Revision int
 }
 
 func NewCmdGetCluster(f *util.Factory, out io.Writer, getOptions *GetOptions) *cobra.Command {
@@ -112,6 +120,7 @@ func NewCmdGetCluster(f *util.Factory, out io.Writer, getOptions *GetOptions) *c
 	}
 
 	cmd.Flags().BoolVar(&options.FullSpec, "full", options.FullSpec, "Show fully populated configuration")
+	cmd.Flags().IntVar(&options.Revision, "revision", options.Revision, "Show the configuration as it was at a revision listed by kops history cluster")
 
 	return cmd
 }
@@ -122,14 +131,30 @@ func RunGetClusters(context Factory, out io.Writer, options *GetClusterOptions)
 		return err
 	}
 
-	clusterList, err := client.ListClusters(metav1.ListOptions{})
-	if err != nil {
-		return err
-	}
+	var clusters []*api.Cluster
+	if options.Revision != 0 {
+		if len(options.ClusterNames) != 1 {
+			return fmt.Errorf("--revision requires a single cluster name")
+		}
+		if options.FullSpec {
+			return fmt.Errorf("--full cannot be used with --revision, as the fully populated configuration is not recorded")
+		}
 
-	clusters, err := buildClusters(options.ClusterNames, clusterList)
-	if err != nil {
-		return err
+		cluster, err := client.GetClusterRevision(options.ClusterNames[0], options.Revision)
+		if err != nil {
+			return err
+		}
+		clusters = append(clusters, cluster)
+	} else {
+		clusterList, err := client.ListClusters(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+
+		clusters, err = buildClusters(options.ClusterNames, clusterList)
+		if err != nil {
+			return err
+		}
 	}
 
 	if len(clusters) == 0 {
@@ -138,7 +163,7 @@ func RunGetClusters(context Factory, out io.Writer, options *GetClusterOptions)
 
 	if options.FullSpec {
 		var err error
-		clusters, err = fullClusterSpecs(clusters)
+		clusters, err = fullClusterSpecs(client, clusters)
 		if err != nil {
 			return err
 		}
@@ -259,15 +284,18 @@ func fullOutputYAML(out io.Writer, args ...runtime.Object) error {
 	return nil
 }
 
-func fullClusterSpecs(clusters []*api.Cluster) ([]*api.Cluster, error) {
+func fullClusterSpecs(clientset simple.Clientset, clusters []*api.Cluster) ([]*api.Cluster, error) {
 	var fullSpecs []*api.Cluster
 	for _, cluster := range clusters {
 		configBase, err := registry.ConfigBase(cluster)
 		if err != nil {
 			return nil, fmt.Errorf("error reading full cluster spec for %q: %v", cluster.ObjectMeta.Name, err)
 		}
-		fullSpec := &api.Cluster{}
-		err = registry.ReadConfigDeprecated(configBase.Join(registry.PathClusterCompleted), fullSpec)
+		secretStore, err := clientset.SecretStore(cluster)
+		if err != nil {
+			return nil, fmt.Errorf("error reading full cluster spec for %q: %v", cluster.ObjectMeta.Name, err)
+		}
+		fullSpec, err := cloudup.ReadCompletedCluster(cluster, configBase, secretStore)
 		if err != nil {
 			return nil, fmt.Errorf("error reading full cluster spec for %q: %v", cluster.ObjectMeta.Name, err)
 		}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/testutils"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup"
+)
+
+// TestGetClusterFullSealedState checks that get cluster --full reads the completed cluster spec of a cluster
+// that seals its state with encryption, which is not stored as plaintext
+func TestGetClusterFullSealedState(t *testing.T) {
+	h := testutils.NewIntegrationTestHarness(t)
+	defer h.Close()
+
+	h.SetupMockAWS()
+
+	clusterName := "minimal.example.com"
+	factoryOptions := &util.FactoryOptions{}
+	factoryOptions.RegistryPath = "memfs://tests"
+	factory := util.NewFactory(factoryOptions)
+
+	var stdout bytes.Buffer
+	{
+		options := &CreateOptions{}
+		options.Filenames = []string{path.Join(updateClusterTestBase, "minimal", "in-v1alpha2.yaml")}
+		if err := RunCreate(factory, &stdout, options); err != nil {
+			t.Fatalf("error creating cluster: %v", err)
+		}
+	}
+
+	clientset, err := factory.Clientset()
+	if err != nil {
+		t.Fatalf("error building clientset: %v", err)
+	}
+	cluster, err := clientset.GetCluster(clusterName)
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	cluster.Spec.SealedState = &kops.SealedStateSpec{Encrypt: fi.Bool(true)}
+	if _, err := clientset.UpdateCluster(cluster, nil); err != nil {
+		t.Fatalf("error updating cluster: %v", err)
+	}
+
+	configBase, err := registry.ConfigBase(cluster)
+	if err != nil {
+		t.Fatalf("error building ConfigBase: %v", err)
+	}
+	secretStore, err := clientset.SecretStore(cluster)
+	if err != nil {
+		t.Fatalf("error building secret store: %v", err)
+	}
+	fullCluster := cluster.DeepCopy()
+	fullCluster.Spec.MasterInternalName = "api.internal.sealed.example.com"
+	if err := cloudup.WriteCompletedCluster(cluster, configBase, secretStore, fullCluster); err != nil {
+		t.Fatalf("error writing completed cluster spec: %v", err)
+	}
+
+	stored, err := configBase.Join(registry.PathClusterCompleted).ReadFile()
+	if err != nil {
+		t.Fatalf("error reading stored cluster spec: %v", err)
+	}
+	if strings.Contains(string(stored), "api.internal.sealed.example.com") {
+		t.Fatalf("completed cluster spec is stored as plaintext")
+	}
+
+	stdout.Reset()
+	options := &GetClusterOptions{
+		GetOptions:   &GetOptions{output: OutputYaml},
+		FullSpec:     true,
+		ClusterNames: []string{clusterName},
+	}
+	if err := RunGetClusters(factory, &stdout, options); err != nil {
+		t.Fatalf("error running get cluster --full: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "masterInternalName: api.internal.sealed.example.com") {
+		t.Errorf("get cluster --full did not show the completed cluster spec:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/cmd/kops/util"
+	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup"
+	"k8s.io/kops/util/pkg/tables"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	getDriftLong = templates.LongDesc(i18n.T(`
+	Compare the live cloud resources of a cluster with the cluster spec.
+
+	The resources that kops update cluster would create, modify or delete are
+	reported, with the expected and actual value of each field that differs.
+	The command exits with status 2 if any drift is found, so it can be used
+	to detect resources that have been changed outside of kops.`))
+
+	getDriftExample = templates.Examples(i18n.T(`
+	# Check a cluster for drift
+	kops get drift --name k8s-cluster.example.com
+
+	# Report the drift as json, for processing in CI
+	kops get drift --name k8s-cluster.example.com -o json`))
+
+	getDriftShort = i18n.T(`Get the differences between the cloud resources and the cluster spec.`)
+)
+
+type GetDriftOptions struct {
+	*GetOptions
+}
+
+func NewCmdGetDrift(f *util.Factory, out io.Writer, getOptions *GetOptions) *cobra.Command {
+	options := GetDriftOptions{
+		GetOptions: getOptions,
+	}
+
+	cmd := &cobra.Command{
+		Use:     "drift",
+		Short:   getDriftShort,
+		Long:    getDriftLong,
+		Example: getDriftExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			drift, err := RunGetDrift(f, &options, out)
+			if err != nil {
+				exitWithError(err)
+			}
+			// As with validate, exit non-zero if we found drift, even though the command succeeded
+			if len(drift) != 0 {
+				os.Exit(2)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func RunGetDrift(f *util.Factory, options *GetDriftOptions, out io.Writer) ([]*fi.Drift, error) {
+	cluster, err := rootCommand.Cluster()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := f.Clientset()
+	if err != nil {
+		return nil, err
+	}
+
+	var instanceGroups []*api.InstanceGroup
+	{
+		list, err := clientset.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			instanceGroups = append(instanceGroups, &list.Items[i])
+		}
+	}
+
+	applyCmd := &cloudup.ApplyClusterCmd{
+		Clientset:       clientset,
+		Cluster:         cluster,
+		DryRun:          true,
+		DryRunOut:       ioutil.Discard,
+		InstanceGroups:  instanceGroups,
+		MaxTaskDuration: cloudup.DefaultMaxTaskDuration,
+		Models:          cloudup.CloudupModels,
+		TargetName:      cloudup.TargetDryRun,
+	}
+	if err := applyCmd.Run(); err != nil {
+		return nil, err
+	}
+
+	drift, err := applyCmd.Target.(*fi.DryRunTarget).Drift(applyCmd.TaskMap)
+	if err != nil {
+		return nil, err
+	}
+
+	switch options.output {
+	case OutputTable:
+		if len(drift) == 0 {
+			fmt.Fprintf(out, "No drift found for cluster %q\n", cluster.ObjectMeta.Name)
+			return drift, nil
+		}
+		return drift, driftOutputTable(drift, out)
+
+	case OutputYaml:
+		b, err := api.ToRawYaml(drift)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling yaml: %v", err)
+		}
+		if _, err := out.Write(b); err != nil {
+			return nil, fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return drift, nil
+
+	case OutputJSON:
+		if drift == nil {
+			// Print an empty list rather than null
+			drift = []*fi.Drift{}
+		}
+		b, err := json.MarshalIndent(drift, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling json: %v", err)
+		}
+		if _, err := out.Write(b); err != nil {
+			return nil, fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return drift, nil
+
+	default:
+		return nil, fmt.Errorf("Unknown output format: %q", options.output)
+	}
+}
+
+func driftOutputTable(drift []*fi.Drift, out io.Writer) error {
+	t := &tables.Table{}
+	t.AddColumn("TYPE", func(d *fi.Drift) string {
+		return d.TaskType
+	})
+	t.AddColumn("NAME", func(d *fi.Drift) string {
+		return d.TaskName
+	})
+	t.AddColumn("DRIFT", func(d *fi.Drift) string {
+		return string(d.Type)
+	})
+	t.AddColumn("FIELD", func(d *fi.Drift) string {
+		return d.Field
+	})
+	t.AddColumn("EXPECTED", func(d *fi.Drift) string {
+		return firstLine(d.Expected)
+	})
+	t.AddColumn("ACTUAL", func(d *fi.Drift) string {
+		return firstLine(d.Actual)
+	})
+	return t.Render(drift, out, "TYPE", "NAME", "DRIFT", "FIELD", "EXPECTED", "ACTUAL")
+}
+
+// firstLine shortens multi-line values, such as the contents of resources, so they fit in a table
+func firstLine(s string) string {
+	if i := strings.Index(s, "\n"); i != -1 {
+		return s[:i] + " ..."
+	}
+	return s
+}
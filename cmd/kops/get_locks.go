@@ -0,0 +1,207 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/cmd/kops/util"
+	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/statelock"
+	"k8s.io/kops/util/pkg/tables"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	getLocksLong = templates.LongDesc(i18n.T(`
+	Display the state store locks held on clusters.
+
+	kops update cluster, rolling-update cluster, delete cluster and upgrade cluster hold a lock
+	on the cluster while they make changes, so that they do not run at the same time as each other.
+	The lock is renewed while the command runs, and expires if it is not renewed, for example
+	because the command was interrupted.  A lock that is no longer needed can be removed with
+	kops delete lock.`))
+
+	getLocksExample = templates.Examples(i18n.T(`
+	# Get the locks on all clusters in the state store
+	kops get locks
+
+	# Get the lock on a cluster
+	kops get locks --name k8s-cluster.example.com`))
+
+	getLocksShort = i18n.T(`Get the state store locks held on clusters.`)
+)
+
+type GetLocksOptions struct {
+	*GetOptions
+
+	// ClusterNames is a list of cluster names to show; if not specified all clusters will be shown
+	ClusterNames []string
+}
+
+// lockInfo is the output of kops get locks
+type lockInfo struct {
+	Cluster string `json:"cluster"`
+	*statelock.Lock
+	Expired bool `json:"expired"`
+}
+
+func NewCmdGetLocks(f *util.Factory, out io.Writer, getOptions *GetOptions) *cobra.Command {
+	options := GetLocksOptions{
+		GetOptions: getOptions,
+	}
+
+	cmd := &cobra.Command{
+		Use:     "locks",
+		Aliases: []string{"lock"},
+		Short:   getLocksShort,
+		Long:    getLocksLong,
+		Example: getLocksExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.ClusterNames = append(options.ClusterNames, args...)
+
+			if rootCommand.clusterName != "" {
+				if len(args) != 0 {
+					exitWithError(fmt.Errorf("cannot mix --name for cluster with positional arguments"))
+				}
+
+				options.ClusterNames = append(options.ClusterNames, rootCommand.clusterName)
+			}
+
+			err := RunGetLocks(f, out, &options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func RunGetLocks(f *util.Factory, out io.Writer, options *GetLocksOptions) error {
+	clientset, err := f.Clientset()
+	if err != nil {
+		return err
+	}
+
+	var clusters []*api.Cluster
+	if len(options.ClusterNames) == 0 {
+		list, err := clientset.ListClusters(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range list.Items {
+			clusters = append(clusters, &list.Items[i])
+		}
+	} else {
+		for _, clusterName := range options.ClusterNames {
+			cluster, err := GetCluster(f, clusterName)
+			if err != nil {
+				return err
+			}
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	var locks []*lockInfo
+	now := time.Now()
+	for _, cluster := range clusters {
+		lock, err := statelock.Read(cluster)
+		if err != nil {
+			return err
+		}
+		if lock == nil {
+			continue
+		}
+		locks = append(locks, &lockInfo{
+			Cluster: cluster.ObjectMeta.Name,
+			Lock:    lock,
+			Expired: lock.IsExpired(now),
+		})
+	}
+
+	switch options.output {
+	case OutputTable:
+		if len(locks) == 0 {
+			fmt.Fprintf(out, "No locks found\n")
+			return nil
+		}
+		return locksOutputTable(locks, out)
+
+	case OutputYaml:
+		b, err := api.ToRawYaml(locks)
+		if err != nil {
+			return fmt.Errorf("error marshaling yaml: %v", err)
+		}
+		if _, err := out.Write(b); err != nil {
+			return fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return nil
+
+	case OutputJSON:
+		if locks == nil {
+			// Print an empty list rather than null
+			locks = []*lockInfo{}
+		}
+		b, err := json.MarshalIndent(locks, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling json: %v", err)
+		}
+		if _, err := out.Write(b); err != nil {
+			return fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("Unknown output format: %q", options.output)
+	}
+}
+
+func locksOutputTable(locks []*lockInfo, out io.Writer) error {
+	t := &tables.Table{}
+	t.AddColumn("CLUSTER", func(l *lockInfo) string {
+		return l.Cluster
+	})
+	t.AddColumn("OWNER", func(l *lockInfo) string {
+		return l.Owner
+	})
+	t.AddColumn("OPERATION", func(l *lockInfo) string {
+		return l.Operation
+	})
+	t.AddColumn("ACQUIRED", func(l *lockInfo) string {
+		return l.Acquired.UTC().Format(time.RFC3339)
+	})
+	t.AddColumn("HEARTBEAT", func(l *lockInfo) string {
+		return l.Heartbeat.UTC().Format(time.RFC3339)
+	})
+	t.AddColumn("EXPIRES", func(l *lockInfo) string {
+		return l.Expires.UTC().Format(time.RFC3339)
+	})
+	t.AddColumn("STATUS", func(l *lockInfo) string {
+		if l.Expired {
+			return "expired"
+		}
+		return "held"
+	})
+	return t.Render(locks, out, "CLUSTER", "OWNER", "OPERATION", "ACQUIRED", "HEARTBEAT", "EXPIRES", "STATUS")
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/instancegroups"
+	"k8s.io/kops/util/pkg/tables"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	getRollingUpdateLong = templates.LongDesc(i18n.T(`
+	Display the progress of the most recent rolling update of a cluster.
+
+	The progress is recorded in the state store while a rolling update runs, so
+	an interrupted rolling update can be inspected, and then continued with
+	kops rolling-update cluster --resume.`))
+
+	getRollingUpdateExample = templates.Examples(i18n.T(`
+	# Get the progress of the rolling update of a cluster
+	kops get rolling-update --name k8s-cluster.example.com
+
+	# Get the full progress, including each instance, as yaml
+	kops get rolling-update --name k8s-cluster.example.com -o yaml`))
+
+	getRollingUpdateShort = i18n.T(`Get the progress of a rolling update.`)
+)
+
+type GetRollingUpdateOptions struct {
+	*GetOptions
+}
+
+func NewCmdGetRollingUpdate(f *util.Factory, out io.Writer, getOptions *GetOptions) *cobra.Command {
+	options := GetRollingUpdateOptions{
+		GetOptions: getOptions,
+	}
+
+	cmd := &cobra.Command{
+		Use:     "rolling-update",
+		Aliases: []string{"rollingupdate"},
+		Short:   getRollingUpdateShort,
+		Long:    getRollingUpdateLong,
+		Example: getRollingUpdateExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunGetRollingUpdate(&options, out)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func RunGetRollingUpdate(options *GetRollingUpdateOptions, out io.Writer) error {
+	cluster, err := rootCommand.Cluster()
+	if err != nil {
+		return err
+	}
+
+	clientset, err := rootCommand.Clientset()
+	if err != nil {
+		return err
+	}
+
+	configBase, err := clientset.ConfigBaseFor(cluster)
+	if err != nil {
+		return err
+	}
+
+	progress, err := instancegroups.NewVFSProgressStore(cluster, configBase).Read()
+	if err != nil {
+		return err
+	}
+
+	if progress == nil {
+		return fmt.Errorf("No rolling update found for cluster %q", cluster.ObjectMeta.Name)
+	}
+
+	switch options.output {
+	case OutputTable:
+		return rollingUpdateOutputTable(progress, out)
+
+	case OutputYaml:
+		b, err := api.ToRawYaml(progress)
+		if err != nil {
+			return fmt.Errorf("error marshaling yaml: %v", err)
+		}
+		_, err = out.Write(b)
+		if err != nil {
+			return fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return nil
+
+	case OutputJSON:
+		b, err := json.MarshalIndent(progress, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling json: %v", err)
+		}
+		_, err = out.Write(b)
+		if err != nil {
+			return fmt.Errorf("error writing to stdout: %v", err)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("Unknown output format: %q", options.output)
+	}
+}
+
+func rollingUpdateOutputTable(progress *instancegroups.RollingUpdateProgress, out io.Writer) error {
+	fmt.Fprintf(out, "Rolling update of %s: %s (started %s, last updated %s)\n", progress.ClusterName, progress.Status, progress.StartTime.Format(time.RFC3339), progress.UpdateTime.Format(time.RFC3339))
+	if progress.Error != "" {
+		fmt.Fprintf(out, "Error: %s\n", progress.Error)
+	}
+	fmt.Fprintf(out, "\n")
+
+	t := &tables.Table{}
+	t.AddColumn("NAME", func(g *instancegroups.InstanceGroupProgress) string {
+		return g.Name
+	})
+	t.AddColumn("STATUS", func(g *instancegroups.InstanceGroupProgress) string {
+		return string(g.Status)
+	})
+	t.AddColumn("REPLACED", func(g *instancegroups.InstanceGroupProgress) string {
+		replaced := 0
+		for _, i := range g.Instances {
+			if i.Status == instancegroups.ProgressStatusTerminated {
+				replaced++
+			}
+		}
+		return fmt.Sprintf("%d/%d", replaced, len(g.Instances))
+	})
+	t.AddColumn("STARTED", func(g *instancegroups.InstanceGroupProgress) string {
+		return timePointerToString(g.StartTime)
+	})
+	t.AddColumn("COMPLETED", func(g *instancegroups.InstanceGroupProgress) string {
+		return timePointerToString(g.CompletionTime)
+	})
+	t.AddColumn("VALIDATION", func(g *instancegroups.InstanceGroupProgress) string {
+		if len(g.Validations) == 0 {
+			return "-"
+		}
+		if g.Validations[len(g.Validations)-1].Succeeded {
+			return "Succeeded"
+		}
+		return "Failed"
+	})
+	t.AddColumn("ERROR", func(g *instancegroups.InstanceGroupProgress) string {
+		return g.Error
+	})
+	return t.Render(progress.InstanceGroups, os.Stdout, "NAME", "STATUS", "REPLACED", "STARTED", "COMPLETED", "VALIDATION", "ERROR")
+}
+
+func timePointerToString(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
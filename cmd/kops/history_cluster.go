@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/util/pkg/tables"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	historyClusterLong = templates.LongDesc(i18n.T(`
+	List the revisions of a cluster configuration.
+
+	A revision is recorded each time the cluster configuration is written to the state store,
+	for example by kops edit cluster, kops replace or kops set cluster, with the user who wrote it
+	and the changes from the previous revision.  A revision can be shown with
+	kops get cluster --revision, and restored with kops rollback cluster.`))
+
+	historyClusterExample = templates.Examples(i18n.T(`
+	# List the revisions of a cluster
+	kops history cluster k8s-cluster.example.com
+
+	# Show the changes made by each revision
+	kops history cluster k8s-cluster.example.com --diff
+	`))
+
+	historyClusterShort = i18n.T(`List the revisions of a cluster.`)
+)
+
+type HistoryClusterOptions struct {
+	ClusterName string
+
+	// Diff is true if the changes made by each revision should be shown
+	Diff bool
+}
+
+func NewCmdHistoryCluster(f *util.Factory, out io.Writer) *cobra.Command {
+	options := &HistoryClusterOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "cluster",
+		Aliases: []string{"clusters"},
+		Short:   historyClusterShort,
+		Long:    historyClusterLong,
+		Example: historyClusterExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rootCommand.ProcessArgs(args); err != nil {
+				exitWithError(err)
+			}
+
+			options.ClusterName = rootCommand.ClusterName()
+
+			err := RunHistoryCluster(f, out, options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&options.Diff, "diff", options.Diff, "Show the changes made by each revision")
+
+	return cmd
+}
+
+func RunHistoryCluster(f *util.Factory, out io.Writer, options *HistoryClusterOptions) error {
+	if options.ClusterName == "" {
+		return fmt.Errorf("ClusterName is required")
+	}
+
+	clientset, err := f.Clientset()
+	if err != nil {
+		return err
+	}
+
+	revisions, err := clientset.ListClusterRevisions(options.ClusterName)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		fmt.Fprintf(out, "No revisions recorded for cluster %q\n", options.ClusterName)
+		return nil
+	}
+
+	if options.Diff {
+		for _, r := range revisions {
+			fmt.Fprintf(out, "Revision %d by %s at %s\n", r.Revision, revisionAuthor(r), r.Timestamp.Format(time.RFC3339))
+			if r.Diff == "" {
+				fmt.Fprintf(out, "  (initial revision)\n\n")
+				continue
+			}
+			fmt.Fprintf(out, "%s\n", r.Diff)
+		}
+		return nil
+	}
+
+	t := &tables.Table{}
+	t.AddColumn("REVISION", func(r *simple.Revision) string {
+		return strconv.Itoa(r.Revision)
+	})
+	t.AddColumn("AUTHOR", revisionAuthor)
+	t.AddColumn("TIMESTAMP", func(r *simple.Revision) string {
+		return r.Timestamp.Format(time.RFC3339)
+	})
+	t.AddColumn("CHANGES", func(r *simple.Revision) string {
+		if r.Diff == "" {
+			return ""
+		}
+		added, removed := 0, 0
+		for _, line := range strings.Split(r.Diff, "\n") {
+			if strings.HasPrefix(line, "+ ") {
+				added++
+			} else if strings.HasPrefix(line, "- ") {
+				removed++
+			}
+		}
+		return fmt.Sprintf("+%d -%d", added, removed)
+	})
+	return t.Render(revisions, out, "REVISION", "AUTHOR", "TIMESTAMP", "CHANGES")
+}
+
+// revisionAuthor returns the author of a revision for display; revisions recorded from the configuration
+// that existed before revisions were recorded have no author
+func revisionAuthor(r *simple.Revision) string {
+	if r.Author == "" {
+		return "<unknown>"
+	}
+	return r.Author
+}
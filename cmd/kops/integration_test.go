@@ -57,6 +57,11 @@ func TestMinimal(t *testing.T) {
 	runTestAWS(t, "minimal.example.com", "minimal", "v1alpha2", false, 1)
 }
 
+// TestMinimalTerraformJSON runs the test on a minimum configuration, writing the terraform output in the JSON syntax
+func TestMinimalTerraformJSON(t *testing.T) {
+	runTestAWSTarget(t, "minimal.example.com", "minimal-json", "v1alpha2", false, 1, cloudup.TargetTerraformJSON, false)
+}
+
 // TestHA runs the test on a simple HA configuration, similar to kops create cluster minimal.example.com --zones us-west-1a,us-west-1b,us-west-1c --master-count=3
 func TestHA(t *testing.T) {
 	runTestAWS(t, "ha.example.com", "ha", "v1alpha1", false, 3)
@@ -143,6 +148,16 @@ func TestSharedSubnet(t *testing.T) {
 	runTestAWS(t, "sharedsubnet.example.com", "shared_subnet", "v1alpha2", false, 1)
 }
 
+// TestMinimalTerraformModule runs the test on a minimum configuration, writing a terraform module
+func TestMinimalTerraformModule(t *testing.T) {
+	runTestAWSTarget(t, "minimal.example.com", "minimal-module", "v1alpha2", false, 1, cloudup.TargetTerraform, true)
+}
+
+// TestSharedSubnetTerraformModule runs the test on a configuration with a shared subnet, writing a terraform module
+func TestSharedSubnetTerraformModule(t *testing.T) {
+	runTestAWSTarget(t, "sharedsubnet.example.com", "shared_subnet-module", "v1alpha2", false, 1, cloudup.TargetTerraform, true)
+}
+
 // TestSharedVPC runs the test on a configuration with a shared VPC
 func TestSharedVPC(t *testing.T) {
 	runTestAWS(t, "sharedvpc.example.com", "shared_vpc", "v1alpha2", false, 1)
@@ -166,13 +181,17 @@ func TestPhaseCluster(t *testing.T) {
 	runTestPhase(t, "lifecyclephases.example.com", "lifecycle_phases", "v1alpha2", true, 1, cloudup.PhaseCluster)
 }
 
-func runTest(t *testing.T, h *testutils.IntegrationTestHarness, clusterName string, srcDir string, version string, private bool, zones int, expectedFilenames []string, tfFileName string, phase *cloudup.Phase) {
+func runTest(t *testing.T, h *testutils.IntegrationTestHarness, clusterName string, srcDir string, version string, private bool, zones int, expectedFilenames []string, tfFileName string, phase *cloudup.Phase, target string, terraformModule bool) {
 	var stdout bytes.Buffer
 
 	srcDir = updateClusterTestBase + srcDir
 	inputYAML := "in-" + version + ".yaml"
 	testDataTFPath := "kubernetes.tf"
 	actualTFPath := "kubernetes.tf"
+	if target == cloudup.TargetTerraformJSON {
+		testDataTFPath = "kubernetes.tf.json"
+		actualTFPath = "kubernetes.tf.json"
+	}
 
 	if tfFileName != "" {
 		testDataTFPath = tfFileName
@@ -208,7 +227,8 @@ func runTest(t *testing.T, h *testutils.IntegrationTestHarness, clusterName stri
 	{
 		options := &UpdateClusterOptions{}
 		options.InitDefaults()
-		options.Target = "terraform"
+		options.Target = target
+		options.TerraformModule = terraformModule
 		options.OutDir = path.Join(h.TempDir, "out")
 		options.MaxTaskDuration = 30 * time.Second
 		if phase != nil {
@@ -238,10 +258,10 @@ func runTest(t *testing.T, h *testutils.IntegrationTestHarness, clusterName stri
 		sort.Strings(fileNames)
 
 		actualFilenames := strings.Join(fileNames, ",")
-		expected := "kubernetes.tf"
+		expected := actualTFPath
 
 		if len(expectedFilenames) > 0 {
-			expected = "data,kubernetes.tf"
+			expected = "data," + actualTFPath
 		}
 
 		if actualFilenames != expected {
@@ -322,6 +342,10 @@ func runTest(t *testing.T, h *testutils.IntegrationTestHarness, clusterName stri
 }
 
 func runTestAWS(t *testing.T, clusterName string, srcDir string, version string, private bool, zones int) {
+	runTestAWSTarget(t, clusterName, srcDir, version, private, zones, cloudup.TargetTerraform, false)
+}
+
+func runTestAWSTarget(t *testing.T, clusterName string, srcDir string, version string, private bool, zones int, target string, terraformModule bool) {
 	h := testutils.NewIntegrationTestHarness(t)
 	defer h.Close()
 
@@ -356,7 +380,7 @@ func runTestAWS(t *testing.T, clusterName string, srcDir string, version string,
 	if srcDir == "bastionadditional_user-data" {
 		expectedFilenames = append(expectedFilenames, "aws_launch_configuration_bastion."+clusterName+"_user_data")
 	}
-	runTest(t, h, clusterName, srcDir, version, private, zones, expectedFilenames, "", nil)
+	runTest(t, h, clusterName, srcDir, version, private, zones, expectedFilenames, "", nil, target, terraformModule)
 }
 
 func runTestPhase(t *testing.T, clusterName string, srcDir string, version string, private bool, zones int, phase cloudup.Phase) {
@@ -402,7 +426,7 @@ func runTestPhase(t *testing.T, clusterName string, srcDir string, version strin
 		}
 	}
 
-	runTest(t, h, clusterName, srcDir, version, private, zones, expectedFilenames, tfFileName, &phase)
+	runTest(t, h, clusterName, srcDir, version, private, zones, expectedFilenames, tfFileName, &phase, cloudup.TargetTerraform, false)
 }
 
 func runTestGCE(t *testing.T, clusterName string, srcDir string, version string, private bool, zones int) {
@@ -427,7 +451,7 @@ func runTestGCE(t *testing.T, clusterName string, srcDir string, version string,
 		expectedFilenames = append(expectedFilenames, prefix+"startup-script")
 	}
 
-	runTest(t, h, clusterName, srcDir, version, private, zones, expectedFilenames, "", nil)
+	runTest(t, h, clusterName, srcDir, version, private, zones, expectedFilenames, "", nil, cloudup.TargetTerraform, false)
 }
 
 func runTestCloudformation(t *testing.T, clusterName string, srcDir string, version string, private bool) {
@@ -0,0 +1,51 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	reconcileLong = templates.LongDesc(i18n.T(`
+	Apply resources from the state store whenever their configuration changes, recording the outcome in their status.`))
+
+	reconcileExample = templates.Examples(i18n.T(`
+	# Keep a cluster in the state described by the state store
+	kops reconcile cluster k8s-cluster.example.com --watch`))
+
+	reconcileShort = i18n.T(`Continuously apply resources from the state store.`)
+)
+
+func NewCmdReconcile(f *util.Factory, out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "reconcile",
+		Short:   reconcileShort,
+		Long:    reconcileLong,
+		Example: reconcileExample,
+	}
+
+	// create subcommands
+	cmd.AddCommand(NewCmdReconcileCluster(f, out))
+
+	return cmd
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	kopsapi "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/reconciler"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	reconcileClusterLong = templates.LongDesc(i18n.T(`
+	Apply the cluster and its instance groups whenever their configuration in the state store changes,
+	and again every --interval, as kops update cluster --yes does.  The outcome is recorded in the
+	status of the cluster, as the Reconciled and Paused conditions.
+
+	Without --watch, the cluster is applied once.  With --watch, the command runs until it is
+	interrupted: the state store is read every --poll-interval, and changes to the cluster are
+	also picked up as soon as they are made if the state store is a Kubernetes cluster.
+
+	The cluster is not applied while it has the annotation kops.kubernetes.io/reconcile-paused=true,
+	or while another operation, such as a rolling update, holds the lock on the cluster.`))
+
+	reconcileClusterExample = templates.Examples(i18n.T(`
+	# Apply the cluster once, recording the outcome in its status
+	kops reconcile cluster k8s-cluster.example.com
+
+	# Keep applying the cluster, serving Prometheus metrics
+	kops reconcile cluster k8s-cluster.example.com --watch --metrics-listen=:9090
+
+	# Pause reconciliation while making manual changes
+	kops edit cluster k8s-cluster.example.com
+	# ... and add under metadata:
+	#   annotations:
+	#     kops.kubernetes.io/reconcile-paused: "true"`))
+
+	reconcileClusterShort = i18n.T(`Continuously apply a cluster from the state store.`)
+)
+
+type ReconcileClusterOptions struct {
+	// watch keeps reconciling the cluster until the command is interrupted
+	watch bool
+	// interval is the period after which the cluster is applied again, even if its configuration has not changed
+	interval time.Duration
+	// pollInterval is the period at which the state store is read to detect changes
+	pollInterval time.Duration
+	// metricsListen is the address on which reconciliation metrics are served while watching
+	metricsListen string
+}
+
+func (o *ReconcileClusterOptions) InitDefaults() {
+	o.interval = reconciler.DefaultInterval
+	o.pollInterval = reconciler.DefaultPollInterval
+}
+
+func NewCmdReconcileCluster(f *util.Factory, out io.Writer) *cobra.Command {
+	options := &ReconcileClusterOptions{}
+	options.InitDefaults()
+
+	cmd := &cobra.Command{
+		Use:     "cluster",
+		Short:   reconcileClusterShort,
+		Long:    reconcileClusterLong,
+		Example: reconcileClusterExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := rootCommand.ProcessArgs(args)
+			if err != nil {
+				exitWithError(err)
+			}
+
+			if err := RunReconcileCluster(f, rootCommand.ClusterName(), out, options); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&options.watch, "watch", options.watch, "Keep applying the cluster until interrupted")
+	cmd.Flags().DurationVar(&options.interval, "interval", options.interval, "Apply the cluster again after this period even if it has not changed; 0 only applies changes")
+	cmd.Flags().DurationVar(&options.pollInterval, "poll-interval", options.pollInterval, "How often to read the state store for changes when watching")
+	cmd.Flags().StringVar(&options.metricsListen, "metrics-listen", options.metricsListen, "Address on which to serve Prometheus metrics while watching, e.g. :9090")
+
+	return cmd
+}
+
+func RunReconcileCluster(f *util.Factory, clusterName string, out io.Writer, options *ReconcileClusterOptions) error {
+	if clusterName == "" {
+		return fmt.Errorf("--name is required")
+	}
+	if options.metricsListen != "" && !options.watch {
+		return fmt.Errorf("--metrics-listen can only be used with --watch")
+	}
+	if options.interval < 0 {
+		return fmt.Errorf("--interval must not be negative")
+	}
+	if options.pollInterval <= 0 {
+		return fmt.Errorf("--poll-interval must be positive")
+	}
+
+	clientset, err := f.Clientset()
+	if err != nil {
+		return err
+	}
+
+	r := &reconciler.Reconciler{
+		Clientset:    clientset,
+		ClusterName:  clusterName,
+		Interval:     options.interval,
+		PollInterval: options.pollInterval,
+	}
+
+	if !options.watch {
+		result, err := r.Reconcile()
+		if err != nil {
+			return err
+		}
+		switch {
+		case result.Paused:
+			fmt.Fprintf(out, "Reconciliation of cluster %q is paused by the annotation %s\n", clusterName, kopsapi.AnnotationNameReconcilePaused)
+		case result.Locked:
+			return fmt.Errorf("cluster %q is locked by another operation", clusterName)
+		case result.ApplyError != nil:
+			return fmt.Errorf("error applying cluster %q: %v", clusterName, result.ApplyError)
+		default:
+			fmt.Fprintf(out, "Cluster %q is reconciled\n", clusterName)
+		}
+		return nil
+	}
+
+	r.Metrics = reconciler.NewMetrics(clusterName)
+
+	serveErrors := make(chan error, 1)
+	if options.metricsListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", r.Metrics)
+		go func() {
+			serveErrors <- http.ListenAndServe(options.metricsListen, mux)
+		}()
+		glog.Infof("Serving reconciliation metrics on %s/metrics", options.metricsListen)
+	}
+
+	// An interrupt stops the reconciler once the current apply finishes; a second interrupt exits immediately
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		glog.Infof("Stopping after the current reconciliation")
+		signal.Stop(signals)
+		close(stop)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		r.Run(stop)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case err := <-serveErrors:
+		return fmt.Errorf("error serving metrics on %q: %v", options.metricsListen, err)
+	}
+}
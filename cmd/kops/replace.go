@@ -24,7 +24,9 @@ import (
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/kops/cmd/kops/util"
 	kopsapi "k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/commands"
@@ -140,6 +142,11 @@ func RunReplace(f *util.Factory, cmd *cobra.Command, out io.Writer, c *replaceOp
 					} else {
 						_, err = clientset.UpdateCluster(v, status)
 						if err != nil {
+							if errors.IsConflict(err) {
+								return replaceConflict(out, err, f, fmt.Sprintf("cluster %q", clusterName), v, func() (runtime.Object, error) {
+									return clientset.GetCluster(clusterName)
+								})
+							}
 							return fmt.Errorf("error replacing cluster: %v", err)
 						}
 					}
@@ -180,6 +187,11 @@ func RunReplace(f *util.Factory, cmd *cobra.Command, out io.Writer, c *replaceOp
 				default:
 					_, err = clientset.InstanceGroupsFor(cluster).Update(v)
 					if err != nil {
+						if errors.IsConflict(err) {
+							return replaceConflict(out, err, f, fmt.Sprintf("instanceGroup %q", igName), v, func() (runtime.Object, error) {
+								return clientset.InstanceGroupsFor(cluster).Get(igName, metav1.GetOptions{})
+							})
+						}
 						return fmt.Errorf("error replacing instanceGroup: %v", err)
 					}
 				}
@@ -192,3 +204,20 @@ func RunReplace(f *util.Factory, cmd *cobra.Command, out io.Writer, c *replaceOp
 
 	return nil
 }
+
+// replaceConflict reports that the object in the file was not written because the object in the state store
+// has changed since the file was written, showing the changes that replacing the current object would make
+func replaceConflict(out io.Writer, err error, filename string, description string, replacement runtime.Object, getCurrent func() (runtime.Object, error)) error {
+	current, getErr := getCurrent()
+	if getErr != nil {
+		return fmt.Errorf("%v (error reading current configuration: %v)", err, getErr)
+	}
+	if err := writeConflictDiff(out, fmt.Sprintf("Replacing the current %s with %q would make these changes", description, filename), current, replacement); err != nil {
+		return err
+	}
+	objectMeta, metaErr := meta.Accessor(current)
+	if metaErr != nil {
+		return metaErr
+	}
+	return fmt.Errorf("%v\nupdate metadata.resourceVersion in %q to %q and run kops replace again to apply these changes", err, filename, objectMeta.GetResourceVersion())
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	rollbackLong = templates.LongDesc(i18n.T(`
+	Restore resources to a revision recorded in the state store.`))
+
+	rollbackExample = templates.Examples(i18n.T(`
+	# Restore the configuration of a cluster to revision 3
+	kops rollback cluster k8s-cluster.example.com --to-revision 3 --yes`))
+
+	rollbackShort = i18n.T(`Restore resources to a previous revision.`)
+)
+
+func NewCmdRollback(f *util.Factory, out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "rollback",
+		Short:   rollbackShort,
+		Long:    rollbackLong,
+		Example: rollbackExample,
+	}
+
+	// create subcommands
+	cmd.AddCommand(NewCmdRollbackCluster(f, out))
+
+	return cmd
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/commands"
+	"k8s.io/kops/pkg/diff"
+	"k8s.io/kops/pkg/kopscodecs"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	rollbackClusterLong = templates.LongDesc(i18n.T(`
+	Restore the configuration of a cluster to a revision listed by kops history cluster.
+
+	The restored configuration is validated and written to the state store as a new revision,
+	so a rollback can itself be rolled back.  Only the cluster configuration is restored; the
+	instance groups are not changed.  Run kops update cluster to apply the restored configuration.`))
+
+	rollbackClusterExample = templates.Examples(i18n.T(`
+	# Show the changes that restoring revision 3 would make
+	kops rollback cluster k8s-cluster.example.com --to-revision 3
+
+	# Restore revision 3
+	kops rollback cluster k8s-cluster.example.com --to-revision 3 --yes
+	`))
+
+	rollbackClusterShort = i18n.T(`Restore a cluster configuration to a previous revision.`)
+)
+
+type RollbackClusterOptions struct {
+	ClusterName string
+
+	// ToRevision is the revision to restore
+	ToRevision int
+
+	Yes bool
+}
+
+func NewCmdRollbackCluster(f *util.Factory, out io.Writer) *cobra.Command {
+	options := &RollbackClusterOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "cluster",
+		Short:   rollbackClusterShort,
+		Long:    rollbackClusterLong,
+		Example: rollbackClusterExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rootCommand.ProcessArgs(args); err != nil {
+				exitWithError(err)
+			}
+
+			options.ClusterName = rootCommand.ClusterName()
+
+			err := RunRollbackCluster(f, out, options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&options.ToRevision, "to-revision", options.ToRevision, "Revision to restore, as listed by kops history cluster")
+	cmd.Flags().BoolVarP(&options.Yes, "yes", "y", options.Yes, "Restore the revision; without --yes, only the changes that would be made are shown")
+
+	return cmd
+}
+
+func RunRollbackCluster(f *util.Factory, out io.Writer, options *RollbackClusterOptions) error {
+	if options.ToRevision <= 0 {
+		return fmt.Errorf("--to-revision is required")
+	}
+
+	cluster, err := GetCluster(f, options.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	clientset, err := f.Clientset()
+	if err != nil {
+		return err
+	}
+
+	restored, err := clientset.GetClusterRevision(options.ClusterName, options.ToRevision)
+	if err != nil {
+		return err
+	}
+	// The restored revision replaces the cluster as it was read, failing if the cluster is changed concurrently
+	restored.ObjectMeta.ResourceVersion = cluster.ObjectMeta.ResourceVersion
+
+	currentYAML, err := kopscodecs.ToVersionedYaml(cluster)
+	if err != nil {
+		return fmt.Errorf("error serializing cluster: %v", err)
+	}
+	restoredYAML, err := kopscodecs.ToVersionedYaml(restored)
+	if err != nil {
+		return fmt.Errorf("error serializing cluster: %v", err)
+	}
+	if string(currentYAML) == string(restoredYAML) {
+		fmt.Fprintf(out, "The configuration of cluster %q is the same as revision %d\n", options.ClusterName, options.ToRevision)
+		return nil
+	}
+
+	fmt.Fprintf(out, "Restoring revision %d of cluster %q makes these changes:\n\n", options.ToRevision, options.ClusterName)
+	fmt.Fprintf(out, "%s\n", diff.FormatDiff(string(currentYAML), string(restoredYAML)))
+
+	if !options.Yes {
+		fmt.Fprintf(out, "Must specify --yes to restore the revision\n")
+		return nil
+	}
+
+	instanceGroups, err := commands.ReadAllInstanceGroups(clientset, restored)
+	if err != nil {
+		return err
+	}
+	if err := commands.UpdateCluster(clientset, restored, instanceGroups); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Restored revision %d of cluster %q.\n", options.ToRevision, options.ClusterName)
+	fmt.Fprintf(out, "Run kops update cluster %s --yes to apply the restored configuration.\n", options.ClusterName)
+	return nil
+}
@@ -21,16 +21,20 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/kops/cmd/kops/util"
 	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/validation"
 	"k8s.io/kops/pkg/cloudinstances"
 	"k8s.io/kops/pkg/featureflag"
 	"k8s.io/kops/pkg/instancegroups"
@@ -86,6 +90,27 @@ var (
 	      --cloudonly \
 		  --force
 
+		# Roll the k8s-cluster.example.com kops cluster,
+		# adding up to 2 extra nodes to each node instancegroup
+		# while the existing nodes are replaced.
+		kops rolling-update cluster k8s-cluster.example.com --yes \
+		  --max-surge 2
+
+		# Continue a rolling update of the k8s-cluster.example.com
+		# kops cluster that was interrupted, skipping the instances
+		# that were already replaced.
+		kops rolling-update cluster k8s-cluster.example.com --yes \
+		  --resume
+
+		# Roll the k8s-cluster.example.com kops cluster,
+		# replacing one node in each node instancegroup first,
+		# and halting unless the cluster and the cassandra pods
+		# stay healthy for 10 minutes.
+		kops rolling-update cluster k8s-cluster.example.com --yes \
+		  --canary 1 \
+		  --canary-soak-period 10m \
+		  --canary-pod-check db:app=cassandra
+
 		# Roll the k8s-cluster.example.com kops cluster,
 		# only roll the node instancegroup,
 		# use the new drain an validate functionality.
@@ -137,6 +162,27 @@ type RollingUpdateOptions struct {
 	// InstanceGroups is the list of instance groups to rolling-update;
 	// if not specified, all instance groups will be updated
 	InstanceGroups []string
+
+	// MaxSurge overrides the maxSurge of the instance groups; it is an absolute number or a percentage
+	MaxSurge string
+
+	// MaxUnavailable overrides the maxUnavailable of the instance groups; it is an absolute number or a percentage
+	MaxUnavailable string
+
+	// Resume continues the most recent rolling update, if it did not complete
+	Resume bool
+
+	// Canary is the number of instances in each node instance group to replace and check before rolling the rest
+	Canary int
+
+	// CanarySoakPeriod is how long the cluster must stay healthy after the canary instances are replaced
+	CanarySoakPeriod time.Duration
+
+	// CanaryPodChecks are label selectors, optionally prefixed with a namespace, for pods that must be ready for the canaries to pass
+	CanaryPodChecks []string
+
+	// Lock is true if the cluster is locked in the state store while it is updated
+	Lock bool
 }
 
 func (o *RollingUpdateOptions) InitDefaults() {
@@ -154,6 +200,10 @@ func (o *RollingUpdateOptions) InitDefaults() {
 	o.PostDrainDelay = 90 * time.Second
 	o.ValidationTimeout = 5 * time.Minute
 
+	o.Canary = 0
+	o.CanarySoakPeriod = 5 * time.Minute
+
+	o.Lock = true
 }
 
 func NewCmdRollingUpdateCluster(f *util.Factory, out io.Writer) *cobra.Command {
@@ -177,6 +227,13 @@ func NewCmdRollingUpdateCluster(f *util.Factory, out io.Writer) *cobra.Command {
 	cmd.Flags().DurationVar(&options.BastionInterval, "bastion-interval", options.BastionInterval, "Time to wait between restarting bastions")
 	cmd.Flags().BoolVarP(&options.Interactive, "interactive", "i", options.Interactive, "Prompt to continue after each instance is updated")
 	cmd.Flags().StringSliceVar(&options.InstanceGroups, "instance-group", options.InstanceGroups, "List of instance groups to update (defaults to all if not specified)")
+	cmd.Flags().StringVar(&options.MaxSurge, "max-surge", options.MaxSurge, "Number or percentage of extra instances to create in each node instance group while rolling (overrides the instance group setting)")
+	cmd.Flags().StringVar(&options.MaxUnavailable, "max-unavailable", options.MaxUnavailable, "Number or percentage of instances in each instance group that can be replaced at the same time (overrides the instance group setting)")
+	cmd.Flags().BoolVar(&options.Resume, "resume", options.Resume, "Resume the most recent rolling update, skipping instances that were already replaced")
+	cmd.Flags().IntVar(&options.Canary, "canary", options.Canary, "Number of instances in each node instance group to replace first, halting the rolling update if the cluster is not healthy afterwards")
+	cmd.Flags().DurationVar(&options.CanarySoakPeriod, "canary-soak-period", options.CanarySoakPeriod, "Time the cluster must stay healthy after the canary instances are replaced")
+	cmd.Flags().StringSliceVar(&options.CanaryPodChecks, "canary-pod-check", options.CanaryPodChecks, "Label selector for pods that must be ready after the canary instances are replaced, as <namespace>:<selector> or <selector> for all namespaces")
+	cmd.Flags().BoolVar(&options.Lock, "lock", options.Lock, "Lock the cluster in the state store while it is changed; --lock=false is for state stores that cannot hold the lock")
 
 	if featureflag.DrainAndValidateRollingUpdate.Enabled() {
 		cmd.Flags().BoolVar(&options.FailOnDrainError, "fail-on-drain-error", true, "The rolling-update will fail if draining a node fails.")
@@ -211,6 +268,32 @@ func NewCmdRollingUpdateCluster(f *util.Factory, out io.Writer) *cobra.Command {
 
 func RunRollingUpdateCluster(f *util.Factory, out io.Writer, options *RollingUpdateOptions) error {
 
+	maxSurge, err := parseIntOrPercent("max-surge", options.MaxSurge)
+	if err != nil {
+		return err
+	}
+
+	maxUnavailable, err := parseIntOrPercent("max-unavailable", options.MaxUnavailable)
+	if err != nil {
+		return err
+	}
+
+	if options.Canary < 0 {
+		return fmt.Errorf("--canary must be greater than or equal to 0")
+	}
+	if options.Canary > 0 && options.CloudOnly {
+		return fmt.Errorf("--canary cannot be used with --cloudonly, as the canary instances are checked by validating the cluster")
+	}
+
+	var canaryPodChecks []instancegroups.PodReadinessCheck
+	for _, s := range options.CanaryPodChecks {
+		check, err := instancegroups.ParsePodReadinessCheck(s)
+		if err != nil {
+			return fmt.Errorf("invalid --canary-pod-check: %v", err)
+		}
+		canaryPodChecks = append(canaryPodChecks, check)
+	}
+
 	clientset, err := f.Clientset()
 	if err != nil {
 		return err
@@ -221,6 +304,10 @@ func RunRollingUpdateCluster(f *util.Factory, out io.Writer, options *RollingUpd
 		return err
 	}
 
+	if err := validation.ValidateRollingUpdateSurge(cluster, maxSurge, field.NewPath("max-surge")); err != nil {
+		return err
+	}
+
 	contextName := cluster.ObjectMeta.Name
 	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		clientcmd.NewDefaultClientConfigLoadingRules(),
@@ -351,7 +438,7 @@ func RunRollingUpdateCluster(f *util.Factory, out io.Writer, options *RollingUpd
 		}
 	}
 
-	if !needUpdate && !options.Force {
+	if !needUpdate && !options.Force && !options.Resume {
 		fmt.Printf("\nNo rolling-update required.\n")
 		return nil
 	}
@@ -361,9 +448,21 @@ func RunRollingUpdateCluster(f *util.Factory, out io.Writer, options *RollingUpd
 		return nil
 	}
 
+	unlock, err := LockCluster(cluster, "rolling-update cluster", options.Lock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	if featureflag.DrainAndValidateRollingUpdate.Enabled() {
 		glog.V(2).Infof("Rolling update with drain and validate enabled.")
 	}
+
+	configBase, err := clientset.ConfigBaseFor(cluster)
+	if err != nil {
+		return err
+	}
+
 	d := &instancegroups.RollingUpdateCluster{
 		MasterInterval:    options.MasterInterval,
 		NodeInterval:      options.NodeInterval,
@@ -379,6 +478,32 @@ func RunRollingUpdateCluster(f *util.Factory, out io.Writer, options *RollingUpd
 		ClusterName:       options.ClusterName,
 		PostDrainDelay:    options.PostDrainDelay,
 		ValidationTimeout: options.ValidationTimeout,
+		MaxSurge:          maxSurge,
+		MaxUnavailable:    maxUnavailable,
+		ProgressStore:     instancegroups.NewVFSProgressStore(cluster, configBase),
+		Resume:            options.Resume,
+		Canary:            options.Canary,
+		CanarySoakPeriod:  options.CanarySoakPeriod,
+		CanaryPodChecks:   canaryPodChecks,
 	}
 	return d.RollingUpdate(groups, cluster, list)
 }
+
+// parseIntOrPercent parses a flag value that is either an absolute number or a percentage, returning nil if it is not set
+func parseIntOrPercent(flag string, value string) (*intstr.IntOrString, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	v := intstr.Parse(value)
+	if v.Type == intstr.String {
+		percent, err := strconv.Atoi(strings.TrimSuffix(v.StrVal, "%"))
+		if err != nil || !strings.HasSuffix(v.StrVal, "%") || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("--%s must be a non-negative number or a percentage, got %q", flag, value)
+		}
+	} else if v.IntVal < 0 {
+		return nil, fmt.Errorf("--%s must be a non-negative number or a percentage, got %q", flag, value)
+	}
+
+	return &v, nil
+}
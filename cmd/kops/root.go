@@ -32,6 +32,7 @@ import (
 	kopsapi "k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/client/simple"
 	"k8s.io/kops/pkg/kubeconfig"
+	"k8s.io/kops/pkg/statelock"
 	"k8s.io/kops/upup/pkg/kutil"
 	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
 	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
@@ -138,9 +139,13 @@ func NewCmdRoot(f *util.Factory, out io.Writer) *cobra.Command {
 	cmd.AddCommand(NewCmdEdit(f, out))
 	cmd.AddCommand(NewCmdExport(f, out))
 	cmd.AddCommand(NewCmdGet(f, out))
+	cmd.AddCommand(NewCmdHistory(f, out))
 	cmd.AddCommand(NewCmdUpdate(f, out))
 	cmd.AddCommand(NewCmdReplace(f, out))
+	cmd.AddCommand(NewCmdReconcile(f, out))
+	cmd.AddCommand(NewCmdRollback(f, out))
 	cmd.AddCommand(NewCmdRollingUpdate(f, out))
+	cmd.AddCommand(NewCmdRotate(f, out))
 	cmd.AddCommand(NewCmdSet(f, out))
 	cmd.AddCommand(NewCmdToolbox(f, out))
 	cmd.AddCommand(NewCmdValidate(f, out))
@@ -305,3 +310,34 @@ func GetCluster(factory Factory, clusterName string) (*kopsapi.Cluster, error) {
 	}
 	return cluster, nil
 }
+
+// LockCluster takes the state store lock on the cluster for the operation, returning a function that releases it.
+// If the lock is lost before it is released, kops exits, rather than making changes that may conflict with another operation.
+// If lock is false the cluster is not locked, for state stores that cannot hold the lock.
+func LockCluster(cluster *kopsapi.Cluster, operation string, lock bool) (func(), error) {
+	if !lock {
+		glog.Warningf("not locking cluster %q for %s; make sure no other operation changes the cluster at the same time", cluster.ObjectMeta.Name, operation)
+		return func() {}, nil
+	}
+
+	lease, err := statelock.Acquire(cluster, operation)
+	if err != nil {
+		return nil, err
+	}
+
+	released := make(chan struct{})
+	go func() {
+		select {
+		case <-lease.Lost():
+			exitWithError(fmt.Errorf("lost the lock on cluster %q, which was removed, taken over or expired; stopping %s, as its changes to the cluster may conflict with another operation", cluster.ObjectMeta.Name, operation))
+		case <-released:
+		}
+	}()
+
+	return func() {
+		close(released)
+		if err := lease.Release(); err != nil {
+			glog.Warningf("error releasing the lock on cluster %q: %v", cluster.ObjectMeta.Name, err)
+		}
+	}, nil
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/certificates"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/pkg/commands"
+	"k8s.io/kops/pkg/envelope"
+	"k8s.io/kops/pkg/kubeconfig"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	rotateCertificatesLong = templates.LongDesc(i18n.T(`
+	Reissue the certificates of a cluster, and optionally replace the CA that signs them.
+
+	Without --ca, every certificate signed by the cluster CA is reissued with the
+	same CA, and the instances are replaced so they pick up the new certificates.
+
+	With --ca, the CA is replaced in three phases, and the instances are replaced
+	after each phase:
+
+	1. CAStaged: a new CA is created in the ca-next keyset, and is trusted alongside the old CA.
+	2. CAPromoted: the new CA becomes the primary CA, and every certificate is reissued by it.
+	3. CARetired: the old CA is removed, so it is no longer trusted.
+
+	The progress is recorded in the state store, in the certificate-rotation secret,
+	and the keysets can be inspected with kops get secrets.  If the command is interrupted,
+	running it again resumes the rotation from where it stopped.
+
+	The kubecfg is exported after each phase, so that kubectl keeps working.`))
+
+	rotateCertificatesExample = templates.Examples(i18n.T(`
+	# Show the phases that a CA rotation would run
+	kops rotate certificates --name k8s-cluster.example.com --ca
+
+	# Rotate the CA and all the certificates
+	kops rotate certificates --name k8s-cluster.example.com --ca --yes
+
+	# Reissue the certificates with the existing CA
+	kops rotate certificates --name k8s-cluster.example.com --yes`))
+
+	rotateCertificatesShort = i18n.T(`Rotate the certificates of a cluster, and optionally its CA.`)
+)
+
+type RotateCertificatesOptions struct {
+	ClusterName string
+
+	// CA is true if the CA should be replaced, not just the certificates it issued
+	CA bool
+
+	Yes       bool
+	CloudOnly bool
+}
+
+func NewCmdRotateCertificates(f *util.Factory, out io.Writer) *cobra.Command {
+	options := &RotateCertificatesOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "certificates",
+		Aliases: []string{"certs"},
+		Short:   rotateCertificatesShort,
+		Long:    rotateCertificatesLong,
+		Example: rotateCertificatesExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := rootCommand.ProcessArgs(args)
+			if err != nil {
+				exitWithError(err)
+			}
+
+			options.ClusterName = rootCommand.ClusterName()
+			if options.ClusterName == "" {
+				exitWithError(fmt.Errorf("--name is required"))
+			}
+
+			err = RunRotateCertificates(f, out, options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&options.CA, "ca", options.CA, "Replace the CA, as well as the certificates it issued")
+	cmd.Flags().BoolVarP(&options.Yes, "yes", "y", options.Yes, "Rotate the certificates and replace the instances; without --yes, only the phases that would run are shown")
+	cmd.Flags().BoolVar(&options.CloudOnly, "cloudonly", options.CloudOnly, "Replace the instances without confirming progress with k8s")
+
+	return cmd
+}
+
+func RunRotateCertificates(f *util.Factory, out io.Writer, options *RotateCertificatesOptions) error {
+	cluster, err := GetCluster(f, options.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	clientset, err := f.Clientset()
+	if err != nil {
+		return err
+	}
+
+	r, err := buildRotator(clientset, cluster)
+	if err != nil {
+		return err
+	}
+
+	status, err := r.LoadStatus()
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		status = &certificates.Status{RotateCA: options.CA}
+	} else if status.RotateCA != options.CA {
+		if status.RotateCA {
+			return fmt.Errorf("a rotation of the CA is in progress (phase %s); run with --ca to resume it", status.Phase)
+		}
+		return fmt.Errorf("a rotation of the certificates is in progress (phase %s); run without --ca to resume it", status.Phase)
+	}
+
+	if !options.Yes {
+		if status.Phase != "" {
+			fmt.Fprintf(out, "Certificate rotation in progress: phase %s", status.Phase)
+			if !status.RolledOut {
+				fmt.Fprintf(out, " (instances not yet replaced)")
+			}
+			fmt.Fprintf(out, "\n")
+		}
+		fmt.Fprintf(out, "Phases to run:\n")
+		for _, phase := range status.RemainingPhases() {
+			fmt.Fprintf(out, "  %s\n", phase)
+		}
+		fmt.Fprintf(out, "\nMust specify --yes to rotate the certificates\n")
+		return nil
+	}
+
+	for {
+		if status.Phase != "" && !status.RolledOut {
+			fmt.Fprintf(out, "Replacing instances after phase %s\n", status.Phase)
+			if err := rollForCertificateRotation(f, out, options); err != nil {
+				return fmt.Errorf("error replacing instances after phase %s (run the command again to resume): %v", status.Phase, err)
+			}
+			status.RolledOut = true
+			if err := r.SaveStatus(status); err != nil {
+				return err
+			}
+		}
+
+		phase := status.NextPhase()
+		if phase == "" {
+			break
+		}
+
+		// We use a new keystore for each phase, because the keystore caches the CA
+		r, err = buildRotator(clientset, cluster)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "Running certificate rotation phase %s\n", phase)
+		if err := r.RunPhase(status, phase); err != nil {
+			return fmt.Errorf("error running certificate rotation phase %s: %v", phase, err)
+		}
+
+		if err := mirrorCertificateRotation(r, cluster); err != nil {
+			return err
+		}
+		if err := exportKubecfgForCertificateRotation(r, cluster); err != nil {
+			return err
+		}
+	}
+
+	if err := r.ClearStatus(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Certificate rotation complete\n")
+	return nil
+}
+
+func buildRotator(clientset simple.Clientset, cluster *api.Cluster) (*certificates.Rotator, error) {
+	keyStore, err := clientset.KeyStore(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	secretStore, err := clientset.SecretStore(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificates.Rotator{
+		KeyStore:    keyStore,
+		SecretStore: secretStore,
+	}, nil
+}
+
+// mirrorCertificateRotation copies the keystore and secrets to where the instances read them, as kops update cluster does
+func mirrorCertificateRotation(r *certificates.Rotator, cluster *api.Cluster) error {
+	keyStorePath, _, err := envelope.BuildStorePath(cluster.Spec.KeyStore)
+	if err != nil {
+		return err
+	}
+	if err := r.KeyStore.MirrorTo(keyStorePath); err != nil {
+		return fmt.Errorf("error mirroring keystore: %v", err)
+	}
+
+	secretStorePath, _, err := envelope.BuildStorePath(cluster.Spec.SecretStore)
+	if err != nil {
+		return err
+	}
+	if err := r.SecretStore.MirrorTo(secretStorePath); err != nil {
+		return fmt.Errorf("error mirroring secrets: %v", err)
+	}
+	return nil
+}
+
+// exportKubecfgForCertificateRotation exports the kubecfg, so that it trusts the CAs that are in use
+// and has a client certificate the apiserver accepts
+func exportKubecfgForCertificateRotation(r *certificates.Rotator, cluster *api.Cluster) error {
+	kubecfgCert, err := r.KeyStore.FindCert("kubecfg")
+	if err != nil {
+		// This is only a convenience; don't error because of it
+		glog.Warningf("Ignoring error trying to fetch kubecfg cert - won't export kubecfg: %v", err)
+		return nil
+	}
+	if kubecfgCert == nil {
+		glog.Infof("kubecfg cert not found; won't export kubecfg")
+		return nil
+	}
+
+	glog.Infof("Exporting kubecfg for cluster")
+	conf, err := kubeconfig.BuildKubecfg(cluster, r.KeyStore, r.SecretStore, &commands.CloudDiscoveryStatusStore{})
+	if err != nil {
+		return err
+	}
+	return conf.WriteKubecfg()
+}
+
+// rollForCertificateRotation replaces all the instances of the cluster, so they pick up the changes to the keystore
+func rollForCertificateRotation(f *util.Factory, out io.Writer, options *RotateCertificatesOptions) error {
+	rollingUpdateOptions := &RollingUpdateOptions{}
+	rollingUpdateOptions.InitDefaults()
+	rollingUpdateOptions.ClusterName = options.ClusterName
+	rollingUpdateOptions.CloudOnly = options.CloudOnly
+	rollingUpdateOptions.Force = true
+	rollingUpdateOptions.Yes = true
+
+	return RunRollingUpdateCluster(f, out, rollingUpdateOptions)
+}
@@ -45,8 +45,11 @@ func NewCmdToolbox(f *util.Factory, out io.Writer) *cobra.Command {
 		Example: toolboxExample,
 	}
 
+	cmd.AddCommand(NewCmdToolboxAssets(f, out))
 	cmd.AddCommand(NewCmdToolboxConvertImported(f, out))
 	cmd.AddCommand(NewCmdToolboxDump(f, out))
+	cmd.AddCommand(NewCmdToolboxEncryptState(f, out))
+	cmd.AddCommand(NewCmdToolboxMigrateState(f, out))
 	cmd.AddCommand(NewCmdToolboxBundle(f, out))
 	cmd.AddCommand(NewCmdToolboxTemplate(f, out))
 
@@ -0,0 +1,101 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/assets"
+	"k8s.io/kops/upup/pkg/fi/cloudup"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	toolboxAssetsLong = templates.LongDesc(i18n.T(`
+	Copy the images and files a cluster uses, for clusters without access to the internet.`))
+
+	toolboxAssetsExample = templates.Examples(i18n.T(`
+	# Export the images and files used by a cluster to a bundle
+	kops toolbox assets export --name k8s-cluster.example.com --output bundle.tar
+
+	# Import the bundle into a local registry and file repository
+	kops toolbox assets import --input bundle.tar --registry registry.example.com:5000 --file-repository /srv/www/kops
+	`))
+
+	toolboxAssetsShort = i18n.T(`Copy the images and files a cluster uses.`)
+)
+
+func NewCmdToolboxAssets(f *util.Factory, out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "assets",
+		Short:   toolboxAssetsShort,
+		Long:    toolboxAssetsLong,
+		Example: toolboxAssetsExample,
+	}
+
+	cmd.AddCommand(NewCmdToolboxAssetsExport(f, out))
+	cmd.AddCommand(NewCmdToolboxAssetsImport(f, out))
+
+	return cmd
+}
+
+// resolveClusterAssets builds the tasks of the cluster in the assets phase, without making changes,
+// to find the images and files the cluster uses
+func resolveClusterAssets(f *util.Factory, clusterName string) (*assets.AssetBuilder, error) {
+	cluster, err := GetCluster(f, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := f.Clientset()
+	if err != nil {
+		return nil, err
+	}
+
+	var instanceGroups []*kops.InstanceGroup
+	{
+		list, err := clientset.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			instanceGroups = append(instanceGroups, &list.Items[i])
+		}
+	}
+
+	applyCmd := &cloudup.ApplyClusterCmd{
+		Clientset:      clientset,
+		Cluster:        cluster,
+		DryRun:         true,
+		DryRunOut:      ioutil.Discard,
+		InstanceGroups: instanceGroups,
+		Models:         cloudup.CloudupModels,
+		Phase:          cloudup.PhaseStageAssets,
+		TargetName:     cloudup.TargetDryRun,
+	}
+	if err := applyCmd.Run(); err != nil {
+		return nil, fmt.Errorf("error finding assets of cluster %q: %v", clusterName, err)
+	}
+	return applyCmd.AssetBuilder, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/assets"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	toolboxAssetsExportLong = templates.LongDesc(i18n.T(`
+	Export the images and files used by a cluster to a bundle, for copying to a site without access to the internet.
+
+	The images (including those of the addons) and files (including kubelet, kubectl, the CNI plugins,
+	nodeup and protokube) that the cluster uses are downloaded from their canonical locations, even if
+	the cluster's spec.assets points to a mirror.  The bundle is a tar archive of an OCI image layout:
+	every image and file is stored as a blob named by its sha256 digest, and the hash of every file is
+	checked against the hash kops expects.  Only the linux/amd64 image of multi-architecture images is exported.
+
+	Use kops toolbox assets import to load the bundle into a registry and file repository.`))
+
+	toolboxAssetsExportExample = templates.Examples(i18n.T(`
+	# Export the images and files used by a cluster
+	kops toolbox assets export --name k8s-cluster.example.com --output bundle.tar
+	`))
+
+	toolboxAssetsExportShort = i18n.T(`Export the images and files used by a cluster to a bundle.`)
+)
+
+type ToolboxAssetsExportOptions struct {
+	ClusterName string
+
+	// Output is the file the bundle is written to
+	Output string
+}
+
+func NewCmdToolboxAssetsExport(f *util.Factory, out io.Writer) *cobra.Command {
+	options := &ToolboxAssetsExportOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "export",
+		Short:   toolboxAssetsExportShort,
+		Long:    toolboxAssetsExportLong,
+		Example: toolboxAssetsExportExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rootCommand.ProcessArgs(args); err != nil {
+				exitWithError(err)
+			}
+
+			options.ClusterName = rootCommand.ClusterName()
+
+			err := RunToolboxAssetsExport(f, out, options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Output, "output", "o", options.Output, "File to write the bundle to")
+
+	return cmd
+}
+
+func RunToolboxAssetsExport(f *util.Factory, out io.Writer, options *ToolboxAssetsExportOptions) error {
+	if options.ClusterName == "" {
+		return fmt.Errorf("ClusterName is required")
+	}
+	if options.Output == "" {
+		return fmt.Errorf("--output is required")
+	}
+
+	assetBuilder, err := resolveClusterAssets(f, options.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(options.Output)
+	if err != nil {
+		return fmt.Errorf("error creating %q: %v", options.Output, err)
+	}
+	contents, err := assets.ExportBundle(file, assetBuilder)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error writing %q: %v", options.Output, closeErr)
+	}
+	if err != nil {
+		// Don't leave a partial bundle behind
+		os.Remove(options.Output)
+		return err
+	}
+
+	fmt.Fprintf(out, "Images:\n")
+	for _, image := range contents.Images {
+		fmt.Fprintf(out, "  %s\t%s\n", image.Source, image.Digest)
+	}
+	fmt.Fprintf(out, "Files:\n")
+	for _, file := range contents.Files {
+		fmt.Fprintf(out, "  %s\t%s\n", file.Source, file.Digest)
+	}
+	fmt.Fprintf(out, "\nExported %d images and %d files to %s\n", len(contents.Images), len(contents.Files), options.Output)
+
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/assets"
+	"k8s.io/kops/util/pkg/vfs"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	toolboxAssetsImportLong = templates.LongDesc(i18n.T(`
+	Import a bundle written by kops toolbox assets export into a container registry and file repository.
+
+	The images are pushed to the registry, and the files and their hashes are written to the file
+	repository, under the names that kops uses when spec.assets.containerRegistry and
+	spec.assets.fileRepository point to them.  The digest of every blob in the bundle is verified
+	before it is imported.
+
+	The file repository is a local directory, or any location kops can write to such as an S3 bucket;
+	it must be served over HTTP at the URL set as spec.assets.fileRepository.  The registry must accept
+	anonymous pushes, or issue anonymous tokens for them.`))
+
+	toolboxAssetsImportExample = templates.Examples(i18n.T(`
+	# Import a bundle into a local registry, and a directory served by a web server
+	kops toolbox assets import --input bundle.tar --registry registry.example.com:5000 --file-repository /srv/www/kops
+
+	# Use the imported assets
+	kops edit cluster k8s-cluster.example.com
+	  # spec:
+	  #   assets:
+	  #     containerRegistry: registry.example.com:5000
+	  #     fileRepository: https://files.example.com/kops/
+	`))
+
+	toolboxAssetsImportShort = i18n.T(`Import a bundle of images and files into a registry and file repository.`)
+)
+
+type ToolboxAssetsImportOptions struct {
+	// Input is the bundle to import
+	Input string
+
+	// Registry is the container registry the images are pushed to
+	Registry string
+	// InsecureRegistry is true if the registry is accessed over plain HTTP
+	InsecureRegistry bool
+
+	// FileRepository is the location the files are written to
+	FileRepository string
+}
+
+func NewCmdToolboxAssetsImport(f *util.Factory, out io.Writer) *cobra.Command {
+	options := &ToolboxAssetsImportOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "import",
+		Short:   toolboxAssetsImportShort,
+		Long:    toolboxAssetsImportLong,
+		Example: toolboxAssetsImportExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunToolboxAssetsImport(f, out, options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Input, "input", "i", options.Input, "Bundle to import")
+	cmd.Flags().StringVar(&options.Registry, "registry", options.Registry, "Container registry to push the images to, as set in spec.assets.containerRegistry")
+	cmd.Flags().BoolVar(&options.InsecureRegistry, "insecure-registry", options.InsecureRegistry, "Access the registry over plain HTTP; registries on localhost always are")
+	cmd.Flags().StringVar(&options.FileRepository, "file-repository", options.FileRepository, "Directory or state store path to write the files to, which is served as spec.assets.fileRepository")
+
+	return cmd
+}
+
+func RunToolboxAssetsImport(f *util.Factory, out io.Writer, options *ToolboxAssetsImportOptions) error {
+	if options.Input == "" {
+		return fmt.Errorf("--input is required")
+	}
+	if options.Registry == "" {
+		return fmt.Errorf("--registry is required")
+	}
+	if options.FileRepository == "" {
+		return fmt.Errorf("--file-repository is required")
+	}
+
+	fileRepository, err := vfs.Context.BuildVfsPath(options.FileRepository)
+	if err != nil {
+		return fmt.Errorf("error parsing file repository %q: %v", options.FileRepository, err)
+	}
+
+	file, err := os.Open(options.Input)
+	if err != nil {
+		return fmt.Errorf("error opening %q: %v", options.Input, err)
+	}
+	defer file.Close()
+
+	contents, err := assets.ImportBundle(file, &assets.ImportBundleOptions{
+		ContainerRegistry: strings.TrimSuffix(options.Registry, "/"),
+		InsecureRegistry:  options.InsecureRegistry,
+		FileRepository:    fileRepository,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Images:\n")
+	for _, image := range contents.Images {
+		fmt.Fprintf(out, "  %s -> %s\n", image.Source, image.Target)
+	}
+	fmt.Fprintf(out, "Files:\n")
+	for _, file := range contents.Files {
+		fmt.Fprintf(out, "  %s -> %s\n", file.Source, file.Target)
+	}
+	fmt.Fprintf(out, "\nImported %d images and %d files\n", len(contents.Images), len(contents.Files))
+
+	return nil
+}
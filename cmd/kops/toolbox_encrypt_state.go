@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/commands"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	toolboxEncryptStateLong = templates.LongDesc(i18n.T(`
+	Encrypt the private keys and secrets that were written before encryption was enabled.
+
+	Once spec.keyStore or spec.secretStore is encrypted, kops and nodeup refuse to read private keys
+	and secrets that are not encrypted with its key encryption key, because anyone who can write
+	to the state store could have written them.  This command encrypts the plaintext private keys
+	and secrets in place, with the key encryption key configured in the cluster spec, and is the
+	only way to read the ones that were written before encryption was enabled.
+
+	Review the files it lists before encrypting them: a file that was written by someone else is
+	trusted once it is encrypted.`))
+
+	toolboxEncryptStateExample = templates.Examples(i18n.T(`
+	# Show the private keys and secrets that are not encrypted
+	kops toolbox encrypt-state --name k8s-cluster.example.com
+
+	# Encrypt them
+	kops toolbox encrypt-state --name k8s-cluster.example.com --yes
+	`))
+
+	toolboxEncryptStateShort = i18n.T(`Encrypt the private keys and secrets that were written before encryption was enabled`)
+)
+
+type ToolboxEncryptStateOptions struct {
+	ClusterName string
+
+	Yes bool
+}
+
+func NewCmdToolboxEncryptState(f *util.Factory, out io.Writer) *cobra.Command {
+	options := &ToolboxEncryptStateOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "encrypt-state",
+		Short:   toolboxEncryptStateShort,
+		Long:    toolboxEncryptStateLong,
+		Example: toolboxEncryptStateExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rootCommand.ProcessArgs(args); err != nil {
+				exitWithError(err)
+			}
+
+			options.ClusterName = rootCommand.ClusterName()
+
+			err := RunToolboxEncryptState(f, out, options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&options.Yes, "yes", "y", options.Yes, "Encrypt the files; without --yes, only the files that would be encrypted are shown")
+
+	return cmd
+}
+
+func RunToolboxEncryptState(f *util.Factory, out io.Writer, options *ToolboxEncryptStateOptions) error {
+	if options.ClusterName == "" {
+		return fmt.Errorf("ClusterName is required")
+	}
+
+	cluster, err := GetCluster(f, options.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	plan, err := commands.BuildEncryptStatePlan(cluster)
+	if err != nil {
+		return err
+	}
+
+	if len(plan.Files) == 0 {
+		fmt.Fprintf(out, "The private keys and secrets of cluster %q are all encrypted.\n", options.ClusterName)
+		return nil
+	}
+
+	fmt.Fprintf(out, "Files to encrypt:\n")
+	for _, file := range plan.Files {
+		fmt.Fprintf(out, "  %s\n", file.Path)
+	}
+	fmt.Fprintf(out, "\n")
+
+	if !options.Yes {
+		fmt.Fprintf(out, "Must specify --yes to encrypt the files\n")
+		return nil
+	}
+
+	if err := commands.EncryptState(plan); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%d files were encrypted and verified.\n", len(plan.Files))
+	return nil
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/simple/api"
+	"k8s.io/kops/pkg/commands"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
+	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
+)
+
+var (
+	toolboxMigrateStateLong = templates.LongDesc(i18n.T(`
+	Move a cluster to another state store.
+
+	The cluster configuration, instance groups, keysets, secrets and SSH keys are copied
+	to the new state store, and the hash of every copied file is verified.  The configBase,
+	configStore, keyStore and secretStore of the cluster are rewritten to point to the new
+	state store; stores outside the cluster's configBase are left where they are.
+
+	The files in the old state store are not removed, because the instances of the cluster
+	keep reading them until the cluster is updated.  A marker is left in the old state store,
+	so that kops commands using it report where the cluster was moved to.
+
+	After moving the cluster, set KOPS_STATE_STORE to the new state store and run
+	kops update cluster and kops rolling-update cluster, so that the instances use the new
+	state store.  The cluster can then be removed from the old state store.
+
+	A cluster can also be moved to custom resources in a Kubernetes cluster, with --to k8s://<context>,
+	where context is a context in the kubeconfig file.  The instance groups, keysets, secrets and SSH keys
+	are copied to objects in a namespace for the cluster.  The configBase of the cluster is unchanged,
+	because the instances of the cluster keep reading their configuration from it.`))
+
+	toolboxMigrateStateExample = templates.Examples(i18n.T(`
+	# Show what moving a cluster to a GCS bucket would do
+	kops toolbox migrate-state --name k8s-cluster.example.com --state s3://old-bucket --to gs://new-bucket
+
+	# Move the cluster
+	kops toolbox migrate-state --name k8s-cluster.example.com --state s3://old-bucket --to gs://new-bucket --yes
+
+	# Move the cluster to custom resources in the management cluster of the kubeconfig context "management"
+	kops toolbox migrate-state --name k8s-cluster.example.com --state s3://old-bucket --to k8s://management --yes
+	`))
+
+	toolboxMigrateStateShort = i18n.T(`Move a cluster to another state store`)
+)
+
+type ToolboxMigrateStateOptions struct {
+	ClusterName string
+
+	// To is the state store the cluster is moved to
+	To string
+
+	Yes bool
+}
+
+func NewCmdToolboxMigrateState(f *util.Factory, out io.Writer) *cobra.Command {
+	options := &ToolboxMigrateStateOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "migrate-state",
+		Short:   toolboxMigrateStateShort,
+		Long:    toolboxMigrateStateLong,
+		Example: toolboxMigrateStateExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rootCommand.ProcessArgs(args); err != nil {
+				exitWithError(err)
+			}
+
+			options.ClusterName = rootCommand.ClusterName()
+
+			err := RunToolboxMigrateState(f, out, options)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&options.To, "to", options.To, "State store to move the cluster to, for example s3://new-bucket, gs://new-bucket or k8s://<kubeconfig context>")
+	cmd.Flags().BoolVarP(&options.Yes, "yes", "y", options.Yes, "Move the cluster; without --yes, only the changes that would be made are shown")
+
+	return cmd
+}
+
+func RunToolboxMigrateState(f *util.Factory, out io.Writer, options *ToolboxMigrateStateOptions) error {
+	if options.ClusterName == "" {
+		return fmt.Errorf("ClusterName is required")
+	}
+	if options.To == "" {
+		return fmt.Errorf("--to is required")
+	}
+	newStateStore := strings.TrimSuffix(options.To, "/")
+
+	cluster, err := GetCluster(f, options.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	if api.IsCRDStateStore(newStateStore) {
+		return runToolboxMigrateStateToKubernetes(f, out, options, cluster, newStateStore)
+	}
+
+	plan, err := commands.BuildMigrateStatePlan(cluster, newStateStore)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Moving cluster %q from %s to %s\n\n", options.ClusterName, plan.Source, plan.Destination)
+	fmt.Fprintf(out, "Files to copy:\n")
+	for _, file := range plan.Files {
+		fmt.Fprintf(out, "  %s\n", file)
+	}
+	fmt.Fprintf(out, "\nCluster spec changes:\n")
+	for _, change := range plan.Changes {
+		fmt.Fprintf(out, "  %s\n", change)
+	}
+	if len(plan.Warnings) != 0 {
+		fmt.Fprintf(out, "\nWarnings:\n")
+		for _, warning := range plan.Warnings {
+			fmt.Fprintf(out, "  %s\n", warning)
+		}
+	}
+	fmt.Fprintf(out, "\n")
+
+	if !options.Yes {
+		fmt.Fprintf(out, "Must specify --yes to move the cluster\n")
+		return nil
+	}
+
+	if err := commands.MigrateState(plan); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Cluster %q has been moved to %s, and %d files were copied and verified.\n\n", options.ClusterName, newStateStore, len(plan.Files))
+	fmt.Fprintf(out, "Next steps:\n")
+	fmt.Fprintf(out, " * use the new state store: export KOPS_STATE_STORE=%s\n", newStateStore)
+	fmt.Fprintf(out, " * update the cluster, so that new instances read from the new state store: kops update cluster %s --yes\n", options.ClusterName)
+	fmt.Fprintf(out, " * replace the existing instances: kops rolling-update cluster %s --yes\n", options.ClusterName)
+	fmt.Fprintf(out, " * the cluster can then be removed from %s\n", plan.Source)
+
+	return nil
+}
+
+func runToolboxMigrateStateToKubernetes(f *util.Factory, out io.Writer, options *ToolboxMigrateStateOptions, cluster *kops.Cluster, newStateStore string) error {
+	clientset, err := f.Clientset()
+	if err != nil {
+		return err
+	}
+
+	destination, err := api.BuildCRDClientset(newStateStore)
+	if err != nil {
+		return err
+	}
+
+	plan, err := commands.BuildMigrateStateToKubernetesPlan(clientset, cluster, destination, newStateStore)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Moving cluster %q from %s to %s\n\n", options.ClusterName, plan.Source, newStateStore)
+	fmt.Fprintf(out, "Objects to create:\n")
+	fmt.Fprintf(out, "  Cluster %s\n", plan.Cluster.ObjectMeta.Name)
+	for _, ig := range plan.InstanceGroups {
+		fmt.Fprintf(out, "  InstanceGroup %s\n", ig.ObjectMeta.Name)
+	}
+	for _, keyset := range plan.Keysets {
+		fmt.Fprintf(out, "  Keyset %s\n", keyset.Name)
+	}
+	for _, name := range plan.SecretNames {
+		fmt.Fprintf(out, "  Secret %s\n", name)
+	}
+	for _, sshCredential := range plan.SSHCredentials {
+		fmt.Fprintf(out, "  SSHCredential %s\n", sshCredential.Name)
+	}
+	if len(plan.Warnings) != 0 {
+		fmt.Fprintf(out, "\nWarnings:\n")
+		for _, warning := range plan.Warnings {
+			fmt.Fprintf(out, "  %s\n", warning)
+		}
+	}
+	fmt.Fprintf(out, "\n")
+
+	if !options.Yes {
+		fmt.Fprintf(out, "Must specify --yes to move the cluster\n")
+		return nil
+	}
+
+	if err := commands.MigrateStateToKubernetes(plan); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Cluster %q has been moved to %s.\n\n", options.ClusterName, newStateStore)
+	fmt.Fprintf(out, "Next steps:\n")
+	fmt.Fprintf(out, " * use the new state store: export KOPS_STATE_STORE=%s\n", newStateStore)
+	fmt.Fprintf(out, " * keep the files under %s, which the instances of the cluster read, and which kops keeps updating\n", plan.Cluster.Spec.ConfigBase)
+
+	return nil
+}
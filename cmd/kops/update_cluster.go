@@ -18,6 +18,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -25,6 +26,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -52,6 +54,17 @@ var (
 	updateClusterExample = templates.Examples(i18n.T(`
 	# After cluster has been edited or upgraded, configure it with:
 	kops update cluster k8s-cluster.example.com --yes --state=s3://kops-state-1234 --yes
+
+	# Write a terraform module, to use from an existing terraform configuration
+	kops update cluster k8s-cluster.example.com --target=terraform --terraform-module --out=modules/kops
+
+	# Review the changes as structured output
+	kops update cluster k8s-cluster.example.com -o json
+
+	# Save the changes to a plan, and later apply exactly that plan.
+	# The update is refused if the live state or the cluster in the state store has changed since the plan was saved.
+	kops update cluster k8s-cluster.example.com --save-plan=plan.json
+	kops update cluster k8s-cluster.example.com --plan=plan.json --yes
 	`))
 
 	updateClusterShort = i18n.T("Update a cluster.")
@@ -68,6 +81,21 @@ type UpdateClusterOptions struct {
 
 	Phase string
 
+	// Output is the format of the dry-run plan: json or yaml.  The text report is printed if it is not set.
+	Output string
+
+	// SavePlan is the path to which the dry-run plan will be written
+	SavePlan string
+
+	// Plan is the path of a saved plan; the update is refused unless it would make exactly the changes in the plan
+	Plan string
+
+	// TerraformModule is true if the terraform output should be a reusable module, with variables and outputs
+	TerraformModule bool
+
+	// Lock is true if the cluster is locked in the state store while it is changed
+	Lock bool
+
 	// LifecycleOverrides is a slice of taskName=lifecycle name values.  This slice is used
 	// to populate the LifecycleOverrides struct member in ApplyClusterCmd struct.
 	LifecycleOverrides []string
@@ -81,6 +109,7 @@ func (o *UpdateClusterOptions) InitDefaults() {
 	o.OutDir = ""
 	o.MaxTaskDuration = cloudup.DefaultMaxTaskDuration
 	o.CreateKubecfg = true
+	o.Lock = true
 }
 
 func NewCmdUpdateCluster(f *util.Factory, out io.Writer) *cobra.Command {
@@ -107,12 +136,17 @@ func NewCmdUpdateCluster(f *util.Factory, out io.Writer) *cobra.Command {
 	}
 
 	cmd.Flags().BoolVarP(&options.Yes, "yes", "y", options.Yes, "Create cloud resources, without --yes update is in dry run mode")
-	cmd.Flags().StringVar(&options.Target, "target", options.Target, "Target - direct, terraform, cloudformation")
+	cmd.Flags().StringVar(&options.Target, "target", options.Target, "Target - direct, terraform, terraform-json, cloudformation")
 	cmd.Flags().StringVar(&options.Models, "model", options.Models, "Models to apply (separate multiple models with commas)")
 	cmd.Flags().StringVar(&options.SSHPublicKey, "ssh-public-key", options.SSHPublicKey, "SSH public key to use (deprecated: use kops create secret instead)")
 	cmd.Flags().StringVar(&options.OutDir, "out", options.OutDir, "Path to write any local output")
 	cmd.Flags().BoolVar(&options.CreateKubecfg, "create-kube-config", options.CreateKubecfg, "Will control automatically creating the kube config file on your local filesystem")
 	cmd.Flags().StringVar(&options.Phase, "phase", options.Phase, "Subset of tasks to run: "+strings.Join(cloudup.Phases.List(), ", "))
+	cmd.Flags().StringVarP(&options.Output, "output", "o", options.Output, "Output format of the dry-run plan. One of json|yaml.")
+	cmd.Flags().StringVar(&options.SavePlan, "save-plan", options.SavePlan, "Path to save the dry-run plan to, so that it can be applied with --plan")
+	cmd.Flags().StringVar(&options.Plan, "plan", options.Plan, "Path of a saved plan; refuse to update unless the changes are exactly those in the plan")
+	cmd.Flags().BoolVar(&options.TerraformModule, "terraform-module", options.TerraformModule, "Write the terraform output as a reusable module, with variables and outputs")
+	cmd.Flags().BoolVar(&options.Lock, "lock", options.Lock, "Lock the cluster in the state store while it is changed; --lock=false is for state stores that cannot hold the lock")
 	cmd.Flags().StringSliceVar(&options.LifecycleOverrides, "lifecycle-overrides", options.LifecycleOverrides, "comma separated list of phase overrides, example: SecurityGroups=Ignore,InternetGateway=ExistsAndWarnIfChanges")
 
 	return cmd
@@ -144,8 +178,26 @@ func RunUpdateCluster(f *util.Factory, clusterName string, out io.Writer, c *Upd
 		targetName = cloudup.TargetDryRun
 	}
 
+	switch c.Output {
+	case "", OutputJSON, OutputYaml:
+	default:
+		return results, fmt.Errorf("unknown output format %q, must be one of json|yaml", c.Output)
+	}
+	if !isDryrun && (c.Output != "" || c.SavePlan != "") {
+		return results, fmt.Errorf("--output and --save-plan can only be used in dry-run mode")
+	}
+	if c.Plan != "" && c.Target != cloudup.TargetDirect {
+		return results, fmt.Errorf("--plan can only be used with --target=%s", cloudup.TargetDirect)
+	}
+	if c.TerraformModule && c.Target != cloudup.TargetTerraform && c.Target != cloudup.TargetTerraformJSON {
+		return results, fmt.Errorf("--terraform-module can only be used with --target=%s or --target=%s", cloudup.TargetTerraform, cloudup.TargetTerraformJSON)
+	}
+	if c.Plan != "" && (c.Output != "" || c.SavePlan != "") {
+		return results, fmt.Errorf("--plan cannot be used with --output or --save-plan")
+	}
+
 	if c.OutDir == "" {
-		if c.Target == cloudup.TargetTerraform {
+		if c.Target == cloudup.TargetTerraform || c.Target == cloudup.TargetTerraformJSON {
 			c.OutDir = "out/terraform"
 		} else if c.Target == cloudup.TargetCloudformation {
 			c.OutDir = "out/cloudformation"
@@ -159,6 +211,14 @@ func RunUpdateCluster(f *util.Factory, clusterName string, out io.Writer, c *Upd
 		return results, err
 	}
 
+	if !isDryrun {
+		unlock, err := LockCluster(cluster, "update cluster", c.Lock)
+		if err != nil {
+			return results, err
+		}
+		defer unlock()
+	}
+
 	clientset, err := f.Clientset()
 	if err != nil {
 		return results, err
@@ -251,8 +311,30 @@ func RunUpdateCluster(f *util.Factory, clusterName string, out io.Writer, c *Upd
 		OutDir:             c.OutDir,
 		Phase:              phase,
 		TargetName:         targetName,
+		TerraformModule:    c.TerraformModule,
 		LifecycleOverrides: lifecycleOverrideMap,
 	}
+	if c.Output != "" {
+		// The plan replaces the text report
+		applyCmd.DryRunOut = ioutil.Discard
+	}
+
+	// The plan is bound to the configuration it was made from, which must be read before it is completed by the apply
+	specHash, err := fi.SpecHash(cluster, instanceGroups)
+	if err != nil {
+		return results, err
+	}
+
+	if c.Plan != "" {
+		if err := verifyPlan(c.Plan, applyCmd, specHash); err != nil {
+			return results, err
+		}
+		if isDryrun {
+			fmt.Fprintf(out, "The live state still matches the plan in %s\n", c.Plan)
+			fmt.Fprintf(out, "Must specify --yes to apply changes\n")
+			return results, nil
+		}
+	}
 
 	if err := applyCmd.Run(); err != nil {
 		return results, err
@@ -263,6 +345,34 @@ func RunUpdateCluster(f *util.Factory, clusterName string, out io.Writer, c *Upd
 
 	if isDryrun {
 		target := applyCmd.Target.(*fi.DryRunTarget)
+
+		if c.Output != "" || c.SavePlan != "" {
+			plan, err := target.Plan(applyCmd.TaskMap)
+			if err != nil {
+				return results, err
+			}
+			plan.Cluster = cluster.ObjectMeta.Name
+			plan.SpecHash = specHash
+			plan.ResourceVersion = cluster.ObjectMeta.ResourceVersion
+
+			if c.SavePlan != "" {
+				b, err := json.MarshalIndent(plan, "", "  ")
+				if err != nil {
+					return results, fmt.Errorf("error marshaling plan: %v", err)
+				}
+				if err := ioutil.WriteFile(c.SavePlan, b, 0644); err != nil {
+					return results, fmt.Errorf("error writing plan to %q: %v", c.SavePlan, err)
+				}
+			}
+
+			if c.Output != "" {
+				return results, planOutput(plan, c.Output, out)
+			}
+
+			fmt.Fprintf(out, "Plan saved to %s; apply it with --plan=%s --yes\n", c.SavePlan, c.SavePlan)
+			return results, nil
+		}
+
 		if target.HasChanges() {
 			fmt.Fprintf(out, "Must specify --yes to apply changes\n")
 		} else {
@@ -305,7 +415,7 @@ func RunUpdateCluster(f *util.Factory, clusterName string, out io.Writer, c *Upd
 	if !isDryrun {
 		sb := new(bytes.Buffer)
 
-		if c.Target == cloudup.TargetTerraform {
+		if c.Target == cloudup.TargetTerraform || c.Target == cloudup.TargetTerraformJSON {
 			fmt.Fprintf(sb, "\n")
 			fmt.Fprintf(sb, "Terraform output has been placed into %s\n", c.OutDir)
 
@@ -374,6 +484,97 @@ func RunUpdateCluster(f *util.Factory, clusterName string, out io.Writer, c *Upd
 	return results, nil
 }
 
+// verifyPlan checks that the plan was made from the current configuration of the cluster, and that the changes
+// applyCmd would make are exactly those in the saved plan.  It runs a dry-run of a copy of applyCmd, because
+// ApplyClusterCmd.Run changes its fields and the cluster and instance groups it is given.
+func verifyPlan(path string, applyCmd *cloudup.ApplyClusterCmd, specHash string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading plan %q: %v", path, err)
+	}
+	saved := &fi.Plan{}
+	if err := yaml.Unmarshal(b, saved); err != nil {
+		return fmt.Errorf("error parsing plan %q: %v", path, err)
+	}
+
+	clusterName := applyCmd.Cluster.ObjectMeta.Name
+	resourceVersion := applyCmd.Cluster.ObjectMeta.ResourceVersion
+	if err := checkPlanSource(saved, clusterName, specHash, resourceVersion); err != nil {
+		return fmt.Errorf("cannot apply plan %q: %v", path, err)
+	}
+
+	dryRunCmd := *applyCmd
+	dryRunCmd.Cluster = applyCmd.Cluster.DeepCopy()
+	dryRunCmd.InstanceGroups = nil
+	for _, ig := range applyCmd.InstanceGroups {
+		dryRunCmd.InstanceGroups = append(dryRunCmd.InstanceGroups, ig.DeepCopy())
+	}
+	dryRunCmd.DryRun = true
+	dryRunCmd.DryRunOut = ioutil.Discard
+	dryRunCmd.TargetName = cloudup.TargetDryRun
+	if err := dryRunCmd.Run(); err != nil {
+		return err
+	}
+
+	live, err := dryRunCmd.Target.(*fi.DryRunTarget).Plan(dryRunCmd.TaskMap)
+	if err != nil {
+		return err
+	}
+	live.Cluster = clusterName
+	live.SpecHash = specHash
+	live.ResourceVersion = resourceVersion
+
+	diff, err := saved.Diff(live)
+	if err != nil {
+		return err
+	}
+	if diff != "" {
+		return fmt.Errorf("the changes needed for cluster %q no longer match the plan in %q; the live state has changed since the plan was saved:\n%s", clusterName, path, diff)
+	}
+	return nil
+}
+
+// checkPlanSource checks that a saved plan was made from the current configuration of the cluster
+func checkPlanSource(saved *fi.Plan, clusterName string, specHash string, resourceVersion string) error {
+	if saved.Cluster != clusterName {
+		return fmt.Errorf("the plan is for cluster %q, not %q", saved.Cluster, clusterName)
+	}
+	if saved.SpecHash == "" {
+		return fmt.Errorf("the plan does not record the configuration it was made from; save it again with --save-plan")
+	}
+	if saved.SpecHash != specHash {
+		return fmt.Errorf("the spec of cluster %q or of its instance groups has changed since the plan was saved", clusterName)
+	}
+	if saved.ResourceVersion != resourceVersion {
+		return fmt.Errorf("cluster %q has been written to the state store since the plan was saved (version %q, now %q)", clusterName, saved.ResourceVersion, resourceVersion)
+	}
+	return nil
+}
+
+func planOutput(plan *fi.Plan, output string, out io.Writer) error {
+	var b []byte
+	var err error
+	switch output {
+	case OutputYaml:
+		b, err = kops.ToRawYaml(plan)
+		if err != nil {
+			return fmt.Errorf("error marshaling yaml: %v", err)
+		}
+	case OutputJSON:
+		b, err = json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling json: %v", err)
+		}
+		b = append(b, '\n')
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	if _, err := out.Write(b); err != nil {
+		return fmt.Errorf("error writing to output: %v", err)
+	}
+	return nil
+}
+
 func parseLifecycle(lifecycle string) (fi.Lifecycle, error) {
 	if v, ok := fi.LifecycleNameMap[lifecycle]; ok {
 		return v, nil
@@ -0,0 +1,243 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/statelock"
+	"k8s.io/kops/pkg/testutils"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup"
+)
+
+func TestCheckPlanSource(t *testing.T) {
+	saved := &fi.Plan{Cluster: "minimal.example.com", SpecHash: "abc", ResourceVersion: "1"}
+
+	grid := []struct {
+		Description     string
+		Plan            *fi.Plan
+		SpecHash        string
+		ResourceVersion string
+		ExpectedError   string
+	}{
+		{
+			Description:     "unchanged",
+			Plan:            saved,
+			SpecHash:        "abc",
+			ResourceVersion: "1",
+		},
+		{
+			Description:     "spec changed",
+			Plan:            saved,
+			SpecHash:        "def",
+			ResourceVersion: "1",
+			ExpectedError:   "spec of cluster",
+		},
+		{
+			Description:     "cluster written",
+			Plan:            saved,
+			SpecHash:        "abc",
+			ResourceVersion: "2",
+			ExpectedError:   "has been written",
+		},
+		{
+			Description:     "plan without hash",
+			Plan:            &fi.Plan{Cluster: "minimal.example.com"},
+			SpecHash:        "abc",
+			ResourceVersion: "1",
+			ExpectedError:   "--save-plan",
+		},
+		{
+			Description:     "other cluster",
+			Plan:            &fi.Plan{Cluster: "other.example.com", SpecHash: "abc", ResourceVersion: "1"},
+			SpecHash:        "abc",
+			ResourceVersion: "1",
+			ExpectedError:   "other.example.com",
+		},
+	}
+	for _, g := range grid {
+		err := checkPlanSource(g.Plan, "minimal.example.com", g.SpecHash, g.ResourceVersion)
+		if g.ExpectedError == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", g.Description, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), g.ExpectedError) {
+			t.Errorf("%s: expected error containing %q, got %v", g.Description, g.ExpectedError, err)
+		}
+	}
+}
+
+// TestUpdateClusterWithoutLock checks that --lock=false updates a cluster without taking the state store lock
+func TestUpdateClusterWithoutLock(t *testing.T) {
+	h := testutils.NewIntegrationTestHarness(t)
+	defer h.Close()
+
+	h.MockKopsVersion("1.8.1")
+	h.SetupMockAWS()
+
+	factoryOptions := &util.FactoryOptions{}
+	factoryOptions.RegistryPath = "memfs://tests"
+	factory := util.NewFactory(factoryOptions)
+
+	srcDir := path.Join(updateClusterTestBase, "minimal")
+	var stdout bytes.Buffer
+	{
+		options := &CreateOptions{}
+		options.Filenames = []string{path.Join(srcDir, "in-v1alpha2.yaml")}
+		if err := RunCreate(factory, &stdout, options); err != nil {
+			t.Fatalf("error creating cluster: %v", err)
+		}
+	}
+	{
+		options := &CreateSecretPublickeyOptions{}
+		options.ClusterName = "minimal.example.com"
+		options.Name = "admin"
+		options.PublicKeyPath = path.Join(srcDir, "id_rsa.pub")
+		if err := RunCreateSecretPublicKey(factory, &stdout, options); err != nil {
+			t.Fatalf("error creating ssh public key: %v", err)
+		}
+	}
+
+	// Another operation holds the lock
+	cluster, err := GetCluster(factory, "minimal.example.com")
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	lease, err := statelock.Acquire(cluster, "rolling-update cluster")
+	if err != nil {
+		t.Fatalf("error acquiring lock: %v", err)
+	}
+	defer lease.Release()
+
+	options := &UpdateClusterOptions{}
+	options.InitDefaults()
+	options.Target = cloudup.TargetTerraform
+	options.OutDir = path.Join(h.TempDir, "out")
+	options.MaxTaskDuration = 30 * time.Second
+	options.CreateKubecfg = false
+
+	if _, err := RunUpdateCluster(factory, "minimal.example.com", &stdout, options); !statelock.IsLocked(err) {
+		t.Fatalf("expected update to fail while the cluster is locked, got %v", err)
+	}
+
+	options.Lock = false
+	if _, err := RunUpdateCluster(factory, "minimal.example.com", &stdout, options); err != nil {
+		t.Fatalf("error updating cluster with --lock=false: %v", err)
+	}
+}
+
+// TestSealedStateKeyNotRendered checks that the secret the state is sealed with is not in the user-data or the terraform output
+func TestSealedStateKeyNotRendered(t *testing.T) {
+	h := testutils.NewIntegrationTestHarness(t)
+	defer h.Close()
+
+	h.MockKopsVersion("1.8.1")
+	h.SetupMockAWS()
+
+	factoryOptions := &util.FactoryOptions{}
+	factoryOptions.RegistryPath = "memfs://tests"
+	factory := util.NewFactory(factoryOptions)
+
+	srcDir := path.Join(updateClusterTestBase, "minimal")
+	var stdout bytes.Buffer
+	{
+		options := &CreateOptions{}
+		options.Filenames = []string{path.Join(srcDir, "in-v1alpha2.yaml")}
+		if err := RunCreate(factory, &stdout, options); err != nil {
+			t.Fatalf("error creating cluster: %v", err)
+		}
+	}
+	{
+		options := &CreateSecretPublickeyOptions{}
+		options.ClusterName = "minimal.example.com"
+		options.Name = "admin"
+		options.PublicKeyPath = path.Join(srcDir, "id_rsa.pub")
+		if err := RunCreateSecretPublicKey(factory, &stdout, options); err != nil {
+			t.Fatalf("error creating ssh public key: %v", err)
+		}
+	}
+
+	clientset, err := factory.Clientset()
+	if err != nil {
+		t.Fatalf("error building clientset: %v", err)
+	}
+	cluster, err := clientset.GetCluster("minimal.example.com")
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	cluster.Spec.SealedState = &kops.SealedStateSpec{}
+	if _, err := clientset.UpdateCluster(cluster, nil); err != nil {
+		t.Fatalf("error updating cluster: %v", err)
+	}
+
+	options := &UpdateClusterOptions{}
+	options.InitDefaults()
+	options.Target = cloudup.TargetTerraform
+	options.OutDir = path.Join(h.TempDir, "out")
+	options.MaxTaskDuration = 30 * time.Second
+	options.CreateKubecfg = false
+	if _, err := RunUpdateCluster(factory, "minimal.example.com", &stdout, options); err != nil {
+		t.Fatalf("error updating cluster: %v", err)
+	}
+
+	secretStore, err := clientset.SecretStore(cluster)
+	if err != nil {
+		t.Fatalf("error building secret store: %v", err)
+	}
+	secret, err := secretStore.Secret(registry.SecretStateSeal)
+	if err != nil {
+		t.Fatalf("error reading the secret the state is sealed with: %v", err)
+	}
+
+	sealed := false
+	err = filepath.Walk(options.OutDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, secret.Data) || bytes.Contains(data, []byte(base64.StdEncoding.EncodeToString(secret.Data))) {
+			t.Errorf("%s contains the secret the state is sealed with", p)
+		}
+		if strings.Contains(string(data), "sealedStateSecretStore:") {
+			sealed = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error reading terraform output: %v", err)
+	}
+	if !sealed {
+		t.Errorf("expected the bootstrap scripts to configure nodeup to read the sealed state")
+	}
+}
@@ -37,6 +37,9 @@ import (
 type UpgradeClusterCmd struct {
 	Yes bool
 
+	// Lock is true if the cluster is locked in the state store while it is upgraded
+	Lock bool
+
 	Channel string
 }
 
@@ -58,6 +61,7 @@ func init() {
 
 	cmd.Flags().BoolVar(&upgradeCluster.Yes, "yes", false, "Apply update")
 	cmd.Flags().StringVar(&upgradeCluster.Channel, "channel", "", "Channel to use for upgrade")
+	cmd.Flags().BoolVar(&upgradeCluster.Lock, "lock", true, "Lock the cluster in the state store while it is changed; --lock=false is for state stores that cannot hold the lock")
 
 	upgradeCmd.AddCommand(cmd)
 }
@@ -273,6 +277,12 @@ func (c *UpgradeClusterCmd) Run(args []string) error {
 		fmt.Printf("\nMust specify --yes to perform upgrade\n")
 		return nil
 	} else {
+		unlock, err := LockCluster(cluster, "upgrade cluster", c.Lock)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
 		for _, action := range actions {
 			action.apply()
 		}
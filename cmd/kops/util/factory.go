@@ -18,15 +18,10 @@ package util
 
 import (
 	"fmt"
-	"net/url"
-	"strings"
 
-	"github.com/golang/glog"
 	"k8s.io/apimachinery/pkg/util/validation/field"
-	"k8s.io/client-go/rest"
 	gceacls "k8s.io/kops/pkg/acls/gce"
 	s3acls "k8s.io/kops/pkg/acls/s3"
-	kopsclient "k8s.io/kops/pkg/client/clientset_generated/clientset"
 	"k8s.io/kops/pkg/client/simple"
 	"k8s.io/kops/pkg/client/simple/api"
 	"k8s.io/kops/pkg/client/simple/vfsclientset"
@@ -69,35 +64,12 @@ func (f *Factory) Clientset() (simple.Clientset, error) {
 			return nil, field.Required(field.NewPath("State Store"), STATE_ERROR)
 		}
 
-		// We recognize a `k8s` scheme; this might change in future so we won't document it yet
-		// In practice nobody is going to hit this accidentally, so I don't think we need a feature flag.
-		if strings.HasPrefix(registryPath, "k8s://") {
-			u, err := url.Parse(registryPath)
+		if api.IsCRDStateStore(registryPath) {
+			clientset, err := api.BuildCRDClientset(registryPath)
 			if err != nil {
-				return nil, fmt.Errorf("Invalid kops server url: %q", registryPath)
-			}
-
-			u.Scheme = "https"
-
-			config := &rest.Config{
-				Host: u.Scheme + "://" + u.Host,
-			}
-
-			glog.Warning("Using insecure TLS")
-			config.Insecure = true
-
-			kopsClient, err := kopsclient.NewForConfig(config)
-			if err != nil {
-				return nil, fmt.Errorf("error building kops API client: %v", err)
-			}
-
-			f.clientset = &api.RESTClientset{
-				BaseURL: &url.URL{
-					Scheme: "k8s",
-					Host:   u.Host,
-				},
-				KopsClient: kopsClient.Kops(),
+				return nil, fmt.Errorf("error building clientset for state store %q: %v", registryPath, err)
 			}
+			f.clientset = clientset
 		} else {
 			basePath, err := vfs.Context.BuildVfsPath(registryPath)
 			if err != nil {
@@ -33,13 +33,24 @@ var (
 	2. All k8s nodes are running and have "Ready" status.
 	3. Componentstatues returns healthly for all components.
 	4. All pods in the kube-system namespace are running and healthy.
+
+	Further checks can be enabled for a cluster by listing them in spec.validation.checks,
+	or the checks to run can be selected with --checks.  The available checks are
+	nodes, components, kube-system-pods, dns, etcd, apiserver-latency, addons,
+	pod-disruption-budgets and certificates.
 	`))
 
 	validateExample = templates.Examples(i18n.T(`
 	# Validate a cluster.
 	# This command uses the currently selected kops cluster as
 	# set by the kubectl config.
-	kops validate cluster`))
+	kops validate cluster
+
+	# Check only etcd and the cluster certificates, reporting the results as JSON.
+	kops validate cluster --checks=etcd,certificates -o json
+
+	# Validate the cluster every 30 seconds, serving the results as Prometheus metrics.
+	kops validate cluster --watch --interval=30s --metrics-listen=:9090`))
 
 	validateShort = i18n.T(`Validate a kops cluster.`)
 )
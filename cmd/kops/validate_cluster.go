@@ -20,9 +20,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
@@ -33,6 +35,7 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/kops/cmd/kops/util"
 	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/simple"
 	"k8s.io/kops/pkg/validation"
 	"k8s.io/kops/util/pkg/tables"
 )
@@ -46,10 +49,19 @@ func init() {
 
 type ValidateClusterOptions struct {
 	output string
+	// checks are the names of the validation checks to run; the defaults and those enabled in the cluster spec are run if empty
+	checks []string
+
+	// watch repeats the validation every interval, until the command is interrupted
+	watch    bool
+	interval time.Duration
+	// metricsListen is the address on which validation metrics are served while watching
+	metricsListen string
 }
 
 func (o *ValidateClusterOptions) InitDefaults() {
 	o.output = OutputTable
+	o.interval = 30 * time.Second
 }
 
 func NewCmdValidateCluster(f *util.Factory, out io.Writer) *cobra.Command {
@@ -68,13 +80,14 @@ func NewCmdValidateCluster(f *util.Factory, out io.Writer) *cobra.Command {
 			}
 			// We want the validate command to exit non-zero if validation found a problem,
 			// even if we didn't really hit an error during validation.
-			if len(result.Failures) != 0 {
+			if result != nil && len(result.Failures) != 0 {
 				os.Exit(2)
 			}
 		},
 	}
 
 	cmd.Flags().StringVarP(&options.output, "output", "o", options.output, "Ouput format. One of json|yaml|table.")
+	cmd.Flags().StringSliceVar(&options.checks, "checks", options.checks, "Validation checks to run, instead of the default checks and those enabled in the cluster spec. One or more of "+strings.Join(validation.ListChecks(), "|")+".")
 
 	return cmd
 }
@@ -85,6 +98,13 @@ func RunValidateCluster(f *util.Factory, cmd *cobra.Command, args []string, out
 		return nil, err
 	}
 
+	if options.metricsListen != "" && !options.watch {
+		return nil, fmt.Errorf("--metrics-listen can only be used with --watch")
+	}
+	if options.watch && options.interval <= 0 {
+		return nil, fmt.Errorf("--interval must be positive")
+	}
+
 	cluster, err := rootCommand.Cluster()
 	if err != nil {
 		return nil, err
@@ -128,40 +148,151 @@ func RunValidateCluster(f *util.Factory, cmd *cobra.Command, args []string, out
 		return nil, fmt.Errorf("Cannot build kubernetes api client for %q: %v", contextName, err)
 	}
 
-	result, err := validation.ValidateCluster(cluster, list, k8sClient)
+	keyStore, err := clientSet.KeyStore(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	configBase, err := clientSet.ConfigBaseFor(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	validator := &validation.ClusterValidator{
+		Cluster:           cluster,
+		InstanceGroupList: list,
+		K8sClient:         k8sClient,
+		KeyStore:          keyStore,
+		ConfigBase:        configBase,
+		Checks:            options.checks,
+	}
+
+	if options.watch {
+		return nil, watchValidateCluster(clientSet, validator, out, options)
+	}
+
+	result, err := validator.Validate()
 	if err != nil {
 		return nil, fmt.Errorf("unexpected error during validation: %v", err)
 	}
 
-	switch options.output {
+	if err := validateClusterOutput(result, cluster, instanceGroups, out, options.output); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// watchValidateCluster validates the cluster every interval, writing each result and exporting metrics, until interrupted.
+// The cluster and its instance groups are read again before each validation, so that changes to them are picked up.
+// It only returns if the metrics cannot be served or the output cannot be written.
+func watchValidateCluster(clientSet simple.Clientset, validator *validation.ClusterValidator, out io.Writer, options *ValidateClusterOptions) error {
+	metrics := validation.NewMetrics(validator.Cluster.ObjectMeta.Name)
+
+	serveErrors := make(chan error, 1)
+	if options.metricsListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		go func() {
+			serveErrors <- http.ListenAndServe(options.metricsListen, mux)
+		}()
+		glog.Infof("Serving validation metrics on %s/metrics", options.metricsListen)
+	}
+
+	ticker := time.NewTicker(options.interval)
+	defer ticker.Stop()
+
+	for first := true; ; first = false {
+		var result *validation.ValidationCluster
+		var err error
+		if !first {
+			err = reloadClusterValidator(clientSet, validator)
+		}
+		if err == nil {
+			result, err = validator.Validate()
+		}
+		metrics.Record(result, err)
+
+		if err != nil {
+			glog.Warningf("unexpected error during validation: %v", err)
+		} else {
+			if options.output == OutputTable {
+				fmt.Fprintf(out, "\n%s\n", time.Now().Format(time.RFC3339))
+			}
+			if options.output == OutputYaml {
+				fmt.Fprintln(out, "---")
+			}
+			if err := validateClusterOutput(result, validator.Cluster, validator.InstanceGroupList.Items, out, options.output); err != nil {
+				return err
+			}
+			if options.output == OutputJSON {
+				fmt.Fprintln(out)
+			}
+		}
+
+		select {
+		case err := <-serveErrors:
+			return fmt.Errorf("error serving metrics on %q: %v", options.metricsListen, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// reloadClusterValidator reads the cluster and its instance groups again, so that the validator
+// expects the instance groups and sizes that are currently configured
+func reloadClusterValidator(clientSet simple.Clientset, validator *validation.ClusterValidator) error {
+	clusterName := validator.Cluster.ObjectMeta.Name
+	cluster, err := clientSet.GetCluster(clusterName)
+	if err != nil {
+		return fmt.Errorf("error reading cluster configuration: %v", err)
+	}
+	if cluster == nil {
+		return fmt.Errorf("cluster %q not found", clusterName)
+	}
+
+	list, err := clientSet.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot get InstanceGroups for %q: %v", clusterName, err)
+	}
+	if len(list.Items) == 0 {
+		return fmt.Errorf("no InstanceGroup objects found")
+	}
+
+	validator.Cluster = cluster
+	validator.InstanceGroupList = list
+	return nil
+}
+
+func validateClusterOutput(result *validation.ValidationCluster, cluster *api.Cluster, instanceGroups []api.InstanceGroup, out io.Writer, output string) error {
+	switch output {
 	case OutputTable:
 		if err := validateClusterOutputTable(result, cluster, instanceGroups, out); err != nil {
-			return nil, err
+			return err
 		}
 
 	case OutputYaml:
 		y, err := yaml.Marshal(result)
 		if err != nil {
-			return nil, fmt.Errorf("unable to marshal YAML: %v", err)
+			return fmt.Errorf("unable to marshal YAML: %v", err)
 		}
 		if _, err := out.Write(y); err != nil {
-			return nil, fmt.Errorf("error writing to output: %v", err)
+			return fmt.Errorf("error writing to output: %v", err)
 		}
 
 	case OutputJSON:
 		j, err := json.Marshal(result)
 		if err != nil {
-			return nil, fmt.Errorf("unable to marshal JSON: %v", err)
+			return fmt.Errorf("unable to marshal JSON: %v", err)
 		}
 		if _, err := out.Write(j); err != nil {
-			return nil, fmt.Errorf("error writing to output: %v", err)
+			return fmt.Errorf("error writing to output: %v", err)
 		}
 
 	default:
-		return nil, fmt.Errorf("Unknown output format: %q", options.output)
+		return fmt.Errorf("Unknown output format: %q", output)
 	}
 
-	return result, nil
+	return nil
 }
 
 func validateClusterOutputTable(result *validation.ValidationCluster, cluster *api.Cluster, instanceGroups []api.InstanceGroup, out io.Writer) error {
@@ -212,6 +343,24 @@ func validateClusterOutputTable(result *validation.ValidationCluster, cluster *a
 		}
 	}
 
+	if len(result.Checks) != 0 {
+		checksTable := &tables.Table{}
+		checksTable.AddColumn("NAME", func(c *validation.CheckResult) string {
+			return c.Name
+		})
+		checksTable.AddColumn("STATUS", func(c *validation.CheckResult) string {
+			return string(c.Status)
+		})
+		checksTable.AddColumn("MESSAGE", func(c *validation.CheckResult) string {
+			return c.Message
+		})
+
+		fmt.Fprintln(out, "\nVALIDATION CHECKS")
+		if err := checksTable.Render(result.Checks, out, "NAME", "STATUS", "MESSAGE"); err != nil {
+			return fmt.Errorf("error rendering checks table: %v", err)
+		}
+	}
+
 	if len(result.Failures) != 0 {
 		failuresTable := &tables.Table{}
 		failuresTable.AddColumn("KIND", func(e *validation.ValidationError) string {
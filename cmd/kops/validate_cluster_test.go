@@ -0,0 +1,90 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"path"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/cmd/kops/util"
+	"k8s.io/kops/pkg/testutils"
+	"k8s.io/kops/pkg/validation"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// TestReloadClusterValidator checks that watching validation picks up changes to the instance groups
+func TestReloadClusterValidator(t *testing.T) {
+	h := testutils.NewIntegrationTestHarness(t)
+	defer h.Close()
+
+	h.SetupMockAWS()
+
+	factoryOptions := &util.FactoryOptions{}
+	factoryOptions.RegistryPath = "memfs://tests"
+	factory := util.NewFactory(factoryOptions)
+
+	var stdout bytes.Buffer
+	options := &CreateOptions{}
+	options.Filenames = []string{path.Join(updateClusterTestBase, "minimal", "in-v1alpha2.yaml")}
+	if err := RunCreate(factory, &stdout, options); err != nil {
+		t.Fatalf("error creating cluster: %v", err)
+	}
+
+	clientset, err := factory.Clientset()
+	if err != nil {
+		t.Fatalf("error building clientset: %v", err)
+	}
+	cluster, err := clientset.GetCluster("minimal.example.com")
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	list, err := clientset.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("error listing instance groups: %v", err)
+	}
+	validator := &validation.ClusterValidator{Cluster: cluster, InstanceGroupList: list}
+
+	// Resize an instance group, and add another one
+	nodes, err := clientset.InstanceGroupsFor(cluster).Get("nodes", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error reading instance group: %v", err)
+	}
+	nodes.Spec.MinSize = fi.Int32(5)
+	nodes.Spec.MaxSize = fi.Int32(5)
+	if _, err := clientset.InstanceGroupsFor(cluster).Update(nodes); err != nil {
+		t.Fatalf("error updating instance group: %v", err)
+	}
+	extra := nodes.DeepCopy()
+	extra.ObjectMeta = metav1.ObjectMeta{Name: "extra-nodes"}
+	if _, err := clientset.InstanceGroupsFor(cluster).Create(extra); err != nil {
+		t.Fatalf("error creating instance group: %v", err)
+	}
+
+	if err := reloadClusterValidator(clientset, validator); err != nil {
+		t.Fatalf("error reloading validator: %v", err)
+	}
+	if len(validator.InstanceGroupList.Items) != len(list.Items)+1 {
+		t.Errorf("expected %d instance groups after reloading, got %d", len(list.Items)+1, len(validator.InstanceGroupList.Items))
+	}
+	for _, ig := range validator.InstanceGroupList.Items {
+		if ig.ObjectMeta.Name == "nodes" && fi.Int32Value(ig.Spec.MinSize) != 5 {
+			t.Errorf("expected the resized instance group after reloading, got minSize %d", fi.Int32Value(ig.Spec.MinSize))
+		}
+	}
+}
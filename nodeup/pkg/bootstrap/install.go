@@ -133,6 +133,26 @@ func (i *Installation) buildSystemdJob() *nodetasks.Service {
 		buffer.WriteString("\"S3_SECRET_ACCESS_KEY=")
 		buffer.WriteString(os.Getenv("S3_SECRET_ACCESS_KEY"))
 		buffer.WriteString("\" ")
+		if os.Getenv("S3_FORCE_PATH_STYLE") != "" {
+			buffer.WriteString("\"S3_FORCE_PATH_STYLE=")
+			buffer.WriteString(os.Getenv("S3_FORCE_PATH_STYLE"))
+			buffer.WriteString("\" ")
+		}
+		if os.Getenv("S3_CA_BUNDLE") != "" {
+			buffer.WriteString("\"S3_CA_BUNDLE=")
+			buffer.WriteString(os.Getenv("S3_CA_BUNDLE"))
+			buffer.WriteString("\" ")
+		}
+	}
+
+	// Pass in the credentials for a state store in Azure Blob Storage
+	if os.Getenv("AZURE_STORAGE_ACCOUNT") != "" {
+		for _, name := range []string{"AZURE_STORAGE_ACCOUNT", "AZURE_STORAGE_KEY", "AZURE_STORAGE_SAS_TOKEN", "AZURE_STORAGE_ENDPOINT"} {
+			if value := os.Getenv(name); value != "" {
+				// Shared access signatures are URL encoded, and systemd would expand the % signs
+				buffer.WriteString("\"" + name + "=" + strings.Replace(value, "%", "%%", -1) + "\" ")
+			}
+		}
 	}
 
 	if buffer.String() != "" {
@@ -117,11 +117,11 @@ func (c *NodeupModelContext) CNIConfDir() string {
 
 // buildPKIKubeconfig generates a kubeconfig
 func (c *NodeupModelContext) buildPKIKubeconfig(id string) (string, error) {
-	caCertificate, err := c.KeyStore.FindCert(fi.CertificateId_CA)
+	caCertificates, err := c.KeyStore.FindCertificatePool(fi.CertificateId_CA)
 	if err != nil {
 		return "", fmt.Errorf("error fetching CA certificate from keystore: %v", err)
 	}
-	if caCertificate == nil {
+	if caCertificates == nil || caCertificates.Primary == nil {
 		return "", fmt.Errorf("CA certificate %q not found", fi.CertificateId_CA)
 	}
 
@@ -151,10 +151,12 @@ func (c *NodeupModelContext) buildPKIKubeconfig(id string) (string, error) {
 		return "", fmt.Errorf("error encoding %q private key: %v", id, err)
 	}
 	cluster := kubeconfig.KubectlCluster{}
-	cluster.CertificateAuthorityData, err = caCertificate.AsBytes()
+	// We trust all the CA certificates, so that the kubeconfig keeps working while the CA is rotated
+	caBundle, err := caCertificates.AsString()
 	if err != nil {
 		return "", fmt.Errorf("error encoding CA certificate: %v", err)
 	}
+	cluster.CertificateAuthorityData = []byte(caBundle)
 
 	if c.IsMaster {
 		if c.IsKubernetesGTE("1.6") {
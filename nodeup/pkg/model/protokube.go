@@ -25,6 +25,7 @@ import (
 
 	kopsbase "k8s.io/kops"
 	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
 	"k8s.io/kops/pkg/apis/kops/util"
 	"k8s.io/kops/pkg/dns"
 	"k8s.io/kops/pkg/flagbuilder"
@@ -67,6 +68,20 @@ func (t *ProtokubeBuilder) Build(c *fi.ModelBuilderContext) error {
 			Mode:     s("0400"),
 		})
 
+		if t.NodeupConfig.SealedStateSecretStore != "" {
+			// protokube verifies the channels it applies from the sealed state with the key
+			secret, err := t.SecretStore.Secret(registry.SecretStateSeal)
+			if err != nil {
+				return err
+			}
+			c.AddTask(&nodetasks.File{
+				Path:     "/var/lib/kops/state-seal-key",
+				Contents: fi.NewBytesResource(secret.Data),
+				Type:     nodetasks.FileType_File,
+				Mode:     s("0400"),
+			})
+		}
+
 		// retrieve the etcd peer certificates and private keys from the keystore
 		if t.UseEtcdTLS() {
 			for _, x := range []string{"etcd", "etcd-client"} {
@@ -212,6 +227,8 @@ type ProtokubeFlags struct {
 	PeerTLSCaFile             *string  `json:"peer-ca,omitempty" flag:"peer-ca"`
 	PeerTLSCertFile           *string  `json:"peer-cert,omitempty" flag:"peer-cert"`
 	PeerTLSKeyFile            *string  `json:"peer-key,omitempty" flag:"peer-key"`
+	SealKeyFile               *string  `json:"sealKeyFile,omitempty" flag:"seal-key-file"`
+	SealedState               *string  `json:"sealedState,omitempty" flag:"sealed-state"`
 	TLSAuth                   *bool    `json:"tls-auth,omitempty" flag:"tls-auth"`
 	TLSCAFile                 *string  `json:"tls-ca,omitempty" flag:"tls-ca"`
 	TLSCertFile               *string  `json:"tls-cert,omitempty" flag:"tls-cert"`
@@ -264,7 +281,7 @@ func (t *ProtokubeBuilder) ProtokubeFlags(k8sVersion semver.Version) (*Protokube
 		image = etcdContainerImage
 	}
 	assets := assets.NewAssetBuilder(t.Cluster, "")
-	remapped, err := assets.RemapImage(image)
+	remapped, err := assets.RemapImage("protokube", image)
 	if err != nil {
 		return nil, fmt.Errorf("unable to remap container %q: %v", image, err)
 	} else {
@@ -273,6 +290,11 @@ func (t *ProtokubeBuilder) ProtokubeFlags(k8sVersion semver.Version) (*Protokube
 
 	f.EtcdImage = s(image)
 
+	if t.IsMaster && t.NodeupConfig.SealedStateSecretStore != "" {
+		f.SealedState = t.NodeupConfig.ConfigBase
+		f.SealKeyFile = s("/rootfs/var/lib/kops/state-seal-key")
+	}
+
 	// initialize rbac on Kubernetes >= 1.6 and master
 	if k8sVersion.Major == 1 && k8sVersion.Minor >= 6 {
 		f.InitializeRBAC = fi.Bool(true)
@@ -362,6 +384,16 @@ func (t *ProtokubeBuilder) ProtokubeEnvironmentVariables() string {
 		buffer.WriteString(" ")
 	}
 
+	// Pass in the credentials for a state store in Azure Blob Storage, which nodeup was given in the user-data
+	if os.Getenv("AZURE_STORAGE_ACCOUNT") != "" {
+		for _, name := range []string{"AZURE_STORAGE_ACCOUNT", "AZURE_STORAGE_KEY", "AZURE_STORAGE_SAS_TOKEN", "AZURE_STORAGE_ENDPOINT"} {
+			if value := os.Getenv(name); value != "" {
+				// Shared access signatures are URL encoded, and systemd would expand the % signs
+				buffer.WriteString(" -e " + name + "='" + strings.Replace(value, "%", "%%", -1) + "' ")
+			}
+		}
+	}
+
 	if os.Getenv("S3_ENDPOINT") != "" {
 		buffer.WriteString(" ")
 		buffer.WriteString("-e S3_ENDPOINT=")
@@ -381,6 +413,21 @@ func (t *ProtokubeBuilder) ProtokubeEnvironmentVariables() string {
 		buffer.WriteString(os.Getenv("S3_SECRET_ACCESS_KEY"))
 		buffer.WriteString("'")
 		buffer.WriteString(" ")
+		if os.Getenv("S3_FORCE_PATH_STYLE") != "" {
+			buffer.WriteString(" -e S3_FORCE_PATH_STYLE=")
+			buffer.WriteString("'")
+			buffer.WriteString(os.Getenv("S3_FORCE_PATH_STYLE"))
+			buffer.WriteString("'")
+			buffer.WriteString(" ")
+		}
+		if os.Getenv("S3_CA_BUNDLE") != "" {
+			// The root filesystem of the host is mounted at /rootfs in the protokube container
+			buffer.WriteString(" -e S3_CA_BUNDLE=")
+			buffer.WriteString("'")
+			buffer.WriteString("/rootfs" + os.Getenv("S3_CA_BUNDLE"))
+			buffer.WriteString("'")
+			buffer.WriteString(" ")
+		}
 	}
 
 	t.writeProxyEnvVars(&buffer)
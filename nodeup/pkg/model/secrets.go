@@ -55,7 +55,9 @@ func (b *SecretBuilder) Build(c *fi.ModelBuilderContext) error {
 			return fmt.Errorf("certificate %q not found", fi.CertificateId_CA)
 		}
 
-		serialized, err := ca.Primary.AsString()
+		// We write the whole pool, so that certificates signed by a CA that is being rotated in (or out) are trusted.
+		// The primary is written first, which is the certificate the controller-manager signs with.
+		serialized, err := ca.AsString()
 		if err != nil {
 			return err
 		}
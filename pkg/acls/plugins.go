@@ -29,6 +29,11 @@ var strategiesMutex sync.Mutex
 
 // GetACL returns the ACL for the vfs.Path, by consulting all registered strategies
 func GetACL(p vfs.Path, cluster *kops.Cluster) (vfs.ACL, error) {
+	// Sealed files are written with the ACL of the path where they are stored
+	if sealed, ok := p.(*vfs.SealedPath); ok {
+		p = sealed.Inner()
+	}
+
 	strategiesMutex.Lock()
 	defer strategiesMutex.Unlock()
 
@@ -31,6 +31,9 @@ type Cluster struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec ClusterSpec `json:"spec,omitempty"`
+
+	// Status is the status of the reconciliation of the cluster by kops reconcile cluster
+	Status *ClusterReconcileStatus `json:"status,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -43,6 +46,48 @@ type ClusterList struct {
 	Items []Cluster `json:"items"`
 }
 
+// ClusterReconcileStatus is the status of a cluster, as reported by kops reconcile cluster.  It is not part of
+// the configuration of the cluster, and is only written when it changes.
+type ClusterReconcileStatus struct {
+	// AppliedSpecHash is the hash of the cluster spec and instance group specs that were last applied successfully
+	AppliedSpecHash string `json:"appliedSpecHash,omitempty"`
+	// Conditions are the latest observations of the state of the reconciliation
+	Conditions []ClusterCondition `json:"conditions,omitempty"`
+}
+
+// ClusterConditionType is the type of a ClusterCondition
+type ClusterConditionType string
+
+const (
+	// ClusterConditionReconciled is True when the current configuration of the cluster was applied successfully
+	ClusterConditionReconciled ClusterConditionType = "Reconciled"
+	// ClusterConditionPaused is True when reconciliation is paused by the reconcile-paused annotation
+	ClusterConditionPaused ClusterConditionType = "Paused"
+)
+
+// ConditionStatus is the status of a condition: True, False or Unknown
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// ClusterCondition is an observation of the state of the reconciliation of a cluster
+type ClusterCondition struct {
+	// Type is the type of the condition
+	Type ClusterConditionType `json:"type"`
+	// Status is the status of the condition: True, False or Unknown
+	Status ConditionStatus `json:"status"`
+	// LastTransitionTime is the time the condition last changed status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a CamelCase reason for the last transition of the condition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition of the condition
+	Message string `json:"message,omitempty"`
+}
+
 // ClusterSpec defines the configuration for a cluster
 type ClusterSpec struct {
 	// The Channel we are following
@@ -164,6 +209,12 @@ type ClusterSpec struct {
 	EncryptionConfig *bool `json:"encryptionConfig,omitempty"`
 	// Target allows for us to nest extra config for targets such as terraform
 	Target *TargetSpec `json:"target,omitempty"`
+	// Validation configures the checks run when validating the cluster
+	Validation *ClusterValidationSpec `json:"validation,omitempty"`
+	// Certificates configures the certificates that kops issues for the cluster
+	Certificates *CertificatesSpec `json:"certificates,omitempty"`
+	// SealedState seals the files that nodeup reads from the state store, so that nodeup refuses files that were tampered with
+	SealedState *SealedStateSpec `json:"sealedState,omitempty"`
 }
 
 // AddonSpec defines an addon that we want to install in the cluster
@@ -192,6 +243,19 @@ type Assets struct {
 	ContainerRegistry *string `json:"containerRegistry,omitempty"`
 	// FileRepository is the url for a private file serving repository
 	FileRepository *string `json:"fileRepository,omitempty"`
+	// PinImageDigests resolves every container image to the digest of its manifest when the cluster is updated,
+	// and runs the images by digest, so that moving a tag does not change the images the cluster runs
+	PinImageDigests *bool `json:"pinImageDigests,omitempty"`
+	// ImageSignature requires every container image to be signed, which is verified when the cluster is updated.
+	// The images are pinned to the digests whose signatures were verified.
+	ImageSignature *ImageSignatureSpec `json:"imageSignature,omitempty"`
+}
+
+// ImageSignatureSpec configures the verification of container image signatures.
+// Signatures are stored in the registry alongside the image, as cosign stores them.
+type ImageSignatureSpec struct {
+	// PublicKey is the PEM-encoded ECDSA or RSA public key the images must be signed with
+	PublicKey string `json:"publicKey,omitempty"`
 }
 
 // IAMSpec adds control over the IAM security policies applied to resources
@@ -399,6 +463,27 @@ type HTTPProxy struct {
 	// Password string `json:"password,omitempty"`
 }
 
+// ClusterValidationSpec configures the checks run when validating the cluster
+type ClusterValidationSpec struct {
+	// Checks are the names of checks to run in addition to the default checks, for example etcd or certificates
+	Checks []string `json:"checks,omitempty"`
+}
+
+// CertificatesSpec configures the certificates that kops issues for the cluster
+type CertificatesSpec struct {
+	// RenewalWindow is how long before they expire that certificates in the keystore are reissued by kops update cluster.
+	// It must be less than the validity of the certificates kops issues; certificates already copied to instances are only replaced with the instances.
+	// If it is not set, certificates are only reissued when their names change.
+	RenewalWindow *metav1.Duration `json:"renewalWindow,omitempty"`
+}
+
+// SealedStateSpec configures sealing of the files that nodeup reads from the state store.
+// The files are signed with a key kept in the secret store, which is passed to nodeup in the instance user-data.
+type SealedStateSpec struct {
+	// Encrypt encrypts the completed cluster spec with AES-GCM, as well as signing it
+	Encrypt *bool `json:"encrypt,omitempty"`
+}
+
 // TargetSpec allows for specifying target config in an extensible way
 type TargetSpec struct {
 	Terraform *TerraformSpec `json:"terraform,omitempty"`
@@ -21,6 +21,7 @@ import (
 
 	"github.com/golang/glog"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const LabelClusterName = "kops.k8s.io/cluster"
@@ -116,6 +117,8 @@ type InstanceGroupSpec struct {
 	AdditionalUserData []UserData `json:"additionalUserData,omitempty"`
 	// SuspendProcesses disables the listed Scaling Policies
 	SuspendProcesses []string `json:"suspendProcesses,omitempty"`
+	// RollingUpdate defines how the instances in this group are replaced during a rolling update
+	RollingUpdate *RollingUpdate `json:"rollingUpdate,omitempty"`
 }
 
 // UserData defines a user-data section
@@ -128,6 +131,76 @@ type UserData struct {
 	Content string `json:"content,omitempty"`
 }
 
+// RollingUpdate defines the strategy used when replacing the instances of an InstanceGroup
+type RollingUpdate struct {
+	// MaxUnavailable is the maximum number of instances that can be unavailable during the update.
+	// The value can be an absolute number (for example 5) or a percentage of the group size (for example 10%).
+	// The absolute number is calculated from a percentage by rounding down.
+	// Defaults to 1 when MaxSurge is 0.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// MaxSurge is the maximum number of extra instances that can be created above the group size during the update.
+	// The value can be an absolute number (for example 5) or a percentage of the group size (for example 10%).
+	// The absolute number is calculated from a percentage by rounding up.
+	// Surging is only supported for node instance groups. Defaults to 0.
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+	// Hooks are actions run at fixed points while each instance is replaced
+	Hooks []RollingUpdateHook `json:"hooks,omitempty"`
+}
+
+// RollingUpdateHookEvent is a point in the replacement of an instance at which a hook can run
+type RollingUpdateHookEvent string
+
+const (
+	// RollingUpdateHookBeforeDrain runs before the node backing an instance is drained
+	RollingUpdateHookBeforeDrain RollingUpdateHookEvent = "BeforeDrain"
+	// RollingUpdateHookAfterDrain runs after the node backing an instance is drained, before the instance is terminated
+	RollingUpdateHookAfterDrain RollingUpdateHookEvent = "AfterDrain"
+	// RollingUpdateHookAfterTerminate runs after an instance is terminated
+	RollingUpdateHookAfterTerminate RollingUpdateHookEvent = "AfterTerminate"
+	// RollingUpdateHookAfterValidate runs after the cluster validates following the replacement of a batch of instances
+	RollingUpdateHookAfterValidate RollingUpdateHookEvent = "AfterValidate"
+)
+
+// RollingUpdateHookFailurePolicy is what happens when a rolling update hook fails
+type RollingUpdateHookFailurePolicy string
+
+const (
+	// RollingUpdateHookFailurePolicyAbort stops the rolling update
+	RollingUpdateHookFailurePolicyAbort RollingUpdateHookFailurePolicy = "Abort"
+	// RollingUpdateHookFailurePolicyContinue logs the failure and carries on with the rolling update
+	RollingUpdateHookFailurePolicyContinue RollingUpdateHookFailurePolicy = "Continue"
+	// RollingUpdateHookFailurePolicyRetry runs the hook again, and stops the rolling update if it never succeeds
+	RollingUpdateHookFailurePolicyRetry RollingUpdateHookFailurePolicy = "Retry"
+)
+
+// RollingUpdateHook is an action run during the rolling update of an InstanceGroup.
+// Exactly one of ExecContainer and HTTP must be set.
+type RollingUpdateHook struct {
+	// Name identifies the hook in logs and errors
+	Name string `json:"name,omitempty"`
+	// Events are the points in the replacement of an instance at which the hook runs
+	Events []RollingUpdateHookEvent `json:"events,omitempty"`
+	// ExecContainer runs a container in the cluster, as a pod in the kube-system namespace
+	ExecContainer *ExecContainerAction `json:"execContainer,omitempty"`
+	// HTTP calls a webhook
+	HTTP *HTTPHookAction `json:"http,omitempty"`
+	// FailurePolicy is one of Abort, Continue or Retry. Defaults to Abort.
+	FailurePolicy RollingUpdateHookFailurePolicy `json:"failurePolicy,omitempty"`
+	// MaxRetries is the number of times a failing hook is retried, when the FailurePolicy is Retry. Defaults to 3.
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+	// Timeout is the maximum time a single run of the hook may take. Defaults to 5 minutes.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// HTTPHookAction calls a webhook.  The details of the event are POSTed as a JSON object,
+// and any response status other than 2xx is treated as a failure.
+type HTTPHookAction struct {
+	// URL is the address of the webhook
+	URL string `json:"url,omitempty"`
+	// Headers are additional HTTP headers sent with the request
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
 // PerformAssignmentsInstanceGroups populates InstanceGroups with default values
 func PerformAssignmentsInstanceGroups(groups []*InstanceGroup) error {
 	names := map[string]bool{}
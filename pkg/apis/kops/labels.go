@@ -24,3 +24,6 @@ const AnnotationValueManagementImported = "imported"
 
 // UpdatePolicyExternal is a value for ClusterSpec.UpdatePolicy indicating that upgrades are done externally, and we should disable automatic upgrades
 const UpdatePolicyExternal = "external"
+
+// AnnotationNameReconcilePaused is the annotation that, when set to "true" on a cluster, stops kops reconcile cluster from applying it
+const AnnotationNameReconcilePaused = "kops.kubernetes.io/reconcile-paused"
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// PathMoved is the path of the marker left at the old location when a cluster is moved to another state store
+const PathMoved = "moved"
+
+// MovedMarker records that a cluster was moved to another state store
+type MovedMarker struct {
+	// StateStore is the state store the cluster was moved to
+	StateStore string `json:"stateStore"`
+	// ConfigBase is the new ConfigBase of the cluster
+	ConfigBase string `json:"configBase"`
+	// Timestamp is the time the cluster was moved
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ReadMovedMarker reads the marker left when the cluster at configBase was moved, returning nil if it was not moved
+func ReadMovedMarker(configBase vfs.Path) (*MovedMarker, error) {
+	marker := &MovedMarker{}
+	if err := ReadConfigDeprecated(configBase.Join(PathMoved), marker); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if marker.StateStore == "" {
+		return nil, fmt.Errorf("marker %s does not record the new state store", configBase.Join(PathMoved))
+	}
+	return marker, nil
+}
+
+// WriteMovedMarker writes the marker recording that the cluster at configBase was moved
+func WriteMovedMarker(cluster *kops.Cluster, configBase vfs.Path, marker *MovedMarker) error {
+	return WriteConfigDeprecated(cluster, configBase.Join(PathMoved), marker)
+}
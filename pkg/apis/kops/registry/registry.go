@@ -30,6 +30,13 @@ const PathCluster = "config"
 // Path for completed cluster spec in the state store
 const PathClusterCompleted = "cluster.spec"
 
+// Path for the advisory lock held while an operation changes the cluster
+const PathLock = "lock"
+
+// SecretStateSeal is the id of the secret that the files nodeup reads from the state store are sealed with.
+// It is kept in the secret store, so sealing only protects against those who can write to the state store but cannot read the secrets.
+const SecretStateSeal = "kops-state-seal"
+
 func ConfigBase(c *api.Cluster) (vfs.Path, error) {
 	if c.Spec.ConfigBase == "" {
 		return nil, field.Required(field.NewPath("Spec", "ConfigBase"), "")
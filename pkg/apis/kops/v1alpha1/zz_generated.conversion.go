@@ -55,6 +55,8 @@ func RegisterConversions(scheme *runtime.Scheme) error {
 		Convert_kops_CalicoNetworkingSpec_To_v1alpha1_CalicoNetworkingSpec,
 		Convert_v1alpha1_CanalNetworkingSpec_To_kops_CanalNetworkingSpec,
 		Convert_kops_CanalNetworkingSpec_To_v1alpha1_CanalNetworkingSpec,
+		Convert_v1alpha1_CertificatesSpec_To_kops_CertificatesSpec,
+		Convert_kops_CertificatesSpec_To_v1alpha1_CertificatesSpec,
 		Convert_v1alpha1_ClassicNetworkingSpec_To_kops_ClassicNetworkingSpec,
 		Convert_kops_ClassicNetworkingSpec_To_v1alpha1_ClassicNetworkingSpec,
 		Convert_v1alpha1_CloudConfiguration_To_kops_CloudConfiguration,
@@ -63,10 +65,16 @@ func RegisterConversions(scheme *runtime.Scheme) error {
 		Convert_kops_CloudControllerManagerConfig_To_v1alpha1_CloudControllerManagerConfig,
 		Convert_v1alpha1_Cluster_To_kops_Cluster,
 		Convert_kops_Cluster_To_v1alpha1_Cluster,
+		Convert_v1alpha1_ClusterCondition_To_kops_ClusterCondition,
+		Convert_kops_ClusterCondition_To_v1alpha1_ClusterCondition,
 		Convert_v1alpha1_ClusterList_To_kops_ClusterList,
 		Convert_kops_ClusterList_To_v1alpha1_ClusterList,
+		Convert_v1alpha1_ClusterReconcileStatus_To_kops_ClusterReconcileStatus,
+		Convert_kops_ClusterReconcileStatus_To_v1alpha1_ClusterReconcileStatus,
 		Convert_v1alpha1_ClusterSpec_To_kops_ClusterSpec,
 		Convert_kops_ClusterSpec_To_v1alpha1_ClusterSpec,
+		Convert_v1alpha1_ClusterValidationSpec_To_kops_ClusterValidationSpec,
+		Convert_kops_ClusterValidationSpec_To_v1alpha1_ClusterValidationSpec,
 		Convert_v1alpha1_DNSAccessSpec_To_kops_DNSAccessSpec,
 		Convert_kops_DNSAccessSpec_To_v1alpha1_DNSAccessSpec,
 		Convert_v1alpha1_DNSSpec_To_kops_DNSSpec,
@@ -91,12 +99,16 @@ func RegisterConversions(scheme *runtime.Scheme) error {
 		Convert_kops_FileAssetSpec_To_v1alpha1_FileAssetSpec,
 		Convert_v1alpha1_FlannelNetworkingSpec_To_kops_FlannelNetworkingSpec,
 		Convert_kops_FlannelNetworkingSpec_To_v1alpha1_FlannelNetworkingSpec,
+		Convert_v1alpha1_HTTPHookAction_To_kops_HTTPHookAction,
+		Convert_kops_HTTPHookAction_To_v1alpha1_HTTPHookAction,
 		Convert_v1alpha1_HTTPProxy_To_kops_HTTPProxy,
 		Convert_kops_HTTPProxy_To_v1alpha1_HTTPProxy,
 		Convert_v1alpha1_HookSpec_To_kops_HookSpec,
 		Convert_kops_HookSpec_To_v1alpha1_HookSpec,
 		Convert_v1alpha1_IAMSpec_To_kops_IAMSpec,
 		Convert_kops_IAMSpec_To_v1alpha1_IAMSpec,
+		Convert_v1alpha1_ImageSignatureSpec_To_kops_ImageSignatureSpec,
+		Convert_kops_ImageSignatureSpec_To_v1alpha1_ImageSignatureSpec,
 		Convert_v1alpha1_InstanceGroup_To_kops_InstanceGroup,
 		Convert_kops_InstanceGroup_To_v1alpha1_InstanceGroup,
 		Convert_v1alpha1_InstanceGroupList_To_kops_InstanceGroupList,
@@ -131,6 +143,10 @@ func RegisterConversions(scheme *runtime.Scheme) error {
 		Convert_kops_NetworkingSpec_To_v1alpha1_NetworkingSpec,
 		Convert_v1alpha1_RBACAuthorizationSpec_To_kops_RBACAuthorizationSpec,
 		Convert_kops_RBACAuthorizationSpec_To_v1alpha1_RBACAuthorizationSpec,
+		Convert_v1alpha1_RollingUpdate_To_kops_RollingUpdate,
+		Convert_kops_RollingUpdate_To_v1alpha1_RollingUpdate,
+		Convert_v1alpha1_RollingUpdateHook_To_kops_RollingUpdateHook,
+		Convert_kops_RollingUpdateHook_To_v1alpha1_RollingUpdateHook,
 		Convert_v1alpha1_RomanaNetworkingSpec_To_kops_RomanaNetworkingSpec,
 		Convert_kops_RomanaNetworkingSpec_To_v1alpha1_RomanaNetworkingSpec,
 		Convert_v1alpha1_SSHCredential_To_kops_SSHCredential,
@@ -139,6 +155,8 @@ func RegisterConversions(scheme *runtime.Scheme) error {
 		Convert_kops_SSHCredentialList_To_v1alpha1_SSHCredentialList,
 		Convert_v1alpha1_SSHCredentialSpec_To_kops_SSHCredentialSpec,
 		Convert_kops_SSHCredentialSpec_To_v1alpha1_SSHCredentialSpec,
+		Convert_v1alpha1_SealedStateSpec_To_kops_SealedStateSpec,
+		Convert_kops_SealedStateSpec_To_v1alpha1_SealedStateSpec,
 		Convert_v1alpha1_TargetSpec_To_kops_TargetSpec,
 		Convert_kops_TargetSpec_To_v1alpha1_TargetSpec,
 		Convert_v1alpha1_TerraformSpec_To_kops_TerraformSpec,
@@ -263,6 +281,16 @@ func Convert_kops_AmazonVPCNetworkingSpec_To_v1alpha1_AmazonVPCNetworkingSpec(in
 func autoConvert_v1alpha1_Assets_To_kops_Assets(in *Assets, out *kops.Assets, s conversion.Scope) error {
 	out.ContainerRegistry = in.ContainerRegistry
 	out.FileRepository = in.FileRepository
+	out.PinImageDigests = in.PinImageDigests
+	if in.ImageSignature != nil {
+		in, out := &in.ImageSignature, &out.ImageSignature
+		*out = new(kops.ImageSignatureSpec)
+		if err := Convert_v1alpha1_ImageSignatureSpec_To_kops_ImageSignatureSpec(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.ImageSignature = nil
+	}
 	return nil
 }
 
@@ -274,6 +302,16 @@ func Convert_v1alpha1_Assets_To_kops_Assets(in *Assets, out *kops.Assets, s conv
 func autoConvert_kops_Assets_To_v1alpha1_Assets(in *kops.Assets, out *Assets, s conversion.Scope) error {
 	out.ContainerRegistry = in.ContainerRegistry
 	out.FileRepository = in.FileRepository
+	out.PinImageDigests = in.PinImageDigests
+	if in.ImageSignature != nil {
+		in, out := &in.ImageSignature, &out.ImageSignature
+		*out = new(ImageSignatureSpec)
+		if err := Convert_kops_ImageSignatureSpec_To_v1alpha1_ImageSignatureSpec(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.ImageSignature = nil
+	}
 	return nil
 }
 
@@ -448,6 +486,26 @@ func Convert_kops_CanalNetworkingSpec_To_v1alpha1_CanalNetworkingSpec(in *kops.C
 	return autoConvert_kops_CanalNetworkingSpec_To_v1alpha1_CanalNetworkingSpec(in, out, s)
 }
 
+func autoConvert_v1alpha1_CertificatesSpec_To_kops_CertificatesSpec(in *CertificatesSpec, out *kops.CertificatesSpec, s conversion.Scope) error {
+	out.RenewalWindow = in.RenewalWindow
+	return nil
+}
+
+// Convert_v1alpha1_CertificatesSpec_To_kops_CertificatesSpec is an autogenerated conversion function.
+func Convert_v1alpha1_CertificatesSpec_To_kops_CertificatesSpec(in *CertificatesSpec, out *kops.CertificatesSpec, s conversion.Scope) error {
+	return autoConvert_v1alpha1_CertificatesSpec_To_kops_CertificatesSpec(in, out, s)
+}
+
+func autoConvert_kops_CertificatesSpec_To_v1alpha1_CertificatesSpec(in *kops.CertificatesSpec, out *CertificatesSpec, s conversion.Scope) error {
+	out.RenewalWindow = in.RenewalWindow
+	return nil
+}
+
+// Convert_kops_CertificatesSpec_To_v1alpha1_CertificatesSpec is an autogenerated conversion function.
+func Convert_kops_CertificatesSpec_To_v1alpha1_CertificatesSpec(in *kops.CertificatesSpec, out *CertificatesSpec, s conversion.Scope) error {
+	return autoConvert_kops_CertificatesSpec_To_v1alpha1_CertificatesSpec(in, out, s)
+}
+
 func autoConvert_v1alpha1_ClassicNetworkingSpec_To_kops_ClassicNetworkingSpec(in *ClassicNetworkingSpec, out *kops.ClassicNetworkingSpec, s conversion.Scope) error {
 	return nil
 }
@@ -569,6 +627,15 @@ func autoConvert_v1alpha1_Cluster_To_kops_Cluster(in *Cluster, out *kops.Cluster
 	if err := Convert_v1alpha1_ClusterSpec_To_kops_ClusterSpec(&in.Spec, &out.Spec, s); err != nil {
 		return err
 	}
+	if in.Status != nil {
+		in, out := &in.Status, &out.Status
+		*out = new(kops.ClusterReconcileStatus)
+		if err := Convert_v1alpha1_ClusterReconcileStatus_To_kops_ClusterReconcileStatus(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Status = nil
+	}
 	return nil
 }
 
@@ -582,6 +649,15 @@ func autoConvert_kops_Cluster_To_v1alpha1_Cluster(in *kops.Cluster, out *Cluster
 	if err := Convert_kops_ClusterSpec_To_v1alpha1_ClusterSpec(&in.Spec, &out.Spec, s); err != nil {
 		return err
 	}
+	if in.Status != nil {
+		in, out := &in.Status, &out.Status
+		*out = new(ClusterReconcileStatus)
+		if err := Convert_kops_ClusterReconcileStatus_To_v1alpha1_ClusterReconcileStatus(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Status = nil
+	}
 	return nil
 }
 
@@ -590,6 +666,34 @@ func Convert_kops_Cluster_To_v1alpha1_Cluster(in *kops.Cluster, out *Cluster, s
 	return autoConvert_kops_Cluster_To_v1alpha1_Cluster(in, out, s)
 }
 
+func autoConvert_v1alpha1_ClusterCondition_To_kops_ClusterCondition(in *ClusterCondition, out *kops.ClusterCondition, s conversion.Scope) error {
+	out.Type = kops.ClusterConditionType(in.Type)
+	out.Status = kops.ConditionStatus(in.Status)
+	out.LastTransitionTime = in.LastTransitionTime
+	out.Reason = in.Reason
+	out.Message = in.Message
+	return nil
+}
+
+// Convert_v1alpha1_ClusterCondition_To_kops_ClusterCondition is an autogenerated conversion function.
+func Convert_v1alpha1_ClusterCondition_To_kops_ClusterCondition(in *ClusterCondition, out *kops.ClusterCondition, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ClusterCondition_To_kops_ClusterCondition(in, out, s)
+}
+
+func autoConvert_kops_ClusterCondition_To_v1alpha1_ClusterCondition(in *kops.ClusterCondition, out *ClusterCondition, s conversion.Scope) error {
+	out.Type = string(in.Type)
+	out.Status = string(in.Status)
+	out.LastTransitionTime = in.LastTransitionTime
+	out.Reason = in.Reason
+	out.Message = in.Message
+	return nil
+}
+
+// Convert_kops_ClusterCondition_To_v1alpha1_ClusterCondition is an autogenerated conversion function.
+func Convert_kops_ClusterCondition_To_v1alpha1_ClusterCondition(in *kops.ClusterCondition, out *ClusterCondition, s conversion.Scope) error {
+	return autoConvert_kops_ClusterCondition_To_v1alpha1_ClusterCondition(in, out, s)
+}
+
 func autoConvert_v1alpha1_ClusterList_To_kops_ClusterList(in *ClusterList, out *kops.ClusterList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
 	if in.Items != nil {
@@ -632,6 +736,48 @@ func Convert_kops_ClusterList_To_v1alpha1_ClusterList(in *kops.ClusterList, out
 	return autoConvert_kops_ClusterList_To_v1alpha1_ClusterList(in, out, s)
 }
 
+func autoConvert_v1alpha1_ClusterReconcileStatus_To_kops_ClusterReconcileStatus(in *ClusterReconcileStatus, out *kops.ClusterReconcileStatus, s conversion.Scope) error {
+	out.AppliedSpecHash = in.AppliedSpecHash
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]kops.ClusterCondition, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha1_ClusterCondition_To_kops_ClusterCondition(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Conditions = nil
+	}
+	return nil
+}
+
+// Convert_v1alpha1_ClusterReconcileStatus_To_kops_ClusterReconcileStatus is an autogenerated conversion function.
+func Convert_v1alpha1_ClusterReconcileStatus_To_kops_ClusterReconcileStatus(in *ClusterReconcileStatus, out *kops.ClusterReconcileStatus, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ClusterReconcileStatus_To_kops_ClusterReconcileStatus(in, out, s)
+}
+
+func autoConvert_kops_ClusterReconcileStatus_To_v1alpha1_ClusterReconcileStatus(in *kops.ClusterReconcileStatus, out *ClusterReconcileStatus, s conversion.Scope) error {
+	out.AppliedSpecHash = in.AppliedSpecHash
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ClusterCondition, len(*in))
+		for i := range *in {
+			if err := Convert_kops_ClusterCondition_To_v1alpha1_ClusterCondition(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Conditions = nil
+	}
+	return nil
+}
+
+// Convert_kops_ClusterReconcileStatus_To_v1alpha1_ClusterReconcileStatus is an autogenerated conversion function.
+func Convert_kops_ClusterReconcileStatus_To_v1alpha1_ClusterReconcileStatus(in *kops.ClusterReconcileStatus, out *ClusterReconcileStatus, s conversion.Scope) error {
+	return autoConvert_kops_ClusterReconcileStatus_To_v1alpha1_ClusterReconcileStatus(in, out, s)
+}
+
 func autoConvert_v1alpha1_ClusterSpec_To_kops_ClusterSpec(in *ClusterSpec, out *kops.ClusterSpec, s conversion.Scope) error {
 	out.Channel = in.Channel
 	if in.Addons != nil {
@@ -885,6 +1031,33 @@ func autoConvert_v1alpha1_ClusterSpec_To_kops_ClusterSpec(in *ClusterSpec, out *
 	} else {
 		out.Target = nil
 	}
+	if in.Validation != nil {
+		in, out := &in.Validation, &out.Validation
+		*out = new(kops.ClusterValidationSpec)
+		if err := Convert_v1alpha1_ClusterValidationSpec_To_kops_ClusterValidationSpec(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Validation = nil
+	}
+	if in.Certificates != nil {
+		in, out := &in.Certificates, &out.Certificates
+		*out = new(kops.CertificatesSpec)
+		if err := Convert_v1alpha1_CertificatesSpec_To_kops_CertificatesSpec(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Certificates = nil
+	}
+	if in.SealedState != nil {
+		in, out := &in.SealedState, &out.SealedState
+		*out = new(kops.SealedStateSpec)
+		if err := Convert_v1alpha1_SealedStateSpec_To_kops_SealedStateSpec(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.SealedState = nil
+	}
 	return nil
 }
 
@@ -1142,9 +1315,56 @@ func autoConvert_kops_ClusterSpec_To_v1alpha1_ClusterSpec(in *kops.ClusterSpec,
 	} else {
 		out.Target = nil
 	}
+	if in.Validation != nil {
+		in, out := &in.Validation, &out.Validation
+		*out = new(ClusterValidationSpec)
+		if err := Convert_kops_ClusterValidationSpec_To_v1alpha1_ClusterValidationSpec(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Validation = nil
+	}
+	if in.Certificates != nil {
+		in, out := &in.Certificates, &out.Certificates
+		*out = new(CertificatesSpec)
+		if err := Convert_kops_CertificatesSpec_To_v1alpha1_CertificatesSpec(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Certificates = nil
+	}
+	if in.SealedState != nil {
+		in, out := &in.SealedState, &out.SealedState
+		*out = new(SealedStateSpec)
+		if err := Convert_kops_SealedStateSpec_To_v1alpha1_SealedStateSpec(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.SealedState = nil
+	}
+	return nil
+}
+
+func autoConvert_v1alpha1_ClusterValidationSpec_To_kops_ClusterValidationSpec(in *ClusterValidationSpec, out *kops.ClusterValidationSpec, s conversion.Scope) error {
+	out.Checks = in.Checks
 	return nil
 }
 
+// Convert_v1alpha1_ClusterValidationSpec_To_kops_ClusterValidationSpec is an autogenerated conversion function.
+func Convert_v1alpha1_ClusterValidationSpec_To_kops_ClusterValidationSpec(in *ClusterValidationSpec, out *kops.ClusterValidationSpec, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ClusterValidationSpec_To_kops_ClusterValidationSpec(in, out, s)
+}
+
+func autoConvert_kops_ClusterValidationSpec_To_v1alpha1_ClusterValidationSpec(in *kops.ClusterValidationSpec, out *ClusterValidationSpec, s conversion.Scope) error {
+	out.Checks = in.Checks
+	return nil
+}
+
+// Convert_kops_ClusterValidationSpec_To_v1alpha1_ClusterValidationSpec is an autogenerated conversion function.
+func Convert_kops_ClusterValidationSpec_To_v1alpha1_ClusterValidationSpec(in *kops.ClusterValidationSpec, out *ClusterValidationSpec, s conversion.Scope) error {
+	return autoConvert_kops_ClusterValidationSpec_To_v1alpha1_ClusterValidationSpec(in, out, s)
+}
+
 func autoConvert_v1alpha1_DNSAccessSpec_To_kops_DNSAccessSpec(in *DNSAccessSpec, out *kops.DNSAccessSpec, s conversion.Scope) error {
 	return nil
 }
@@ -1511,6 +1731,28 @@ func Convert_kops_FlannelNetworkingSpec_To_v1alpha1_FlannelNetworkingSpec(in *ko
 	return autoConvert_kops_FlannelNetworkingSpec_To_v1alpha1_FlannelNetworkingSpec(in, out, s)
 }
 
+func autoConvert_v1alpha1_HTTPHookAction_To_kops_HTTPHookAction(in *HTTPHookAction, out *kops.HTTPHookAction, s conversion.Scope) error {
+	out.URL = in.URL
+	out.Headers = in.Headers
+	return nil
+}
+
+// Convert_v1alpha1_HTTPHookAction_To_kops_HTTPHookAction is an autogenerated conversion function.
+func Convert_v1alpha1_HTTPHookAction_To_kops_HTTPHookAction(in *HTTPHookAction, out *kops.HTTPHookAction, s conversion.Scope) error {
+	return autoConvert_v1alpha1_HTTPHookAction_To_kops_HTTPHookAction(in, out, s)
+}
+
+func autoConvert_kops_HTTPHookAction_To_v1alpha1_HTTPHookAction(in *kops.HTTPHookAction, out *HTTPHookAction, s conversion.Scope) error {
+	out.URL = in.URL
+	out.Headers = in.Headers
+	return nil
+}
+
+// Convert_kops_HTTPHookAction_To_v1alpha1_HTTPHookAction is an autogenerated conversion function.
+func Convert_kops_HTTPHookAction_To_v1alpha1_HTTPHookAction(in *kops.HTTPHookAction, out *HTTPHookAction, s conversion.Scope) error {
+	return autoConvert_kops_HTTPHookAction_To_v1alpha1_HTTPHookAction(in, out, s)
+}
+
 func autoConvert_v1alpha1_HTTPProxy_To_kops_HTTPProxy(in *HTTPProxy, out *kops.HTTPProxy, s conversion.Scope) error {
 	out.Host = in.Host
 	out.Port = in.Port
@@ -1619,6 +1861,26 @@ func Convert_kops_IAMSpec_To_v1alpha1_IAMSpec(in *kops.IAMSpec, out *IAMSpec, s
 	return autoConvert_kops_IAMSpec_To_v1alpha1_IAMSpec(in, out, s)
 }
 
+func autoConvert_v1alpha1_ImageSignatureSpec_To_kops_ImageSignatureSpec(in *ImageSignatureSpec, out *kops.ImageSignatureSpec, s conversion.Scope) error {
+	out.PublicKey = in.PublicKey
+	return nil
+}
+
+// Convert_v1alpha1_ImageSignatureSpec_To_kops_ImageSignatureSpec is an autogenerated conversion function.
+func Convert_v1alpha1_ImageSignatureSpec_To_kops_ImageSignatureSpec(in *ImageSignatureSpec, out *kops.ImageSignatureSpec, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ImageSignatureSpec_To_kops_ImageSignatureSpec(in, out, s)
+}
+
+func autoConvert_kops_ImageSignatureSpec_To_v1alpha1_ImageSignatureSpec(in *kops.ImageSignatureSpec, out *ImageSignatureSpec, s conversion.Scope) error {
+	out.PublicKey = in.PublicKey
+	return nil
+}
+
+// Convert_kops_ImageSignatureSpec_To_v1alpha1_ImageSignatureSpec is an autogenerated conversion function.
+func Convert_kops_ImageSignatureSpec_To_v1alpha1_ImageSignatureSpec(in *kops.ImageSignatureSpec, out *ImageSignatureSpec, s conversion.Scope) error {
+	return autoConvert_kops_ImageSignatureSpec_To_v1alpha1_ImageSignatureSpec(in, out, s)
+}
+
 func autoConvert_v1alpha1_InstanceGroup_To_kops_InstanceGroup(in *InstanceGroup, out *kops.InstanceGroup, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
 	if err := Convert_v1alpha1_InstanceGroupSpec_To_kops_InstanceGroupSpec(&in.Spec, &out.Spec, s); err != nil {
@@ -1748,6 +2010,15 @@ func autoConvert_v1alpha1_InstanceGroupSpec_To_kops_InstanceGroupSpec(in *Instan
 	}
 	out.Zones = in.Zones
 	out.SuspendProcesses = in.SuspendProcesses
+	if in.RollingUpdate != nil {
+		in, out := &in.RollingUpdate, &out.RollingUpdate
+		*out = new(kops.RollingUpdate)
+		if err := Convert_v1alpha1_RollingUpdate_To_kops_RollingUpdate(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.RollingUpdate = nil
+	}
 	return nil
 }
 
@@ -1813,6 +2084,15 @@ func autoConvert_kops_InstanceGroupSpec_To_v1alpha1_InstanceGroupSpec(in *kops.I
 		out.AdditionalUserData = nil
 	}
 	out.SuspendProcesses = in.SuspendProcesses
+	if in.RollingUpdate != nil {
+		in, out := &in.RollingUpdate, &out.RollingUpdate
+		*out = new(RollingUpdate)
+		if err := Convert_kops_RollingUpdate_To_v1alpha1_RollingUpdate(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.RollingUpdate = nil
+	}
 	return nil
 }
 
@@ -2634,6 +2914,130 @@ func Convert_kops_RBACAuthorizationSpec_To_v1alpha1_RBACAuthorizationSpec(in *ko
 	return autoConvert_kops_RBACAuthorizationSpec_To_v1alpha1_RBACAuthorizationSpec(in, out, s)
 }
 
+func autoConvert_v1alpha1_RollingUpdate_To_kops_RollingUpdate(in *RollingUpdate, out *kops.RollingUpdate, s conversion.Scope) error {
+	out.MaxUnavailable = in.MaxUnavailable
+	out.MaxSurge = in.MaxSurge
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]kops.RollingUpdateHook, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha1_RollingUpdateHook_To_kops_RollingUpdateHook(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Hooks = nil
+	}
+	return nil
+}
+
+// Convert_v1alpha1_RollingUpdate_To_kops_RollingUpdate is an autogenerated conversion function.
+func Convert_v1alpha1_RollingUpdate_To_kops_RollingUpdate(in *RollingUpdate, out *kops.RollingUpdate, s conversion.Scope) error {
+	return autoConvert_v1alpha1_RollingUpdate_To_kops_RollingUpdate(in, out, s)
+}
+
+func autoConvert_kops_RollingUpdate_To_v1alpha1_RollingUpdate(in *kops.RollingUpdate, out *RollingUpdate, s conversion.Scope) error {
+	out.MaxUnavailable = in.MaxUnavailable
+	out.MaxSurge = in.MaxSurge
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]RollingUpdateHook, len(*in))
+		for i := range *in {
+			if err := Convert_kops_RollingUpdateHook_To_v1alpha1_RollingUpdateHook(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Hooks = nil
+	}
+	return nil
+}
+
+// Convert_kops_RollingUpdate_To_v1alpha1_RollingUpdate is an autogenerated conversion function.
+func Convert_kops_RollingUpdate_To_v1alpha1_RollingUpdate(in *kops.RollingUpdate, out *RollingUpdate, s conversion.Scope) error {
+	return autoConvert_kops_RollingUpdate_To_v1alpha1_RollingUpdate(in, out, s)
+}
+
+func autoConvert_v1alpha1_RollingUpdateHook_To_kops_RollingUpdateHook(in *RollingUpdateHook, out *kops.RollingUpdateHook, s conversion.Scope) error {
+	out.Name = in.Name
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]kops.RollingUpdateHookEvent, len(*in))
+		for i := range *in {
+			(*out)[i] = kops.RollingUpdateHookEvent((*in)[i])
+		}
+	} else {
+		out.Events = nil
+	}
+	if in.ExecContainer != nil {
+		in, out := &in.ExecContainer, &out.ExecContainer
+		*out = new(kops.ExecContainerAction)
+		if err := Convert_v1alpha1_ExecContainerAction_To_kops_ExecContainerAction(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.ExecContainer = nil
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(kops.HTTPHookAction)
+		if err := Convert_v1alpha1_HTTPHookAction_To_kops_HTTPHookAction(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.HTTP = nil
+	}
+	out.FailurePolicy = kops.RollingUpdateHookFailurePolicy(in.FailurePolicy)
+	out.MaxRetries = in.MaxRetries
+	out.Timeout = in.Timeout
+	return nil
+}
+
+// Convert_v1alpha1_RollingUpdateHook_To_kops_RollingUpdateHook is an autogenerated conversion function.
+func Convert_v1alpha1_RollingUpdateHook_To_kops_RollingUpdateHook(in *RollingUpdateHook, out *kops.RollingUpdateHook, s conversion.Scope) error {
+	return autoConvert_v1alpha1_RollingUpdateHook_To_kops_RollingUpdateHook(in, out, s)
+}
+
+func autoConvert_kops_RollingUpdateHook_To_v1alpha1_RollingUpdateHook(in *kops.RollingUpdateHook, out *RollingUpdateHook, s conversion.Scope) error {
+	out.Name = in.Name
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]RollingUpdateHookEvent, len(*in))
+		for i := range *in {
+			(*out)[i] = RollingUpdateHookEvent((*in)[i])
+		}
+	} else {
+		out.Events = nil
+	}
+	if in.ExecContainer != nil {
+		in, out := &in.ExecContainer, &out.ExecContainer
+		*out = new(ExecContainerAction)
+		if err := Convert_kops_ExecContainerAction_To_v1alpha1_ExecContainerAction(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.ExecContainer = nil
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPHookAction)
+		if err := Convert_kops_HTTPHookAction_To_v1alpha1_HTTPHookAction(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.HTTP = nil
+	}
+	out.FailurePolicy = RollingUpdateHookFailurePolicy(in.FailurePolicy)
+	out.MaxRetries = in.MaxRetries
+	out.Timeout = in.Timeout
+	return nil
+}
+
+// Convert_kops_RollingUpdateHook_To_v1alpha1_RollingUpdateHook is an autogenerated conversion function.
+func Convert_kops_RollingUpdateHook_To_v1alpha1_RollingUpdateHook(in *kops.RollingUpdateHook, out *RollingUpdateHook, s conversion.Scope) error {
+	return autoConvert_kops_RollingUpdateHook_To_v1alpha1_RollingUpdateHook(in, out, s)
+}
+
 func autoConvert_v1alpha1_RomanaNetworkingSpec_To_kops_RomanaNetworkingSpec(in *RomanaNetworkingSpec, out *kops.RomanaNetworkingSpec, s conversion.Scope) error {
 	out.DaemonServiceIP = in.DaemonServiceIP
 	out.EtcdServiceIP = in.EtcdServiceIP
@@ -2744,6 +3148,26 @@ func Convert_kops_SSHCredentialSpec_To_v1alpha1_SSHCredentialSpec(in *kops.SSHCr
 	return autoConvert_kops_SSHCredentialSpec_To_v1alpha1_SSHCredentialSpec(in, out, s)
 }
 
+func autoConvert_v1alpha1_SealedStateSpec_To_kops_SealedStateSpec(in *SealedStateSpec, out *kops.SealedStateSpec, s conversion.Scope) error {
+	out.Encrypt = in.Encrypt
+	return nil
+}
+
+// Convert_v1alpha1_SealedStateSpec_To_kops_SealedStateSpec is an autogenerated conversion function.
+func Convert_v1alpha1_SealedStateSpec_To_kops_SealedStateSpec(in *SealedStateSpec, out *kops.SealedStateSpec, s conversion.Scope) error {
+	return autoConvert_v1alpha1_SealedStateSpec_To_kops_SealedStateSpec(in, out, s)
+}
+
+func autoConvert_kops_SealedStateSpec_To_v1alpha1_SealedStateSpec(in *kops.SealedStateSpec, out *SealedStateSpec, s conversion.Scope) error {
+	out.Encrypt = in.Encrypt
+	return nil
+}
+
+// Convert_kops_SealedStateSpec_To_v1alpha1_SealedStateSpec is an autogenerated conversion function.
+func Convert_kops_SealedStateSpec_To_v1alpha1_SealedStateSpec(in *kops.SealedStateSpec, out *SealedStateSpec, s conversion.Scope) error {
+	return autoConvert_kops_SealedStateSpec_To_v1alpha1_SealedStateSpec(in, out, s)
+}
+
 func autoConvert_v1alpha1_TargetSpec_To_kops_TargetSpec(in *TargetSpec, out *kops.TargetSpec, s conversion.Scope) error {
 	if in.Terraform != nil {
 		in, out := &in.Terraform, &out.Terraform
@@ -18,7 +18,11 @@ package validation
 
 import (
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/apis/kops/util"
@@ -69,6 +73,13 @@ func ValidateInstanceGroup(g *kops.InstanceGroup) error {
 		}
 	}
 
+	if g.Spec.RollingUpdate != nil {
+		err := validateRollingUpdate(g.Spec.RollingUpdate, g.Spec.Role == kops.InstanceGroupRoleNode)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -114,6 +125,12 @@ func CrossValidateInstanceGroup(g *kops.InstanceGroup, cluster *kops.Cluster, st
 		}
 	}
 
+	if g.Spec.RollingUpdate != nil {
+		if err := ValidateRollingUpdateSurge(cluster, g.Spec.RollingUpdate.MaxSurge, field.NewPath("RollingUpdate").Child("MaxSurge")); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
 	if len(allErrs) != 0 {
 		return allErrs[0]
 	}
@@ -121,6 +138,24 @@ func CrossValidateInstanceGroup(g *kops.InstanceGroup, cluster *kops.Cluster, st
 	return nil
 }
 
+// ValidateRollingUpdateSurge rejects a maxSurge other than zero on clouds where instance groups cannot be surged during a rolling update
+func ValidateRollingUpdateSurge(cluster *kops.Cluster, maxSurge *intstr.IntOrString, fieldPath *field.Path) *field.Error {
+	if maxSurge == nil {
+		return nil
+	}
+	surge, _ := intstr.GetValueFromIntOrPercent(maxSurge, 100, true)
+	if surge == 0 {
+		return nil
+	}
+
+	switch kops.CloudProviderID(cluster.Spec.CloudProvider) {
+	case kops.CloudProviderAWS, kops.CloudProviderGCE:
+		return nil
+	default:
+		return field.Forbidden(fieldPath, fmt.Sprintf("MaxSurge is not supported on cloud provider %q; it is only supported on AWS and GCE", cluster.Spec.CloudProvider))
+	}
+}
+
 func validateExtraUserData(userData *kops.UserData) error {
 	fieldPath := field.NewPath("AdditionalUserData")
 
@@ -148,3 +183,116 @@ func validateExtraUserData(userData *kops.UserData) error {
 
 	return nil
 }
+
+func validateRollingUpdate(rollingUpdate *kops.RollingUpdate, allowSurge bool) error {
+	fieldPath := field.NewPath("RollingUpdate")
+
+	if rollingUpdate.MaxUnavailable != nil {
+		if err := validateIntOrPercent(rollingUpdate.MaxUnavailable, fieldPath.Child("MaxUnavailable")); err != nil {
+			return err
+		}
+	}
+
+	if rollingUpdate.MaxSurge != nil {
+		if err := validateIntOrPercent(rollingUpdate.MaxSurge, fieldPath.Child("MaxSurge")); err != nil {
+			return err
+		}
+
+		if !allowSurge {
+			surge, _ := intstr.GetValueFromIntOrPercent(rollingUpdate.MaxSurge, 100, true)
+			if surge != 0 {
+				return field.Forbidden(fieldPath.Child("MaxSurge"), "MaxSurge is only supported for Node instance groups")
+			}
+		}
+	}
+
+	for i := range rollingUpdate.Hooks {
+		errs := validateRollingUpdateHook(&rollingUpdate.Hooks[i], fieldPath.Child("Hooks").Index(i))
+		if len(errs) != 0 {
+			return errs[0]
+		}
+	}
+
+	return nil
+}
+
+func validateRollingUpdateHook(hook *kops.RollingUpdateHook, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if len(hook.Events) == 0 {
+		allErrs = append(allErrs, field.Required(fieldPath.Child("Events"), "at least one event must be specified"))
+	}
+	for i, event := range hook.Events {
+		switch event {
+		case kops.RollingUpdateHookBeforeDrain, kops.RollingUpdateHookAfterDrain, kops.RollingUpdateHookAfterTerminate, kops.RollingUpdateHookAfterValidate:
+			// OK
+		default:
+			allErrs = append(allErrs, field.NotSupported(fieldPath.Child("Events").Index(i), event, []string{
+				string(kops.RollingUpdateHookBeforeDrain),
+				string(kops.RollingUpdateHookAfterDrain),
+				string(kops.RollingUpdateHookAfterTerminate),
+				string(kops.RollingUpdateHookAfterValidate),
+			}))
+		}
+	}
+
+	if hook.ExecContainer == nil && hook.HTTP == nil {
+		allErrs = append(allErrs, field.Required(fieldPath, "you must set either execContainer or http for a rolling update hook"))
+	}
+	if hook.ExecContainer != nil && hook.HTTP != nil {
+		allErrs = append(allErrs, field.Forbidden(fieldPath, "you cannot set both execContainer and http for a rolling update hook"))
+	}
+	if hook.ExecContainer != nil {
+		allErrs = append(allErrs, validateExecContainerAction(hook.ExecContainer, fieldPath.Child("ExecContainer"))...)
+	}
+	if hook.HTTP != nil {
+		u, err := url.Parse(hook.HTTP.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(fieldPath.Child("HTTP", "URL"), hook.HTTP.URL, "must be an http or https URL"))
+		}
+	}
+
+	switch hook.FailurePolicy {
+	case "", kops.RollingUpdateHookFailurePolicyAbort, kops.RollingUpdateHookFailurePolicyContinue, kops.RollingUpdateHookFailurePolicyRetry:
+		// OK
+	default:
+		allErrs = append(allErrs, field.NotSupported(fieldPath.Child("FailurePolicy"), hook.FailurePolicy, []string{
+			string(kops.RollingUpdateHookFailurePolicyAbort),
+			string(kops.RollingUpdateHookFailurePolicyContinue),
+			string(kops.RollingUpdateHookFailurePolicyRetry),
+		}))
+	}
+
+	if hook.MaxRetries != nil && *hook.MaxRetries < 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("MaxRetries"), *hook.MaxRetries, "must be greater than or equal to 0"))
+	}
+	if hook.Timeout != nil && hook.Timeout.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("Timeout"), hook.Timeout.Duration.String(), "must be greater than 0"))
+	}
+
+	return allErrs
+}
+
+// validateIntOrPercent checks that the value is a non-negative integer or a percentage between 0% and 100%
+func validateIntOrPercent(v *intstr.IntOrString, fieldPath *field.Path) error {
+	switch v.Type {
+	case intstr.Int:
+		if v.IntVal < 0 {
+			return field.Invalid(fieldPath, v.IntVal, "must be greater than or equal to 0")
+		}
+
+	case intstr.String:
+		if !strings.HasSuffix(v.StrVal, "%") {
+			return field.Invalid(fieldPath, v.StrVal, "must be an integer or a percentage")
+		}
+		percent, err := strconv.Atoi(strings.TrimSuffix(v.StrVal, "%"))
+		if err != nil || percent < 0 || percent > 100 {
+			return field.Invalid(fieldPath, v.StrVal, "must be a percentage between 0% and 100%")
+		}
+
+	default:
+		return field.Invalid(fieldPath, v, "must be an integer or a percentage")
+	}
+
+	return nil
+}
@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/kops/pkg/apis/kops"
 )
 
@@ -64,3 +65,242 @@ func TestDefaultTaintsEnforcedBefore160(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateRollingUpdate(t *testing.T) {
+	grid := []struct {
+		Role           kops.InstanceGroupRole
+		MaxUnavailable *intstr.IntOrString
+		MaxSurge       *intstr.IntOrString
+		ExpectedErr    string
+	}{
+		{
+			Role: kops.InstanceGroupRoleNode,
+		},
+		{
+			Role:           kops.InstanceGroupRoleNode,
+			MaxUnavailable: intOrStringPtr(intstr.FromInt(2)),
+			MaxSurge:       intOrStringPtr(intstr.FromString("25%")),
+		},
+		{
+			Role:           kops.InstanceGroupRoleNode,
+			MaxUnavailable: intOrStringPtr(intstr.FromInt(-1)),
+			ExpectedErr:    "RollingUpdate.MaxUnavailable",
+		},
+		{
+			Role:        kops.InstanceGroupRoleNode,
+			MaxSurge:    intOrStringPtr(intstr.FromString("150%")),
+			ExpectedErr: "RollingUpdate.MaxSurge",
+		},
+		{
+			Role:        kops.InstanceGroupRoleNode,
+			MaxSurge:    intOrStringPtr(intstr.FromString("one")),
+			ExpectedErr: "RollingUpdate.MaxSurge",
+		},
+		{
+			Role:     kops.InstanceGroupRoleMaster,
+			MaxSurge: intOrStringPtr(intstr.FromInt(0)),
+		},
+		{
+			Role:        kops.InstanceGroupRoleMaster,
+			MaxSurge:    intOrStringPtr(intstr.FromInt(1)),
+			ExpectedErr: "MaxSurge is only supported for Node instance groups",
+		},
+		{
+			Role:        kops.InstanceGroupRoleBastion,
+			MaxSurge:    intOrStringPtr(intstr.FromString("10%")),
+			ExpectedErr: "MaxSurge is only supported for Node instance groups",
+		},
+	}
+
+	for _, g := range grid {
+		ig := &kops.InstanceGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: kops.InstanceGroupSpec{
+				Role:    g.Role,
+				Subnets: []string{"subnet-a"},
+				RollingUpdate: &kops.RollingUpdate{
+					MaxUnavailable: g.MaxUnavailable,
+					MaxSurge:       g.MaxSurge,
+				},
+			},
+		}
+
+		err := ValidateInstanceGroup(ig)
+		if g.ExpectedErr == "" {
+			if err != nil {
+				t.Errorf("unexpected error validating %v: %v", g, err)
+			}
+		} else {
+			if err == nil {
+				t.Errorf("expected error %q validating %v, got nil", g.ExpectedErr, g)
+			} else if !strings.Contains(err.Error(), g.ExpectedErr) {
+				t.Errorf("expected error %q validating %v, got %v", g.ExpectedErr, g, err)
+			}
+		}
+	}
+}
+
+func TestValidateRollingUpdateHooks(t *testing.T) {
+	grid := []struct {
+		Hook        kops.RollingUpdateHook
+		ExpectedErr string
+	}{
+		{
+			Hook: kops.RollingUpdateHook{
+				Events: []kops.RollingUpdateHookEvent{kops.RollingUpdateHookAfterDrain},
+				HTTP:   &kops.HTTPHookAction{URL: "https://lb.example.com/deregister"},
+			},
+		},
+		{
+			Hook: kops.RollingUpdateHook{
+				Events:        []kops.RollingUpdateHookEvent{kops.RollingUpdateHookBeforeDrain, kops.RollingUpdateHookAfterValidate},
+				ExecContainer: &kops.ExecContainerAction{Image: "busybox"},
+				FailurePolicy: kops.RollingUpdateHookFailurePolicyRetry,
+			},
+		},
+		{
+			Hook: kops.RollingUpdateHook{
+				HTTP: &kops.HTTPHookAction{URL: "https://lb.example.com/deregister"},
+			},
+			ExpectedErr: "RollingUpdate.Hooks[0].Events",
+		},
+		{
+			Hook: kops.RollingUpdateHook{
+				Events: []kops.RollingUpdateHookEvent{"BeforeLaunch"},
+				HTTP:   &kops.HTTPHookAction{URL: "https://lb.example.com/deregister"},
+			},
+			ExpectedErr: "RollingUpdate.Hooks[0].Events[0]",
+		},
+		{
+			Hook: kops.RollingUpdateHook{
+				Events: []kops.RollingUpdateHookEvent{kops.RollingUpdateHookAfterDrain},
+			},
+			ExpectedErr: "you must set either execContainer or http",
+		},
+		{
+			Hook: kops.RollingUpdateHook{
+				Events:        []kops.RollingUpdateHookEvent{kops.RollingUpdateHookAfterDrain},
+				ExecContainer: &kops.ExecContainerAction{Image: "busybox"},
+				HTTP:          &kops.HTTPHookAction{URL: "https://lb.example.com/deregister"},
+			},
+			ExpectedErr: "you cannot set both execContainer and http",
+		},
+		{
+			Hook: kops.RollingUpdateHook{
+				Events:        []kops.RollingUpdateHookEvent{kops.RollingUpdateHookAfterDrain},
+				ExecContainer: &kops.ExecContainerAction{},
+			},
+			ExpectedErr: "RollingUpdate.Hooks[0].ExecContainer.Image",
+		},
+		{
+			Hook: kops.RollingUpdateHook{
+				Events: []kops.RollingUpdateHookEvent{kops.RollingUpdateHookAfterDrain},
+				HTTP:   &kops.HTTPHookAction{URL: "lb.example.com/deregister"},
+			},
+			ExpectedErr: "RollingUpdate.Hooks[0].HTTP.URL",
+		},
+		{
+			Hook: kops.RollingUpdateHook{
+				Events:        []kops.RollingUpdateHookEvent{kops.RollingUpdateHookAfterDrain},
+				HTTP:          &kops.HTTPHookAction{URL: "https://lb.example.com/deregister"},
+				FailurePolicy: "Ignore",
+			},
+			ExpectedErr: "RollingUpdate.Hooks[0].FailurePolicy",
+		},
+		{
+			Hook: kops.RollingUpdateHook{
+				Events:  []kops.RollingUpdateHookEvent{kops.RollingUpdateHookAfterDrain},
+				HTTP:    &kops.HTTPHookAction{URL: "https://lb.example.com/deregister"},
+				Timeout: &metav1.Duration{},
+			},
+			ExpectedErr: "RollingUpdate.Hooks[0].Timeout",
+		},
+	}
+
+	for _, g := range grid {
+		ig := &kops.InstanceGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: kops.InstanceGroupSpec{
+				Role:    kops.InstanceGroupRoleNode,
+				Subnets: []string{"subnet-a"},
+				RollingUpdate: &kops.RollingUpdate{
+					Hooks: []kops.RollingUpdateHook{g.Hook},
+				},
+			},
+		}
+
+		err := ValidateInstanceGroup(ig)
+		if g.ExpectedErr == "" {
+			if err != nil {
+				t.Errorf("unexpected error validating %v: %v", g, err)
+			}
+		} else {
+			if err == nil {
+				t.Errorf("expected error %q validating %v, got nil", g.ExpectedErr, g)
+			} else if !strings.Contains(err.Error(), g.ExpectedErr) {
+				t.Errorf("expected error %q validating %v, got %v", g.ExpectedErr, g, err)
+			}
+		}
+	}
+}
+
+func intOrStringPtr(v intstr.IntOrString) *intstr.IntOrString {
+	return &v
+}
+
+func TestCrossValidateRollingUpdateSurge(t *testing.T) {
+	grid := []struct {
+		CloudProvider kops.CloudProviderID
+		MaxSurge      *intstr.IntOrString
+		ExpectedErr   string
+	}{
+		{
+			CloudProvider: kops.CloudProviderAWS,
+			MaxSurge:      intOrStringPtr(intstr.FromInt(2)),
+		},
+		{
+			CloudProvider: kops.CloudProviderGCE,
+			MaxSurge:      intOrStringPtr(intstr.FromString("25%")),
+		},
+		{
+			CloudProvider: kops.CloudProviderOpenstack,
+			MaxSurge:      intOrStringPtr(intstr.FromInt(0)),
+		},
+		{
+			CloudProvider: kops.CloudProviderOpenstack,
+			MaxSurge:      intOrStringPtr(intstr.FromInt(1)),
+			ExpectedErr:   "RollingUpdate.MaxSurge",
+		},
+		{
+			CloudProvider: kops.CloudProviderVSphere,
+			MaxSurge:      intOrStringPtr(intstr.FromString("10%")),
+			ExpectedErr:   "MaxSurge is not supported on cloud provider \"vsphere\"",
+		},
+	}
+
+	for _, g := range grid {
+		cluster := &kops.Cluster{Spec: kops.ClusterSpec{KubernetesVersion: "1.9.0", CloudProvider: string(g.CloudProvider)}}
+		ig := &kops.InstanceGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: kops.InstanceGroupSpec{
+				Role: kops.InstanceGroupRoleNode,
+				RollingUpdate: &kops.RollingUpdate{
+					MaxSurge: g.MaxSurge,
+				},
+			},
+		}
+
+		err := CrossValidateInstanceGroup(ig, cluster, false)
+		if g.ExpectedErr == "" {
+			if err != nil {
+				t.Errorf("unexpected error validating %v: %v", g, err)
+			}
+		} else {
+			if err == nil {
+				t.Errorf("expected error %q validating %v, got nil", g.ExpectedErr, g)
+			} else if !strings.Contains(err.Error(), g.ExpectedErr) {
+				t.Errorf("expected error %q validating %v, got %v", g.ExpectedErr, g, err)
+			}
+		}
+	}
+}
@@ -26,10 +26,17 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/envelope"
+	"k8s.io/kops/pkg/pki"
 )
 
 var validDockerConfigStorageValues = []string{"aufs", "btrfs", "devicemapper", "overlay", "overlay2", "zfs"}
 
+// ValidationChecks returns the names of the checks that can be enabled in spec.validation.checks.
+// The checks are registered by pkg/validation, which depends on this package, so it sets this function;
+// the names are not validated if it is not set.
+var ValidationChecks func() []string
+
 func ValidateDockerConfig(config *kops.DockerConfig, fldPath *field.Path) field.ErrorList {
 	allErrs := field.ErrorList{}
 	allErrs = append(allErrs, IsValidValue(fldPath.Child("storage"), config.Storage, validDockerConfigStorageValues)...)
@@ -94,6 +101,79 @@ func validateClusterSpec(spec *kops.ClusterSpec, fieldPath *field.Path) field.Er
 		allErrs = append(allErrs, validateNetworking(spec.Networking, fieldPath.Child("networking"))...)
 	}
 
+	if spec.Certificates != nil {
+		allErrs = append(allErrs, validateCertificates(spec.Certificates, fieldPath.Child("certificates"))...)
+	}
+
+	if spec.Validation != nil {
+		allErrs = append(allErrs, validateValidationChecks(spec.Validation.Checks, fieldPath.Child("validation", "checks"))...)
+	}
+
+	allErrs = append(allErrs, validateStoreLocation(spec.KeyStore, fieldPath.Child("keyStore"))...)
+	allErrs = append(allErrs, validateStoreLocation(spec.SecretStore, fieldPath.Child("secretStore"))...)
+
+	if spec.Assets != nil && spec.Assets.ImageSignature != nil {
+		allErrs = append(allErrs, validateImageSignature(spec.Assets.ImageSignature, fieldPath.Child("assets", "imageSignature"))...)
+	}
+
+	return allErrs
+}
+
+// validateCertificates checks the renewal window is within the validity of the certificates kops issues
+func validateCertificates(spec *kops.CertificatesSpec, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if spec.RenewalWindow != nil {
+		renewalWindow := spec.RenewalWindow.Duration
+		if renewalWindow <= 0 {
+			allErrs = append(allErrs, field.Invalid(fieldPath.Child("renewalWindow"), renewalWindow.String(), "must be greater than zero"))
+		} else if renewalWindow >= pki.CertificateValidity {
+			// Every certificate would be within the window as soon as it is issued, and be reissued on every update
+			allErrs = append(allErrs, field.Invalid(fieldPath.Child("renewalWindow"), renewalWindow.String(), fmt.Sprintf("must be less than the validity of the certificates kops issues (%s)", pki.CertificateValidity)))
+		}
+	}
+	return allErrs
+}
+
+// validateValidationChecks checks that the validation checks enabled in the spec are registered
+func validateValidationChecks(checks []string, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if ValidationChecks == nil {
+		return allErrs
+	}
+	validChecks := ValidationChecks()
+	for i := range checks {
+		allErrs = append(allErrs, IsValidValue(fieldPath.Index(i), &checks[i], validChecks)...)
+	}
+	return allErrs
+}
+
+// validateImageSignature checks the public key that container images are verified with
+func validateImageSignature(spec *kops.ImageSignatureSpec, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if spec.PublicKey == "" {
+		allErrs = append(allErrs, field.Required(fieldPath.Child("publicKey"), "a public key is required to verify image signatures"))
+	} else if _, err := pki.ParsePEMPublicKey([]byte(spec.PublicKey)); err != nil {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("publicKey"), "<public key>", err.Error()))
+	}
+	return allErrs
+}
+
+// validateStoreLocation checks the location of the keystore or secret store, including the key encryption key of an encrypted store
+func validateStoreLocation(location string, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if location != "" {
+		_, kekURL, err := envelope.ParseStoreLocation(location)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fieldPath, location, err.Error()))
+		} else if strings.HasPrefix(kekURL, "vault://") || strings.HasPrefix(kekURL, "vault+http://") {
+			// nodeup decrypts the store when the instance boots, before anything could provide it with a Vault token
+			allErrs = append(allErrs, field.Invalid(fieldPath, location, "a vault key encryption key cannot be used, because nodeup reads the store and the instances have no Vault token"))
+		}
+	}
 	return allErrs
 }
 
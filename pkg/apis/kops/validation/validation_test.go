@@ -17,12 +17,20 @@ limitations under the License.
 package validation
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"testing"
+	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/pki"
 )
 
 func Test_Validate_DNS(t *testing.T) {
@@ -241,3 +249,123 @@ func Test_Validate_Networking_Flannel(t *testing.T) {
 		testErrors(t, g.Input, errs, g.ExpectedErrors)
 	}
 }
+
+func Test_Validate_StoreLocation(t *testing.T) {
+	grid := []struct {
+		Input          string
+		ExpectedErrors []string
+	}{
+		{
+			Input: "",
+		},
+		{
+			Input: "s3://bucket/cluster/pki",
+		},
+		{
+			Input: "encrypted+s3://bucket/cluster/pki?kek=awskms://alias/kops?region=us-east-1",
+		},
+		{
+			Input: "encrypted+s3://bucket/cluster/secrets?kek=gcpkms://projects/p/locations/global/keyRings/r/cryptoKeys/kops",
+		},
+		{
+			Input:          "encrypted+s3://bucket/cluster/secrets?kek=vault://vault.example.com:8200/transit/kops",
+			ExpectedErrors: []string{"Invalid value::spec.keyStore"},
+		},
+		{
+			Input:          "encrypted+s3://bucket/cluster/pki",
+			ExpectedErrors: []string{"Invalid value::spec.keyStore"},
+		},
+		{
+			Input:          "encrypted+s3://bucket/cluster/pki?kek=unknown://key",
+			ExpectedErrors: []string{"Invalid value::spec.keyStore"},
+		},
+	}
+	for _, g := range grid {
+		errs := validateStoreLocation(g.Input, field.NewPath("spec", "keyStore"))
+		testErrors(t, g.Input, errs, g.ExpectedErrors)
+	}
+}
+
+func Test_Validate_ImageSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("error serializing public key: %v", err)
+	}
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	grid := []struct {
+		Input          kops.ImageSignatureSpec
+		ExpectedErrors []string
+	}{
+		{
+			Input: kops.ImageSignatureSpec{PublicKey: publicKey},
+		},
+		{
+			Input:          kops.ImageSignatureSpec{},
+			ExpectedErrors: []string{"Required value::spec.assets.imageSignature.publicKey"},
+		},
+		{
+			Input:          kops.ImageSignatureSpec{PublicKey: "not a key"},
+			ExpectedErrors: []string{"Invalid value::spec.assets.imageSignature.publicKey"},
+		},
+	}
+	for _, g := range grid {
+		errs := validateImageSignature(&g.Input, field.NewPath("spec", "assets", "imageSignature"))
+		testErrors(t, g.Input, errs, g.ExpectedErrors)
+	}
+}
+
+func Test_Validate_ValidationChecks(t *testing.T) {
+	defer func(f func() []string) { ValidationChecks = f }(ValidationChecks)
+	ValidationChecks = func() []string { return []string{"etcd", "nodes"} }
+
+	grid := []struct {
+		Input          []string
+		ExpectedErrors []string
+	}{
+		{
+			Input: []string{"etcd"},
+		},
+		{
+			Input: []string{"nodes", "etcd"},
+		},
+		{
+			Input:          []string{"etcd", "etc"},
+			ExpectedErrors: []string{"Unsupported value::spec.validation.checks[1]"},
+		},
+	}
+	for _, g := range grid {
+		errs := validateValidationChecks(g.Input, field.NewPath("spec", "validation", "checks"))
+		testErrors(t, g.Input, errs, g.ExpectedErrors)
+	}
+}
+
+func Test_Validate_Certificates(t *testing.T) {
+	grid := []struct {
+		Input          kops.CertificatesSpec
+		ExpectedErrors []string
+	}{
+		{
+			Input: kops.CertificatesSpec{},
+		},
+		{
+			Input: kops.CertificatesSpec{RenewalWindow: &metav1.Duration{Duration: 30 * 24 * time.Hour}},
+		},
+		{
+			Input:          kops.CertificatesSpec{RenewalWindow: &metav1.Duration{}},
+			ExpectedErrors: []string{"Invalid value::spec.certificates.renewalWindow"},
+		},
+		{
+			Input:          kops.CertificatesSpec{RenewalWindow: &metav1.Duration{Duration: pki.CertificateValidity}},
+			ExpectedErrors: []string{"Invalid value::spec.certificates.renewalWindow"},
+		},
+	}
+	for _, g := range grid {
+		errs := validateCertificates(&g.Input, field.NewPath("spec", "certificates"))
+		testErrors(t, g.Input, errs, g.ExpectedErrors)
+	}
+}
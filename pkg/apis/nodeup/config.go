@@ -37,6 +37,10 @@ type Config struct {
 	ProtokubeImage *Image `json:"protokubeImage,omitempty"`
 	// Channels is a list of channels that we should apply
 	Channels []string `json:"channels,omitempty"`
+	// SealedStateSecretStore is the location of the secret store holding the secret that the files nodeup reads
+	// from the state store are sealed with.  If set, nodeup reads the secret and refuses files whose integrity cannot
+	// be verified with it.  The secret is not part of this configuration, which is rendered into the user-data.
+	SealedStateSecretStore string `json:"sealedStateSecretStore,omitempty"`
 }
 
 // Image is a docker image we should pre-load
@@ -26,6 +26,7 @@ import (
 
 	"github.com/blang/semver"
 	"github.com/golang/glog"
+	"github.com/opencontainers/go-digest"
 
 	"k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/apis/kops/util"
@@ -50,6 +51,15 @@ type AssetBuilder struct {
 
 	// KubernetesVersion is the version of kubernetes we are installing
 	KubernetesVersion semver.Version
+
+	// ResolveImageDigests pins images to digests and verifies their signatures, if AssetsLocation asks for it.
+	// It is only set when the cluster is updated, so that other commands do not need access to the registries.
+	ResolveImageDigests bool
+
+	// imageDigests caches the digests images were pinned to
+	imageDigests map[string]digest.Digest
+	// registry is the client used to resolve digests
+	registry *registryClient
 }
 
 // ContainerAsset models a container's location.
@@ -59,6 +69,10 @@ type ContainerAsset struct {
 	DockerImage string
 	// CanonicalLocation will be the source location of the container.
 	CanonicalLocation string
+	// Component is the component or addon that runs the container.
+	Component string
+	// Digest is the digest of the manifest of DockerImage, if the image is pinned to a digest.
+	Digest string
 }
 
 // FileAsset models a file's location.
@@ -69,6 +83,8 @@ type FileAsset struct {
 	CanonicalFileURL *url.URL
 	// SHAValue is the SHA hash of the FileAsset.
 	SHAValue string
+	// Component is the component that uses the file.
+	Component string
 }
 
 // NewAssetBuilder creates a new AssetBuilder.
@@ -92,7 +108,8 @@ func NewAssetBuilder(cluster *kops.Cluster, phase string) *AssetBuilder {
 // Whenever we are building a Task that includes a manifest, we should pass it through RemapManifest first.
 // This will:
 // * rewrite the images if they are being redirected to a mirror, and ensure the image is uploaded
-func (a *AssetBuilder) RemapManifest(data []byte) ([]byte, error) {
+// The images are recorded as used by the addon.
+func (a *AssetBuilder) RemapManifest(addon string, data []byte) ([]byte, error) {
 	if !RewriteManifests.Enabled() {
 		return data, nil
 	}
@@ -105,7 +122,10 @@ func (a *AssetBuilder) RemapManifest(data []byte) ([]byte, error) {
 	var yamlSeparator = []byte("\n---\n\n")
 	var remappedManifests [][]byte
 	for _, manifest := range manifests {
-		if err := manifest.RemapImages(a.RemapImage); err != nil {
+		remap := func(image string) (string, error) {
+			return a.RemapImage(addon, image)
+		}
+		if err := manifest.RemapImages(remap); err != nil {
 			return nil, fmt.Errorf("error remapping images: %v", err)
 		}
 
@@ -121,8 +141,11 @@ func (a *AssetBuilder) RemapManifest(data []byte) ([]byte, error) {
 }
 
 // RemapImage normalizes a containers location if a user sets the AssetsLocation ContainerRegistry location.
-func (a *AssetBuilder) RemapImage(image string) (string, error) {
-	asset := &ContainerAsset{}
+// The image is recorded as used by the component.
+func (a *AssetBuilder) RemapImage(component string, image string) (string, error) {
+	asset := &ContainerAsset{
+		Component: component,
+	}
 
 	asset.DockerImage = image
 
@@ -147,36 +170,49 @@ func (a *AssetBuilder) RemapImage(image string) (string, error) {
 	}
 
 	if a.AssetsLocation != nil && a.AssetsLocation.ContainerRegistry != nil {
-		registryMirror := *a.AssetsLocation.ContainerRegistry
-		normalized := image
-
-		// Remove the 'standard' kubernetes image prefix, just for sanity
-		normalized = strings.TrimPrefix(normalized, "k8s.gcr.io/")
-
-		// We can't nest arbitrarily
-		// Some risk of collisions, but also -- and __ in the names appear to be blocked by docker hub
-		normalized = strings.Replace(normalized, "/", "-", -1)
-		asset.DockerImage = registryMirror + "/" + normalized
-
+		asset.DockerImage = remapImageToRegistry(*a.AssetsLocation.ContainerRegistry, image)
 		asset.CanonicalLocation = image
 
 		// Run the new image
 		image = asset.DockerImage
 	}
 
+	if a.ResolveImageDigests && a.pinImageDigests() {
+		pinned, d, err := a.pinImage(image)
+		if err != nil {
+			return "", err
+		}
+		asset.Digest = d.String()
+		image = pinned
+	}
+
 	a.ContainerAssets = append(a.ContainerAssets, asset)
 	return image, nil
 }
 
+// remapImageToRegistry returns the name of the image in the registry mirror
+func remapImageToRegistry(registryMirror string, image string) string {
+	normalized := image
+
+	// Remove the 'standard' kubernetes image prefix, just for sanity
+	normalized = strings.TrimPrefix(normalized, "k8s.gcr.io/")
+
+	// We can't nest arbitrarily
+	// Some risk of collisions, but also -- and __ in the names appear to be blocked by docker hub
+	normalized = strings.Replace(normalized, "/", "-", -1)
+	return registryMirror + "/" + normalized
+}
+
 // RemapFileAndSHA returns a remapped url for the file, if AssetsLocation is defined.
-// It also returns the SHA hash of the file.
-func (a *AssetBuilder) RemapFileAndSHA(fileURL *url.URL) (*url.URL, *hashing.Hash, error) {
+// It also returns the SHA hash of the file.  The file is recorded as used by the component.
+func (a *AssetBuilder) RemapFileAndSHA(component string, fileURL *url.URL) (*url.URL, *hashing.Hash, error) {
 	if fileURL == nil {
 		return nil, nil, fmt.Errorf("unable to remap an nil URL")
 	}
 
 	fileAsset := &FileAsset{
-		FileURL: fileURL,
+		FileURL:   fileURL,
+		Component: component,
 	}
 
 	if a.AssetsLocation != nil && a.AssetsLocation.FileRepository != nil {
@@ -207,14 +243,15 @@ func (a *AssetBuilder) RemapFileAndSHA(fileURL *url.URL) (*url.URL, *hashing.Has
 // TODO - remove this method as CNI does now have a SHA file
 
 // RemapFileAndSHAValue is used exclusively to remap the cni tarball, as the tarball does not have a sha file in object storage.
-func (a *AssetBuilder) RemapFileAndSHAValue(fileURL *url.URL, shaValue string) (*url.URL, error) {
+func (a *AssetBuilder) RemapFileAndSHAValue(component string, fileURL *url.URL, shaValue string) (*url.URL, error) {
 	if fileURL == nil {
 		return nil, fmt.Errorf("unable to remap a nil URL")
 	}
 
 	fileAsset := &FileAsset{
-		FileURL:  fileURL,
-		SHAValue: shaValue,
+		FileURL:   fileURL,
+		SHAValue:  shaValue,
+		Component: component,
 	}
 
 	if a.AssetsLocation != nil && a.AssetsLocation.FileRepository != nil {
@@ -0,0 +1,567 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/kops/util/pkg/hashing"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+const (
+	// mediaTypeBundleFileConfig is the media type of the config of the manifests wrapping the files in an asset bundle
+	mediaTypeBundleFileConfig = "application/vnd.kops.asset.file.config.v1+json"
+
+	// AnnotationFileURL is the annotation recording the URL a file in an asset bundle was downloaded from
+	AnnotationFileURL = "io.k8s.kops.asset.file.url"
+	// AnnotationFileHash is the annotation recording the hash kops verifies a file in an asset bundle against, usually its SHA1
+	AnnotationFileHash = "io.k8s.kops.asset.file.hash"
+)
+
+// BundleAsset is an image or file in an asset bundle
+type BundleAsset struct {
+	// Source is the image or URL the asset was exported from
+	Source string
+	// Target is the image or location the asset was imported to
+	Target string
+	// Digest is the sha256 digest of the manifest of the image, or of the file
+	Digest string
+}
+
+// BundleContents lists the assets exported to or imported from an asset bundle
+type BundleContents struct {
+	Images []*BundleAsset
+	Files  []*BundleAsset
+}
+
+// ExportBundle downloads the images and files recorded by the AssetBuilder, and writes them to w as a tar archive of an OCI image layout.
+// Images are exported as their linux/amd64 manifest, and each file is wrapped in a manifest with a single layer.
+// The digest of every blob, and the hash of every file, is verified as it is downloaded.
+func ExportBundle(w io.Writer, a *AssetBuilder) (*BundleContents, error) {
+	bw := &bundleWriter{
+		tw:      tar.NewWriter(w),
+		written: make(map[digest.Digest]bool),
+	}
+	registry := newRegistryClient(false)
+	contents := &BundleContents{}
+
+	layout, err := json.Marshal(&ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return nil, fmt.Errorf("error serializing image layout: %v", err)
+	}
+	if err := bw.writeFile(ocispec.ImageLayoutFile, layout); err != nil {
+		return nil, err
+	}
+
+	index := &ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+	}
+
+	for _, image := range a.sourceImages() {
+		desc, err := bw.writeImage(registry, image)
+		if err != nil {
+			return nil, err
+		}
+		index.Manifests = append(index.Manifests, *desc)
+		contents.Images = append(contents.Images, &BundleAsset{Source: image, Digest: desc.Digest.String()})
+	}
+
+	files := a.sourceFiles()
+	var fileURLs []string
+	for u := range files {
+		fileURLs = append(fileURLs, u)
+	}
+	sort.Strings(fileURLs)
+	for _, u := range fileURLs {
+		desc, fileDigest, err := bw.writeAssetFile(u, files[u])
+		if err != nil {
+			return nil, err
+		}
+		index.Manifests = append(index.Manifests, *desc)
+		contents.Files = append(contents.Files, &BundleAsset{Source: u, Digest: fileDigest.String()})
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing index: %v", err)
+	}
+	if err := bw.writeFile("index.json", data); err != nil {
+		return nil, err
+	}
+	if err := bw.tw.Close(); err != nil {
+		return nil, fmt.Errorf("error writing bundle: %v", err)
+	}
+	return contents, nil
+}
+
+// sourceImages returns the images the assets are copied from, sorted and without duplicates
+func (a *AssetBuilder) sourceImages() []string {
+	seen := make(map[string]bool)
+	var images []string
+	for _, asset := range a.ContainerAssets {
+		image := asset.CanonicalLocation
+		if image == "" {
+			image = asset.DockerImage
+		}
+		if !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+// sourceFiles returns the URLs the files are copied from, mapped to their hash
+func (a *AssetBuilder) sourceFiles() map[string]string {
+	files := make(map[string]string)
+	for _, asset := range a.FileAssets {
+		u := asset.CanonicalFileURL
+		if u == nil {
+			u = asset.FileURL
+		}
+		files[u.String()] = asset.SHAValue
+	}
+	return files
+}
+
+// bundleWriter writes the blobs of an OCI image layout to a tar archive, writing each blob once
+type bundleWriter struct {
+	tw      *tar.Writer
+	written map[digest.Digest]bool
+}
+
+// writeFile writes a file to the archive
+func (b *bundleWriter) writeFile(name string, data []byte) error {
+	return b.writeStream(name, int64(len(data)), bytes.NewReader(data))
+}
+
+// writeStream writes size bytes read from r to the archive
+func (b *bundleWriter) writeStream(name string, size int64, r io.Reader) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	}
+	if err := b.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing %s to bundle: %v", name, err)
+	}
+	n, err := io.Copy(b.tw, io.LimitReader(r, size))
+	if err != nil {
+		return fmt.Errorf("error writing %s to bundle: %v", name, err)
+	}
+	if n != size {
+		return fmt.Errorf("error writing %s to bundle: read %d of %d bytes", name, n, size)
+	}
+	return nil
+}
+
+// blobName returns the name of the blob in the image layout
+func blobName(d digest.Digest) string {
+	return path.Join("blobs", string(d.Algorithm()), d.Hex())
+}
+
+// writeBlob writes the blob read from r, which must match the digest
+func (b *bundleWriter) writeBlob(d digest.Digest, size int64, r io.Reader) error {
+	if b.written[d] {
+		return nil
+	}
+	if d.Algorithm() != digest.SHA256 {
+		return fmt.Errorf("unsupported digest %q", d)
+	}
+
+	hasher := sha256.New()
+	if err := b.writeStream(blobName(d), size, io.TeeReader(r, hasher)); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != d.Hex() {
+		return fmt.Errorf("downloaded blob had digest sha256:%s, expected %s", actual, d)
+	}
+
+	b.written[d] = true
+	return nil
+}
+
+// writeBlobBytes writes the data as a blob, returning its descriptor
+func (b *bundleWriter) writeBlobBytes(mediaType string, data []byte) (*ocispec.Descriptor, error) {
+	desc := &ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	if err := b.writeBlob(desc.Digest, desc.Size, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return desc, nil
+}
+
+// writeImage downloads the image, and writes its manifest, config and layers to the archive
+func (b *bundleWriter) writeImage(registry *registryClient, image string) (*ocispec.Descriptor, error) {
+	l, err := parseImageLocation(image)
+	if err != nil {
+		return nil, err
+	}
+
+	glog.Infof("exporting image %q", image)
+	data, mediaType, err := registry.getManifest(l)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading manifest of %q: %v", image, err)
+	}
+	manifest := &ocispec.Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("error parsing manifest of %q: %v", image, err)
+	}
+
+	for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+		if b.written[blob.Digest] {
+			continue
+		}
+		r, err := registry.getBlob(l, blob.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("error downloading %s of %q: %v", blob.Digest, image, err)
+		}
+		err = b.writeBlob(blob.Digest, blob.Size, r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error exporting %s of %q: %v", blob.Digest, image, err)
+		}
+	}
+
+	desc, err := b.writeBlobBytes(mediaType, data)
+	if err != nil {
+		return nil, err
+	}
+	desc.Annotations = map[string]string{ocispec.AnnotationRefName: image}
+	return desc, nil
+}
+
+// writeAssetFile downloads the file, verifies its hash, and writes it to the archive wrapped in a manifest.
+// It returns the descriptor of the manifest, and the digest of the file.
+func (b *bundleWriter) writeAssetFile(fileURL string, hash string) (*ocispec.Descriptor, digest.Digest, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("error parsing %q: %v", fileURL, err)
+	}
+
+	glog.Infof("exporting file %q", fileURL)
+	data, err := vfs.Context.ReadFile(fileURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("error downloading %q: %v", fileURL, err)
+	}
+	if err := verifyFileHash(fileURL, data, hash); err != nil {
+		return nil, "", err
+	}
+
+	file, err := b.writeBlobBytes("application/octet-stream", data)
+	if err != nil {
+		return nil, "", err
+	}
+	file.Annotations = map[string]string{ocispec.AnnotationTitle: path.Base(u.Path)}
+
+	config, err := b.writeBlobBytes(mediaTypeBundleFileConfig, []byte("{}"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	manifest := &ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    *config,
+		Layers:    []ocispec.Descriptor{*file},
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, "", fmt.Errorf("error serializing manifest: %v", err)
+	}
+	desc, err := b.writeBlobBytes(ocispec.MediaTypeImageManifest, manifestData)
+	if err != nil {
+		return nil, "", err
+	}
+	desc.Annotations = map[string]string{
+		AnnotationFileURL:  fileURL,
+		AnnotationFileHash: hash,
+	}
+	return desc, file.Digest, nil
+}
+
+// verifyFileHash checks the file matches the hash, in any algorithm kops supports
+func verifyFileHash(name string, data []byte, hash string) error {
+	expected, err := hashing.FromString(strings.TrimSpace(hash))
+	if err != nil {
+		return fmt.Errorf("error parsing hash of %q: %v", name, err)
+	}
+	actual, err := expected.Algorithm.Hash(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error hashing %q: %v", name, err)
+	}
+	if !actual.Equal(expected) {
+		return fmt.Errorf("hash of %q was %s, expected %s", name, actual.Hex(), expected.Hex())
+	}
+	return nil
+}
+
+// ImportBundleOptions specifies where the assets in a bundle are imported to
+type ImportBundleOptions struct {
+	// ContainerRegistry is the registry the images are pushed to, as set in spec.assets.containerRegistry
+	ContainerRegistry string
+	// InsecureRegistry is true if the registry is accessed over plain HTTP
+	InsecureRegistry bool
+
+	// FileRepository is where the files are written, which is served as spec.assets.fileRepository
+	FileRepository vfs.Path
+}
+
+// ImportBundle reads an asset bundle written by ExportBundle, verifying the digest of every blob.  It pushes the images to the
+// container registry, and writes the files and their hashes to the file repository, under the names that a cluster with
+// spec.assets pointing to them looks for.
+func ImportBundle(r io.Reader, options *ImportBundleOptions) (*BundleContents, error) {
+	if options.ContainerRegistry == "" {
+		return nil, fmt.Errorf("ContainerRegistry is required")
+	}
+	if options.FileRepository == nil {
+		return nil, fmt.Errorf("FileRepository is required")
+	}
+
+	dir, err := ioutil.TempDir("", "kops-assets")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	index, err := extractBundle(r, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := newRegistryClient(options.InsecureRegistry)
+	contents := &BundleContents{}
+	for i := range index.Manifests {
+		desc := &index.Manifests[i]
+		data, err := readExtractedBlob(dir, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		manifest := &ocispec.Manifest{}
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return nil, fmt.Errorf("error parsing manifest %s: %v", desc.Digest, err)
+		}
+
+		if manifest.Config.MediaType == mediaTypeBundleFileConfig {
+			asset, err := importFile(dir, desc, manifest, options.FileRepository)
+			if err != nil {
+				return nil, err
+			}
+			contents.Files = append(contents.Files, asset)
+		} else {
+			asset, err := importImage(dir, registry, desc, manifest, data, options.ContainerRegistry)
+			if err != nil {
+				return nil, err
+			}
+			contents.Images = append(contents.Images, asset)
+		}
+	}
+	return contents, nil
+}
+
+// extractBundle extracts the blobs of the bundle to dir, verifying their digests, and returns the index of the bundle
+func extractBundle(r io.Reader, dir string) (*ocispec.Index, error) {
+	var index *ocispec.Index
+	foundLayout := false
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading bundle: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		name := strings.TrimPrefix(header.Name, "./")
+		switch {
+		case name == ocispec.ImageLayoutFile:
+			layout := &ocispec.ImageLayout{}
+			if err := json.NewDecoder(tr).Decode(layout); err != nil {
+				return nil, fmt.Errorf("error parsing %s: %v", name, err)
+			}
+			if layout.Version != ocispec.ImageLayoutVersion {
+				return nil, fmt.Errorf("unsupported image layout version %q", layout.Version)
+			}
+			foundLayout = true
+
+		case name == "index.json":
+			index = &ocispec.Index{}
+			if err := json.NewDecoder(tr).Decode(index); err != nil {
+				return nil, fmt.Errorf("error parsing %s: %v", name, err)
+			}
+
+		case strings.HasPrefix(name, "blobs/sha256/"):
+			if err := extractBlob(tr, dir, strings.TrimPrefix(name, "blobs/sha256/")); err != nil {
+				return nil, err
+			}
+
+		default:
+			glog.Warningf("ignoring unexpected file %q in bundle", header.Name)
+		}
+	}
+
+	if !foundLayout {
+		return nil, fmt.Errorf("bundle is not an OCI image layout: %s not found", ocispec.ImageLayoutFile)
+	}
+	if index == nil {
+		return nil, fmt.Errorf("bundle is not an OCI image layout: index.json not found")
+	}
+	return index, nil
+}
+
+// extractBlob writes the blob to dir, and checks its sha256 digest matches its name
+func extractBlob(r io.Reader, dir string, name string) error {
+	d := digest.NewDigestFromHex(string(digest.SHA256), name)
+	if err := d.Validate(); err != nil {
+		return fmt.Errorf("invalid blob name %q in bundle: %v", name, err)
+	}
+
+	p := filepath.Join(dir, d.Hex())
+	f, err := os.Create(p)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", p, err)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hasher), r); err != nil {
+		return fmt.Errorf("error extracting %s: %v", d, err)
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != d.Hex() {
+		return fmt.Errorf("blob %s in bundle has digest sha256:%s", d, actual)
+	}
+	return f.Close()
+}
+
+// readExtractedBlob reads a blob extracted by extractBundle
+func readExtractedBlob(dir string, d digest.Digest) ([]byte, error) {
+	if d.Algorithm() != digest.SHA256 {
+		return nil, fmt.Errorf("unsupported digest %q", d)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, d.Hex()))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("blob %s not found in bundle", d)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// importImage pushes the blobs and manifest of an image to the registry
+func importImage(dir string, registry *registryClient, desc *ocispec.Descriptor, manifest *ocispec.Manifest, data []byte, containerRegistry string) (*BundleAsset, error) {
+	source := desc.Annotations[ocispec.AnnotationRefName]
+	if source == "" {
+		return nil, fmt.Errorf("manifest %s in bundle does not have a %s annotation", desc.Digest, ocispec.AnnotationRefName)
+	}
+	target := remapImageToRegistry(containerRegistry, source)
+	l, err := parseImageLocation(target)
+	if err != nil {
+		return nil, err
+	}
+
+	glog.Infof("pushing image %q to %q", source, target)
+	for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+		found, err := registry.hasBlob(l, blob.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("error checking for %s in %q: %v", blob.Digest, target, err)
+		}
+		if found {
+			continue
+		}
+
+		p := filepath.Join(dir, blob.Digest.Hex())
+		open := func() (io.ReadCloser, error) {
+			return os.Open(p)
+		}
+		if err := registry.putBlob(l, blob.Digest, blob.Size, open); err != nil {
+			return nil, fmt.Errorf("error pushing %s of %q: %v", blob.Digest, target, err)
+		}
+	}
+
+	if err := registry.putManifest(l, desc.MediaType, data); err != nil {
+		return nil, fmt.Errorf("error pushing manifest of %q: %v", target, err)
+	}
+
+	return &BundleAsset{Source: source, Target: target, Digest: desc.Digest.String()}, nil
+}
+
+// importFile writes a file, and its hash, to the file repository, at the path of the URL it was exported from
+func importFile(dir string, desc *ocispec.Descriptor, manifest *ocispec.Manifest, fileRepository vfs.Path) (*BundleAsset, error) {
+	source := desc.Annotations[AnnotationFileURL]
+	hash := desc.Annotations[AnnotationFileHash]
+	if source == "" || hash == "" || len(manifest.Layers) != 1 {
+		return nil, fmt.Errorf("manifest %s in bundle is not a valid file", desc.Digest)
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %q: %v", source, err)
+	}
+
+	file := manifest.Layers[0]
+	data, err := readExtractedBlob(dir, file.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyFileHash(source, data, hash); err != nil {
+		return nil, err
+	}
+
+	target := fileRepository.Join(strings.TrimPrefix(u.Path, "/"))
+	glog.Infof("writing file %q to %q", source, target)
+	if err := target.WriteFile(bytes.NewReader(data), nil); err != nil {
+		return nil, fmt.Errorf("error writing %s: %v", target, err)
+	}
+	h, err := hashing.FromString(strings.TrimSpace(hash))
+	if err != nil {
+		return nil, err
+	}
+	// The hash file is named for its algorithm, as nodeup assumes a .sha1 file holds a SHA-1 hash
+	hashPath := fileRepository.Join(strings.TrimPrefix(u.Path, "/") + "." + string(h.Algorithm))
+	if err := hashPath.WriteFile(bytes.NewReader([]byte(h.Hex())), nil); err != nil {
+		return nil, fmt.Errorf("error writing %s: %v", hashPath, err)
+	}
+
+	return &BundleAsset{Source: source, Target: target.Path(), Digest: file.Digest.String()}, nil
+}
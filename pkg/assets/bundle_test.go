@@ -0,0 +1,364 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// fakeRegistry implements the parts of the docker registry HTTP API v2 used to pull and push images,
+// requiring a bearer token issued by its /token endpoint
+type fakeRegistry struct {
+	mutex     sync.Mutex
+	server    *httptest.Server
+	manifests map[string]fakeManifest
+	blobs     map[digest.Digest][]byte
+	uploads   int
+}
+
+type fakeManifest struct {
+	MediaType string
+	Data      []byte
+}
+
+func newFakeRegistry() *fakeRegistry {
+	r := &fakeRegistry{
+		manifests: make(map[string]fakeManifest),
+		blobs:     make(map[digest.Digest][]byte),
+	}
+	r.server = httptest.NewServer(r)
+	return r
+}
+
+// host returns the host of the registry, as used in image names
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if req.URL.Path == "/token" {
+		json.NewEncoder(w).Encode(map[string]string{"token": "t0k3n"})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer t0k3n" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:x:pull,push"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.HasSuffix(p, "/blobs/uploads/") && req.Method == http.MethodPost:
+		w.Header().Set("Location", "/upload/1")
+		w.WriteHeader(http.StatusAccepted)
+
+	case strings.HasPrefix(req.URL.Path, "/upload/") && req.Method == http.MethodPut:
+		data, _ := ioutil.ReadAll(req.Body)
+		d := digest.Digest(req.URL.Query().Get("digest"))
+		if digest.FromBytes(data) != d {
+			http.Error(w, "digest mismatch", http.StatusBadRequest)
+			return
+		}
+		r.blobs[d] = data
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+
+	case strings.Contains(p, "/blobs/"):
+		d := digest.Digest(p[strings.LastIndex(p, "/")+1:])
+		data, found := r.blobs[d]
+		if !found {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+
+	case strings.Contains(p, "/manifests/") && req.Method == http.MethodPut:
+		data, _ := ioutil.ReadAll(req.Body)
+		r.manifests[p] = fakeManifest{MediaType: req.Header.Get("Content-Type"), Data: data}
+		w.WriteHeader(http.StatusCreated)
+
+	case strings.Contains(p, "/manifests/"):
+		m, found := r.manifests[p]
+		if !found {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", m.MediaType)
+		w.Write(m.Data)
+
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// addBlob adds a blob to the registry, returning its descriptor
+func (r *fakeRegistry) addBlob(mediaType string, data []byte) ocispec.Descriptor {
+	d := digest.FromBytes(data)
+	r.blobs[d] = data
+	return ocispec.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+}
+
+// addImage adds an image with a single layer, served for linux/amd64 from a manifest list, returning the digest of its manifest
+func (r *fakeRegistry) addImage(t *testing.T, repository string, tag string, layer string) digest.Digest {
+	manifest := &ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    r.addBlob("application/vnd.docker.container.image.v1+json", []byte(`{"architecture":"amd64"}`)),
+		Layers:    []ocispec.Descriptor{r.addBlob("application/vnd.docker.image.rootfs.diff.tar.gzip", []byte(layer))},
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("error serializing manifest: %v", err)
+	}
+	d := digest.FromBytes(data)
+	r.manifests[repository+"/manifests/"+d.String()] = fakeManifest{MediaType: mediaTypeDockerManifest, Data: data}
+
+	list := &ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []ocispec.Descriptor{
+			{MediaType: mediaTypeDockerManifest, Digest: digest.FromString("arm64"), Platform: &ocispec.Platform{OS: "linux", Architecture: "arm64"}},
+			{MediaType: mediaTypeDockerManifest, Digest: d, Size: int64(len(data)), Platform: &ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+		},
+	}
+	listData, err := json.Marshal(list)
+	if err != nil {
+		t.Fatalf("error serializing manifest list: %v", err)
+	}
+	r.manifests[repository+"/manifests/"+tag] = fakeManifest{MediaType: mediaTypeDockerManifestList, Data: listData}
+	return d
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	source := newFakeRegistry()
+	defer source.server.Close()
+	apiserverDigest := source.addImage(t, "kube-apiserver", "v1.10.0", "apiserver layer")
+	dnsControllerDigest := source.addImage(t, "kope/dns-controller", "1.9.0", "dns-controller layer")
+
+	registryEndpoints["k8s.gcr.io"] = source.server.URL
+	registryEndpoints["registry-1.docker.io"] = source.server.URL
+	defer func() {
+		delete(registryEndpoints, "k8s.gcr.io")
+		delete(registryEndpoints, "registry-1.docker.io")
+	}()
+
+	kubelet := []byte("kubelet binary")
+	kubeletHash := sha1.Sum(kubelet)
+	kubectl := []byte("kubectl binary")
+	kubectlHash := sha256.Sum256(kubectl)
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubelet" {
+			w.Write(kubelet)
+			return
+		}
+		if req.URL.Path == "/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubectl" {
+			w.Write(kubectl)
+			return
+		}
+		http.NotFound(w, req)
+	}))
+	defer files.Close()
+	kubeletURL, _ := url.Parse(files.URL + "/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubelet")
+	kubectlURL, _ := url.Parse(files.URL + "/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubectl")
+
+	a := &AssetBuilder{
+		ContainerAssets: []*ContainerAsset{
+			{DockerImage: "k8s.gcr.io/kube-apiserver:v1.10.0"},
+			{DockerImage: "kope/dns-controller:1.9.0"},
+			{DockerImage: "k8s.gcr.io/kube-apiserver:v1.10.0"},
+		},
+		FileAssets: []*FileAsset{
+			{FileURL: kubeletURL, SHAValue: hex.EncodeToString(kubeletHash[:])},
+			{FileURL: kubectlURL, SHAValue: hex.EncodeToString(kubectlHash[:])},
+		},
+	}
+
+	var bundle bytes.Buffer
+	exported, err := ExportBundle(&bundle, a)
+	if err != nil {
+		t.Fatalf("error exporting bundle: %v", err)
+	}
+	if len(exported.Images) != 2 || len(exported.Files) != 2 {
+		t.Fatalf("unexpected bundle contents: %d images, %d files", len(exported.Images), len(exported.Files))
+	}
+	if exported.Images[0].Source != "k8s.gcr.io/kube-apiserver:v1.10.0" || exported.Images[0].Digest != apiserverDigest.String() {
+		t.Errorf("unexpected image %+v, expected digest %s", exported.Images[0], apiserverDigest)
+	}
+
+	// The bundle is an OCI image layout
+	names := make(map[string]bool)
+	tr := tar.NewReader(bytes.NewReader(bundle.Bytes()))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading bundle: %v", err)
+		}
+		names[header.Name] = true
+	}
+	for _, name := range []string{"oci-layout", "index.json", "blobs/sha256/" + apiserverDigest.Hex(), "blobs/sha256/" + digest.FromBytes(kubelet).Hex()} {
+		if !names[name] {
+			t.Errorf("bundle does not contain %q: %v", name, names)
+		}
+	}
+
+	target := newFakeRegistry()
+	defer target.server.Close()
+	vfs.Context.ResetMemfsContext(true)
+	fileRepository, err := vfs.Context.BuildVfsPath("memfs://files/kops")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+
+	imported, err := ImportBundle(bytes.NewReader(bundle.Bytes()), &ImportBundleOptions{
+		ContainerRegistry: target.host(),
+		FileRepository:    fileRepository,
+	})
+	if err != nil {
+		t.Fatalf("error importing bundle: %v", err)
+	}
+	if len(imported.Images) != 2 || len(imported.Files) != 2 {
+		t.Fatalf("unexpected imported contents: %d images, %d files", len(imported.Images), len(imported.Files))
+	}
+
+	// Images are pushed under the names the AssetBuilder remaps them to
+	for image, d := range map[string]digest.Digest{
+		"k8s.gcr.io/kube-apiserver:v1.10.0": apiserverDigest,
+		"kope/dns-controller:1.9.0":         dnsControllerDigest,
+	} {
+		l, err := parseImageLocation(remapImageToRegistry(target.host(), image))
+		if err != nil {
+			t.Fatalf("error parsing image: %v", err)
+		}
+		m, found := target.manifests[l.Repository+"/manifests/"+l.Reference]
+		if !found {
+			t.Errorf("image %q was not pushed as %s:%s", image, l.Repository, l.Reference)
+			continue
+		}
+		if digest.FromBytes(m.Data) != d || m.MediaType != mediaTypeDockerManifest {
+			t.Errorf("image %q was pushed with digest %s and media type %q", image, digest.FromBytes(m.Data), m.MediaType)
+		}
+	}
+	// The images share their config, and the fake registry does not separate blobs by repository
+	if target.uploads != 3 {
+		t.Errorf("expected 3 blobs to be uploaded, got %d", target.uploads)
+	}
+
+	// Files are written at the path of their URL, with their hash
+	data, err := vfs.Context.ReadFile("memfs://files/kops/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubelet")
+	if err != nil || !bytes.Equal(data, kubelet) {
+		t.Errorf("unexpected kubelet in file repository: %q, %v", data, err)
+	}
+	data, err = vfs.Context.ReadFile("memfs://files/kops/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubelet.sha1")
+	if err != nil || string(data) != hex.EncodeToString(kubeletHash[:]) {
+		t.Errorf("unexpected kubelet hash in file repository: %q, %v", data, err)
+	}
+
+	// The hash file is named for the algorithm of the hash
+	data, err = vfs.Context.ReadFile("memfs://files/kops/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubectl.sha256")
+	if err != nil || string(data) != hex.EncodeToString(kubectlHash[:]) {
+		t.Errorf("unexpected kubectl hash in file repository: %q, %v", data, err)
+	}
+	if _, err := vfs.Context.ReadFile("memfs://files/kops/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubectl.sha1"); !os.IsNotExist(err) {
+		t.Errorf("expected no SHA-1 hash file for kubectl, got %v", err)
+	}
+
+	// Importing again does not upload the blobs again
+	if _, err := ImportBundle(bytes.NewReader(bundle.Bytes()), &ImportBundleOptions{ContainerRegistry: target.host(), FileRepository: fileRepository}); err != nil {
+		t.Fatalf("error importing bundle again: %v", err)
+	}
+	if target.uploads != 3 {
+		t.Errorf("blobs were uploaded again: %d uploads", target.uploads)
+	}
+}
+
+func TestExportBundleVerifiesFileHash(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("tampered"))
+	}))
+	defer files.Close()
+	u, _ := url.Parse(files.URL + "/kubelet")
+
+	hash := sha1.Sum([]byte("kubelet binary"))
+	a := &AssetBuilder{
+		FileAssets: []*FileAsset{{FileURL: u, SHAValue: hex.EncodeToString(hash[:])}},
+	}
+	if _, err := ExportBundle(ioutil.Discard, a); err == nil || !strings.Contains(err.Error(), "expected") {
+		t.Errorf("expected hash mismatch error, got %v", err)
+	}
+}
+
+func TestImportBundleVerifiesBlobs(t *testing.T) {
+	var bundle bytes.Buffer
+	tw := tar.NewWriter(&bundle)
+	for name, data := range map[string]string{
+		"oci-layout": `{"imageLayoutVersion":"1.0.0"}`,
+		"index.json": `{"schemaVersion":2,"manifests":[]}`,
+		"blobs/sha256/" + digest.FromString("original").Hex(): "tampered",
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+
+	vfs.Context.ResetMemfsContext(true)
+	fileRepository, _ := vfs.Context.BuildVfsPath("memfs://files")
+	_, err := ImportBundle(&bundle, &ImportBundleOptions{ContainerRegistry: "localhost:5000", FileRepository: fileRepository})
+	if err == nil || !strings.Contains(err.Error(), "has digest") {
+		t.Errorf("expected digest mismatch error, got %v", err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	params := parseChallenge(`realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/busybox:pull,push"`)
+	expected := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/busybox:pull,push",
+	}
+	if len(params) != len(expected) {
+		t.Errorf("unexpected parameters %v", params)
+	}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("parameter %q: expected %q, got %q", k, v, params[k])
+		}
+	}
+}
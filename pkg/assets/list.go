@@ -0,0 +1,224 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/opencontainers/go-digest"
+	"k8s.io/kops/util/pkg/hashing"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// Types of assets
+const (
+	AssetTypeImage = "image"
+	AssetTypeFile  = "file"
+)
+
+// Asset is a container image or file used by a cluster
+type Asset struct {
+	// Type is AssetTypeImage or AssetTypeFile
+	Type string `json:"type"`
+	// Source is the location the asset is published at
+	Source string `json:"source"`
+	// Location is the location the cluster uses, after the asset is remapped to a mirror
+	Location string `json:"location"`
+	// SHA256 is the SHA-256 hash of the file, or the digest of the manifest of the image, hex-encoded
+	SHA256 string `json:"sha256,omitempty"`
+	// UsedBy are the components and addons that reference the asset
+	UsedBy []string `json:"usedBy,omitempty"`
+}
+
+// ListAssets returns the images and files of the AssetBuilder, sorted by type and source, with their SHA-256 hashes.
+// The hashes are read from the location the cluster uses, falling back to the source if the asset has not been copied there.
+func ListAssets(a *AssetBuilder) ([]*Asset, error) {
+	var assets []*Asset
+
+	images := make(map[string]*Asset)
+	for _, c := range a.ContainerAssets {
+		source := c.CanonicalLocation
+		if source == "" {
+			source = c.DockerImage
+		}
+		asset := images[source]
+		if asset == nil {
+			asset = &Asset{Type: AssetTypeImage, Source: source, Location: c.DockerImage}
+			if d, err := digest.Parse(c.Digest); err == nil && d.Algorithm() == digest.SHA256 {
+				// The image was pinned to this digest when the cluster was built
+				asset.SHA256 = d.Hex()
+			}
+			images[source] = asset
+			assets = append(assets, asset)
+		}
+		asset.UsedBy = appendComponent(asset.UsedBy, c.Component)
+	}
+
+	files := make(map[string]*Asset)
+	fileHashes := make(map[*Asset]string)
+	for _, f := range a.FileAssets {
+		u := f.CanonicalFileURL
+		if u == nil {
+			u = f.FileURL
+		}
+		source := u.String()
+		asset := files[source]
+		if asset == nil {
+			asset = &Asset{Type: AssetTypeFile, Source: source, Location: f.FileURL.String()}
+			files[source] = asset
+			fileHashes[asset] = f.SHAValue
+			assets = append(assets, asset)
+		}
+		asset.UsedBy = appendComponent(asset.UsedBy, f.Component)
+	}
+
+	sort.Slice(assets, func(i, j int) bool {
+		if assets[i].Type != assets[j].Type {
+			return assets[i].Type == AssetTypeImage
+		}
+		return assets[i].Source < assets[j].Source
+	})
+
+	registry := newRegistryClient(false)
+	for _, asset := range assets {
+		sort.Strings(asset.UsedBy)
+		if asset.SHA256 != "" {
+			continue
+		}
+
+		var err error
+		switch asset.Type {
+		case AssetTypeImage:
+			asset.SHA256, err = resolveFromLocations(asset, func(image string) (string, error) {
+				return imageDigest(registry, image)
+			})
+		case AssetTypeFile:
+			asset.SHA256, err = resolveFromLocations(asset, func(fileURL string) (string, error) {
+				return fileSHA256(fileURL, fileHashes[asset])
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return assets, nil
+}
+
+// appendComponent adds the component to the list, if it is not already in it
+func appendComponent(components []string, component string) []string {
+	if component == "" {
+		return components
+	}
+	for _, c := range components {
+		if c == component {
+			return components
+		}
+	}
+	return append(components, component)
+}
+
+// resolveFromLocations resolves the hash of the asset from its location, falling back to its source
+func resolveFromLocations(asset *Asset, resolve func(string) (string, error)) (string, error) {
+	hash, err := resolve(asset.Location)
+	if err == nil || asset.Source == asset.Location {
+		return hash, err
+	}
+	glog.V(2).Infof("unable to read %s, reading %s instead: %v", asset.Location, asset.Source, err)
+	return resolve(asset.Source)
+}
+
+// imageDigest returns the hex-encoded SHA-256 digest of the manifest of the image.
+// For multi-platform images, this is the digest of the manifest list.
+func imageDigest(registry *registryClient, image string) (string, error) {
+	l, err := parseImageLocation(image)
+	if err != nil {
+		return "", err
+	}
+
+	d, err := registry.resolveDigest(l)
+	if err != nil {
+		return "", fmt.Errorf("error reading manifest of %q: %v", image, err)
+	}
+	if d.Algorithm() != digest.SHA256 {
+		return "", fmt.Errorf("digest of %q is not a SHA-256 digest: %s", image, d)
+	}
+	return d.Hex(), nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 hash of the file.  The hash is read from the .sha256 file published
+// alongside it if there is one, and otherwise the file is downloaded, checked against the hash kops uses, and hashed.
+func fileSHA256(fileURL string, hash string) (string, error) {
+	if h, err := hashing.FromString(hash); err == nil && h.Algorithm == hashing.HashAlgorithmSHA256 {
+		return h.Hex(), nil
+	}
+
+	if b, err := readOptionalFile(fileURL + ".sha256"); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) != 0 {
+			if _, err := hex.DecodeString(fields[0]); err == nil && len(fields[0]) == 64 {
+				return strings.ToLower(fields[0]), nil
+			}
+		}
+		glog.V(2).Infof("ignoring unexpected contents of %s.sha256", fileURL)
+	}
+
+	glog.Infof("downloading %q to compute its SHA-256 hash", fileURL)
+	data, err := vfs.Context.ReadFile(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("error downloading %q: %v", fileURL, err)
+	}
+	if hash != "" {
+		if err := verifyFileHash(fileURL, data, hash); err != nil {
+			return "", err
+		}
+	}
+	h, err := hashing.HashAlgorithmSHA256.Hash(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("error hashing %q: %v", fileURL, err)
+	}
+	return h.Hex(), nil
+}
+
+// readOptionalFile reads a file that may not exist.  Unlike vfs.Context.ReadFile,
+// an http(s) URL is requested once, rather than retrying in case a 404 is due to eventual consistency.
+func readOptionalFile(fileURL string) ([]byte, error) {
+	if !strings.HasPrefix(fileURL, "http://") && !strings.HasPrefix(fileURL, "https://") {
+		return vfs.Context.ReadFile(fileURL)
+	}
+
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response code %q for %q", resp.Status, fileURL)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
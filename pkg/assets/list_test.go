@@ -0,0 +1,191 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestListAssets(t *testing.T) {
+	source := newFakeRegistry()
+	defer source.server.Close()
+	source.addImage(t, "kube-apiserver", "v1.10.0", "apiserver layer")
+	listDigest := digest.FromBytes(source.manifests["kube-apiserver/manifests/v1.10.0"].Data)
+
+	registryEndpoints["k8s.gcr.io"] = source.server.URL
+	defer delete(registryEndpoints, "k8s.gcr.io")
+
+	// The mirror is empty, so the digest is read from the source
+	mirror := newFakeRegistry()
+	defer mirror.server.Close()
+
+	kubelet := []byte("kubelet binary")
+	kubeletSHA256 := sha256.Sum256(kubelet)
+	nodeup := []byte("nodeup binary")
+	nodeupSHA1 := sha1.Sum(nodeup)
+	nodeupSHA256 := sha256.Sum256(nodeup)
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/release/v1.10.0/bin/linux/amd64/kubelet.sha256":
+			w.Write([]byte(hex.EncodeToString(kubeletSHA256[:]) + "  kubelet\n"))
+		case "/kops/1.10.0/linux/amd64/nodeup":
+			w.Write(nodeup)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer files.Close()
+	kubeletURL, _ := url.Parse(files.URL + "/release/v1.10.0/bin/linux/amd64/kubelet")
+	nodeupURL, _ := url.Parse(files.URL + "/kops/1.10.0/linux/amd64/nodeup")
+
+	a := &AssetBuilder{
+		ContainerAssets: []*ContainerAsset{
+			{DockerImage: mirror.host() + "/kube-apiserver:v1.10.0", CanonicalLocation: "k8s.gcr.io/kube-apiserver:v1.10.0", Component: "kube-apiserver"},
+			{DockerImage: mirror.host() + "/kube-apiserver:v1.10.0", CanonicalLocation: "k8s.gcr.io/kube-apiserver:v1.10.0", Component: "custom-addon"},
+			{DockerImage: "k8s.gcr.io/pause@sha256:" + strings.Repeat("ab", 32), Component: "kubelet"},
+		},
+		FileAssets: []*FileAsset{
+			{FileURL: nodeupURL, SHAValue: hex.EncodeToString(nodeupSHA1[:]), Component: "nodeup"},
+			{FileURL: kubeletURL, SHAValue: "0123", Component: "kubelet"},
+		},
+	}
+
+	assets, err := ListAssets(a)
+	if err != nil {
+		t.Fatalf("error listing assets: %v", err)
+	}
+
+	expected := []*Asset{
+		{
+			Type:     AssetTypeImage,
+			Source:   "k8s.gcr.io/kube-apiserver:v1.10.0",
+			Location: mirror.host() + "/kube-apiserver:v1.10.0",
+			SHA256:   listDigest.Hex(),
+			UsedBy:   []string{"custom-addon", "kube-apiserver"},
+		},
+		{
+			Type:     AssetTypeImage,
+			Source:   "k8s.gcr.io/pause@sha256:" + strings.Repeat("ab", 32),
+			Location: "k8s.gcr.io/pause@sha256:" + strings.Repeat("ab", 32),
+			SHA256:   strings.Repeat("ab", 32),
+			UsedBy:   []string{"kubelet"},
+		},
+		{
+			Type:     AssetTypeFile,
+			Source:   nodeupURL.String(),
+			Location: nodeupURL.String(),
+			SHA256:   hex.EncodeToString(nodeupSHA256[:]),
+			UsedBy:   []string{"nodeup"},
+		},
+		{
+			Type:     AssetTypeFile,
+			Source:   kubeletURL.String(),
+			Location: kubeletURL.String(),
+			SHA256:   hex.EncodeToString(kubeletSHA256[:]),
+			UsedBy:   []string{"kubelet"},
+		},
+	}
+	if !reflect.DeepEqual(assets, expected) {
+		actualJSON, _ := json.MarshalIndent(assets, "", "  ")
+		expectedJSON, _ := json.MarshalIndent(expected, "", "  ")
+		t.Errorf("unexpected assets\nactual: %s\nexpected: %s", actualJSON, expectedJSON)
+	}
+}
+
+func TestSBOM(t *testing.T) {
+	assets := []*Asset{
+		{
+			Type:     AssetTypeImage,
+			Source:   "k8s.gcr.io/kube-apiserver:v1.10.0",
+			Location: "mirror.example.com/kube-apiserver:v1.10.0",
+			SHA256:   strings.Repeat("ab", 32),
+			UsedBy:   []string{"kube-apiserver"},
+		},
+		{
+			Type:     AssetTypeFile,
+			Source:   "https://storage.googleapis.com/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubelet",
+			Location: "https://storage.googleapis.com/kubernetes-release/release/v1.10.0/bin/linux/amd64/kubelet",
+			SHA256:   strings.Repeat("cd", 32),
+			UsedBy:   []string{"kubelet"},
+		},
+	}
+	options := &SBOMOptions{
+		Name:    "cluster.example.com",
+		Created: time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC),
+		Serial:  "3d3b3c1f-2d6e-4c8b-9a1e-000000000000",
+	}
+
+	var b bytes.Buffer
+	if err := WriteCycloneDX(&b, assets, options); err != nil {
+		t.Fatalf("error writing CycloneDX: %v", err)
+	}
+	bom := &cycloneDXBOM{}
+	if err := json.Unmarshal(b.Bytes(), bom); err != nil {
+		t.Fatalf("error parsing CycloneDX: %v", err)
+	}
+	if bom.SpecVersion != "1.4" || bom.SerialNumber != "urn:uuid:"+options.Serial || bom.Metadata.Timestamp != "2018-06-01T12:00:00Z" {
+		t.Errorf("unexpected CycloneDX header: %+v", bom)
+	}
+	if len(bom.Components) != 2 {
+		t.Fatalf("unexpected CycloneDX components: %+v", bom.Components)
+	}
+	image := bom.Components[0]
+	if image.Type != "container" || image.Name != "k8s.gcr.io/kube-apiserver" || image.Version != "v1.10.0" {
+		t.Errorf("unexpected image component: %+v", image)
+	}
+	if image.PURL != "pkg:oci/kube-apiserver@sha256%3A"+strings.Repeat("ab", 32)+"?repository_url=k8s.gcr.io%2Fkube-apiserver&tag=v1.10.0" {
+		t.Errorf("unexpected purl of image: %q", image.PURL)
+	}
+	file := bom.Components[1]
+	if file.Type != "file" || file.Name != "kubelet" || file.Version != "v1.10.0" || len(file.Hashes) != 1 || file.Hashes[0].Content != strings.Repeat("cd", 32) {
+		t.Errorf("unexpected file component: %+v", file)
+	}
+
+	b.Reset()
+	if err := WriteSPDX(&b, assets, options); err != nil {
+		t.Fatalf("error writing SPDX: %v", err)
+	}
+	doc := &spdxDocument{}
+	if err := json.Unmarshal(b.Bytes(), doc); err != nil {
+		t.Fatalf("error parsing SPDX: %v", err)
+	}
+	if doc.SPDXVersion != "SPDX-2.2" || doc.CreationInfo.Created != "2018-06-01T12:00:00Z" || !strings.HasSuffix(doc.DocumentNamespace, options.Serial) {
+		t.Errorf("unexpected SPDX header: %+v", doc)
+	}
+	if len(doc.Packages) != 2 || len(doc.Relationships) != 2 {
+		t.Fatalf("unexpected SPDX packages: %+v", doc.Packages)
+	}
+	if p := doc.Packages[1]; p.Name != "kubelet" || p.Checksums[0].Algorithm != "SHA256" || p.DownloadLocation != assets[1].Source {
+		t.Errorf("unexpected SPDX package: %+v", p)
+	}
+	if r := doc.Relationships[0]; r.SPDXElementID != "SPDXRef-DOCUMENT" || r.RelationshipType != "DESCRIBES" || r.RelatedSPDXElement != doc.Packages[0].SPDXID {
+		t.Errorf("unexpected SPDX relationship: %+v", r)
+	}
+}
@@ -0,0 +1,428 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/golang/glog"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Media types of docker image manifests, which registries serve as well as the OCI media types
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// manifestMediaTypes are the manifest media types we accept from a registry
+var manifestMediaTypes = []string{
+	ocispec.MediaTypeImageManifest,
+	mediaTypeDockerManifest,
+	ocispec.MediaTypeImageIndex,
+	mediaTypeDockerManifestList,
+}
+
+// registryEndpoints overrides the base URL of the API of a registry, by host; used for testing
+var registryEndpoints = map[string]string{}
+
+// imageLocation is an image in a registry
+type imageLocation struct {
+	// Host is the host of the registry
+	Host string
+	// Repository is the name of the image in the registry
+	Repository string
+	// Reference is the tag or digest of the image
+	Reference string
+}
+
+// parseImageLocation parses an image name, as it is given to docker
+func parseImageLocation(image string) (*imageLocation, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing image %q: %v", image, err)
+	}
+
+	l := &imageLocation{
+		Host:       reference.Domain(named),
+		Repository: reference.Path(named),
+		Reference:  "latest",
+	}
+	if l.Host == "docker.io" {
+		l.Host = "registry-1.docker.io"
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		l.Reference = digested.Digest().String()
+	} else if tagged, ok := named.(reference.Tagged); ok {
+		l.Reference = tagged.Tag()
+	}
+	return l, nil
+}
+
+// registryClient copies images using the docker registry HTTP API v2.
+// Registries asking for a bearer token are sent an anonymous token request; other credentials are not supported.
+type registryClient struct {
+	httpClient *http.Client
+
+	// insecure is true if registries are accessed over plain HTTP
+	insecure bool
+
+	// tokens are the bearer tokens issued for each repository
+	tokens map[string]string
+}
+
+// newRegistryClient builds a registryClient.  Registries on the loopback interface are always accessed over plain HTTP, as docker does.
+func newRegistryClient(insecure bool) *registryClient {
+	return &registryClient{
+		httpClient: http.DefaultClient,
+		insecure:   insecure,
+		tokens:     make(map[string]string),
+	}
+}
+
+// url returns the URL of the API of the registry for the repository
+func (c *registryClient) url(l *imageLocation, elem ...string) string {
+	base := registryEndpoints[l.Host]
+	if base == "" {
+		scheme := "https"
+		if c.insecure || isLoopback(l.Host) {
+			scheme = "http"
+		}
+		base = scheme + "://" + l.Host
+	}
+	return base + "/v2/" + l.Repository + "/" + strings.Join(elem, "/")
+}
+
+// isLoopback returns true if the host (with optional port) is on the loopback interface
+func isLoopback(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// do sends a request to the registry, requesting a token and retrying if the registry asks for a bearer token.
+// body opens the body of the request, so that it can be sent again.
+func (c *registryClient) do(l *imageLocation, method string, u string, header http.Header, body func() (io.ReadCloser, error), size int64) (*http.Response, error) {
+	key := l.Host + "/" + l.Repository
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, u, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error building request for %q: %v", u, err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if body != nil {
+			req.Body, err = body()
+			if err != nil {
+				return nil, err
+			}
+			req.ContentLength = size
+		}
+		if token := c.tokens[key]; token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		glog.V(4).Infof("%s %s", method, u)
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error from %s %s: %v", method, u, err)
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt != 0 {
+			return resp, nil
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if !strings.HasPrefix(challenge, "Bearer ") {
+			return nil, fmt.Errorf("registry %s requires authentication, which is not supported (%q)", l.Host, challenge)
+		}
+		token, err := c.requestToken(parseChallenge(strings.TrimPrefix(challenge, "Bearer ")))
+		if err != nil {
+			return nil, fmt.Errorf("error requesting token for %s: %v", key, err)
+		}
+		c.tokens[key] = token
+	}
+}
+
+// parseChallenge parses the parameters of a WWW-Authenticate challenge, such as realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		eq := strings.Index(s, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, "\"") {
+			end := strings.Index(s[1:], "\"")
+			if end == -1 {
+				end = len(s) - 1
+			}
+			value = s[1 : end+1]
+			s = s[end+1:]
+			if s != "" {
+				s = s[1:]
+			}
+		} else {
+			end := strings.Index(s, ",")
+			if end == -1 {
+				end = len(s)
+			}
+			value = s[:end]
+			s = s[end:]
+		}
+		params[key] = value
+		s = strings.TrimPrefix(strings.TrimSpace(s), ",")
+	}
+	return params
+}
+
+// requestToken requests an anonymous bearer token from the token server of the challenge
+func (c *registryClient) requestToken(challenge map[string]string) (string, error) {
+	realm := challenge["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("challenge does not include a realm")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("error parsing realm %q: %v", realm, err)
+	}
+	query := u.Query()
+	for _, k := range []string{"service", "scope"} {
+		if challenge[k] != "" {
+			query.Set(k, challenge[k])
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	resp, err := c.httpClient.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from %s: %s", realm, resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error parsing token from %s: %v", realm, err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+	return "", fmt.Errorf("no token returned from %s", realm)
+}
+
+// responseError builds an error from an unexpected response, including the start of its body
+func responseError(resp *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("unexpected status from %s %s: %s %s", resp.Request.Method, resp.Request.URL, resp.Status, strings.TrimSpace(string(b)))
+}
+
+// getManifest downloads the manifest of the image.  If the image is a manifest list, the manifest of the linux/amd64 image is returned.
+func (c *registryClient) getManifest(l *imageLocation) ([]byte, string, error) {
+	data, mediaType, err := c.fetchManifest(l, l.Reference)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch mediaType {
+	case ocispec.MediaTypeImageManifest, mediaTypeDockerManifest:
+		return data, mediaType, nil
+
+	case ocispec.MediaTypeImageIndex, mediaTypeDockerManifestList:
+		index := &ocispec.Index{}
+		if err := json.Unmarshal(data, index); err != nil {
+			return nil, "", fmt.Errorf("error parsing manifest list of %s/%s:%s: %v", l.Host, l.Repository, l.Reference, err)
+		}
+		for _, m := range index.Manifests {
+			if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				data, mediaType, err := c.fetchManifest(l, m.Digest.String())
+				if err != nil {
+					return nil, "", err
+				}
+				if mediaType != ocispec.MediaTypeImageManifest && mediaType != mediaTypeDockerManifest {
+					return nil, "", fmt.Errorf("unexpected media type %q of linux/amd64 image of %s/%s:%s", mediaType, l.Host, l.Repository, l.Reference)
+				}
+				return data, mediaType, nil
+			}
+		}
+		return nil, "", fmt.Errorf("manifest list of %s/%s:%s does not include a linux/amd64 image", l.Host, l.Repository, l.Reference)
+
+	default:
+		return nil, "", fmt.Errorf("unsupported media type %q of %s/%s:%s", mediaType, l.Host, l.Repository, l.Reference)
+	}
+}
+
+// fetchManifest downloads the manifest with the tag or digest, verifying the digest if one is given
+func (c *registryClient) fetchManifest(l *imageLocation, ref string) ([]byte, string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := c.do(l, http.MethodGet, c.url(l, "manifests", ref), header, nil, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", responseError(resp)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading manifest of %s/%s:%s: %v", l.Host, l.Repository, ref, err)
+	}
+
+	if d, err := digest.Parse(ref); err == nil {
+		if actual := digest.FromBytes(data); actual != d {
+			return nil, "", fmt.Errorf("digest of manifest of %s/%s was %s, expected %s", l.Host, l.Repository, actual, d)
+		}
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if i := strings.Index(mediaType, ";"); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	if mediaType == "" || mediaType == "application/json" {
+		var versioned struct {
+			MediaType string `json:"mediaType"`
+		}
+		if err := json.Unmarshal(data, &versioned); err == nil && versioned.MediaType != "" {
+			mediaType = versioned.MediaType
+		}
+	}
+	return data, mediaType, nil
+}
+
+// resolveDigest returns the digest of the manifest of the image; for multi-platform images, this is the digest of the manifest list
+func (c *registryClient) resolveDigest(l *imageLocation) (digest.Digest, error) {
+	if d, err := digest.Parse(l.Reference); err == nil {
+		return d, nil
+	}
+
+	data, _, err := c.fetchManifest(l, l.Reference)
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(data), nil
+}
+
+// getBlob downloads a blob of the image
+func (c *registryClient) getBlob(l *imageLocation, d digest.Digest) (io.ReadCloser, error) {
+	resp, err := c.do(l, http.MethodGet, c.url(l, "blobs", d.String()), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// hasBlob returns true if the repository already has the blob
+func (c *registryClient) hasBlob(l *imageLocation, d digest.Digest) (bool, error) {
+	resp, err := c.do(l, http.MethodHead, c.url(l, "blobs", d.String()), nil, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, responseError(resp)
+	}
+}
+
+// putBlob uploads a blob to the repository, in a single request
+func (c *registryClient) putBlob(l *imageLocation, d digest.Digest, size int64, open func() (io.ReadCloser, error)) error {
+	resp, err := c.do(l, http.MethodPost, c.url(l, "blobs", "uploads")+"/", nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("error parsing upload location %q: %v", resp.Header.Get("Location"), err)
+	}
+	query := location.Query()
+	query.Set("digest", d.String())
+	location.RawQuery = query.Encode()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err = c.do(l, http.MethodPut, location.String(), header, open, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// putManifest uploads the manifest of the image, tagging it with the reference of the image
+func (c *registryClient) putManifest(l *imageLocation, mediaType string, data []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+	open := func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	resp, err := c.do(l, http.MethodPut, c.url(l, "manifests", l.Reference), header, open, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/satori/go.uuid"
+	"k8s.io/kops"
+)
+
+// SBOMOptions describes the software bill of materials document
+type SBOMOptions struct {
+	// Name is the name of the document, normally the name of the cluster
+	Name string
+	// Created is the time the document is created
+	Created time.Time
+	// Serial is a unique identifier of the document; a random UUID is generated if it is empty
+	Serial string
+}
+
+func (o *SBOMOptions) serial() string {
+	if o.Serial != "" {
+		return o.Serial
+	}
+	return uuid.NewV4().String()
+}
+
+// cycloneDXBOM is a CycloneDX 1.4 JSON document
+type cycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string              `json:"timestamp"`
+	Tools     []cycloneDXTool     `json:"tools"`
+	Component *cycloneDXComponent `json:"component,omitempty"`
+}
+
+type cycloneDXTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef             string                       `json:"bom-ref,omitempty"`
+	Type               string                       `json:"type"`
+	Name               string                       `json:"name"`
+	Version            string                       `json:"version,omitempty"`
+	Hashes             []cycloneDXHash              `json:"hashes,omitempty"`
+	PURL               string                       `json:"purl,omitempty"`
+	ExternalReferences []cycloneDXExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cycloneDXProperty          `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// WriteCycloneDX writes the assets as a CycloneDX 1.4 JSON software bill of materials
+func WriteCycloneDX(w io.Writer, assets []*Asset, options *SBOMOptions) error {
+	bom := &cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + options.serial(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: options.Created.UTC().Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Vendor: "Kubernetes", Name: "kops", Version: kops.Version}},
+			Component: &cycloneDXComponent{Type: "application", Name: options.Name},
+		},
+		Components: []cycloneDXComponent{},
+	}
+
+	for i, asset := range assets {
+		name, version := assetNameAndVersion(asset)
+		c := cycloneDXComponent{
+			BOMRef:             fmt.Sprintf("%s-%d", asset.Type, i+1),
+			Name:               name,
+			Version:            version,
+			PURL:               assetPURL(asset),
+			ExternalReferences: []cycloneDXExternalReference{{Type: "distribution", URL: asset.Source}},
+		}
+		switch asset.Type {
+		case AssetTypeImage:
+			c.Type = "container"
+		default:
+			c.Type = "file"
+		}
+		if asset.SHA256 != "" {
+			c.Hashes = []cycloneDXHash{{Alg: "SHA-256", Content: asset.SHA256}}
+		}
+		if asset.Location != asset.Source {
+			c.Properties = append(c.Properties, cycloneDXProperty{Name: "kops:location", Value: asset.Location})
+		}
+		if len(asset.UsedBy) != 0 {
+			c.Properties = append(c.Properties, cycloneDXProperty{Name: "kops:usedBy", Value: strings.Join(asset.UsedBy, ",")})
+		}
+		bom.Components = append(bom.Components, c)
+	}
+
+	return writeIndentedJSON(w, bom)
+}
+
+// spdxDocument is an SPDX 2.2 JSON document
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// WriteSPDX writes the assets as an SPDX 2.2 JSON software bill of materials
+func WriteSPDX(w io.Writer, assets []*Asset, options *SBOMOptions) error {
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.2",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              options.Name,
+		DocumentNamespace: "https://github.com/kubernetes/kops/spdx/" + url.PathEscape(options.Name) + "-" + options.serial(),
+		CreationInfo: spdxCreationInfo{
+			Created:  options.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: kops-" + kops.Version},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+
+	for i, asset := range assets {
+		name, version := assetNameAndVersion(asset)
+		p := spdxPackage{
+			SPDXID:           fmt.Sprintf("SPDXRef-%s-%d", asset.Type, i+1),
+			Name:             name,
+			VersionInfo:      version,
+			DownloadLocation: asset.Source,
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+		}
+		if asset.SHA256 != "" {
+			p.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: asset.SHA256}}
+		}
+		if purl := assetPURL(asset); purl != "" {
+			p.ExternalRefs = []spdxExternalRef{{ReferenceCategory: "PACKAGE_MANAGER", ReferenceType: "purl", ReferenceLocator: purl}}
+		}
+		var comments []string
+		if asset.Location != asset.Source {
+			comments = append(comments, "Location: "+asset.Location)
+		}
+		if len(asset.UsedBy) != 0 {
+			comments = append(comments, "Used by: "+strings.Join(asset.UsedBy, ", "))
+		}
+		p.Comment = strings.Join(comments, "\n")
+
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      doc.SPDXID,
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: p.SPDXID,
+		})
+	}
+
+	return writeIndentedJSON(w, doc)
+}
+
+func writeIndentedJSON(w io.Writer, o interface{}) error {
+	b, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializing software bill of materials: %v", err)
+	}
+	b = append(b, '\n')
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("error writing software bill of materials: %v", err)
+	}
+	return nil
+}
+
+// releaseVersion matches the version in the path of a release file, as in /release/v1.10.0/bin/linux/amd64/kubelet
+var releaseVersion = regexp.MustCompile(`^v?[0-9]+\.[0-9]+(\.[0-9]+)?([-+][0-9A-Za-z.+-]*)?$`)
+
+// assetNameAndVersion returns the name and version of the asset, as they are shown in a software bill of materials.
+// The name of an image is its repository and the version its tag; the name of a file is its file name,
+// and the version is taken from its path if it looks like a release.
+func assetNameAndVersion(asset *Asset) (string, string) {
+	if asset.Type == AssetTypeImage {
+		named, err := reference.ParseNormalizedNamed(asset.Source)
+		if err != nil {
+			return asset.Source, ""
+		}
+		version := ""
+		if tagged, ok := named.(reference.Tagged); ok {
+			version = tagged.Tag()
+		}
+		return reference.FamiliarName(named), version
+	}
+
+	u, err := url.Parse(asset.Source)
+	if err != nil {
+		return asset.Source, ""
+	}
+	version := ""
+	for _, elem := range strings.Split(path.Dir(u.Path), "/") {
+		if releaseVersion.MatchString(elem) {
+			version = elem
+		}
+	}
+	return path.Base(u.Path), version
+}
+
+// assetPURL returns the package URL of the asset: a pkg:oci purl for images, and a pkg:generic purl for files.
+// An empty string is returned for images whose digest is not known, as an OCI purl requires a digest.
+func assetPURL(asset *Asset) string {
+	name, version := assetNameAndVersion(asset)
+	switch asset.Type {
+	case AssetTypeImage:
+		if asset.SHA256 == "" {
+			return ""
+		}
+		named, err := reference.ParseNormalizedNamed(asset.Source)
+		if err != nil {
+			return ""
+		}
+		q := url.Values{}
+		q.Set("repository_url", named.Name())
+		if version != "" {
+			q.Set("tag", version)
+		}
+		return "pkg:oci/" + url.PathEscape(path.Base(name)) + "@" + url.QueryEscape("sha256:"+asset.SHA256) + "?" + q.Encode()
+
+	default:
+		q := url.Values{}
+		q.Set("download_url", asset.Source)
+		if asset.SHA256 != "" {
+			q.Set("checksum", "sha256:"+asset.SHA256)
+		}
+		purl := "pkg:generic/" + url.PathEscape(name)
+		if version != "" {
+			purl += "@" + url.PathEscape(version)
+		}
+		return purl + "?" + q.Encode()
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/kops/pkg/pki"
+)
+
+// annotationCosignSignature is the annotation of the layer of a cosign signature manifest holding the base64-encoded signature of the layer
+const annotationCosignSignature = "dev.cosignproject.cosign/signature"
+
+// pinImageDigests returns true if the images are pinned to digests, which is implied by verifying their signatures
+func (a *AssetBuilder) pinImageDigests() bool {
+	if a.AssetsLocation == nil {
+		return false
+	}
+	if a.AssetsLocation.PinImageDigests != nil && *a.AssetsLocation.PinImageDigests {
+		return true
+	}
+	return a.AssetsLocation.ImageSignature != nil
+}
+
+// pinImage resolves the image to the digest of its manifest, verifying the signature of the digest if AssetsLocation requires one.
+// It returns the image name with the digest, as in registry.example.com/kube-apiserver:v1.10.0@sha256:..., and the digest.
+func (a *AssetBuilder) pinImage(image string) (string, digest.Digest, error) {
+	if d, found := a.imageDigests[image]; found {
+		return pinnedImageName(image, d), d, nil
+	}
+
+	l, err := parseImageLocation(image)
+	if err != nil {
+		return "", "", err
+	}
+
+	if a.registry == nil {
+		a.registry = newRegistryClient(false)
+	}
+	d, err := a.registry.resolveDigest(l)
+	if err != nil {
+		return "", "", fmt.Errorf("error resolving digest of image %q: %v", image, err)
+	}
+	glog.V(2).Infof("resolved image %q to %s", image, d)
+
+	if a.AssetsLocation.ImageSignature != nil {
+		key, err := pki.ParsePEMPublicKey([]byte(a.AssetsLocation.ImageSignature.PublicKey))
+		if err != nil {
+			return "", "", fmt.Errorf("error parsing spec.assets.imageSignature.publicKey: %v", err)
+		}
+		if err := verifyImageSignature(a.registry, l, d, key); err != nil {
+			return "", "", fmt.Errorf("image %q is not signed with the key in spec.assets.imageSignature: %v", image, err)
+		}
+		glog.Infof("verified signature of image %q (%s)", image, d)
+	}
+
+	if a.imageDigests == nil {
+		a.imageDigests = make(map[string]digest.Digest)
+	}
+	a.imageDigests[image] = d
+	return pinnedImageName(image, d), d, nil
+}
+
+// pinnedImageName adds the digest to the image name, unless the image is already referenced by digest
+func pinnedImageName(image string, d digest.Digest) string {
+	if strings.Contains(image, "@") {
+		return image
+	}
+	return image + "@" + d.String()
+}
+
+// signatureTag returns the tag that cosign stores the signatures of the manifest with the digest under
+func signatureTag(d digest.Digest) string {
+	return d.Algorithm().String() + "-" + d.Hex() + ".sig"
+}
+
+// verifyImageSignature checks that the repository of the image holds a signature of the digest made with the key.
+// Signatures are read as cosign stores them: a manifest tagged sha256-<hex>.sig, with a layer for each signature
+// whose content is the signed payload, and whose annotation is the signature.
+func verifyImageSignature(registry *registryClient, l *imageLocation, d digest.Digest, key crypto.PublicKey) error {
+	sigLocation := &imageLocation{Host: l.Host, Repository: l.Repository, Reference: signatureTag(d)}
+	data, _, err := registry.fetchManifest(sigLocation, sigLocation.Reference)
+	if err != nil {
+		return fmt.Errorf("error reading signatures from %s/%s:%s: %v", sigLocation.Host, sigLocation.Repository, sigLocation.Reference, err)
+	}
+	manifest := &ocispec.Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return fmt.Errorf("error parsing signatures from %s/%s:%s: %v", sigLocation.Host, sigLocation.Repository, sigLocation.Reference, err)
+	}
+
+	var problems []string
+	for _, layer := range manifest.Layers {
+		signature := layer.Annotations[annotationCosignSignature]
+		if signature == "" {
+			continue
+		}
+
+		payload, err := readSignaturePayload(registry, sigLocation, layer.Digest)
+		if err != nil {
+			return err
+		}
+		if err := verifySignedPayload(payload, signature, d, key); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		return nil
+	}
+
+	if len(problems) == 0 {
+		return fmt.Errorf("no signatures found in %s/%s:%s", sigLocation.Host, sigLocation.Repository, sigLocation.Reference)
+	}
+	return fmt.Errorf("no valid signature found in %s/%s:%s: %s", sigLocation.Host, sigLocation.Repository, sigLocation.Reference, strings.Join(problems, "; "))
+}
+
+// readSignaturePayload downloads the signed payload, checking its digest
+func readSignaturePayload(registry *registryClient, l *imageLocation, d digest.Digest) ([]byte, error) {
+	r, err := registry.getBlob(l, d)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	payload, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signed payload %s from %s/%s: %v", d, l.Host, l.Repository, err)
+	}
+	if actual := digest.FromBytes(payload); actual != d {
+		return nil, fmt.Errorf("digest of signed payload from %s/%s was %s, expected %s", l.Host, l.Repository, actual, d)
+	}
+	return payload, nil
+}
+
+// simpleSigningPayload is the part of the payload signed by cosign that identifies the image
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// verifySignedPayload checks the base64-encoded signature of the SHA-256 hash of the payload with the key,
+// and that the payload is for the digest
+func verifySignedPayload(payload []byte, signature string, d digest.Digest, key crypto.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("error decoding signature: %v", err)
+	}
+
+	hash := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		var ecdsaSig struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(sig, &ecdsaSig); err != nil {
+			return fmt.Errorf("error parsing ECDSA signature: %v", err)
+		}
+		if !ecdsa.Verify(k, hash[:], ecdsaSig.R, ecdsaSig.S) {
+			return fmt.Errorf("signature was not made with the key")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], sig); err != nil {
+			return fmt.Errorf("signature was not made with the key")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+
+	signed := &simpleSigningPayload{}
+	if err := json.Unmarshal(payload, signed); err != nil {
+		return fmt.Errorf("error parsing signed payload: %v", err)
+	}
+	if signed.Critical.Image.DockerManifestDigest != d.String() {
+		return fmt.Errorf("signature is for %q, not %s", signed.Critical.Image.DockerManifestDigest, d)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package assets
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// addSignature stores a cosign signature of the digest, made with the key, in the repository
+func (r *fakeRegistry) addSignature(t *testing.T, repository string, d digest.Digest, key *ecdsa.PrivateKey) {
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"%s"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`, repository, d))
+	hash := sha256.Sum256(payload)
+	sigR, sigS, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatalf("error signing payload: %v", err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{sigR, sigS})
+	if err != nil {
+		t.Fatalf("error serializing signature: %v", err)
+	}
+
+	layer := r.addBlob("application/vnd.dev.cosign.simplesigning.v1+json", payload)
+	layer.Annotations = map[string]string{annotationCosignSignature: base64.StdEncoding.EncodeToString(sig)}
+	manifest := &ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    r.addBlob("application/vnd.oci.image.config.v1+json", []byte("{}")),
+		Layers:    []ocispec.Descriptor{layer},
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("error serializing manifest: %v", err)
+	}
+	r.manifests[repository+"/manifests/"+signatureTag(d)] = fakeManifest{MediaType: ocispec.MediaTypeImageManifest, Data: data}
+}
+
+func generatePublicKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("error serializing public key: %v", err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestPinImageDigests(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.server.Close()
+	registry.addImage(t, "kube-apiserver", "v1.10.0", "apiserver layer")
+	listDigest := digest.FromBytes(registry.manifests["kube-apiserver/manifests/v1.10.0"].Data)
+
+	registryEndpoints["k8s.gcr.io"] = registry.server.URL
+	defer delete(registryEndpoints, "k8s.gcr.io")
+
+	pin := true
+	a := &AssetBuilder{
+		AssetsLocation:    &kops.Assets{PinImageDigests: &pin},
+		KubernetesVersion: semver.MustParse("1.10.0"),
+	}
+
+	// Images are only pinned when the cluster is updated
+	image, err := a.RemapImage("kube-apiserver", "k8s.gcr.io/kube-apiserver:v1.10.0")
+	if err != nil {
+		t.Fatalf("error remapping image: %v", err)
+	}
+	if image != "k8s.gcr.io/kube-apiserver:v1.10.0" {
+		t.Errorf("image was pinned without ResolveImageDigests: %q", image)
+	}
+
+	a.ResolveImageDigests = true
+	manifest, err := a.RemapManifest("kube-apiserver", []byte("apiVersion: v1\nkind: Pod\nspec:\n  containers:\n  - image: k8s.gcr.io/kube-apiserver:v1.10.0\n"))
+	if err != nil {
+		t.Fatalf("error remapping manifest: %v", err)
+	}
+	expected := "k8s.gcr.io/kube-apiserver:v1.10.0@" + listDigest.String()
+	if !strings.Contains(string(manifest), "image: "+expected) {
+		t.Errorf("manifest was not pinned to %q:\n%s", expected, manifest)
+	}
+	last := a.ContainerAssets[len(a.ContainerAssets)-1]
+	if last.DockerImage != "k8s.gcr.io/kube-apiserver:v1.10.0" || last.Digest != listDigest.String() {
+		t.Errorf("unexpected asset %+v", last)
+	}
+
+	// Images that do not exist cannot be pinned
+	if _, err := a.RemapImage("kube-proxy", "k8s.gcr.io/kube-proxy:v1.10.0"); err == nil {
+		t.Errorf("expected error pinning an image that does not exist")
+	}
+}
+
+func TestVerifyImageSignatures(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.server.Close()
+	registry.addImage(t, "kube-apiserver", "v1.10.0", "apiserver layer")
+	registry.addImage(t, "kube-proxy", "v1.10.0", "proxy layer")
+	registry.addImage(t, "kube-scheduler", "v1.10.0", "scheduler layer")
+	apiserverDigest := digest.FromBytes(registry.manifests["kube-apiserver/manifests/v1.10.0"].Data)
+	proxyDigest := digest.FromBytes(registry.manifests["kube-proxy/manifests/v1.10.0"].Data)
+
+	registryEndpoints["k8s.gcr.io"] = registry.server.URL
+	defer delete(registryEndpoints, "k8s.gcr.io")
+
+	key, publicKey := generatePublicKey(t)
+	otherKey, _ := generatePublicKey(t)
+	registry.addSignature(t, "kube-apiserver", apiserverDigest, key)
+	registry.addSignature(t, "kube-proxy", proxyDigest, otherKey)
+
+	a := &AssetBuilder{
+		AssetsLocation:      &kops.Assets{ImageSignature: &kops.ImageSignatureSpec{PublicKey: publicKey}},
+		KubernetesVersion:   semver.MustParse("1.10.0"),
+		ResolveImageDigests: true,
+	}
+
+	image, err := a.RemapImage("kube-apiserver", "k8s.gcr.io/kube-apiserver:v1.10.0")
+	if err != nil {
+		t.Fatalf("error verifying signed image: %v", err)
+	}
+	if image != "k8s.gcr.io/kube-apiserver:v1.10.0@"+apiserverDigest.String() {
+		t.Errorf("signed image was not pinned: %q", image)
+	}
+
+	if _, err := a.RemapImage("kube-proxy", "k8s.gcr.io/kube-proxy:v1.10.0"); err == nil || !strings.Contains(err.Error(), "not made with the key") {
+		t.Errorf("expected error verifying image signed with another key, got %v", err)
+	}
+	if _, err := a.RemapImage("kube-scheduler", "k8s.gcr.io/kube-scheduler:v1.10.0"); err == nil {
+		t.Errorf("expected error verifying unsigned image")
+	}
+
+	// A signature of another image is not accepted
+	registry.addSignature(t, "kube-scheduler", apiserverDigest, key)
+	schedulerDigest := digest.FromBytes(registry.manifests["kube-scheduler/manifests/v1.10.0"].Data)
+	registry.manifests["kube-scheduler/manifests/"+signatureTag(schedulerDigest)] = registry.manifests["kube-scheduler/manifests/"+signatureTag(apiserverDigest)]
+	if _, err := a.RemapImage("kube-scheduler", "k8s.gcr.io/kube-scheduler:v1.10.0"); err == nil || !strings.Contains(err.Error(), "signature is for") {
+		t.Errorf("expected error verifying image with the signature of another image, got %v", err)
+	}
+}
@@ -56,23 +56,21 @@ func (b *Builder) Build(cluster *kops.Cluster, ig *kops.InstanceGroup) (*Data, e
 		return nil, err
 	}
 
-	fullCluster := &kops.Cluster{}
+	var fullCluster *kops.Cluster
 	{
 		configBase, err := b.Clientset.ConfigBaseFor(cluster)
 		if err != nil {
 			return nil, fmt.Errorf("error building ConfigBase for cluster: %v", err)
 		}
 
-		p := configBase.Join(registry.PathClusterCompleted)
-
-		b, err := p.ReadFile()
+		secretStore, err := b.Clientset.SecretStore(cluster)
 		if err != nil {
-			return nil, fmt.Errorf("error loading Cluster %q: %v", p, err)
+			return nil, err
 		}
 
-		err = utils.YamlUnmarshal(b, fullCluster)
+		fullCluster, err = cloudup.ReadCompletedCluster(cluster, configBase, secretStore)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing Cluster %q: %v", p, err)
+			return nil, fmt.Errorf("error loading Cluster %q: %v", configBase.Join(registry.PathClusterCompleted), err)
 		}
 	}
 
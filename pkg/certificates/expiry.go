@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certificates
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/pki"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// CertificateInfo describes a certificate in the keystore
+type CertificateInfo struct {
+	// Keyset is the name of the keyset holding the certificate
+	Keyset string `json:"keyset"`
+	// ID is the id of the certificate in the keyset
+	ID string `json:"id"`
+	// Primary is true if this is the certificate that is in use, rather than an older or additional certificate
+	Primary bool `json:"primary"`
+	// Subject is the distinguished name of the certificate
+	Subject string `json:"subject"`
+	// AlternateNames are the DNS names and IP addresses of the certificate
+	AlternateNames []string `json:"alternateNames,omitempty"`
+	// Issuer is the distinguished name of the CA that signed the certificate
+	Issuer string `json:"issuer"`
+	// NotAfter is when the certificate expires
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// ExpiresWithin returns true if the certificate expires before now + d
+func (c *CertificateInfo) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return now.Add(d).After(c.NotAfter)
+}
+
+// ListCertificates returns all the certificates of the keypairs in the keystore, sorted by keyset and id
+func ListCertificates(keyStore fi.CAStore) ([]*CertificateInfo, error) {
+	keysets, err := keyStore.ListKeysets()
+	if err != nil {
+		return nil, fmt.Errorf("error listing keysets: %v", err)
+	}
+
+	var certificates []*CertificateInfo
+	for _, k := range keysets {
+		if k.Spec.Type != kops.SecretTypeKeypair {
+			continue
+		}
+
+		// The listed keysets only have the ids, so we read each keyset for the certificates
+		keyset, err := keyStore.FindCertificateKeyset(k.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading keyset %q: %v", k.Name, err)
+		}
+		if keyset == nil {
+			continue
+		}
+		primary, err := keyStore.FindCert(k.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading certificate %q: %v", k.Name, err)
+		}
+
+		for _, item := range keyset.Spec.Keys {
+			if len(item.PublicMaterial) == 0 {
+				continue
+			}
+			cert, err := pki.ParsePEMCertificate(item.PublicMaterial)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing certificate %s:%s: %v", k.Name, item.Id, err)
+			}
+
+			info := &CertificateInfo{
+				Keyset:   k.Name,
+				ID:       item.Id,
+				Primary:  primary != nil && bytes.Equal(primary.Certificate.Raw, cert.Certificate.Raw),
+				Subject:  cert.Certificate.Subject.String(),
+				Issuer:   cert.Certificate.Issuer.String(),
+				NotAfter: cert.Certificate.NotAfter,
+			}
+			info.AlternateNames = append(info.AlternateNames, cert.Certificate.DNSNames...)
+			for _, ip := range cert.Certificate.IPAddresses {
+				info.AlternateNames = append(info.AlternateNames, ip.String())
+			}
+			certificates = append(certificates, info)
+		}
+	}
+
+	sort.Slice(certificates, func(i, j int) bool {
+		if certificates[i].Keyset != certificates[j].Keyset {
+			return certificates[i].Keyset < certificates[j].Keyset
+		}
+		return certificates[i].ID < certificates[j].ID
+	})
+	return certificates, nil
+}
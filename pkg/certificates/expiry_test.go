@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certificates
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+func TestListCertificates(t *testing.T) {
+	r := buildTestRotator(t)
+
+	ca := storeTestKeypair(t, r.KeyStore, fi.CertificateId_CA, "", true)
+	storeTestKeypair(t, r.KeyStore, "master", fi.CertificateId_CA, false)
+	if err := r.RunPhase(&Status{RotateCA: true}, PhaseCAStaged); err != nil {
+		t.Fatalf("error staging CA: %v", err)
+	}
+
+	certificates, err := ListCertificates(r.KeyStore)
+	if err != nil {
+		t.Fatalf("error listing certificates: %v", err)
+	}
+
+	var keysets []string
+	primaries := 0
+	for _, c := range certificates {
+		keysets = append(keysets, c.Keyset)
+		if c.Primary {
+			primaries++
+		}
+	}
+	// The staged CA is in both the ca and ca-next keysets
+	expected := []string{"ca", "ca", "ca-next", "master"}
+	if len(keysets) != len(expected) {
+		t.Fatalf("expected keysets %v, got %v", expected, keysets)
+	}
+	for i := range expected {
+		if keysets[i] != expected[i] {
+			t.Fatalf("expected keysets %v, got %v", expected, keysets)
+		}
+	}
+	if primaries != 3 {
+		t.Errorf("expected 3 primary certificates, got %d", primaries)
+	}
+
+	master := certificates[3]
+	if master.Subject != "CN=master" {
+		t.Errorf("unexpected subject %q", master.Subject)
+	}
+	if master.Issuer != ca.Certificate.Subject.String() {
+		t.Errorf("unexpected issuer %q", master.Issuer)
+	}
+
+	now := time.Now()
+	if master.ExpiresWithin(now, 24*time.Hour) {
+		t.Errorf("certificate should not expire within a day")
+	}
+	if !master.ExpiresWithin(now, 20*365*24*time.Hour) {
+		t.Errorf("certificate should expire within 20 years")
+	}
+}
@@ -0,0 +1,411 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certificates
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/pki"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+const (
+	// KeysetNextCA is the keyset holding the CA that is being rotated in, until the old CA is retired
+	KeysetNextCA = "ca-next"
+
+	// SecretRotationStatus is the secret recording the progress of a certificate rotation
+	SecretRotationStatus = "certificate-rotation"
+)
+
+// Phase is a step of a certificate rotation.  The instances are rolled after each phase,
+// so that they pick up the changes to the keystore before the next phase starts.
+type Phase string
+
+const (
+	// PhaseReissued means the certificates have been reissued by the current CA
+	PhaseReissued Phase = "Reissued"
+	// PhaseCAStaged means a new CA has been created, and is trusted alongside the old CA
+	PhaseCAStaged Phase = "CAStaged"
+	// PhaseCAPromoted means the new CA is the primary CA, and the certificates have been reissued by it
+	PhaseCAPromoted Phase = "CAPromoted"
+	// PhaseCARetired means the old CA has been removed, and is no longer trusted
+	PhaseCARetired Phase = "CARetired"
+)
+
+// Status records the progress of a certificate rotation, so that it can be resumed
+type Status struct {
+	// RotateCA is true if the CA is being replaced, not just the certificates it issued
+	RotateCA bool `json:"rotateCA,omitempty"`
+	// Phase is the last phase whose changes to the keystore have been made
+	Phase Phase `json:"phase,omitempty"`
+	// RolledOut is true once the instances have been replaced after the last phase
+	RolledOut bool `json:"rolledOut,omitempty"`
+	// PreviousCA is the id of the CA certificate that is being replaced
+	PreviousCA string `json:"previousCA,omitempty"`
+}
+
+// NextPhase returns the phase that follows the last completed phase, or "" if the rotation is complete
+func (s *Status) NextPhase() Phase {
+	if !s.RotateCA {
+		if s.Phase == "" {
+			return PhaseReissued
+		}
+		return ""
+	}
+
+	switch s.Phase {
+	case "":
+		return PhaseCAStaged
+	case PhaseCAStaged:
+		return PhaseCAPromoted
+	case PhaseCAPromoted:
+		return PhaseCARetired
+	default:
+		return ""
+	}
+}
+
+// RemainingPhases returns the phases that have not yet started
+func (s *Status) RemainingPhases() []Phase {
+	var phases []Phase
+	next := &Status{RotateCA: s.RotateCA, Phase: s.Phase}
+	for {
+		phase := next.NextPhase()
+		if phase == "" {
+			return phases
+		}
+		phases = append(phases, phase)
+		next.Phase = phase
+	}
+}
+
+// Rotator makes the changes to the keystore for each phase of a certificate rotation
+type Rotator struct {
+	KeyStore    fi.CAStore
+	SecretStore fi.SecretStore
+}
+
+// LoadStatus returns the status of the rotation in progress, or nil if there is none
+func (r *Rotator) LoadStatus() (*Status, error) {
+	secret, err := r.SecretStore.FindSecret(SecretRotationStatus)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificate rotation status: %v", err)
+	}
+	if secret == nil {
+		return nil, nil
+	}
+
+	status := &Status{}
+	if err := json.Unmarshal(secret.Data, status); err != nil {
+		return nil, fmt.Errorf("error parsing certificate rotation status: %v", err)
+	}
+	return status, nil
+}
+
+// SaveStatus records the progress of the rotation
+func (r *Rotator) SaveStatus(status *Status) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("error serializing certificate rotation status: %v", err)
+	}
+	if _, err := r.SecretStore.ReplaceSecret(SecretRotationStatus, &fi.Secret{Data: data}); err != nil {
+		return fmt.Errorf("error writing certificate rotation status: %v", err)
+	}
+	return nil
+}
+
+// ClearStatus removes the status, once the rotation is complete
+func (r *Rotator) ClearStatus() error {
+	if err := r.SecretStore.DeleteSecret(SecretRotationStatus); err != nil {
+		return fmt.Errorf("error removing certificate rotation status: %v", err)
+	}
+	return nil
+}
+
+// RunPhase makes the changes to the keystore for the phase, and records it in the status.
+// Each phase can safely be run again if it was interrupted.
+func (r *Rotator) RunPhase(status *Status, phase Phase) error {
+	var err error
+	switch phase {
+	case PhaseReissued:
+		err = r.reissue()
+	case PhaseCAStaged:
+		err = r.stageCA(status)
+	case PhaseCAPromoted:
+		err = r.promoteCA()
+	case PhaseCARetired:
+		err = r.retireCA(status)
+	default:
+		err = fmt.Errorf("unknown certificate rotation phase %q", phase)
+	}
+	if err != nil {
+		return err
+	}
+
+	status.Phase = phase
+	status.RolledOut = false
+	return r.SaveStatus(status)
+}
+
+// reissue reissues the certificates signed by the primary CA, with the same CA
+func (r *Rotator) reissue() error {
+	caCert, caKey, _, err := r.KeyStore.FindKeypair(fi.CertificateId_CA)
+	if err != nil {
+		return fmt.Errorf("error reading CA keypair: %v", err)
+	}
+	if caCert == nil || caKey == nil {
+		return fmt.Errorf("CA keypair %q not found", fi.CertificateId_CA)
+	}
+
+	return r.reissueCertificates(caCert, caKey, []*pki.Certificate{caCert}, false)
+}
+
+// stageCA creates the new CA, and adds it to the CA pool so that it is trusted
+func (r *Rotator) stageCA(status *Status) error {
+	pool, err := r.KeyStore.FindCertificatePool(fi.CertificateId_CA)
+	if err != nil {
+		return fmt.Errorf("error reading CA certificates: %v", err)
+	}
+	if pool == nil || pool.Primary == nil {
+		return fmt.Errorf("CA certificate %q not found", fi.CertificateId_CA)
+	}
+
+	nextCert, _, _, err := r.KeyStore.FindKeypair(KeysetNextCA)
+	if err != nil {
+		return fmt.Errorf("error reading keypair %q: %v", KeysetNextCA, err)
+	}
+
+	if nextCert == nil {
+		glog.Infof("Creating new CA")
+		privateKey, err := pki.GeneratePrivateKey()
+		if err != nil {
+			return err
+		}
+		template := fi.BuildCAX509Template()
+		template.SerialNumber = pki.BuildPKISerial(time.Now().UnixNano())
+		nextCert, err = pki.SignNewCertificate(privateKey, template, nil, nil)
+		if err != nil {
+			return fmt.Errorf("error creating CA certificate: %v", err)
+		}
+		if err := r.KeyStore.StoreKeypair(KeysetNextCA, nextCert, privateKey); err != nil {
+			return err
+		}
+	}
+
+	if !containsCertificate(pool.All(), nextCert) {
+		if err := r.KeyStore.AddCert(fi.CertificateId_CA, nextCert); err != nil {
+			return err
+		}
+	}
+
+	if status.PreviousCA == "" {
+		keyset, err := r.KeyStore.FindCertificateKeyset(fi.CertificateId_CA)
+		if err != nil {
+			return err
+		}
+		ids, err := keysetItemIDs(keyset, pool.Primary)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("cannot find the id of the primary CA certificate")
+		}
+		status.PreviousCA = ids[0]
+	}
+	return nil
+}
+
+// promoteCA makes the new CA the primary CA, and reissues the certificates with it
+func (r *Rotator) promoteCA() error {
+	nextCert, nextKey, _, err := r.KeyStore.FindKeypair(KeysetNextCA)
+	if err != nil {
+		return fmt.Errorf("error reading keypair %q: %v", KeysetNextCA, err)
+	}
+	if nextCert == nil || nextKey == nil {
+		return fmt.Errorf("keypair %q not found; the new CA has not been staged", KeysetNextCA)
+	}
+
+	pool, err := r.KeyStore.FindCertificatePool(fi.CertificateId_CA)
+	if err != nil {
+		return fmt.Errorf("error reading CA certificates: %v", err)
+	}
+	if pool == nil || pool.Primary == nil {
+		return fmt.Errorf("CA certificate %q not found", fi.CertificateId_CA)
+	}
+
+	if !bytes.Equal(pool.Primary.Certificate.Raw, nextCert.Certificate.Raw) {
+		glog.Infof("Promoting new CA")
+		// The CA was created with a newer serial than the existing CA, so it becomes the primary
+		if err := r.KeyStore.StoreKeypair(fi.CertificateId_CA, nextCert, nextKey); err != nil {
+			return err
+		}
+	}
+
+	// Remove the copy that was added to trust the CA while it was staged
+	keyset, err := r.KeyStore.FindCertificateKeyset(fi.CertificateId_CA)
+	if err != nil {
+		return err
+	}
+	ids, err := keysetItemIDs(keyset, nextCert)
+	if err != nil {
+		return err
+	}
+	primaryID := nextCert.Certificate.SerialNumber.String()
+	for _, id := range ids {
+		if id == primaryID {
+			continue
+		}
+		if err := r.KeyStore.DeleteKeysetItem(keyset, id); err != nil {
+			return err
+		}
+	}
+
+	return r.reissueCertificates(nextCert, nextKey, pool.All(), true)
+}
+
+// retireCA removes the old CA from the CA pool, and removes the staging keyset
+func (r *Rotator) retireCA(status *Status) error {
+	keyset, err := r.KeyStore.FindCertificateKeyset(fi.CertificateId_CA)
+	if err != nil {
+		return err
+	}
+	if keyset != nil && status.PreviousCA != "" {
+		for _, item := range keyset.Spec.Keys {
+			if item.Id != status.PreviousCA {
+				continue
+			}
+			glog.Infof("Removing old CA %s", item.Id)
+			if err := r.KeyStore.DeleteKeysetItem(keyset, item.Id); err != nil {
+				return err
+			}
+		}
+	}
+
+	next, err := r.KeyStore.FindCertificateKeyset(KeysetNextCA)
+	if err != nil {
+		return err
+	}
+	if next != nil {
+		for _, item := range next.Spec.Keys {
+			if err := r.KeyStore.DeleteKeysetItem(next, item.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reissueCertificates replaces each keypair signed by one of the signers with a certificate signed by caCert.
+// If skipReissued is set, certificates that caCert already signed are left alone, so an interrupted rotation can be resumed.
+// The private keys are kept, because some are used for more than TLS (for example, to sign service account tokens).
+func (r *Rotator) reissueCertificates(caCert *pki.Certificate, caKey *pki.PrivateKey, signers []*pki.Certificate, skipReissued bool) error {
+	keysets, err := r.KeyStore.ListKeysets()
+	if err != nil {
+		return fmt.Errorf("error listing keysets: %v", err)
+	}
+	sort.Slice(keysets, func(i, j int) bool {
+		return keysets[i].Name < keysets[j].Name
+	})
+
+	for _, keyset := range keysets {
+		if keyset.Spec.Type != kops.SecretTypeKeypair || keyset.Name == fi.CertificateId_CA || keyset.Name == KeysetNextCA {
+			continue
+		}
+
+		cert, privateKey, _, err := r.KeyStore.FindKeypair(keyset.Name)
+		if err != nil {
+			return fmt.Errorf("error reading keypair %q: %v", keyset.Name, err)
+		}
+		if cert == nil || privateKey == nil || cert.Certificate.IsCA {
+			continue
+		}
+
+		// Certificates signed by other CAs (for example the aggregator CA) are left alone
+		if !signedBy(cert, signers) {
+			continue
+		}
+		if skipReissued && signedBy(cert, []*pki.Certificate{caCert}) {
+			continue
+		}
+
+		glog.Infof("Reissuing certificate %q", keyset.Name)
+		template := &x509.Certificate{
+			Subject:               cert.Certificate.Subject,
+			DNSNames:              cert.Certificate.DNSNames,
+			IPAddresses:           cert.Certificate.IPAddresses,
+			KeyUsage:              cert.Certificate.KeyUsage,
+			ExtKeyUsage:           cert.Certificate.ExtKeyUsage,
+			BasicConstraintsValid: true,
+			SerialNumber:          pki.BuildPKISerial(time.Now().UnixNano()),
+		}
+		reissued, err := pki.SignNewCertificate(privateKey, template, caCert.Certificate, caKey)
+		if err != nil {
+			return fmt.Errorf("error reissuing certificate %q: %v", keyset.Name, err)
+		}
+		if err := r.KeyStore.StoreKeypair(keyset.Name, reissued, privateKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func signedBy(cert *pki.Certificate, signers []*pki.Certificate) bool {
+	for _, signer := range signers {
+		if cert.Certificate.CheckSignatureFrom(signer.Certificate) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCertificate(certs []*pki.Certificate, cert *pki.Certificate) bool {
+	for _, c := range certs {
+		if bytes.Equal(c.Certificate.Raw, cert.Certificate.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// keysetItemIDs returns the ids of the items in the keyset that hold the certificate
+func keysetItemIDs(keyset *kops.Keyset, cert *pki.Certificate) ([]string, error) {
+	if keyset == nil {
+		return nil, nil
+	}
+	var ids []string
+	for _, item := range keyset.Spec.Keys {
+		if len(item.PublicMaterial) == 0 {
+			continue
+		}
+		c, err := pki.ParsePEMCertificate(item.PublicMaterial)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate %s:%s: %v", keyset.Name, item.Id, err)
+		}
+		if bytes.Equal(c.Certificate.Raw, cert.Certificate.Raw) {
+			ids = append(ids, item.Id)
+		}
+	}
+	return ids, nil
+}
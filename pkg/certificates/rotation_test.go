@@ -0,0 +1,236 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certificates
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/pki"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/secrets"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func buildTestRotator(t *testing.T) *Rotator {
+	vfs.Context.ResetMemfsContext(true)
+
+	basePath, err := vfs.Context.BuildVfsPath("memfs://tests")
+	if err != nil {
+		t.Fatalf("error building vfspath: %v", err)
+	}
+
+	cluster := &kops.Cluster{}
+	return &Rotator{
+		KeyStore:    fi.NewVFSCAStore(cluster, basePath.Join("pki"), true),
+		SecretStore: secrets.NewVFSSecretStore(cluster, basePath.Join("secrets")),
+	}
+}
+
+// storeTestKeypair creates a keypair, signed by the signer keypair or self-signed if signer is empty
+func storeTestKeypair(t *testing.T, keyStore fi.CAStore, name string, signer string, isCA bool) *pki.Certificate {
+	privateKey, err := pki.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("error generating private key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		BasicConstraintsValid: true,
+		SerialNumber:          pki.BuildPKISerial(time.Now().Add(-time.Hour).UnixNano()),
+	}
+	if isCA {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+
+	var cert *pki.Certificate
+	if signer == "" {
+		cert, err = pki.SignNewCertificate(privateKey, template, nil, nil)
+	} else {
+		signerCert, signerKey, _, findErr := keyStore.FindKeypair(signer)
+		if findErr != nil {
+			t.Fatalf("error reading keypair %q: %v", signer, findErr)
+		}
+		cert, err = pki.SignNewCertificate(privateKey, template, signerCert.Certificate, signerKey)
+	}
+	if err != nil {
+		t.Fatalf("error signing certificate %q: %v", name, err)
+	}
+
+	if err := keyStore.StoreKeypair(name, cert, privateKey); err != nil {
+		t.Fatalf("error storing keypair %q: %v", name, err)
+	}
+	return cert
+}
+
+func findTestKeypair(t *testing.T, keyStore fi.CAStore, name string) (*pki.Certificate, *pki.PrivateKey) {
+	cert, key, _, err := keyStore.FindKeypair(name)
+	if err != nil {
+		t.Fatalf("error reading keypair %q: %v", name, err)
+	}
+	return cert, key
+}
+
+func findTestPool(t *testing.T, keyStore fi.CAStore) *fi.CertificatePool {
+	pool, err := keyStore.FindCertificatePool(fi.CertificateId_CA)
+	if err != nil {
+		t.Fatalf("error reading CA pool: %v", err)
+	}
+	return pool
+}
+
+func runTestPhase(t *testing.T, r *Rotator, status *Status, expected Phase) {
+	phase := status.NextPhase()
+	if phase != expected {
+		t.Fatalf("expected phase %q, got %q", expected, phase)
+	}
+	if err := r.RunPhase(status, phase); err != nil {
+		t.Fatalf("error running phase %q: %v", phase, err)
+	}
+
+	loaded, err := r.LoadStatus()
+	if err != nil {
+		t.Fatalf("error loading status: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, status) {
+		t.Fatalf("status did not round-trip: expected %+v, got %+v", status, loaded)
+	}
+}
+
+func TestRotateCA(t *testing.T) {
+	r := buildTestRotator(t)
+
+	oldCA := storeTestKeypair(t, r.KeyStore, fi.CertificateId_CA, "", true)
+	oldMaster := storeTestKeypair(t, r.KeyStore, "master", fi.CertificateId_CA, false)
+	aggregator := storeTestKeypair(t, r.KeyStore, "apiserver-aggregator-ca", "", true)
+	aggregatorClient := storeTestKeypair(t, r.KeyStore, "apiserver-aggregator", "apiserver-aggregator-ca", false)
+	_, masterKey := findTestKeypair(t, r.KeyStore, "master")
+
+	status := &Status{RotateCA: true}
+	if phases := status.RemainingPhases(); !reflect.DeepEqual(phases, []Phase{PhaseCAStaged, PhaseCAPromoted, PhaseCARetired}) {
+		t.Fatalf("unexpected phases %v", phases)
+	}
+
+	runTestPhase(t, r, status, PhaseCAStaged)
+	nextCA, _ := findTestKeypair(t, r.KeyStore, KeysetNextCA)
+	if nextCA == nil {
+		t.Fatalf("new CA was not staged")
+	}
+	pool := findTestPool(t, r.KeyStore)
+	if !bytes.Equal(pool.Primary.Certificate.Raw, oldCA.Certificate.Raw) {
+		t.Errorf("primary CA changed while staging")
+	}
+	if len(pool.Secondary) != 1 || !bytes.Equal(pool.Secondary[0].Certificate.Raw, nextCA.Certificate.Raw) {
+		t.Errorf("new CA was not added to the CA pool")
+	}
+	if status.PreviousCA != oldCA.Certificate.SerialNumber.String() {
+		t.Errorf("expected previous CA %s, got %s", oldCA.Certificate.SerialNumber, status.PreviousCA)
+	}
+
+	// Staging again reuses the new CA
+	if err := r.RunPhase(status, PhaseCAStaged); err != nil {
+		t.Fatalf("error staging again: %v", err)
+	}
+	if again, _ := findTestKeypair(t, r.KeyStore, KeysetNextCA); !bytes.Equal(again.Certificate.Raw, nextCA.Certificate.Raw) {
+		t.Errorf("staging again created another CA")
+	}
+	if pool := findTestPool(t, r.KeyStore); len(pool.All()) != 2 {
+		t.Errorf("expected 2 CA certificates after staging again, got %d", len(pool.All()))
+	}
+
+	runTestPhase(t, r, status, PhaseCAPromoted)
+	pool = findTestPool(t, r.KeyStore)
+	if !bytes.Equal(pool.Primary.Certificate.Raw, nextCA.Certificate.Raw) {
+		t.Errorf("new CA was not promoted")
+	}
+	if len(pool.Secondary) != 1 || !bytes.Equal(pool.Secondary[0].Certificate.Raw, oldCA.Certificate.Raw) {
+		t.Errorf("old CA should still be trusted after promotion")
+	}
+	master, key := findTestKeypair(t, r.KeyStore, "master")
+	if err := master.Certificate.CheckSignatureFrom(nextCA.Certificate); err != nil {
+		t.Errorf("master certificate was not reissued by the new CA: %v", err)
+	}
+	if master.Certificate.Subject.CommonName != oldMaster.Certificate.Subject.CommonName {
+		t.Errorf("master certificate subject changed to %q", master.Certificate.Subject.CommonName)
+	}
+	if !reflect.DeepEqual(key, masterKey) {
+		t.Errorf("master private key changed")
+	}
+	if c, _ := findTestKeypair(t, r.KeyStore, "apiserver-aggregator-ca"); !bytes.Equal(c.Certificate.Raw, aggregator.Certificate.Raw) {
+		t.Errorf("aggregator CA should not change")
+	}
+	if c, _ := findTestKeypair(t, r.KeyStore, "apiserver-aggregator"); !bytes.Equal(c.Certificate.Raw, aggregatorClient.Certificate.Raw) {
+		t.Errorf("certificate signed by the aggregator CA should not change")
+	}
+
+	// Promoting again does not reissue the certificates again
+	if err := r.RunPhase(status, PhaseCAPromoted); err != nil {
+		t.Fatalf("error promoting again: %v", err)
+	}
+	if again, _ := findTestKeypair(t, r.KeyStore, "master"); !bytes.Equal(again.Certificate.Raw, master.Certificate.Raw) {
+		t.Errorf("promoting again reissued the master certificate")
+	}
+
+	runTestPhase(t, r, status, PhaseCARetired)
+	pool = findTestPool(t, r.KeyStore)
+	if !bytes.Equal(pool.Primary.Certificate.Raw, nextCA.Certificate.Raw) || len(pool.Secondary) != 0 {
+		t.Errorf("old CA was not retired: %d secondary certificates", len(pool.Secondary))
+	}
+	if c, _ := findTestKeypair(t, r.KeyStore, KeysetNextCA); c != nil {
+		t.Errorf("staging keyset was not removed")
+	}
+	if phase := status.NextPhase(); phase != "" {
+		t.Errorf("expected rotation to be complete, next phase is %q", phase)
+	}
+
+	if err := r.ClearStatus(); err != nil {
+		t.Fatalf("error clearing status: %v", err)
+	}
+	if loaded, err := r.LoadStatus(); err != nil || loaded != nil {
+		t.Errorf("expected no status after clearing, got %+v (err=%v)", loaded, err)
+	}
+}
+
+func TestReissueCertificates(t *testing.T) {
+	r := buildTestRotator(t)
+
+	ca := storeTestKeypair(t, r.KeyStore, fi.CertificateId_CA, "", true)
+	oldKubelet := storeTestKeypair(t, r.KeyStore, "kubelet", fi.CertificateId_CA, false)
+
+	status := &Status{}
+	runTestPhase(t, r, status, PhaseReissued)
+
+	kubelet, _ := findTestKeypair(t, r.KeyStore, "kubelet")
+	if bytes.Equal(kubelet.Certificate.Raw, oldKubelet.Certificate.Raw) {
+		t.Errorf("kubelet certificate was not reissued")
+	}
+	if err := kubelet.Certificate.CheckSignatureFrom(ca.Certificate); err != nil {
+		t.Errorf("kubelet certificate was not signed by the CA: %v", err)
+	}
+	if c, _ := findTestKeypair(t, r.KeyStore, fi.CertificateId_CA); !bytes.Equal(c.Certificate.Raw, ca.Certificate.Raw) {
+		t.Errorf("CA should not change")
+	}
+	if phase := status.NextPhase(); phase != "" {
+		t.Errorf("expected rotation to be complete, next phase is %q", phase)
+	}
+}
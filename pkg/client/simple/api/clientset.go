@@ -24,10 +24,12 @@ import (
 	"github.com/golang/glog"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/apis/kops/registry"
 	"k8s.io/kops/pkg/apis/kops/validation"
 	kopsinternalversion "k8s.io/kops/pkg/client/clientset_generated/clientset/typed/kops/internalversion"
+	"k8s.io/kops/pkg/client/simple"
 	"k8s.io/kops/pkg/client/simple/vfsclientset"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/secrets"
@@ -59,7 +61,11 @@ func (c *RESTClientset) UpdateCluster(cluster *kops.Cluster, status *kops.Cluste
 	if err != nil {
 		return nil, err
 	}
-	if err := validation.ValidateClusterUpdate(cluster, status, old).ToAggregate(); err != nil {
+	// The clusters are validated as they are in a VFS state store, where they do not have a namespace
+	validated := cluster.DeepCopy()
+	validated.Namespace = ""
+	old.Namespace = ""
+	if err := validation.ValidateClusterUpdate(validated, status, old).ToAggregate(); err != nil {
 		return nil, err
 	}
 
@@ -82,6 +88,21 @@ func (c *RESTClientset) ListClusters(options metav1.ListOptions) (*kops.ClusterL
 	return c.KopsClient.Clusters(metav1.NamespaceAll).List(options)
 }
 
+// WatchClusters implements the WatchClusters method of Clientset for a kubernetes-API state store
+func (c *RESTClientset) WatchClusters(options metav1.ListOptions) (watch.Interface, error) {
+	return c.KopsClient.Clusters(metav1.NamespaceAll).Watch(options)
+}
+
+// ListClusterRevisions implements the ListClusterRevisions method of Clientset for a kubernetes-API state store
+func (c *RESTClientset) ListClusterRevisions(name string) ([]*simple.Revision, error) {
+	return nil, fmt.Errorf("revision history is not supported for a kubernetes-API state store")
+}
+
+// GetClusterRevision implements the GetClusterRevision method of Clientset for a kubernetes-API state store
+func (c *RESTClientset) GetClusterRevision(name string, revision int) (*kops.Cluster, error) {
+	return nil, fmt.Errorf("revision history is not supported for a kubernetes-API state store")
+}
+
 // InstanceGroupsFor implements the InstanceGroupsFor method of Clientset for a kubernetes-API state store
 func (c *RESTClientset) InstanceGroupsFor(cluster *kops.Cluster) kopsinternalversion.InstanceGroupInterface {
 	namespace := restNamespaceForClusterName(cluster.Name)
@@ -137,6 +158,26 @@ func (c *RESTClientset) DeleteCluster(cluster *kops.Cluster) error {
 		}
 	}
 
+	{
+		sshCredentials, err := c.KopsClient.SSHCredentials(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing SSHCredentials: %v", err)
+		}
+
+		for i := range sshCredentials.Items {
+			sshCredential := &sshCredentials.Items[i]
+			err = c.KopsClient.SSHCredentials(namespace).Delete(sshCredential.Name, &metav1.DeleteOptions{})
+			if err != nil {
+				if errors.IsNotFound(err) {
+					// Unlikely...
+					glog.Warningf("SSHCredential was concurrently deleted")
+				} else {
+					return fmt.Errorf("error deleting SSHCredential %q: %v", sshCredential.Name, err)
+				}
+			}
+		}
+	}
+
 	{
 		igs, err := c.KopsClient.InstanceGroups(namespace).List(metav1.ListOptions{})
 		if err != nil {
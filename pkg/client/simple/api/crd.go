@@ -0,0 +1,229 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/v1alpha2"
+	kopsscheme "k8s.io/kops/pkg/client/clientset_generated/clientset/scheme"
+)
+
+// CRDGroupVersion is the group and version of the CustomResourceDefinitions that hold the kops objects
+var CRDGroupVersion = schema.GroupVersion{Group: "kops.k8s.io", Version: "v1alpha2"}
+
+// crdInternalGroupVersion is the internal version of CRDGroupVersion, that objects are converted to when they are read
+var crdInternalGroupVersion = schema.GroupVersion{Group: CRDGroupVersion.Group, Version: runtime.APIVersionInternal}
+
+// customResourceDefinitionsPath is the path of the CustomResourceDefinition API
+const customResourceDefinitionsPath = "/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions"
+
+// crdEstablishTimeout is how long we wait for a new CustomResourceDefinition to be served
+const crdEstablishTimeout = 30 * time.Second
+
+// crdKind describes the CustomResourceDefinition for a kops kind
+type crdKind struct {
+	Kind     string
+	Plural   string
+	Singular string
+}
+
+// crdKinds are the kinds stored as custom resources; the plurals match the resources of the generated client
+var crdKinds = []crdKind{
+	{Kind: "Cluster", Plural: "clusters", Singular: "cluster"},
+	{Kind: "InstanceGroup", Plural: "instancegroups", Singular: "instancegroup"},
+	{Kind: "Keyset", Plural: "keysets", Singular: "keyset"},
+	{Kind: "SSHCredential", Plural: "sshcredentials", Singular: "sshcredential"},
+}
+
+func init() {
+	// The generated client encodes list options with the parameter codec of the generated scheme,
+	// converting them to the version of the client, so they must be registered for the CRD group version.
+	metav1.AddToGroupVersion(kopsscheme.Scheme, CRDGroupVersion)
+}
+
+// newCRDScheme builds the scheme used to read and write kops objects as custom resources.
+// The objects are stored as v1alpha2, and converted to and from the internal kops types.
+func newCRDScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+
+	// Registers the conversion and defaulting functions of v1alpha2
+	if err := v1alpha2.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("error building scheme: %v", err)
+	}
+
+	scheme.AddKnownTypes(CRDGroupVersion,
+		&v1alpha2.Cluster{},
+		&v1alpha2.ClusterList{},
+		&v1alpha2.InstanceGroup{},
+		&v1alpha2.InstanceGroupList{},
+		&v1alpha2.Keyset{},
+		&v1alpha2.KeysetList{},
+		&v1alpha2.SSHCredential{},
+		&v1alpha2.SSHCredentialList{},
+	)
+	metav1.AddToGroupVersion(scheme, CRDGroupVersion)
+
+	scheme.AddKnownTypes(crdInternalGroupVersion,
+		&kops.Cluster{},
+		&kops.ClusterList{},
+		&kops.InstanceGroup{},
+		&kops.InstanceGroupList{},
+		&kops.Keyset{},
+		&kops.KeysetList{},
+		&kops.SSHCredential{},
+		&kops.SSHCredentialList{},
+	)
+
+	// Status is returned by the API server for errors
+	metav1.AddToGroupVersion(scheme, schema.GroupVersion{Version: "v1"})
+
+	return scheme, nil
+}
+
+// customResourceDefinition is the part of an apiextensions.k8s.io/v1beta1 CustomResourceDefinition that kops uses
+type customResourceDefinition struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   customResourceDefinitionSpec   `json:"spec"`
+	Status customResourceDefinitionStatus `json:"status,omitempty"`
+}
+
+type customResourceDefinitionSpec struct {
+	Group   string                        `json:"group"`
+	Version string                        `json:"version"`
+	Scope   string                        `json:"scope"`
+	Names   customResourceDefinitionNames `json:"names"`
+}
+
+type customResourceDefinitionNames struct {
+	Plural     string   `json:"plural"`
+	Singular   string   `json:"singular,omitempty"`
+	Kind       string   `json:"kind"`
+	ListKind   string   `json:"listKind,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+type customResourceDefinitionStatus struct {
+	Conditions []customResourceDefinitionCondition `json:"conditions,omitempty"`
+}
+
+type customResourceDefinitionCondition struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// established returns true if the API server is serving the custom resource
+func (d *customResourceDefinition) established() bool {
+	for _, condition := range d.Status.Conditions {
+		if condition.Type == "Established" && condition.Status == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// buildCustomResourceDefinition builds the CustomResourceDefinition for the kind
+func buildCustomResourceDefinition(k crdKind) *customResourceDefinition {
+	d := &customResourceDefinition{}
+	d.APIVersion = "apiextensions.k8s.io/v1beta1"
+	d.Kind = "CustomResourceDefinition"
+	d.Name = k.Plural + "." + CRDGroupVersion.Group
+	d.Spec = customResourceDefinitionSpec{
+		Group:   CRDGroupVersion.Group,
+		Version: CRDGroupVersion.Version,
+		Scope:   "Namespaced",
+		Names: customResourceDefinitionNames{
+			Plural:     k.Plural,
+			Singular:   k.Singular,
+			Kind:       k.Kind,
+			ListKind:   k.Kind + "List",
+			Categories: []string{"kops"},
+		},
+	}
+	return d
+}
+
+// EnsureCustomResourceDefinitions registers the CustomResourceDefinitions for the kops kinds, if they are not
+// already registered, and waits until they are served
+func EnsureCustomResourceDefinitions(client rest.Interface) error {
+	for _, k := range crdKinds {
+		expected := buildCustomResourceDefinition(k)
+
+		existing, err := getCustomResourceDefinition(client, expected.Name)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			glog.Infof("Registering CustomResourceDefinition %s", expected.Name)
+			data, err := json.Marshal(expected)
+			if err != nil {
+				return fmt.Errorf("error serializing CustomResourceDefinition %q: %v", expected.Name, err)
+			}
+			if err := client.Post().AbsPath(customResourceDefinitionsPath).Body(data).Do().Error(); err != nil && !errors.IsAlreadyExists(err) {
+				return fmt.Errorf("error creating CustomResourceDefinition %q: %v", expected.Name, err)
+			}
+		} else if existing.Spec.Group != expected.Spec.Group || existing.Spec.Names.Kind != expected.Spec.Names.Kind {
+			return fmt.Errorf("CustomResourceDefinition %q exists, but is for %s in group %s", expected.Name, existing.Spec.Names.Kind, existing.Spec.Group)
+		} else if existing.established() {
+			continue
+		}
+
+		err = wait.PollImmediate(time.Second, crdEstablishTimeout, func() (bool, error) {
+			d, err := getCustomResourceDefinition(client, expected.Name)
+			if err != nil {
+				return false, err
+			}
+			return d != nil && d.established(), nil
+		})
+		if err != nil {
+			return fmt.Errorf("error waiting for CustomResourceDefinition %q to be established: %v", expected.Name, err)
+		}
+	}
+	return nil
+}
+
+// getCustomResourceDefinition reads the named CustomResourceDefinition, returning nil if it does not exist
+func getCustomResourceDefinition(client rest.Interface, name string) (*customResourceDefinition, error) {
+	data, err := client.Get().AbsPath(customResourceDefinitionsPath, name).DoRaw()
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		if errors.IsForbidden(err) {
+			return nil, fmt.Errorf("error reading CustomResourceDefinition %q; registering the kops CustomResourceDefinitions requires permission to manage customresourcedefinitions: %v", name, err)
+		}
+		return nil, fmt.Errorf("error reading CustomResourceDefinition %q: %v", name, err)
+	}
+
+	d := &customResourceDefinition{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, fmt.Errorf("error parsing CustomResourceDefinition %q: %v", name, err)
+	}
+	return d, nil
+}
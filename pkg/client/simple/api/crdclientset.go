@@ -0,0 +1,240 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/validation"
+	kopsinternalversion "k8s.io/kops/pkg/client/clientset_generated/clientset/typed/kops/internalversion"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// StateStoreScheme is the scheme of a state store URL that refers to a Kubernetes cluster, k8s://<context>,
+// where context is the name of a context in the kubeconfig file
+const StateStoreScheme = "k8s"
+
+// AnnotationNamespaceCluster is set on the namespaces that kops creates for clusters, so that they are deleted with the cluster
+const AnnotationNamespaceCluster = "kops.k8s.io/cluster"
+
+// CRDClientset is an implementation of Clientset that stores the kops objects as custom resources in a
+// management cluster, with a namespace for each cluster.  The instances of a cluster cannot read the
+// custom resources, so the files they read are still written under the cluster's spec.configBase.
+type CRDClientset struct {
+	RESTClientset
+
+	// ConfigBase is the location under which the files of clusters without a spec.configBase are written
+	ConfigBase vfs.Path
+
+	restClient rest.Interface
+}
+
+var _ simple.Clientset = &CRDClientset{}
+
+// IsCRDStateStore returns true if the state store is a Kubernetes cluster
+func IsCRDStateStore(stateStore string) bool {
+	return strings.HasPrefix(stateStore, StateStoreScheme+"://")
+}
+
+// BuildCRDClientset builds a CRDClientset for a state store of the form k8s://<context>, using the credentials
+// of the kubeconfig context.  An empty context selects the current context.  The configBase query parameter,
+// as in k8s://<context>?configBase=s3://bucket, sets the location of the files of clusters without a spec.configBase.
+func BuildCRDClientset(stateStore string) (*CRDClientset, error) {
+	if !IsCRDStateStore(stateStore) {
+		return nil, fmt.Errorf("state store %q is not of the form %s://<context>", stateStore, StateStoreScheme)
+	}
+	context := strings.TrimPrefix(stateStore, StateStoreScheme+"://")
+
+	var configBase vfs.Path
+	if i := strings.Index(context, "?"); i != -1 {
+		query, err := url.ParseQuery(context[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing state store %q: %v", stateStore, err)
+		}
+		context = context[:i]
+
+		for k := range query {
+			if k != "configBase" {
+				return nil, fmt.Errorf("unknown parameter %q in state store %q", k, stateStore)
+			}
+		}
+		if s := query.Get("configBase"); s != "" {
+			configBase, err = vfs.Context.BuildVfsPath(strings.TrimSuffix(s, "/"))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing configBase %q: %v", s, err)
+			}
+		}
+	}
+	context = strings.TrimSuffix(context, "/")
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig context %q: %v", context, err)
+	}
+
+	c, err := NewCRDClientset(config)
+	if err != nil {
+		return nil, err
+	}
+	c.ConfigBase = configBase
+	return c, nil
+}
+
+// NewCRDClientset builds a CRDClientset for the Kubernetes cluster, registering the kops CustomResourceDefinitions if needed
+func NewCRDClientset(config *rest.Config) (*CRDClientset, error) {
+	scheme, err := newCRDScheme()
+	if err != nil {
+		return nil, err
+	}
+
+	config = rest.CopyConfig(config)
+	config.APIPath = "/apis"
+	config.GroupVersion = &CRDGroupVersion
+	config.NegotiatedSerializer = serializer.NewCodecFactory(scheme)
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	restClient, err := rest.RESTClientFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("error building client for %s: %v", config.Host, err)
+	}
+
+	if err := EnsureCustomResourceDefinitions(restClient); err != nil {
+		return nil, err
+	}
+
+	return &CRDClientset{
+		RESTClientset: RESTClientset{
+			KopsClient: kopsinternalversion.New(restClient),
+		},
+		restClient: restClient,
+	}, nil
+}
+
+// CreateCluster implements the CreateCluster method of Clientset for a CRD state store, creating the namespace of the cluster
+func (c *CRDClientset) CreateCluster(cluster *kops.Cluster) (*kops.Cluster, error) {
+	if err := validation.ValidateCluster(cluster, false); err != nil {
+		return nil, err
+	}
+	if cluster.Spec.ConfigBase == "" {
+		return nil, fmt.Errorf("spec.configBase must be set for cluster %q, as its instances read their configuration from it", cluster.Name)
+	}
+
+	if err := c.ensureNamespace(cluster.Name); err != nil {
+		return nil, err
+	}
+	return c.RESTClientset.CreateCluster(cluster)
+}
+
+// ConfigBaseFor implements the ConfigBaseFor method of Clientset for a CRD state store
+func (c *CRDClientset) ConfigBaseFor(cluster *kops.Cluster) (vfs.Path, error) {
+	if cluster.Spec.ConfigBase != "" {
+		return vfs.Context.BuildVfsPath(cluster.Spec.ConfigBase)
+	}
+	if c.ConfigBase == nil {
+		return nil, fmt.Errorf("the location of the configuration of cluster %q must be specified, with spec.configBase or the configBase parameter of the state store", cluster.Name)
+	}
+	return c.ConfigBase.Join(cluster.Name), nil
+}
+
+// KeysetsFor returns the KeysetInterface bound to the namespace of the cluster
+func (c *CRDClientset) KeysetsFor(cluster *kops.Cluster) kopsinternalversion.KeysetInterface {
+	namespace := restNamespaceForClusterName(cluster.Name)
+	return c.KopsClient.Keysets(namespace)
+}
+
+// DeleteCluster implements the DeleteCluster method of Clientset for a CRD state store, also deleting the
+// namespace of the cluster if kops created it
+func (c *CRDClientset) DeleteCluster(cluster *kops.Cluster) error {
+	if err := c.RESTClientset.DeleteCluster(cluster); err != nil {
+		return err
+	}
+
+	name := restNamespaceForClusterName(cluster.Name)
+	namespace, err := c.getNamespace(name)
+	if err != nil {
+		return err
+	}
+	if namespace == nil || namespace.Annotations[AnnotationNamespaceCluster] != cluster.Name {
+		return nil
+	}
+
+	glog.V(2).Infof("Deleting namespace %q", name)
+	if err := c.restClient.Delete().AbsPath("/api/v1/namespaces", name).Do().Error(); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting namespace %q: %v", name, err)
+	}
+	return nil
+}
+
+// ensureNamespace creates the namespace for the cluster, if it does not already exist
+func (c *CRDClientset) ensureNamespace(clusterName string) error {
+	name := restNamespaceForClusterName(clusterName)
+	existing, err := c.getNamespace(name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+
+	namespace := &v1.Namespace{}
+	namespace.APIVersion = "v1"
+	namespace.Kind = "Namespace"
+	namespace.Name = name
+	namespace.Annotations = map[string]string{AnnotationNamespaceCluster: clusterName}
+	data, err := json.Marshal(namespace)
+	if err != nil {
+		return fmt.Errorf("error serializing namespace %q: %v", name, err)
+	}
+
+	glog.V(2).Infof("Creating namespace %q", name)
+	if err := c.restClient.Post().AbsPath("/api/v1/namespaces").Body(data).Do().Error(); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("error creating namespace %q: %v", name, err)
+	}
+	return nil
+}
+
+// getNamespace reads the namespace, returning nil if it does not exist
+func (c *CRDClientset) getNamespace(name string) (*v1.Namespace, error) {
+	data, err := c.restClient.Get().AbsPath("/api/v1/namespaces", name).DoRaw()
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading namespace %q: %v", name, err)
+	}
+
+	namespace := &v1.Namespace{}
+	if err := json.Unmarshal(data, namespace); err != nil {
+		return nil, fmt.Errorf("error parsing namespace %q: %v", name, err)
+	}
+	return namespace, nil
+}
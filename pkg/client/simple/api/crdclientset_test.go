@@ -0,0 +1,223 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/testutils/mockapiserver"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func buildTestCluster() *kops.Cluster {
+	c := &kops.Cluster{}
+	c.ObjectMeta.Name = "cluster.example.com"
+	c.Spec.KubernetesVersion = "1.9.3"
+	c.Spec.CloudProvider = "aws"
+	c.Spec.Subnets = []kops.ClusterSubnetSpec{
+		{Name: "us-test-1a", Zone: "us-test-1a", CIDR: "172.20.32.0/19"},
+	}
+	c.Spec.NetworkCIDR = "172.20.0.0/16"
+	c.Spec.NonMasqueradeCIDR = "100.64.0.0/10"
+	c.Spec.Topology = &kops.TopologySpec{Masters: kops.TopologyPublic, Nodes: kops.TopologyPublic}
+	c.Spec.Networking = &kops.NetworkingSpec{Kubenet: &kops.KubenetNetworkingSpec{}}
+	for _, name := range []string{"main", "events"} {
+		c.Spec.EtcdClusters = append(c.Spec.EtcdClusters, &kops.EtcdClusterSpec{
+			Name:    name,
+			Members: []*kops.EtcdMemberSpec{{Name: "a", InstanceGroup: fi.String("master-us-test-1a")}},
+		})
+	}
+	return c
+}
+
+func nextEvent(t *testing.T, w watch.Interface) watch.Event {
+	select {
+	case event, ok := <-w.ResultChan():
+		if !ok {
+			t.Fatalf("watch closed unexpectedly")
+		}
+		return event
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for watch event")
+	}
+	return watch.Event{}
+}
+
+func TestCRDClientset(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	server := mockapiserver.New()
+	defer server.Close()
+
+	clientset, err := NewCRDClientset(server.Config())
+	if err != nil {
+		t.Fatalf("error building clientset: %v", err)
+	}
+	for _, k := range crdKinds {
+		expected := "/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions//" + k.Plural + ".kops.k8s.io"
+		found := false
+		for _, key := range server.Keys() {
+			found = found || key == expected
+		}
+		if !found {
+			t.Errorf("CustomResourceDefinition %s was not registered: %v", expected, server.Keys())
+		}
+	}
+
+	// Registering the CustomResourceDefinitions again is a no-op
+	if _, err := NewCRDClientset(server.Config()); err != nil {
+		t.Fatalf("error building second clientset: %v", err)
+	}
+
+	watcher, err := clientset.WatchClusters(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("error watching clusters: %v", err)
+	}
+	defer watcher.Stop()
+
+	cluster := buildTestCluster()
+	if _, err := clientset.CreateCluster(cluster); err == nil || !strings.Contains(err.Error(), "configBase") {
+		t.Errorf("expected error creating cluster without configBase, got %v", err)
+	}
+
+	clientset.ConfigBase, _ = vfs.Context.BuildVfsPath("memfs://clusters")
+	configBase, err := clientset.ConfigBaseFor(cluster)
+	if err != nil {
+		t.Fatalf("error building configBase: %v", err)
+	}
+	if configBase.Path() != "memfs://clusters/cluster.example.com" {
+		t.Errorf("unexpected configBase %q", configBase.Path())
+	}
+	cluster.Spec.ConfigBase = configBase.Path()
+
+	if _, err := clientset.CreateCluster(cluster); err != nil {
+		t.Fatalf("error creating cluster: %v", err)
+	}
+
+	event := nextEvent(t, watcher)
+	if event.Type != watch.Added || event.Object.(*kops.Cluster).Name != cluster.Name {
+		t.Errorf("unexpected watch event %v", event)
+	}
+
+	loaded, err := clientset.GetCluster(cluster.Name)
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	if loaded.Spec.KubernetesVersion != "1.9.3" || loaded.Spec.ConfigBase != cluster.Spec.ConfigBase || loaded.Spec.Networking.Kubenet == nil {
+		t.Errorf("cluster did not round-trip: %v", loaded.Spec)
+	}
+	if loaded.Namespace != "cluster-example-com" {
+		t.Errorf("unexpected namespace %q", loaded.Namespace)
+	}
+
+	loaded.Spec.KubernetesVersion = "1.9.4"
+	if _, err := clientset.UpdateCluster(loaded, nil); err != nil {
+		t.Fatalf("error updating cluster: %v", err)
+	}
+	event = nextEvent(t, watcher)
+	if event.Type != watch.Modified || event.Object.(*kops.Cluster).Spec.KubernetesVersion != "1.9.4" {
+		t.Errorf("unexpected watch event %v", event)
+	}
+
+	clusters, err := clientset.ListClusters(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("error listing clusters: %v", err)
+	}
+	if len(clusters.Items) != 1 || clusters.Items[0].Name != cluster.Name {
+		t.Errorf("unexpected clusters %v", clusters.Items)
+	}
+
+	ig := &kops.InstanceGroup{}
+	ig.Name = "nodes"
+	ig.Spec.Role = kops.InstanceGroupRoleNode
+	if _, err := clientset.InstanceGroupsFor(cluster).Create(ig); err != nil {
+		t.Fatalf("error creating instance group: %v", err)
+	}
+
+	secretStore, err := clientset.SecretStore(cluster)
+	if err != nil {
+		t.Fatalf("error building secret store: %v", err)
+	}
+	for _, name := range []string{"kube", "system:dns", "kubelet"} {
+		if _, _, err := secretStore.GetOrCreateSecret(name, &fi.Secret{Data: []byte(name)}); err != nil {
+			t.Fatalf("error creating secret %q: %v", name, err)
+		}
+	}
+	if _, err := secretStore.ReplaceSecret("kube", &fi.Secret{Data: []byte("replaced")}); err != nil {
+		t.Fatalf("error replacing secret: %v", err)
+	}
+	secretNames, err := secretStore.ListSecrets()
+	if err != nil {
+		t.Fatalf("error listing secrets: %v", err)
+	}
+	sort.Strings(secretNames)
+	if strings.Join(secretNames, ",") != "kube,kubelet,system:dns" {
+		t.Errorf("unexpected secrets %v", secretNames)
+	}
+	if secret, err := secretStore.FindSecret("kube"); err != nil || secret == nil || string(secret.Data) != "replaced" {
+		t.Errorf("unexpected secret %v: %v", secret, err)
+	}
+
+	sshCredentialStore, err := clientset.SSHCredentialStore(cluster)
+	if err != nil {
+		t.Fatalf("error building SSH credential store: %v", err)
+	}
+	if err := sshCredentialStore.AddSSHPublicKey("admin", []byte("ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQCtWu40XQo8dczLsCq0OWV+hxm9uV3WxeH9Kgh4sMzQxNtoU1pvW0XdjpkBesRKGoolfWeCLXWxpyQb1IaiMkKoz7MdhQ/6UKjMjP66aFWWp3pwD0uj0HuJ7tq4gKHKRYGTaZIRWpzUiANBrjugVgA+Sd7E/mYwc/DMXkIyRZbvhQ== test@example.com")); err != nil {
+		t.Fatalf("error adding SSH public key: %v", err)
+	}
+
+	keyStore, err := clientset.KeyStore(cluster)
+	if err != nil {
+		t.Fatalf("error building key store: %v", err)
+	}
+	keysets, err := keyStore.ListKeysets()
+	if err != nil {
+		t.Fatalf("error listing keysets: %v", err)
+	}
+	if len(keysets) != 0 {
+		t.Errorf("secrets were listed as keysets: %v", keysets)
+	}
+
+	configPath, _ := vfs.Context.BuildVfsPath("memfs://clusters/cluster.example.com/cluster.spec")
+	if err := configPath.WriteFile(bytes.NewReader([]byte("{}")), nil); err != nil {
+		t.Fatalf("error writing %s: %v", configPath, err)
+	}
+
+	if err := clientset.DeleteCluster(loaded); err != nil {
+		t.Fatalf("error deleting cluster: %v", err)
+	}
+	for _, key := range server.Keys() {
+		if !strings.HasPrefix(key, "/apis/apiextensions.k8s.io/") {
+			t.Errorf("object %s was not deleted with the cluster", key)
+		}
+	}
+	if _, err := configPath.ReadFile(); err == nil {
+		t.Errorf("%s was not deleted with the cluster", configPath)
+	}
+	event = nextEvent(t, watcher)
+	if event.Type != watch.Deleted {
+		t.Errorf("unexpected watch event %v", event)
+	}
+}
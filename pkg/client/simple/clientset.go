@@ -18,6 +18,7 @@ package simple
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/kops/pkg/apis/kops"
 	kopsinternalversion "k8s.io/kops/pkg/client/clientset_generated/clientset/typed/kops/internalversion"
 	"k8s.io/kops/upup/pkg/fi"
@@ -37,6 +38,15 @@ type Clientset interface {
 	// ListClusters returns all clusters
 	ListClusters(options metav1.ListOptions) (*kops.ClusterList, error)
 
+	// WatchClusters watches for changes to clusters; it is not supported by every state store
+	WatchClusters(options metav1.ListOptions) (watch.Interface, error)
+
+	// ListClusterRevisions returns the recorded revisions of a cluster, oldest first
+	ListClusterRevisions(name string) ([]*Revision, error)
+
+	// GetClusterRevision reads a cluster as it was at the specified revision
+	GetClusterRevision(name string, revision int) (*kops.Cluster, error)
+
 	// ConfigBaseFor returns the vfs path where we will read configuration information from
 	ConfigBaseFor(cluster *kops.Cluster) (vfs.Path, error)
 
@@ -0,0 +1,35 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simple
+
+import (
+	"time"
+)
+
+// Revision is a version of a Cluster or InstanceGroup, recorded each time it is written to the state store
+type Revision struct {
+	// Revision is the number of the revision, starting at 1
+	Revision int `json:"revision"`
+	// Author identifies who wrote the revision, as user@host
+	Author string `json:"author,omitempty"`
+	// Timestamp is the time the revision was written
+	Timestamp time.Time `json:"timestamp"`
+	// Diff is the change from the previous revision
+	Diff string `json:"diff,omitempty"`
+	// Object is the object as it was written to the state store, in versioned YAML
+	Object string `json:"object"`
+}
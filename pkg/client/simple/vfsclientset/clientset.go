@@ -21,10 +21,12 @@ import (
 	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/apis/kops/registry"
 	kopsinternalversion "k8s.io/kops/pkg/client/clientset_generated/clientset/typed/kops/internalversion"
 	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/pkg/envelope"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/secrets"
 	"k8s.io/kops/util/pkg/vfs"
@@ -61,6 +63,22 @@ func (c *VFSClientset) ListClusters(options metav1.ListOptions) (*kops.ClusterLi
 	return c.clusters().List(options)
 }
 
+// WatchClusters implements the WatchClusters method of simple.Clientset for a VFS-backed state store;
+// a VFS state store cannot be watched, so callers must poll it
+func (c *VFSClientset) WatchClusters(options metav1.ListOptions) (watch.Interface, error) {
+	return nil, fmt.Errorf("watching clusters is not supported for a VFS state store")
+}
+
+// ListClusterRevisions implements the ListClusterRevisions method of simple.Clientset for a VFS-backed state store
+func (c *VFSClientset) ListClusterRevisions(name string) ([]*simple.Revision, error) {
+	return c.clusters().ListRevisions(name)
+}
+
+// GetClusterRevision implements the GetClusterRevision method of simple.Clientset for a VFS-backed state store
+func (c *VFSClientset) GetClusterRevision(name string, revision int) (*kops.Cluster, error) {
+	return c.clusters().GetRevision(name, revision)
+}
+
 // ConfigBaseFor implements the ConfigBaseFor method of simple.Clientset for a VFS-backed state store
 func (c *VFSClientset) ConfigBaseFor(cluster *kops.Cluster) (vfs.Path, error) {
 	if cluster.Spec.ConfigBase != "" {
@@ -80,6 +98,14 @@ func (c *VFSClientset) SecretStore(cluster *kops.Cluster) (fi.SecretStore, error
 		return nil, err
 	}
 	basedir := configBase.Join("secrets")
+
+	encrypter, err := envelope.StoreEncrypter(cluster.Spec.SecretStore)
+	if err != nil {
+		return nil, err
+	}
+	if encrypter != nil {
+		return secrets.NewEncryptedVFSSecretStore(cluster, basedir, encrypter), nil
+	}
 	return secrets.NewVFSSecretStore(cluster, basedir), nil
 }
 
@@ -89,7 +115,14 @@ func (c *VFSClientset) KeyStore(cluster *kops.Cluster) (fi.CAStore, error) {
 		return nil, err
 	}
 	basedir := configBase.Join("pki")
-	return fi.NewVFSCAStore(cluster, basedir, c.allowList), nil
+
+	encrypter, err := envelope.StoreEncrypter(cluster.Spec.KeyStore)
+	if err != nil {
+		return nil, err
+	}
+	keyStore := fi.NewVFSCAStore(cluster, basedir, c.allowList)
+	keyStore.Encrypter = encrypter
+	return keyStore, nil
 }
 
 func (c *VFSClientset) SSHCredentialStore(cluster *kops.Cluster) (fi.SSHCredentialStore, error) {
@@ -112,7 +145,7 @@ func DeleteAllClusterState(basePath vfs.Path) error {
 		if err != nil {
 			return err
 		}
-		if relativePath == "config" || relativePath == "cluster.spec" {
+		if relativePath == "config" || relativePath == "cluster.spec" || relativePath == registry.PathMoved || relativePath == registry.PathLock || relativePath == vfs.SealManifestName {
 			continue
 		}
 		if strings.HasPrefix(relativePath, "addons/") {
@@ -127,6 +160,12 @@ func DeleteAllClusterState(basePath vfs.Path) error {
 		if strings.HasPrefix(relativePath, "instancegroup/") {
 			continue
 		}
+		if strings.HasPrefix(relativePath, "rollingupdate/") {
+			continue
+		}
+		if strings.HasPrefix(relativePath, PathHistory+"/") {
+			continue
+		}
 
 		return fmt.Errorf("refusing to delete: unknown file found: %s", path)
 	}
@@ -33,6 +33,7 @@ import (
 	"k8s.io/kops/pkg/apis/kops/registry"
 	"k8s.io/kops/pkg/apis/kops/v1alpha1"
 	"k8s.io/kops/pkg/apis/kops/validation"
+	"k8s.io/kops/pkg/client/simple"
 	"k8s.io/kops/util/pkg/vfs"
 )
 
@@ -45,6 +46,9 @@ func newClusterVFS(basePath vfs.Path) *ClusterVFS {
 	c.init("Cluster", basePath, StoreVersion)
 	defaultReadVersion := v1alpha1.SchemeGroupVersion.WithKind("Cluster")
 	c.defaultReadVersion = &defaultReadVersion
+	c.historyPath = func(name string) vfs.Path {
+		return basePath.Join(name, PathHistory, "cluster")
+	}
 	return c
 }
 
@@ -141,7 +145,7 @@ func (r *ClusterVFS) Update(c *api.Cluster, status *api.ClusterStatus) (*api.Clu
 	}
 
 	if err := r.writeConfig(c, r.basePath.Join(clusterName, registry.PathCluster), c, vfs.WriteOptionOnlyIfExists); err != nil {
-		if os.IsNotExist(err) {
+		if os.IsNotExist(err) || errors.IsConflict(err) {
 			return nil, err
 		}
 		return nil, fmt.Errorf("error writing Cluster: %v", err)
@@ -179,6 +183,14 @@ func (r *ClusterVFS) find(clusterName string) (*api.Cluster, error) {
 	}
 	configPath := r.basePath.Join(clusterName, registry.PathCluster)
 
+	moved, err := registry.ReadMovedMarker(r.basePath.Join(clusterName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster configuration %q: %v", clusterName, err)
+	}
+	if moved != nil {
+		return nil, fmt.Errorf("cluster %q was moved to state store %q; use --state=%s or set KOPS_STATE_STORE", clusterName, moved.StateStore, moved.StateStore)
+	}
+
 	o, err := r.readConfig(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -188,7 +200,14 @@ func (r *ClusterVFS) find(clusterName string) (*api.Cluster, error) {
 	}
 
 	c := o.(*api.Cluster)
+	if err := r.setDefaults(clusterName, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
+// setDefaults fills in the fields of a cluster read from the state store that are implied by its location
+func (r *ClusterVFS) setDefaults(clusterName string, c *api.Cluster) error {
 	if c.ObjectMeta.Name == "" {
 		c.ObjectMeta.Name = clusterName
 	}
@@ -200,11 +219,45 @@ func (r *ClusterVFS) find(clusterName string) (*api.Cluster, error) {
 	if c.Spec.ConfigBase == "" {
 		configBase, err := r.configBase(clusterName)
 		if err != nil {
-			return nil, fmt.Errorf("error building ConfigBase for cluster: %v", err)
+			return fmt.Errorf("error building ConfigBase for cluster: %v", err)
 		}
 		c.Spec.ConfigBase = configBase.Path()
 	}
 
+	return nil
+}
+
+// ListRevisions returns the recorded revisions of the cluster, oldest first
+func (r *ClusterVFS) ListRevisions(clusterName string) ([]*simple.Revision, error) {
+	if clusterName == "" {
+		return nil, fmt.Errorf("clusterName is required")
+	}
+	return readRevisions(r.historyPath(clusterName))
+}
+
+// GetRevision reads the cluster as it was at the specified revision
+func (r *ClusterVFS) GetRevision(clusterName string, revision int) (*api.Cluster, error) {
+	if clusterName == "" {
+		return nil, fmt.Errorf("clusterName is required")
+	}
+
+	p := revisionPath(r.historyPath(clusterName), revision)
+	recorded, err := readRevision(p)
+	if err != nil {
+		return nil, err
+	}
+	if recorded == nil {
+		return nil, fmt.Errorf("revision %d of cluster %q not found", revision, clusterName)
+	}
+
+	o, _, err := r.decoder.Decode([]byte(recorded.Object), r.defaultReadVersion, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing revision %d of cluster %q: %v", revision, clusterName, err)
+	}
+	c := o.(*api.Cluster)
+	if err := r.setDefaults(clusterName, c); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
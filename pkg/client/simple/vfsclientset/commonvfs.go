@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -48,6 +49,9 @@ type commonVFS struct {
 	encoder            runtime.Encoder
 	defaultReadVersion *schema.GroupVersionKind
 	validate           ValidationFunction
+
+	// historyPath returns the directory where the revisions of the named object are recorded; if nil, revisions are not recorded
+	historyPath func(name string) vfs.Path
 }
 
 func (c *commonVFS) init(kind string, basePath vfs.Path, storeVersion runtime.GroupVersioner) {
@@ -108,8 +112,17 @@ func (c *commonVFS) create(cluster *kops.Cluster, i runtime.Object) error {
 }
 
 func (c *commonVFS) serialize(o runtime.Object) ([]byte, error) {
+	// The ResourceVersion is the version of the file in the state store, so it is not stored in the file
+	objectMeta, err := meta.Accessor(o)
+	if err != nil {
+		return nil, err
+	}
+	resourceVersion := objectMeta.GetResourceVersion()
+	objectMeta.SetResourceVersion("")
+	defer objectMeta.SetResourceVersion(resourceVersion)
+
 	var b bytes.Buffer
-	err := c.encoder.Encode(o, &b)
+	err = c.encoder.Encode(o, &b)
 	if err != nil {
 		return nil, fmt.Errorf("error encoding object: %v", err)
 	}
@@ -118,7 +131,7 @@ func (c *commonVFS) serialize(o runtime.Object) ([]byte, error) {
 }
 
 func (c *commonVFS) readConfig(configPath vfs.Path) (runtime.Object, error) {
-	data, err := configPath.ReadFile()
+	data, version, err := vfs.ReadFileVersion(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, err
@@ -130,22 +143,40 @@ func (c *commonVFS) readConfig(configPath vfs.Path) (runtime.Object, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error parsing %s: %v", configPath, err)
 	}
+
+	objectMeta, err := meta.Accessor(object)
+	if err != nil {
+		return nil, err
+	}
+	objectMeta.SetResourceVersion(version)
+
 	return object, nil
 }
 
+// writeConfig writes the object to configPath.  When updating with WriteOptionOnlyIfExists, if the object has a ResourceVersion,
+// the file is only written if it has not changed since the object was read; otherwise a Conflict error is returned.
+// The ResourceVersion of the object is set to the version that was written, so that it can be updated again.
 func (c *commonVFS) writeConfig(cluster *kops.Cluster, configPath vfs.Path, o runtime.Object, writeOptions ...vfs.WriteOption) error {
+	objectMeta, err := meta.Accessor(o)
+	if err != nil {
+		return err
+	}
+
 	data, err := c.serialize(o)
 	if err != nil {
 		return fmt.Errorf("error marshalling object: %v", err)
 	}
 
 	create := false
+	onlyIfExists := false
+	var previous []byte
 	for _, writeOption := range writeOptions {
 		switch writeOption {
 		case vfs.WriteOptionCreate:
 			create = true
 		case vfs.WriteOptionOnlyIfExists:
-			_, err = configPath.ReadFile()
+			onlyIfExists = true
+			previous, err = configPath.ReadFile()
 			if err != nil {
 				if os.IsNotExist(err) {
 					return fmt.Errorf("cannot update configuration file %s: does not exist", configPath)
@@ -156,6 +187,12 @@ func (c *commonVFS) writeConfig(cluster *kops.Cluster, configPath vfs.Path, o ru
 			return fmt.Errorf("unknown write option: %q", writeOption)
 		}
 	}
+	if !create && previous == nil && c.historyPath != nil {
+		previous, err = configPath.ReadFile()
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error reading configuration file %s: %v", configPath, err)
+		}
+	}
 
 	acl, err := acls.GetACL(configPath, cluster)
 	if err != nil {
@@ -163,18 +200,31 @@ func (c *commonVFS) writeConfig(cluster *kops.Cluster, configPath vfs.Path, o ru
 	}
 
 	rs := bytes.NewReader(data)
+	var version string
 	if create {
-		err = configPath.CreateFile(rs, acl)
+		version, err = vfs.CreateFileVersion(configPath, rs, acl)
+	} else if onlyIfExists {
+		version, err = vfs.WriteFileVersion(configPath, rs, acl, objectMeta.GetResourceVersion())
 	} else {
-		err = configPath.WriteFile(rs, acl)
+		version, err = vfs.WriteFileVersion(configPath, rs, acl, "")
 	}
 	if err != nil {
 		if create && os.IsExist(err) {
 			glog.Warningf("failed to create file as already exists: %v", configPath)
 			return err
 		}
+		if vfs.IsConflict(err) {
+			return errors.NewConflict(schema.GroupResource{Group: kops.GroupName, Resource: c.kind}, objectMeta.GetName(), fmt.Errorf("the object has been modified since it was read; please apply your changes to the latest version and try again"))
+		}
 		return fmt.Errorf("error writing configuration file %s: %v", configPath, err)
 	}
+	objectMeta.SetResourceVersion(version)
+
+	if c.historyPath != nil {
+		if err := recordRevision(cluster, c.historyPath(objectMeta.GetName()), previous, data); err != nil {
+			glog.Warningf("%s %q was written, but the revision could not be recorded: %v", c.kind, objectMeta.GetName(), err)
+		}
+	}
 	return nil
 }
 
@@ -198,6 +248,9 @@ func (c *commonVFS) update(cluster *kops.Cluster, i runtime.Object) error {
 
 	err = c.writeConfig(cluster, c.basePath.Join(objectMeta.GetName()), i, vfs.WriteOptionOnlyIfExists)
 	if err != nil {
+		if errors.IsConflict(err) {
+			return err
+		}
 		return fmt.Errorf("error writing %s: %v", c.kind, err)
 	}
 
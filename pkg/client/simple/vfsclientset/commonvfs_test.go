@@ -0,0 +1,151 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfsclientset
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestConcurrentUpdateConflicts(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+	basePath, err := vfs.Context.BuildVfsPath("memfs://state")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+
+	clusters := newClusterVFS(basePath)
+	configPath := basePath.Join("cluster.example.com", registry.PathCluster)
+
+	cluster := &kops.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+		Spec:       kops.ClusterSpec{KubernetesVersion: "1.8.0"},
+	}
+	if err := clusters.writeConfig(cluster, configPath, cluster, vfs.WriteOptionCreate); err != nil {
+		t.Fatalf("error creating cluster: %v", err)
+	}
+
+	first, err := clusters.Get("cluster.example.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	second, err := clusters.Get("cluster.example.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	if first.ObjectMeta.ResourceVersion == "" || first.ObjectMeta.ResourceVersion != second.ObjectMeta.ResourceVersion {
+		t.Fatalf("unexpected resourceVersions %q and %q", first.ObjectMeta.ResourceVersion, second.ObjectMeta.ResourceVersion)
+	}
+
+	first.Spec.KubernetesVersion = "1.9.0"
+	if err := clusters.writeConfig(first, configPath, first, vfs.WriteOptionOnlyIfExists); err != nil {
+		t.Fatalf("error updating cluster: %v", err)
+	}
+	if first.ObjectMeta.ResourceVersion == second.ObjectMeta.ResourceVersion {
+		t.Errorf("resourceVersion was not updated by write")
+	}
+
+	// The second writer read the cluster before the first wrote it
+	second.Spec.KubernetesVersion = "1.10.0"
+	err = clusters.writeConfig(second, configPath, second, vfs.WriteOptionOnlyIfExists)
+	if !errors.IsConflict(err) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+
+	current, err := clusters.Get("cluster.example.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	if current.Spec.KubernetesVersion != "1.9.0" {
+		t.Errorf("expected the first write to be kept, got kubernetesVersion %q", current.Spec.KubernetesVersion)
+	}
+	if current.ObjectMeta.ResourceVersion != first.ObjectMeta.ResourceVersion {
+		t.Errorf("expected resourceVersion %q, got %q", first.ObjectMeta.ResourceVersion, current.ObjectMeta.ResourceVersion)
+	}
+
+	// The resourceVersion is not stored in the configuration
+	data, err := configPath.ReadFile()
+	if err != nil {
+		t.Fatalf("error reading configuration: %v", err)
+	}
+	if strings.Contains(string(data), "resourceVersion") {
+		t.Errorf("resourceVersion was stored in the configuration:\n%s", data)
+	}
+
+	// An update without a resourceVersion is not checked
+	second.ObjectMeta.ResourceVersion = ""
+	if err := clusters.writeConfig(second, configPath, second, vfs.WriteOptionOnlyIfExists); err != nil {
+		t.Errorf("unexpected error writing without resourceVersion: %v", err)
+	}
+}
+
+func TestUpdateAfterCreateConflicts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	vfs.Context.ResetMemfsContext(true)
+	memfsPath, err := vfs.Context.BuildVfsPath("memfs://state")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+
+	for _, basePath := range []vfs.Path{memfsPath, vfs.NewFSPath(dir)} {
+		clusters := newClusterVFS(basePath)
+		configPath := basePath.Join("cluster.example.com", registry.PathCluster)
+
+		created := &kops.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+			Spec:       kops.ClusterSpec{KubernetesVersion: "1.8.0"},
+		}
+		if err := clusters.writeConfig(created, configPath, created, vfs.WriteOptionCreate); err != nil {
+			t.Fatalf("error creating cluster in %s: %v", basePath, err)
+		}
+		if created.ObjectMeta.ResourceVersion == "" {
+			t.Fatalf("resourceVersion was not set by create in %s", basePath)
+		}
+
+		other, err := clusters.Get("cluster.example.com", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("error reading cluster from %s: %v", basePath, err)
+		}
+		if other.ObjectMeta.ResourceVersion != created.ObjectMeta.ResourceVersion {
+			t.Errorf("expected resourceVersion %q after create in %s, got %q", created.ObjectMeta.ResourceVersion, basePath, other.ObjectMeta.ResourceVersion)
+		}
+		other.Spec.KubernetesVersion = "1.9.0"
+		if err := clusters.writeConfig(other, configPath, other, vfs.WriteOptionOnlyIfExists); err != nil {
+			t.Fatalf("error updating cluster in %s: %v", basePath, err)
+		}
+
+		// The creator did not read the update
+		created.Spec.KubernetesVersion = "1.10.0"
+		err = clusters.writeConfig(created, configPath, created, vfs.WriteOptionOnlyIfExists)
+		if !errors.IsConflict(err) {
+			t.Errorf("expected conflict updating the created cluster in %s, got %v", basePath, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfsclientset
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/pkg/diff"
+	"k8s.io/kops/upup/pkg/fi/utils"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// PathHistory is the directory under the ConfigBase of a cluster where the revisions of the cluster
+// and its instance groups are recorded, in cluster/<revision> and instancegroup/<name>/<revision>
+const PathHistory = "history"
+
+// revisionHistoryLimit is the number of revisions kept for each object; the oldest revisions are removed
+// when a new revision is recorded.  It is a variable so that tests can lower it.
+var revisionHistoryLimit = 100
+
+// revisionFile is a revision recorded in the history, which has not been read
+type revisionFile struct {
+	Revision int
+	Path     vfs.Path
+}
+
+// revisionPath returns the path of a revision.  The revision number is zero-padded, so that the names
+// of the revisions sort in order.
+func revisionPath(historyPath vfs.Path, revision int) vfs.Path {
+	return historyPath.Join(fmt.Sprintf("%010d", revision))
+}
+
+// listRevisionFiles lists the revisions recorded in historyPath, oldest first, without reading them
+func listRevisionFiles(historyPath vfs.Path) ([]*revisionFile, error) {
+	files, err := historyPath.ReadDir()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error listing revisions in %s: %v", historyPath, err)
+	}
+
+	var revisionFiles []*revisionFile
+	for _, f := range files {
+		revision, err := strconv.Atoi(f.Base())
+		if err != nil {
+			continue
+		}
+		revisionFiles = append(revisionFiles, &revisionFile{Revision: revision, Path: f})
+	}
+
+	sort.Slice(revisionFiles, func(i, j int) bool {
+		return revisionFiles[i].Revision < revisionFiles[j].Revision
+	})
+	return revisionFiles, nil
+}
+
+// readRevisions returns the revisions recorded in historyPath, oldest first
+func readRevisions(historyPath vfs.Path) ([]*simple.Revision, error) {
+	files, err := listRevisionFiles(historyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []*simple.Revision
+	for _, f := range files {
+		revision, err := readRevision(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if revision == nil {
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// readRevision reads a recorded revision, returning nil if it does not exist
+func readRevision(p vfs.Path) (*simple.Revision, error) {
+	revision := &simple.Revision{}
+	if err := registry.ReadConfigDeprecated(p, revision); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading revision %s: %v", p, err)
+	}
+	return revision, nil
+}
+
+// recordRevision records data as a new revision in historyPath, unless it is unchanged from the latest revision.
+// previous is the object that data replaced, or nil if it was created; when nothing has been recorded yet,
+// previous is recorded first, so that objects written before revisions were recorded can be rolled back.
+func recordRevision(cluster *kops.Cluster, historyPath vfs.Path, previous []byte, data []byte) error {
+	files, err := listRevisionFiles(historyPath)
+	if err != nil {
+		return err
+	}
+
+	// Only the latest revision is read, to compare it with data
+	var latest *simple.Revision
+	if len(files) != 0 {
+		f := files[len(files)-1]
+		latest, err = readRevision(f.Path)
+		if err != nil {
+			return err
+		}
+		if latest == nil {
+			return fmt.Errorf("revision %d was removed concurrently from %s", f.Revision, historyPath)
+		}
+	} else if previous != nil {
+		latest = &simple.Revision{
+			Revision:  1,
+			Timestamp: time.Now().UTC(),
+			Object:    string(previous),
+		}
+		if err := writeRevision(cluster, historyPath, latest); err != nil {
+			return err
+		}
+		files = append(files, &revisionFile{Revision: latest.Revision, Path: revisionPath(historyPath, latest.Revision)})
+	}
+
+	if latest != nil && latest.Object == string(data) {
+		return nil
+	}
+
+	revision := &simple.Revision{
+		Revision:  1,
+		Author:    utils.UserAtHost(),
+		Timestamp: time.Now().UTC(),
+		Object:    string(data),
+	}
+	if latest != nil {
+		revision.Revision = latest.Revision + 1
+		revision.Diff = diff.FormatDiff(latest.Object, revision.Object)
+	}
+	if err := writeRevision(cluster, historyPath, revision); err != nil {
+		return err
+	}
+	files = append(files, &revisionFile{Revision: revision.Revision, Path: revisionPath(historyPath, revision.Revision)})
+
+	return pruneRevisions(files, revisionHistoryLimit)
+}
+
+func writeRevision(cluster *kops.Cluster, historyPath vfs.Path, revision *simple.Revision) error {
+	p := revisionPath(historyPath, revision.Revision)
+	if err := registry.WriteConfigDeprecated(cluster, p, revision, vfs.WriteOptionCreate); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("revision %d was recorded concurrently in %s", revision.Revision, historyPath)
+		}
+		return fmt.Errorf("error recording revision %d in %s: %v", revision.Revision, historyPath, err)
+	}
+	return nil
+}
+
+// pruneRevisions removes the oldest of the revision files, oldest first, so that at most limit are kept
+func pruneRevisions(files []*revisionFile, limit int) error {
+	for len(files) > limit {
+		f := files[0]
+		if err := f.Path.Remove(); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing revision %d from history: %v", f.Revision, err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfsclientset
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestClusterRevisions(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+	basePath, err := vfs.Context.BuildVfsPath("memfs://state")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+
+	clusters := newClusterVFS(basePath)
+	configPath := basePath.Join("cluster.example.com", registry.PathCluster)
+
+	cluster := &kops.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+		Spec:       kops.ClusterSpec{KubernetesVersion: "1.8.0"},
+	}
+	if err := clusters.writeConfig(cluster, configPath, cluster, vfs.WriteOptionCreate); err != nil {
+		t.Fatalf("error creating cluster: %v", err)
+	}
+
+	cluster.Spec.KubernetesVersion = "1.9.0"
+	if err := clusters.writeConfig(cluster, configPath, cluster, vfs.WriteOptionOnlyIfExists); err != nil {
+		t.Fatalf("error updating cluster: %v", err)
+	}
+
+	// Writing an unchanged cluster does not record a revision
+	if err := clusters.writeConfig(cluster, configPath, cluster, vfs.WriteOptionOnlyIfExists); err != nil {
+		t.Fatalf("error updating cluster: %v", err)
+	}
+
+	revisions, err := clusters.ListRevisions("cluster.example.com")
+	if err != nil {
+		t.Fatalf("error listing revisions: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(revisions))
+	}
+	if revisions[0].Revision != 1 || revisions[0].Diff != "" || revisions[0].Author == "" {
+		t.Errorf("unexpected first revision: %+v", revisions[0])
+	}
+	if revisions[1].Revision != 2 || !strings.Contains(revisions[1].Diff, "-   kubernetesVersion: 1.8.0") || !strings.Contains(revisions[1].Diff, "+   kubernetesVersion: 1.9.0") {
+		t.Errorf("unexpected diff in second revision: %q", revisions[1].Diff)
+	}
+
+	first, err := clusters.GetRevision("cluster.example.com", 1)
+	if err != nil {
+		t.Fatalf("error reading revision: %v", err)
+	}
+	if first.Spec.KubernetesVersion != "1.8.0" {
+		t.Errorf("expected kubernetesVersion 1.8.0 at revision 1, got %q", first.Spec.KubernetesVersion)
+	}
+	if first.Spec.ConfigBase != "memfs://state/cluster.example.com" {
+		t.Errorf("expected ConfigBase to be defaulted, got %q", first.Spec.ConfigBase)
+	}
+
+	if _, err := clusters.GetRevision("cluster.example.com", 3); err == nil {
+		t.Errorf("expected error reading a revision that does not exist")
+	}
+}
+
+func TestRevisionsOfExistingCluster(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+	basePath, err := vfs.Context.BuildVfsPath("memfs://state")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+
+	clusters := newClusterVFS(basePath)
+	configPath := basePath.Join("cluster.example.com", registry.PathCluster)
+
+	// A cluster written before revisions were recorded
+	cluster := &kops.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+		Spec:       kops.ClusterSpec{KubernetesVersion: "1.8.0"},
+	}
+	clusters.historyPath = nil
+	if err := clusters.writeConfig(cluster, configPath, cluster, vfs.WriteOptionCreate); err != nil {
+		t.Fatalf("error creating cluster: %v", err)
+	}
+
+	clusters = newClusterVFS(basePath)
+	cluster.Spec.KubernetesVersion = "1.9.0"
+	if err := clusters.writeConfig(cluster, configPath, cluster, vfs.WriteOptionOnlyIfExists); err != nil {
+		t.Fatalf("error updating cluster: %v", err)
+	}
+
+	revisions, err := clusters.ListRevisions("cluster.example.com")
+	if err != nil {
+		t.Fatalf("error listing revisions: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("expected the existing configuration to be recorded before the update, got %d revisions", len(revisions))
+	}
+	if revisions[0].Author != "" {
+		t.Errorf("expected no author for the existing configuration, got %q", revisions[0].Author)
+	}
+
+	first, err := clusters.GetRevision("cluster.example.com", 1)
+	if err != nil {
+		t.Fatalf("error reading revision: %v", err)
+	}
+	if first.Spec.KubernetesVersion != "1.8.0" {
+		t.Errorf("expected kubernetesVersion 1.8.0 at revision 1, got %q", first.Spec.KubernetesVersion)
+	}
+}
+
+func TestRevisionHistoryLimit(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+	basePath, err := vfs.Context.BuildVfsPath("memfs://state")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+
+	oldLimit := revisionHistoryLimit
+	defer func() { revisionHistoryLimit = oldLimit }()
+	revisionHistoryLimit = 3
+
+	clusters := newClusterVFS(basePath)
+	configPath := basePath.Join("cluster.example.com", registry.PathCluster)
+
+	cluster := &kops.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+		Spec:       kops.ClusterSpec{KubernetesVersion: "1.8.0"},
+	}
+	if err := clusters.writeConfig(cluster, configPath, cluster, vfs.WriteOptionCreate); err != nil {
+		t.Fatalf("error creating cluster: %v", err)
+	}
+	for i := 1; i <= 11; i++ {
+		cluster.Spec.KubernetesVersion = fmt.Sprintf("1.8.%d", i)
+		if err := clusters.writeConfig(cluster, configPath, cluster, vfs.WriteOptionOnlyIfExists); err != nil {
+			t.Fatalf("error updating cluster: %v", err)
+		}
+	}
+
+	revisions, err := clusters.ListRevisions("cluster.example.com")
+	if err != nil {
+		t.Fatalf("error listing revisions: %v", err)
+	}
+	var numbers []int
+	for _, r := range revisions {
+		numbers = append(numbers, r.Revision)
+	}
+	if fmt.Sprintf("%v", numbers) != "[10 11 12]" {
+		t.Fatalf("expected the latest 3 revisions to be kept, got %v", numbers)
+	}
+	if !strings.Contains(revisions[2].Diff, "+   kubernetesVersion: 1.8.11") {
+		t.Errorf("unexpected diff in latest revision: %q", revisions[2].Diff)
+	}
+
+	// Revision 10 sorts after revision 9 by name, so listing the history finds the latest revision
+	files, err := clusters.historyPath("cluster.example.com").ReadDir()
+	if err != nil {
+		t.Fatalf("error listing history: %v", err)
+	}
+	for _, f := range files {
+		if len(f.Base()) != 10 {
+			t.Errorf("expected zero-padded revision file name, got %q", f.Base())
+		}
+	}
+
+	if _, err := clusters.GetRevision("cluster.example.com", 1); err == nil {
+		t.Errorf("expected error reading a removed revision")
+	}
+}
@@ -60,6 +60,9 @@ func NewInstanceGroupMirror(cluster *kops.Cluster, configBase vfs.Path) Instance
 		clusterName: clusterName,
 	}
 	r.init(kind, configBase.Join("instancegroup"), StoreVersion)
+	r.historyPath = func(name string) vfs.Path {
+		return configBase.Join(PathHistory, "instancegroup", name)
+	}
 	defaultReadVersion := v1alpha1.SchemeGroupVersion.WithKind(kind)
 	r.defaultReadVersion = &defaultReadVersion
 	r.validate = func(o runtime.Object) error {
@@ -81,6 +84,9 @@ func newInstanceGroupVFS(c *VFSClientset, cluster *kops.Cluster) *InstanceGroupV
 		clusterName: clusterName,
 	}
 	r.init(kind, c.basePath.Join(clusterName, "instancegroup"), StoreVersion)
+	r.historyPath = func(name string) vfs.Path {
+		return c.basePath.Join(clusterName, PathHistory, "instancegroup", name)
+	}
 	defaultReadVersion := v1alpha1.SchemeGroupVersion.WithKind(kind)
 	r.defaultReadVersion = &defaultReadVersion
 	r.validate = func(o runtime.Object) error {
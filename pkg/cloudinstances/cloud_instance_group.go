@@ -33,6 +33,8 @@ type CloudInstanceGroup struct {
 	NeedUpdate    []*CloudInstanceGroupMember
 	MinSize       int
 	MaxSize       int
+	// TargetSize is the number of instances the cloud is currently trying to maintain in the group
+	TargetSize int
 
 	// Raw allows for the implementer to attach an object, for tracking additional state
 	Raw interface{}
@@ -0,0 +1,170 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"k8s.io/kops/pkg/acls"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/envelope"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// EncryptStatePlan describes encrypting the private keys and secrets that were written before encryption was enabled
+type EncryptStatePlan struct {
+	// Files are the private keys and secrets that are not encrypted
+	Files []*EncryptStateFile
+
+	cluster *kops.Cluster
+}
+
+// EncryptStateFile is a private key or secret that will be encrypted
+type EncryptStateFile struct {
+	Path vfs.Path
+
+	encrypter *envelope.Encrypter
+}
+
+// BuildEncryptStatePlan finds the private keys and secrets of the cluster that are not encrypted, although
+// the cluster spec configures their store to be encrypted
+func BuildEncryptStatePlan(cluster *kops.Cluster) (*EncryptStatePlan, error) {
+	configBase, err := registry.ConfigBase(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	stores := []struct {
+		Field    string
+		Location string
+		// Base is where the clientset keeps the store, under the ConfigBase
+		Base vfs.Path
+		// Encrypted is the directory of the store holding the encrypted files
+		Encrypted string
+	}{
+		{Field: "spec.keyStore", Location: cluster.Spec.KeyStore, Base: configBase.Join("pki"), Encrypted: "private"},
+		{Field: "spec.secretStore", Location: cluster.Spec.SecretStore, Base: configBase.Join("secrets")},
+	}
+
+	plan := &EncryptStatePlan{cluster: cluster}
+	encrypted := false
+	for _, store := range stores {
+		p, encrypter, err := envelope.BuildStorePath(store.Location)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", store.Field, err)
+		}
+		if encrypter == nil {
+			continue
+		}
+		encrypted = true
+
+		// The clientset keeps the store under the ConfigBase, and it is mirrored to the location in the spec, where nodeup reads it
+		dirs := []vfs.Path{store.Base}
+		if p.Path() != store.Base.Path() {
+			dirs = append(dirs, p)
+		}
+		for _, dir := range dirs {
+			if store.Encrypted != "" {
+				dir = dir.Join(store.Encrypted)
+			}
+			files, err := findPlaintextFiles(dir)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				plan.Files = append(plan.Files, &EncryptStateFile{Path: f, encrypter: encrypter})
+			}
+		}
+	}
+
+	if !encrypted {
+		return nil, fmt.Errorf("neither spec.keyStore nor spec.secretStore is encrypted; configure their key encryption key before encrypting the state")
+	}
+
+	sort.Slice(plan.Files, func(i, j int) bool { return plan.Files[i].Path.Path() < plan.Files[j].Path.Path() })
+	return plan, nil
+}
+
+// findPlaintextFiles returns the files under dir that are not encrypted
+func findPlaintextFiles(dir vfs.Path) ([]vfs.Path, error) {
+	files, err := dir.ReadTree()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading %s: %v", dir, err)
+	}
+
+	var plaintext []vfs.Path
+	for _, f := range files {
+		data, err := f.ReadFile()
+		if err != nil {
+			if os.IsNotExist(err) {
+				// A directory
+				continue
+			}
+			return nil, fmt.Errorf("error reading %s: %v", f, err)
+		}
+		if !envelope.IsEncrypted(data) {
+			plaintext = append(plaintext, f)
+		}
+	}
+	return plaintext, nil
+}
+
+// EncryptState encrypts the files of the plan in place, with the key encryption key of their store,
+// and checks that each file can be decrypted with it.  Files that were encrypted since the plan was built are left alone.
+func EncryptState(plan *EncryptStatePlan) error {
+	for _, f := range plan.Files {
+		data, err := f.Path.ReadFile()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", f.Path, err)
+		}
+		if envelope.IsEncrypted(data) {
+			continue
+		}
+
+		encrypted, err := f.encrypter.Encrypt(data)
+		if err != nil {
+			return fmt.Errorf("error encrypting %s: %v", f.Path, err)
+		}
+		acl, err := acls.GetACL(f.Path, plan.cluster)
+		if err != nil {
+			return err
+		}
+		if err := f.Path.WriteFile(bytes.NewReader(encrypted), acl); err != nil {
+			return fmt.Errorf("error writing %s: %v", f.Path, err)
+		}
+
+		written, err := f.Path.ReadFile()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", f.Path, err)
+		}
+		decrypted, err := f.encrypter.Decrypt(written)
+		if err != nil {
+			return fmt.Errorf("error verifying %s: %v", f.Path, err)
+		}
+		if !bytes.Equal(decrypted, data) {
+			return fmt.Errorf("%s did not decrypt to its original contents", f.Path)
+		}
+	}
+	return nil
+}
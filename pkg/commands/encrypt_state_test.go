@@ -0,0 +1,136 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/envelope"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestEncryptState(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	dir, err := ioutil.TempDir("", "encryptstate")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "kek")
+	if err := ioutil.WriteFile(keyPath, []byte(strings.Repeat("k", 32)), 0600); err != nil {
+		t.Fatalf("error writing key encryption key: %v", err)
+	}
+	kekURL := "file://" + keyPath
+	encrypter, err := envelope.NewEncrypter(kekURL)
+	if err != nil {
+		t.Fatalf("error building encrypter: %v", err)
+	}
+	alreadyEncrypted, err := encrypter.Encrypt([]byte("{\"Data\":\"a2V5\"}"))
+	if err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+
+	cluster := &kops.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+		Spec: kops.ClusterSpec{
+			ConfigBase:  "memfs://state/cluster.example.com",
+			KeyStore:    "encrypted+memfs://state/cluster.example.com/pki?kek=" + kekURL,
+			SecretStore: "encrypted+memfs://state/cluster.example.com/secrets?kek=" + kekURL,
+		},
+	}
+
+	files := map[string][]byte{
+		"pki/issued/ca/keyset.yaml":  []byte("certificate"),
+		"pki/private/ca/keyset.yaml": []byte("private key bundle"),
+		"pki/private/ca/1234.key":    []byte("private key"),
+		"secrets/admin":              []byte("{\"Data\":\"cGFzc3dvcmQ=\"}"),
+		"secrets/kube":               alreadyEncrypted,
+	}
+	for k, v := range files {
+		writeTestFile(t, "memfs://state/cluster.example.com/"+k, v)
+	}
+
+	plan, err := BuildEncryptStatePlan(cluster)
+	if err != nil {
+		t.Fatalf("error planning encryption: %v", err)
+	}
+	var planned []string
+	for _, f := range plan.Files {
+		planned = append(planned, f.Path.Path())
+	}
+	expected := []string{
+		"memfs://state/cluster.example.com/pki/private/ca/1234.key",
+		"memfs://state/cluster.example.com/pki/private/ca/keyset.yaml",
+		"memfs://state/cluster.example.com/secrets/admin",
+	}
+	if !reflect.DeepEqual(planned, expected) {
+		t.Fatalf("expected plan %v, got %v", expected, planned)
+	}
+
+	if err := EncryptState(plan); err != nil {
+		t.Fatalf("error encrypting state: %v", err)
+	}
+
+	for k, v := range files {
+		data := readTestFile(t, "memfs://state/cluster.example.com/"+k)
+		if strings.HasPrefix(k, "pki/issued/") || k == "secrets/kube" {
+			if string(data) != string(v) {
+				t.Errorf("%s was changed", k)
+			}
+			continue
+		}
+
+		decrypted, err := encrypter.Decrypt(data)
+		if err != nil {
+			t.Errorf("error decrypting %s: %v", k, err)
+		} else if string(decrypted) != string(v) {
+			t.Errorf("%s decrypted to %q, expected %q", k, decrypted, v)
+		}
+	}
+
+	// Nothing is left to encrypt
+	plan, err = BuildEncryptStatePlan(cluster)
+	if err != nil {
+		t.Fatalf("error planning encryption: %v", err)
+	}
+	if len(plan.Files) != 0 {
+		t.Errorf("expected no files to encrypt, got %d", len(plan.Files))
+	}
+}
+
+func TestEncryptStateRequiresEncryptedStore(t *testing.T) {
+	cluster := &kops.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+		Spec: kops.ClusterSpec{
+			ConfigBase:  "memfs://state/cluster.example.com",
+			KeyStore:    "memfs://state/cluster.example.com/pki",
+			SecretStore: "memfs://state/cluster.example.com/secrets",
+		},
+	}
+	if _, err := BuildEncryptStatePlan(cluster); err == nil {
+		t.Errorf("expected error encrypting the state of a cluster without encrypted stores")
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/acls"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/envelope"
+	"k8s.io/kops/pkg/kopscodecs"
+	"k8s.io/kops/util/pkg/hashing"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// MigrateStatePlan describes moving a cluster to another state store
+type MigrateStatePlan struct {
+	// Cluster is the cluster configuration, with its store locations rewritten for the new state store
+	Cluster *kops.Cluster
+	// NewStateStore is the state store the cluster is moved to
+	NewStateStore string
+
+	// Source is the location of the cluster in the current state store
+	Source vfs.Path
+	// Destination is the location of the cluster in the new state store
+	Destination vfs.Path
+
+	// Files are the paths of the files that will be copied, relative to Source
+	Files []string
+	// Changes describes the fields of the cluster spec that are rewritten
+	Changes []string
+	// Warnings describes store locations outside the cluster's ConfigBase, which are not moved
+	Warnings []string
+
+	original *kops.Cluster
+}
+
+// BuildMigrateStatePlan plans moving the cluster, which must be stored under its ConfigBase, to the new state store
+func BuildMigrateStatePlan(cluster *kops.Cluster, newStateStore string) (*MigrateStatePlan, error) {
+	source, err := registry.ConfigBase(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	newBase, err := vfs.Context.BuildVfsPath(newStateStore)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing state store %q: %v", newStateStore, err)
+	}
+	destination := newBase.Join(cluster.ObjectMeta.Name)
+
+	if destination.Path() == source.Path() {
+		return nil, fmt.Errorf("cluster %q is already stored at %s", cluster.ObjectMeta.Name, destination)
+	}
+
+	if _, err := destination.Join(registry.PathCluster).ReadFile(); err == nil {
+		return nil, fmt.Errorf("cluster %q already exists in state store %q", cluster.ObjectMeta.Name, newStateStore)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error checking for cluster in state store %q: %v", newStateStore, err)
+	}
+
+	plan := &MigrateStatePlan{
+		Cluster:       cluster.DeepCopy(),
+		NewStateStore: newStateStore,
+		Source:        source,
+		Destination:   destination,
+		original:      cluster,
+	}
+
+	// The resourceVersion is the version of the configuration in the current state store
+	plan.Cluster.ObjectMeta.ResourceVersion = ""
+	plan.Cluster.Spec.ConfigBase = destination.Path()
+	plan.Changes = append(plan.Changes, fmt.Sprintf("spec.configBase: %s -> %s", cluster.Spec.ConfigBase, destination.Path()))
+
+	stores := []struct {
+		Field    string
+		Location *string
+	}{
+		{Field: "spec.configStore", Location: &plan.Cluster.Spec.ConfigStore},
+		{Field: "spec.keyStore", Location: &plan.Cluster.Spec.KeyStore},
+		{Field: "spec.secretStore", Location: &plan.Cluster.Spec.SecretStore},
+	}
+	for _, store := range stores {
+		if *store.Location == "" {
+			continue
+		}
+		rewritten, changed, err := rewriteStoreLocation(*store.Location, source.Path(), destination.Path())
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", store.Field, err)
+		}
+		if !changed {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s %q is not under %s, and will not be moved", store.Field, *store.Location, source))
+			continue
+		}
+		plan.Changes = append(plan.Changes, fmt.Sprintf("%s: %s -> %s", store.Field, *store.Location, rewritten))
+		*store.Location = rewritten
+	}
+
+	files, err := source.ReadTree()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", source, err)
+	}
+	for _, f := range files {
+		relativePath, err := vfs.RelativePath(source, f)
+		if err != nil {
+			return nil, err
+		}
+		plan.Files = append(plan.Files, relativePath)
+	}
+	sort.Strings(plan.Files)
+
+	return plan, nil
+}
+
+// rewriteStoreLocation moves a store location under oldBase to the same path under newBase,
+// preserving the encryption settings of the store.  It returns false if the location is not under oldBase.
+func rewriteStoreLocation(location string, oldBase string, newBase string) (string, bool, error) {
+	p, kekURL, err := envelope.ParseStoreLocation(location)
+	if err != nil {
+		return "", false, err
+	}
+
+	p = strings.TrimSuffix(p, "/")
+	if p != oldBase && !strings.HasPrefix(p, oldBase+"/") {
+		return location, false, nil
+	}
+
+	return envelope.FormatStoreLocation(newBase+strings.TrimPrefix(p, oldBase), kekURL), true, nil
+}
+
+// MigrateState copies the files of the cluster to the new state store, verifying their hashes,
+// writes the rewritten cluster configuration, and leaves a marker at the old location pointing to the new state store.
+// The files at the old location are not removed, as the instances of the cluster read them until the cluster is updated.
+func MigrateState(plan *MigrateStatePlan) error {
+	for _, relativePath := range plan.Files {
+		src := plan.Source.Join(relativePath)
+		dest := plan.Destination.Join(relativePath)
+
+		if err := copyVerified(src, dest, plan.Cluster); err != nil {
+			return err
+		}
+	}
+
+	data, err := kopscodecs.ToVersionedYaml(plan.Cluster)
+	if err != nil {
+		return fmt.Errorf("error serializing cluster: %v", err)
+	}
+	configPath := plan.Destination.Join(registry.PathCluster)
+	acl, err := acls.GetACL(configPath, plan.Cluster)
+	if err != nil {
+		return err
+	}
+	if err := configPath.WriteFile(bytes.NewReader(data), acl); err != nil {
+		return fmt.Errorf("error writing cluster configuration to %s: %v", configPath, err)
+	}
+
+	marker := &registry.MovedMarker{
+		StateStore: plan.NewStateStore,
+		ConfigBase: plan.Cluster.Spec.ConfigBase,
+		Timestamp:  time.Now().UTC(),
+	}
+	if err := registry.WriteMovedMarker(plan.original, plan.Source, marker); err != nil {
+		return fmt.Errorf("error writing moved marker to %s: %v", plan.Source, err)
+	}
+
+	return nil
+}
+
+// copyVerified copies src to dest, and checks that the SHA256 hash of dest matches that of src
+func copyVerified(src vfs.Path, dest vfs.Path, cluster *kops.Cluster) error {
+	data, err := src.ReadFile()
+	if err != nil {
+		if os.IsNotExist(err) {
+			glog.Warningf("%s was removed before it could be copied", src)
+			return nil
+		}
+		return fmt.Errorf("error reading %s: %v", src, err)
+	}
+	srcHash, err := hashing.HashAlgorithmSHA256.Hash(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error hashing %s: %v", src, err)
+	}
+
+	acl, err := acls.GetACL(dest, cluster)
+	if err != nil {
+		return err
+	}
+
+	glog.V(2).Infof("Copying %s to %s", src, dest)
+	if err := dest.WriteFile(bytes.NewReader(data), acl); err != nil {
+		return fmt.Errorf("error writing %s: %v", dest, err)
+	}
+
+	copied, err := dest.ReadFile()
+	if err != nil {
+		return fmt.Errorf("error reading back %s: %v", dest, err)
+	}
+	destHash, err := hashing.HashAlgorithmSHA256.Hash(bytes.NewReader(copied))
+	if err != nil {
+		return fmt.Errorf("error hashing %s: %v", dest, err)
+	}
+	if !destHash.Equal(srcHash) {
+		return fmt.Errorf("hash of %s (%s) does not match hash of %s (%s)", dest, destHash.Hex(), src, srcHash.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/pkg/client/simple/api"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// MigrateStateToKubernetesPlan describes moving a cluster from a VFS state store to custom resources in a Kubernetes cluster
+type MigrateStateToKubernetesPlan struct {
+	// Cluster is the cluster configuration; its configBase is unchanged, as the instances of the cluster read their configuration from it
+	Cluster *kops.Cluster
+	// NewStateStore is the state store the cluster is moved to, of the form k8s://<context>
+	NewStateStore string
+
+	// Source is the location of the cluster in the current state store
+	Source vfs.Path
+
+	InstanceGroups []*kops.InstanceGroup
+	Keysets        []*kops.Keyset
+	SecretNames    []string
+	SSHCredentials []*kops.SSHCredential
+
+	// Warnings describes settings of the cluster that behave differently in the new state store
+	Warnings []string
+
+	original    *kops.Cluster
+	secrets     map[string]*fi.Secret
+	destination *api.CRDClientset
+}
+
+// BuildMigrateStateToKubernetesPlan plans copying the cluster and its instance groups, keysets, secrets and SSH keys
+// from the source clientset to the destination
+func BuildMigrateStateToKubernetesPlan(source simple.Clientset, cluster *kops.Cluster, destination *api.CRDClientset, newStateStore string) (*MigrateStateToKubernetesPlan, error) {
+	configBase, err := registry.ConfigBase(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := destination.GetCluster(cluster.ObjectMeta.Name); err == nil {
+		return nil, fmt.Errorf("cluster %q already exists in state store %q", cluster.ObjectMeta.Name, newStateStore)
+	} else if !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("error checking for cluster in state store %q: %v", newStateStore, err)
+	}
+
+	plan := &MigrateStateToKubernetesPlan{
+		Cluster:       cluster.DeepCopy(),
+		NewStateStore: newStateStore,
+		Source:        configBase,
+		original:      cluster,
+		secrets:       make(map[string]*fi.Secret),
+		destination:   destination,
+	}
+	plan.Cluster.ObjectMeta.ResourceVersion = ""
+
+	if cluster.Spec.KeyStore != "" {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("the keysets are copied from spec.keyStore %q, which is then only written as a mirror for the instances of the cluster", cluster.Spec.KeyStore))
+	}
+	if cluster.Spec.SecretStore != "" {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("the secrets are copied from spec.secretStore %q, which is then only written as a mirror for the instances of the cluster", cluster.Spec.SecretStore))
+	}
+
+	igs, err := source.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error reading instance groups: %v", err)
+	}
+	for i := range igs.Items {
+		ig := igs.Items[i].DeepCopy()
+		ig.ObjectMeta.ResourceVersion = ""
+		plan.InstanceGroups = append(plan.InstanceGroups, ig)
+	}
+
+	keyStore, err := source.KeyStore(cluster)
+	if err != nil {
+		return nil, err
+	}
+	keysets, err := keyStore.ListKeysets()
+	if err != nil {
+		return nil, fmt.Errorf("error listing keysets: %v", err)
+	}
+	for _, k := range keysets {
+		if k.Spec.Type != kops.SecretTypeKeypair {
+			continue
+		}
+		keyset, err := readKeyset(keyStore, k.Name)
+		if err != nil {
+			return nil, err
+		}
+		plan.Keysets = append(plan.Keysets, keyset)
+	}
+	sort.Slice(plan.Keysets, func(i, j int) bool { return plan.Keysets[i].Name < plan.Keysets[j].Name })
+
+	secretStore, err := source.SecretStore(cluster)
+	if err != nil {
+		return nil, err
+	}
+	secretNames, err := secretStore.ListSecrets()
+	if err != nil {
+		return nil, fmt.Errorf("error listing secrets: %v", err)
+	}
+	for _, name := range secretNames {
+		secret, err := secretStore.FindSecret(name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading secret %q: %v", name, err)
+		}
+		if secret == nil {
+			glog.Warningf("secret %q was removed before it could be read", name)
+			continue
+		}
+		plan.secrets[name] = secret
+		plan.SecretNames = append(plan.SecretNames, name)
+	}
+	sort.Strings(plan.SecretNames)
+
+	sshCredentialStore, err := source.SSHCredentialStore(cluster)
+	if err != nil {
+		return nil, err
+	}
+	plan.SSHCredentials, err = sshCredentialStore.ListSSHCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("error listing SSH credentials: %v", err)
+	}
+
+	return plan, nil
+}
+
+// readKeyset reads the certificates and private keys of the keyset, merging them by id
+func readKeyset(keyStore fi.CAStore, name string) (*kops.Keyset, error) {
+	certificates, err := keyStore.FindCertificateKeyset(name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificates of keyset %q: %v", name, err)
+	}
+	privateKeys, err := keyStore.FindPrivateKeyset(name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading private keys of keyset %q: %v", name, err)
+	}
+
+	keyset := &kops.Keyset{}
+	keyset.Name = name
+	keyset.Spec.Type = kops.SecretTypeKeypair
+
+	items := make(map[string]*kops.KeysetItem)
+	for _, k := range []*kops.Keyset{certificates, privateKeys} {
+		if k == nil {
+			continue
+		}
+		for i := range k.Spec.Keys {
+			key := &k.Spec.Keys[i]
+			item := items[key.Id]
+			if item == nil {
+				item = &kops.KeysetItem{Id: key.Id}
+				items[key.Id] = item
+			}
+			if len(key.PublicMaterial) != 0 {
+				item.PublicMaterial = key.PublicMaterial
+			}
+			if len(key.PrivateMaterial) != 0 {
+				item.PrivateMaterial = key.PrivateMaterial
+			}
+		}
+	}
+
+	var ids []string
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		keyset.Spec.Keys = append(keyset.Spec.Keys, *items[id])
+	}
+	return keyset, nil
+}
+
+// MigrateStateToKubernetes creates the objects of the plan in the Kubernetes state store, and leaves a marker
+// at the old location pointing to the new state store.  The files under the cluster's configBase are kept,
+// as the instances of the cluster read them, and kops keeps writing them when the cluster is updated.
+func MigrateStateToKubernetes(plan *MigrateStateToKubernetesPlan) error {
+	destination := plan.destination
+	cluster := plan.Cluster
+
+	if _, err := destination.CreateCluster(cluster); err != nil {
+		return fmt.Errorf("error creating cluster: %v", err)
+	}
+
+	for _, ig := range plan.InstanceGroups {
+		if _, err := destination.InstanceGroupsFor(cluster).Create(ig); err != nil {
+			return fmt.Errorf("error creating instance group %q: %v", ig.ObjectMeta.Name, err)
+		}
+	}
+
+	for _, keyset := range plan.Keysets {
+		if _, err := destination.KeysetsFor(cluster).Create(keyset); err != nil {
+			return fmt.Errorf("error creating keyset %q: %v", keyset.Name, err)
+		}
+	}
+
+	secretStore, err := destination.SecretStore(cluster)
+	if err != nil {
+		return err
+	}
+	for _, name := range plan.SecretNames {
+		if _, err := secretStore.ReplaceSecret(name, plan.secrets[name]); err != nil {
+			return fmt.Errorf("error creating secret %q: %v", name, err)
+		}
+	}
+
+	sshCredentialStore, err := destination.SSHCredentialStore(cluster)
+	if err != nil {
+		return err
+	}
+	for _, sshCredential := range plan.SSHCredentials {
+		if err := sshCredentialStore.AddSSHPublicKey(sshCredential.Name, []byte(sshCredential.Spec.PublicKey)); err != nil {
+			return fmt.Errorf("error creating SSH credential %q: %v", sshCredential.Name, err)
+		}
+	}
+
+	marker := &registry.MovedMarker{
+		StateStore: plan.NewStateStore,
+		ConfigBase: cluster.Spec.ConfigBase,
+		Timestamp:  time.Now().UTC(),
+	}
+	if err := registry.WriteMovedMarker(plan.original, plan.Source, marker); err != nil {
+		return fmt.Errorf("error writing moved marker to %s: %v", plan.Source, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/simple/api"
+	"k8s.io/kops/pkg/client/simple/vfsclientset"
+	"k8s.io/kops/pkg/pki"
+	"k8s.io/kops/pkg/testutils/mockapiserver"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+const testSSHPublicKey = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQCtWu40XQo8dczLsCq0OWV+hxm9uV3WxeH9Kgh4sMzQxNtoU1pvW0XdjpkBesRKGoolfWeCLXWxpyQb1IaiMkKoz7MdhQ/6UKjMjP66aFWWp3pwD0uj0HuJ7tq4gKHKRYGTaZIRWpzUiANBrjugVgA+Sd7E/mYwc/DMXkIyRZbvhQ== test@example.com"
+
+func buildMigrateTestCluster() *kops.Cluster {
+	c := &kops.Cluster{}
+	c.ObjectMeta.Name = "cluster.example.com"
+	c.Spec.ConfigBase = "memfs://old/cluster.example.com"
+	c.Spec.KubernetesVersion = "1.9.3"
+	c.Spec.CloudProvider = "aws"
+	c.Spec.Subnets = []kops.ClusterSubnetSpec{
+		{Name: "us-test-1a", Zone: "us-test-1a", CIDR: "172.20.32.0/19"},
+	}
+	c.Spec.NetworkCIDR = "172.20.0.0/16"
+	c.Spec.NonMasqueradeCIDR = "100.64.0.0/10"
+	c.Spec.Topology = &kops.TopologySpec{Masters: kops.TopologyPublic, Nodes: kops.TopologyPublic}
+	c.Spec.Networking = &kops.NetworkingSpec{Kubenet: &kops.KubenetNetworkingSpec{}}
+	for _, name := range []string{"main", "events"} {
+		c.Spec.EtcdClusters = append(c.Spec.EtcdClusters, &kops.EtcdClusterSpec{
+			Name:    name,
+			Members: []*kops.EtcdMemberSpec{{Name: "a", InstanceGroup: fi.String("master-us-test-1a")}},
+		})
+	}
+	return c
+}
+
+func TestMigrateStateToKubernetes(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	server := mockapiserver.New()
+	defer server.Close()
+
+	oldBase, _ := vfs.Context.BuildVfsPath("memfs://old")
+	source := vfsclientset.NewVFSClientset(oldBase, true)
+
+	cluster, err := source.CreateCluster(buildMigrateTestCluster())
+	if err != nil {
+		t.Fatalf("error creating cluster: %v", err)
+	}
+
+	ig := &kops.InstanceGroup{}
+	ig.ObjectMeta.Name = "nodes"
+	ig.Spec.Role = kops.InstanceGroupRoleNode
+	if _, err := source.InstanceGroupsFor(cluster).Create(ig); err != nil {
+		t.Fatalf("error creating instance group: %v", err)
+	}
+
+	keyStore, err := source.KeyStore(cluster)
+	if err != nil {
+		t.Fatalf("error building keystore: %v", err)
+	}
+	caKey, err := pki.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("error generating CA key: %v", err)
+	}
+	caCertificate, err := pki.SignNewCertificate(caKey, fi.BuildCAX509Template(), nil, nil)
+	if err != nil {
+		t.Fatalf("error signing CA certificate: %v", err)
+	}
+	if err := keyStore.StoreKeypair(fi.CertificateId_CA, caCertificate, caKey); err != nil {
+		t.Fatalf("error storing CA: %v", err)
+	}
+
+	secretStore, err := source.SecretStore(cluster)
+	if err != nil {
+		t.Fatalf("error building secret store: %v", err)
+	}
+	if _, _, err := secretStore.GetOrCreateSecret("system:dns", &fi.Secret{Data: []byte("token")}); err != nil {
+		t.Fatalf("error creating secret: %v", err)
+	}
+
+	sshCredentialStore, err := source.SSHCredentialStore(cluster)
+	if err != nil {
+		t.Fatalf("error building SSH credential store: %v", err)
+	}
+	if err := sshCredentialStore.AddSSHPublicKey("admin", []byte(testSSHPublicKey)); err != nil {
+		t.Fatalf("error adding SSH public key: %v", err)
+	}
+
+	destination, err := api.NewCRDClientset(server.Config())
+	if err != nil {
+		t.Fatalf("error building clientset: %v", err)
+	}
+
+	plan, err := BuildMigrateStateToKubernetesPlan(source, cluster, destination, "k8s://management")
+	if err != nil {
+		t.Fatalf("error planning migration: %v", err)
+	}
+	if len(plan.InstanceGroups) != 1 || len(plan.Keysets) != 1 || len(plan.SecretNames) != 1 || len(plan.SSHCredentials) != 1 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	if keys := plan.Keysets[0].Spec.Keys; len(keys) != 1 || len(keys[0].PublicMaterial) == 0 || len(keys[0].PrivateMaterial) == 0 {
+		t.Errorf("keyset was not merged: %v", plan.Keysets[0])
+	}
+
+	if err := MigrateStateToKubernetes(plan); err != nil {
+		t.Fatalf("error migrating state: %v", err)
+	}
+
+	moved, err := destination.GetCluster(cluster.ObjectMeta.Name)
+	if err != nil {
+		t.Fatalf("error reading moved cluster: %v", err)
+	}
+	if moved.Spec.ConfigBase != "memfs://old/cluster.example.com" {
+		t.Errorf("unexpected configBase of moved cluster: %q", moved.Spec.ConfigBase)
+	}
+
+	igs, err := destination.InstanceGroupsFor(moved).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("error listing instance groups: %v", err)
+	}
+	if len(igs.Items) != 1 || igs.Items[0].Spec.Role != kops.InstanceGroupRoleNode {
+		t.Errorf("unexpected instance groups %v", igs.Items)
+	}
+
+	movedKeyStore, err := destination.KeyStore(moved)
+	if err != nil {
+		t.Fatalf("error building keystore: %v", err)
+	}
+	movedCA, err := movedKeyStore.FindCertificatePool(fi.CertificateId_CA)
+	if err != nil {
+		t.Fatalf("error reading CA: %v", err)
+	}
+	if movedCA == nil || !bytes.Equal(movedCA.Primary.Certificate.Raw, caCertificate.Certificate.Raw) {
+		t.Errorf("CA was not copied")
+	}
+	if privateKey, err := movedKeyStore.FindPrivateKey(fi.CertificateId_CA); err != nil || privateKey == nil {
+		t.Errorf("CA private key was not copied: %v", err)
+	}
+
+	movedSecretStore, err := destination.SecretStore(moved)
+	if err != nil {
+		t.Fatalf("error building secret store: %v", err)
+	}
+	if secret, err := movedSecretStore.FindSecret("system:dns"); err != nil || secret == nil || string(secret.Data) != "token" {
+		t.Errorf("secret was not copied: %v %v", secret, err)
+	}
+
+	movedSSHCredentialStore, err := destination.SSHCredentialStore(moved)
+	if err != nil {
+		t.Fatalf("error building SSH credential store: %v", err)
+	}
+	if sshCredentials, err := movedSSHCredentialStore.FindSSHPublicKeys("admin"); err != nil || len(sshCredentials) != 1 {
+		t.Errorf("SSH credential was not copied: %v %v", sshCredentials, err)
+	}
+
+	// The cluster can no longer be read from the old state store
+	if _, err := source.GetCluster(cluster.ObjectMeta.Name); err == nil || !strings.Contains(err.Error(), "k8s://management") {
+		t.Errorf("expected error reporting that the cluster was moved, got %v", err)
+	}
+
+	// The cluster cannot be moved over an existing cluster
+	if _, err := BuildMigrateStateToKubernetesPlan(source, cluster, destination, "k8s://management"); err == nil {
+		t.Errorf("expected error moving cluster to a state store where it exists")
+	}
+}
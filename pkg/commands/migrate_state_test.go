@@ -0,0 +1,186 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/simple/vfsclientset"
+	"k8s.io/kops/pkg/kopscodecs"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func writeTestFile(t *testing.T, p string, data []byte) {
+	path, err := vfs.Context.BuildVfsPath(p)
+	if err != nil {
+		t.Fatalf("error building path %q: %v", p, err)
+	}
+	if err := path.WriteFile(bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("error writing %q: %v", p, err)
+	}
+}
+
+func readTestFile(t *testing.T, p string) []byte {
+	path, err := vfs.Context.BuildVfsPath(p)
+	if err != nil {
+		t.Fatalf("error building path %q: %v", p, err)
+	}
+	data, err := path.ReadFile()
+	if err != nil {
+		t.Fatalf("error reading %q: %v", p, err)
+	}
+	return data
+}
+
+func TestMigrateState(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	cluster := &kops.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+		Spec: kops.ClusterSpec{
+			ConfigBase:  "memfs://old/cluster.example.com",
+			KeyStore:    "encrypted+memfs://old/cluster.example.com/pki?kek=file:///etc/kops/kek",
+			SecretStore: "memfs://secrets/cluster.example.com",
+		},
+	}
+	config, err := kopscodecs.ToVersionedYaml(cluster)
+	if err != nil {
+		t.Fatalf("error serializing cluster: %v", err)
+	}
+
+	files := map[string][]byte{
+		"config":                     config,
+		"instancegroup/nodes":        []byte("kind: InstanceGroup\n"),
+		"pki/issued/ca/keyset.yaml":  []byte("certificate"),
+		"pki/private/ca/keyset.yaml": []byte("{\"envelope\":\"kops/v1\"}"),
+		"pki/ssh/public/admin/abc":   []byte("ssh-rsa AAAA"),
+	}
+	for k, v := range files {
+		writeTestFile(t, "memfs://old/cluster.example.com/"+k, v)
+	}
+
+	oldBase, _ := vfs.Context.BuildVfsPath("memfs://old")
+	oldClientset := vfsclientset.NewVFSClientset(oldBase, true)
+	loaded, err := oldClientset.GetCluster("cluster.example.com")
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+
+	plan, err := BuildMigrateStatePlan(loaded, "memfs://new")
+	if err != nil {
+		t.Fatalf("error planning migration: %v", err)
+	}
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "spec.secretStore") {
+		t.Errorf("expected a warning that the secret store is not moved, got %v", plan.Warnings)
+	}
+	for k := range files {
+		found := false
+		for _, f := range plan.Files {
+			if f == k {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("file %q not in plan %v", k, plan.Files)
+		}
+	}
+
+	if err := MigrateState(plan); err != nil {
+		t.Fatalf("error migrating state: %v", err)
+	}
+
+	for k, v := range files {
+		if k == "config" {
+			continue
+		}
+		if actual := readTestFile(t, "memfs://new/cluster.example.com/"+k); !bytes.Equal(actual, v) {
+			t.Errorf("file %q was copied as %q, expected %q", k, actual, v)
+		}
+	}
+
+	newBase, _ := vfs.Context.BuildVfsPath("memfs://new")
+	moved, err := vfsclientset.NewVFSClientset(newBase, true).GetCluster("cluster.example.com")
+	if err != nil {
+		t.Fatalf("error reading moved cluster: %v", err)
+	}
+	if moved.Spec.ConfigBase != "memfs://new/cluster.example.com" {
+		t.Errorf("unexpected configBase of moved cluster: %q", moved.Spec.ConfigBase)
+	}
+	if moved.Spec.KeyStore != "encrypted+memfs://new/cluster.example.com/pki?kek=file:///etc/kops/kek" {
+		t.Errorf("unexpected keyStore of moved cluster: %q", moved.Spec.KeyStore)
+	}
+	if moved.Spec.SecretStore != "memfs://secrets/cluster.example.com" {
+		t.Errorf("unexpected secretStore of moved cluster: %q", moved.Spec.SecretStore)
+	}
+
+	// The cluster can no longer be read from the old state store
+	if _, err := oldClientset.GetCluster("cluster.example.com"); err == nil || !strings.Contains(err.Error(), "memfs://new") {
+		t.Errorf("expected error reporting that the cluster was moved, got %v", err)
+	}
+
+	// The cluster cannot be moved over an existing cluster
+	if _, err := BuildMigrateStatePlan(loaded, "memfs://new"); err == nil {
+		t.Errorf("expected error moving cluster to a state store where it exists")
+	}
+}
+
+func TestRewriteStoreLocation(t *testing.T) {
+	grid := []struct {
+		Location string
+		Expected string
+		Changed  bool
+	}{
+		{
+			Location: "s3://old/cluster.example.com/pki",
+			Expected: "gs://new/cluster.example.com/pki",
+			Changed:  true,
+		},
+		{
+			Location: "s3://old/cluster.example.com",
+			Expected: "gs://new/cluster.example.com",
+			Changed:  true,
+		},
+		{
+			Location: "encrypted+s3://old/cluster.example.com/secrets?kek=awskms://alias/kops",
+			Expected: "encrypted+gs://new/cluster.example.com/secrets?kek=awskms://alias/kops",
+			Changed:  true,
+		},
+		{
+			Location: "s3://old/cluster.example.com.other/pki",
+			Expected: "s3://old/cluster.example.com.other/pki",
+		},
+		{
+			Location: "s3://elsewhere/pki",
+			Expected: "s3://elsewhere/pki",
+		},
+	}
+
+	for _, g := range grid {
+		actual, changed, err := rewriteStoreLocation(g.Location, "s3://old/cluster.example.com", "gs://new/cluster.example.com")
+		if err != nil {
+			t.Errorf("unexpected error rewriting %q: %v", g.Location, err)
+			continue
+		}
+		if actual != g.Expected || changed != g.Changed {
+			t.Errorf("rewriting %q: expected (%q, %v), got (%q, %v)", g.Location, g.Expected, g.Changed, actual, changed)
+		}
+	}
+}
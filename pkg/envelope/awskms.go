@@ -0,0 +1,116 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envelope
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// awsKMSKeyEncrypter encrypts data keys with an AWS KMS key
+type awsKMSKeyEncrypter struct {
+	url    string
+	keyID  string
+	client *kms.KMS
+}
+
+var _ KeyEncrypter = &awsKMSKeyEncrypter{}
+
+// ParseAWSKMSURL returns the key id and region of an awskms:// URL.  The region is taken from the
+// region parameter, from the key ARN, or from the AWS_REGION environment variable.
+func ParseAWSKMSURL(kekURL string) (string, string, error) {
+	keyID := strings.TrimPrefix(kekURL, "awskms://")
+	region := ""
+	if i := strings.Index(keyID, "?"); i != -1 {
+		query, err := url.ParseQuery(keyID[i+1:])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid key encryption key URL %q: %v", kekURL, err)
+		}
+		region = query.Get("region")
+		keyID = keyID[:i]
+	}
+	if keyID == "" {
+		return "", "", fmt.Errorf("key encryption key URL %q must specify the KMS key", kekURL)
+	}
+
+	if region == "" && strings.HasPrefix(keyID, "arn:") {
+		// arn:aws:kms:<region>:<account>:key/<id>
+		tokens := strings.Split(keyID, ":")
+		if len(tokens) < 6 || tokens[3] == "" {
+			return "", "", fmt.Errorf("key encryption key URL %q has an invalid ARN", kekURL)
+		}
+		region = tokens[3]
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	return keyID, region, nil
+}
+
+func newAWSKMSKeyEncrypter(kekURL string) (*awsKMSKeyEncrypter, error) {
+	keyID, region, err := ParseAWSKMSURL(kekURL)
+	if err != nil {
+		return nil, err
+	}
+	if region == "" {
+		return nil, fmt.Errorf("cannot determine the region of KMS key %q; specify it with ?region=, use the key ARN, or set AWS_REGION", keyID)
+	}
+
+	config := aws.NewConfig().WithRegion(region)
+	config = config.WithCredentialsChainVerboseErrors(true)
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, fmt.Errorf("error starting new AWS session: %v", err)
+	}
+
+	return &awsKMSKeyEncrypter{
+		url:    kekURL,
+		keyID:  keyID,
+		client: kms.New(sess, config),
+	}, nil
+}
+
+func (k *awsKMSKeyEncrypter) URL() string {
+	return k.url
+}
+
+func (k *awsKMSKeyEncrypter) EncryptKey(plaintext []byte) ([]byte, error) {
+	response, err := k.client.Encrypt(&kms.EncryptInput{
+		KeyId:     aws.String(k.keyID),
+		Plaintext: plaintext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calling KMS Encrypt: %v", err)
+	}
+	return response.CiphertextBlob, nil
+}
+
+func (k *awsKMSKeyEncrypter) DecryptKey(ciphertext []byte) ([]byte, error) {
+	response, err := k.client.Decrypt(&kms.DecryptInput{
+		CiphertextBlob: ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calling KMS Decrypt: %v", err)
+	}
+	return response.Plaintext, nil
+}
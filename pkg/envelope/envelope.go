@@ -0,0 +1,249 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	crypto_rand "crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// envelopeVersion identifies the format of the envelope; it is always the first field, so encrypted data can be recognized
+const envelopeVersion = "kops/v1"
+
+var envelopePrefix = []byte(`{"envelope":"` + envelopeVersion + `"`)
+
+// KeyEncrypter encrypts and decrypts data keys with a key encryption key, which is held by a
+// key management service and never leaves it
+type KeyEncrypter interface {
+	// URL identifies the key encryption key, and is recorded in the envelope so the data can be decrypted later
+	URL() string
+	// EncryptKey encrypts a data key
+	EncryptKey(plaintext []byte) ([]byte, error)
+	// DecryptKey decrypts a data key that was encrypted by EncryptKey
+	DecryptKey(ciphertext []byte) ([]byte, error)
+}
+
+// envelope is the serialized form of encrypted data: the data is encrypted with a random AES-256-GCM data key,
+// and the data key is encrypted with the key encryption key
+type envelope struct {
+	Envelope     string `json:"envelope"`
+	KEK          string `json:"kek"`
+	EncryptedKey []byte `json:"encryptedKey"`
+	Nonce        []byte `json:"nonce"`
+	Ciphertext   []byte `json:"ciphertext"`
+}
+
+// Encrypter performs envelope encryption with a key encryption key
+type Encrypter struct {
+	kek KeyEncrypter
+}
+
+// NewEncrypter builds an Encrypter for the key encryption key with the specified URL
+func NewEncrypter(kekURL string) (*Encrypter, error) {
+	kek, err := getKeyEncrypter(kekURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Encrypter{kek: kek}, nil
+}
+
+// NewEncrypterForKey builds an Encrypter using the specified KeyEncrypter
+func NewEncrypterForKey(kek KeyEncrypter) *Encrypter {
+	return &Encrypter{kek: kek}
+}
+
+// KeyURL returns the URL of the key encryption key
+func (e *Encrypter) KeyURL() string {
+	return e.kek.URL()
+}
+
+// Encrypt encrypts the data with a new data key, returning the envelope
+func (e *Encrypter) Encrypt(plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(crypto_rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("error generating data key: %v", err)
+	}
+
+	encryptedKey, err := e.kek.EncryptKey(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting data key with %q: %v", e.kek.URL(), err)
+	}
+
+	nonce, ciphertext, err := sealAESGCM(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(&envelope{
+		Envelope:     envelopeVersion,
+		KEK:          e.kek.URL(),
+		EncryptedKey: encryptedKey,
+		Nonce:        nonce,
+		Ciphertext:   ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error serializing envelope: %v", err)
+	}
+	return data, nil
+}
+
+// IsEncrypted returns true if the data is an envelope written by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, envelopePrefix)
+}
+
+// Decrypt decrypts an envelope written by Encrypt with the same key encryption key.
+// Envelopes that record a different key encryption key are rejected, because the key encryption key
+// recorded in the envelope is written by whoever wrote the data, and is never trusted.
+// Data that is not encrypted is rejected too; stores written before encryption was enabled are
+// encrypted by kops toolbox encrypt-state.
+func (e *Encrypter) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, fmt.Errorf("data is not encrypted, but is expected to be encrypted with %q", e.kek.URL())
+	}
+
+	env := &envelope{}
+	if err := json.Unmarshal(data, env); err != nil {
+		return nil, fmt.Errorf("error parsing envelope: %v", err)
+	}
+
+	if env.KEK != e.kek.URL() {
+		return nil, fmt.Errorf("data is encrypted with %q, but is expected to be encrypted with %q", env.KEK, e.kek.URL())
+	}
+
+	dataKey, err := e.kek.DecryptKey(env.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data key with %q: %v", env.KEK, err)
+	}
+
+	return openAESGCM(dataKey, env.Nonce, env.Ciphertext)
+}
+
+var (
+	// keyEncryptersMutex guards keyEncrypters
+	keyEncryptersMutex sync.Mutex
+	// keyEncrypters caches the KeyEncrypters by URL, so their clients are reused
+	keyEncrypters = make(map[string]KeyEncrypter)
+)
+
+// getKeyEncrypter returns the KeyEncrypter for the URL, building it if it is not cached
+func getKeyEncrypter(kekURL string) (KeyEncrypter, error) {
+	keyEncryptersMutex.Lock()
+	defer keyEncryptersMutex.Unlock()
+
+	if kek := keyEncrypters[kekURL]; kek != nil {
+		return kek, nil
+	}
+
+	kek, err := NewKeyEncrypter(kekURL)
+	if err != nil {
+		return nil, err
+	}
+	keyEncrypters[kekURL] = kek
+	return kek, nil
+}
+
+// NewKeyEncrypter builds the KeyEncrypter for a key encryption key URL.  The supported URLs are:
+//
+//	awskms://<key id, alias or ARN>[?region=<region>]
+//	gcpkms://projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>
+//	vault://<host>[:<port>]/<transit mount>/<key>  (or vault+http:// for a vault without TLS)
+//	file:///<path to a file holding a 32 byte key>
+func NewKeyEncrypter(kekURL string) (KeyEncrypter, error) {
+	if err := ValidateKeyURL(kekURL); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasPrefix(kekURL, "awskms://"):
+		return newAWSKMSKeyEncrypter(kekURL)
+	case strings.HasPrefix(kekURL, "gcpkms://"):
+		return newGCPKMSKeyEncrypter(kekURL)
+	case strings.HasPrefix(kekURL, "vault://"), strings.HasPrefix(kekURL, "vault+http://"):
+		return newVaultKeyEncrypter(kekURL)
+	case strings.HasPrefix(kekURL, "file://"):
+		return newFileKeyEncrypter(kekURL)
+	default:
+		return nil, fmt.Errorf("unknown key encryption key URL %q", kekURL)
+	}
+}
+
+// ValidateKeyURL checks that a key encryption key URL is well-formed, without contacting the key management service
+func ValidateKeyURL(kekURL string) error {
+	switch {
+	case strings.HasPrefix(kekURL, "awskms://"):
+		_, _, err := ParseAWSKMSURL(kekURL)
+		return err
+	case strings.HasPrefix(kekURL, "gcpkms://"):
+		_, err := parseGCPKMSURL(kekURL)
+		return err
+	case strings.HasPrefix(kekURL, "vault://"), strings.HasPrefix(kekURL, "vault+http://"):
+		_, _, err := parseVaultURL(kekURL)
+		return err
+	case strings.HasPrefix(kekURL, "file://"):
+		_, err := parseFileKeyURL(kekURL)
+		return err
+	default:
+		return fmt.Errorf("unknown key encryption key URL %q; expected awskms://, gcpkms://, vault://, vault+http:// or file://", kekURL)
+	}
+}
+
+// sealAESGCM encrypts the plaintext with AES-GCM, returning a random nonce and the ciphertext
+func sealAESGCM(key []byte, plaintext []byte) ([]byte, []byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building cipher: %v", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(crypto_rand.Reader, nonce); err != nil {
+		return nil, nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// openAESGCM decrypts ciphertext written by sealAESGCM
+func openAESGCM(key []byte, nonce []byte, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error building cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error building cipher: %v", err)
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(nonce))
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data: %v", err)
+	}
+	return plaintext, nil
+}
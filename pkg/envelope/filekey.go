@@ -0,0 +1,90 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// fileKeyEncrypter encrypts data keys with an AES-256 key read from a local file.
+// It is intended for tests and development, where no key management service is available;
+// the key file must be present wherever the store is read, including on the instances.
+type fileKeyEncrypter struct {
+	url string
+	key []byte
+}
+
+var _ KeyEncrypter = &fileKeyEncrypter{}
+
+func parseFileKeyURL(kekURL string) (string, error) {
+	p := strings.TrimPrefix(kekURL, "file://")
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("key encryption key URL %q must be an absolute path, like file:///etc/kops/kek", kekURL)
+	}
+	return p, nil
+}
+
+func newFileKeyEncrypter(kekURL string) (*fileKeyEncrypter, error) {
+	p, err := parseFileKeyURL(kekURL)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key encryption key %q: %v", p, err)
+	}
+
+	// The key is either 32 raw bytes, or the base64 encoding of 32 bytes
+	key := data
+	if len(key) != 32 {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+		if err != nil || len(decoded) != 32 {
+			return nil, fmt.Errorf("key encryption key %q must hold 32 bytes, optionally base64 encoded", p)
+		}
+		key = decoded
+	}
+
+	return &fileKeyEncrypter{
+		url: kekURL,
+		key: key,
+	}, nil
+}
+
+func (k *fileKeyEncrypter) URL() string {
+	return k.url
+}
+
+func (k *fileKeyEncrypter) EncryptKey(plaintext []byte) ([]byte, error) {
+	nonce, ciphertext, err := sealAESGCM(k.key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, ciphertext...), nil
+}
+
+func (k *fileKeyEncrypter) DecryptKey(ciphertext []byte) ([]byte, error) {
+	// The nonce of AES-GCM is 12 bytes, and is written before the ciphertext
+	if len(ciphertext) < 12 {
+		return nil, fmt.Errorf("encrypted key is too short")
+	}
+	return openAESGCM(k.key, ciphertext[:12], ciphertext[12:])
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envelope
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+)
+
+// gcpKMSEndpoint is the base URL of the Cloud KMS REST API
+const gcpKMSEndpoint = "https://cloudkms.googleapis.com/v1/"
+
+// gcpKMSScope is the OAuth scope needed to call Cloud KMS
+const gcpKMSScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// gcpKMSKeyEncrypter encrypts data keys with a Google Cloud KMS crypto key
+type gcpKMSKeyEncrypter struct {
+	url string
+	// name is the resource name of the crypto key
+	name   string
+	client *http.Client
+}
+
+var _ KeyEncrypter = &gcpKMSKeyEncrypter{}
+
+func parseGCPKMSURL(kekURL string) (string, error) {
+	name := strings.TrimPrefix(kekURL, "gcpkms://")
+	tokens := strings.Split(name, "/")
+	if len(tokens) != 8 || tokens[0] != "projects" || tokens[2] != "locations" || tokens[4] != "keyRings" || tokens[6] != "cryptoKeys" {
+		return "", fmt.Errorf("key encryption key URL %q must be gcpkms://projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>", kekURL)
+	}
+	for _, token := range tokens {
+		if token == "" {
+			return "", fmt.Errorf("key encryption key URL %q has an empty path component", kekURL)
+		}
+	}
+	return name, nil
+}
+
+func newGCPKMSKeyEncrypter(kekURL string) (*gcpKMSKeyEncrypter, error) {
+	name, err := parseGCPKMSURL(kekURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := google.DefaultClient(context.Background(), gcpKMSScope)
+	if err != nil {
+		return nil, fmt.Errorf("error building Cloud KMS HTTP client: %v", err)
+	}
+
+	return &gcpKMSKeyEncrypter{
+		url:    kekURL,
+		name:   name,
+		client: client,
+	}, nil
+}
+
+func (k *gcpKMSKeyEncrypter) URL() string {
+	return k.url
+}
+
+type gcpKMSEncryptRequest struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+type gcpKMSEncryptResponse struct {
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type gcpKMSDecryptRequest struct {
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type gcpKMSDecryptResponse struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+func (k *gcpKMSKeyEncrypter) EncryptKey(plaintext []byte) ([]byte, error) {
+	response := &gcpKMSEncryptResponse{}
+	if err := postJSON(k.client, gcpKMSEndpoint+k.name+":encrypt", nil, &gcpKMSEncryptRequest{Plaintext: plaintext}, response); err != nil {
+		return nil, fmt.Errorf("error calling Cloud KMS encrypt: %v", err)
+	}
+	return response.Ciphertext, nil
+}
+
+func (k *gcpKMSKeyEncrypter) DecryptKey(ciphertext []byte) ([]byte, error) {
+	response := &gcpKMSDecryptResponse{}
+	if err := postJSON(k.client, gcpKMSEndpoint+k.name+":decrypt", nil, &gcpKMSDecryptRequest{Ciphertext: ciphertext}, response); err != nil {
+		return nil, fmt.Errorf("error calling Cloud KMS decrypt: %v", err)
+	}
+	return response.Plaintext, nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envelope
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// StorePrefix is the scheme prefix of an encrypted keystore or secret store location
+const StorePrefix = "encrypted+"
+
+// storeKeyParameter separates the location of an encrypted store from the URL of its key encryption key
+const storeKeyParameter = "?kek="
+
+// ParseStoreLocation splits a KeyStore or SecretStore location into the VFS location of the store and
+// the URL of its key encryption key, which is empty if the store is not encrypted.
+// Encrypted stores are written as encrypted+<location>?kek=<key encryption key URL>, for example
+// encrypted+s3://bucket/cluster/pki?kek=awskms://alias/kops?region=us-east-1
+func ParseStoreLocation(s string) (string, string, error) {
+	if !strings.HasPrefix(s, StorePrefix) {
+		return s, "", nil
+	}
+
+	s = strings.TrimPrefix(s, StorePrefix)
+	i := strings.Index(s, storeKeyParameter)
+	if i == -1 {
+		return "", "", fmt.Errorf("encrypted store %q must specify the key encryption key with %s", StorePrefix+s, storeKeyParameter)
+	}
+	location := s[:i]
+	kekURL := s[i+len(storeKeyParameter):]
+	if location == "" {
+		return "", "", fmt.Errorf("encrypted store %q must specify the location of the store", StorePrefix+s)
+	}
+	if err := ValidateKeyURL(kekURL); err != nil {
+		return "", "", err
+	}
+	return location, kekURL, nil
+}
+
+// FormatStoreLocation is the inverse of ParseStoreLocation, building a KeyStore or SecretStore location
+// from the VFS location of the store and the URL of its key encryption key, which is empty if the store is not encrypted
+func FormatStoreLocation(location string, kekURL string) string {
+	if kekURL == "" {
+		return location
+	}
+	return StorePrefix + location + storeKeyParameter + kekURL
+}
+
+// BuildStorePath returns the VFS path of a KeyStore or SecretStore location, and the Encrypter
+// for its contents, which is nil if the store is not encrypted
+func BuildStorePath(s string) (vfs.Path, *Encrypter, error) {
+	location, _, err := ParseStoreLocation(s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := vfs.Context.BuildVfsPath(location)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encrypter, err := StoreEncrypter(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, encrypter, nil
+}
+
+// StoreEncrypter returns the Encrypter for a KeyStore or SecretStore location, or nil if the store is not encrypted
+func StoreEncrypter(s string) (*Encrypter, error) {
+	_, kekURL, err := ParseStoreLocation(s)
+	if err != nil {
+		return nil, err
+	}
+	if kekURL == "" {
+		return nil, nil
+	}
+	return NewEncrypter(kekURL)
+}
+
+// DecryptStoreData decrypts data read from a KeyStore or SecretStore with the Encrypter of the store,
+// which is nil if the store is not encrypted.  An unencrypted store only holds plaintext, because
+// there is no configured key encryption key to decrypt with.
+func DecryptStoreData(encrypter *Encrypter, data []byte) ([]byte, error) {
+	if encrypter != nil {
+		return encrypter.Decrypt(data)
+	}
+	if IsEncrypted(data) {
+		return nil, fmt.Errorf("data is encrypted, but the store is not configured with a key encryption key")
+	}
+	return data, nil
+}
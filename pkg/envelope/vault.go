@@ -0,0 +1,201 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// vaultKeyEncrypter encrypts data keys with a key in the transit secrets engine of HashiCorp Vault
+type vaultKeyEncrypter struct {
+	url string
+	// address is the base URL of the vault server, for example https://vault.example.com:8200
+	address string
+	// mount is the path where the transit secrets engine is mounted, normally transit
+	mount string
+	// key is the name of the transit key
+	key    string
+	client *http.Client
+}
+
+var _ KeyEncrypter = &vaultKeyEncrypter{}
+
+// parseVaultURL returns the server address and the transit key path (<mount>/<key>) of a vault:// URL
+func parseVaultURL(kekURL string) (string, string, error) {
+	scheme := "https"
+	s := kekURL
+	if strings.HasPrefix(s, "vault+http://") {
+		scheme = "http"
+		s = strings.TrimPrefix(s, "vault+http://")
+	} else {
+		s = strings.TrimPrefix(s, "vault://")
+	}
+
+	u, err := url.Parse(scheme + "://" + s)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid key encryption key URL %q: %v", kekURL, err)
+	}
+	keyPath := strings.Trim(u.Path, "/")
+	if u.Host == "" || !strings.Contains(keyPath, "/") {
+		return "", "", fmt.Errorf("key encryption key URL %q must be vault://<host>[:<port>]/<transit mount>/<key>", kekURL)
+	}
+	return scheme + "://" + u.Host, keyPath, nil
+}
+
+func newVaultKeyEncrypter(kekURL string) (*vaultKeyEncrypter, error) {
+	address, keyPath, err := parseVaultURL(kekURL)
+	if err != nil {
+		return nil, err
+	}
+
+	i := strings.LastIndex(keyPath, "/")
+	return &vaultKeyEncrypter{
+		url:     kekURL,
+		address: address,
+		mount:   keyPath[:i],
+		key:     keyPath[i+1:],
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// vaultToken returns the token used to authenticate to vault: the VAULT_TOKEN environment variable,
+// or the ~/.vault-token file written by vault login
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = "/root"
+	}
+	p := filepath.Join(home, ".vault-token")
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("no vault token found; set VAULT_TOKEN or write the token to %s", p)
+		}
+		return "", fmt.Errorf("error reading vault token from %s: %v", p, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (k *vaultKeyEncrypter) URL() string {
+	return k.url
+}
+
+type vaultEncryptRequest struct {
+	Plaintext string `json:"plaintext"`
+}
+
+type vaultEncryptResponse struct {
+	Data struct {
+		Ciphertext string `json:"ciphertext"`
+	} `json:"data"`
+}
+
+type vaultDecryptRequest struct {
+	Ciphertext string `json:"ciphertext"`
+}
+
+type vaultDecryptResponse struct {
+	Data struct {
+		Plaintext string `json:"plaintext"`
+	} `json:"data"`
+}
+
+func (k *vaultKeyEncrypter) EncryptKey(plaintext []byte) ([]byte, error) {
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &vaultEncryptRequest{Plaintext: base64.StdEncoding.EncodeToString(plaintext)}
+	response := &vaultEncryptResponse{}
+	u := k.address + "/v1/" + k.mount + "/encrypt/" + k.key
+	if err := postJSON(k.client, u, map[string]string{"X-Vault-Token": token}, request, response); err != nil {
+		return nil, fmt.Errorf("error calling vault transit encrypt: %v", err)
+	}
+	if response.Data.Ciphertext == "" {
+		return nil, fmt.Errorf("vault transit encrypt returned no ciphertext")
+	}
+	return []byte(response.Data.Ciphertext), nil
+}
+
+func (k *vaultKeyEncrypter) DecryptKey(ciphertext []byte) ([]byte, error) {
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &vaultDecryptRequest{Ciphertext: string(ciphertext)}
+	response := &vaultDecryptResponse{}
+	u := k.address + "/v1/" + k.mount + "/decrypt/" + k.key
+	if err := postJSON(k.client, u, map[string]string{"X-Vault-Token": token}, request, response); err != nil {
+		return nil, fmt.Errorf("error calling vault transit decrypt: %v", err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(response.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding plaintext from vault: %v", err)
+	}
+	return plaintext, nil
+}
+
+// postJSON posts the request as JSON, and parses the JSON response
+func postJSON(client *http.Client, u string, headers map[string]string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("error serializing request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error building request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, u, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("error parsing response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancegroups
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/cloudinstances"
+	"k8s.io/kops/pkg/validation"
+)
+
+// canaryCheckInterval is how often we check the health of the cluster while the canaries soak
+var canaryCheckInterval = 30 * time.Second
+
+// PodReadinessCheck requires that the pods matching a label selector are all ready
+type PodReadinessCheck struct {
+	// Namespace is the namespace of the pods; pods in all namespaces are checked if empty
+	Namespace string
+	// Selector is a label selector for the pods
+	Selector string
+}
+
+// ParsePodReadinessCheck parses a check of the form <namespace>:<selector>, or just <selector> to check all namespaces
+func ParsePodReadinessCheck(s string) (PodReadinessCheck, error) {
+	check := PodReadinessCheck{Selector: s}
+	if i := strings.Index(s, ":"); i != -1 {
+		check.Namespace = s[:i]
+		check.Selector = s[i+1:]
+	}
+
+	if check.Selector == "" {
+		return check, fmt.Errorf("pod readiness check %q must have a label selector", s)
+	}
+	if _, err := labels.Parse(check.Selector); err != nil {
+		return check, fmt.Errorf("invalid label selector in pod readiness check %q: %v", s, err)
+	}
+
+	return check, nil
+}
+
+func (c PodReadinessCheck) String() string {
+	if c.Namespace == "" {
+		return c.Selector
+	}
+	return c.Namespace + ":" + c.Selector
+}
+
+// CanaryFailedError is returned when the cluster is not healthy after the canary instances were replaced
+type CanaryFailedError struct {
+	// Replaced are the instances that were replaced by canaries
+	Replaced []string
+	// Canaries are the instances that were launched as replacements, if they could be found
+	Canaries []string
+	// Failures are the problems found with the cluster
+	Failures []string
+}
+
+func (e *CanaryFailedError) Error() string {
+	var b bytes.Buffer
+	b.WriteString("rolling update halted because the cluster was not healthy after replacing the canary instances")
+	b.WriteString("\nreplaced instances: " + strings.Join(e.Replaced, ", "))
+	if len(e.Canaries) != 0 {
+		b.WriteString("\ncanary instances: " + strings.Join(e.Canaries, ", "))
+	}
+	b.WriteString("\nfailures:")
+	for _, f := range e.Failures {
+		b.WriteString("\n  " + f)
+	}
+	return b.String()
+}
+
+// rollCanaries replaces up to Canary instances in each node group, and checks the cluster stays healthy for the soak period.
+// The groups are updated to exclude the replaced instances, so that the remaining instances can be rolled afterwards.
+func (c *RollingUpdateCluster) rollCanaries(nodeGroups map[string]*cloudinstances.CloudInstanceGroup, cluster *api.Cluster, instanceGroups *api.InstanceGroupList) error {
+	var keys []string
+	for k := range nodeGroups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	existing := make(map[string]bool)
+	var replaced []*cloudinstances.CloudInstanceGroupMember
+	for _, k := range keys {
+		group := nodeGroups[k]
+		for _, u := range append(append([]*cloudinstances.CloudInstanceGroupMember{}, group.Ready...), group.NeedUpdate...) {
+			existing[u.ID] = true
+		}
+
+		g, err := NewRollingUpdateInstanceGroup(c.Cloud, group)
+		if err != nil {
+			return err
+		}
+		g.maxReplacements = c.Canary
+
+		glog.Infof("Replacing up to %d canary instance(s) in group %q.", c.Canary, group.HumanName)
+		if err := g.RollingUpdate(c, cluster, instanceGroups, false, c.NodeInterval, c.ValidationTimeout); err != nil {
+			return fmt.Errorf("error replacing canary instances in group %q: %v", group.HumanName, err)
+		}
+
+		replaced = append(replaced, g.replaced...)
+		nodeGroups[k] = withoutInstances(group, g.replaced)
+	}
+
+	if len(replaced) == 0 {
+		glog.Infof("No canary instances needed replacing.")
+		return nil
+	}
+
+	glog.Infof("Soaking %d canary instance(s) for %s.", len(replaced), c.CanarySoakPeriod)
+
+	deadline := time.Now().Add(c.CanarySoakPeriod)
+	for {
+		failures := c.checkCanaryHealth(cluster, instanceGroups)
+		if len(failures) != 0 {
+			e := &CanaryFailedError{
+				Failures: failures,
+			}
+			for _, u := range replaced {
+				e.Replaced = append(e.Replaced, describeMember(u))
+			}
+			for _, u := range c.findCanaries(cluster, instanceGroups, existing) {
+				e.Canaries = append(e.Canaries, describeMember(u))
+			}
+			return e
+		}
+
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			break
+		}
+		if remaining > canaryCheckInterval {
+			remaining = canaryCheckInterval
+		}
+		time.Sleep(remaining)
+	}
+
+	glog.Infof("Canary instances are healthy, continuing with the rolling update.")
+	return nil
+}
+
+// checkCanaryHealth validates the cluster and runs the pod readiness checks, returning the problems found
+func (c *RollingUpdateCluster) checkCanaryHealth(cluster *api.Cluster, instanceGroups *api.InstanceGroupList) []string {
+	var failures []string
+
+	validateCluster := c.validateCluster
+	if validateCluster == nil {
+		validateCluster = validation.ValidateCluster
+	}
+
+	result, err := validateCluster(cluster, instanceGroups, c.K8sClient)
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("cluster did not validate: %v", err))
+	} else {
+		for _, f := range result.Failures {
+			failures = append(failures, fmt.Sprintf("%s %q: %s", f.Kind, f.Name, f.Message))
+		}
+	}
+
+	for _, check := range c.CanaryPodChecks {
+		podFailures, err := checkPodsReady(c.K8sClient, check)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("pod readiness check %q failed: %v", check, err))
+			continue
+		}
+		failures = append(failures, podFailures...)
+	}
+
+	return failures
+}
+
+// checkPodsReady returns a failure for each pod matching the check that is not ready
+func checkPodsReady(client kubernetes.Interface, check PodReadinessCheck) ([]string, error) {
+	pods, err := client.CoreV1().Pods(check.Namespace).List(metav1.ListOptions{LabelSelector: check.Selector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return []string{fmt.Sprintf("no pods match pod readiness check %q", check)}, nil
+	}
+
+	var failures []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == v1.PodSucceeded {
+			continue
+		}
+		if !validation.IsPodReady(pod) {
+			failures = append(failures, fmt.Sprintf("pod %q matching %q is not ready", pod.Namespace+"/"+pod.Name, check))
+		}
+	}
+	return failures, nil
+}
+
+// findCanaries looks up the instances that were launched since the rolling update started.
+// It is only used to report on a failure, so problems are logged rather than returned.
+func (c *RollingUpdateCluster) findCanaries(cluster *api.Cluster, instanceGroups *api.InstanceGroupList, existing map[string]bool) []*cloudinstances.CloudInstanceGroupMember {
+	var igs []*api.InstanceGroup
+	for i := range instanceGroups.Items {
+		ig := &instanceGroups.Items[i]
+		if ig.Spec.Role == api.InstanceGroupRoleNode {
+			igs = append(igs, ig)
+		}
+	}
+
+	nodes, err := c.K8sClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		glog.Warningf("Unable to list nodes to find the canary instances: %v", err)
+		return nil
+	}
+
+	groups, err := c.Cloud.GetCloudGroups(cluster, igs, false, nodes.Items)
+	if err != nil {
+		glog.Warningf("Unable to list instance groups to find the canary instances: %v", err)
+		return nil
+	}
+
+	var canaries []*cloudinstances.CloudInstanceGroupMember
+	for _, group := range groups {
+		for _, u := range append(append([]*cloudinstances.CloudInstanceGroupMember{}, group.Ready...), group.NeedUpdate...) {
+			if !existing[u.ID] {
+				canaries = append(canaries, u)
+			}
+		}
+	}
+	sort.Slice(canaries, func(i, j int) bool {
+		return canaries[i].ID < canaries[j].ID
+	})
+	return canaries
+}
+
+// withoutInstances returns a copy of the group that does not include the specified instances
+func withoutInstances(group *cloudinstances.CloudInstanceGroup, remove []*cloudinstances.CloudInstanceGroupMember) *cloudinstances.CloudInstanceGroup {
+	ids := make(map[string]bool)
+	for _, u := range remove {
+		ids[u.ID] = true
+	}
+
+	filter := func(members []*cloudinstances.CloudInstanceGroupMember) []*cloudinstances.CloudInstanceGroupMember {
+		var filtered []*cloudinstances.CloudInstanceGroupMember
+		for _, u := range members {
+			if !ids[u.ID] {
+				filtered = append(filtered, u)
+			}
+		}
+		return filtered
+	}
+
+	c := *group
+	c.Ready = filter(group.Ready)
+	c.NeedUpdate = filter(group.NeedUpdate)
+	return &c
+}
+
+func describeMember(u *cloudinstances.CloudInstanceGroupMember) string {
+	if u.Node != nil && u.Node.Name != "" {
+		return fmt.Sprintf("%s (node %s)", u.ID, u.Node.Name)
+	}
+	return u.ID
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancegroups
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"k8s.io/api/core/v1"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kops/cloudmock/aws/mockautoscaling"
+	kopsapi "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/cloudinstances"
+	"k8s.io/kops/pkg/validation"
+	"k8s.io/kops/upup/pkg/fi/cloudup/awsup"
+)
+
+func countInstances(t *testing.T, cloud awsup.AWSCloud, name string) int {
+	asgGroups, err := cloud.Autoscaling().DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(name)},
+	})
+	if err != nil || len(asgGroups.AutoScalingGroups) != 1 {
+		t.Fatalf("unable to find autoscaling group %q: %v", name, err)
+	}
+	return len(asgGroups.AutoScalingGroups[0].Instances)
+}
+
+func TestRollingUpdateCanary(t *testing.T) {
+	canaryCheckInterval = time.Millisecond
+
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockcloud.MockAutoscaling = &mockautoscaling.MockAutoscaling{}
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	validations := 0
+	c := &RollingUpdateCluster{
+		Cloud:            mockcloud,
+		MasterInterval:   1 * time.Millisecond,
+		NodeInterval:     1 * time.Millisecond,
+		BastionInterval:  1 * time.Millisecond,
+		K8sClient:        fake.NewSimpleClientset(),
+		ClusterName:      cluster.Name,
+		Canary:           1,
+		CanarySoakPeriod: 5 * time.Millisecond,
+	}
+	c.validateCluster = func(cluster *kopsapi.Cluster, instanceGroups *kopsapi.InstanceGroupList, k8sClient kubernetes.Interface) (*validation.ValidationCluster, error) {
+		validations++
+		// Only the canaries have been replaced while we soak
+		for _, name := range []string{"node-1", "node-2"} {
+			if n := countInstances(t, mockcloud, name); n != 3 {
+				t.Errorf("Expected 3 instances in group %q while soaking canaries, got %d", name, n)
+			}
+		}
+		return &validation.ValidationCluster{}, nil
+	}
+
+	groups := map[string]*cloudinstances.CloudInstanceGroup{
+		"node-1": buildSurgeGroup(t, mockcloud, "node-1", kopsapi.InstanceGroupRoleNode, nil),
+		"node-2": buildSurgeGroup(t, mockcloud, "node-2", kopsapi.InstanceGroupRoleNode, nil),
+	}
+
+	err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{})
+	if err != nil {
+		t.Errorf("Error on rolling update: %v", err)
+	}
+
+	if validations == 0 {
+		t.Errorf("Expected the cluster to be validated while soaking canaries")
+	}
+	for _, name := range []string{"node-1", "node-2"} {
+		if n := countInstances(t, mockcloud, name); n != 0 {
+			t.Errorf("Expected all instances in group %q to be replaced, %d remaining", name, n)
+		}
+	}
+}
+
+func TestRollingUpdateCanaryHalts(t *testing.T) {
+	canaryCheckInterval = time.Millisecond
+
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockcloud.MockAutoscaling = &mockautoscaling.MockAutoscaling{}
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	k8sClient := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: v1meta.ObjectMeta{
+			Name:      "cassandra-0",
+			Namespace: "db",
+			Labels:    map[string]string{"app": "cassandra"},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodReady, Status: v1.ConditionFalse},
+			},
+		},
+	})
+
+	c := &RollingUpdateCluster{
+		Cloud:           mockcloud,
+		MasterInterval:  1 * time.Millisecond,
+		NodeInterval:    1 * time.Millisecond,
+		BastionInterval: 1 * time.Millisecond,
+		K8sClient:       k8sClient,
+		ClusterName:     cluster.Name,
+		Canary:          1,
+		CanaryPodChecks: []PodReadinessCheck{{Namespace: "db", Selector: "app=cassandra"}},
+	}
+	c.validateCluster = func(cluster *kopsapi.Cluster, instanceGroups *kopsapi.InstanceGroupList, k8sClient kubernetes.Interface) (*validation.ValidationCluster, error) {
+		return &validation.ValidationCluster{
+			Failures: []*validation.ValidationError{
+				{Kind: "Node", Name: "ip-172-20-1-1", Message: "node \"ip-172-20-1-1\" is not ready"},
+			},
+		}, nil
+	}
+
+	groups := map[string]*cloudinstances.CloudInstanceGroup{
+		"node-1": buildSurgeGroup(t, mockcloud, "node-1", kopsapi.InstanceGroupRoleNode, nil),
+		"node-2": buildSurgeGroup(t, mockcloud, "node-2", kopsapi.InstanceGroupRoleNode, nil),
+	}
+
+	err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{})
+	canaryErr, ok := err.(*CanaryFailedError)
+	if !ok {
+		t.Fatalf("Expected CanaryFailedError, got %v", err)
+	}
+
+	if strings.Join(canaryErr.Replaced, ",") != "node-1a,node-2a" {
+		t.Errorf("Expected canaries to have replaced node-1a and node-2a, got %v", canaryErr.Replaced)
+	}
+	if len(canaryErr.Failures) != 2 ||
+		!strings.Contains(canaryErr.Failures[0], "ip-172-20-1-1") ||
+		!strings.Contains(canaryErr.Failures[1], "db/cassandra-0") {
+		t.Errorf("Expected node and pod failures to be reported, got %v", canaryErr.Failures)
+	}
+	if !strings.Contains(err.Error(), "node-1a") || !strings.Contains(err.Error(), "db/cassandra-0") {
+		t.Errorf("Expected error to describe the instances and failures, got %q", err.Error())
+	}
+
+	for _, name := range []string{"node-1", "node-2"} {
+		if n := countInstances(t, mockcloud, name); n != 3 {
+			t.Errorf("Expected rolling update of group %q to halt after the canary, %d instances remaining", name, n)
+		}
+	}
+}
+
+func TestRollingUpdateCanaryRequiresValidation(t *testing.T) {
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockcloud.MockAutoscaling = &mockautoscaling.MockAutoscaling{}
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	c := &RollingUpdateCluster{
+		Cloud:     mockcloud,
+		CloudOnly: true,
+		Canary:    1,
+	}
+
+	groups := map[string]*cloudinstances.CloudInstanceGroup{
+		"node-1": buildSurgeGroup(t, mockcloud, "node-1", kopsapi.InstanceGroupRoleNode, nil),
+	}
+
+	if err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{}); err == nil {
+		t.Errorf("Expected error rolling canaries with cloudonly")
+	}
+	if n := countInstances(t, mockcloud, "node-1"); n != 4 {
+		t.Errorf("Expected no instances to be replaced, %d remaining", n)
+	}
+}
+
+func TestParsePodReadinessCheck(t *testing.T) {
+	grid := []struct {
+		Input     string
+		Expected  PodReadinessCheck
+		ExpectErr bool
+	}{
+		{Input: "app=cassandra", Expected: PodReadinessCheck{Selector: "app=cassandra"}},
+		{Input: "db:app=cassandra,tier!=test", Expected: PodReadinessCheck{Namespace: "db", Selector: "app=cassandra,tier!=test"}},
+		{Input: "kube-system:k8s-app in (kube-dns)", Expected: PodReadinessCheck{Namespace: "kube-system", Selector: "k8s-app in (kube-dns)"}},
+		{Input: "db:", ExpectErr: true},
+		{Input: "app in cassandra", ExpectErr: true},
+	}
+
+	for _, g := range grid {
+		check, err := ParsePodReadinessCheck(g.Input)
+		if g.ExpectErr {
+			if err == nil {
+				t.Errorf("expected error parsing %q", g.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %v", g.Input, err)
+			continue
+		}
+		if check != g.Expected {
+			t.Errorf("parsing %q: expected %v, got %v", g.Input, g.Expected, check)
+		}
+		if check.String() != g.Input {
+			t.Errorf("expected %v to format as %q, got %q", check, g.Input, check.String())
+		}
+	}
+}
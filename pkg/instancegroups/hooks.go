@@ -0,0 +1,313 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancegroups
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/cloudinstances"
+)
+
+const (
+	// defaultHookTimeout is the maximum time a single run of a hook may take, if the hook does not set a timeout
+	defaultHookTimeout = 5 * time.Minute
+	// defaultHookMaxRetries is the number of times a hook with the Retry failure policy is retried, if not set
+	defaultHookMaxRetries = 3
+	// hookNamespace is the namespace in which execContainer hooks run
+	hookNamespace = "kube-system"
+)
+
+// hookRetryInterval is the time to wait before retrying a failed hook; it is a variable so tests can shorten it
+var hookRetryInterval = 10 * time.Second
+
+// HookContext describes the point in a rolling update, and the instance, for which a hook runs
+type HookContext struct {
+	// Event is the point in the replacement of the instance
+	Event api.RollingUpdateHookEvent `json:"event"`
+	// ClusterName is the name of the cluster being rolled
+	ClusterName string `json:"clusterName"`
+	// InstanceGroup is the name of the InstanceGroup being rolled
+	InstanceGroup string `json:"instanceGroup"`
+	// InstanceID is the cloud identifier of the instance being replaced
+	InstanceID string `json:"instanceID"`
+	// NodeName is the name of the kubernetes node backed by the instance, if known
+	NodeName string `json:"nodeName,omitempty"`
+}
+
+// Hook is an action run during a rolling update
+type Hook interface {
+	// Run runs the action once, returning an error if it failed.  The context is cancelled when the hook times out.
+	Run(ctx context.Context, hookContext *HookContext) error
+}
+
+// HookBuilder builds the Hook for the action configured in a RollingUpdateHook
+type HookBuilder func(rollingUpdateData *RollingUpdateCluster, spec *api.RollingUpdateHook) (Hook, error)
+
+// BuildHook is the default HookBuilder, supporting execContainer and http actions
+func BuildHook(rollingUpdateData *RollingUpdateCluster, spec *api.RollingUpdateHook) (Hook, error) {
+	if spec.ExecContainer != nil {
+		if rollingUpdateData.K8sClient == nil {
+			return nil, fmt.Errorf("execContainer hooks cannot be run without a kubernetes client, which is not available with --cloudonly")
+		}
+		return &execContainerHook{
+			client: rollingUpdateData.K8sClient,
+			action: spec.ExecContainer,
+		}, nil
+	}
+
+	if spec.HTTP != nil {
+		return &httpHook{
+			client: http.DefaultClient,
+			action: spec.HTTP,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("hook has neither execContainer nor http set")
+}
+
+// runHooks runs the hooks of the instance group that are registered for the event, applying their failure policies.
+func (r *RollingUpdateInstanceGroup) runHooks(rollingUpdateData *RollingUpdateCluster, event api.RollingUpdateHookEvent, u *cloudinstances.CloudInstanceGroupMember) error {
+	ig := r.CloudGroup.InstanceGroup
+	if ig == nil || ig.Spec.RollingUpdate == nil {
+		return nil
+	}
+
+	for i := range ig.Spec.RollingUpdate.Hooks {
+		spec := &ig.Spec.RollingUpdate.Hooks[i]
+
+		if !hookHasEvent(spec, event) {
+			continue
+		}
+
+		hookContext := &HookContext{
+			Event:         event,
+			ClusterName:   rollingUpdateData.ClusterName,
+			InstanceGroup: ig.ObjectMeta.Name,
+			InstanceID:    u.ID,
+		}
+		if u.Node != nil {
+			hookContext.NodeName = u.Node.Name
+		}
+
+		name := spec.Name
+		if name == "" {
+			name = fmt.Sprintf("hook-%d", i)
+		}
+
+		if err := runHook(rollingUpdateData, name, spec, hookContext); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runHook runs a single hook, retrying it or ignoring its failure as configured by the failure policy
+func runHook(rollingUpdateData *RollingUpdateCluster, name string, spec *api.RollingUpdateHook, hookContext *HookContext) error {
+	builder := rollingUpdateData.HookBuilder
+	if builder == nil {
+		builder = BuildHook
+	}
+
+	hook, err := builder(rollingUpdateData, spec)
+	if err != nil {
+		return fmt.Errorf("error building rolling update hook %q: %v", name, err)
+	}
+
+	timeout := defaultHookTimeout
+	if spec.Timeout != nil {
+		timeout = spec.Timeout.Duration
+	}
+
+	attempts := 1
+	if spec.FailurePolicy == api.RollingUpdateHookFailurePolicyRetry {
+		retries := defaultHookMaxRetries
+		if spec.MaxRetries != nil {
+			retries = int(*spec.MaxRetries)
+		}
+		attempts += retries
+	}
+
+	glog.Infof("Running rolling update hook %q at %s for instance %q.", name, hookContext.Event, hookContext.InstanceID)
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = hook.Run(ctx, hookContext)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			break
+		}
+
+		glog.Warningf("Rolling update hook %q failed (attempt %d of %d), retrying: %v", name, attempt, attempts, err)
+		time.Sleep(hookRetryInterval)
+	}
+
+	if spec.FailurePolicy == api.RollingUpdateHookFailurePolicyContinue {
+		glog.Warningf("Ignoring failure of rolling update hook %q at %s for instance %q: %v", name, hookContext.Event, hookContext.InstanceID, err)
+		return nil
+	}
+
+	return fmt.Errorf("rolling update hook %q failed at %s for instance %q: %v", name, hookContext.Event, hookContext.InstanceID, err)
+}
+
+func hookHasEvent(spec *api.RollingUpdateHook, event api.RollingUpdateHookEvent) bool {
+	for _, e := range spec.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// httpHook POSTs the HookContext to a webhook
+type httpHook struct {
+	client *http.Client
+	action *api.HTTPHookAction
+}
+
+var _ Hook = &httpHook{}
+
+// Run implements Hook::Run
+func (h *httpHook) Run(ctx context.Context, hookContext *HookContext) error {
+	body, err := json.Marshal(hookContext)
+	if err != nil {
+		return fmt.Errorf("error serializing hook context: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", h.action.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error building request to %s: %v", h.action.URL, err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.action.Headers {
+		req.Header.Set(k, v)
+	}
+
+	response, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling %s: %v", h.action.URL, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("unexpected response from %s: %s %s", h.action.URL, response.Status, string(b))
+	}
+
+	return nil
+}
+
+// execContainerHook runs a container to completion as a pod in the cluster
+type execContainerHook struct {
+	client kubernetes.Interface
+	action *api.ExecContainerAction
+}
+
+var _ Hook = &execContainerHook{}
+
+// execContainerPollInterval is how often we check whether an execContainer hook has finished
+var execContainerPollInterval = 2 * time.Second
+
+// Run implements Hook::Run
+func (h *execContainerHook) Run(ctx context.Context, hookContext *HookContext) error {
+	env := []v1.EnvVar{
+		{Name: "KOPS_HOOK_EVENT", Value: string(hookContext.Event)},
+		{Name: "KOPS_CLUSTER_NAME", Value: hookContext.ClusterName},
+		{Name: "KOPS_INSTANCE_GROUP", Value: hookContext.InstanceGroup},
+		{Name: "KOPS_INSTANCE_ID", Value: hookContext.InstanceID},
+		{Name: "KOPS_NODE_NAME", Value: hookContext.NodeName},
+	}
+	var keys []string
+	for k := range h.action.Environment {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, v1.EnvVar{Name: k, Value: h.action.Environment[k]})
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "kops-rolling-update-hook-",
+			Namespace:    hookNamespace,
+			Labels: map[string]string{
+				"k8s-app": "kops-rolling-update-hook",
+			},
+		},
+		Spec: v1.PodSpec{
+			RestartPolicy: v1.RestartPolicyNever,
+			Containers: []v1.Container{
+				{
+					Name:  "hook",
+					Image: h.action.Image,
+					// As with cluster hooks, the command replaces the arguments of the image, like docker run
+					Args: h.action.Command,
+					Env:  env,
+				},
+			},
+		},
+	}
+
+	created, err := h.client.CoreV1().Pods(hookNamespace).Create(pod)
+	if err != nil {
+		return fmt.Errorf("error creating hook pod: %v", err)
+	}
+	defer func() {
+		if err := h.client.CoreV1().Pods(hookNamespace).Delete(created.Name, &metav1.DeleteOptions{}); err != nil {
+			glog.Warningf("Error deleting hook pod %s/%s: %v", hookNamespace, created.Name, err)
+		}
+	}()
+
+	err = wait.PollUntil(execContainerPollInterval, func() (bool, error) {
+		p, err := h.client.CoreV1().Pods(hookNamespace).Get(created.Name, metav1.GetOptions{})
+		if err != nil {
+			glog.V(2).Infof("Error getting hook pod %s/%s: %v", hookNamespace, created.Name, err)
+			return false, nil
+		}
+
+		switch p.Status.Phase {
+		case v1.PodSucceeded:
+			return true, nil
+		case v1.PodFailed:
+			return false, fmt.Errorf("hook pod %s/%s failed: %s", hookNamespace, created.Name, p.Status.Message)
+		default:
+			return false, nil
+		}
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out waiting for hook pod %s/%s to complete", hookNamespace, created.Name)
+	}
+	return err
+}
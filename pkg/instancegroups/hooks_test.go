@@ -0,0 +1,319 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancegroups
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"k8s.io/kops/cloudmock/aws/mockautoscaling"
+	kopsapi "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/cloudinstances"
+	"k8s.io/kops/upup/pkg/fi/cloudup/awsup"
+)
+
+// recordingHook records the contexts it is run with, failing the first failures runs
+type recordingHook struct {
+	failures int
+	runs     []HookContext
+}
+
+func (h *recordingHook) Run(ctx context.Context, hookContext *HookContext) error {
+	h.runs = append(h.runs, *hookContext)
+	if len(h.runs) <= h.failures {
+		return fmt.Errorf("hook failure %d", len(h.runs))
+	}
+	return nil
+}
+
+func (h *recordingHook) builder(rollingUpdateData *RollingUpdateCluster, spec *kopsapi.RollingUpdateHook) (Hook, error) {
+	return h, nil
+}
+
+func TestRunHookFailurePolicies(t *testing.T) {
+	hookRetryInterval = time.Millisecond
+
+	maxRetries := int32(2)
+	grid := []struct {
+		Policy           kopsapi.RollingUpdateHookFailurePolicy
+		MaxRetries       *int32
+		Failures         int
+		ExpectedAttempts int
+		ExpectErr        bool
+	}{
+		{Policy: "", Failures: 0, ExpectedAttempts: 1},
+		{Policy: "", Failures: 1, ExpectedAttempts: 1, ExpectErr: true},
+		{Policy: kopsapi.RollingUpdateHookFailurePolicyAbort, Failures: 1, ExpectedAttempts: 1, ExpectErr: true},
+		{Policy: kopsapi.RollingUpdateHookFailurePolicyContinue, Failures: 1, ExpectedAttempts: 1},
+		{Policy: kopsapi.RollingUpdateHookFailurePolicyRetry, Failures: 2, ExpectedAttempts: 3},
+		{Policy: kopsapi.RollingUpdateHookFailurePolicyRetry, Failures: 10, ExpectedAttempts: 4, ExpectErr: true},
+		{Policy: kopsapi.RollingUpdateHookFailurePolicyRetry, MaxRetries: &maxRetries, Failures: 10, ExpectedAttempts: 3, ExpectErr: true},
+	}
+
+	for _, g := range grid {
+		hook := &recordingHook{failures: g.Failures}
+		c := &RollingUpdateCluster{HookBuilder: hook.builder}
+		spec := &kopsapi.RollingUpdateHook{
+			FailurePolicy: g.Policy,
+			MaxRetries:    g.MaxRetries,
+		}
+
+		err := runHook(c, "test", spec, &HookContext{Event: kopsapi.RollingUpdateHookAfterDrain})
+		if g.ExpectErr && err == nil {
+			t.Errorf("expected error running hook with policy %q and %d failures", g.Policy, g.Failures)
+		}
+		if !g.ExpectErr && err != nil {
+			t.Errorf("unexpected error running hook with policy %q and %d failures: %v", g.Policy, g.Failures, err)
+		}
+		if len(hook.runs) != g.ExpectedAttempts {
+			t.Errorf("expected %d attempts with policy %q and %d failures, got %d", g.ExpectedAttempts, g.Policy, g.Failures, len(hook.runs))
+		}
+	}
+}
+
+func TestHTTPHook(t *testing.T) {
+	var received []HookContext
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expected configured header to be sent, got %q", r.Header.Get("Authorization"))
+		}
+		hookContext := HookContext{}
+		if err := json.NewDecoder(r.Body).Decode(&hookContext); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		received = append(received, hookContext)
+		if fail {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	c := &RollingUpdateCluster{}
+	hook, err := BuildHook(c, &kopsapi.RollingUpdateHook{
+		HTTP: &kopsapi.HTTPHookAction{
+			URL:     server.URL,
+			Headers: map[string]string{"Authorization": "Bearer secret"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error building hook: %v", err)
+	}
+
+	hookContext := &HookContext{
+		Event:         kopsapi.RollingUpdateHookAfterDrain,
+		ClusterName:   "test.k8s.local",
+		InstanceGroup: "nodes",
+		InstanceID:    "i-1",
+		NodeName:      "node-1",
+	}
+	if err := hook.Run(context.Background(), hookContext); err != nil {
+		t.Errorf("unexpected error running hook: %v", err)
+	}
+	if len(received) != 1 || !reflect.DeepEqual(received[0], *hookContext) {
+		t.Errorf("expected webhook to receive %v, got %v", *hookContext, received)
+	}
+
+	fail = true
+	if err := hook.Run(context.Background(), hookContext); err == nil {
+		t.Errorf("expected error when webhook fails")
+	}
+}
+
+func TestExecContainerHook(t *testing.T) {
+	execContainerPollInterval = time.Millisecond
+
+	for _, phase := range []v1.PodPhase{v1.PodSucceeded, v1.PodFailed} {
+		k8sClient := fake.NewSimpleClientset()
+
+		var created *v1.Pod
+		k8sClient.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+			created = action.(core.CreateAction).GetObject().(*v1.Pod).DeepCopy()
+			created.Name = "hook-pod"
+			return true, created, nil
+		})
+		k8sClient.PrependReactor("get", "pods", func(action core.Action) (bool, runtime.Object, error) {
+			p := created.DeepCopy()
+			p.Status.Phase = phase
+			return true, p, nil
+		})
+		deleted := false
+		k8sClient.PrependReactor("delete", "pods", func(action core.Action) (bool, runtime.Object, error) {
+			deleted = action.(core.DeleteAction).GetName() == "hook-pod"
+			return true, nil, nil
+		})
+
+		c := &RollingUpdateCluster{K8sClient: k8sClient}
+		hook, err := BuildHook(c, &kopsapi.RollingUpdateHook{
+			ExecContainer: &kopsapi.ExecContainerAction{
+				Image:       "busybox",
+				Command:     []string{"sh", "-c", "true"},
+				Environment: map[string]string{"FOO": "bar"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("error building hook: %v", err)
+		}
+
+		err = hook.Run(context.Background(), &HookContext{
+			Event:      kopsapi.RollingUpdateHookBeforeDrain,
+			InstanceID: "i-1",
+		})
+		if phase == v1.PodSucceeded && err != nil {
+			t.Errorf("unexpected error running hook: %v", err)
+		}
+		if phase == v1.PodFailed && err == nil {
+			t.Errorf("expected error when hook pod fails")
+		}
+
+		if created == nil {
+			t.Fatalf("expected hook pod to be created")
+		}
+		container := created.Spec.Containers[0]
+		if container.Image != "busybox" || !reflect.DeepEqual(container.Args, []string{"sh", "-c", "true"}) {
+			t.Errorf("unexpected hook container: %v", container)
+		}
+		env := make(map[string]string)
+		for _, e := range container.Env {
+			env[e.Name] = e.Value
+		}
+		if env["KOPS_HOOK_EVENT"] != "BeforeDrain" || env["KOPS_INSTANCE_ID"] != "i-1" || env["FOO"] != "bar" {
+			t.Errorf("unexpected hook environment: %v", env)
+		}
+		if !deleted {
+			t.Errorf("expected hook pod to be deleted")
+		}
+	}
+}
+
+func TestExecContainerHookRequiresClient(t *testing.T) {
+	c := &RollingUpdateCluster{CloudOnly: true}
+	_, err := BuildHook(c, &kopsapi.RollingUpdateHook{
+		ExecContainer: &kopsapi.ExecContainerAction{Image: "busybox"},
+	})
+	if err == nil {
+		t.Errorf("expected error building execContainer hook without a kubernetes client")
+	}
+}
+
+func TestRollingUpdateRunsHooks(t *testing.T) {
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockcloud.MockAutoscaling = &mockautoscaling.MockAutoscaling{}
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	hook := &recordingHook{}
+	c := &RollingUpdateCluster{
+		Cloud:           mockcloud,
+		MasterInterval:  1 * time.Millisecond,
+		NodeInterval:    1 * time.Millisecond,
+		BastionInterval: 1 * time.Millisecond,
+		CloudOnly:       true,
+		ClusterName:     cluster.Name,
+		HookBuilder:     hook.builder,
+	}
+
+	group := buildSurgeGroup(t, mockcloud, "node-1", kopsapi.InstanceGroupRoleNode, &kopsapi.RollingUpdate{
+		Hooks: []kopsapi.RollingUpdateHook{
+			{
+				Name:   "deregister",
+				Events: []kopsapi.RollingUpdateHookEvent{kopsapi.RollingUpdateHookAfterDrain, kopsapi.RollingUpdateHookAfterTerminate},
+				HTTP:   &kopsapi.HTTPHookAction{URL: "http://127.0.0.1/"},
+			},
+		},
+	})
+	group.NeedUpdate = group.NeedUpdate[:2]
+	groups := map[string]*cloudinstances.CloudInstanceGroup{"node-1": group}
+
+	err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{})
+	if err != nil {
+		t.Errorf("Error on rolling update: %v", err)
+	}
+
+	var actual []string
+	for _, run := range hook.runs {
+		if run.ClusterName != cluster.Name || run.InstanceGroup != "node-1" {
+			t.Errorf("unexpected hook context: %v", run)
+		}
+		actual = append(actual, string(run.Event)+":"+run.InstanceID)
+	}
+	expected := []string{
+		"AfterDrain:node-1a",
+		"AfterTerminate:node-1a",
+		"AfterDrain:node-1b",
+		"AfterTerminate:node-1b",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected hooks to run %v, got %v", expected, actual)
+	}
+}
+
+func TestRollingUpdateAbortsOnHookFailure(t *testing.T) {
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockcloud.MockAutoscaling = &mockautoscaling.MockAutoscaling{}
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	hook := &recordingHook{failures: 1}
+	c := &RollingUpdateCluster{
+		Cloud:           mockcloud,
+		MasterInterval:  1 * time.Millisecond,
+		NodeInterval:    1 * time.Millisecond,
+		BastionInterval: 1 * time.Millisecond,
+		CloudOnly:       true,
+		ClusterName:     cluster.Name,
+		HookBuilder:     hook.builder,
+	}
+
+	group := buildSurgeGroup(t, mockcloud, "node-1", kopsapi.InstanceGroupRoleNode, &kopsapi.RollingUpdate{
+		Hooks: []kopsapi.RollingUpdateHook{
+			{
+				Events: []kopsapi.RollingUpdateHookEvent{kopsapi.RollingUpdateHookBeforeDrain},
+				HTTP:   &kopsapi.HTTPHookAction{URL: "http://127.0.0.1/"},
+			},
+		},
+	})
+	groups := map[string]*cloudinstances.CloudInstanceGroup{"node-1": group}
+
+	err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{})
+	if err == nil {
+		t.Errorf("Expected rolling update to fail when a hook fails")
+	}
+
+	asgGroups, _ := mockcloud.Autoscaling().DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{})
+	for _, group := range asgGroups.AutoScalingGroups {
+		if len(group.Instances) != 4 {
+			t.Errorf("Expected no instances to be terminated, got %d remaining", len(group.Instances))
+		}
+	}
+}
@@ -21,9 +21,12 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	api "k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/cloudinstances"
 	"k8s.io/kops/pkg/featureflag"
@@ -40,6 +43,11 @@ type RollingUpdateInstanceGroup struct {
 	// CloudGroup is the kops cloud provider groups
 	CloudGroup *cloudinstances.CloudInstanceGroup
 
+	// maxReplacements limits the number of instances replaced by RollingUpdate, if greater than 0
+	maxReplacements int
+	// replaced records the instances that RollingUpdate terminated
+	replaced []*cloudinstances.CloudInstanceGroupMember
+
 	// TODO should remove the need to have rollingupdate struct and add:
 	// TODO - the kubernetes client
 	// TODO - the cluster name
@@ -92,11 +100,14 @@ func promptInteractive(upgradedHost string) (stopPrompting bool, err error) {
 	return stopPrompting, err
 }
 
-// TODO: Temporarily increase size of ASG?
+// surgePollInterval is the interval at which the nodes of a surged group are checked for readiness
+var surgePollInterval = 15 * time.Second
+
 // TODO: Remove from ASG first so status is immediately updated?
-// TODO: Batch termination, like a rolling-update
 
 // RollingUpdate performs a rolling update on a list of ec2 instances.
+// Instances are replaced in batches; the batch size and whether the group is temporarily
+// grown while instances are replaced are controlled by the maxSurge and maxUnavailable settings.
 func (r *RollingUpdateInstanceGroup) RollingUpdate(rollingUpdateData *RollingUpdateCluster, cluster *api.Cluster, instanceGroupList *api.InstanceGroupList, isBastion bool, sleepAfterTerminate time.Duration, validationTimeout time.Duration) (err error) {
 
 	// we should not get here, but hey I am going to check.
@@ -113,21 +124,48 @@ func (r *RollingUpdateInstanceGroup) RollingUpdate(rollingUpdateData *RollingUpd
 		return fmt.Errorf("rollingUpdate is missing the InstanceGroupList")
 	}
 
-	update := r.CloudGroup.NeedUpdate
-	if rollingUpdateData.Force {
-		update = append(update, r.CloudGroup.Ready...)
+	name := r.CloudGroup.InstanceGroup.ObjectMeta.Name
+	progress := rollingUpdateData.progress
+
+	if recorded := progress.groupProgress(name); recorded != nil && recorded.Status == ProgressStatusCompleted {
+		glog.Infof("Skipping group %q, as it was already rolled.", name)
+		return nil
 	}
 
+	update := r.instancesToUpdate(rollingUpdateData)
+
 	if len(update) == 0 {
 		return nil
 	}
 
+	// When only some of the instances are replaced, the group is not finished
+	partial := false
+	if r.maxReplacements > 0 && len(update) > r.maxReplacements {
+		update = update[:r.maxReplacements]
+		partial = true
+	}
+
+	maxSurge, maxUnavailable, err := resolveRollingUpdate(rollingUpdateData, r.CloudGroup)
+	if err != nil {
+		return err
+	}
+
+	progress.startGroup(name, update)
+	defer func() {
+		if partial && err == nil {
+			return
+		}
+		progress.finishGroup(name, err)
+	}()
+
 	if isBastion {
 		glog.V(3).Info("Not validating the cluster as instance is a bastion.")
 	} else if rollingUpdateData.CloudOnly {
 		glog.V(3).Info("Not validating cluster as validation is turned off via the cloud-only flag.")
 	} else if featureflag.DrainAndValidateRollingUpdate.Enabled() {
-		if err = r.ValidateCluster(rollingUpdateData, cluster, instanceGroupList); err != nil {
+		err = r.ValidateCluster(rollingUpdateData, cluster, instanceGroupList)
+		progress.recordValidation(name, err)
+		if err != nil {
 			if rollingUpdateData.FailOnValidate {
 				return fmt.Errorf("error validating cluster: %v", err)
 			} else {
@@ -137,12 +175,82 @@ func (r *RollingUpdateInstanceGroup) RollingUpdate(rollingUpdateData *RollingUpd
 		}
 	}
 
-	for _, u := range update {
-		instanceId := u.ID
+	originalSize := r.CloudGroup.TargetSize
+	if originalSize == 0 {
+		// Fall back to the number of instances if the cloud did not report a target size
+		originalSize = len(r.CloudGroup.Ready) + len(r.CloudGroup.NeedUpdate)
+	}
+	if recorded := progress.groupProgress(name); recorded != nil && recorded.OriginalSize > 0 {
+		// An interrupted rolling update may have left the group surged
+		originalSize = recorded.OriginalSize
+	}
+
+	// The group is grown by at most one instance per instance being replaced, and shrunk back by
+	// terminating the last of the old instances with a scale-in, so that they are not replaced
+	surge := maxSurge
+	if surge > len(update) {
+		surge = len(update)
+	}
+	if surplus := r.CloudGroup.TargetSize - originalSize; surplus > surge {
+		// Keep the instances an interrupted rolling update surged the group by, rather than letting the cloud pick instances to terminate
+		surge = surplus
+	}
+
+	scaleIn := make(map[*cloudinstances.CloudInstanceGroupMember]bool)
+	for i := len(update) - 1; i >= 0 && len(scaleIn) < surge; i-- {
+		scaleIn[update[i]] = true
+	}
+
+	if surge > 0 {
+		progress.recordOriginalSize(name, originalSize)
+
+		glog.Infof("Surging group %q from %d to %d instances.", r.CloudGroup.HumanName, originalSize, originalSize+surge)
+		if err = r.Cloud.ResizeGroup(r.CloudGroup, originalSize+surge); err != nil {
+			return fmt.Errorf("error surging group %q: %v", r.CloudGroup.HumanName, err)
+		}
+
+		defer func() {
+			if err != nil {
+				// Shrinking the group here would let the cloud pick which instances to terminate, without draining them
+				glog.Warningf("Group %q was left with up to %d surge instances; run the rolling update again with --resume to finish it.", r.CloudGroup.HumanName, surge)
+				return
+			}
+			// The scale-ins have already brought the group back to its original size; this restores the
+			// limits that were raised to fit the surge, and does not terminate any instances
+			if surge > len(scaleIn) {
+				glog.Warningf("Group %q has %d more instances than its original size of %d, which the cloud will terminate.", r.CloudGroup.HumanName, surge-len(scaleIn), originalSize)
+			}
+			if resizeErr := r.Cloud.ResizeGroup(r.CloudGroup, originalSize); resizeErr != nil {
+				err = fmt.Errorf("error restoring size of group %q: %v", r.CloudGroup.HumanName, resizeErr)
+			}
+		}()
+
+		// Wait for the surge instances to come up before we start taking instances away
+		time.Sleep(sleepAfterTerminate)
+
+		if err = r.waitForSurge(rollingUpdateData, originalSize+surge, isBastion, validationTimeout); err != nil {
+			return err
+		}
+
+		if err = r.validateAfterChange(rollingUpdateData, cluster, instanceGroupList, isBastion, validationTimeout); err != nil {
+			return err
+		}
+	}
+
+	batchSize := maxSurge + maxUnavailable
 
-		nodeName := ""
-		if u.Node != nil {
-			nodeName = u.Node.Name
+	for len(update) > 0 {
+		batch := update
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		update = update[len(batch):]
+
+		for _, u := range batch {
+			progress.setInstanceStatus(name, u, ProgressStatusInProgress)
+			if err = r.runHooks(rollingUpdateData, api.RollingUpdateHookBeforeDrain, u); err != nil {
+				return err
+			}
 		}
 
 		if isBastion {
@@ -153,31 +261,49 @@ func (r *RollingUpdateInstanceGroup) RollingUpdate(rollingUpdateData *RollingUpd
 
 		} else if featureflag.DrainAndValidateRollingUpdate.Enabled() {
 
+			if err = r.drainBatch(batch, rollingUpdateData); err != nil {
+				return err
+			}
+		}
+
+		for _, u := range batch {
+			if err = r.runHooks(rollingUpdateData, api.RollingUpdateHookAfterDrain, u); err != nil {
+				return err
+			}
+		}
+
+		var nodeNames []string
+		for _, u := range batch {
+			instanceId := u.ID
+
+			nodeName := ""
 			if u.Node != nil {
-				glog.Infof("Draining the node: %q.", nodeName)
-
-				if err = r.DrainNode(u, rollingUpdateData); err != nil {
-					if rollingUpdateData.FailOnDrainError {
-						return fmt.Errorf("failed to drain node %q: %v", nodeName, err)
-					} else {
-						glog.Infof("Ignoring error draining node %q: %v", nodeName, err)
-					}
-				}
+				nodeName = u.Node.Name
+				nodeNames = append(nodeNames, nodeName)
+			}
+
+			if scaleIn[u] {
+				err = r.ScaleInInstance(u)
 			} else {
-				glog.Warningf("Skipping drain of instance %q, because it is not registered in kubernetes", instanceId)
+				err = r.DeleteInstance(u)
 			}
-		}
+			if err != nil {
+				glog.Errorf("Error deleting aws instance %q, node %q: %v", instanceId, nodeName, err)
+				return err
+			}
+			progress.setInstanceStatus(name, u, ProgressStatusTerminated)
+			r.replaced = append(r.replaced, u)
 
-		if err = r.DeleteInstance(u); err != nil {
-			glog.Errorf("Error deleting aws instance %q, node %q: %v", instanceId, nodeName, err)
-			return err
+			if err = r.runHooks(rollingUpdateData, api.RollingUpdateHookAfterTerminate, u); err != nil {
+				return err
+			}
 		}
 
 		// Wait for the minimum interval
 		time.Sleep(sleepAfterTerminate)
 
 		if isBastion {
-			glog.Infof("Deleted a bastion instance, %s, and continuing with rolling-update.", instanceId)
+			glog.Infof("Deleted %d bastion instance(s), and continuing with rolling-update.", len(batch))
 
 			continue
 		} else if rollingUpdateData.CloudOnly {
@@ -185,19 +311,16 @@ func (r *RollingUpdateInstanceGroup) RollingUpdate(rollingUpdateData *RollingUpd
 			continue
 
 		} else if featureflag.DrainAndValidateRollingUpdate.Enabled() {
-			glog.Infof("Validating the cluster.")
-
-			if err = r.ValidateClusterWithDuration(rollingUpdateData, cluster, instanceGroupList, validationTimeout); err != nil {
-
-				if rollingUpdateData.FailOnValidate {
-					glog.Errorf("Cluster did not validate within %s", validationTimeout)
-					return fmt.Errorf("error validating cluster after removing a node: %v", err)
+			if err = r.validateAfterChange(rollingUpdateData, cluster, instanceGroupList, isBastion, validationTimeout); err != nil {
+				return err
+			}
+			for _, u := range batch {
+				if err = r.runHooks(rollingUpdateData, api.RollingUpdateHookAfterValidate, u); err != nil {
+					return err
 				}
-
-				glog.Warningf("Cluster validation failed after removing instance, proceeding since fail-on-validate is set to false: %v", err)
 			}
 			if rollingUpdateData.Interactive {
-				stopPrompting, err := promptInteractive(nodeName)
+				stopPrompting, err := promptInteractive(strings.Join(nodeNames, ", "))
 				if err != nil {
 					return err
 				}
@@ -212,6 +335,189 @@ func (r *RollingUpdateInstanceGroup) RollingUpdate(rollingUpdateData *RollingUpd
 	return nil
 }
 
+// instancesToUpdate returns the instances in the group that need replacing.
+// When resuming, instances that were already replaced are skipped, as are any
+// instances that were launched as replacements during a forced rolling update.
+func (r *RollingUpdateInstanceGroup) instancesToUpdate(rollingUpdateData *RollingUpdateCluster) []*cloudinstances.CloudInstanceGroupMember {
+	recorded := rollingUpdateData.progress.groupProgress(r.CloudGroup.InstanceGroup.ObjectMeta.Name)
+
+	var update []*cloudinstances.CloudInstanceGroupMember
+	for _, u := range r.CloudGroup.NeedUpdate {
+		if recorded != nil {
+			if i := recorded.FindInstance(u.ID); i != nil && i.Status == ProgressStatusTerminated {
+				continue
+			}
+		}
+		update = append(update, u)
+	}
+
+	if rollingUpdateData.Force {
+		for _, u := range r.CloudGroup.Ready {
+			if recorded != nil {
+				if i := recorded.FindInstance(u.ID); i == nil || i.Status == ProgressStatusTerminated {
+					continue
+				}
+			}
+			update = append(update, u)
+		}
+	}
+
+	return update
+}
+
+// resolveRollingUpdate returns the number of extra instances the group may be grown by,
+// and the number of instances that may be unavailable at the same time.
+// Values set on the RollingUpdateCluster take precedence over the InstanceGroup spec.
+func resolveRollingUpdate(rollingUpdateData *RollingUpdateCluster, group *cloudinstances.CloudInstanceGroup) (int, int, error) {
+	var maxSurge, maxUnavailable *intstr.IntOrString
+
+	if group.InstanceGroup != nil && group.InstanceGroup.Spec.RollingUpdate != nil {
+		maxSurge = group.InstanceGroup.Spec.RollingUpdate.MaxSurge
+		maxUnavailable = group.InstanceGroup.Spec.RollingUpdate.MaxUnavailable
+	}
+	if rollingUpdateData.MaxSurge != nil {
+		maxSurge = rollingUpdateData.MaxSurge
+	}
+	if rollingUpdateData.MaxUnavailable != nil {
+		maxUnavailable = rollingUpdateData.MaxUnavailable
+	}
+
+	// We only surge nodes; masters are bound to their volumes and bastions are not worth it
+	if group.InstanceGroup == nil || group.InstanceGroup.Spec.Role != api.InstanceGroupRoleNode {
+		maxSurge = nil
+	}
+
+	groupSize := len(group.Ready) + len(group.NeedUpdate)
+
+	surge := 0
+	if maxSurge != nil {
+		v, err := intstr.GetValueFromIntOrPercent(maxSurge, groupSize, true)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid maxSurge %q for group %q: %v", maxSurge.String(), group.HumanName, err)
+		}
+		surge = v
+	}
+
+	unavailable := 0
+	if maxUnavailable != nil {
+		v, err := intstr.GetValueFromIntOrPercent(maxUnavailable, groupSize, false)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid maxUnavailable %q for group %q: %v", maxUnavailable.String(), group.HumanName, err)
+		}
+		unavailable = v
+	}
+
+	if surge < 0 || unavailable < 0 {
+		return 0, 0, fmt.Errorf("maxSurge and maxUnavailable for group %q cannot be negative", group.HumanName)
+	}
+
+	// We have to replace at least one instance at a time to make progress
+	if surge == 0 && unavailable == 0 {
+		unavailable = 1
+	}
+
+	return surge, unavailable, nil
+}
+
+// drainBatch drains the nodes backing a batch of instances in parallel.
+func (r *RollingUpdateInstanceGroup) drainBatch(batch []*cloudinstances.CloudInstanceGroupMember, rollingUpdateData *RollingUpdateCluster) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(batch))
+
+	for i, u := range batch {
+		if u.Node == nil {
+			glog.Warningf("Skipping drain of instance %q, because it is not registered in kubernetes", u.ID)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, u *cloudinstances.CloudInstanceGroupMember) {
+			defer wg.Done()
+
+			glog.Infof("Draining the node: %q.", u.Node.Name)
+			if err := r.DrainNode(u, rollingUpdateData); err != nil {
+				errs[i] = fmt.Errorf("failed to drain node %q: %v", u.Node.Name, err)
+				return
+			}
+			rollingUpdateData.progress.setInstanceStatus(r.CloudGroup.InstanceGroup.ObjectMeta.Name, u, ProgressStatusDrained)
+		}(i, u)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if rollingUpdateData.FailOnDrainError {
+			return err
+		}
+		glog.Infof("Ignoring error draining node: %v", err)
+	}
+
+	return nil
+}
+
+// validateAfterChange validates the cluster after instances have been added or removed, honoring fail-on-validate.
+func (r *RollingUpdateInstanceGroup) validateAfterChange(rollingUpdateData *RollingUpdateCluster, cluster *api.Cluster, instanceGroupList *api.InstanceGroupList, isBastion bool, validationTimeout time.Duration) error {
+	if isBastion || rollingUpdateData.CloudOnly || !featureflag.DrainAndValidateRollingUpdate.Enabled() {
+		return nil
+	}
+
+	glog.Infof("Validating the cluster.")
+
+	err := r.ValidateClusterWithDuration(rollingUpdateData, cluster, instanceGroupList, validationTimeout)
+	rollingUpdateData.progress.recordValidation(r.CloudGroup.InstanceGroup.ObjectMeta.Name, err)
+	if err != nil {
+		if rollingUpdateData.FailOnValidate {
+			glog.Errorf("Cluster did not validate within %s", validationTimeout)
+			return fmt.Errorf("error validating cluster after changing group %q: %v", r.CloudGroup.HumanName, err)
+		}
+
+		glog.Warningf("Cluster validation failed after changing group %q, proceeding since fail-on-validate is set to false: %v", r.CloudGroup.HumanName, err)
+	}
+
+	return nil
+}
+
+// waitForSurge waits until the group has targetSize nodes registered in kubernetes and ready, so that surge
+// instances are serving before the instances they replace are taken away.  Unlike validation, this is not
+// relaxed by fail-on-validate, as replacing instances without their surge would reduce the capacity of the group.
+func (r *RollingUpdateInstanceGroup) waitForSurge(rollingUpdateData *RollingUpdateCluster, targetSize int, isBastion bool, timeout time.Duration) error {
+	if isBastion || rollingUpdateData.CloudOnly || !featureflag.DrainAndValidateRollingUpdate.Enabled() {
+		return nil
+	}
+
+	name := r.CloudGroup.InstanceGroup.ObjectMeta.Name
+	selector := api.NodeLabelInstanceGroup + "=" + name
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ready := 0
+		nodes, err := rollingUpdateData.K8sClient.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			glog.Warningf("error listing nodes of group %q: %v", r.CloudGroup.HumanName, err)
+		} else {
+			for i := range nodes.Items {
+				if validation.IsNodeReady(&nodes.Items[i]) {
+					ready++
+				}
+			}
+			if ready >= targetSize {
+				glog.Infof("Group %q has %d ready nodes.", r.CloudGroup.HumanName, ready)
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("group %q did not have %d ready nodes within %s, only %d were ready", r.CloudGroup.HumanName, targetSize, timeout, ready)
+		}
+
+		glog.Infof("Waiting for group %q to have %d ready nodes, %d are ready.", r.CloudGroup.HumanName, targetSize, ready)
+		time.Sleep(surgePollInterval)
+	}
+}
+
 // ValidateClusterWithDuration runs validation.ValidateCluster until either we get positive result or the timeout expires
 func (r *RollingUpdateInstanceGroup) ValidateClusterWithDuration(rollingUpdateData *RollingUpdateCluster, cluster *api.Cluster, instanceGroupList *api.InstanceGroupList, duration time.Duration) error {
 	// TODO should we expose this to the UI?
@@ -287,6 +593,21 @@ func (r *RollingUpdateInstanceGroup) DeleteInstance(u *cloudinstances.CloudInsta
 
 }
 
+// ScaleInInstance deletes a Cloud Instance and shrinks its group by one, so that it is not replaced.
+func (r *RollingUpdateInstanceGroup) ScaleInInstance(u *cloudinstances.CloudInstanceGroupMember) error {
+	nodeName := ""
+	if u.Node != nil {
+		nodeName = u.Node.Name
+	}
+	glog.Infof("Stopping instance %q, node %q, and shrinking group %q.", u.ID, nodeName, r.CloudGroup.HumanName)
+
+	if err := r.Cloud.ScaleInInstance(u); err != nil {
+		return fmt.Errorf("error scaling in instance %q: %v", u.ID, err)
+	}
+
+	return nil
+}
+
 // DrainNode drains a K8s node.
 func (r *RollingUpdateInstanceGroup) DrainNode(u *cloudinstances.CloudInstanceGroupMember, rollingUpdateData *RollingUpdateCluster) error {
 	if rollingUpdateData.ClientConfig == nil {
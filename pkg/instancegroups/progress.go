@@ -0,0 +1,337 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancegroups
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/acls"
+	api "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/cloudinstances"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// ProgressStatus is the state of a rolling update, or of one of its instance groups or instances
+type ProgressStatus string
+
+const (
+	ProgressStatusPending    ProgressStatus = "Pending"
+	ProgressStatusInProgress ProgressStatus = "InProgress"
+	ProgressStatusDrained    ProgressStatus = "Drained"
+	ProgressStatusTerminated ProgressStatus = "Terminated"
+	ProgressStatusCompleted  ProgressStatus = "Completed"
+	ProgressStatusFailed     ProgressStatus = "Failed"
+)
+
+// RollingUpdateProgress records how far a rolling update has got, so that an interrupted update can be inspected and resumed
+type RollingUpdateProgress struct {
+	// ClusterName is the name of the cluster being rolled
+	ClusterName string `json:"clusterName"`
+	// Status is the overall status of the rolling update
+	Status ProgressStatus `json:"status"`
+	// StartTime is when the rolling update was first started
+	StartTime time.Time `json:"startTime"`
+	// UpdateTime is when the progress was last recorded
+	UpdateTime time.Time `json:"updateTime"`
+	// Force records whether the rolling update was started with --force
+	Force bool `json:"force,omitempty"`
+	// Error is the error that stopped the rolling update, if any
+	Error string `json:"error,omitempty"`
+	// InstanceGroups holds the progress of each instance group that needed updating
+	InstanceGroups []*InstanceGroupProgress `json:"instanceGroups,omitempty"`
+}
+
+// InstanceGroupProgress records the progress of the rolling update of a single instance group
+type InstanceGroupProgress struct {
+	// Name is the name of the InstanceGroup
+	Name string `json:"name"`
+	// Status is the status of the rolling update of the group
+	Status ProgressStatus `json:"status"`
+	// StartTime is when the rolling update of the group was started
+	StartTime *time.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the rolling update of the group finished
+	CompletionTime *time.Time `json:"completionTime,omitempty"`
+	// Error is the error that stopped the rolling update of the group, if any
+	Error string `json:"error,omitempty"`
+	// OriginalSize is the target size of the group before it was surged, to which it is restored
+	OriginalSize int `json:"originalSize,omitempty"`
+	// Instances holds the progress of each instance being replaced
+	Instances []*InstanceProgress `json:"instances,omitempty"`
+	// Validations holds the result of every cluster validation performed while rolling the group
+	Validations []*ValidationProgress `json:"validations,omitempty"`
+}
+
+// InstanceProgress records the progress of replacing a single instance
+type InstanceProgress struct {
+	// ID is the cloud identifier of the instance
+	ID string `json:"id"`
+	// NodeName is the name of the kubernetes node backed by the instance, if known
+	NodeName string `json:"nodeName,omitempty"`
+	// Status is the status of the replacement of the instance
+	Status ProgressStatus `json:"status"`
+	// UpdateTime is when the status of the instance last changed
+	UpdateTime time.Time `json:"updateTime"`
+}
+
+// ValidationProgress records the outcome of a cluster validation
+type ValidationProgress struct {
+	// Time is when the validation finished
+	Time time.Time `json:"time"`
+	// Succeeded is true if the cluster validated
+	Succeeded bool `json:"succeeded"`
+	// Message describes the validation failure, if any
+	Message string `json:"message,omitempty"`
+}
+
+// FindInstanceGroup returns the progress for the named instance group, or nil if it is not recorded
+func (p *RollingUpdateProgress) FindInstanceGroup(name string) *InstanceGroupProgress {
+	for _, g := range p.InstanceGroups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// FindInstance returns the progress for the instance with the specified id, or nil if it is not recorded
+func (g *InstanceGroupProgress) FindInstance(id string) *InstanceProgress {
+	for _, i := range g.Instances {
+		if i.ID == id {
+			return i
+		}
+	}
+	return nil
+}
+
+// ProgressStore persists the progress of a rolling update
+type ProgressStore interface {
+	// Read returns the recorded progress, or nil if there is none
+	Read() (*RollingUpdateProgress, error)
+	// Write records the progress, replacing any existing record
+	Write(progress *RollingUpdateProgress) error
+}
+
+// VFSProgressStore is a ProgressStore that keeps the progress in the state store, under the cluster's ConfigBase
+type VFSProgressStore struct {
+	cluster *api.Cluster
+	path    vfs.Path
+}
+
+var _ ProgressStore = &VFSProgressStore{}
+
+// NewVFSProgressStore builds a ProgressStore that writes to the rollingupdate directory of the ConfigBase
+func NewVFSProgressStore(cluster *api.Cluster, configBase vfs.Path) *VFSProgressStore {
+	return &VFSProgressStore{
+		cluster: cluster,
+		path:    configBase.Join("rollingupdate", "progress"),
+	}
+}
+
+// Read implements ProgressStore::Read
+func (s *VFSProgressStore) Read() (*RollingUpdateProgress, error) {
+	data, err := s.path.ReadFile()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading rolling update progress from %s: %v", s.path, err)
+	}
+
+	progress := &RollingUpdateProgress{}
+	if err := json.Unmarshal(data, progress); err != nil {
+		return nil, fmt.Errorf("error parsing rolling update progress from %s: %v", s.path, err)
+	}
+	return progress, nil
+}
+
+// Write implements ProgressStore::Write
+func (s *VFSProgressStore) Write(progress *RollingUpdateProgress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializing rolling update progress: %v", err)
+	}
+
+	acl, err := acls.GetACL(s.path, s.cluster)
+	if err != nil {
+		return err
+	}
+
+	if err := s.path.WriteFile(bytes.NewReader(data), acl); err != nil {
+		return fmt.Errorf("error writing rolling update progress to %s: %v", s.path, err)
+	}
+	return nil
+}
+
+// progressTracker records changes to the progress of a rolling update, persisting them after each change.
+// All methods are safe to call on a nil progressTracker, in which case nothing is recorded.
+type progressTracker struct {
+	mutex    sync.Mutex
+	store    ProgressStore
+	progress *RollingUpdateProgress
+}
+
+// update applies a change to the progress and persists it.
+// Failing to persist progress is not fatal to the rolling update, so errors are only logged.
+func (t *progressTracker) update(fn func(p *RollingUpdateProgress)) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	fn(t.progress)
+	t.progress.UpdateTime = time.Now().UTC()
+
+	if err := t.store.Write(t.progress); err != nil {
+		glog.Warningf("Unable to record rolling update progress: %v", err)
+	}
+}
+
+// updateGroup applies a change to the progress of an instance group, recording the group if needed
+func (t *progressTracker) updateGroup(name string, fn func(g *InstanceGroupProgress)) {
+	t.update(func(p *RollingUpdateProgress) {
+		g := p.FindInstanceGroup(name)
+		if g == nil {
+			g = &InstanceGroupProgress{Name: name, Status: ProgressStatusPending}
+			p.InstanceGroups = append(p.InstanceGroups, g)
+		}
+		fn(g)
+	})
+}
+
+// groupProgress returns a copy of the recorded progress of an instance group, or nil if it is not recorded
+func (t *progressTracker) groupProgress(name string) *InstanceGroupProgress {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	g := t.progress.FindInstanceGroup(name)
+	if g == nil {
+		return nil
+	}
+
+	c := *g
+	c.Instances = nil
+	for _, i := range g.Instances {
+		ic := *i
+		c.Instances = append(c.Instances, &ic)
+	}
+	return &c
+}
+
+// startGroup marks an instance group as in progress, recording the instances that are to be replaced
+func (t *progressTracker) startGroup(name string, instances []*cloudinstances.CloudInstanceGroupMember) {
+	now := time.Now().UTC()
+	t.updateGroup(name, func(g *InstanceGroupProgress) {
+		g.Status = ProgressStatusInProgress
+		g.Error = ""
+		if g.StartTime == nil {
+			g.StartTime = &now
+		}
+		for _, u := range instances {
+			if g.FindInstance(u.ID) != nil {
+				continue
+			}
+			i := &InstanceProgress{
+				ID:         u.ID,
+				Status:     ProgressStatusPending,
+				UpdateTime: now,
+			}
+			if u.Node != nil {
+				i.NodeName = u.Node.Name
+			}
+			g.Instances = append(g.Instances, i)
+		}
+	})
+}
+
+// recordOriginalSize records the size of an instance group before it is surged, unless it is already recorded
+func (t *progressTracker) recordOriginalSize(name string, size int) {
+	t.updateGroup(name, func(g *InstanceGroupProgress) {
+		if g.OriginalSize == 0 {
+			g.OriginalSize = size
+		}
+	})
+}
+
+// finishGroup marks an instance group as completed, or as failed if err is not nil
+func (t *progressTracker) finishGroup(name string, err error) {
+	now := time.Now().UTC()
+	t.updateGroup(name, func(g *InstanceGroupProgress) {
+		if err != nil {
+			g.Status = ProgressStatusFailed
+			g.Error = err.Error()
+			return
+		}
+		g.Status = ProgressStatusCompleted
+		g.CompletionTime = &now
+	})
+}
+
+// setInstanceStatus records a new status for an instance of an instance group
+func (t *progressTracker) setInstanceStatus(name string, u *cloudinstances.CloudInstanceGroupMember, status ProgressStatus) {
+	now := time.Now().UTC()
+	t.updateGroup(name, func(g *InstanceGroupProgress) {
+		i := g.FindInstance(u.ID)
+		if i == nil {
+			i = &InstanceProgress{ID: u.ID}
+			if u.Node != nil {
+				i.NodeName = u.Node.Name
+			}
+			g.Instances = append(g.Instances, i)
+		}
+		i.Status = status
+		i.UpdateTime = now
+	})
+}
+
+// recordValidation records the outcome of a cluster validation performed while rolling an instance group
+func (t *progressTracker) recordValidation(name string, err error) {
+	v := &ValidationProgress{
+		Time:      time.Now().UTC(),
+		Succeeded: err == nil,
+	}
+	if err != nil {
+		v.Message = err.Error()
+	}
+	t.updateGroup(name, func(g *InstanceGroupProgress) {
+		g.Validations = append(g.Validations, v)
+	})
+}
+
+// finish marks the rolling update as completed, or as failed if err is not nil
+func (t *progressTracker) finish(err error) {
+	t.update(func(p *RollingUpdateProgress) {
+		if err != nil {
+			p.Status = ProgressStatusFailed
+			p.Error = err.Error()
+			return
+		}
+		p.Status = ProgressStatusCompleted
+		p.Error = ""
+	})
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancegroups
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	kopsapi "k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/cloudinstances"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestVFSProgressStoreRoundTrip(t *testing.T) {
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	configBase := vfs.NewMemFSPath(vfs.NewMemFSContext(), "memfs://tests/test.k8s.local")
+	store := NewVFSProgressStore(cluster, configBase)
+
+	progress, err := store.Read()
+	if err != nil {
+		t.Fatalf("unexpected error reading empty store: %v", err)
+	}
+	if progress != nil {
+		t.Fatalf("expected no progress in empty store, got %v", progress)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	written := &RollingUpdateProgress{
+		ClusterName: cluster.Name,
+		Status:      ProgressStatusInProgress,
+		StartTime:   now,
+		UpdateTime:  now,
+		Force:       true,
+		InstanceGroups: []*InstanceGroupProgress{
+			{
+				Name:      "nodes",
+				Status:    ProgressStatusInProgress,
+				StartTime: &now,
+				Instances: []*InstanceProgress{
+					{ID: "i-1", Status: ProgressStatusTerminated, UpdateTime: now},
+					{ID: "i-2", Status: ProgressStatusPending, UpdateTime: now},
+				},
+			},
+		},
+	}
+	if err := store.Write(written); err != nil {
+		t.Fatalf("unexpected error writing progress: %v", err)
+	}
+
+	if _, err := configBase.Join("rollingupdate", "progress").ReadFile(); err != nil {
+		t.Fatalf("expected progress to be written under the config base: %v", err)
+	}
+
+	read, err := store.Read()
+	if err != nil {
+		t.Fatalf("unexpected error reading progress: %v", err)
+	}
+	if read == nil {
+		t.Fatalf("expected to read back progress")
+	}
+	if read.ClusterName != cluster.Name || read.Status != ProgressStatusInProgress || !read.Force || !read.StartTime.Equal(now) {
+		t.Errorf("unexpected progress read back: %+v", read)
+	}
+	g := read.FindInstanceGroup("nodes")
+	if g == nil {
+		t.Fatalf("expected to find instance group nodes")
+	}
+	if i := g.FindInstance("i-1"); i == nil || i.Status != ProgressStatusTerminated {
+		t.Errorf("unexpected progress for instance i-1: %+v", i)
+	}
+	if i := g.FindInstance("i-3"); i != nil {
+		t.Errorf("unexpected progress for unknown instance: %+v", i)
+	}
+}
+
+// memoryProgressStore is a ProgressStore that counts writes, for testing
+type memoryProgressStore struct {
+	progress *RollingUpdateProgress
+	writes   int
+}
+
+var _ ProgressStore = &memoryProgressStore{}
+
+func (s *memoryProgressStore) Read() (*RollingUpdateProgress, error) {
+	return s.progress, nil
+}
+
+func (s *memoryProgressStore) Write(progress *RollingUpdateProgress) error {
+	s.progress = progress
+	s.writes++
+	return nil
+}
+
+func TestProgressTracker(t *testing.T) {
+	store := &memoryProgressStore{}
+	tracker := &progressTracker{
+		store:    store,
+		progress: &RollingUpdateProgress{Status: ProgressStatusInProgress},
+	}
+
+	members := []*cloudinstances.CloudInstanceGroupMember{
+		{ID: "i-1"},
+		{ID: "i-2"},
+	}
+
+	tracker.startGroup("nodes", members)
+	tracker.setInstanceStatus("nodes", members[0], ProgressStatusDrained)
+	tracker.setInstanceStatus("nodes", members[0], ProgressStatusTerminated)
+	tracker.recordValidation("nodes", fmt.Errorf("node not ready"))
+	tracker.recordValidation("nodes", nil)
+
+	g := tracker.groupProgress("nodes")
+	if g == nil {
+		t.Fatalf("expected group to be recorded")
+	}
+	if g.Status != ProgressStatusInProgress || g.StartTime == nil {
+		t.Errorf("expected group to be in progress, got %+v", g)
+	}
+	if len(g.Instances) != 2 {
+		t.Fatalf("expected 2 instances to be recorded, got %d", len(g.Instances))
+	}
+	if g.Instances[0].Status != ProgressStatusTerminated || g.Instances[1].Status != ProgressStatusPending {
+		t.Errorf("unexpected instance status: %s, %s", g.Instances[0].Status, g.Instances[1].Status)
+	}
+	if len(g.Validations) != 2 || g.Validations[0].Succeeded || g.Validations[0].Message != "node not ready" || !g.Validations[1].Succeeded {
+		t.Errorf("unexpected validations recorded: %+v", g.Validations)
+	}
+
+	// groupProgress returns a copy, so changes are not visible to the caller
+	g.Instances[1].Status = ProgressStatusFailed
+	if tracker.groupProgress("nodes").Instances[1].Status != ProgressStatusPending {
+		t.Errorf("expected groupProgress to return a copy")
+	}
+
+	tracker.finishGroup("nodes", nil)
+	tracker.finish(nil)
+
+	if store.writes != 7 {
+		t.Errorf("expected every change to be persisted, got %d writes", store.writes)
+	}
+	if store.progress.Status != ProgressStatusCompleted {
+		t.Errorf("expected rolling update to be completed, got %s", store.progress.Status)
+	}
+	if g := store.progress.FindInstanceGroup("nodes"); g.Status != ProgressStatusCompleted || g.CompletionTime == nil {
+		t.Errorf("expected group to be completed, got %+v", g)
+	}
+
+	// A nil tracker records nothing
+	var nilTracker *progressTracker
+	nilTracker.startGroup("nodes", members)
+	nilTracker.finish(fmt.Errorf("failed"))
+	if nilTracker.groupProgress("nodes") != nil {
+		t.Errorf("expected nil tracker to record nothing")
+	}
+}
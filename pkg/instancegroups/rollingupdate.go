@@ -22,10 +22,12 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	api "k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/cloudinstances"
+	"k8s.io/kops/pkg/validation"
 	"k8s.io/kops/upup/pkg/fi"
 )
 
@@ -56,6 +58,81 @@ type RollingUpdateCluster struct {
 
 	// ValidationTimeout is the maximum time to wait for the cluster to validate, once we start validation
 	ValidationTimeout time.Duration
+
+	// MaxSurge overrides the maxSurge of every node InstanceGroup, if set
+	MaxSurge *intstr.IntOrString
+	// MaxUnavailable overrides the maxUnavailable of every InstanceGroup, if set
+	MaxUnavailable *intstr.IntOrString
+
+	// ProgressStore records the progress of the rolling update, if set
+	ProgressStore ProgressStore
+	// Resume continues the rolling update recorded in the ProgressStore, instead of starting a new one
+	Resume bool
+
+	// HookBuilder builds the hooks configured on the InstanceGroups; defaults to BuildHook
+	HookBuilder HookBuilder
+
+	// Canary is the number of instances in each node InstanceGroup to replace, and check, before rolling the rest
+	Canary int
+	// CanarySoakPeriod is how long the cluster must stay healthy after the canary instances are replaced
+	CanarySoakPeriod time.Duration
+	// CanaryPodChecks are the pods that must be ready for the canary instances to be considered healthy
+	CanaryPodChecks []PodReadinessCheck
+
+	// validateCluster validates the cluster while the canaries soak; defaults to validation.ValidateCluster
+	validateCluster func(cluster *api.Cluster, instanceGroups *api.InstanceGroupList, k8sClient kubernetes.Interface) (*validation.ValidationCluster, error)
+
+	progress *progressTracker
+}
+
+// initProgress loads or starts the record of the rolling update progress, if a ProgressStore is configured.
+func (c *RollingUpdateCluster) initProgress() error {
+	if c.ProgressStore == nil {
+		if c.Resume {
+			return fmt.Errorf("cannot resume a rolling update without a progress store")
+		}
+		return nil
+	}
+
+	existing, err := c.ProgressStore.Read()
+	if err != nil {
+		return err
+	}
+
+	if c.Resume {
+		if existing == nil {
+			return fmt.Errorf("no rolling update of cluster %q was found to resume", c.ClusterName)
+		}
+		if existing.Status == ProgressStatusCompleted {
+			return fmt.Errorf("the rolling update of cluster %q started at %s has already completed", c.ClusterName, existing.StartTime)
+		}
+
+		glog.Infof("Resuming rolling update of cluster %q started at %s.", c.ClusterName, existing.StartTime)
+		existing.Status = ProgressStatusInProgress
+		existing.Error = ""
+		// Keep the behaviour of the original run, so we roll the same set of instances
+		c.Force = c.Force || existing.Force
+		c.progress = &progressTracker{store: c.ProgressStore, progress: existing}
+	} else {
+		if existing != nil && existing.Status != ProgressStatusCompleted {
+			glog.Warningf("Found an unfinished rolling update of cluster %q started at %s; starting a new rolling update (use --resume to continue it instead).", c.ClusterName, existing.StartTime)
+		}
+
+		c.progress = &progressTracker{
+			store: c.ProgressStore,
+			progress: &RollingUpdateProgress{
+				ClusterName: c.ClusterName,
+				Status:      ProgressStatusInProgress,
+				StartTime:   time.Now().UTC(),
+				Force:       c.Force,
+			},
+		}
+	}
+
+	// Record that we have started before we make any changes
+	c.progress.update(func(p *RollingUpdateProgress) {})
+
+	return nil
 }
 
 // RollingUpdate performs a rolling update on a K8s Cluster.
@@ -65,6 +142,14 @@ func (c *RollingUpdateCluster) RollingUpdate(groups map[string]*cloudinstances.C
 		return nil
 	}
 
+	if c.Canary > 0 && (c.CloudOnly || c.K8sClient == nil) {
+		return fmt.Errorf("canary instances cannot be checked without validating the cluster, which is not possible with --cloudonly")
+	}
+
+	if err := c.initProgress(); err != nil {
+		return err
+	}
+
 	var resultsMutex sync.Mutex
 	results := make(map[string]error)
 
@@ -146,6 +231,21 @@ func (c *RollingUpdateCluster) RollingUpdate(groups map[string]*cloudinstances.C
 		wg.Wait()
 	}
 
+	// Replace a few canary nodes in each group, and make sure the cluster stays healthy before rolling the rest
+	if c.Canary > 0 && len(nodeGroups) != 0 {
+		for _, err := range results {
+			if err != nil {
+				c.progress.finish(err)
+				return err
+			}
+		}
+
+		if err := c.rollCanaries(nodeGroups, cluster, instanceGroups); err != nil {
+			c.progress.finish(err)
+			return err
+		}
+	}
+
 	// Upgrade nodes, with greater parallelism
 	{
 		var wg sync.WaitGroup
@@ -186,10 +286,13 @@ func (c *RollingUpdateCluster) RollingUpdate(groups map[string]*cloudinstances.C
 
 	for _, err := range results {
 		if err != nil {
+			c.progress.finish(err)
 			return err
 		}
 	}
 
+	c.progress.finish(nil)
+
 	glog.Infof("Rolling update completed for cluster %q!", c.ClusterName)
 	return nil
 }
@@ -17,6 +17,8 @@ limitations under the License.
 package instancegroups
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -25,6 +27,8 @@ import (
 
 	"k8s.io/api/core/v1"
 	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/kops/cloudmock/aws/mockautoscaling"
 	kopsapi "k8s.io/kops/pkg/apis/kops"
@@ -679,3 +683,487 @@ func TestRollingUpdateUnknownRole(t *testing.T) {
 		}
 	}
 }
+
+// recordingAutoscaling records the desired capacities requested through UpdateAutoScalingGroup
+type recordingAutoscaling struct {
+	*mockautoscaling.MockAutoscaling
+	desiredCapacities []int64
+	scaledIn          []string
+}
+
+func (m *recordingAutoscaling) TerminateInstanceInAutoScalingGroup(input *autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
+	if aws.BoolValue(input.ShouldDecrementDesiredCapacity) {
+		m.scaledIn = append(m.scaledIn, aws.StringValue(input.InstanceId))
+	}
+	return m.MockAutoscaling.TerminateInstanceInAutoScalingGroup(input)
+}
+
+func (m *recordingAutoscaling) UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	m.desiredCapacities = append(m.desiredCapacities, aws.Int64Value(input.DesiredCapacity))
+	return m.MockAutoscaling.UpdateAutoScalingGroup(input)
+}
+
+func buildSurgeGroup(t *testing.T, cloud awsup.AWSCloud, name string, role kopsapi.InstanceGroupRole, rollingUpdate *kopsapi.RollingUpdate) *cloudinstances.CloudInstanceGroup {
+	cloud.Autoscaling().CreateAutoScalingGroup(&autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(name),
+		MinSize:              aws.Int64(1),
+		MaxSize:              aws.Int64(4),
+		DesiredCapacity:      aws.Int64(4),
+	})
+
+	var ids []*string
+	var members []*cloudinstances.CloudInstanceGroupMember
+	for _, suffix := range []string{"a", "b", "c", "d"} {
+		ids = append(ids, aws.String(name+suffix))
+		members = append(members, &cloudinstances.CloudInstanceGroupMember{
+			ID:   name + suffix,
+			Node: &v1.Node{},
+		})
+	}
+	cloud.Autoscaling().AttachInstances(&autoscaling.AttachInstancesInput{
+		AutoScalingGroupName: aws.String(name),
+		InstanceIds:          ids,
+	})
+
+	asgGroups, err := cloud.Autoscaling().DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(name)},
+	})
+	if err != nil || len(asgGroups.AutoScalingGroups) != 1 {
+		t.Fatalf("unable to find autoscaling group %q: %v", name, err)
+	}
+
+	return &cloudinstances.CloudInstanceGroup{
+		HumanName: name,
+		InstanceGroup: &kopsapi.InstanceGroup{
+			ObjectMeta: v1meta.ObjectMeta{
+				Name: name,
+			},
+			Spec: kopsapi.InstanceGroupSpec{
+				Role:          role,
+				RollingUpdate: rollingUpdate,
+			},
+		},
+		NeedUpdate: members,
+		MinSize:    1,
+		MaxSize:    4,
+		TargetSize: 4,
+		Raw:        asgGroups.AutoScalingGroups[0],
+	}
+}
+
+// readyNodes returns count ready nodes labelled as members of the instance group
+func readyNodes(groupName string, count int) []runtime.Object {
+	var nodes []runtime.Object
+	for i := 0; i < count; i++ {
+		nodes = append(nodes, &v1.Node{
+			ObjectMeta: v1meta.ObjectMeta{
+				Name:   fmt.Sprintf("%s-%d", groupName, i),
+				Labels: map[string]string{kopsapi.NodeLabelInstanceGroup: groupName},
+			},
+			Status: v1.NodeStatus{
+				Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+			},
+		})
+	}
+	return nodes
+}
+
+func TestRollingUpdateMaxSurge(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(readyNodes("node-1", 6)...)
+
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockAutoscaling := &recordingAutoscaling{MockAutoscaling: &mockautoscaling.MockAutoscaling{}}
+	mockcloud.MockAutoscaling = mockAutoscaling
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	c := &RollingUpdateCluster{
+		Cloud:           mockcloud,
+		MasterInterval:  1 * time.Millisecond,
+		NodeInterval:    1 * time.Millisecond,
+		BastionInterval: 1 * time.Millisecond,
+		Force:           false,
+		K8sClient:       k8sClient,
+	}
+	cloud := c.Cloud.(awsup.AWSCloud)
+
+	maxSurge := intstr.FromString("50%")
+	groups := make(map[string]*cloudinstances.CloudInstanceGroup)
+	groups["node-1"] = buildSurgeGroup(t, cloud, "node-1", kopsapi.InstanceGroupRoleNode, &kopsapi.RollingUpdate{
+		MaxSurge: &maxSurge,
+	})
+
+	err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{})
+	if err != nil {
+		t.Errorf("Error on rolling update: %v", err)
+	}
+
+	if !reflect.DeepEqual(mockAutoscaling.desiredCapacities, []int64{6, 4}) {
+		t.Errorf("Expected group to be surged to 6 and restored to 4, got %v", mockAutoscaling.desiredCapacities)
+	}
+
+	// The group must be shrunk by terminating the last old instances, not by lowering its desired capacity
+	if !reflect.DeepEqual(mockAutoscaling.scaledIn, []string{"node-1c", "node-1d"}) {
+		t.Errorf("Expected the last 2 instances to be scaled in, got %v", mockAutoscaling.scaledIn)
+	}
+
+	asgGroups, _ := cloud.Autoscaling().DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String("node-1")},
+	})
+	for _, group := range asgGroups.AutoScalingGroups {
+		if len(group.Instances) != 0 {
+			t.Errorf("Expected all instances to be terminated, got: %v", len(group.Instances))
+		}
+		if aws.Int64Value(group.DesiredCapacity) != 4 {
+			t.Errorf("Expected desired capacity to be restored to 4, got: %v", aws.Int64Value(group.DesiredCapacity))
+		}
+		if aws.Int64Value(group.MaxSize) != 4 {
+			t.Errorf("Expected max size to be restored to 4, got: %v", aws.Int64Value(group.MaxSize))
+		}
+	}
+}
+
+func TestRollingUpdateMaxSurgeWaitsForReadyNodes(t *testing.T) {
+	defer func(interval time.Duration) { surgePollInterval = interval }(surgePollInterval)
+	surgePollInterval = time.Millisecond
+
+	// Only 5 of the 6 nodes of the surged group become ready
+	k8sClient := fake.NewSimpleClientset(readyNodes("node-1", 5)...)
+
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockAutoscaling := &recordingAutoscaling{MockAutoscaling: &mockautoscaling.MockAutoscaling{}}
+	mockcloud.MockAutoscaling = mockAutoscaling
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	c := &RollingUpdateCluster{
+		Cloud:             mockcloud,
+		MasterInterval:    1 * time.Millisecond,
+		NodeInterval:      1 * time.Millisecond,
+		BastionInterval:   1 * time.Millisecond,
+		K8sClient:         k8sClient,
+		ValidationTimeout: 20 * time.Millisecond,
+	}
+	cloud := c.Cloud.(awsup.AWSCloud)
+
+	maxSurge := intstr.FromInt(2)
+	groups := make(map[string]*cloudinstances.CloudInstanceGroup)
+	groups["node-1"] = buildSurgeGroup(t, cloud, "node-1", kopsapi.InstanceGroupRoleNode, &kopsapi.RollingUpdate{
+		MaxSurge: &maxSurge,
+	})
+
+	err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{})
+	if err == nil {
+		t.Fatalf("Expected rolling update to fail when the surge nodes do not become ready")
+	}
+
+	// No instance may be taken away, and the group is left surged rather than shrunk by the cloud
+	if !reflect.DeepEqual(mockAutoscaling.desiredCapacities, []int64{6}) {
+		t.Errorf("Expected group to be surged to 6 and left surged, got %v", mockAutoscaling.desiredCapacities)
+	}
+	asgGroups, _ := cloud.Autoscaling().DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String("node-1")},
+	})
+	for _, group := range asgGroups.AutoScalingGroups {
+		if len(group.Instances) != 4 {
+			t.Errorf("Expected no instances to be terminated, got %d instances", len(group.Instances))
+		}
+	}
+}
+
+func TestRollingUpdateMaxSurgeIgnoredForMasters(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockAutoscaling := &recordingAutoscaling{MockAutoscaling: &mockautoscaling.MockAutoscaling{}}
+	mockcloud.MockAutoscaling = mockAutoscaling
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	maxSurge := intstr.FromInt(2)
+	c := &RollingUpdateCluster{
+		Cloud:           mockcloud,
+		MasterInterval:  1 * time.Millisecond,
+		NodeInterval:    1 * time.Millisecond,
+		BastionInterval: 1 * time.Millisecond,
+		Force:           false,
+		K8sClient:       k8sClient,
+		MaxSurge:        &maxSurge,
+	}
+	cloud := c.Cloud.(awsup.AWSCloud)
+
+	groups := make(map[string]*cloudinstances.CloudInstanceGroup)
+	groups["master-1"] = buildSurgeGroup(t, cloud, "master-1", kopsapi.InstanceGroupRoleMaster, nil)
+
+	err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{})
+	if err != nil {
+		t.Errorf("Error on rolling update: %v", err)
+	}
+
+	if len(mockAutoscaling.desiredCapacities) != 0 {
+		t.Errorf("Expected master group not to be resized, got %v", mockAutoscaling.desiredCapacities)
+	}
+
+	asgGroups, _ := cloud.Autoscaling().DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String("master-1")},
+	})
+	for _, group := range asgGroups.AutoScalingGroups {
+		if len(group.Instances) != 0 {
+			t.Errorf("Expected all instances to be terminated, got: %v", len(group.Instances))
+		}
+	}
+}
+
+func TestResolveRollingUpdate(t *testing.T) {
+	intOrString := func(v intstr.IntOrString) *intstr.IntOrString {
+		return &v
+	}
+
+	grid := []struct {
+		Role                   kopsapi.InstanceGroupRole
+		Spec                   *kopsapi.RollingUpdate
+		MaxSurge               *intstr.IntOrString
+		MaxUnavailable         *intstr.IntOrString
+		ExpectedMaxSurge       int
+		ExpectedMaxUnavailable int
+	}{
+		{
+			Role:                   kopsapi.InstanceGroupRoleNode,
+			ExpectedMaxSurge:       0,
+			ExpectedMaxUnavailable: 1,
+		},
+		{
+			Role: kopsapi.InstanceGroupRoleNode,
+			Spec: &kopsapi.RollingUpdate{
+				MaxSurge: intOrString(intstr.FromString("25%")),
+			},
+			ExpectedMaxSurge:       2,
+			ExpectedMaxUnavailable: 0,
+		},
+		{
+			Role: kopsapi.InstanceGroupRoleNode,
+			Spec: &kopsapi.RollingUpdate{
+				MaxUnavailable: intOrString(intstr.FromString("25%")),
+			},
+			ExpectedMaxSurge:       0,
+			ExpectedMaxUnavailable: 1,
+		},
+		{
+			Role: kopsapi.InstanceGroupRoleNode,
+			Spec: &kopsapi.RollingUpdate{
+				MaxSurge:       intOrString(intstr.FromInt(1)),
+				MaxUnavailable: intOrString(intstr.FromInt(1)),
+			},
+			MaxSurge:               intOrString(intstr.FromInt(3)),
+			ExpectedMaxSurge:       3,
+			ExpectedMaxUnavailable: 1,
+		},
+		{
+			Role: kopsapi.InstanceGroupRoleNode,
+			Spec: &kopsapi.RollingUpdate{
+				MaxSurge:       intOrString(intstr.FromInt(0)),
+				MaxUnavailable: intOrString(intstr.FromInt(0)),
+			},
+			ExpectedMaxSurge:       0,
+			ExpectedMaxUnavailable: 1,
+		},
+		{
+			Role:                   kopsapi.InstanceGroupRoleMaster,
+			MaxSurge:               intOrString(intstr.FromInt(1)),
+			ExpectedMaxSurge:       0,
+			ExpectedMaxUnavailable: 1,
+		},
+	}
+
+	for _, g := range grid {
+		var members []*cloudinstances.CloudInstanceGroupMember
+		for i := 0; i < 5; i++ {
+			members = append(members, &cloudinstances.CloudInstanceGroupMember{})
+		}
+		group := &cloudinstances.CloudInstanceGroup{
+			InstanceGroup: &kopsapi.InstanceGroup{
+				Spec: kopsapi.InstanceGroupSpec{
+					Role:          g.Role,
+					RollingUpdate: g.Spec,
+				},
+			},
+			Ready:      members[:2],
+			NeedUpdate: members[2:],
+		}
+		c := &RollingUpdateCluster{
+			MaxSurge:       g.MaxSurge,
+			MaxUnavailable: g.MaxUnavailable,
+		}
+
+		maxSurge, maxUnavailable, err := resolveRollingUpdate(c, group)
+		if err != nil {
+			t.Errorf("unexpected error resolving %v: %v", g, err)
+			continue
+		}
+		if maxSurge != g.ExpectedMaxSurge || maxUnavailable != g.ExpectedMaxUnavailable {
+			t.Errorf("unexpected result resolving %v: maxSurge=%d maxUnavailable=%d", g, maxSurge, maxUnavailable)
+		}
+	}
+}
+
+func TestRollingUpdateResume(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockcloud.MockAutoscaling = &mockautoscaling.MockAutoscaling{}
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	// An earlier rolling update replaced node-1a, then was interrupted; node-1e is its replacement
+	startTime := time.Now().UTC().Add(-time.Hour)
+	store := &memoryProgressStore{
+		progress: &RollingUpdateProgress{
+			ClusterName: cluster.Name,
+			Status:      ProgressStatusFailed,
+			StartTime:   startTime,
+			Force:       true,
+			InstanceGroups: []*InstanceGroupProgress{
+				{
+					Name:   "node-1",
+					Status: ProgressStatusFailed,
+					Instances: []*InstanceProgress{
+						{ID: "node-1a", Status: ProgressStatusTerminated},
+						{ID: "node-1b", Status: ProgressStatusPending},
+						{ID: "node-1c", Status: ProgressStatusPending},
+						{ID: "node-1d", Status: ProgressStatusPending},
+					},
+				},
+			},
+		},
+	}
+
+	c := &RollingUpdateCluster{
+		Cloud:           mockcloud,
+		MasterInterval:  1 * time.Millisecond,
+		NodeInterval:    1 * time.Millisecond,
+		BastionInterval: 1 * time.Millisecond,
+		K8sClient:       k8sClient,
+		ClusterName:     cluster.Name,
+		ProgressStore:   store,
+		Resume:          true,
+	}
+	cloud := c.Cloud.(awsup.AWSCloud)
+
+	group := buildSurgeGroup(t, cloud, "node-1", kopsapi.InstanceGroupRoleNode, nil)
+	// The instances all run the current configuration, and are only being rolled because the original update was forced
+	group.Ready = append(group.NeedUpdate[1:], &cloudinstances.CloudInstanceGroupMember{ID: "node-1e", Node: &v1.Node{}})
+	group.NeedUpdate = nil
+	groups := map[string]*cloudinstances.CloudInstanceGroup{"node-1": group}
+
+	err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{})
+	if err != nil {
+		t.Errorf("Error on rolling update: %v", err)
+	}
+
+	asgGroups, _ := cloud.Autoscaling().DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String("node-1")},
+	})
+	for _, group := range asgGroups.AutoScalingGroups {
+		if len(group.Instances) != 1 || aws.StringValue(group.Instances[0].InstanceId) != "node-1a" {
+			t.Errorf("Expected only the instances recorded as pending to be terminated, got: %v", group.Instances)
+		}
+	}
+
+	if store.progress.Status != ProgressStatusCompleted || !store.progress.StartTime.Equal(startTime) {
+		t.Errorf("Expected the resumed rolling update to complete, got %+v", store.progress)
+	}
+	g := store.progress.FindInstanceGroup("node-1")
+	if g == nil || g.Status != ProgressStatusCompleted {
+		t.Fatalf("Expected group to be completed, got %+v", g)
+	}
+	for _, i := range g.Instances {
+		if i.Status != ProgressStatusTerminated {
+			t.Errorf("Expected instance %s to be terminated, got %s", i.ID, i.Status)
+		}
+	}
+	if g.FindInstance("node-1e") != nil {
+		t.Errorf("Expected replacement instance not to be rolled")
+	}
+
+	// Nothing is left to resume
+	if err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{}); err == nil {
+		t.Errorf("Expected error resuming a completed rolling update")
+	}
+}
+
+func TestRollingUpdateResumeSurged(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(readyNodes("node-1", 6)...)
+
+	mockcloud := awsup.BuildMockAWSCloud("us-east-1", "abc")
+	mockAutoscaling := &recordingAutoscaling{MockAutoscaling: &mockautoscaling.MockAutoscaling{}}
+	mockcloud.MockAutoscaling = mockAutoscaling
+
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+
+	// An earlier rolling update surged the group from 4 to 6 and replaced node-1a and node-1b, then was interrupted
+	store := &memoryProgressStore{
+		progress: &RollingUpdateProgress{
+			ClusterName: cluster.Name,
+			Status:      ProgressStatusFailed,
+			InstanceGroups: []*InstanceGroupProgress{
+				{
+					Name:         "node-1",
+					Status:       ProgressStatusFailed,
+					OriginalSize: 4,
+					Instances: []*InstanceProgress{
+						{ID: "node-1a", Status: ProgressStatusTerminated},
+						{ID: "node-1b", Status: ProgressStatusTerminated},
+						{ID: "node-1c", Status: ProgressStatusPending},
+						{ID: "node-1d", Status: ProgressStatusPending},
+					},
+				},
+			},
+		},
+	}
+
+	maxSurge := intstr.FromInt(2)
+	c := &RollingUpdateCluster{
+		Cloud:           mockcloud,
+		MasterInterval:  1 * time.Millisecond,
+		NodeInterval:    1 * time.Millisecond,
+		BastionInterval: 1 * time.Millisecond,
+		K8sClient:       k8sClient,
+		ClusterName:     cluster.Name,
+		ProgressStore:   store,
+		Resume:          true,
+		MaxSurge:        &maxSurge,
+	}
+	cloud := c.Cloud.(awsup.AWSCloud)
+
+	group := buildSurgeGroup(t, cloud, "node-1", kopsapi.InstanceGroupRoleNode, nil)
+	group.TargetSize = 6
+	mockAutoscaling.Groups["node-1"].DesiredCapacity = aws.Int64(6)
+	groups := map[string]*cloudinstances.CloudInstanceGroup{"node-1": group}
+
+	err := c.RollingUpdate(groups, cluster, &kopsapi.InstanceGroupList{})
+	if err != nil {
+		t.Errorf("Error on rolling update: %v", err)
+	}
+
+	// The group must not be surged again from its surged size
+	if !reflect.DeepEqual(mockAutoscaling.desiredCapacities, []int64{6, 4}) {
+		t.Errorf("Expected group to be kept at 6 and restored to 4, got %v", mockAutoscaling.desiredCapacities)
+	}
+	if !reflect.DeepEqual(mockAutoscaling.scaledIn, []string{"node-1c", "node-1d"}) {
+		t.Errorf("Expected the remaining 2 instances to be scaled in, got %v", mockAutoscaling.scaledIn)
+	}
+
+	asgGroups, _ := cloud.Autoscaling().DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String("node-1")},
+	})
+	for _, group := range asgGroups.AutoScalingGroups {
+		if aws.Int64Value(group.DesiredCapacity) != 4 {
+			t.Errorf("Expected desired capacity to be restored to 4, got: %v", aws.Int64Value(group.DesiredCapacity))
+		}
+	}
+}
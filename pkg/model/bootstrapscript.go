@@ -21,7 +21,9 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"text/template"
@@ -76,15 +78,13 @@ func (b *BootstrapScript) ResourceNodeUp(ig *kops.InstanceGroup, cs *kops.Cluste
 		},
 
 		// Pass in extra environment variables for user-defined S3 service
-		"S3Env": func() string {
-			if os.Getenv("S3_ENDPOINT") != "" {
-				return fmt.Sprintf("export S3_ENDPOINT=%s\nexport S3_REGION=%s\nexport S3_ACCESS_KEY_ID=%s\nexport S3_SECRET_ACCESS_KEY=%s\n",
-					os.Getenv("S3_ENDPOINT"),
-					os.Getenv("S3_REGION"),
-					os.Getenv("S3_ACCESS_KEY_ID"),
-					os.Getenv("S3_SECRET_ACCESS_KEY"))
-			}
-			return ""
+		"S3Env": func() (string, error) {
+			return b.createS3Env()
+		},
+
+		// Pass in the credentials for a state store in Azure Blob Storage
+		"AzureStorageEnv": func() string {
+			return b.createAzureStorageEnv(cs)
 		},
 
 		"ProxyEnv": func() string {
@@ -285,6 +285,68 @@ func (b *BootstrapScript) computeFingerprint(content string) (string, error) {
 	return base64.StdEncoding.EncodeToString(hasher.Sum(nil)), nil
 }
 
+// s3CABundlePath is where the certificate authorities for a user-defined S3 service are written on the instances
+const s3CABundlePath = "/var/lib/kops/s3-ca-bundle.pem"
+
+// createS3Env exports the environment variables for a user-defined S3 service, and writes the certificate
+// authorities in S3_CA_BUNDLE to the instance, so that nodeup and protokube can read the state store
+func (b *BootstrapScript) createS3Env() (string, error) {
+	if os.Getenv("S3_ENDPOINT") == "" {
+		return "", nil
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("export S3_ENDPOINT=%s\nexport S3_REGION=%s\nexport S3_ACCESS_KEY_ID=%s\nexport S3_SECRET_ACCESS_KEY=%s\n",
+		os.Getenv("S3_ENDPOINT"),
+		os.Getenv("S3_REGION"),
+		os.Getenv("S3_ACCESS_KEY_ID"),
+		os.Getenv("S3_SECRET_ACCESS_KEY")))
+
+	if os.Getenv("S3_FORCE_PATH_STYLE") != "" {
+		buffer.WriteString(fmt.Sprintf("export S3_FORCE_PATH_STYLE=%s\n", os.Getenv("S3_FORCE_PATH_STYLE")))
+	}
+
+	if caBundle := os.Getenv("S3_CA_BUNDLE"); caBundle != "" {
+		data, err := ioutil.ReadFile(caBundle)
+		if err != nil {
+			return "", fmt.Errorf("error reading S3_CA_BUNDLE %q: %v", caBundle, err)
+		}
+		buffer.WriteString("mkdir -p " + path.Dir(s3CABundlePath) + "\n")
+		buffer.WriteString("cat > " + s3CABundlePath + " << '__EOF_S3_CA_BUNDLE'\n")
+		buffer.WriteString(strings.TrimSpace(string(data)) + "\n")
+		buffer.WriteString("__EOF_S3_CA_BUNDLE\n")
+		buffer.WriteString("export S3_CA_BUNDLE=" + s3CABundlePath + "\n")
+	}
+
+	return buffer.String(), nil
+}
+
+// azureStorageEnvVars are the environment variables that configure access to Azure Blob Storage
+var azureStorageEnvVars = []string{"AZURE_STORAGE_ACCOUNT", "AZURE_STORAGE_KEY", "AZURE_STORAGE_SAS_TOKEN", "AZURE_STORAGE_ENDPOINT"}
+
+// createAzureStorageEnv exports the credentials for Azure Blob Storage, if the cluster keeps its state there,
+// so that nodeup and protokube can read the state store
+func (b *BootstrapScript) createAzureStorageEnv(cs *kops.ClusterSpec) string {
+	inAzure := false
+	for _, location := range []string{cs.ConfigBase, cs.ConfigStore, cs.KeyStore, cs.SecretStore} {
+		if strings.Contains(location, "azureblob://") {
+			inAzure = true
+		}
+	}
+	if !inAzure || os.Getenv("AZURE_STORAGE_ACCOUNT") == "" {
+		return ""
+	}
+
+	var buffer bytes.Buffer
+	for _, name := range azureStorageEnvVars {
+		if value := os.Getenv(name); value != "" {
+			// Shared access signatures contain & and =, so the value is quoted
+			buffer.WriteString(fmt.Sprintf("export %s='%s'\n", name, value))
+		}
+	}
+	return buffer.String()
+}
+
 func (b *BootstrapScript) createProxyEnv(ps *kops.EgressProxySpec) string {
 	var buffer bytes.Buffer
 
@@ -18,6 +18,8 @@ package model
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -53,6 +55,97 @@ func Test_ProxyFunc(t *testing.T) {
 	}
 }
 
+func Test_S3Env(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3env")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	caBundle := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caBundle, []byte("-----BEGIN CERTIFICATE-----\nabc\n-----END CERTIFICATE-----\n"), 0644); err != nil {
+		t.Fatalf("error writing CA bundle: %v", err)
+	}
+
+	env := map[string]string{
+		"S3_ENDPOINT":          "https://minio.example.com:9000",
+		"S3_REGION":            "us-east-1",
+		"S3_ACCESS_KEY_ID":     "access",
+		"S3_SECRET_ACCESS_KEY": "secret",
+		"S3_FORCE_PATH_STYLE":  "true",
+		"S3_CA_BUNDLE":         caBundle,
+	}
+	for k, v := range env {
+		old, found := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if found {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	b := &BootstrapScript{}
+	script, err := b.createS3Env()
+	if err != nil {
+		t.Fatalf("error building script: %v", err)
+	}
+
+	for _, expected := range []string{
+		"export S3_ENDPOINT=https://minio.example.com:9000\n",
+		"export S3_FORCE_PATH_STYLE=true\n",
+		"cat > /var/lib/kops/s3-ca-bundle.pem << '__EOF_S3_CA_BUNDLE'\n-----BEGIN CERTIFICATE-----\nabc\n-----END CERTIFICATE-----\n__EOF_S3_CA_BUNDLE\n",
+		"export S3_CA_BUNDLE=/var/lib/kops/s3-ca-bundle.pem\n",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("script does not contain %q:\n%s", expected, script)
+		}
+	}
+
+	os.Setenv("S3_CA_BUNDLE", filepath.Join(dir, "missing.pem"))
+	if _, err := b.createS3Env(); err == nil {
+		t.Errorf("expected error reading missing CA bundle")
+	}
+
+	os.Unsetenv("S3_ENDPOINT")
+	if script, err := b.createS3Env(); err != nil || script != "" {
+		t.Errorf("expected empty script without S3_ENDPOINT, got %q, %v", script, err)
+	}
+}
+
+func Test_AzureStorageEnv(t *testing.T) {
+	env := map[string]string{
+		"AZURE_STORAGE_ACCOUNT":   "kopsstate",
+		"AZURE_STORAGE_KEY":       "",
+		"AZURE_STORAGE_SAS_TOKEN": "sv=2017-07-29&ss=b&sig=abc%2Bdef%3D",
+		"AZURE_STORAGE_ENDPOINT":  "",
+	}
+	for k, v := range env {
+		old, found := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if found {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	b := &BootstrapScript{}
+	script := b.createAzureStorageEnv(&kops.ClusterSpec{
+		ConfigBase: "azureblob://state/cluster.example.com",
+		KeyStore:   "azureblob://state/cluster.example.com/pki",
+	})
+	expected := "export AZURE_STORAGE_ACCOUNT='kopsstate'\nexport AZURE_STORAGE_SAS_TOKEN='sv=2017-07-29&ss=b&sig=abc%2Bdef%3D'\n"
+	if script != expected {
+		t.Errorf("expected %q, got %q", expected, script)
+	}
+
+	// The credentials are only given to the instances of clusters that keep their state in Azure Blob Storage
+	if script := b.createAzureStorageEnv(&kops.ClusterSpec{ConfigBase: "s3://state/cluster.example.com"}); script != "" {
+		t.Errorf("expected empty script for a state store in S3, got %q", script)
+	}
+}
+
 func TestBootstrapUserData(t *testing.T) {
 	cs := []struct {
 		Role               kops.InstanceGroupRole
@@ -143,7 +143,7 @@ func Image(component string, clusterSpec *kops.ClusterSpec, assetsBuilder *asset
 	if !IsBaseURL(clusterSpec.KubernetesVersion) {
 		image := "k8s.gcr.io/" + component + ":" + "v" + kubernetesVersion.String()
 
-		image, err := assetsBuilder.RemapImage(image)
+		image, err := assetsBuilder.RemapImage(component, image)
 		if err != nil {
 			return "", fmt.Errorf("unable to remap container %q: %v", image, err)
 		}
@@ -52,7 +52,7 @@ func (b *EtcdOptionsBuilder) BuildOptions(o interface{}) error {
 			image = fmt.Sprintf("k8s.gcr.io/etcd:%s", c.Version)
 		}
 
-		image, err := b.Context.AssetBuilder.RemapImage(image)
+		image, err := b.Context.AssetBuilder.RemapImage("etcd", image)
 		if err != nil {
 			return fmt.Errorf("unable to remap container %q: %v", image, err)
 		}
@@ -69,7 +69,7 @@ func (b *EtcdOptionsBuilder) BuildOptions(o interface{}) error {
 			image = fmt.Sprintf(DefaultBackupImage)
 		}
 
-		image, err := b.Context.AssetBuilder.RemapImage(image)
+		image, err := b.Context.AssetBuilder.RemapImage("etcd-backup", image)
 		if err != nil {
 			return fmt.Errorf("unable to remap container %q: %v", image, err)
 		}
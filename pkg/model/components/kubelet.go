@@ -203,7 +203,7 @@ func (b *KubeletOptionsBuilder) BuildOptions(o interface{}) error {
 
 	// Specify our pause image
 	image := "k8s.gcr.io/pause-amd64:3.0"
-	if image, err = b.Context.AssetBuilder.RemapImage(image); err != nil {
+	if image, err = b.Context.AssetBuilder.RemapImage("kubelet", image); err != nil {
 		return err
 	}
 	clusterSpec.Kubelet.PodInfraContainerImage = image
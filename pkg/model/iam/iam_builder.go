@@ -36,6 +36,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/envelope"
 	"k8s.io/kops/pkg/util/stringorslice"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/awstasks"
@@ -167,6 +169,10 @@ func (b *PolicyBuilder) BuildAWSPolicyMaster() (*Policy, error) {
 		return nil, fmt.Errorf("failed to generate AWS IAM S3 access statements: %v", err)
 	}
 
+	if err := b.addStoreKMSPermissions(p); err != nil {
+		return nil, fmt.Errorf("failed to generate AWS IAM KMS access statements: %v", err)
+	}
+
 	if b.KMSKeys != nil && len(b.KMSKeys) != 0 {
 		addKMSIAMPolicies(p, stringorslice.Slice(b.KMSKeys), b.Cluster.Spec.IAM.Legacy)
 	}
@@ -209,6 +215,10 @@ func (b *PolicyBuilder) BuildAWSPolicyNode() (*Policy, error) {
 		return nil, fmt.Errorf("failed to generate AWS IAM S3 access statements: %v", err)
 	}
 
+	if err := b.addStoreKMSPermissions(p); err != nil {
+		return nil, fmt.Errorf("failed to generate AWS IAM KMS access statements: %v", err)
+	}
+
 	if b.Cluster.Spec.IAM.Legacy {
 		if b.HostedZoneID != "" {
 			addRoute53Permissions(p, b.HostedZoneID)
@@ -280,6 +290,12 @@ func (b *PolicyBuilder) AddS3Permissions(p *Policy) (*Policy, error) {
 				continue
 			}
 
+			// Encrypted stores are read from the location of the store
+			p, _, err := envelope.ParseStoreLocation(p)
+			if err != nil {
+				return nil, err
+			}
+
 			if !strings.HasSuffix(p, "/") {
 				p = p + "/"
 			}
@@ -360,6 +376,19 @@ func (b *PolicyBuilder) AddS3Permissions(p *Policy) (*Policy, error) {
 						),
 					})
 
+					if b.Cluster.Spec.SealedState != nil {
+						// nodeup reads the secret the state is sealed with from the secret store, as it is not in the user-data
+						p.Statement = append(p.Statement, &Statement{
+							Sid:    "kopsK8sS3NodeBucketGetSealedState",
+							Effect: StatementEffectAllow,
+							Action: stringorslice.Slice([]string{"s3:Get*"}),
+							Resource: stringorslice.Of(
+								strings.Join([]string{b.IAMPrefix(), ":s3:::", iamS3Path, "/", vfs.SealManifestName}, ""),
+								strings.Join([]string{b.IAMPrefix(), ":s3:::", iamS3Path, "/secrets/", registry.SecretStateSeal}, ""),
+							),
+						})
+					}
+
 					if b.Cluster.Spec.Networking != nil {
 						// @check if kuberoute is enabled and permit access to the private key
 						if b.Cluster.Spec.Networking.Kuberouter != nil {
@@ -535,6 +564,52 @@ func addRoute53Permissions(p *Policy, hostedZoneID string) {
 	})
 }
 
+// addStoreKMSPermissions grants permission to decrypt the keystore and secret store, if they are
+// encrypted with AWS KMS keys, so that nodeup can read the private keys and secrets
+func (b *PolicyBuilder) addStoreKMSPermissions(p *Policy) error {
+	keys := sets.NewString()
+	for _, location := range []string{b.Cluster.Spec.KeyStore, b.Cluster.Spec.SecretStore} {
+		_, kekURL, err := envelope.ParseStoreLocation(location)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(kekURL, "awskms://") {
+			continue
+		}
+
+		keyID, region, err := envelope.ParseAWSKMSURL(kekURL)
+		if err != nil {
+			return err
+		}
+		if region == "" {
+			region = b.Region
+		}
+
+		switch {
+		case strings.HasPrefix(keyID, "arn:"):
+			keys.Insert(keyID)
+		case strings.HasPrefix(keyID, "alias/"):
+			// An alias can't be used as the resource of a policy, and we don't know which key it refers to
+			glog.Warningf("granting kms:Decrypt on all keys, because the store is encrypted with the alias %q; use the ARN of the key for a tighter policy", keyID)
+			keys.Insert("*")
+		default:
+			keys.Insert(strings.Join([]string{b.IAMPrefix(), ":kms:", region, ":*:key/", keyID}, ""))
+		}
+	}
+
+	if keys.Len() == 0 {
+		return nil
+	}
+
+	p.Statement = append(p.Statement, &Statement{
+		Sid:      "kopsK8sKMSStoreDecrypt",
+		Effect:   StatementEffectAllow,
+		Action:   stringorslice.Of("kms:Decrypt"),
+		Resource: stringorslice.Slice(keys.List()),
+	})
+	return nil
+}
+
 func addKMSIAMPolicies(p *Policy, resource stringorslice.StringOrSlice, legacyIAM bool) {
 	if legacyIAM {
 		p.Statement = append(p.Statement, &Statement{
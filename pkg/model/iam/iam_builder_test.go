@@ -203,3 +203,38 @@ func TestPolicyGeneration(t *testing.T) {
 		}
 	}
 }
+
+func TestPolicyStoreKMSDecrypt(t *testing.T) {
+	b := &PolicyBuilder{
+		Cluster: &kops.Cluster{
+			Spec: kops.ClusterSpec{
+				ConfigStore: "s3://kops-tests/iam-builder-test.k8s.local",
+				KeyStore:    "encrypted+s3://kops-tests/iam-builder-test.k8s.local/pki?kek=awskms://arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+				SecretStore: "encrypted+s3://kops-tests/iam-builder-test.k8s.local/secrets?kek=awskms://alias/kops?region=us-east-1",
+				IAM:         &kops.IAMSpec{},
+			},
+		},
+		Region: "us-east-1",
+		Role:   kops.InstanceGroupRoleNode,
+	}
+	b.Cluster.SetName("iam-builder-test.k8s.local")
+
+	p, err := b.BuildAWSPolicy()
+	if err != nil {
+		t.Fatalf("failed to build an AWS IAM policy: %v", err)
+	}
+
+	var decrypt *Statement
+	for _, s := range p.Statement {
+		if s.Sid == "kopsK8sKMSStoreDecrypt" {
+			decrypt = s
+		}
+	}
+	if decrypt == nil {
+		t.Fatalf("policy does not allow decrypting the keystore and secret store")
+	}
+	expected := stringorslice.Of("*", "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab")
+	if !decrypt.Action.Equal(stringorslice.Of("kms:Decrypt")) || !decrypt.Resource.Equal(expected) {
+		t.Errorf("unexpected statement %+v", decrypt)
+	}
+}
@@ -20,10 +20,10 @@ import (
 	"fmt"
 
 	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/kops/pkg/envelope"
 	"k8s.io/kops/pkg/tokens"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/fitasks"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 // PKIModelBuilder configures PKI keypairs, as well as tokens
@@ -49,7 +49,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 		Type:      "ca",
 		Format:    format,
 	}
-	c.AddTask(defaultCA)
+	b.addKeypair(c, defaultCA)
 
 	{
 
@@ -62,13 +62,13 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:  defaultCA,
 			Format:  format,
 		}
-		c.AddTask(t)
+		b.addKeypair(c, t)
 	}
 	{
 		// Generate a kubelet client certificate for api to speak securely to kubelets. This change was first
 		// introduced in https://github.com/kubernetes/kops/pull/2831 where server.cert/key were used. With kubernetes >= 1.7
 		// the certificate usage is being checked (obviously the above was server not client certificate) and so now fails
-		c.AddTask(&fitasks.Keypair{
+		b.addKeypair(c, &fitasks.Keypair{
 			Name:      fi.String("kubelet-api"),
 			Lifecycle: b.Lifecycle,
 			Subject:   "cn=kubelet-api",
@@ -86,7 +86,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:    defaultCA,
 			Format:    format,
 		}
-		c.AddTask(t)
+		b.addKeypair(c, t)
 	}
 
 	{
@@ -98,7 +98,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:    defaultCA,
 			Format:    format,
 		}
-		c.AddTask(t)
+		b.addKeypair(c, t)
 	}
 
 	{
@@ -110,7 +110,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:    defaultCA,
 			Format:    format,
 		}
-		c.AddTask(t)
+		b.addKeypair(c, t)
 	}
 
 	// check if we need to generate certificates for etcd peers certificates from a different CA?
@@ -121,7 +121,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 		alternativeNames := []string{fmt.Sprintf("*.internal.%s", b.ClusterName()), "localhost", "127.0.0.1"}
 		// @question should wildcard's be here instead of generating per node. If we ever provide the
 		// ability to resize the master, this will become a blocker
-		c.AddTask(&fitasks.Keypair{
+		b.addKeypair(c, &fitasks.Keypair{
 			AlternateNames: alternativeNames,
 			Lifecycle:      b.Lifecycle,
 			Name:           fi.String("etcd"),
@@ -130,7 +130,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:         defaultCA,
 			Format:         format,
 		})
-		c.AddTask(&fitasks.Keypair{
+		b.addKeypair(c, &fitasks.Keypair{
 			Name:      fi.String("etcd-client"),
 			Lifecycle: b.Lifecycle,
 			Subject:   "cn=etcd-client",
@@ -141,7 +141,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 
 		// @check if calico is enabled as the CNI provider
 		if b.KopsModelContext.Cluster.Spec.Networking.Calico != nil {
-			c.AddTask(&fitasks.Keypair{
+			b.addKeypair(c, &fitasks.Keypair{
 				Name:      fi.String("calico-client"),
 				Lifecycle: b.Lifecycle,
 				Subject:   "cn=calico-client",
@@ -160,7 +160,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:  defaultCA,
 			Format:  format,
 		}
-		c.AddTask(t)
+		b.addKeypair(c, t)
 	}
 
 	{
@@ -172,7 +172,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:    defaultCA,
 			Format:    format,
 		}
-		c.AddTask(t)
+		b.addKeypair(c, t)
 	}
 
 	{
@@ -184,7 +184,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:    defaultCA,
 			Format:    format,
 		}
-		c.AddTask(t)
+		b.addKeypair(c, t)
 	}
 
 	{
@@ -195,7 +195,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Type:      "ca",
 			Format:    format,
 		}
-		c.AddTask(aggregatorCA)
+		b.addKeypair(c, aggregatorCA)
 
 		aggregator := &fitasks.Keypair{
 			Name:      fi.String("apiserver-aggregator"),
@@ -206,7 +206,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:  aggregatorCA,
 			Format:  format,
 		}
-		c.AddTask(aggregator)
+		b.addKeypair(c, aggregator)
 	}
 
 	{
@@ -219,7 +219,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:    defaultCA,
 			Format:    format,
 		}
-		c.AddTask(t)
+		b.addKeypair(c, t)
 	}
 
 	{
@@ -257,7 +257,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Signer:         defaultCA,
 			Format:         format,
 		}
-		c.AddTask(t)
+		b.addKeypair(c, t)
 	}
 
 	// Create auth tokens (though this is deprecated)
@@ -267,7 +267,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 	}
 
 	{
-		mirrorPath, err := vfs.Context.BuildVfsPath(b.Cluster.Spec.SecretStore)
+		mirrorPath, _, err := envelope.BuildStorePath(b.Cluster.Spec.SecretStore)
 		if err != nil {
 			return err
 		}
@@ -280,7 +280,7 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 	}
 
 	{
-		mirrorPath, err := vfs.Context.BuildVfsPath(b.Cluster.Spec.KeyStore)
+		mirrorPath, _, err := envelope.BuildStorePath(b.Cluster.Spec.KeyStore)
 		if err != nil {
 			return err
 		}
@@ -295,3 +295,11 @@ func (b *PKIModelBuilder) Build(c *fi.ModelBuilderContext) error {
 
 	return nil
 }
+
+// addKeypair adds a keypair task, which is reissued when it expires within the renewal window from the cluster spec
+func (b *PKIModelBuilder) addKeypair(c *fi.ModelBuilderContext, t *fitasks.Keypair) {
+	if b.Cluster.Spec.Certificates != nil && b.Cluster.Spec.Certificates.RenewalWindow != nil {
+		t.RenewalWindow = &b.Cluster.Spec.Certificates.RenewalWindow.Duration
+	}
+	c.AddTask(t)
+}
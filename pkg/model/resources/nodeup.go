@@ -48,7 +48,7 @@ set -o pipefail
 NODEUP_URL={{ NodeUpSource }}
 NODEUP_HASH={{ NodeUpSourceHash }}
 
-{{ S3Env }}
+{{ S3Env }}{{ AzureStorageEnv }}
 {{ AWS_REGION }}
 
 {{ ProxyEnv }}
@@ -27,6 +27,9 @@ import (
 	"github.com/golang/glog"
 )
 
+// CertificateValidity is how long the certificates that kops issues are valid for, unless the template sets an expiry
+const CertificateValidity = 10 * 365 * 24 * time.Hour
+
 // BuildPKISerial produces a serial number for certs that is vanishingly unlikely to collide
 // The timestamp should be provided as an input (time.Now().UnixNano()), and then we combine
 // that with a 32 bit random crypto-rand integer.
@@ -63,7 +66,7 @@ func SignNewCertificate(privateKey *PrivateKey, template *x509.Certificate, sign
 	}
 
 	if template.NotAfter.IsZero() {
-		template.NotAfter = now.Add(time.Hour * 10 * 365 * 24)
+		template.NotAfter = now.Add(CertificateValidity)
 	}
 
 	if template.SerialNumber == nil {
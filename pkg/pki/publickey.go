@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// ParsePEMPublicKey parses a PEM-encoded ECDSA or RSA public key, in PKIX format ("PUBLIC KEY")
+func ParsePEMPublicKey(pemData []byte) (crypto.PublicKey, error) {
+	for {
+		block, rest := pem.Decode(pemData)
+		if block == nil {
+			return nil, fmt.Errorf("could not parse public key")
+		}
+
+		if block.Type == "PUBLIC KEY" {
+			glog.V(10).Infof("Parsing pem block: %q", block.Type)
+			k, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case *ecdsa.PublicKey, *rsa.PublicKey:
+				return k, nil
+			default:
+				return nil, fmt.Errorf("unsupported public key type %T", k)
+			}
+		}
+
+		glog.Infof("Ignoring unexpected PEM block: %q", block.Type)
+		pemData = rest
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconciler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const metricsNamespace = "kops_reconcile"
+
+// Metrics records the outcome of the reconciliations of a cluster, and exports them in the Prometheus text format
+type Metrics struct {
+	registry *prometheus.Registry
+
+	runs        prometheus.Counter
+	errors      prometheus.Counter
+	duration    prometheus.Histogram
+	lastRun     prometheus.Gauge
+	lastSuccess prometheus.Gauge
+	paused      prometheus.Gauge
+	reconciled  prometheus.Gauge
+}
+
+var _ http.Handler = &Metrics{}
+
+// NewMetrics builds the metrics for reconciling the named cluster
+func NewMetrics(clusterName string) *Metrics {
+	labels := prometheus.Labels{"cluster": clusterName}
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		runs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Name:        "runs_total",
+			Help:        "Number of times the cluster has been applied.",
+			ConstLabels: labels,
+		}),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Name:        "errors_total",
+			Help:        "Number of times applying the cluster failed.",
+			ConstLabels: labels,
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   metricsNamespace,
+			Name:        "run_duration_seconds",
+			Help:        "Time taken to apply the cluster.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(5, 2, 10),
+		}),
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "last_run_timestamp_seconds",
+			Help:        "Time at which the cluster was last applied, in seconds since the epoch.",
+			ConstLabels: labels,
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "last_success_timestamp_seconds",
+			Help:        "Time at which the cluster was last applied successfully, in seconds since the epoch.",
+			ConstLabels: labels,
+		}),
+		paused: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "paused",
+			Help:        "Whether reconciliation of the cluster is paused by its annotation (1) or not (0).",
+			ConstLabels: labels,
+		}),
+		reconciled: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "reconciled",
+			Help:        "Whether the current configuration of the cluster has been applied successfully (1) or not (0).",
+			ConstLabels: labels,
+		}),
+	}
+
+	m.registry.MustRegister(m.runs, m.errors, m.duration, m.lastRun, m.lastSuccess, m.paused, m.reconciled)
+	return m
+}
+
+// RecordApply updates the metrics with the outcome of applying the cluster
+func (m *Metrics) RecordApply(duration time.Duration, err error) {
+	now := float64(time.Now().Unix())
+
+	m.runs.Inc()
+	m.lastRun.Set(now)
+	m.duration.Observe(duration.Seconds())
+
+	if err != nil {
+		m.errors.Inc()
+		return
+	}
+	m.lastSuccess.Set(now)
+}
+
+// RecordState updates the metrics with the state of the cluster after a reconciliation
+func (m *Metrics) RecordState(paused bool, reconciled bool) {
+	m.paused.Set(boolToFloat(paused))
+	m.reconciled.Set(boolToFloat(reconciled))
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			glog.Warningf("error writing metrics: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,359 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconciler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/pkg/statelock"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup"
+)
+
+// DefaultInterval is the default period after which a cluster is applied again, even if its configuration has not changed
+const DefaultInterval = 15 * time.Minute
+
+// DefaultPollInterval is the default period at which the state store is read to detect changes to the configuration
+const DefaultPollInterval = time.Minute
+
+// ApplyFunc applies the configuration of a cluster
+type ApplyFunc func(clientset simple.Clientset, cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) error
+
+// ApplyCluster applies the cluster with the cloudup task graph, as kops update cluster --yes does
+func ApplyCluster(clientset simple.Clientset, cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) error {
+	applyCmd := &cloudup.ApplyClusterCmd{
+		Clientset:      clientset,
+		Cluster:        cluster,
+		InstanceGroups: instanceGroups,
+		Models:         cloudup.CloudupModels,
+		OutDir:         "out",
+		TargetName:     cloudup.TargetDirect,
+	}
+	return applyCmd.Run()
+}
+
+// Reconciler keeps a cluster in the state described by the state store: it applies the cluster when its
+// configuration changes and every Interval, and records the outcome in the status of the cluster.
+// A Reconciler is not safe for concurrent use.
+type Reconciler struct {
+	Clientset   simple.Clientset
+	ClusterName string
+
+	// Interval is the period after which the cluster is applied again, even if its configuration has not changed; zero disables it
+	Interval time.Duration
+	// PollInterval is the period at which the state store is read to detect changes, in addition to the watch if the state store supports it
+	PollInterval time.Duration
+
+	// Apply applies the cluster; ApplyCluster is used if it is nil
+	Apply ApplyFunc
+	// Metrics records the outcome of each reconciliation, if not nil
+	Metrics *Metrics
+
+	// appliedHash is the hash of the configuration last applied successfully by this reconciler
+	appliedHash string
+	// lastAttempt is the time the cluster was last applied, successfully or not
+	lastAttempt time.Time
+	// lastError is the error of the last attempt to apply the cluster, or nil if it succeeded
+	lastError error
+
+	// now returns the current time; it is replaced in tests
+	now func() time.Time
+}
+
+// Result is the outcome of a reconciliation
+type Result struct {
+	// SpecHash is the hash of the configuration of the cluster that was read
+	SpecHash string
+	// Paused is true if the cluster has the reconcile-paused annotation
+	Paused bool
+	// Applied is true if the cluster was applied
+	Applied bool
+	// Locked is true if the cluster was due to be applied, but another operation held the lock on it
+	Locked bool
+	// ApplyError is the error applying the cluster, if it was applied and failed
+	ApplyError error
+}
+
+// Reconcile reads the cluster and its instance groups, applies them if the configuration changed or the
+// cluster is due to be applied again, and updates the status of the cluster if it changed.  The cluster is
+// not applied if it has the reconcile-paused annotation, or if another operation holds the lock on it.
+// Errors applying the cluster are reported in the result and the status, not as the returned error.
+func (r *Reconciler) Reconcile() (*Result, error) {
+	cluster, err := r.Clientset.GetCluster(r.ClusterName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster %q: %v", r.ClusterName, err)
+	}
+	if cluster == nil {
+		return nil, fmt.Errorf("cluster %q not found", r.ClusterName)
+	}
+
+	list, err := r.Clientset.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error reading instance groups of cluster %q: %v", r.ClusterName, err)
+	}
+	var instanceGroups []*kops.InstanceGroup
+	for i := range list.Items {
+		instanceGroups = append(instanceGroups, &list.Items[i])
+	}
+
+	hash, err := fi.SpecHash(cluster, instanceGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		SpecHash: hash,
+		Paused:   IsPaused(cluster),
+	}
+
+	if !result.Paused && r.isDue(hash) {
+		r.apply(cluster, instanceGroups, result)
+	}
+
+	status := r.buildStatus(cluster.Status, hash, result.Paused)
+	if r.Metrics != nil {
+		r.Metrics.RecordState(result.Paused, isConditionTrue(status, kops.ClusterConditionReconciled))
+	}
+	if err := r.updateStatus(cluster, status); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// IsPaused returns true if the cluster has the annotation that pauses its reconciliation
+func IsPaused(cluster *kops.Cluster) bool {
+	return cluster.ObjectMeta.Annotations[kops.AnnotationNameReconcilePaused] == "true"
+}
+
+// isDue returns true if the configuration has not been applied successfully, or was last applied more than Interval ago
+func (r *Reconciler) isDue(hash string) bool {
+	if hash != r.appliedHash || r.lastError != nil {
+		return true
+	}
+	return r.Interval > 0 && r.clock().Sub(r.lastAttempt) >= r.Interval
+}
+
+// apply applies the cluster while holding the lock on it, recording the outcome in the result
+func (r *Reconciler) apply(cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup, result *Result) {
+	lease, err := statelock.Acquire(cluster, "reconcile cluster")
+	if err != nil {
+		if statelock.IsLocked(err) {
+			glog.Infof("Not applying cluster %q: %v", r.ClusterName, err)
+			result.Locked = true
+			return
+		}
+		r.recordApply(result, 0, fmt.Errorf("error locking cluster: %v", err))
+		return
+	}
+	defer func() {
+		if err := lease.Release(); err != nil {
+			glog.Warningf("error releasing the lock on cluster %q: %v", r.ClusterName, err)
+		}
+	}()
+
+	// The apply may fill in the objects, which must not leak into the status update
+	var igs []*kops.InstanceGroup
+	for _, ig := range instanceGroups {
+		igs = append(igs, ig.DeepCopy())
+	}
+
+	apply := r.Apply
+	if apply == nil {
+		apply = ApplyCluster
+	}
+
+	glog.Infof("Applying cluster %q (configuration %s)", r.ClusterName, result.SpecHash)
+	start := r.clock()
+	err = apply(r.Clientset, cluster.DeepCopy(), igs)
+	select {
+	case <-lease.Lost():
+		if err == nil {
+			err = fmt.Errorf("lost the lock on cluster %q while applying it, so the changes may conflict with another operation", r.ClusterName)
+		}
+	default:
+	}
+	if err == nil {
+		r.appliedHash = result.SpecHash
+		glog.Infof("Applied cluster %q", r.ClusterName)
+	} else {
+		glog.Warningf("error applying cluster %q: %v", r.ClusterName, err)
+	}
+	r.recordApply(result, r.clock().Sub(start), err)
+}
+
+func (r *Reconciler) recordApply(result *Result, duration time.Duration, err error) {
+	result.Applied = true
+	result.ApplyError = err
+	r.lastAttempt = r.clock()
+	r.lastError = err
+	if r.Metrics != nil {
+		r.Metrics.RecordApply(duration, err)
+	}
+}
+
+// buildStatus returns the status of the cluster after the reconciliation, based on its current status
+func (r *Reconciler) buildStatus(current *kops.ClusterReconcileStatus, hash string, paused bool) *kops.ClusterReconcileStatus {
+	status := &kops.ClusterReconcileStatus{}
+	if current != nil {
+		status = current.DeepCopy()
+	}
+	if r.appliedHash != "" {
+		status.AppliedSpecHash = r.appliedHash
+	}
+
+	now := r.clock()
+
+	if paused {
+		setCondition(status, kops.ClusterCondition{
+			Type:    kops.ClusterConditionPaused,
+			Status:  kops.ConditionTrue,
+			Reason:  "Annotated",
+			Message: fmt.Sprintf("the cluster has the annotation %s=true", kops.AnnotationNameReconcilePaused),
+		}, now)
+	} else {
+		setCondition(status, kops.ClusterCondition{
+			Type:   kops.ClusterConditionPaused,
+			Status: kops.ConditionFalse,
+			Reason: "NotAnnotated",
+		}, now)
+	}
+
+	reconciled := kops.ClusterCondition{Type: kops.ClusterConditionReconciled}
+	switch {
+	case r.lastError != nil && !paused:
+		reconciled.Status = kops.ConditionFalse
+		reconciled.Reason = "ApplyFailed"
+		reconciled.Message = r.lastError.Error()
+	case status.AppliedSpecHash == hash:
+		reconciled.Status = kops.ConditionTrue
+		reconciled.Reason = "Applied"
+		reconciled.Message = "the current configuration was applied"
+	case paused:
+		reconciled.Status = kops.ConditionFalse
+		reconciled.Reason = "Paused"
+		reconciled.Message = "the configuration has changes that are not applied while reconciliation is paused"
+	default:
+		reconciled.Status = kops.ConditionFalse
+		reconciled.Reason = "Pending"
+		reconciled.Message = "the configuration has changes that have not been applied yet"
+	}
+	setCondition(status, reconciled, now)
+
+	return status
+}
+
+// updateStatus writes the status to the cluster, if it changed.  Every write of a cluster in a VFS state store
+// records a revision, so an unchanged status is never written.
+func (r *Reconciler) updateStatus(cluster *kops.Cluster, status *kops.ClusterReconcileStatus) error {
+	if statusEqual(cluster.Status, status) {
+		return nil
+	}
+
+	cluster = cluster.DeepCopy()
+	cluster.Status = status
+	if _, err := r.Clientset.UpdateCluster(cluster, nil); err != nil {
+		if errors.IsConflict(err) {
+			// The cluster changed since we read it; the status is written by the next reconciliation
+			glog.V(2).Infof("cluster %q changed while reconciling, not updating its status: %v", r.ClusterName, err)
+			return nil
+		}
+		return fmt.Errorf("error updating status of cluster %q: %v", r.ClusterName, err)
+	}
+	return nil
+}
+
+// Run reconciles the cluster every PollInterval, and whenever the cluster changes if the state store supports
+// watching clusters, until stop is closed
+func (r *Reconciler) Run(stop <-chan struct{}) {
+	pollInterval := r.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+
+	changes := make(chan struct{}, 1)
+	go r.watch(changes, stop)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(); err != nil {
+			glog.Warningf("error reconciling cluster %q: %v", r.ClusterName, err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-changes:
+		}
+	}
+}
+
+// watch signals changes to the cluster on the changes channel until stop is closed.  It re-establishes the
+// watch when it is closed by the server, and returns if the state store does not support watching clusters.
+func (r *Reconciler) watch(changes chan<- struct{}, stop <-chan struct{}) {
+	for {
+		w, err := r.Clientset.WatchClusters(metav1.ListOptions{})
+		if err != nil {
+			glog.Infof("Not watching cluster %q, changes are detected by polling: %v", r.ClusterName, err)
+			return
+		}
+
+		closed := false
+		for !closed {
+			select {
+			case <-stop:
+				w.Stop()
+				return
+			case event, ok := <-w.ResultChan():
+				if !ok {
+					closed = true
+					break
+				}
+				cluster, ok := event.Object.(*kops.Cluster)
+				if !ok || cluster.ObjectMeta.Name != r.ClusterName {
+					continue
+				}
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+
+		glog.V(2).Infof("watch of cluster %q was closed, restarting it", r.ClusterName)
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (r *Reconciler) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
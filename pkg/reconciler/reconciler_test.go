@@ -0,0 +1,318 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconciler
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/pkg/client/simple/api"
+	"k8s.io/kops/pkg/client/simple/vfsclientset"
+	"k8s.io/kops/pkg/statelock"
+	"k8s.io/kops/pkg/testutils/mockapiserver"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func buildTestCluster() *kops.Cluster {
+	c := &kops.Cluster{}
+	c.ObjectMeta.Name = "cluster.example.com"
+	c.Spec.ConfigBase = "memfs://clusters/cluster.example.com"
+	c.Spec.KubernetesVersion = "1.9.3"
+	c.Spec.CloudProvider = "aws"
+	c.Spec.Subnets = []kops.ClusterSubnetSpec{
+		{Name: "us-test-1a", Zone: "us-test-1a", CIDR: "172.20.32.0/19"},
+	}
+	c.Spec.NetworkCIDR = "172.20.0.0/16"
+	c.Spec.NonMasqueradeCIDR = "100.64.0.0/10"
+	c.Spec.Topology = &kops.TopologySpec{Masters: kops.TopologyPublic, Nodes: kops.TopologyPublic}
+	c.Spec.Networking = &kops.NetworkingSpec{Kubenet: &kops.KubenetNetworkingSpec{}}
+	for _, name := range []string{"main", "events"} {
+		c.Spec.EtcdClusters = append(c.Spec.EtcdClusters, &kops.EtcdClusterSpec{
+			Name:    name,
+			Members: []*kops.EtcdMemberSpec{{Name: "a", InstanceGroup: fi.String("master-us-test-1a")}},
+		})
+	}
+	return c
+}
+
+// fakeApply records the clusters it applies, and fails with err if set
+type fakeApply struct {
+	applied []*kops.Cluster
+	err     error
+}
+
+func (f *fakeApply) apply(clientset simple.Clientset, cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) error {
+	f.applied = append(f.applied, cluster)
+	return f.err
+}
+
+func updateCluster(t *testing.T, clientset simple.Clientset, mutate func(cluster *kops.Cluster)) {
+	cluster, err := clientset.GetCluster("cluster.example.com")
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	mutate(cluster)
+	if _, err := clientset.UpdateCluster(cluster, nil); err != nil {
+		t.Fatalf("error updating cluster: %v", err)
+	}
+}
+
+func reconcile(t *testing.T, r *Reconciler) (*Result, *kops.ClusterReconcileStatus) {
+	result, err := r.Reconcile()
+	if err != nil {
+		t.Fatalf("error reconciling: %v", err)
+	}
+	cluster, err := r.Clientset.GetCluster(r.ClusterName)
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	return result, cluster.Status
+}
+
+func expectCondition(t *testing.T, status *kops.ClusterReconcileStatus, conditionType kops.ClusterConditionType, conditionStatus kops.ConditionStatus, reason string) {
+	condition := FindCondition(status, conditionType)
+	if condition == nil {
+		t.Errorf("condition %s not found in %v", conditionType, status)
+		return
+	}
+	if condition.Status != conditionStatus || condition.Reason != reason {
+		t.Errorf("expected condition %s to be %s (%s), was %s (%s): %s", conditionType, conditionStatus, reason, condition.Status, condition.Reason, condition.Message)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	basePath, _ := vfs.Context.BuildVfsPath("memfs://state")
+	clientset := vfsclientset.NewVFSClientset(basePath, true)
+
+	cluster, err := clientset.CreateCluster(buildTestCluster())
+	if err != nil {
+		t.Fatalf("error creating cluster: %v", err)
+	}
+	ig := &kops.InstanceGroup{}
+	ig.ObjectMeta.Name = "nodes"
+	ig.Spec.Role = kops.InstanceGroupRoleNode
+	if _, err := clientset.InstanceGroupsFor(cluster).Create(ig); err != nil {
+		t.Fatalf("error creating instance group: %v", err)
+	}
+
+	now := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakeApply{}
+	r := &Reconciler{
+		Clientset:   clientset,
+		ClusterName: "cluster.example.com",
+		Interval:    time.Hour,
+		Apply:       fake.apply,
+		Metrics:     NewMetrics("cluster.example.com"),
+		now:         func() time.Time { return now },
+	}
+
+	// The cluster is applied when the reconciler starts
+	result, status := reconcile(t, r)
+	if !result.Applied || len(fake.applied) != 1 {
+		t.Fatalf("expected cluster to be applied, got %+v", result)
+	}
+	if status == nil || status.AppliedSpecHash != result.SpecHash {
+		t.Fatalf("unexpected status %v", status)
+	}
+	expectCondition(t, status, kops.ClusterConditionReconciled, kops.ConditionTrue, "Applied")
+	expectCondition(t, status, kops.ClusterConditionPaused, kops.ConditionFalse, "NotAnnotated")
+	appliedTime := FindCondition(status, kops.ClusterConditionReconciled).LastTransitionTime
+
+	// Writing the status does not change the configuration, so nothing is applied until the interval passes
+	now = now.Add(30 * time.Minute)
+	if result, _ := reconcile(t, r); result.Applied {
+		t.Errorf("cluster was applied without changes")
+	}
+	now = now.Add(30 * time.Minute)
+	result, status = reconcile(t, r)
+	if !result.Applied || len(fake.applied) != 2 {
+		t.Errorf("expected cluster to be applied after the interval, got %+v", result)
+	}
+	if transition := FindCondition(status, kops.ClusterConditionReconciled).LastTransitionTime; !transition.Equal(&appliedTime) {
+		t.Errorf("transition time changed from %v to %v without a change of status", appliedTime, transition)
+	}
+
+	// Changes to instance groups are applied
+	igs, err := clientset.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("error listing instance groups: %v", err)
+	}
+	igs.Items[0].Spec.MaxSize = fi.Int32(3)
+	if _, err := clientset.InstanceGroupsFor(cluster).Update(&igs.Items[0]); err != nil {
+		t.Fatalf("error updating instance group: %v", err)
+	}
+	if result, _ := reconcile(t, r); !result.Applied {
+		t.Errorf("expected instance group change to be applied")
+	}
+
+	// Failures are reported in the status, and retried
+	fake.err = fmt.Errorf("cloud unavailable")
+	updateCluster(t, clientset, func(c *kops.Cluster) { c.Spec.KubernetesVersion = "1.9.4" })
+	result, status = reconcile(t, r)
+	if !result.Applied || result.ApplyError == nil {
+		t.Errorf("expected apply to fail, got %+v", result)
+	}
+	expectCondition(t, status, kops.ClusterConditionReconciled, kops.ConditionFalse, "ApplyFailed")
+	if condition := FindCondition(status, kops.ClusterConditionReconciled); condition.Message != "cloud unavailable" {
+		t.Errorf("unexpected message %q", condition.Message)
+	}
+	if status.AppliedSpecHash == result.SpecHash {
+		t.Errorf("failed configuration was recorded as applied")
+	}
+
+	fake.err = nil
+	result, status = reconcile(t, r)
+	if !result.Applied || result.ApplyError != nil {
+		t.Errorf("expected apply to be retried, got %+v", result)
+	}
+	expectCondition(t, status, kops.ClusterConditionReconciled, kops.ConditionTrue, "Applied")
+	if applied := fake.applied[len(fake.applied)-1]; applied.Spec.KubernetesVersion != "1.9.4" {
+		t.Errorf("unexpected cluster applied: %v", applied.Spec.KubernetesVersion)
+	}
+
+	// Paused clusters are not applied
+	updateCluster(t, clientset, func(c *kops.Cluster) {
+		c.ObjectMeta.Annotations = map[string]string{kops.AnnotationNameReconcilePaused: "true"}
+		c.Spec.KubernetesVersion = "1.9.5"
+	})
+	applies := len(fake.applied)
+	now = now.Add(2 * time.Hour)
+	result, status = reconcile(t, r)
+	if result.Applied || !result.Paused || len(fake.applied) != applies {
+		t.Errorf("paused cluster was applied: %+v", result)
+	}
+	expectCondition(t, status, kops.ClusterConditionPaused, kops.ConditionTrue, "Annotated")
+	expectCondition(t, status, kops.ClusterConditionReconciled, kops.ConditionFalse, "Paused")
+
+	// Clusters locked by another operation are applied once the lock is released
+	updateCluster(t, clientset, func(c *kops.Cluster) { c.ObjectMeta.Annotations = nil })
+	locked, err := clientset.GetCluster("cluster.example.com")
+	if err != nil {
+		t.Fatalf("error reading cluster: %v", err)
+	}
+	lease, err := statelock.Acquire(locked, "update cluster")
+	if err != nil {
+		t.Fatalf("error locking cluster: %v", err)
+	}
+	result, status = reconcile(t, r)
+	if result.Applied || !result.Locked {
+		t.Errorf("locked cluster was applied: %+v", result)
+	}
+	expectCondition(t, status, kops.ClusterConditionReconciled, kops.ConditionFalse, "Pending")
+	if err := lease.Release(); err != nil {
+		t.Fatalf("error releasing lock: %v", err)
+	}
+	if result, _ := reconcile(t, r); !result.Applied {
+		t.Errorf("expected cluster to be applied once unlocked")
+	}
+
+	w := httptest.NewRecorder()
+	r.Metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	text := w.Body.String()
+	for _, line := range []string{
+		`kops_reconcile_runs_total{cluster="cluster.example.com"} 6`,
+		`kops_reconcile_errors_total{cluster="cluster.example.com"} 1`,
+		`kops_reconcile_paused{cluster="cluster.example.com"} 0`,
+		`kops_reconcile_reconciled{cluster="cluster.example.com"} 1`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("metrics did not contain %q:\n%s", line, text)
+		}
+	}
+}
+
+func TestRunWatchesCluster(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	server := mockapiserver.New()
+	defer server.Close()
+
+	clientset, err := api.NewCRDClientset(server.Config())
+	if err != nil {
+		t.Fatalf("error building clientset: %v", err)
+	}
+	if _, err := clientset.CreateCluster(buildTestCluster()); err != nil {
+		t.Fatalf("error creating cluster: %v", err)
+	}
+
+	applied := make(chan *kops.Cluster, 10)
+	r := &Reconciler{
+		Clientset:   clientset,
+		ClusterName: "cluster.example.com",
+		// Only the watch can trigger the second apply
+		PollInterval: time.Hour,
+		Apply: func(clientset simple.Clientset, cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) error {
+			applied <- cluster
+			return nil
+		},
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Run(stop)
+		close(done)
+	}()
+
+	next := func() *kops.Cluster {
+		select {
+		case cluster := <-applied:
+			return cluster
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for cluster to be applied")
+		}
+		return nil
+	}
+
+	next()
+
+	// Wait for the status to be written, so that it does not conflict with the change, and for the watch to be established
+	for i := 0; ; i++ {
+		cluster, err := clientset.GetCluster("cluster.example.com")
+		if err != nil {
+			t.Fatalf("error reading cluster: %v", err)
+		}
+		if cluster.Status != nil {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("timeout waiting for status to be written")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	updateCluster(t, clientset, func(c *kops.Cluster) { c.Spec.KubernetesVersion = "1.9.4" })
+	if cluster := next(); cluster.Spec.KubernetesVersion != "1.9.4" {
+		t.Errorf("unexpected cluster applied: %v", cluster.Spec.KubernetesVersion)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for reconciler to stop")
+	}
+}
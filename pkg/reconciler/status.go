@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconciler
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// FindCondition returns the condition of the given type, or nil if the status does not have it
+func FindCondition(status *kops.ClusterReconcileStatus, conditionType kops.ClusterConditionType) *kops.ClusterCondition {
+	if status == nil {
+		return nil
+	}
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func isConditionTrue(status *kops.ClusterReconcileStatus, conditionType kops.ClusterConditionType) bool {
+	condition := FindCondition(status, conditionType)
+	return condition != nil && condition.Status == kops.ConditionTrue
+}
+
+// setCondition adds or replaces the condition in the status.  The transition time of an existing condition is
+// kept if its status does not change.
+func setCondition(status *kops.ClusterReconcileStatus, condition kops.ClusterCondition, now time.Time) {
+	existing := FindCondition(status, condition.Type)
+	if existing == nil {
+		condition.LastTransitionTime = metav1.NewTime(now.UTC())
+		status.Conditions = append(status.Conditions, condition)
+		return
+	}
+
+	if existing.Status == condition.Status {
+		condition.LastTransitionTime = existing.LastTransitionTime
+	} else {
+		condition.LastTransitionTime = metav1.NewTime(now.UTC())
+	}
+	*existing = condition
+}
+
+// statusEqual returns true if the statuses are the same, comparing times as instants
+func statusEqual(a, b *kops.ClusterReconcileStatus) bool {
+	return equality.Semantic.DeepEqual(a, b)
+}
@@ -92,6 +92,18 @@ func (c *Cloud) DeleteGroup(g *cloudinstances.CloudInstanceGroup) error {
 	return fmt.Errorf("digital ocean cloud provider does not support deleting cloud groups at this time")
 }
 
+// ResizeGroup is not implemented yet, is a func that needs to resize a DO instance group.
+func (c *Cloud) ResizeGroup(g *cloudinstances.CloudInstanceGroup, targetSize int) error {
+	glog.V(8).Infof("digitalocean cloud provider ResizeGroup not implemented yet")
+	return fmt.Errorf("digital ocean cloud provider does not support resizing cloud groups at this time")
+}
+
+// ScaleInInstance is not implemented yet, is a func that needs to delete a DO instance and shrink its group.
+func (c *Cloud) ScaleInInstance(i *cloudinstances.CloudInstanceGroupMember) error {
+	glog.V(8).Infof("digitalocean cloud provider ScaleInInstance not implemented yet")
+	return fmt.Errorf("digital ocean cloud provider does not support scaling in cloud groups at this time")
+}
+
 // DeleteInstance is not implemented yet, is func needs to delete a DO instance.
 func (c *Cloud) DeleteInstance(i *cloudinstances.CloudInstanceGroupMember) error {
 	glog.V(8).Infof("digitalocean cloud provider DeleteInstance not implemented yet")
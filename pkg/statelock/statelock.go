@@ -0,0 +1,368 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statelock
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/acls"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/upup/pkg/fi/utils"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// LeaseDuration is how long a lock is held without a heartbeat before it expires
+const LeaseDuration = 5 * time.Minute
+
+// HeartbeatInterval is how often a held lock is renewed
+const HeartbeatInterval = time.Minute
+
+// Lock is the advisory lock held in the state store while an operation changes a cluster
+type Lock struct {
+	// ID identifies the holder of the lock
+	ID string `json:"id"`
+	// Owner is the user and host that holds the lock
+	Owner string `json:"owner"`
+	// Operation is the kops command that holds the lock
+	Operation string `json:"operation"`
+	// Acquired is the time the lock was acquired
+	Acquired time.Time `json:"acquired"`
+	// Heartbeat is the time the lock was last renewed
+	Heartbeat time.Time `json:"heartbeat"`
+	// Expires is the time after which the lock is no longer held, unless it is renewed
+	Expires time.Time `json:"expires"`
+}
+
+// IsExpired returns true if the lock has not been renewed in time, so can be taken over
+func (l *Lock) IsExpired(now time.Time) bool {
+	return now.After(l.Expires)
+}
+
+// LockedError is returned when acquiring a lock that is held by another operation
+type LockedError struct {
+	Cluster string
+	Lock    *Lock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("cluster %q is locked by %s for %q since %s (expires %s); if that operation is no longer running, remove the lock with kops delete lock --name %s --force",
+		e.Cluster, e.Lock.Owner, e.Lock.Operation, e.Lock.Acquired.Format(time.RFC3339), e.Lock.Expires.Format(time.RFC3339), e.Cluster)
+}
+
+// IsLocked returns true if the error is a *LockedError
+func IsLocked(err error) bool {
+	_, ok := err.(*LockedError)
+	return ok
+}
+
+// Lease is a lock held by this process, which is renewed until it is released
+type Lease struct {
+	cluster  string
+	path     vfs.Path
+	acl      vfs.ACL
+	duration time.Duration
+
+	mutex   sync.Mutex
+	lock    Lock
+	version string
+	lost    bool
+
+	stop chan struct{}
+	done chan struct{}
+	// lostCh is closed when the lock is lost
+	lostCh chan struct{}
+}
+
+// Acquire takes the lock on the cluster for the operation, failing with a *LockedError if another operation holds it.
+// An expired lock is taken over.  The lock is renewed in the background until the lease is released.
+func Acquire(cluster *kops.Cluster, operation string) (*Lease, error) {
+	configBase, err := registry.ConfigBase(cluster)
+	if err != nil {
+		return nil, err
+	}
+	p := configBase.Join(registry.PathLock)
+	acl, err := acls.GetACL(p, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	lease, err := acquire(cluster.ObjectMeta.Name, p, acl, operation, LeaseDuration)
+	if err != nil {
+		return nil, err
+	}
+	go lease.heartbeat(HeartbeatInterval)
+	return lease, nil
+}
+
+func acquire(cluster string, p vfs.Path, acl vfs.ACL, operation string, duration time.Duration) (*Lease, error) {
+	id, err := newLockID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	lease := &Lease{
+		cluster:  cluster,
+		path:     p,
+		acl:      acl,
+		duration: duration,
+		lock: Lock{
+			ID:        id,
+			Owner:     utils.UserAtHost(),
+			Operation: operation,
+			Acquired:  now,
+			Heartbeat: now,
+			Expires:   now.Add(duration),
+		},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		lostCh: make(chan struct{}),
+	}
+	data, err := utils.YamlMarshal(&lease.lock)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing lock: %v", err)
+	}
+
+	_, conditional := p.(vfs.VersionedPath)
+	if !conditional {
+		glog.Warningf("the state store cannot create %s only if it does not exist, so the lock on cluster %q is taken on a best-effort basis, and does not stop operations that start at the same time", p, cluster)
+	}
+
+	// We retry once, in case the lock is created or taken over between reading and writing it
+	for attempt := 0; attempt < 2; attempt++ {
+		existing, version, err := readLock(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if existing == nil {
+			// When the store checks that the lock does not exist as part of the write, only one operation can create it
+			newVersion, err := vfs.CreateFileVersion(p, bytes.NewReader(data), acl)
+			if err != nil {
+				if os.IsExist(err) {
+					continue
+				}
+				return nil, fmt.Errorf("error writing lock %s: %v", p, err)
+			}
+			if !conditional {
+				// Another operation may have written the lock at the same time; the last write is the one that is kept
+				current, currentVersion, err := readLock(p)
+				if err != nil {
+					return nil, err
+				}
+				if current == nil || current.ID != lease.lock.ID {
+					continue
+				}
+				newVersion = currentVersion
+			}
+			lease.version = newVersion
+			return lease, nil
+		}
+
+		if !existing.IsExpired(now) {
+			return nil, &LockedError{Cluster: cluster, Lock: existing}
+		}
+
+		glog.Warningf("taking over the lock on cluster %q held by %s for %q, which expired at %s", cluster, existing.Owner, existing.Operation, existing.Expires.Format(time.RFC3339))
+		newVersion, err := vfs.WriteFileVersion(p, bytes.NewReader(data), acl, version)
+		if err != nil {
+			if vfs.IsConflict(err) {
+				continue
+			}
+			return nil, fmt.Errorf("error writing lock %s: %v", p, err)
+		}
+		lease.version = newVersion
+		return lease, nil
+	}
+
+	existing, _, err := readLock(p)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, &LockedError{Cluster: cluster, Lock: existing}
+	}
+	return nil, fmt.Errorf("unable to acquire lock %s: it is being changed concurrently", p)
+}
+
+// heartbeat renews the lock every interval, until the lease is released or the lock is lost.
+// The lock is lost if another operation removes or takes it over, or if it expires because it could not be renewed.
+func (l *Lease) heartbeat(interval time.Duration) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.renew(); err != nil {
+				if vfs.IsConflict(err) {
+					glog.Errorf("the lock on cluster %q was removed or taken over by another operation", l.cluster)
+					l.markLost()
+					return
+				}
+				glog.Warningf("error renewing the lock on cluster %q: %v", l.cluster, err)
+				if l.isExpired(time.Now().UTC()) {
+					glog.Errorf("the lock on cluster %q expired before it could be renewed, and can be taken over by another operation", l.cluster)
+					l.markLost()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Lost returns a channel that is closed when the lock is lost, after which changes to the cluster may
+// conflict with another operation, so the operation holding the lease should stop
+func (l *Lease) Lost() <-chan struct{} {
+	return l.lostCh
+}
+
+// markLost records that the lock is no longer held, and notifies Lost
+func (l *Lease) markLost() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.lost = true
+	close(l.lostCh)
+}
+
+// isExpired returns true if the lock was not renewed before it expired
+func (l *Lease) isExpired(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.lock.IsExpired(now)
+}
+
+// renew extends the expiry of the lock, failing with a *vfs.ConflictError if the lock is no longer ours
+func (l *Lease) renew() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now().UTC()
+	renewed := l.lock
+	renewed.Heartbeat = now
+	renewed.Expires = now.Add(l.duration)
+
+	data, err := utils.YamlMarshal(&renewed)
+	if err != nil {
+		return fmt.Errorf("error serializing lock: %v", err)
+	}
+	version, err := vfs.WriteFileVersion(l.path, bytes.NewReader(data), l.acl, l.version)
+	if err != nil {
+		return err
+	}
+
+	l.lock = renewed
+	l.version = version
+	return nil
+}
+
+// Release stops renewing the lock and removes it, if it is still held by this lease
+func (l *Lease) Release() error {
+	close(l.stop)
+	<-l.done
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.lost {
+		return nil
+	}
+
+	existing, _, err := readLock(l.path)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		// Removed along with the cluster state, or by kops delete lock
+		return nil
+	}
+	if existing.ID != l.lock.ID {
+		glog.Warningf("not releasing the lock on cluster %q, as it is now held by %s for %q", l.cluster, existing.Owner, existing.Operation)
+		return nil
+	}
+
+	if err := l.path.Remove(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing lock %s: %v", l.path, err)
+	}
+	return nil
+}
+
+// Read returns the lock on the cluster, or nil if the cluster is not locked
+func Read(cluster *kops.Cluster) (*Lock, error) {
+	configBase, err := registry.ConfigBase(cluster)
+	if err != nil {
+		return nil, err
+	}
+	lock, _, err := readLock(configBase.Join(registry.PathLock))
+	return lock, err
+}
+
+// Delete removes the lock on the cluster, whichever operation holds it
+func Delete(cluster *kops.Cluster) error {
+	configBase, err := registry.ConfigBase(cluster)
+	if err != nil {
+		return err
+	}
+	p := configBase.Join(registry.PathLock)
+	if err := p.Remove(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing lock %s: %v", p, err)
+	}
+	return nil
+}
+
+// readLock reads the lock and its version, returning a nil lock if there is none
+func readLock(p vfs.Path) (*Lock, string, error) {
+	data, version, err := vfs.ReadFileVersion(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("error reading lock %s: %v", p, err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return nil, "", nil
+	}
+
+	lock := &Lock{}
+	if err := utils.YamlUnmarshal(data, lock); err != nil {
+		return nil, "", fmt.Errorf("error parsing lock %s: %v", p, err)
+	}
+	return lock, version, nil
+}
+
+func newLockID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating lock id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
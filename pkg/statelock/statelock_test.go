@@ -0,0 +1,187 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statelock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestAcquireAndRelease(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+	p, err := vfs.Context.BuildVfsPath("memfs://state/cluster.example.com/lock")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+
+	first, err := acquire("cluster.example.com", p, nil, "update cluster", time.Hour)
+	if err != nil {
+		t.Fatalf("error acquiring lock: %v", err)
+	}
+
+	_, err = acquire("cluster.example.com", p, nil, "rolling-update cluster", time.Hour)
+	if !IsLocked(err) {
+		t.Fatalf("expected the lock to be held, got %v", err)
+	}
+	if lock := err.(*LockedError).Lock; lock.Operation != "update cluster" || lock.ID != first.lock.ID {
+		t.Errorf("unexpected lock reported: %+v", lock)
+	}
+
+	// Renewing extends the expiry
+	expires := first.lock.Expires
+	time.Sleep(time.Millisecond)
+	if err := first.renew(); err != nil {
+		t.Fatalf("error renewing lock: %v", err)
+	}
+	held, _, err := readLock(p)
+	if err != nil {
+		t.Fatalf("error reading lock: %v", err)
+	}
+	if !held.Expires.After(expires) {
+		t.Errorf("renewing did not extend the expiry: %v is not after %v", held.Expires, expires)
+	}
+
+	close(first.done)
+	if err := first.Release(); err != nil {
+		t.Fatalf("error releasing lock: %v", err)
+	}
+	if lock, _, _ := readLock(p); lock != nil {
+		t.Errorf("lock was not removed on release: %+v", lock)
+	}
+
+	second, err := acquire("cluster.example.com", p, nil, "rolling-update cluster", time.Hour)
+	if err != nil {
+		t.Fatalf("error acquiring released lock: %v", err)
+	}
+	close(second.done)
+	if err := second.Release(); err != nil {
+		t.Fatalf("error releasing lock: %v", err)
+	}
+}
+
+func TestExpiredLockIsTakenOver(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+	p, err := vfs.Context.BuildVfsPath("memfs://state/cluster.example.com/lock")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+
+	stale, err := acquire("cluster.example.com", p, nil, "update cluster", -time.Second)
+	if err != nil {
+		t.Fatalf("error acquiring lock: %v", err)
+	}
+
+	current, err := acquire("cluster.example.com", p, nil, "delete cluster", time.Hour)
+	if err != nil {
+		t.Fatalf("error taking over expired lock: %v", err)
+	}
+
+	// The previous holder can no longer renew or release the lock
+	if err := stale.renew(); !vfs.IsConflict(err) {
+		t.Errorf("expected conflict renewing a lock that was taken over, got %v", err)
+	}
+	close(stale.done)
+	if err := stale.Release(); err != nil {
+		t.Fatalf("error releasing lock: %v", err)
+	}
+	held, _, err := readLock(p)
+	if err != nil {
+		t.Fatalf("error reading lock: %v", err)
+	}
+	if held == nil || held.ID != current.lock.ID {
+		t.Errorf("expected the lock to still be held by the new holder, got %+v", held)
+	}
+}
+
+func TestLostLease(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+	p, err := vfs.Context.BuildVfsPath("memfs://state/cluster.example.com/lock")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+
+	lease, err := acquire("cluster.example.com", p, nil, "update cluster", time.Hour)
+	if err != nil {
+		t.Fatalf("error acquiring lock: %v", err)
+	}
+	go lease.heartbeat(time.Millisecond)
+
+	select {
+	case <-lease.Lost():
+		t.Fatalf("lease was lost while the lock was held")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Removing the lock, as kops delete lock --force does, makes the next renewal fail
+	if err := p.Remove(); err != nil {
+		t.Fatalf("error removing lock: %v", err)
+	}
+	select {
+	case <-lease.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("lease was not reported lost after the lock was removed")
+	}
+
+	if err := lease.Release(); err != nil {
+		t.Fatalf("error releasing lost lease: %v", err)
+	}
+}
+
+// unversionedPath hides the conditional writes of a path, like the stores that do not support them
+type unversionedPath struct {
+	storePath
+}
+
+type storePath interface {
+	vfs.Path
+}
+
+func TestAcquireWithoutConditionalCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statelock")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The lock is taken on a best-effort basis on a store that cannot create it only if it does not exist
+	p := &unversionedPath{storePath: vfs.NewFSPath(filepath.Join(dir, "lock"))}
+	lease, err := acquire("cluster.example.com", p, nil, "update cluster", time.Hour)
+	if err != nil {
+		t.Fatalf("error acquiring lock on a store without conditional writes: %v", err)
+	}
+
+	if _, err := acquire("cluster.example.com", p, nil, "rolling-update cluster", time.Hour); !IsLocked(err) {
+		t.Errorf("expected locked error acquiring held lock, got %v", err)
+	}
+
+	if err := lease.renew(); err != nil {
+		t.Errorf("error renewing lock: %v", err)
+	}
+
+	close(lease.done)
+	if err := lease.Release(); err != nil {
+		t.Fatalf("error releasing lock: %v", err)
+	}
+	if _, err := p.ReadFile(); !os.IsNotExist(err) {
+		t.Errorf("expected lock to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,487 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mockapiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
+)
+
+// object is a stored object, as decoded from JSON
+type object map[string]interface{}
+
+// MockAPIServer is an in-memory Kubernetes API server for tests.  It serves namespaces, CustomResourceDefinitions,
+// and the custom resources they define, with create, get, list, update, delete and watch.
+type MockAPIServer struct {
+	server *httptest.Server
+
+	mutex           sync.Mutex
+	objects         map[string]object
+	resourceVersion int
+	watchers        map[*watcher]bool
+	stop            chan struct{}
+}
+
+// watcher receives the events for a resource, in a namespace or in all namespaces
+type watcher struct {
+	collection string
+	namespace  string
+	events     chan metav1.WatchEvent
+}
+
+// request is the object or collection addressed by a request
+type request struct {
+	// groupVersion is the prefix of the path, for example /apis/kops.k8s.io/v1alpha2
+	groupVersion string
+	namespace    string
+	resource     string
+	name         string
+}
+
+func (r *request) collection() string {
+	return r.groupVersion + "/" + r.resource
+}
+
+func (r *request) key(namespace string, name string) string {
+	return r.collection() + "/" + namespace + "/" + name
+}
+
+// New starts a MockAPIServer; it must be stopped with Close
+func New() *MockAPIServer {
+	m := &MockAPIServer{
+		objects:  make(map[string]object),
+		watchers: make(map[*watcher]bool),
+		stop:     make(chan struct{}),
+	}
+	m.server = httptest.NewServer(m)
+	return m
+}
+
+// Close stops the server, ending any watches
+func (m *MockAPIServer) Close() {
+	close(m.stop)
+	m.server.Close()
+}
+
+// Config returns the configuration for a client of the server, without client-side rate limiting
+func (m *MockAPIServer) Config() *rest.Config {
+	return &rest.Config{Host: m.server.URL, QPS: 1000, Burst: 1000}
+}
+
+// Keys returns the keys of the stored objects, of the form <path of collection>/<namespace>/<name>, sorted
+func (m *MockAPIServer) Keys() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var keys []string
+	for k := range m.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ServeHTTP implements http.Handler
+func (m *MockAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := parseRequest(r.URL.Path)
+	if err != nil {
+		writeStatus(w, errors.NewBadRequest(err.Error()))
+		return
+	}
+
+	if req.groupVersion != "/api/v1" && req.groupVersion != "/apis/apiextensions.k8s.io/v1beta1" {
+		if m.listKind(req) == "" {
+			writeStatus(w, errors.NewNotFound(schema.GroupResource{Resource: req.resource}, req.name))
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if req.name != "" {
+			m.get(w, req)
+		} else if r.URL.Query().Get("watch") == "true" {
+			m.watch(w, r, req)
+		} else {
+			m.list(w, req)
+		}
+	case http.MethodPost:
+		m.create(w, r, req)
+	case http.MethodPut:
+		m.update(w, r, req)
+	case http.MethodDelete:
+		m.delete(w, req)
+	default:
+		writeStatus(w, errors.NewMethodNotSupported(schema.GroupResource{Resource: req.resource}, r.Method))
+	}
+}
+
+// parseRequest splits the path of a request into its group version, namespace, resource and name
+func parseRequest(path string) (*request, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	req := &request{}
+	switch {
+	case len(segments) >= 3 && segments[0] == "api":
+		req.groupVersion = "/" + strings.Join(segments[:2], "/")
+		segments = segments[2:]
+	case len(segments) >= 4 && segments[0] == "apis":
+		req.groupVersion = "/" + strings.Join(segments[:3], "/")
+		segments = segments[3:]
+	default:
+		return nil, fmt.Errorf("unsupported path %q", path)
+	}
+
+	if len(segments) >= 3 && segments[0] == "namespaces" {
+		req.namespace = segments[1]
+		segments = segments[2:]
+	}
+	switch len(segments) {
+	case 1:
+		req.resource = segments[0]
+	case 2:
+		req.resource = segments[0]
+		req.name = segments[1]
+	default:
+		return nil, fmt.Errorf("unsupported path %q", path)
+	}
+	return req, nil
+}
+
+// listKind returns the kind of a list of the resource, or "" if the resource is not served
+func (m *MockAPIServer) listKind(req *request) string {
+	switch req.collection() {
+	case "/api/v1/namespaces":
+		return "NamespaceList"
+	case "/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions":
+		return "CustomResourceDefinitionList"
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tokens := strings.Split(req.groupVersion, "/")
+	crd := m.objects["/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions//"+req.resource+"."+tokens[2]]
+	if crd == nil {
+		return ""
+	}
+	spec, _ := crd["spec"].(map[string]interface{})
+	if spec["version"] != tokens[3] {
+		return ""
+	}
+	names, _ := spec["names"].(map[string]interface{})
+	listKind, _ := names["listKind"].(string)
+	return listKind
+}
+
+func (m *MockAPIServer) get(w http.ResponseWriter, req *request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	o := m.objects[req.key(req.namespace, req.name)]
+	if o == nil {
+		writeStatus(w, errors.NewNotFound(schema.GroupResource{Resource: req.resource}, req.name))
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (m *MockAPIServer) list(w http.ResponseWriter, req *request) {
+	listKind := m.listKind(req)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	items := []object{}
+	for _, k := range m.matchingKeys(req) {
+		items = append(items, m.objects[k])
+	}
+
+	list := object{
+		"apiVersion": strings.TrimPrefix(strings.TrimPrefix(req.groupVersion, "/api/"), "/apis/"),
+		"kind":       listKind,
+		"metadata":   map[string]interface{}{"resourceVersion": strconv.Itoa(m.resourceVersion)},
+		"items":      items,
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// matchingKeys returns the sorted keys of the objects in the collection and namespace of the request
+func (m *MockAPIServer) matchingKeys(req *request) []string {
+	prefix := req.collection() + "/"
+	if req.namespace != "" {
+		prefix += req.namespace + "/"
+	}
+
+	var keys []string
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *MockAPIServer) create(w http.ResponseWriter, r *http.Request, req *request) {
+	o, err := readObject(r)
+	if err != nil {
+		writeStatus(w, errors.NewBadRequest(err.Error()))
+		return
+	}
+	metadata := o.metadata()
+	name, _ := metadata["name"].(string)
+	if name == "" {
+		writeStatus(w, errors.NewBadRequest("metadata.name is required"))
+		return
+	}
+	if msgs := validation.IsDNS1123Subdomain(name); len(msgs) != 0 {
+		writeStatus(w, errors.NewBadRequest(fmt.Sprintf("metadata.name %q is invalid: %s", name, strings.Join(msgs, ", "))))
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if req.namespace != "" && m.objects["/api/v1/namespaces//"+req.namespace] == nil {
+		writeStatus(w, errors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, req.namespace))
+		return
+	}
+
+	key := req.key(req.namespace, name)
+	if m.objects[key] != nil {
+		writeStatus(w, errors.NewAlreadyExists(schema.GroupResource{Resource: req.resource}, name))
+		return
+	}
+
+	if req.namespace != "" {
+		metadata["namespace"] = req.namespace
+	}
+	metadata["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+	metadata["uid"] = fmt.Sprintf("uid-%d", m.resourceVersion+1)
+	if req.resource == "customresourcedefinitions" {
+		o["status"] = map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Established", "status": "True"},
+			},
+		}
+	}
+
+	m.store(key, req, o, watchEventAdded)
+	writeJSON(w, http.StatusCreated, o)
+}
+
+func (m *MockAPIServer) update(w http.ResponseWriter, r *http.Request, req *request) {
+	o, err := readObject(r)
+	if err != nil {
+		writeStatus(w, errors.NewBadRequest(err.Error()))
+		return
+	}
+	metadata := o.metadata()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := req.key(req.namespace, req.name)
+	existing := m.objects[key]
+	if existing == nil {
+		writeStatus(w, errors.NewNotFound(schema.GroupResource{Resource: req.resource}, req.name))
+		return
+	}
+	resourceVersion, _ := metadata["resourceVersion"].(string)
+	if resourceVersion == "" {
+		writeStatus(w, errors.NewBadRequest("metadata.resourceVersion must be specified for an update"))
+		return
+	}
+	if resourceVersion != existing.metadata()["resourceVersion"] {
+		writeStatus(w, errors.NewConflict(schema.GroupResource{Resource: req.resource}, req.name, fmt.Errorf("the object has been modified")))
+		return
+	}
+
+	for _, k := range []string{"namespace", "creationTimestamp", "uid"} {
+		if v, found := existing.metadata()[k]; found {
+			metadata[k] = v
+		}
+	}
+
+	m.store(key, req, o, watchEventModified)
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (m *MockAPIServer) delete(w http.ResponseWriter, req *request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := req.key(req.namespace, req.name)
+	o := m.objects[key]
+	if o == nil {
+		writeStatus(w, errors.NewNotFound(schema.GroupResource{Resource: req.resource}, req.name))
+		return
+	}
+	delete(m.objects, key)
+	m.notify(req, o, watchEventDeleted)
+
+	if req.collection() == "/api/v1/namespaces" {
+		for k, o := range m.objects {
+			if o.metadata()["namespace"] == req.name {
+				delete(m.objects, k)
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusSuccess,
+	})
+}
+
+const (
+	watchEventAdded    = "ADDED"
+	watchEventModified = "MODIFIED"
+	watchEventDeleted  = "DELETED"
+)
+
+// store saves the object with a new resourceVersion, and notifies the watchers
+func (m *MockAPIServer) store(key string, req *request, o object, eventType string) {
+	m.resourceVersion++
+	o.metadata()["resourceVersion"] = strconv.Itoa(m.resourceVersion)
+	m.objects[key] = o
+	m.notify(req, o, eventType)
+}
+
+// notify sends the event to the watchers of the collection of the object
+func (m *MockAPIServer) notify(req *request, o object, eventType string) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		panic(fmt.Sprintf("error serializing object: %v", err))
+	}
+	namespace, _ := o.metadata()["namespace"].(string)
+	for w := range m.watchers {
+		if w.collection != req.collection() || (w.namespace != "" && w.namespace != namespace) {
+			continue
+		}
+		event := metav1.WatchEvent{Type: eventType}
+		event.Object.Raw = data
+		select {
+		case w.events <- event:
+		default:
+			panic("watcher is not reading events")
+		}
+	}
+}
+
+func (m *MockAPIServer) watch(w http.ResponseWriter, r *http.Request, req *request) {
+	watcher := &watcher{
+		collection: req.collection(),
+		namespace:  req.namespace,
+		events:     make(chan metav1.WatchEvent, 100),
+	}
+
+	m.mutex.Lock()
+	if r.URL.Query().Get("resourceVersion") == "" {
+		// Without a resourceVersion, the watch starts with the existing objects
+		for _, k := range m.matchingKeys(req) {
+			data, err := json.Marshal(m.objects[k])
+			if err != nil {
+				panic(fmt.Sprintf("error serializing object: %v", err))
+			}
+			event := metav1.WatchEvent{Type: watchEventAdded}
+			event.Object.Raw = data
+			watcher.events <- event
+		}
+	}
+	m.watchers[watcher] = true
+	m.mutex.Unlock()
+
+	defer func() {
+		m.mutex.Lock()
+		delete(m.watchers, watcher)
+		m.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher := w.(http.Flusher)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case event := <-watcher.events:
+			if err := encoder.Encode(&event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (o object) metadata() map[string]interface{} {
+	metadata, _ := o["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+		o["metadata"] = metadata
+	}
+	return metadata
+}
+
+func readObject(r *http.Request) (object, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading body: %v", err)
+	}
+	o := object{}
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("error parsing body: %v", err)
+	}
+	return o, nil
+}
+
+func writeStatus(w http.ResponseWriter, err *errors.StatusError) {
+	status := err.ErrStatus
+	status.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+	writeJSON(w, int(status.Code), &status)
+}
+
+func writeJSON(w http.ResponseWriter, code int, o interface{}) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"k8s.io/kops/channels/pkg/channels"
+	"k8s.io/kops/pkg/apis/kops/util"
+)
+
+func init() {
+	RegisterCheck("addons", NewCheck("the installed addons match the versions in the cluster's bootstrap channel", runAddonsCheck))
+}
+
+func runAddonsCheck(ctx *CheckContext) (*CheckResult, error) {
+	if ctx.ConfigBase == nil {
+		return &CheckResult{
+			Status:  CheckStatusSkipped,
+			Message: "the state store is not available",
+		}, nil
+	}
+
+	channelPath := ctx.ConfigBase.Join("addons", "bootstrap-channel.yaml")
+	data, err := channelPath.ReadFile()
+	if err != nil {
+		return nil, fmt.Errorf("error reading addons channel %q: %v", channelPath, err)
+	}
+
+	location, err := url.Parse(channelPath.Path())
+	if err != nil {
+		return nil, fmt.Errorf("error parsing addons channel location %q: %v", channelPath, err)
+	}
+
+	addons, err := channels.ParseAddons(channelPath.Path(), location, data)
+	if err != nil {
+		return nil, err
+	}
+
+	kubernetesVersion, err := util.ParseKubernetesVersion(ctx.Cluster.Spec.KubernetesVersion)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse KubernetesVersion %q: %v", ctx.Cluster.Spec.KubernetesVersion, err)
+	}
+
+	menu, err := addons.GetCurrent(*kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range menu.Addons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := &CheckResult{}
+	for _, name := range names {
+		update, err := menu.Addons[name].GetRequiredUpdates(ctx.K8sClient)
+		if err != nil {
+			return nil, fmt.Errorf("error checking version of addon %q: %v", name, err)
+		}
+		if update == nil {
+			continue
+		}
+
+		message := fmt.Sprintf("addon %q is not installed; the channel has version %s", name, addonVersion(update.NewVersion))
+		if update.ExistingVersion != nil {
+			message = fmt.Sprintf("addon %q is at version %s, but the channel has version %s", name, addonVersion(update.ExistingVersion), addonVersion(update.NewVersion))
+		}
+		result.Failures = append(result.Failures, &ValidationError{
+			Kind:    "Addon",
+			Name:    name,
+			Message: message,
+		})
+	}
+	result.Message = fmt.Sprintf("%d addon(s) in channel", len(names))
+	return result, nil
+}
+
+func addonVersion(v *channels.ChannelVersion) string {
+	if v == nil || v.Version == nil {
+		return "(unknown)"
+	}
+	return *v.Version
+}
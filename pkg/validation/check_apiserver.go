@@ -0,0 +1,65 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// apiserverLatencySamples is the number of requests we time to measure the apiserver latency
+const apiserverLatencySamples = 5
+
+// apiserverLatencyThreshold is the median latency above which the apiserver is considered unhealthy
+var apiserverLatencyThreshold = time.Second
+
+func init() {
+	RegisterCheck("apiserver-latency", NewCheck(fmt.Sprintf("the median latency of apiserver requests is below %s", apiserverLatencyThreshold), runAPIServerLatencyCheck))
+}
+
+func runAPIServerLatencyCheck(ctx *CheckContext) (*CheckResult, error) {
+	var latencies []time.Duration
+	for i := 0; i < apiserverLatencySamples; i++ {
+		start := time.Now()
+		if _, err := ctx.K8sClient.Discovery().ServerVersion(); err != nil {
+			return nil, fmt.Errorf("error querying apiserver version: %v", err)
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	median := latencies[len(latencies)/2]
+	max := latencies[len(latencies)-1]
+
+	result := &CheckResult{
+		Details: map[string]string{
+			"median": median.String(),
+			"max":    max.String(),
+		},
+	}
+	if median > apiserverLatencyThreshold {
+		result.Failures = append(result.Failures, &ValidationError{
+			Kind:    "APIServer",
+			Name:    "latency",
+			Message: fmt.Sprintf("median apiserver latency of %s exceeds %s", median, apiserverLatencyThreshold),
+		})
+	}
+	return result, nil
+}
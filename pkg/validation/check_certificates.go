@@ -0,0 +1,84 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// certificateExpiryWarning is how far ahead we warn that a certificate will expire
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+func init() {
+	RegisterCheck("certificates", NewCheck("the primary certificates in the cluster keystore have not expired", runCertificatesCheck))
+}
+
+func runCertificatesCheck(ctx *CheckContext) (*CheckResult, error) {
+	if ctx.KeyStore == nil {
+		return &CheckResult{
+			Status:  CheckStatusSkipped,
+			Message: "the keystore is not available",
+		}, nil
+	}
+
+	keysets, err := ctx.KeyStore.ListKeysets()
+	if err != nil {
+		return nil, fmt.Errorf("error listing keysets: %v", err)
+	}
+
+	var names []string
+	for _, keyset := range keysets {
+		names = append(names, keyset.Name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	result := &CheckResult{
+		Details: make(map[string]string),
+	}
+	var expiring []string
+	for _, name := range names {
+		pool, err := ctx.KeyStore.FindCertificatePool(name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading certificate %q: %v", name, err)
+		}
+		if pool == nil || pool.Primary == nil || pool.Primary.Certificate == nil {
+			continue
+		}
+
+		notAfter := pool.Primary.Certificate.NotAfter
+		result.Details[name] = notAfter.UTC().Format(time.RFC3339)
+
+		if notAfter.Before(now) {
+			result.Failures = append(result.Failures, &ValidationError{
+				Kind:    "Certificate",
+				Name:    name,
+				Message: fmt.Sprintf("certificate %q expired at %s", name, notAfter.UTC().Format(time.RFC3339)),
+			})
+		} else if notAfter.Before(now.Add(certificateExpiryWarning)) {
+			expiring = append(expiring, name)
+		}
+	}
+
+	if len(expiring) != 0 {
+		result.Message = fmt.Sprintf("certificates expiring within %d days: %s", int(certificateExpiryWarning.Hours()/24), strings.Join(expiring, ", "))
+	}
+	return result, nil
+}
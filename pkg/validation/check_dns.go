@@ -0,0 +1,116 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// dnsCheckImage is the image used to resolve a name from inside the cluster
+	dnsCheckImage = "busybox:1.28"
+	// dnsCheckNamespace is the namespace in which the dns check pod runs
+	dnsCheckNamespace = "kube-system"
+)
+
+var (
+	// dnsCheckTimeout is how long we wait for the dns check pod to complete
+	dnsCheckTimeout = 2 * time.Minute
+	// dnsCheckPollInterval is how often we check whether the dns check pod has completed
+	dnsCheckPollInterval = 2 * time.Second
+)
+
+func init() {
+	RegisterCheck("dns", NewCheck("the kubernetes service name can be resolved from a pod in the cluster", runDNSCheck))
+}
+
+func runDNSCheck(ctx *CheckContext) (*CheckResult, error) {
+	domain := ctx.Cluster.Spec.ClusterDNSDomain
+	if domain == "" {
+		domain = "cluster.local"
+	}
+	host := "kubernetes.default.svc." + domain
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kops-validate-dns-" + utilrand.String(5),
+			Namespace: dnsCheckNamespace,
+			Labels: map[string]string{
+				"k8s-app": "kops-validate-dns",
+			},
+		},
+		Spec: v1.PodSpec{
+			RestartPolicy: v1.RestartPolicyNever,
+			Containers: []v1.Container{
+				{
+					Name:    "nslookup",
+					Image:   dnsCheckImage,
+					Command: []string{"nslookup", host},
+				},
+			},
+		},
+	}
+
+	pods := ctx.K8sClient.CoreV1().Pods(dnsCheckNamespace)
+	if _, err := pods.Create(pod); err != nil {
+		return nil, fmt.Errorf("error creating dns check pod: %v", err)
+	}
+	defer func() {
+		if err := pods.Delete(pod.Name, &metav1.DeleteOptions{}); err != nil {
+			glog.Warningf("Error deleting dns check pod %s/%s: %v", dnsCheckNamespace, pod.Name, err)
+		}
+	}()
+
+	var phase v1.PodPhase
+	err := wait.PollImmediate(dnsCheckPollInterval, dnsCheckTimeout, func() (bool, error) {
+		p, err := pods.Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			glog.V(2).Infof("Error getting dns check pod %s/%s: %v", dnsCheckNamespace, pod.Name, err)
+			return false, nil
+		}
+		phase = p.Status.Phase
+		return phase == v1.PodSucceeded || phase == v1.PodFailed, nil
+	})
+
+	result := &CheckResult{
+		Details: map[string]string{"host": host},
+	}
+	switch {
+	case err == wait.ErrWaitTimeout:
+		result.Failures = append(result.Failures, &ValidationError{
+			Kind:    "DNS",
+			Name:    host,
+			Message: fmt.Sprintf("dns check pod %s/%s did not complete within %s", dnsCheckNamespace, pod.Name, dnsCheckTimeout),
+		})
+	case err != nil:
+		return nil, err
+	case phase == v1.PodFailed:
+		result.Failures = append(result.Failures, &ValidationError{
+			Kind:    "DNS",
+			Name:    host,
+			Message: fmt.Sprintf("%q could not be resolved from inside the cluster", host),
+		})
+	}
+	return result, nil
+}
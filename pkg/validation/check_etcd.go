@@ -0,0 +1,101 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	RegisterCheck("etcd", NewCheck("all etcd members are running, and the apiserver can reach etcd", runEtcdCheck))
+}
+
+// etcdPodName returns the name protokube gives the pods of an etcd cluster, which is also their k8s-app label
+func etcdPodName(clusterName string) string {
+	if clusterName == "main" {
+		return "etcd-server"
+	}
+	return "etcd-server-" + clusterName
+}
+
+func runEtcdCheck(ctx *CheckContext) (*CheckResult, error) {
+	result := &CheckResult{
+		Details: make(map[string]string),
+	}
+
+	for _, etcdCluster := range ctx.Cluster.Spec.EtcdClusters {
+		podName := etcdPodName(etcdCluster.Name)
+		pods, err := ctx.K8sClient.CoreV1().Pods("kube-system").List(metav1.ListOptions{LabelSelector: "k8s-app=" + podName})
+		if err != nil {
+			return nil, fmt.Errorf("error listing pods for etcd cluster %q: %v", etcdCluster.Name, err)
+		}
+
+		ready := 0
+		for i := range pods.Items {
+			if IsPodReady(&pods.Items[i]) {
+				ready++
+			}
+		}
+
+		expected := len(etcdCluster.Members)
+		result.Details[etcdCluster.Name] = fmt.Sprintf("%d/%d", ready, expected)
+		if ready < expected {
+			message := fmt.Sprintf("etcd cluster %q has %d of %d members ready", etcdCluster.Name, ready, expected)
+			if ready <= expected/2 {
+				message += ", and has lost quorum"
+			}
+			result.Failures = append(result.Failures, &ValidationError{
+				Kind:    "Etcd",
+				Name:    etcdCluster.Name,
+				Message: message,
+			})
+		}
+	}
+
+	// The apiserver reports whether it can reach etcd in its health checks
+	restClient := ctx.K8sClient.Discovery().RESTClient()
+	if restClient != nil {
+		body, err := restClient.Get().AbsPath("/healthz/etcd").DoRaw()
+		if err != nil {
+			message := strings.TrimSpace(string(body))
+			if message == "" {
+				message = err.Error()
+			}
+			result.Failures = append(result.Failures, &ValidationError{
+				Kind:    "Etcd",
+				Name:    "apiserver",
+				Message: fmt.Sprintf("apiserver health check of etcd failed: %s", message),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// IsPodReady returns true if the Ready condition of the pod is true
+func IsPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	RegisterCheck("pod-disruption-budgets", NewCheck("every PodDisruptionBudget allows at least one disruption, so that nodes can be drained", runPodDisruptionBudgetsCheck))
+}
+
+func runPodDisruptionBudgetsCheck(ctx *CheckContext) (*CheckResult, error) {
+	pdbs, err := ctx.K8sClient.PolicyV1beta1().PodDisruptionBudgets("").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing PodDisruptionBudgets: %v", err)
+	}
+
+	result := &CheckResult{}
+	for i := range pdbs.Items {
+		pdb := &pdbs.Items[i]
+		if pdb.Status.ExpectedPods == 0 || pdb.Status.PodDisruptionsAllowed > 0 {
+			continue
+		}
+
+		result.Failures = append(result.Failures, &ValidationError{
+			Kind: "PodDisruptionBudget",
+			Name: pdb.Namespace + "/" + pdb.Name,
+			Message: fmt.Sprintf("PodDisruptionBudget %q allows no disruptions (%d of %d pods healthy, %d required); nodes running its pods cannot be drained",
+				pdb.Namespace+"/"+pdb.Name,
+				pdb.Status.CurrentHealthy,
+				pdb.Status.ExpectedPods,
+				pdb.Status.DesiredHealthy),
+		})
+	}
+	result.Message = fmt.Sprintf("%d PodDisruptionBudget(s) checked", len(pdbs.Items))
+	return result, nil
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kops/pkg/apis/kops"
+	apivalidation "k8s.io/kops/pkg/apis/kops/validation"
+	"k8s.io/kops/pkg/cloudinstances"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// CheckStatus is the outcome of running a check
+type CheckStatus string
+
+const (
+	// CheckStatusPassed means the check found no problems
+	CheckStatusPassed CheckStatus = "Passed"
+	// CheckStatusFailed means the check found problems, which are reported as failures
+	CheckStatusFailed CheckStatus = "Failed"
+	// CheckStatusSkipped means the check could not be run in this context, for example because the keystore is not available
+	CheckStatusSkipped CheckStatus = "Skipped"
+	// CheckStatusError means the check could not be completed
+	CheckStatusError CheckStatus = "Error"
+)
+
+// CheckResult is the structured result of a single check
+type CheckResult struct {
+	// Name is the name the check is registered under
+	Name string `json:"name"`
+	// Status is the outcome of the check
+	Status CheckStatus `json:"status"`
+	// Message is an optional human readable summary
+	Message string `json:"message,omitempty"`
+	// Details holds check-specific values, for example measured latencies
+	Details map[string]string `json:"details,omitempty"`
+	// Failures are the problems found by the check
+	Failures []*ValidationError `json:"failures,omitempty"`
+
+	// Nodes are the nodes found by the check; they are reported in the ValidationCluster
+	Nodes []*ValidationNode `json:"-"`
+}
+
+// Check is a single validation check that can be run against a cluster
+type Check interface {
+	// Description is a short explanation of what the check verifies
+	Description() string
+	// Run runs the check.  Problems with the cluster are returned as failures in the result;
+	// an error is returned only if the check could not be completed.
+	Run(ctx *CheckContext) (*CheckResult, error)
+}
+
+// NewCheck builds a Check from a function
+func NewCheck(description string, run func(ctx *CheckContext) (*CheckResult, error)) Check {
+	return &checkFunc{description: description, run: run}
+}
+
+type checkFunc struct {
+	description string
+	run         func(ctx *CheckContext) (*CheckResult, error)
+}
+
+// Description implements Check::Description
+func (c *checkFunc) Description() string {
+	return c.description
+}
+
+// Run implements Check::Run
+func (c *checkFunc) Run(ctx *CheckContext) (*CheckResult, error) {
+	return c.run(ctx)
+}
+
+var (
+	checksMutex sync.Mutex
+	checks      = make(map[string]Check)
+)
+
+// DefaultChecks are the checks that are run when validating a cluster, unless specific checks are selected
+var DefaultChecks = []string{"nodes", "components", "kube-system-pods"}
+
+// RegisterCheck registers a check under a name, so that it can be enabled in the cluster spec or selected with --checks
+func RegisterCheck(name string, check Check) {
+	checksMutex.Lock()
+	defer checksMutex.Unlock()
+
+	if checks[name] != nil {
+		panic(fmt.Sprintf("validation check %q registered twice", name))
+	}
+	checks[name] = check
+}
+
+// FindCheck returns the check registered under the name, or nil if there is none
+func FindCheck(name string) Check {
+	checksMutex.Lock()
+	defer checksMutex.Unlock()
+
+	return checks[name]
+}
+
+func init() {
+	// Let the cluster spec be validated against the registered checks, without an import cycle
+	apivalidation.ValidationChecks = ListChecks
+}
+
+// ListChecks returns the names of the registered checks, in sorted order
+func ListChecks() []string {
+	checksMutex.Lock()
+	defer checksMutex.Unlock()
+
+	var names []string
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckContext holds the cluster being validated, and the clients the checks use
+type CheckContext struct {
+	Cluster        *kops.Cluster
+	InstanceGroups []*kops.InstanceGroup
+	K8sClient      kubernetes.Interface
+	// KeyStore holds the cluster certificates, or is nil if it is not available
+	KeyStore fi.CAStore
+	// ConfigBase is the location of the cluster in the state store, or is nil if it is not available
+	ConfigBase vfs.Path
+
+	cloud       fi.Cloud
+	cloudGroups map[string]*cloudinstances.CloudInstanceGroup
+}
+
+// CloudGroups returns the cloud instance groups of the cluster, matched to their nodes
+func (c *CheckContext) CloudGroups() (map[string]*cloudinstances.CloudInstanceGroup, error) {
+	if c.cloudGroups != nil {
+		return c.cloudGroups, nil
+	}
+
+	if c.cloud == nil {
+		cloud, err := cloudup.BuildCloud(c.Cluster)
+		if err != nil {
+			return nil, err
+		}
+		c.cloud = cloud
+	}
+
+	nodeList, err := c.K8sClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing nodes: %v", err)
+	}
+
+	warnUnmatched := false
+	cloudGroups, err := c.cloud.GetCloudGroups(c.Cluster, c.InstanceGroups, warnUnmatched, nodeList.Items)
+	if err != nil {
+		return nil, err
+	}
+	c.cloudGroups = cloudGroups
+	return cloudGroups, nil
+}
+
+// ClusterValidator validates a cluster by running a set of checks against it
+type ClusterValidator struct {
+	Cluster           *kops.Cluster
+	InstanceGroupList *kops.InstanceGroupList
+	K8sClient         kubernetes.Interface
+
+	// Cloud is used to find the instances of the cluster; it is built from the cluster if not set
+	Cloud fi.Cloud
+	// KeyStore holds the cluster certificates; checks that need it are skipped if it is not set
+	KeyStore fi.CAStore
+	// ConfigBase is the location of the cluster in the state store; checks that need it are skipped if it is not set
+	ConfigBase vfs.Path
+
+	// Checks are the names of the checks to run.  If empty, the DefaultChecks and the checks enabled in the cluster spec are run.
+	Checks []string
+}
+
+// checkNames returns the names of the checks to run, verifying that they are all registered
+func (v *ClusterValidator) checkNames() ([]string, error) {
+	var names []string
+	if len(v.Checks) != 0 {
+		names = v.Checks
+	} else {
+		names = append(names, DefaultChecks...)
+		if v.Cluster.Spec.Validation != nil {
+			names = append(names, v.Cluster.Spec.Validation.Checks...)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if FindCheck(name) == nil {
+			return nil, fmt.Errorf("unknown validation check %q; the available checks are: %s", name, strings.Join(ListChecks(), ", "))
+		}
+		unique = append(unique, name)
+	}
+	return unique, nil
+}
+
+// Validate runs the checks, returning their results.
+// A check that cannot be completed is reported with the Error status and as a failure, rather than as an error.
+func (v *ClusterValidator) Validate() (*ValidationCluster, error) {
+	names, err := v.checkNames()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ValidationCluster{}
+	if failure, err := checkAPIDNS(v.Cluster.Name); err != nil {
+		return nil, err
+	} else if failure != nil {
+		result.addError(failure)
+		return result, nil
+	}
+
+	ctx := &CheckContext{
+		Cluster:    v.Cluster,
+		K8sClient:  v.K8sClient,
+		KeyStore:   v.KeyStore,
+		ConfigBase: v.ConfigBase,
+		cloud:      v.Cloud,
+	}
+	for i := range v.InstanceGroupList.Items {
+		ctx.InstanceGroups = append(ctx.InstanceGroups, &v.InstanceGroupList.Items[i])
+	}
+	if len(ctx.InstanceGroups) == 0 {
+		return nil, fmt.Errorf("no InstanceGroup objects found")
+	}
+
+	for _, name := range names {
+		result.runCheck(name, FindCheck(name), ctx)
+	}
+
+	return result, nil
+}
+
+func (v *ValidationCluster) runCheck(name string, check Check, ctx *CheckContext) {
+	r, err := check.Run(ctx)
+	if err != nil {
+		r = &CheckResult{
+			Status:  CheckStatusError,
+			Message: err.Error(),
+			Failures: []*ValidationError{
+				{
+					Kind:    "Check",
+					Name:    name,
+					Message: fmt.Sprintf("validation check %q could not be completed: %v", name, err),
+				},
+			},
+		}
+	}
+	if r == nil {
+		r = &CheckResult{}
+	}
+
+	r.Name = name
+	if r.Status == "" {
+		if len(r.Failures) != 0 {
+			r.Status = CheckStatusFailed
+		} else {
+			r.Status = CheckStatusPassed
+		}
+	}
+
+	v.Checks = append(v.Checks, r)
+	v.Failures = append(v.Failures, r.Failures...)
+	v.Nodes = append(v.Nodes, r.Nodes...)
+}
@@ -0,0 +1,374 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	kopsapi "k8s.io/kops/pkg/apis/kops"
+	apivalidation "k8s.io/kops/pkg/apis/kops/validation"
+	"k8s.io/kops/pkg/pki"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func testCheckCluster() (*kopsapi.Cluster, *kopsapi.InstanceGroupList) {
+	cluster := &kopsapi.Cluster{}
+	cluster.Name = "test.k8s.local"
+	cluster.Spec.KubernetesVersion = "1.9.3"
+
+	instanceGroups := &kopsapi.InstanceGroupList{
+		Items: []kopsapi.InstanceGroup{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "nodes"},
+				Spec:       kopsapi.InstanceGroupSpec{Role: kopsapi.InstanceGroupRoleNode},
+			},
+		},
+	}
+	return cluster, instanceGroups
+}
+
+func runTestCheck(t *testing.T, validator *ClusterValidator) *CheckResult {
+	result, err := validator.Validate()
+	if err != nil {
+		t.Fatalf("unexpected error validating cluster: %v", err)
+	}
+	if len(result.Checks) != 1 {
+		t.Fatalf("expected a single check result, got %v", result.Checks)
+	}
+	return result.Checks[0]
+}
+
+func failureNames(r *CheckResult) []string {
+	var names []string
+	for _, f := range r.Failures {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func Test_ClusterSpecChecksAreValidated(t *testing.T) {
+	if apivalidation.ValidationChecks == nil {
+		t.Fatalf("expected the registered checks to be used to validate the cluster spec")
+	}
+	if names := apivalidation.ValidationChecks(); !reflect.DeepEqual(names, ListChecks()) {
+		t.Errorf("expected the cluster spec to be validated against %v, got %v", ListChecks(), names)
+	}
+}
+
+func Test_CheckNames(t *testing.T) {
+	cluster, _ := testCheckCluster()
+
+	v := &ClusterValidator{Cluster: cluster}
+	names, err := v.checkNames()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(names, DefaultChecks) {
+		t.Errorf("expected default checks %v, got %v", DefaultChecks, names)
+	}
+
+	cluster.Spec.Validation = &kopsapi.ClusterValidationSpec{Checks: []string{"etcd", "nodes"}}
+	names, err = v.checkNames()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"nodes", "components", "kube-system-pods", "etcd"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected checks enabled in the cluster spec to be added to the defaults, got %v", names)
+	}
+
+	v.Checks = []string{"certificates"}
+	names, err = v.checkNames()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"certificates"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected selected checks to replace the defaults, got %v", names)
+	}
+
+	v.Checks = []string{"no-such-check"}
+	if _, err := v.checkNames(); err == nil || !strings.Contains(err.Error(), "no-such-check") {
+		t.Errorf("expected error for unknown check, got %v", err)
+	}
+}
+
+func Test_CheckErrorIsReported(t *testing.T) {
+	cluster, instanceGroups := testCheckCluster()
+
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "poddisruptionbudgets", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+
+	validator := &ClusterValidator{
+		Cluster:           cluster,
+		InstanceGroupList: instanceGroups,
+		K8sClient:         client,
+		Checks:            []string{"pod-disruption-budgets"},
+	}
+	r := runTestCheck(t, validator)
+	if r.Status != CheckStatusError || len(r.Failures) != 1 || r.Failures[0].Kind != "Check" {
+		t.Errorf("expected check error to be reported as a failure, got %+v", r)
+	}
+
+	// ValidateCluster runs the default checks, and the nodes check cannot build a cloud for this cluster
+	if _, err := ValidateCluster(cluster, instanceGroups, client); err == nil || !strings.Contains(err.Error(), `validation check "nodes"`) {
+		t.Errorf("expected ValidateCluster to return the check error, got %v", err)
+	}
+}
+
+func Test_EtcdCheck(t *testing.T) {
+	cluster, instanceGroups := testCheckCluster()
+	cluster.Spec.EtcdClusters = []*kopsapi.EtcdClusterSpec{
+		{Name: "main", Members: []*kopsapi.EtcdMemberSpec{{Name: "a"}, {Name: "b"}, {Name: "c"}}},
+		{Name: "events", Members: []*kopsapi.EtcdMemberSpec{{Name: "a"}, {Name: "b"}, {Name: "c"}}},
+	}
+
+	etcdPod := func(name string, app string, ready v1.ConditionStatus) runtime.Object {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "kube-system",
+				Labels:    map[string]string{"k8s-app": app},
+			},
+			Status: v1.PodStatus{
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: ready}},
+			},
+		}
+	}
+
+	client := fake.NewSimpleClientset(
+		etcdPod("etcd-server-a", "etcd-server", v1.ConditionTrue),
+		etcdPod("etcd-server-b", "etcd-server", v1.ConditionTrue),
+		etcdPod("etcd-server-c", "etcd-server", v1.ConditionFalse),
+		etcdPod("etcd-server-events-a", "etcd-server-events", v1.ConditionTrue),
+		etcdPod("etcd-server-events-b", "etcd-server-events", v1.ConditionTrue),
+		etcdPod("etcd-server-events-c", "etcd-server-events", v1.ConditionTrue),
+	)
+
+	r := runTestCheck(t, &ClusterValidator{
+		Cluster:           cluster,
+		InstanceGroupList: instanceGroups,
+		K8sClient:         client,
+		Checks:            []string{"etcd"},
+	})
+	if r.Status != CheckStatusFailed || !reflect.DeepEqual(failureNames(r), []string{"main"}) {
+		t.Errorf("expected the main etcd cluster to fail, got %+v", r)
+	}
+	if r.Details["main"] != "2/3" || r.Details["events"] != "3/3" {
+		t.Errorf("unexpected etcd member details: %v", r.Details)
+	}
+	if strings.Contains(r.Failures[0].Message, "quorum") {
+		t.Errorf("etcd cluster with 2 of 3 members should not have lost quorum: %q", r.Failures[0].Message)
+	}
+}
+
+func Test_PodDisruptionBudgetsCheck(t *testing.T) {
+	cluster, instanceGroups := testCheckCluster()
+
+	pdb := func(name string, expected, allowed int32) runtime.Object {
+		return &policy.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "db"},
+			Status: policy.PodDisruptionBudgetStatus{
+				ExpectedPods:          expected,
+				CurrentHealthy:        expected,
+				DesiredHealthy:        expected - allowed,
+				PodDisruptionsAllowed: allowed,
+			},
+		}
+	}
+
+	r := runTestCheck(t, &ClusterValidator{
+		Cluster:           cluster,
+		InstanceGroupList: instanceGroups,
+		K8sClient:         fake.NewSimpleClientset(pdb("cassandra", 3, 0), pdb("web", 3, 1), pdb("unused", 0, 0)),
+		Checks:            []string{"pod-disruption-budgets"},
+	})
+	if r.Status != CheckStatusFailed || !reflect.DeepEqual(failureNames(r), []string{"db/cassandra"}) {
+		t.Errorf("expected only the cassandra PodDisruptionBudget to fail, got %+v", r)
+	}
+}
+
+func Test_AddonsCheck(t *testing.T) {
+	cluster, instanceGroups := testCheckCluster()
+
+	configBase := vfs.NewMemFSPath(vfs.NewMemFSContext(), "memfs://tests/test.k8s.local")
+	channel := `
+kind: Addons
+metadata:
+  name: bootstrap
+spec:
+  addons:
+  - name: kube-dns.addons.k8s.io
+    version: 1.14.8
+    manifest: kube-dns.addons.k8s.io/k8s-1.6.yaml
+  - name: dns-controller.addons.k8s.io
+    version: 1.8.1
+    manifest: dns-controller.addons.k8s.io/k8s-1.6.yaml
+  - name: limit-range.addons.k8s.io
+    version: 1.5.0
+    manifest: limit-range.addons.k8s.io/v1.5.0.yaml
+`
+	if err := configBase.Join("addons", "bootstrap-channel.yaml").WriteFile(bytes.NewReader([]byte(channel)), nil); err != nil {
+		t.Fatalf("error writing channel: %v", err)
+	}
+
+	client := fake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "kube-system",
+			Annotations: map[string]string{
+				"addons.k8s.io/kube-dns.addons.k8s.io":       `{"version":"1.14.8","channel":"bootstrap"}`,
+				"addons.k8s.io/dns-controller.addons.k8s.io": `{"version":"1.8.0","channel":"bootstrap"}`,
+			},
+		},
+	})
+
+	validator := &ClusterValidator{
+		Cluster:           cluster,
+		InstanceGroupList: instanceGroups,
+		K8sClient:         client,
+		Checks:            []string{"addons"},
+	}
+	if r := runTestCheck(t, validator); r.Status != CheckStatusSkipped {
+		t.Errorf("expected addons check to be skipped without the state store, got %+v", r)
+	}
+
+	validator.ConfigBase = configBase
+	r := runTestCheck(t, validator)
+	if r.Status != CheckStatusFailed || !reflect.DeepEqual(failureNames(r), []string{"dns-controller.addons.k8s.io", "limit-range.addons.k8s.io"}) {
+		t.Fatalf("expected outdated and missing addons to fail, got %+v", r)
+	}
+	if !strings.Contains(r.Failures[0].Message, "1.8.0") || !strings.Contains(r.Failures[0].Message, "1.8.1") {
+		t.Errorf("expected failure to report both versions, got %q", r.Failures[0].Message)
+	}
+}
+
+func Test_CertificatesCheck(t *testing.T) {
+	cluster, instanceGroups := testCheckCluster()
+
+	keyStore := fi.NewVFSCAStore(cluster, vfs.NewMemFSPath(vfs.NewMemFSContext(), "memfs://tests/test.k8s.local/pki"), true)
+	storeCertificate := func(name string, notAfter time.Time) {
+		privateKey, err := pki.GeneratePrivateKey()
+		if err != nil {
+			t.Fatalf("error generating private key: %v", err)
+		}
+		template := &x509.Certificate{
+			Subject:   pkix.Name{CommonName: name},
+			NotBefore: notAfter.Add(-365 * 24 * time.Hour),
+			NotAfter:  notAfter,
+		}
+		cert, err := pki.SignNewCertificate(privateKey, template, nil, nil)
+		if err != nil {
+			t.Fatalf("error signing certificate: %v", err)
+		}
+		if err := keyStore.StoreKeypair(name, cert, privateKey); err != nil {
+			t.Fatalf("error storing keypair: %v", err)
+		}
+	}
+	storeCertificate("kubelet", time.Now().Add(-time.Hour))
+	storeCertificate("kube-proxy", time.Now().Add(24*time.Hour))
+	storeCertificate("kubecfg", time.Now().Add(365*24*time.Hour))
+
+	r := runTestCheck(t, &ClusterValidator{
+		Cluster:           cluster,
+		InstanceGroupList: instanceGroups,
+		K8sClient:         fake.NewSimpleClientset(),
+		KeyStore:          keyStore,
+		Checks:            []string{"certificates"},
+	})
+	if r.Status != CheckStatusFailed || !reflect.DeepEqual(failureNames(r), []string{"kubelet"}) {
+		t.Errorf("expected only the expired certificate to fail, got %+v", r)
+	}
+	if !strings.Contains(r.Message, "kube-proxy") || strings.Contains(r.Message, "kubecfg") {
+		t.Errorf("expected the certificate expiring soon to be reported, got %q", r.Message)
+	}
+	if len(r.Details) != 3 {
+		t.Errorf("expected the expiry of each certificate in the details, got %v", r.Details)
+	}
+}
+
+func Test_DNSCheck(t *testing.T) {
+	dnsCheckPollInterval = time.Millisecond
+
+	cluster, instanceGroups := testCheckCluster()
+
+	for _, phase := range []v1.PodPhase{v1.PodSucceeded, v1.PodFailed} {
+		client := fake.NewSimpleClientset()
+		var created *v1.Pod
+		client.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+			created = action.(core.CreateAction).GetObject().(*v1.Pod)
+			return false, nil, nil
+		})
+		client.PrependReactor("get", "pods", func(action core.Action) (bool, runtime.Object, error) {
+			pod := created.DeepCopy()
+			pod.Status.Phase = phase
+			return true, pod, nil
+		})
+
+		r := runTestCheck(t, &ClusterValidator{
+			Cluster:           cluster,
+			InstanceGroupList: instanceGroups,
+			K8sClient:         client,
+			Checks:            []string{"dns"},
+		})
+
+		if created == nil || !reflect.DeepEqual(created.Spec.Containers[0].Command, []string{"nslookup", "kubernetes.default.svc.cluster.local"}) {
+			t.Fatalf("expected a pod resolving the kubernetes service, got %v", created)
+		}
+		if phase == v1.PodSucceeded && r.Status != CheckStatusPassed {
+			t.Errorf("expected dns check to pass when the pod succeeds, got %+v", r)
+		}
+		if phase == v1.PodFailed && r.Status != CheckStatusFailed {
+			t.Errorf("expected dns check to fail when the pod fails, got %+v", r)
+		}
+
+		pods, err := client.CoreV1().Pods(dnsCheckNamespace).List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("error listing pods: %v", err)
+		}
+		if len(pods.Items) != 0 {
+			t.Errorf("expected dns check pod to be deleted, found %d pods", len(pods.Items))
+		}
+	}
+}
+
+func Test_APIServerLatencyCheck(t *testing.T) {
+	cluster, instanceGroups := testCheckCluster()
+
+	r := runTestCheck(t, &ClusterValidator{
+		Cluster:           cluster,
+		InstanceGroupList: instanceGroups,
+		K8sClient:         fake.NewSimpleClientset(),
+		Checks:            []string{"apiserver-latency"},
+	})
+	if r.Status != CheckStatusPassed || r.Details["median"] == "" || r.Details["max"] == "" {
+		t.Errorf("expected apiserver latency check to pass and report latencies, got %+v", r)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const metricsNamespace = "kops_validation"
+
+// checkStatuses are the values of the status label of the check status gauge
+var checkStatuses = []CheckStatus{CheckStatusPassed, CheckStatusFailed, CheckStatusSkipped, CheckStatusError}
+
+// Metrics records the results of repeated cluster validations, and exports them in the Prometheus text format
+type Metrics struct {
+	registry *prometheus.Registry
+
+	clusterValid   prometheus.Gauge
+	lastValidation prometheus.Gauge
+	runs           prometheus.Counter
+	errors         prometheus.Counter
+	checkStatus    *prometheus.GaugeVec
+	checkFailures  *prometheus.GaugeVec
+	checkFailed    *prometheus.CounterVec
+}
+
+var _ http.Handler = &Metrics{}
+
+// NewMetrics builds the metrics for validating the named cluster
+func NewMetrics(clusterName string) *Metrics {
+	labels := prometheus.Labels{"cluster": clusterName}
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		clusterValid: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "cluster_valid",
+			Help:        "Whether the last validation of the cluster found no failures (1) or not (0).",
+			ConstLabels: labels,
+		}),
+		lastValidation: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "last_run_timestamp_seconds",
+			Help:        "Time at which the cluster was last validated, in seconds since the epoch.",
+			ConstLabels: labels,
+		}),
+		runs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Name:        "runs_total",
+			Help:        "Number of times the cluster has been validated.",
+			ConstLabels: labels,
+		}),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Name:        "errors_total",
+			Help:        "Number of validations that could not be run at all.",
+			ConstLabels: labels,
+		}),
+		checkStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "check_status",
+			Help:        "Status of each check in the last validation; the gauge for the current status is 1, and the others are 0.",
+			ConstLabels: labels,
+		}, []string{"check", "status"}),
+		checkFailures: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "check_failures",
+			Help:        "Number of failures found by each check in the last validation.",
+			ConstLabels: labels,
+		}, []string{"check"}),
+		checkFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Name:        "check_failed_total",
+			Help:        "Number of validations in which each check failed or could not be completed.",
+			ConstLabels: labels,
+		}, []string{"check"}),
+	}
+
+	m.registry.MustRegister(m.clusterValid, m.lastValidation, m.runs, m.errors, m.checkStatus, m.checkFailures, m.checkFailed)
+	return m
+}
+
+// Record updates the metrics with the outcome of a validation
+func (m *Metrics) Record(result *ValidationCluster, err error) {
+	m.runs.Inc()
+	m.lastValidation.Set(float64(time.Now().Unix()))
+
+	if err != nil {
+		m.errors.Inc()
+		m.clusterValid.Set(0)
+		return
+	}
+
+	if len(result.Failures) == 0 {
+		m.clusterValid.Set(1)
+	} else {
+		m.clusterValid.Set(0)
+	}
+
+	for _, check := range result.Checks {
+		for _, status := range checkStatuses {
+			value := 0.0
+			if check.Status == status {
+				value = 1.0
+			}
+			m.checkStatus.WithLabelValues(check.Name, string(status)).Set(value)
+		}
+
+		m.checkFailures.WithLabelValues(check.Name).Set(float64(len(check.Failures)))
+
+		// Make sure the counter is exported for every check, even before it first fails
+		failed := m.checkFailed.WithLabelValues(check.Name)
+		if check.Status == CheckStatusFailed || check.Status == CheckStatusError {
+			failed.Inc()
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			glog.Warningf("error writing metrics: %v", err)
+			return
+		}
+	}
+}
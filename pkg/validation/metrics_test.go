@@ -0,0 +1,87 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrapeMetrics(t *testing.T, m *Metrics) string {
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != 200 {
+		t.Fatalf("unexpected response code %d: %s", w.Code, w.Body.String())
+	}
+	return w.Body.String()
+}
+
+func expectMetrics(t *testing.T, text string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("expected metric %q in:\n%s", line, text)
+		}
+	}
+}
+
+func Test_MetricsRecord(t *testing.T) {
+	m := NewMetrics("test.k8s.local")
+
+	failing := &ValidationCluster{
+		Checks: []*CheckResult{
+			{Name: "nodes", Status: CheckStatusPassed},
+			{
+				Name:     "etcd",
+				Status:   CheckStatusFailed,
+				Failures: []*ValidationError{{Kind: "Etcd", Name: "main"}, {Kind: "Etcd", Name: "events"}},
+			},
+		},
+	}
+	failing.Failures = failing.Checks[1].Failures
+	m.Record(failing, nil)
+
+	expectMetrics(t, scrapeMetrics(t, m),
+		`kops_validation_cluster_valid{cluster="test.k8s.local"} 0`,
+		`kops_validation_runs_total{cluster="test.k8s.local"} 1`,
+		`kops_validation_check_status{check="etcd",cluster="test.k8s.local",status="Failed"} 1`,
+		`kops_validation_check_status{check="etcd",cluster="test.k8s.local",status="Passed"} 0`,
+		`kops_validation_check_status{check="nodes",cluster="test.k8s.local",status="Passed"} 1`,
+		`kops_validation_check_failures{check="etcd",cluster="test.k8s.local"} 2`,
+		`kops_validation_check_failed_total{check="etcd",cluster="test.k8s.local"} 1`,
+		`kops_validation_check_failed_total{check="nodes",cluster="test.k8s.local"} 0`,
+	)
+
+	m.Record(nil, fmt.Errorf("connection refused"))
+	m.Record(&ValidationCluster{
+		Checks: []*CheckResult{
+			{Name: "nodes", Status: CheckStatusPassed},
+			{Name: "etcd", Status: CheckStatusPassed},
+		},
+	}, nil)
+
+	expectMetrics(t, scrapeMetrics(t, m),
+		`kops_validation_cluster_valid{cluster="test.k8s.local"} 1`,
+		`kops_validation_runs_total{cluster="test.k8s.local"} 3`,
+		`kops_validation_errors_total{cluster="test.k8s.local"} 1`,
+		`kops_validation_check_status{check="etcd",cluster="test.k8s.local",status="Failed"} 0`,
+		`kops_validation_check_status{check="etcd",cluster="test.k8s.local",status="Passed"} 1`,
+		`kops_validation_check_failures{check="etcd",cluster="test.k8s.local"} 0`,
+		`kops_validation_check_failed_total{check="etcd",cluster="test.k8s.local"} 1`,
+	)
+}
@@ -30,7 +30,6 @@ import (
 	"k8s.io/kops/pkg/apis/kops/util"
 	"k8s.io/kops/pkg/cloudinstances"
 	"k8s.io/kops/pkg/dns"
-	"k8s.io/kops/upup/pkg/fi/cloudup"
 )
 
 // ValidationCluster a cluster to validate.
@@ -38,6 +37,9 @@ type ValidationCluster struct {
 	Failures []*ValidationError `json:"failures,omitempty"`
 
 	Nodes []*ValidationNode `json:"nodes,omitempty"`
+
+	// Checks are the results of the individual checks that were run
+	Checks []*CheckResult `json:"checks,omitempty"`
 }
 
 // ValidationError holds a validation failure
@@ -86,74 +88,92 @@ func hasPlaceHolderIP(clusterName string) (bool, error) {
 	return false, nil
 }
 
-// ValidateCluster validate a k8s cluster with a provided instance group list
-func ValidateCluster(cluster *kops.Cluster, instanceGroupList *kops.InstanceGroupList, k8sClient kubernetes.Interface) (*ValidationCluster, error) {
-	clusterName := cluster.Name
-
-	v := &ValidationCluster{}
-
+// checkAPIDNS checks that dns-controller has replaced the placeholder address of the API DNS name, returning a failure if it has not.
+// Validation cannot proceed until it has, so no checks are run.
+func checkAPIDNS(clusterName string) (*ValidationError, error) {
 	// Do not use if we are running gossip
-	if !dns.IsGossipHostname(clusterName) {
-		contextName := clusterName
+	if dns.IsGossipHostname(clusterName) {
+		return nil, nil
+	}
 
-		hasPlaceHolderIPAddress, err := hasPlaceHolderIP(contextName)
-		if err != nil {
-			return nil, err
-		}
+	contextName := clusterName
 
-		if hasPlaceHolderIPAddress {
-			message := "Validation Failed\n\n" +
-				"The dns-controller Kubernetes deployment has not updated the Kubernetes cluster's API DNS entry to the correct IP address." +
-				"  The API DNS IP address is the placeholder address that kops creates: 203.0.113.123." +
-				"  Please wait about 5-10 minutes for a master to start, dns-controller to launch, and DNS to propagate." +
-				"  The protokube container and dns-controller deployment logs may contain more diagnostic information." +
-				"  Etcd and the API DNS entries must be updated for a kops Kubernetes cluster to start."
-			v.addError(&ValidationError{
-				Kind:    "dns",
-				Name:    "apiserver",
-				Message: message,
-			})
-			return v, nil
-		}
+	hasPlaceHolderIPAddress, err := hasPlaceHolderIP(contextName)
+	if err != nil {
+		return nil, err
 	}
 
-	var instanceGroups []*kops.InstanceGroup
-
-	for i := range instanceGroupList.Items {
-		ig := &instanceGroupList.Items[i]
-		instanceGroups = append(instanceGroups, ig)
+	if !hasPlaceHolderIPAddress {
+		return nil, nil
 	}
 
-	if len(instanceGroups) == 0 {
-		return nil, fmt.Errorf("no InstanceGroup objects found")
+	message := "Validation Failed\n\n" +
+		"The dns-controller Kubernetes deployment has not updated the Kubernetes cluster's API DNS entry to the correct IP address." +
+		"  The API DNS IP address is the placeholder address that kops creates: 203.0.113.123." +
+		"  Please wait about 5-10 minutes for a master to start, dns-controller to launch, and DNS to propagate." +
+		"  The protokube container and dns-controller deployment logs may contain more diagnostic information." +
+		"  Etcd and the API DNS entries must be updated for a kops Kubernetes cluster to start."
+	return &ValidationError{
+		Kind:    "dns",
+		Name:    "apiserver",
+		Message: message,
+	}, nil
+}
+
+func init() {
+	RegisterCheck("nodes", NewCheck("instance groups have enough instances, which have joined the cluster and are ready", runNodesCheck))
+	RegisterCheck("components", NewCheck("component statuses reported by the apiserver are healthy", runComponentsCheck))
+	RegisterCheck("kube-system-pods", NewCheck("pods in the kube-system namespace are ready", runKubeSystemPodsCheck))
+}
+
+// ValidateCluster validate a k8s cluster with a provided instance group list.
+// The default checks are run, along with any checks enabled in the cluster spec.
+func ValidateCluster(cluster *kops.Cluster, instanceGroupList *kops.InstanceGroupList, k8sClient kubernetes.Interface) (*ValidationCluster, error) {
+	validator := &ClusterValidator{
+		Cluster:           cluster,
+		InstanceGroupList: instanceGroupList,
+		K8sClient:         k8sClient,
 	}
 
-	cloud, err := cloudup.BuildCloud(cluster)
+	v, err := validator.Validate()
 	if err != nil {
 		return nil, err
 	}
 
-	nodeList, err := k8sClient.CoreV1().Nodes().List(metav1.ListOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("error listing nodes: %v", err)
+	for _, check := range v.Checks {
+		if check.Status == CheckStatusError {
+			return nil, fmt.Errorf("cannot run validation check %q for %q: %s", check.Name, cluster.Name, check.Message)
+		}
 	}
 
-	warnUnmatched := false
-	cloudGroups, err := cloud.GetCloudGroups(cluster, instanceGroups, warnUnmatched, nodeList.Items)
+	return v, nil
+}
+
+func runNodesCheck(ctx *CheckContext) (*CheckResult, error) {
+	cloudGroups, err := ctx.CloudGroups()
 	if err != nil {
 		return nil, err
 	}
+
+	v := &ValidationCluster{}
 	v.validateNodes(cloudGroups)
+	return &CheckResult{Failures: v.Failures, Nodes: v.Nodes}, nil
+}
 
-	if err := v.collectComponentFailures(k8sClient); err != nil {
-		return nil, fmt.Errorf("cannot get component status for %q: %v", clusterName, err)
+func runComponentsCheck(ctx *CheckContext) (*CheckResult, error) {
+	v := &ValidationCluster{}
+	if err := v.collectComponentFailures(ctx.K8sClient); err != nil {
+		return nil, err
 	}
+	return &CheckResult{Failures: v.Failures}, nil
+}
 
-	if err = v.collectPodFailures(k8sClient); err != nil {
-		return nil, fmt.Errorf("cannot get pod health for %q: %v", clusterName, err)
+func runKubeSystemPodsCheck(ctx *CheckContext) (*CheckResult, error) {
+	v := &ValidationCluster{}
+	if err := v.collectPodFailures(ctx.K8sClient); err != nil {
+		return nil, err
 	}
-
-	return v, nil
+	return &CheckResult{Failures: v.Failures}, nil
 }
 
 func (v *ValidationCluster) collectComponentFailures(client kubernetes.Interface) error {
@@ -248,7 +268,7 @@ func (v *ValidationCluster) validateNodes(cloudGroups map[string]*cloudinstances
 				Status:   getNodeReadyStatus(node),
 			}
 
-			ready := isNodeReady(node)
+			ready := IsNodeReady(node)
 
 			// TODO: Use instance group role instead...
 			if n.Role == "master" {
@@ -21,6 +21,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"path"
@@ -32,6 +33,7 @@ import (
 	gossipdns "k8s.io/kops/protokube/pkg/gossip/dns"
 	"k8s.io/kops/protokube/pkg/gossip/mesh"
 	"k8s.io/kops/protokube/pkg/protokube"
+	"k8s.io/kops/util/pkg/vfs"
 	// Load DNS plugins
 	"github.com/golang/glog"
 	"github.com/spf13/pflag"
@@ -63,6 +65,7 @@ func run() error {
 	var cloud, clusterID, dnsServer, dnsProviderID, dnsInternalSuffix, gossipSecret, gossipListen string
 	var flagChannels, tlsCert, tlsKey, tlsCA, peerCert, peerKey, peerCA string
 	var etcdBackupImage, etcdBackupStore, etcdImageSource, etcdElectionTimeout, etcdHeartbeatInterval string
+	var sealedState, sealKeyFile string
 
 	flag.BoolVar(&applyTaints, "apply-taints", applyTaints, "Apply taints to nodes based on the role")
 	flag.BoolVar(&containerized, "containerized", containerized, "Set if we are running containerized.")
@@ -77,6 +80,8 @@ func run() error {
 	flag.StringVar(&peerCA, "peer-ca", peerCA, "Path to a file containing the peer ca in PEM format")
 	flag.StringVar(&peerCert, "peer-cert", peerCert, "Path to a file containing the peer certificate")
 	flag.StringVar(&peerKey, "peer-key", peerKey, "Path to a file containing the private key for the peers")
+	flag.StringVar(&sealedState, "sealed-state", sealedState, "VFS path to the state that kops has sealed; channels read from it are verified before they are applied")
+	flag.StringVar(&sealKeyFile, "seal-key-file", sealKeyFile, "Path to a file containing the key that the sealed state is sealed with")
 	flag.BoolVar(&tlsAuth, "tls-auth", tlsAuth, "Indicates the peers and client should enforce authentication via CA")
 	flag.StringVar(&tlsCA, "tls-ca", tlsCA, "Path to a file containing the ca for client certificates")
 	flag.StringVar(&tlsCert, "tls-cert", tlsCert, "Path to a file containing the certificate for etcd server")
@@ -318,6 +323,25 @@ func run() error {
 		TLSKey:                tlsKey,
 	}
 
+	if sealedState != "" {
+		root, err := vfs.Context.BuildVfsPath(sealedState)
+		if err != nil {
+			return fmt.Errorf("error parsing sealed-state %q: %v", sealedState, err)
+		}
+		if sealKeyFile == "" {
+			return fmt.Errorf("seal-key-file is required with sealed-state")
+		}
+		sealKey, err := ioutil.ReadFile(sealKeyFile)
+		if err != nil {
+			return fmt.Errorf("error reading seal-key-file %q: %v", sealKeyFile, err)
+		}
+		keys, err := vfs.NewSealKeys(sealKey)
+		if err != nil {
+			return err
+		}
+		k.SealedState = &protokube.SealedState{Root: root, Keys: keys}
+	}
+
 	k.Init(volumes)
 
 	if dnsProvider != nil {
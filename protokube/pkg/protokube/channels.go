@@ -18,18 +18,51 @@ package protokube
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/golang/glog"
+	"k8s.io/kops/util/pkg/vfs"
 )
 
+// SealedState verifies the channels that are read from a state store that kops has sealed
+type SealedState struct {
+	// Root is the root of the sealed tree, the ConfigBase of the cluster
+	Root vfs.Path
+	// Keys are the keys that the tree is sealed with
+	Keys *vfs.SealKeys
+}
+
 // applyChannel is responsible for applying the channel manifests
-func applyChannel(channel string) error {
+func applyChannel(channel string, sealedState *SealedState) error {
 	// We don't embed the channels code because we expect this will eventually be part of kubectl
 	glog.Infof("checking channel: %q", channel)
 
+	if sealedState != nil {
+		tmpDir, err := ioutil.TempDir("", "channel")
+		if err != nil {
+			return fmt.Errorf("error creating temp dir: %v", err)
+		}
+		defer func() {
+			if err := os.RemoveAll(tmpDir); err != nil {
+				glog.Warningf("error deleting temp dir %q: %v", tmpDir, err)
+			}
+		}()
+
+		local, err := sealedState.copyChannel(channel, tmpDir)
+		if err != nil {
+			return err
+		}
+		if local != "" {
+			// channels applies the copy, so the manifests that are applied are the ones that were verified
+			channel = local
+		}
+	}
+
 	out, err := execChannels("apply", "channel", channel, "--v=4", "--yes")
 	glog.V(4).Infof("apply channel output was: %v", out)
 	return err
@@ -52,3 +85,43 @@ func execChannels(args ...string) (string, error) {
 
 	return string(output), err
 }
+
+// copyChannel verifies the channel and the manifests in its directory, and copies them to dir.
+// It returns the location of the copy of the channel, or "" if the channel is not in the sealed tree.
+func (s *SealedState) copyChannel(channel string, dir string) (string, error) {
+	p, err := vfs.Context.BuildVfsPath(channel)
+	if err != nil {
+		return "", fmt.Errorf("error parsing channel location %q: %v", channel, err)
+	}
+	relative, err := vfs.RelativePath(s.Root, p)
+	if err != nil {
+		glog.Infof("channel %q is not sealed, as it is not in %q", channel, s.Root)
+		return "", nil
+	}
+
+	channelDir := path.Dir(relative)
+	sealed := vfs.NewSealedPath(s.Root, s.Keys, false)
+	if channelDir != "." {
+		sealed = sealed.Join(channelDir).(*vfs.SealedPath)
+	}
+	files, err := sealed.ReadSealedTree()
+	if err != nil {
+		return "", fmt.Errorf("error verifying channel %q: %v", channel, err)
+	}
+	if _, found := files[path.Base(relative)]; !found {
+		return "", &vfs.IntegrityError{Path: p.Path(), Message: "the file has not been sealed"}
+	}
+
+	for name, data := range files {
+		localPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(localPath), 0700); err != nil {
+			return "", fmt.Errorf("error creating directory for %q: %v", localPath, err)
+		}
+		if err := ioutil.WriteFile(localPath, data, 0600); err != nil {
+			return "", fmt.Errorf("error writing %q: %v", localPath, err)
+		}
+	}
+	glog.V(2).Infof("verified channel %q and %d manifests", channel, len(files)-1)
+
+	return "file://" + filepath.Join(dir, path.Base(relative)), nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protokube
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestSealedStateCopyChannel(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+	root, err := vfs.Context.BuildVfsPath("memfs://state/cluster")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+	keys, err := vfs.NewSealKeys([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("error building keys: %v", err)
+	}
+	sealedState := &SealedState{Root: root, Keys: keys}
+
+	sealed := vfs.NewSealedPath(root, keys, false)
+	for name, data := range map[string]string{
+		"addons/bootstrap-channel.yaml":                    "channel",
+		"addons/dns-controller.addons.k8s.io/k8s-1.6.yaml": "manifest",
+	} {
+		if err := sealed.Join(name).WriteFile(bytes.NewReader([]byte(data)), nil); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	local, err := sealedState.copyChannel("memfs://state/cluster/addons/bootstrap-channel.yaml", dir)
+	if err != nil {
+		t.Fatalf("error copying channel: %v", err)
+	}
+	if expected := "file://" + filepath.Join(dir, "bootstrap-channel.yaml"); local != expected {
+		t.Errorf("expected channel to be copied to %q, was %q", expected, local)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "dns-controller.addons.k8s.io", "k8s-1.6.yaml")); err != nil || string(data) != "manifest" {
+		t.Errorf("unexpected copy of manifest: %q, %v", data, err)
+	}
+
+	// A channel outside the sealed state is applied as it is
+	if local, err := sealedState.copyChannel("memfs://state/other/addons/bootstrap-channel.yaml", dir); err != nil || local != "" {
+		t.Errorf("unexpected result copying channel outside the sealed state: %q, %v", local, err)
+	}
+
+	// A manifest changed without the keys is not copied
+	if err := root.Join("addons", "dns-controller.addons.k8s.io", "k8s-1.6.yaml").WriteFile(bytes.NewReader([]byte("tampered")), nil); err != nil {
+		t.Fatalf("error tampering with manifest: %v", err)
+	}
+	if _, err := sealedState.copyChannel("memfs://state/cluster/addons/bootstrap-channel.yaml", dir); err == nil || !strings.Contains(err.Error(), "integrity check") {
+		t.Errorf("expected integrity error copying tampered channel, got %v", err)
+	}
+
+	// A channel that was not sealed is not copied
+	if err := root.Join("addons", "other-channel.yaml").WriteFile(bytes.NewReader([]byte("channel")), nil); err != nil {
+		t.Fatalf("error writing unsealed channel: %v", err)
+	}
+	if _, err := sealedState.copyChannel("memfs://state/cluster/addons/other-channel.yaml", dir); err == nil || !strings.Contains(err.Error(), "integrity check") {
+		t.Errorf("expected integrity error copying unsealed channel, got %v", err)
+	}
+}
@@ -36,6 +36,8 @@ var (
 type KubeBoot struct {
 	// Channels is a list of channel to apply
 	Channels []string
+	// SealedState verifies the channels that are read from the sealed state store, if the state is sealed
+	SealedState *SealedState
 	// InitializeRBAC should be set to true if we should create the core RBAC roles
 	InitializeRBAC bool
 	// InternalDNSSuffix is the dns zone we are living in
@@ -146,7 +148,7 @@ func (k *KubeBoot) syncOnce() error {
 			}
 		}
 		for _, channel := range k.Channels {
-			if err := applyChannel(channel); err != nil {
+			if err := applyChannel(channel, k.SealedState); err != nil {
 				glog.Warningf("error applying channel %q: %v", channel, err)
 			}
 		}
@@ -32,6 +32,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/kops/pkg/apis/kops"
 	kopsinternalversion "k8s.io/kops/pkg/client/clientset_generated/clientset/typed/kops/internalversion"
+	"k8s.io/kops/pkg/envelope"
 	"k8s.io/kops/pkg/pki"
 	"k8s.io/kops/util/pkg/vfs"
 )
@@ -661,8 +662,14 @@ func (c *ClientsetCAStore) MirrorTo(basedir vfs.Path) error {
 		return err
 	}
 
+	// The mirror is read by nodeup, so it is encrypted if the cluster's keystore is encrypted
+	encrypter, err := envelope.StoreEncrypter(c.cluster.Spec.KeyStore)
+	if err != nil {
+		return err
+	}
+
 	for _, keyset := range keysets {
-		if err := mirrorKeyset(c.cluster, basedir, keyset); err != nil {
+		if err := mirrorKeyset(c.cluster, basedir, keyset, encrypter); err != nil {
 			return err
 		}
 	}
@@ -37,6 +37,12 @@ type Cloud interface {
 	// DeleteGroup deletes the cloud resources that make up a CloudInstanceGroup, including the instances
 	DeleteGroup(group *cloudinstances.CloudInstanceGroup) error
 
+	// ResizeGroup changes the number of instances the cloud maintains in a CloudInstanceGroup
+	ResizeGroup(group *cloudinstances.CloudInstanceGroup, targetSize int) error
+
+	// ScaleInInstance deletes a cloud instance and lowers the target size of its group by one, so that it is not replaced
+	ScaleInInstance(instance *cloudinstances.CloudInstanceGroupMember) error
+
 	// GetCloudGroups returns a map of cloud instances that back a kops cluster
 	GetCloudGroups(cluster *kops.Cluster, instancegroups []*kops.InstanceGroup, warnUnmatched bool, nodes []v1.Node) (map[string]*cloudinstances.CloudInstanceGroup, error)
 }
@@ -18,6 +18,7 @@ package cloudup
 
 import (
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
@@ -99,6 +100,9 @@ type ApplyClusterCmd struct {
 	// TargetName specifies how we are operating e.g. direct to GCE, or AWS, or dry-run, or terraform
 	TargetName string
 
+	// TerraformModule is true if the terraform targets should write a reusable module, with variables and outputs
+	TerraformModule bool
+
 	// Target is the fi.Target we will operate against
 	Target fi.Target
 
@@ -116,11 +120,20 @@ type ApplyClusterCmd struct {
 	// DryRun is true if this is only a dry run
 	DryRun bool
 
+	// DryRunOut is where the dry-run target prints the changes it would make; os.Stdout is used if not set
+	DryRunOut io.Writer
+
+	// AssetBuilder records the images and files used by the cluster; it is set by Run
+	AssetBuilder *assets.AssetBuilder
+
 	MaxTaskDuration time.Duration
 
 	// The channel we are using
 	channel *kops.Channel
 
+	// stateSealKey is the secret that the files nodeup reads from the state store are sealed with, if the cluster seals its state
+	stateSealKey string
+
 	// Phase can be set to a Phase to run the specific subset of tasks, if we don't want to run everything
 	Phase Phase
 
@@ -210,6 +223,9 @@ func (c *ApplyClusterCmd) Run() error {
 	// go dependency.
 	phase := string(c.Phase)
 	assetBuilder := assets.NewAssetBuilder(c.Cluster, phase)
+	// In the assets phase the images are copied to the registry mirror, so they can only be resolved to digests afterwards
+	assetBuilder.ResolveImageDigests = c.Phase != PhaseStageAssets
+	c.AssetBuilder = assetBuilder
 	err = c.upgradeSpecs(assetBuilder)
 	if err != nil {
 		return err
@@ -263,6 +279,17 @@ func (c *ApplyClusterCmd) Run() error {
 		return err
 	}
 
+	if cluster.Spec.SealedState != nil {
+		c.stateSealKey, err = findStateSealKey(secretStore, c.TargetName == TargetDryRun)
+		if err != nil {
+			return err
+		}
+	}
+	sealedConfigBase, completedConfigBase, err := buildSealedConfigBase(cluster, configBase, c.stateSealKey)
+	if err != nil {
+		return err
+	}
+
 	// Normalize k8s version
 	versionWithoutV := strings.TrimSpace(cluster.Spec.KubernetesVersion)
 	if strings.HasPrefix(versionWithoutV, "v") {
@@ -666,10 +693,15 @@ func (c *ApplyClusterCmd) Run() error {
 			return fmt.Errorf("direct configuration not supported with CloudProvider:%q", cluster.Spec.CloudProvider)
 		}
 
-	case TargetTerraform:
+	case TargetTerraform, TargetTerraformJSON:
 		checkExisting = false
 		outDir := c.OutDir
-		tf := terraform.NewTerraformTarget(cloud, region, project, outDir, cluster.Spec.Target)
+		var tf *terraform.TerraformTarget
+		if c.TargetName == TargetTerraformJSON {
+			tf = terraform.NewTerraformJSONTarget(cloud, region, project, outDir, cluster.Spec.Target)
+		} else {
+			tf = terraform.NewTerraformTarget(cloud, region, project, outDir, cluster.Spec.Target)
+		}
 
 		// We include a few "util" variables in the TF output
 		if err := tf.AddOutputVariable("region", terraform.LiteralFromStringValue(region)); err != nil {
@@ -686,6 +718,29 @@ func (c *ApplyClusterCmd) Run() error {
 			return err
 		}
 
+		if c.TerraformModule {
+			module := &terraform.ModuleOptions{
+				VPCID: cluster.Spec.NetworkID,
+			}
+			if cluster.Spec.NetworkID == "" {
+				module.VPCCIDR = cluster.Spec.NetworkCIDR
+			}
+			for _, subnet := range cluster.Spec.Subnets {
+				if subnet.ProviderID != "" {
+					if module.SubnetIDs == nil {
+						module.SubnetIDs = make(map[string]string)
+					}
+					module.SubnetIDs[subnet.Name] = subnet.ProviderID
+				} else if subnet.CIDR != "" {
+					if module.SubnetCIDRs == nil {
+						module.SubnetCIDRs = make(map[string]string)
+					}
+					module.SubnetCIDRs[subnet.Name] = subnet.CIDR
+				}
+			}
+			tf.Module = module
+		}
+
 		target = tf
 
 		// Can cause conflicts with terraform management
@@ -700,7 +755,11 @@ func (c *ApplyClusterCmd) Run() error {
 		shouldPrecreateDNS = false
 
 	case TargetDryRun:
-		target = fi.NewDryRunTarget(assetBuilder, os.Stdout)
+		out := c.DryRunOut
+		if out == nil {
+			out = os.Stdout
+		}
+		target = fi.NewDryRunTarget(assetBuilder, out)
 		dryRun = true
 
 		// Avoid making changes on a dry-run
@@ -712,7 +771,7 @@ func (c *ApplyClusterCmd) Run() error {
 	c.Target = target
 
 	if !dryRun {
-		err = registry.WriteConfigDeprecated(cluster, configBase.Join(registry.PathClusterCompleted), c.Cluster)
+		err = registry.WriteConfigDeprecated(cluster, completedConfigBase.Join(registry.PathClusterCompleted), c.Cluster)
 		if err != nil {
 			return fmt.Errorf("error writing completed cluster spec: %v", err)
 		}
@@ -730,10 +789,16 @@ func (c *ApplyClusterCmd) Run() error {
 			if err := vfsMirror.WriteMirror(g); err != nil {
 				return fmt.Errorf("error writing instance group spec to mirror: %v", err)
 			}
+
+			if c.stateSealKey != "" {
+				if err := sealInstanceGroup(cluster, configBase, sealedConfigBase, g); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
-	context, err := fi.NewContext(target, cluster, cloud, keyStore, secretStore, configBase, checkExisting, taskMap)
+	context, err := fi.NewContext(target, cluster, cloud, keyStore, secretStore, sealedConfigBase, checkExisting, taskMap)
 	if err != nil {
 		return fmt.Errorf("error building context: %v", err)
 	}
@@ -945,7 +1010,7 @@ func (c *ApplyClusterCmd) AddFileAssets(assetBuilder *assets.AssetBuilder) error
 		}
 		k.Path = path.Join(k.Path, a)
 
-		u, hash, err := assetBuilder.RemapFileAndSHA(k)
+		u, hash, err := assetBuilder.RemapFileAndSHA(strings.TrimSuffix(path.Base(a), ".tar.gz"), k)
 		if err != nil {
 			return err
 		}
@@ -1084,7 +1149,7 @@ func (c *ApplyClusterCmd) BuildNodeUpConfig(assetBuilder *assets.AssetBuilder, i
 
 			baseURL.Path = path.Join(baseURL.Path, "/bin/linux/amd64/", component+".tar")
 
-			u, hash, err := assetBuilder.RemapFileAndSHA(baseURL)
+			u, hash, err := assetBuilder.RemapFileAndSHA(component, baseURL)
 			if err != nil {
 				return nil, err
 			}
@@ -1112,6 +1177,9 @@ func (c *ApplyClusterCmd) BuildNodeUpConfig(assetBuilder *assets.AssetBuilder, i
 
 	config.Images = images
 	config.Channels = channels
+	if cluster.Spec.SealedState != nil {
+		config.SealedStateSecretStore = cluster.Spec.SecretStore
+	}
 
 	return config, nil
 }
@@ -347,12 +347,50 @@ func deleteGroup(c AWSCloud, g *cloudinstances.CloudInstanceGroup) error {
 	return nil
 }
 
+// ResizeGroup sets the desired capacity of an aws autoscaling group, raising the max size if required
+func (c *awsCloudImplementation) ResizeGroup(g *cloudinstances.CloudInstanceGroup, targetSize int) error {
+	return resizeGroup(c, g, targetSize)
+}
+
+func resizeGroup(c AWSCloud, g *cloudinstances.CloudInstanceGroup, targetSize int) error {
+	asg := g.Raw.(*autoscaling.Group)
+
+	name := aws.StringValue(asg.AutoScalingGroupName)
+
+	// We never lower the max size below the value the group had when we found it
+	maxSize := g.MaxSize
+	if targetSize > maxSize {
+		maxSize = targetSize
+	}
+
+	glog.V(2).Infof("Resizing autoscaling group %q to %d instances", name, targetSize)
+	request := &autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(name),
+		DesiredCapacity:      aws.Int64(int64(targetSize)),
+		MaxSize:              aws.Int64(int64(maxSize)),
+	}
+	if _, err := c.Autoscaling().UpdateAutoScalingGroup(request); err != nil {
+		return fmt.Errorf("error resizing autoscaling group %q: %v", name, err)
+	}
+
+	return nil
+}
+
 // DeleteInstance deletes an aws instance
 func (c *awsCloudImplementation) DeleteInstance(i *cloudinstances.CloudInstanceGroupMember) error {
 	return deleteInstance(c, i)
 }
 
+// ScaleInInstance deletes an aws instance, decrementing the desired capacity of its autoscaling group
+func (c *awsCloudImplementation) ScaleInInstance(i *cloudinstances.CloudInstanceGroupMember) error {
+	return terminateInstance(c, i, true)
+}
+
 func deleteInstance(c AWSCloud, i *cloudinstances.CloudInstanceGroupMember) error {
+	return terminateInstance(c, i, false)
+}
+
+func terminateInstance(c AWSCloud, i *cloudinstances.CloudInstanceGroupMember, decrementDesiredCapacity bool) error {
 	id := i.ID
 	if id == "" {
 		return fmt.Errorf("id was not set on CloudInstanceGroupMember: %v", i)
@@ -360,7 +398,7 @@ func deleteInstance(c AWSCloud, i *cloudinstances.CloudInstanceGroupMember) erro
 
 	request := &autoscaling.TerminateInstanceInAutoScalingGroupInput{
 		InstanceId:                     aws.String(id),
-		ShouldDecrementDesiredCapacity: aws.Bool(false),
+		ShouldDecrementDesiredCapacity: aws.Bool(decrementDesiredCapacity),
 	}
 
 	if _, err := c.Autoscaling().TerminateInstanceInAutoScalingGroup(request); err != nil {
@@ -504,6 +542,7 @@ func awsBuildCloudInstanceGroup(c AWSCloud, ig *kops.InstanceGroup, g *autoscali
 		InstanceGroup: ig,
 		MinSize:       int(aws.Int64Value(g.MinSize)),
 		MaxSize:       int(aws.Int64Value(g.MaxSize)),
+		TargetSize:    int(aws.Int64Value(g.DesiredCapacity)),
 		Raw:           g,
 	}
 
@@ -82,10 +82,18 @@ func (c *MockAWSCloud) DeleteGroup(g *cloudinstances.CloudInstanceGroup) error {
 	return deleteGroup(c, g)
 }
 
+func (c *MockAWSCloud) ResizeGroup(g *cloudinstances.CloudInstanceGroup, targetSize int) error {
+	return resizeGroup(c, g, targetSize)
+}
+
 func (c *MockAWSCloud) DeleteInstance(i *cloudinstances.CloudInstanceGroupMember) error {
 	return deleteInstance(c, i)
 }
 
+func (c *MockAWSCloud) ScaleInInstance(i *cloudinstances.CloudInstanceGroupMember) error {
+	return terminateInstance(c, i, true)
+}
+
 func (c *MockAWSCloud) GetCloudGroups(cluster *kops.Cluster, instancegroups []*kops.InstanceGroup, warnUnmatched bool, nodes []v1.Node) (map[string]*cloudinstances.CloudInstanceGroup, error) {
 	return getCloudGroups(c, cluster, instancegroups, warnUnmatched, nodes)
 }
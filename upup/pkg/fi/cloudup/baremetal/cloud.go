@@ -64,6 +64,20 @@ func (c *Cloud) DeleteGroup(g *cloudinstances.CloudInstanceGroup) error {
 	return fmt.Errorf("baremetal cloud provider does not support deleting cloud groups at this time")
 }
 
+// ResizeGroup is not implemented yet, is a func that needs to resize a baremetal instance group.
+// Baremetal may not support this.
+func (c *Cloud) ResizeGroup(g *cloudinstances.CloudInstanceGroup, targetSize int) error {
+	glog.V(8).Infof("baremetal cloud provider ResizeGroup not implemented yet")
+	return fmt.Errorf("baremetal cloud provider does not support resizing cloud groups at this time")
+}
+
+// ScaleInInstance is not implemented yet, is a func that needs to delete a baremetal instance and shrink its group.
+// Baremetal may not support this.
+func (c *Cloud) ScaleInInstance(instance *cloudinstances.CloudInstanceGroupMember) error {
+	glog.V(8).Infof("baremetal cloud provider ScaleInInstance not implemented yet")
+	return fmt.Errorf("baremetal cloud provider does not support scaling in cloud groups at this time")
+}
+
 //DeleteInstance is not implemented yet, is func needs to delete a DO instance.
 //Baremetal may not support this.
 func (c *Cloud) DeleteInstance(instance *cloudinstances.CloudInstanceGroupMember) error {
@@ -166,7 +166,7 @@ func findCNIAssets(c *api.Cluster, assetBuilder *assets.AssetBuilder) (*url.URL,
 		return nil, "", nil
 	}
 
-	u, err = assetBuilder.RemapFileAndSHAValue(u, cniAssetHash)
+	u, err = assetBuilder.RemapFileAndSHAValue("cni", u, cniAssetHash)
 	if err != nil {
 		return nil, "", err
 	}
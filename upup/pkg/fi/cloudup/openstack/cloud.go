@@ -149,6 +149,14 @@ func (c *openstackCloud) DeleteGroup(g *cloudinstances.CloudInstanceGroup) error
 	return fmt.Errorf("openstackCloud::DeleteGroup not implemented")
 }
 
+func (c *openstackCloud) ResizeGroup(g *cloudinstances.CloudInstanceGroup, targetSize int) error {
+	return fmt.Errorf("openstackCloud::ResizeGroup not implemented")
+}
+
+func (c *openstackCloud) ScaleInInstance(i *cloudinstances.CloudInstanceGroupMember) error {
+	return fmt.Errorf("openstackCloud::ScaleInInstance not implemented")
+}
+
 func (c *openstackCloud) GetCloudGroups(cluster *kops.Cluster, instancegroups []*kops.InstanceGroup, warnUnmatched bool, nodes []v1.Node) (map[string]*cloudinstances.CloudInstanceGroup, error) {
 	return nil, fmt.Errorf("openstackCloud::GetCloudGroups not implemented")
 }
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudup
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/acls"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// findStateSealKey returns the secret that the files nodeup reads from the state store are sealed with, creating it if needed.
+// On a dry run the secret is not created, and "" is returned if it does not exist yet.
+func findStateSealKey(secretStore fi.SecretStore, dryRun bool) (string, error) {
+	if dryRun {
+		secret, err := secretStore.FindSecret(registry.SecretStateSeal)
+		if err != nil {
+			return "", fmt.Errorf("error reading secret %q: %v", registry.SecretStateSeal, err)
+		}
+		if secret == nil {
+			glog.Infof("Secret %q will be created to seal the state", registry.SecretStateSeal)
+			return "", nil
+		}
+		return string(secret.Data), nil
+	}
+
+	secret, err := fi.CreateSecret()
+	if err != nil {
+		return "", err
+	}
+	current, _, err := secretStore.GetOrCreateSecret(registry.SecretStateSeal, secret)
+	if err != nil {
+		return "", fmt.Errorf("error creating secret %q: %v", registry.SecretStateSeal, err)
+	}
+	return string(current.Data), nil
+}
+
+// buildSealedConfigBase returns the paths under the ConfigBase through which the files nodeup reads are signed,
+// and through which the completed cluster spec is written, which also encrypts it if configured.
+// If sealKey is empty, the state is not sealed and configBase is returned for both.
+func buildSealedConfigBase(cluster *kops.Cluster, configBase vfs.Path, sealKey string) (vfs.Path, vfs.Path, error) {
+	if sealKey == "" {
+		return configBase, configBase, nil
+	}
+
+	keys, err := vfs.NewSealKeys([]byte(sealKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypt := cluster.Spec.SealedState != nil && fi.BoolValue(cluster.Spec.SealedState.Encrypt)
+	return vfs.NewSealedPath(configBase, keys, false), vfs.NewSealedPath(configBase, keys, encrypt), nil
+}
+
+// WriteCompletedCluster writes the completed cluster spec to the ConfigBase, sealing it as ApplyClusterCmd does if the cluster seals its state,
+// so that the manifest still matches it.  The secret that the state is sealed with is created if needed.
+func WriteCompletedCluster(cluster *kops.Cluster, configBase vfs.Path, secretStore fi.SecretStore, fullCluster *kops.Cluster) error {
+	sealKey := ""
+	if cluster.Spec.SealedState != nil {
+		var err error
+		sealKey, err = findStateSealKey(secretStore, false)
+		if err != nil {
+			return err
+		}
+	}
+	_, completedConfigBase, err := buildSealedConfigBase(cluster, configBase, sealKey)
+	if err != nil {
+		return err
+	}
+	return registry.WriteConfigDeprecated(cluster, completedConfigBase.Join(registry.PathClusterCompleted), fullCluster)
+}
+
+// ReadCompletedCluster reads the completed cluster spec from the ConfigBase, verifying and decrypting it if the cluster seals its state.
+// If the secret that the state is sealed with does not exist yet, the state has not been sealed and the cluster spec is read as it is.
+func ReadCompletedCluster(cluster *kops.Cluster, configBase vfs.Path, secretStore fi.SecretStore) (*kops.Cluster, error) {
+	sealKey := ""
+	if cluster.Spec.SealedState != nil {
+		secret, err := secretStore.FindSecret(registry.SecretStateSeal)
+		if err != nil {
+			return nil, fmt.Errorf("error reading secret %q: %v", registry.SecretStateSeal, err)
+		}
+		if secret != nil {
+			sealKey = string(secret.Data)
+		}
+	}
+	_, completedConfigBase, err := buildSealedConfigBase(cluster, configBase, sealKey)
+	if err != nil {
+		return nil, err
+	}
+
+	fullCluster := &kops.Cluster{}
+	if err := registry.ReadConfigDeprecated(completedConfigBase.Join(registry.PathClusterCompleted), fullCluster); err != nil {
+		return nil, err
+	}
+	return fullCluster, nil
+}
+
+// sealInstanceGroup signs the instance group as written to the ConfigBase, so that nodeup can verify it.
+// The instance group is not encrypted, as kops reads it from the same location.
+func sealInstanceGroup(cluster *kops.Cluster, configBase vfs.Path, sealedConfigBase vfs.Path, ig *kops.InstanceGroup) error {
+	src := configBase.Join("instancegroup", ig.ObjectMeta.Name)
+	data, err := src.ReadFile()
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", src, err)
+	}
+
+	dest := sealedConfigBase.Join("instancegroup", ig.ObjectMeta.Name)
+	acl, err := acls.GetACL(dest, cluster)
+	if err != nil {
+		return err
+	}
+	if err := dest.WriteFile(bytes.NewReader(data), acl); err != nil {
+		return fmt.Errorf("error sealing %s: %v", dest, err)
+	}
+	return nil
+}
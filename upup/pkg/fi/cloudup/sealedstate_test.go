@@ -0,0 +1,136 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudup
+
+import (
+	"bytes"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/secrets"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestSealedState(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	cluster := &kops.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+		Spec: kops.ClusterSpec{
+			SealedState: &kops.SealedStateSpec{Encrypt: fi.Bool(true)},
+		},
+	}
+	configBase, _ := vfs.Context.BuildVfsPath("memfs://state/cluster.example.com")
+	secretsPath, _ := vfs.Context.BuildVfsPath("memfs://state/cluster.example.com/secrets")
+	secretStore := secrets.NewVFSSecretStore(cluster, secretsPath)
+
+	// A dry run does not create the key
+	key, err := findStateSealKey(secretStore, true)
+	if err != nil || key != "" {
+		t.Fatalf("unexpected result finding key on dry run: %q, %v", key, err)
+	}
+
+	key, err = findStateSealKey(secretStore, false)
+	if err != nil || key == "" {
+		t.Fatalf("unexpected result creating key: %q, %v", key, err)
+	}
+	if again, err := findStateSealKey(secretStore, true); err != nil || again != key {
+		t.Errorf("expected existing key %q, got %q, %v", key, again, err)
+	}
+
+	sealedConfigBase, completedConfigBase, err := buildSealedConfigBase(cluster, configBase, key)
+	if err != nil {
+		t.Fatalf("error building sealed config base: %v", err)
+	}
+
+	if err := completedConfigBase.Join("cluster.spec").WriteFile(bytes.NewReader([]byte("spec")), nil); err != nil {
+		t.Fatalf("error writing completed cluster spec: %v", err)
+	}
+	if stored, _ := configBase.Join("cluster.spec").ReadFile(); bytes.Equal(stored, []byte("spec")) {
+		t.Errorf("completed cluster spec was not encrypted")
+	}
+
+	ig := &kops.InstanceGroup{ObjectMeta: metav1.ObjectMeta{Name: "nodes"}}
+	if err := configBase.Join("instancegroup", "nodes").WriteFile(bytes.NewReader([]byte("ig")), nil); err != nil {
+		t.Fatalf("error writing instance group: %v", err)
+	}
+	if err := sealInstanceGroup(cluster, configBase, sealedConfigBase, ig); err != nil {
+		t.Fatalf("error sealing instance group: %v", err)
+	}
+	if stored, _ := configBase.Join("instancegroup", "nodes").ReadFile(); string(stored) != "ig" {
+		t.Errorf("instance group was not stored as plaintext: %q", stored)
+	}
+
+	// nodeup reads both files through a signed path built from the key
+	keys, _ := vfs.NewSealKeys([]byte(key))
+	nodeup := vfs.NewSealedPath(configBase, keys, false)
+	for k, v := range map[string]string{"cluster.spec": "spec", "instancegroup/nodes": "ig"} {
+		if data, err := nodeup.Join(k).ReadFile(); err != nil || string(data) != v {
+			t.Errorf("unexpected result reading %s: %q, %v", k, data, err)
+		}
+	}
+
+	// Without a key, the state is not sealed
+	unsealed, _, err := buildSealedConfigBase(cluster, configBase, "")
+	if err != nil || unsealed != configBase {
+		t.Errorf("expected the config base when the state is not sealed, got %v, %v", unsealed, err)
+	}
+}
+
+func TestCompletedClusterSealedState(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	cluster := &kops.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster.example.com"},
+		Spec: kops.ClusterSpec{
+			SealedState:        &kops.SealedStateSpec{Encrypt: fi.Bool(true)},
+			MasterInternalName: "api.internal.cluster.example.com",
+		},
+	}
+	configBase, _ := vfs.Context.BuildVfsPath("memfs://state/cluster.example.com")
+	secretsPath, _ := vfs.Context.BuildVfsPath("memfs://state/cluster.example.com/secrets")
+	secretStore := secrets.NewVFSSecretStore(cluster, secretsPath)
+
+	// Before the key is created, the completed cluster spec has not been sealed
+	if err := configBase.Join("cluster.spec").WriteFile(bytes.NewReader([]byte("metadata:\n  name: unsealed\n")), nil); err != nil {
+		t.Fatalf("error writing completed cluster spec: %v", err)
+	}
+	if full, err := ReadCompletedCluster(cluster, configBase, secretStore); err != nil || full.ObjectMeta.Name != "unsealed" {
+		t.Fatalf("unexpected result reading unsealed cluster spec: %v, %v", full, err)
+	}
+
+	if err := WriteCompletedCluster(cluster, configBase, secretStore, cluster); err != nil {
+		t.Fatalf("error writing completed cluster spec: %v", err)
+	}
+	if secret, err := secretStore.FindSecret(registry.SecretStateSeal); err != nil || secret == nil {
+		t.Fatalf("expected the key to be created, got %v, %v", secret, err)
+	}
+	if stored, _ := configBase.Join("cluster.spec").ReadFile(); bytes.Contains(stored, []byte(cluster.Spec.MasterInternalName)) {
+		t.Errorf("completed cluster spec was not encrypted")
+	}
+
+	full, err := ReadCompletedCluster(cluster, configBase, secretStore)
+	if err != nil {
+		t.Fatalf("error reading completed cluster spec: %v", err)
+	}
+	if full.Spec.MasterInternalName != cluster.Spec.MasterInternalName {
+		t.Errorf("unexpected completed cluster spec: %v", full.Spec)
+	}
+}
@@ -19,4 +19,5 @@ package cloudup
 const TargetDirect = "direct"
 const TargetDryRun = "dryrun"
 const TargetTerraform = "terraform"
+const TargetTerraformJSON = "terraform-json"
 const TargetCloudformation = "cloudformation"
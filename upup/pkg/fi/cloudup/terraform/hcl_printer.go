@@ -88,7 +88,32 @@ func (v *astSanitizer) visitObjectItem(o *ast.ObjectItem) {
 	v.visit(o.Val)
 }
 
-func hclPrint(node ast.Node) ([]byte, error) {
+// unescapeInterpolations removes the escaping of quotes within ${...} interpolations
+func unescapeInterpolations(s string) string {
+	var b bytes.Buffer
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			b.WriteString("${")
+			i++
+		case depth > 0 && s[i] == '}':
+			depth--
+			b.WriteByte('}')
+		case depth > 0 && strings.HasPrefix(s[i:], "\\\""):
+			b.WriteByte('"')
+			i++
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// hclPrint writes the HCL for the node.  Modules use functions whose arguments are quoted strings within
+// interpolations, so module output has the escaping of those quotes removed.
+func hclPrint(node ast.Node, module bool) ([]byte, error) {
 	var sanitizer astSanitizer
 	sanitizer.visit(node)
 
@@ -110,6 +135,11 @@ func hclPrint(node ast.Node) ([]byte, error) {
 	s = strings.Replace(s, "(\\\"", "(\"", -1)
 	s = strings.Replace(s, "\\\")", "\")", -1)
 
+	// ... and the functions used by modules
+	if module {
+		s = unescapeInterpolations(s)
+	}
+
 	// We don't need to escape > or <
 	s = strings.Replace(s, "\\u003c", "<", -1)
 	s = strings.Replace(s, "\\u003e", ">", -1)
@@ -0,0 +1,274 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ModuleOptions configures the output of a reusable Terraform module, rather than a standalone configuration.
+// Values that differ between uses of the module become variables, with the values from the cluster spec as defaults,
+// and the main resources are exported as outputs.
+type ModuleOptions struct {
+	// VPCID is the ID of a shared VPC; references to it are replaced by the vpc_id variable
+	VPCID string
+	// SubnetIDs maps the names of shared subnets to their IDs; references to them are replaced by lookups in the subnet_ids variable
+	SubnetIDs map[string]string
+
+	// VPCCIDR is the CIDR of the VPC that kops creates; it is replaced by the vpc_cidr variable
+	VPCCIDR string
+	// SubnetCIDRs maps the names of the subnets that kops creates to their CIDRs; they are replaced by lookups in the subnet_cidrs variable
+	SubnetCIDRs map[string]string
+}
+
+// moduleInstanceFields are the fields of launch configurations that become map variables, keyed by the launch configuration name
+var moduleInstanceFields = []struct {
+	ResourceType string
+	Field        string
+	Variable     string
+	Description  string
+}{
+	{"aws_launch_configuration", "image_id", "amis", "AMI for each launch configuration, by name"},
+	{"aws_launch_configuration", "instance_type", "instance_types", "Instance type for each launch configuration, by name"},
+}
+
+// moduleAutoscalingGroupTags is the name of the data source that converts the tags variable for autoscaling groups
+const moduleAutoscalingGroupTags = "autoscaling_group_tags"
+
+// moduleOutputs are the map outputs of a module, keyed by the terraform name of the resource
+var moduleOutputs = []struct {
+	ResourceType string
+	Property     string
+	Output       string
+}{
+	{"aws_autoscaling_group", "name", "autoscaling_group_names"},
+	{"aws_elb", "dns_name", "elb_dns_names"},
+	{"aws_iam_role", "arn", "iam_role_arns"},
+	{"aws_iam_role", "name", "iam_role_names"},
+	{"aws_security_group", "id", "security_group_ids"},
+}
+
+// buildModule converts the terraform configuration into a module: it adds the variables and outputs,
+// and removes the provider configuration, which should be inherited from the configuration that uses the module
+func (o *ModuleOptions) buildModule(data map[string]interface{}) (map[string]interface{}, error) {
+	module, err := toGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	delete(module, "provider")
+
+	variables := make(map[string]interface{})
+	outputs, _ := module["output"].(map[string]interface{})
+	if outputs == nil {
+		outputs = make(map[string]interface{})
+	}
+	resources, _ := module["resource"].(map[string]interface{})
+
+	// The shared network is replaced wherever it is referenced, including in the existing outputs
+	replacements := make(map[string]string)
+	if o.VPCID != "" {
+		variables["vpc_id"] = map[string]interface{}{
+			"description": "ID of the shared VPC",
+			"default":     o.VPCID,
+		}
+		replacements[o.VPCID] = "${var.vpc_id}"
+	}
+	if len(o.SubnetIDs) != 0 {
+		variables["subnet_ids"] = map[string]interface{}{
+			"description": "IDs of the shared subnets, by subnet name",
+			"type":        "map",
+			"default":     map[string]interface{}{},
+		}
+		for name, id := range o.SubnetIDs {
+			replacements[id] = fmt.Sprintf("${lookup(var.subnet_ids, %q, %q)}", name, id)
+		}
+	}
+	if o.VPCCIDR != "" {
+		variables["vpc_cidr"] = map[string]interface{}{
+			"description": "CIDR of the VPC",
+			"default":     o.VPCCIDR,
+		}
+		replacements[o.VPCCIDR] = "${var.vpc_cidr}"
+	}
+	if len(o.SubnetCIDRs) != 0 {
+		variables["subnet_cidrs"] = map[string]interface{}{
+			"description": "CIDRs of the subnets, by subnet name",
+			"type":        "map",
+			"default":     map[string]interface{}{},
+		}
+		for name, cidr := range o.SubnetCIDRs {
+			replacements[cidr] = fmt.Sprintf("${lookup(var.subnet_cidrs, %q, %q)}", name, cidr)
+		}
+	}
+	replaceStrings(resources, replacements)
+	replaceStrings(outputs, replacements)
+
+	for _, f := range moduleInstanceFields {
+		items, _ := resources[f.ResourceType].(map[string]interface{})
+		for _, name := range sortedKeys(items) {
+			item, _ := items[name].(map[string]interface{})
+			value, ok := item[f.Field].(string)
+			if !ok {
+				continue
+			}
+			variables[f.Variable] = map[string]interface{}{
+				"description": f.Description,
+				"type":        "map",
+				"default":     map[string]interface{}{},
+			}
+			item[f.Field] = fmt.Sprintf("${lookup(var.%s, %q, %q)}", f.Variable, name, value)
+		}
+	}
+
+	// Tags are merged with the tags variable, for the resources that take a map of tags
+	hasTags := false
+	for _, resourceType := range sortedKeys(resources) {
+		items, _ := resources[resourceType].(map[string]interface{})
+		for _, name := range sortedKeys(items) {
+			item, _ := items[name].(map[string]interface{})
+			tags, ok := item["tags"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var args []string
+			for _, k := range sortedKeys(tags) {
+				args = append(args, fmt.Sprintf("%q", k), fmt.Sprintf("%q", fmt.Sprint(tags[k])))
+			}
+			item["tags"] = fmt.Sprintf("${merge(map(%s), var.tags)}", strings.Join(args, ", "))
+			hasTags = true
+		}
+	}
+	// Autoscaling groups take a list of tags, so the tags variable is converted with a data source; the tags are added
+	// to the tag blocks of the group, and propagated to its instances
+	if groups, _ := resources["aws_autoscaling_group"].(map[string]interface{}); len(groups) != 0 {
+		for _, name := range sortedKeys(groups) {
+			item, _ := groups[name].(map[string]interface{})
+			if item == nil {
+				continue
+			}
+			item["tags"] = []interface{}{"${data.null_data_source." + moduleAutoscalingGroupTags + ".*.outputs}"}
+		}
+
+		data, _ := module["data"].(map[string]interface{})
+		if data == nil {
+			data = make(map[string]interface{})
+			module["data"] = data
+		}
+		nullDataSources, _ := data["null_data_source"].(map[string]interface{})
+		if nullDataSources == nil {
+			nullDataSources = make(map[string]interface{})
+			data["null_data_source"] = nullDataSources
+		}
+		nullDataSources[moduleAutoscalingGroupTags] = map[string]interface{}{
+			"count": "${length(keys(var.tags))}",
+			"inputs": map[string]interface{}{
+				"key":                 "${element(keys(var.tags), count.index)}",
+				"value":               "${lookup(var.tags, element(keys(var.tags), count.index))}",
+				"propagate_at_launch": "true",
+			},
+		}
+		hasTags = true
+	}
+
+	if hasTags {
+		variables["tags"] = map[string]interface{}{
+			"description": "Additional tags for the resources that support tags",
+			"type":        "map",
+			"default":     map[string]interface{}{},
+		}
+	}
+
+	for _, output := range moduleOutputs {
+		items, _ := resources[output.ResourceType].(map[string]interface{})
+		if len(items) == 0 {
+			continue
+		}
+		// The map is built with an interpolation; the HCL printer would write a map value as a block
+		var args []string
+		for _, name := range sortedKeys(items) {
+			args = append(args, fmt.Sprintf("%q", name), output.ResourceType+"."+name+"."+output.Property)
+		}
+		if outputs[output.Output] != nil {
+			return nil, fmt.Errorf("duplicate variable found: %s", output.Output)
+		}
+		outputs[output.Output] = map[string]interface{}{
+			"value": fmt.Sprintf("${map(%s)}", strings.Join(args, ", ")),
+		}
+	}
+
+	if len(variables) != 0 {
+		module["variable"] = variables
+	}
+	if len(outputs) != 0 {
+		module["output"] = outputs
+	}
+
+	return module, nil
+}
+
+// toGeneric converts the typed terraform configuration to maps, by round-tripping through JSON
+func toGeneric(data map[string]interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling terraform data to json: %v", err)
+	}
+
+	generic := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	// Keep numbers as they were written
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, fmt.Errorf("error parsing terraform json: %v", err)
+	}
+	return generic, nil
+}
+
+// replaceStrings replaces string values (but not keys) that exactly match a key of replacements
+func replaceStrings(v interface{}, replacements map[string]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		if r, found := replacements[v]; found {
+			return r
+		}
+		return v
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = replaceStrings(v[k], replacements)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = replaceStrings(v[i], replacements)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package terraform
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -50,6 +51,11 @@ type TerraformTarget struct {
 	files map[string][]byte
 	// extra config to add to the provider block
 	clusterSpecTarget *kops.TargetSpec
+	// outputJSON is true if the configuration is written as Terraform JSON, rather than HCL
+	outputJSON bool
+
+	// Module is set if the configuration should be written as a reusable module
+	Module *ModuleOptions
 }
 
 func NewTerraformTarget(cloud fi.Cloud, region, project string, outDir string, clusterSpecTarget *kops.TargetSpec) *TerraformTarget {
@@ -65,6 +71,14 @@ func NewTerraformTarget(cloud fi.Cloud, region, project string, outDir string, c
 	}
 }
 
+// NewTerraformJSONTarget builds a TerraformTarget that writes kubernetes.tf.json in the Terraform JSON syntax,
+// so that the output can be processed without an HCL parser
+func NewTerraformJSONTarget(cloud fi.Cloud, region, project string, outDir string, clusterSpecTarget *kops.TargetSpec) *TerraformTarget {
+	t := NewTerraformTarget(cloud, region, project, outDir, clusterSpecTarget)
+	t.outputJSON = true
+	return t
+}
+
 var _ fi.Target = &TerraformTarget{}
 
 type terraformResource struct {
@@ -251,22 +265,36 @@ func (t *TerraformTarget) Finish(taskMap map[string]fi.Task) error {
 		data["output"] = outputVariables
 	}
 
+	if t.Module != nil {
+		module, err := t.Module.buildModule(data)
+		if err != nil {
+			return err
+		}
+		data = module
+	}
+
 	jsonBytes, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshalling terraform data to json: %v", err)
 	}
 
-	useJson := false
-
-	if useJson {
-		t.files["kubernetes.tf"] = jsonBytes
+	if t.outputJSON {
+		// Re-encode without escaping, so that expressions such as ">= 0.9.3" are readable
+		var b bytes.Buffer
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return fmt.Errorf("error marshalling terraform data to json: %v", err)
+		}
+		t.files["kubernetes.tf.json"] = b.Bytes()
 	} else {
 		f, err := hcl_parser.Parse(jsonBytes)
 		if err != nil {
 			return fmt.Errorf("error parsing terraform json: %v", err)
 		}
 
-		b, err := hclPrint(f)
+		b, err := hclPrint(f, t.Module != nil)
 		if err != nil {
 			return fmt.Errorf("error writing terraform data to output: %v", err)
 		}
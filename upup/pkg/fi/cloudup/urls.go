@@ -22,6 +22,7 @@ import (
 	"os"
 
 	"path"
+	"strings"
 
 	"github.com/golang/glog"
 	"k8s.io/kops"
@@ -119,7 +120,7 @@ func NodeUpLocation(assetsBuilder *assets.AssetBuilder) (*url.URL, *hashing.Hash
 			return nil, nil, fmt.Errorf("unable to parse env var NODEUP_URL %q as an url: %v", env, err)
 		}
 
-		nodeUpLocation, nodeUpHash, err = assetsBuilder.RemapFileAndSHA(nodeUpLocation)
+		nodeUpLocation, nodeUpHash, err = assetsBuilder.RemapFileAndSHA("nodeup", nodeUpLocation)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -156,7 +157,7 @@ func ProtokubeImageSource(assetsBuilder *assets.AssetBuilder) (*url.URL, *hashin
 			return nil, nil, fmt.Errorf("unable to parse env var PROTOKUBE_IMAGE %q as an url: %v", env, err)
 		}
 
-		protokubeLocation, protokubeHash, err = assetsBuilder.RemapFileAndSHA(protokubeImageSource)
+		protokubeLocation, protokubeHash, err = assetsBuilder.RemapFileAndSHA("protokube", protokubeImageSource)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -175,7 +176,8 @@ func KopsFileUrl(file string, assetBuilder *assets.AssetBuilder) (*url.URL, *has
 
 	base.Path = path.Join(base.Path, file)
 
-	fileUrl, hash, err := assetBuilder.RemapFileAndSHA(base)
+	component := strings.TrimSuffix(path.Base(file), ".tar.gz")
+	fileUrl, hash, err := assetBuilder.RemapFileAndSHA(component, base)
 	if err != nil {
 		return nil, nil, err
 	}
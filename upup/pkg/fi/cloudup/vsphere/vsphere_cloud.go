@@ -118,6 +118,18 @@ func (c *VSphereCloud) DeleteGroup(g *cloudinstances.CloudInstanceGroup) error {
 	return fmt.Errorf("vSphere cloud provider does not support deleting cloud groups at this time.")
 }
 
+// ResizeGroup is not implemented yet, is a func that needs to resize a vSphere instance group.
+func (c *VSphereCloud) ResizeGroup(g *cloudinstances.CloudInstanceGroup, targetSize int) error {
+	glog.V(8).Infof("vSphere cloud provider ResizeGroup not implemented yet")
+	return fmt.Errorf("vSphere cloud provider does not support resizing cloud groups at this time.")
+}
+
+// ScaleInInstance is not implemented yet, is a func that needs to delete a vSphere instance and shrink its group.
+func (c *VSphereCloud) ScaleInInstance(i *cloudinstances.CloudInstanceGroupMember) error {
+	glog.V(8).Infof("vSphere cloud provider ScaleInInstance not implemented yet")
+	return fmt.Errorf("vSphere cloud provider does not support scaling in cloud groups at this time.")
+}
+
 // DeleteInstance is not implemented yet, is func needs to delete a vSphereCloud instance.
 func (c *VSphereCloud) DeleteInstance(i *cloudinstances.CloudInstanceGroupMember) error {
 	glog.V(8).Infof("vSphere cloud provider DeleteInstance not implemented yet")
@@ -0,0 +1,112 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fi
+
+import (
+	"sort"
+)
+
+// DriftType describes how the live state of a resource differs from the state the cluster spec requires
+type DriftType string
+
+const (
+	// DriftMissing means the resource does not exist, and would be created
+	DriftMissing DriftType = "Missing"
+	// DriftModified means a field of the resource does not have the expected value, and would be changed
+	DriftModified DriftType = "Modified"
+	// DriftUnexpected means the resource exists but is no longer expected, and would be deleted
+	DriftUnexpected DriftType = "Unexpected"
+)
+
+// Drift is a single difference between the live state and the expected state of a task
+type Drift struct {
+	// TaskType is the type of the task, for example SecurityGroup
+	TaskType string `json:"taskType"`
+	// TaskName is the name of the task, or a description of the item for an unexpected resource
+	TaskName string `json:"taskName"`
+	// Type is how the resource differs
+	Type DriftType `json:"type"`
+	// Field is the field that differs, for a modified resource; it is empty if the field cannot be described
+	Field string `json:"field,omitempty"`
+	// Expected is the value of the field required by the cluster spec
+	Expected string `json:"expected,omitempty"`
+	// Actual is the value of the field in the live state
+	Actual string `json:"actual,omitempty"`
+}
+
+// Drift returns the differences between the live state and the tasks that the target has recorded, in a consistent order
+func (t *DryRunTarget) Drift(taskMap map[string]Task) ([]*Drift, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var drift []*Drift
+	for _, r := range t.changes {
+		taskType := getTaskName(r.changes)
+		taskName := idForTask(taskMap, r.e)
+
+		if r.aIsNil {
+			drift = append(drift, &Drift{
+				TaskType: taskType,
+				TaskName: taskName,
+				Type:     DriftMissing,
+			})
+			continue
+		}
+
+		changeList, err := buildChangeList(r.a, r.e, r.changes)
+		if err != nil {
+			return nil, err
+		}
+		if len(changeList) == 0 {
+			// The task reported a change that is not in any field we can describe, for example a zero value
+			drift = append(drift, &Drift{
+				TaskType: taskType,
+				TaskName: taskName,
+				Type:     DriftModified,
+			})
+			continue
+		}
+		for _, change := range changeList {
+			drift = append(drift, &Drift{
+				TaskType: taskType,
+				TaskName: taskName,
+				Type:     DriftModified,
+				Field:    change.FieldName,
+				Expected: change.Expected,
+				Actual:   change.Actual,
+			})
+		}
+	}
+
+	for _, d := range t.deletions {
+		drift = append(drift, &Drift{
+			TaskType: d.TaskName(),
+			TaskName: d.Item(),
+			Type:     DriftUnexpected,
+		})
+	}
+
+	// The changes are recorded as the tasks run, so sort them to be deterministic
+	sort.SliceStable(drift, func(i, j int) bool {
+		if drift[i].TaskType != drift[j].TaskType {
+			return drift[i].TaskType < drift[j].TaskType
+		}
+		return drift[i].TaskName < drift[j].TaskName
+	})
+
+	return drift, nil
+}
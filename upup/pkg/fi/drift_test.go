@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fi
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testDriftTask struct {
+	Name     *string
+	Port     *int64
+	UserData Resource
+}
+
+func (e *testDriftTask) Run(c *Context) error { return nil }
+func (e *testDriftTask) GetName() *string     { return e.Name }
+func (e *testDriftTask) SetName(name string)  { e.Name = &name }
+
+type testDriftDeletion struct {
+	item string
+}
+
+func (d *testDriftDeletion) Delete(target Target) error { return nil }
+func (d *testDriftDeletion) TaskName() string           { return "SecurityGroupRule" }
+func (d *testDriftDeletion) Item() string               { return d.item }
+
+func TestDryRunTargetDrift(t *testing.T) {
+	target := &DryRunTarget{}
+
+	missing := &testDriftTask{Name: String("missing"), Port: Int64(443)}
+	var actualMissing *testDriftTask
+	if err := target.Render(actualMissing, missing, missing); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &testDriftTask{Name: String("modified"), Port: Int64(443), UserData: NewStringResource("new")}
+	actual := &testDriftTask{Name: String("modified"), Port: Int64(22), UserData: NewStringResource("old")}
+	changes := &testDriftTask{Port: Int64(443), UserData: NewStringResource("new")}
+	if err := target.Render(actual, expected, changes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := target.Delete(&testDriftDeletion{item: "sg-1234 ingress 0.0.0.0/0:22"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	taskMap := map[string]Task{
+		"testDriftTask/missing":  missing,
+		"testDriftTask/modified": expected,
+	}
+	drift, err := target.Drift(taskMap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []Drift
+	for _, d := range drift {
+		got = append(got, *d)
+	}
+	want := []Drift{
+		{TaskType: "SecurityGroupRule", TaskName: "sg-1234 ingress 0.0.0.0/0:22", Type: DriftUnexpected},
+		{TaskType: "testDriftTask", TaskName: "missing", Type: DriftMissing},
+		{TaskType: "testDriftTask", TaskName: "modified", Type: DriftModified, Field: "Port", Expected: "443", Actual: "22"},
+		{TaskType: "testDriftTask", TaskName: "modified", Type: DriftModified, Field: "UserData", Expected: resourceDigest("new"), Actual: resourceDigest("old")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected drift\nexpected: %+v\n     got: %+v", want, got)
+	}
+}
+
+func TestDryRunTargetDriftWithoutFields(t *testing.T) {
+	target := &DryRunTarget{}
+
+	// A change that only sets zero values cannot be described field by field
+	expected := &testDriftTask{Name: String("modified")}
+	actual := &testDriftTask{Name: String("modified")}
+	if err := target.Render(actual, expected, &testDriftTask{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	drift, err := target.Drift(map[string]Task{"testDriftTask/modified": expected})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []Drift
+	for _, d := range drift {
+		got = append(got, *d)
+	}
+	want := []Drift{
+		{TaskType: "testDriftTask", TaskName: "modified", Type: DriftModified},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected drift\nexpected: %+v\n     got: %+v", want, got)
+	}
+}
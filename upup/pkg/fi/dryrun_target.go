@@ -18,6 +18,8 @@ package fi
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"reflect"
@@ -151,56 +153,8 @@ func (t *DryRunTarget) PrintReport(taskMap map[string]Task, out io.Writer) error
 				taskName := getTaskName(r.changes)
 				fmt.Fprintf(b, "  %s/%s\n", taskName, idForTask(taskMap, r.e))
 
-				changes := reflect.ValueOf(r.changes)
-				if changes.Kind() == reflect.Ptr && !changes.IsNil() {
-					changes = changes.Elem()
-				}
-
-				if changes.Kind() == reflect.Struct {
-					for i := 0; i < changes.NumField(); i++ {
-
-						field := changes.Field(i)
-
-						fieldName := changes.Type().Field(i).Name
-						if changes.Type().Field(i).PkgPath != "" {
-							// Not exported
-							continue
-						}
-
-						fieldValue := ValueAsString(field)
-
-						shouldPrint := true
-						if fieldName == "Name" {
-							// The field name is already printed above, no need to repeat it.
-							shouldPrint = false
-						}
-						if fieldName == "Lifecycle" {
-							// Lifecycle is a "system" field; no need to show it
-							shouldPrint = false
-						}
-						if fieldValue == "<nil>" || fieldValue == "<resource>" {
-							// Uninformative
-							shouldPrint = false
-						}
-						if fieldValue == "id:<nil>" {
-							// Uninformative, but we can often print the name instead
-							name := ""
-							if field.CanInterface() {
-								hasName, ok := field.Interface().(HasName)
-								if ok {
-									name = StringValue(hasName.GetName())
-								}
-							}
-							if name != "" {
-								fieldValue = "name:" + name
-							} else {
-								shouldPrint = false
-							}
-						}
-						if shouldPrint {
-							fmt.Fprintf(b, "  \t%-20s\t%s\n", fieldName, fieldValue)
-						}
-					}
+				for _, field := range buildCreateFieldList(r.changes) {
+					fmt.Fprintf(b, "  \t%-20s\t%s\n", field.FieldName, field.Expected)
 				}
 
 				fmt.Fprintf(b, "\n")
@@ -273,9 +227,72 @@ func (t *DryRunTarget) PrintReport(taskMap map[string]Task, out io.Writer) error
 	return err
 }
 
+// buildCreateFieldList returns the informative fields of a task that will be created
+func buildCreateFieldList(t Task) []change {
+	var fields []change
+
+	changes := reflect.ValueOf(t)
+	if changes.Kind() == reflect.Ptr && !changes.IsNil() {
+		changes = changes.Elem()
+	}
+
+	if changes.Kind() == reflect.Struct {
+		for i := 0; i < changes.NumField(); i++ {
+
+			field := changes.Field(i)
+
+			fieldName := changes.Type().Field(i).Name
+			if changes.Type().Field(i).PkgPath != "" {
+				// Not exported
+				continue
+			}
+
+			fieldValue := ValueAsString(field)
+
+			shouldPrint := true
+			if fieldName == "Name" {
+				// The field name is already printed above, no need to repeat it.
+				shouldPrint = false
+			}
+			if fieldName == "Lifecycle" {
+				// Lifecycle is a "system" field; no need to show it
+				shouldPrint = false
+			}
+			if fieldValue == "<nil>" || fieldValue == "<resource>" {
+				// Uninformative
+				shouldPrint = false
+			}
+			if fieldValue == "id:<nil>" {
+				// Uninformative, but we can often print the name instead
+				name := ""
+				if field.CanInterface() {
+					hasName, ok := field.Interface().(HasName)
+					if ok {
+						name = StringValue(hasName.GetName())
+					}
+				}
+				if name != "" {
+					fieldValue = "name:" + name
+				} else {
+					shouldPrint = false
+				}
+			}
+			if shouldPrint {
+				fields = append(fields, change{FieldName: fieldName, Expected: fieldValue})
+			}
+		}
+	}
+
+	return fields
+}
+
 type change struct {
 	FieldName   string
 	Description string
+
+	// Actual and Expected are the values of the field in the live state and in the task
+	Actual   string
+	Expected string
 }
 
 func buildChangeList(a, e, changes Task) ([]change, error) {
@@ -322,6 +339,8 @@ func buildChangeList(a, e, changes Task) ([]change, error) {
 			fieldValE := valE.Field(i)
 
 			description := ""
+			actual := ""
+			expected := ""
 			ignored := false
 			if fieldValE.CanInterface() {
 				fieldValA := valA.Field(i)
@@ -334,17 +353,22 @@ func buildChangeList(a, e, changes Task) ([]change, error) {
 					resE, okE := tryResourceAsString(fieldValE)
 					if okA && okE {
 						description = diff.FormatDiff(resA, resE)
+						// Resources can hold secrets (user-data, for example), so only their hashes are recorded
+						actual = resourceDigest(resA)
+						expected = resourceDigest(resE)
 					}
 				}
 
 				if !ignored && description == "" {
-					description = fmt.Sprintf(" %v -> %v", ValueAsString(fieldValA), ValueAsString(fieldValE))
+					actual = ValueAsString(fieldValA)
+					expected = ValueAsString(fieldValE)
+					description = fmt.Sprintf(" %v -> %v", actual, expected)
 				}
 			}
 			if ignored {
 				continue
 			}
-			changeList = append(changeList, change{FieldName: valC.Type().Field(i).Name, Description: description})
+			changeList = append(changeList, change{FieldName: valC.Type().Field(i).Name, Description: description, Actual: actual, Expected: expected})
 		}
 	} else {
 		return nil, fmt.Errorf("unhandled change type: %v", valC.Type())
@@ -389,6 +413,12 @@ func tryResourceAsString(v reflect.Value) (string, bool) {
 	return "", false
 }
 
+// resourceDigest returns a placeholder for the contents of a resource, which changes when the contents change
+func resourceDigest(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return "<resource sha256:" + hex.EncodeToString(hash[:]) + ">"
+}
+
 func getTaskName(t Task) string {
 	s := fmt.Sprintf("%T", t)
 	lastDot := strings.LastIndexByte(s, '.')
@@ -436,6 +466,10 @@ func ValueAsString(value reflect.Value) string {
 
 		case reflect.Map:
 			keys := v.MapKeys()
+			// Sort the keys so that the output is stable, and can be compared
+			sort.Slice(keys, func(i, j int) bool {
+				return ValueAsString(keys[i]) < ValueAsString(keys[j])
+			})
 			fmt.Fprintf(b, "{")
 			for i, key := range keys {
 				mv := v.MapIndex(key)
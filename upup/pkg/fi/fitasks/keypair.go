@@ -22,6 +22,7 @@ import (
 	"net"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"k8s.io/kops/pkg/pki"
@@ -54,6 +55,10 @@ type Keypair struct {
 	// Format stores the api version of kops.Keyset.  We are using this info in order to determine if kops
 	// is accessing legacy secrets that do not use keyset.yaml.
 	Format string `json:"format"`
+	// RenewalWindow is how long before it expires that the certificate is reissued; if nil it is not reissued because of its expiry
+	RenewalWindow *time.Duration `json:"renewalWindow,omitempty"`
+	// ExpiresSoon is true on the actual state when the certificate expires within the renewal window, so that it is reissued
+	ExpiresSoon bool `json:"expiresSoon,omitempty"`
 }
 
 var _ fi.HasCheckExisting = &Keypair{}
@@ -105,8 +110,14 @@ func (e *Keypair) Find(c *fi.Context) (*Keypair, error) {
 
 	actual.Signer = &Keypair{Subject: pkixNameToString(&cert.Certificate.Issuer)}
 
+	if e.RenewalWindow != nil && time.Now().Add(*e.RenewalWindow).After(cert.Certificate.NotAfter) {
+		glog.Infof("certificate %q expires at %s, within the renewal window", name, cert.Certificate.NotAfter.UTC().Format(time.RFC3339))
+		actual.ExpiresSoon = true
+	}
+
 	// Avoid spurious changes
 	actual.Lifecycle = e.Lifecycle
+	actual.RenewalWindow = e.RenewalWindow
 
 	return actual, nil
 }
@@ -179,6 +190,9 @@ func (_ *Keypair) Render(c *fi.Context, a, e, changes *Keypair) error {
 	if a == nil {
 		createCertificate = true
 		glog.V(8).Infof("creating brand new certificate")
+	} else if a.ExpiresSoon {
+		createCertificate = true
+		glog.V(8).Infof("creating certificate as the existing certificate expires within the renewal window")
 	} else if changes != nil {
 		glog.V(8).Infof("creating certificate as changes are not nil")
 		if changes.AlternateNames != nil {
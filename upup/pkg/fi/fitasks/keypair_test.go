@@ -17,10 +17,16 @@ limitations under the License.
 package fitasks
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"strings"
 	"testing"
+	"time"
 
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/pki"
 	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
 )
 
 func TestKeypairDeps(t *testing.T) {
@@ -43,3 +49,56 @@ func TestKeypairDeps(t *testing.T) {
 		t.Errorf("unexpected dependencies for cert: %v", deps["cert"])
 	}
 }
+
+func TestKeypairFindExpiresSoon(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+	basePath, err := vfs.Context.BuildVfsPath("memfs://tests")
+	if err != nil {
+		t.Fatalf("error building vfspath: %v", err)
+	}
+	keystore := fi.NewVFSCAStore(&kops.Cluster{}, basePath, true)
+
+	privateKey, err := pki.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("error generating private key: %v", err)
+	}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "kubelet"},
+		BasicConstraintsValid: true,
+		NotAfter:              time.Now().Add(10 * 24 * time.Hour),
+	}
+	cert, err := pki.SignNewCertificate(privateKey, template, nil, nil)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	if err := keystore.StoreKeypair("kubelet", cert, privateKey); err != nil {
+		t.Fatalf("error storing keypair: %v", err)
+	}
+
+	c := &fi.Context{Keystore: keystore}
+	grid := []struct {
+		RenewalWindow *time.Duration
+		ExpiresSoon   bool
+	}{
+		{RenewalWindow: nil, ExpiresSoon: false},
+		{RenewalWindow: durationPtr(24 * time.Hour), ExpiresSoon: false},
+		{RenewalWindow: durationPtr(30 * 24 * time.Hour), ExpiresSoon: true},
+	}
+	for _, g := range grid {
+		e := &Keypair{Name: fi.String("kubelet"), RenewalWindow: g.RenewalWindow}
+		actual, err := e.Find(c)
+		if err != nil {
+			t.Fatalf("error from Find: %v", err)
+		}
+		if actual.ExpiresSoon != g.ExpiresSoon {
+			t.Errorf("renewal window %v: expected ExpiresSoon=%v, got %v", g.RenewalWindow, g.ExpiresSoon, actual.ExpiresSoon)
+		}
+		if actual.RenewalWindow != e.RenewalWindow {
+			t.Errorf("renewal window %v: RenewalWindow should be copied to avoid spurious changes", g.RenewalWindow)
+		}
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
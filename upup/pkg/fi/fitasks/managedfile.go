@@ -21,9 +21,11 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/golang/glog"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/kops/pkg/acls"
 	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
 )
 
 //go:generate fitask -type=ManagedFile
@@ -48,6 +50,11 @@ func (e *ManagedFile) Find(c *fi.Context) (*ManagedFile, error) {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
+		if vfs.IsIntegrityError(err) {
+			// The file is rewritten, so that it is sealed
+			glog.Infof("%v", err)
+			return nil, nil
+		}
 		return nil, err
 	}
 
@@ -34,6 +34,7 @@ import (
 	"k8s.io/kops/pkg/apis/kops/registry"
 	"k8s.io/kops/pkg/apis/nodeup"
 	"k8s.io/kops/pkg/assets"
+	"k8s.io/kops/pkg/envelope"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/nodeup/cloudinit"
 	"k8s.io/kops/upup/pkg/fi/nodeup/local"
@@ -114,12 +115,33 @@ func (c *NodeUpCommand) Run(out io.Writer) error {
 		return fmt.Errorf("ConfigBase is required")
 	}
 
+	sealed := c.config.SealedStateSecretStore != ""
+	if sealed {
+		// The secret is read from the secret store, rather than passed in the configuration, so that it is not in the user-data
+		secretStore, err := buildSecretStore(nil, c.config.SealedStateSecretStore)
+		if err != nil {
+			return err
+		}
+		secret, err := secretStore.Secret(registry.SecretStateSeal)
+		if err != nil {
+			return fmt.Errorf("error reading the secret the state is sealed with: %v", err)
+		}
+		keys, err := vfs.NewSealKeys(secret.Data)
+		if err != nil {
+			return fmt.Errorf("error building seal keys: %v", err)
+		}
+		configBase = vfs.NewSealedPath(configBase, keys, false)
+	}
+
 	c.cluster = &api.Cluster{}
 	{
 		clusterLocation := fi.StringValue(c.config.ClusterLocation)
 
 		var p vfs.Path
 		if clusterLocation != "" {
+			if sealed {
+				return fmt.Errorf("ClusterLocation cannot be used with a sealed state; set ConfigBase instead")
+			}
 			var err error
 			p, err = vfs.Context.BuildVfsPath(clusterLocation)
 			if err != nil {
@@ -156,6 +178,18 @@ func (c *NodeUpCommand) Run(out io.Writer) error {
 		glog.Warningf("No instance group defined in nodeup config")
 	}
 
+	if sealed {
+		// protokube verifies the addons again as it applies them, but an instance that cannot verify them should not start
+		addons := configBase.Join("addons")
+		if _, err := addons.Join("bootstrap-channel.yaml").ReadFile(); err != nil {
+			return fmt.Errorf("error verifying addons %q: %v", addons, err)
+		}
+		if err := addons.(*vfs.SealedPath).VerifyTree(); err != nil {
+			return fmt.Errorf("error verifying addons %q: %v", addons, err)
+		}
+		glog.Infof("Verified the integrity of the configuration read from %q", configBase)
+	}
+
 	err := evaluateSpec(c.cluster)
 	if err != nil {
 		return err
@@ -187,24 +221,26 @@ func (c *NodeUpCommand) Run(out io.Writer) error {
 
 	if c.cluster.Spec.SecretStore != "" {
 		glog.Infof("Building SecretStore at %q", c.cluster.Spec.SecretStore)
-		p, err := vfs.Context.BuildVfsPath(c.cluster.Spec.SecretStore)
+		secretStore, err := buildSecretStore(c.cluster, c.cluster.Spec.SecretStore)
 		if err != nil {
-			return fmt.Errorf("error building secret store path: %v", err)
+			return err
 		}
-
-		modelContext.SecretStore = secrets.NewVFSSecretStore(c.cluster, p)
+		modelContext.SecretStore = secretStore
 	} else {
 		return fmt.Errorf("SecretStore not set")
 	}
 
 	if c.cluster.Spec.KeyStore != "" {
 		glog.Infof("Building KeyStore at %q", c.cluster.Spec.KeyStore)
-		p, err := vfs.Context.BuildVfsPath(c.cluster.Spec.KeyStore)
+		// The private keys are decrypted with the key encryption key of the key store, if it is encrypted
+		p, encrypter, err := envelope.BuildStorePath(c.cluster.Spec.KeyStore)
 		if err != nil {
 			return fmt.Errorf("error building key store path: %v", err)
 		}
 
-		modelContext.KeyStore = fi.NewVFSCAStore(c.cluster, p, false)
+		keyStore := fi.NewVFSCAStore(c.cluster, p, false)
+		keyStore.Encrypter = encrypter
+		modelContext.KeyStore = keyStore
 	} else {
 		return fmt.Errorf("KeyStore not set")
 	}
@@ -300,6 +336,20 @@ func (c *NodeUpCommand) Run(out io.Writer) error {
 	return nil
 }
 
+// buildSecretStore builds the secret store at the location.  The secrets are decrypted with the key encryption key
+// of the secret store, if it is encrypted.
+func buildSecretStore(cluster *api.Cluster, location string) (fi.SecretStore, error) {
+	p, encrypter, err := envelope.BuildStorePath(location)
+	if err != nil {
+		return nil, fmt.Errorf("error building secret store path: %v", err)
+	}
+
+	if encrypter != nil {
+		return secrets.NewEncryptedVFSSecretStore(cluster, p, encrypter), nil
+	}
+	return secrets.NewVFSSecretStore(cluster, p), nil
+}
+
 func evaluateSpec(c *api.Cluster) error {
 	var err error
 
@@ -0,0 +1,160 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/kops/pkg/diff"
+)
+
+// Plan is a structured form of the changes that a DryRunTarget recorded.
+// It can be saved, and later compared with a new plan to check that the live state has not changed.
+type Plan struct {
+	// Cluster is the name of the cluster the plan applies to
+	Cluster string `json:"cluster,omitempty"`
+	// SpecHash is the hash of the specs of the cluster and its instance groups the plan was made from
+	SpecHash string `json:"specHash,omitempty"`
+	// ResourceVersion is the version of the cluster in the state store the plan was made from, if the store records versions
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+
+	// Create are the tasks that will be created
+	Create []*PlannedTask `json:"create,omitempty"`
+	// Modify are the tasks that will be changed
+	Modify []*PlannedTask `json:"modify,omitempty"`
+	// Delete are the resources that will be deleted
+	Delete []*PlannedDeletion `json:"delete,omitempty"`
+}
+
+// PlannedTask is a task that will be created or changed
+type PlannedTask struct {
+	// TaskType is the type of the task, for example SecurityGroup
+	TaskType string `json:"taskType"`
+	// TaskName is the name of the task
+	TaskName string `json:"taskName"`
+	// Fields are the fields that will be set; for a created task Actual is always empty
+	Fields []*PlannedField `json:"fields,omitempty"`
+	// Dependencies are the keys (taskType/taskName) of the tasks that must run first
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+// PlannedField is a single field of a planned task
+type PlannedField struct {
+	Name     string `json:"name"`
+	Actual   string `json:"actual,omitempty"`
+	Expected string `json:"expected,omitempty"`
+}
+
+// PlannedDeletion is a resource that is no longer needed, and will be deleted
+type PlannedDeletion struct {
+	TaskType string `json:"taskType"`
+	Item     string `json:"item"`
+}
+
+// IsEmpty returns true if the plan makes no changes
+func (p *Plan) IsEmpty() bool {
+	return len(p.Create) == 0 && len(p.Modify) == 0 && len(p.Delete) == 0
+}
+
+// Diff compares two plans, returning a human-readable diff, or an empty string if they are the same
+func (p *Plan) Diff(other *Plan) (string, error) {
+	l, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling plan: %v", err)
+	}
+	r, err := json.MarshalIndent(other, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling plan: %v", err)
+	}
+	if string(l) == string(r) {
+		return "", nil
+	}
+	return diff.FormatDiff(string(l), string(r)), nil
+}
+
+// Plan returns the changes that the target has recorded as a Plan, in a consistent order
+func (t *DryRunTarget) Plan(taskMap map[string]Task) (*Plan, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	dependencies := FindTaskDependencies(taskMap)
+
+	taskKeys := make(map[Task]string)
+	for k, task := range taskMap {
+		taskKeys[task] = k
+	}
+
+	plan := &Plan{}
+	for _, r := range t.changes {
+		p := &PlannedTask{
+			TaskType: getTaskName(r.changes),
+			TaskName: idForTask(taskMap, r.e),
+		}
+
+		if key, found := taskKeys[r.e]; found {
+			p.Dependencies = append(p.Dependencies, dependencies[key]...)
+			sort.Strings(p.Dependencies)
+		}
+
+		if r.aIsNil {
+			for _, field := range buildCreateFieldList(r.changes) {
+				p.Fields = append(p.Fields, &PlannedField{Name: field.FieldName, Expected: field.Expected})
+			}
+			plan.Create = append(plan.Create, p)
+			continue
+		}
+
+		changeList, err := buildChangeList(r.a, r.e, r.changes)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changeList {
+			p.Fields = append(p.Fields, &PlannedField{Name: change.FieldName, Actual: change.Actual, Expected: change.Expected})
+		}
+		plan.Modify = append(plan.Modify, p)
+	}
+
+	for _, d := range t.deletions {
+		plan.Delete = append(plan.Delete, &PlannedDeletion{
+			TaskType: d.TaskName(),
+			Item:     d.Item(),
+		})
+	}
+
+	// The changes are recorded as the tasks run, so sort them to be deterministic
+	sortPlannedTasks(plan.Create)
+	sortPlannedTasks(plan.Modify)
+	sort.SliceStable(plan.Delete, func(i, j int) bool {
+		if plan.Delete[i].TaskType != plan.Delete[j].TaskType {
+			return plan.Delete[i].TaskType < plan.Delete[j].TaskType
+		}
+		return plan.Delete[i].Item < plan.Delete[j].Item
+	})
+
+	return plan, nil
+}
+
+func sortPlannedTasks(tasks []*PlannedTask) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].TaskType != tasks[j].TaskType {
+			return tasks[i].TaskType < tasks[j].TaskType
+		}
+		return tasks[i].TaskName < tasks[j].TaskName
+	})
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testPlanTask struct {
+	Name   *string
+	Port   *int64
+	Tags   map[string]string
+	Parent *testPlanTask
+}
+
+func (e *testPlanTask) Run(c *Context) error { return nil }
+func (e *testPlanTask) GetName() *string     { return e.Name }
+func (e *testPlanTask) SetName(name string)  { e.Name = &name }
+
+type testPlanResourceTask struct {
+	Name     *string
+	UserData Resource
+}
+
+func (e *testPlanResourceTask) Run(c *Context) error { return nil }
+
+func TestDryRunTargetPlan(t *testing.T) {
+	target := &DryRunTarget{}
+
+	parent := &testPlanTask{Name: String("parent"), Port: Int64(22)}
+	actualParent := &testPlanTask{Name: String("parent"), Port: Int64(2222)}
+	if err := target.Render(actualParent, parent, &testPlanTask{Port: Int64(22)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	child := &testPlanTask{Name: String("child"), Tags: map[string]string{"b": "2", "a": "1"}, Parent: parent}
+	var actualChild *testPlanTask
+	if err := target.Render(actualChild, child, child); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := target.Delete(&testDriftDeletion{item: "sg-1234 ingress 0.0.0.0/0:22"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	taskMap := map[string]Task{
+		"testPlanTask/parent": parent,
+		"testPlanTask/child":  child,
+	}
+	plan, err := target.Plan(taskMap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := &Plan{
+		Create: []*PlannedTask{
+			{
+				TaskType: "testPlanTask",
+				TaskName: "child",
+				Fields: []*PlannedField{
+					{Name: "Tags", Expected: "{a: 1, b: 2}"},
+					{Name: "Parent", Expected: `{"Name":"parent","Port":22,"Tags":null,"Parent":null}`},
+				},
+				Dependencies: []string{"testPlanTask/parent"},
+			},
+		},
+		Modify: []*PlannedTask{
+			{
+				TaskType: "testPlanTask",
+				TaskName: "parent",
+				Fields:   []*PlannedField{{Name: "Port", Actual: "2222", Expected: "22"}},
+			},
+		},
+		Delete: []*PlannedDeletion{
+			{TaskType: "SecurityGroupRule", Item: "sg-1234 ingress 0.0.0.0/0:22"},
+		},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		got, _ := json.Marshal(plan)
+		expected, _ := json.Marshal(want)
+		t.Fatalf("unexpected plan\nexpected: %s\n     got: %s", expected, got)
+	}
+
+	if diff, err := plan.Diff(want); err != nil || diff != "" {
+		t.Errorf("expected identical plans to have no diff, got %q (%v)", diff, err)
+	}
+
+	changed := *want
+	changed.Delete = nil
+	if diff, err := plan.Diff(&changed); err != nil || diff == "" {
+		t.Errorf("expected changed plans to have a diff (%v)", err)
+	}
+}
+
+func TestDryRunTargetPlanOmitsResourceContents(t *testing.T) {
+	target := &DryRunTarget{}
+
+	created := &testPlanResourceTask{Name: String("created"), UserData: NewStringResource("#!/bin/bash\necho created-secret")}
+	var actualCreated *testPlanResourceTask
+	if err := target.Render(actualCreated, created, created); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	modified := &testPlanResourceTask{Name: String("modified"), UserData: NewStringResource("#!/bin/bash\necho expected-secret")}
+	actualModified := &testPlanResourceTask{Name: String("modified"), UserData: NewStringResource("#!/bin/bash\necho actual-secret")}
+	if err := target.Render(actualModified, modified, &testPlanResourceTask{UserData: modified.UserData}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	plan, err := target.Plan(map[string]Task{
+		"testPlanResourceTask/created":  created,
+		"testPlanResourceTask/modified": modified,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("error marshaling plan: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("plan contains the contents of a resource: %s", data)
+	}
+
+	if len(plan.Modify) != 1 || len(plan.Modify[0].Fields) != 1 {
+		t.Fatalf("expected a single modified field, got %s", data)
+	}
+	field := plan.Modify[0].Fields[0]
+	if field.Name != "UserData" || !strings.HasPrefix(field.Actual, "<resource sha256:") || !strings.HasPrefix(field.Expected, "<resource sha256:") {
+		t.Errorf("expected hashes of the resource, got %+v", field)
+	}
+	if field.Actual == field.Expected {
+		t.Errorf("expected different hashes for different contents, got %+v", field)
+	}
+}
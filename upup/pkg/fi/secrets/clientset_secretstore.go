@@ -18,6 +18,8 @@ package secrets
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -26,9 +28,11 @@ import (
 	"github.com/golang/glog"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/kops/pkg/acls"
 	"k8s.io/kops/pkg/apis/kops"
 	kopsinternalversion "k8s.io/kops/pkg/client/clientset_generated/clientset/typed/kops/internalversion"
+	"k8s.io/kops/pkg/envelope"
 	"k8s.io/kops/pkg/pki"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/util/pkg/vfs"
@@ -37,6 +41,9 @@ import (
 // NamePrefix is a prefix we use to avoid collisions with other keysets
 const NamePrefix = "token-"
 
+// AnnotationSecretName is the annotation on a Keyset that records the name of the secret it holds
+const AnnotationSecretName = "kops.k8s.io/secret-name"
+
 // ClientsetSecretStore is a SecretStore backed by Keyset objects in an API server
 type ClientsetSecretStore struct {
 	cluster   *kops.Cluster
@@ -62,6 +69,12 @@ func (c *ClientsetSecretStore) MirrorTo(basedir vfs.Path) error {
 		return fmt.Errorf("error listing keysets: %v", err)
 	}
 
+	// The mirror is read by nodeup, so it is encrypted if the cluster's secret store is encrypted
+	encrypter, err := envelope.StoreEncrypter(c.cluster.Spec.SecretStore)
+	if err != nil {
+		return err
+	}
+
 	for i := range list.Items {
 		keyset := &list.Items[i]
 
@@ -74,7 +87,7 @@ func (c *ClientsetSecretStore) MirrorTo(basedir vfs.Path) error {
 			return fmt.Errorf("found secret with no primary data: %s", keyset.Name)
 		}
 
-		name := strings.TrimPrefix(keyset.Name, NamePrefix)
+		name := secretNameForKeyset(keyset)
 		p := BuildVfsSecretPath(basedir, name)
 
 		s := &fi.Secret{
@@ -84,6 +97,12 @@ func (c *ClientsetSecretStore) MirrorTo(basedir vfs.Path) error {
 		if err != nil {
 			return fmt.Errorf("error serializing secret: %v", err)
 		}
+		if encrypter != nil {
+			data, err = encrypter.Encrypt(data)
+			if err != nil {
+				return fmt.Errorf("error encrypting secret %q: %v", name, err)
+			}
+		}
 
 		acl, err := acls.GetACL(p, c.cluster)
 		if err != nil {
@@ -120,8 +139,7 @@ func (c *ClientsetSecretStore) ListSecrets() ([]string, error) {
 
 		switch keyset.Spec.Type {
 		case kops.SecretTypeSecret:
-			name := strings.TrimPrefix(keyset.Name, NamePrefix)
-			names = append(names, name)
+			names = append(names, secretNameForKeyset(keyset))
 		}
 	}
 
@@ -143,6 +161,7 @@ func (c *ClientsetSecretStore) Secret(name string) (*fi.Secret, error) {
 // DeleteSecret implements fi.SecretStore::DeleteSecret
 func (c *ClientsetSecretStore) DeleteSecret(name string) error {
 	client := c.clientset.Keysets(c.namespace)
+	name = keysetNameForSecret(name)
 
 	keyset, err := client.Get(name, v1.GetOptions{})
 	if err != nil {
@@ -217,7 +236,7 @@ func (c *ClientsetSecretStore) ReplaceSecret(name string, secret *fi.Secret) (*f
 
 // loadSecret returns the named secret, if it exists, otherwise returns nil
 func (c *ClientsetSecretStore) loadSecret(name string) (*fi.Secret, error) {
-	name = NamePrefix + name
+	name = keysetNameForSecret(name)
 	keyset, err := c.clientset.Keysets(c.namespace).Get(name, v1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -244,7 +263,8 @@ func parseSecret(keyset *kops.Keyset) (*fi.Secret, error) {
 // createSecret will create the Secret, overwriting an existing secret if replace is true
 func (c *ClientsetSecretStore) createSecret(s *fi.Secret, name string, replace bool) (*kops.Keyset, error) {
 	keyset := &kops.Keyset{}
-	keyset.Name = NamePrefix + name
+	keyset.Name = keysetNameForSecret(name)
+	keyset.Annotations = map[string]string{AnnotationSecretName: name}
 	keyset.Spec.Type = kops.SecretTypeSecret
 
 	t := time.Now().UnixNano()
@@ -255,8 +275,46 @@ func (c *ClientsetSecretStore) createSecret(s *fi.Secret, name string, replace b
 		PrivateMaterial: s.Data,
 	})
 
+	client := c.clientset.Keysets(c.namespace)
 	if replace {
-		return c.clientset.Keysets(c.namespace).Update(keyset)
+		existing, err := client.Get(keyset.Name, v1.GetOptions{})
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return nil, fmt.Errorf("error reading keyset %q: %v", keyset.Name, err)
+			}
+		} else {
+			keyset.ResourceVersion = existing.ResourceVersion
+			return client.Update(keyset)
+		}
+	}
+	return client.Create(keyset)
+}
+
+// keysetNameForSecret returns the name of the Keyset holding the named secret.  Secret names such as system:dns
+// are not valid object names, so invalid characters are replaced and a hash of the name keeps the result unique.
+func keysetNameForSecret(name string) string {
+	keysetName := NamePrefix + name
+	if len(validation.IsDNS1123Subdomain(keysetName)) == 0 {
+		return keysetName
+	}
+
+	sanitized := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(name))
+	if len(sanitized) > 200 {
+		sanitized = sanitized[:200]
+	}
+	hash := sha256.Sum256([]byte(name))
+	return NamePrefix + sanitized + "-" + hex.EncodeToString(hash[:])[:8]
+}
+
+// secretNameForKeyset returns the name of the secret held in the Keyset
+func secretNameForKeyset(keyset *kops.Keyset) string {
+	if name := keyset.Annotations[AnnotationSecretName]; name != "" {
+		return name
 	}
-	return c.clientset.Keysets(c.namespace).Create(keyset)
+	return strings.TrimPrefix(keyset.Name, NamePrefix)
 }
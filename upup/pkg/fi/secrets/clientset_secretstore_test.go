@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/clientset_generated/clientset/fake"
+	"k8s.io/kops/pkg/envelope"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestClientsetSecretStoreMirrorEncrypted(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	dir, err := ioutil.TempDir("", "secretstore")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "kek")
+	if err := ioutil.WriteFile(keyPath, []byte(strings.Repeat("k", 32)), 0600); err != nil {
+		t.Fatalf("error writing key encryption key: %v", err)
+	}
+
+	cluster := &kops.Cluster{}
+	cluster.Spec.SecretStore = envelope.FormatStoreLocation("memfs://tests/secrets", "file://"+keyPath)
+
+	s := NewClientsetSecretStore(cluster, fake.NewSimpleClientset().Kops(), "default")
+	if _, _, err := s.GetOrCreateSecret("admin", &fi.Secret{Data: []byte("password")}); err != nil {
+		t.Fatalf("error creating secret: %v", err)
+	}
+
+	mirrorPath, err := vfs.Context.BuildVfsPath("memfs://tests/mirror")
+	if err != nil {
+		t.Fatalf("error building vfspath: %v", err)
+	}
+	if err := s.MirrorTo(mirrorPath); err != nil {
+		t.Fatalf("error from MirrorTo: %v", err)
+	}
+
+	data, err := mirrorPath.Join("admin").ReadFile()
+	if err != nil {
+		t.Fatalf("error reading mirrored secret: %v", err)
+	}
+	if !envelope.IsEncrypted(data) {
+		t.Fatalf("mirrored secret was not encrypted: %s", data)
+	}
+
+	// nodeup reads the mirror with the key encryption key of the secret store
+	encrypter, err := envelope.StoreEncrypter(cluster.Spec.SecretStore)
+	if err != nil {
+		t.Fatalf("error building encrypter: %v", err)
+	}
+	secret, err := NewEncryptedVFSSecretStore(cluster, mirrorPath, encrypter).FindSecret("admin")
+	if err != nil {
+		t.Fatalf("error reading mirrored secret: %v", err)
+	}
+	if secret == nil || string(secret.Data) != "password" {
+		t.Errorf("mirrored secret did not round-trip: %v", secret)
+	}
+
+	// Without a key encryption key, the mirror is plaintext, as before
+	cluster.Spec.SecretStore = "memfs://tests/secrets"
+	if err := s.MirrorTo(mirrorPath); err != nil {
+		t.Fatalf("error from MirrorTo: %v", err)
+	}
+	data, err = mirrorPath.Join("admin").ReadFile()
+	if err != nil {
+		t.Fatalf("error reading mirrored secret: %v", err)
+	}
+	plaintext := &fi.Secret{}
+	if err := json.Unmarshal(data, plaintext); err != nil || string(plaintext.Data) != "password" {
+		t.Errorf("unexpected unencrypted mirror: %s, %v", data, err)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/golang/glog"
 	"k8s.io/kops/pkg/acls"
 	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/envelope"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/util/pkg/vfs"
 )
@@ -32,6 +33,9 @@ import (
 type VFSSecretStore struct {
 	cluster *kops.Cluster
 	basedir vfs.Path
+
+	// encrypter, if set, encrypts the secrets before they are written, and decrypts them when they are read
+	encrypter *envelope.Encrypter
 }
 
 var _ fi.SecretStore = &VFSSecretStore{}
@@ -44,6 +48,17 @@ func NewVFSSecretStore(cluster *kops.Cluster, basedir vfs.Path) fi.SecretStore {
 	return c
 }
 
+// NewEncryptedVFSSecretStore builds a VFSSecretStore that encrypts the secrets it writes with the encrypter,
+// and only reads secrets that were encrypted with the same key encryption key.
+func NewEncryptedVFSSecretStore(cluster *kops.Cluster, basedir vfs.Path, encrypter *envelope.Encrypter) fi.SecretStore {
+	c := &VFSSecretStore{
+		cluster:   cluster,
+		basedir:   basedir,
+		encrypter: encrypter,
+	}
+	return c
+}
+
 func (c *VFSSecretStore) VFSPath() vfs.Path {
 	return c.basedir
 }
@@ -174,6 +189,10 @@ func (c *VFSSecretStore) loadSecret(p vfs.Path) (*fi.Secret, error) {
 			return nil, nil
 		}
 	}
+	data, err = envelope.DecryptStoreData(c.encrypter, data)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting secret from %q: %v", p, err)
+	}
 	s := &fi.Secret{}
 	err = json.Unmarshal(data, s)
 	if err != nil {
@@ -189,6 +208,13 @@ func (c *VFSSecretStore) createSecret(s *fi.Secret, p vfs.Path, acl vfs.ACL, rep
 		return fmt.Errorf("error serializing secret: %v", err)
 	}
 
+	if c.encrypter != nil {
+		data, err = c.encrypter.Encrypt(data)
+		if err != nil {
+			return fmt.Errorf("error encrypting secret: %v", err)
+		}
+	}
+
 	rs := bytes.NewReader(data)
 	if replace {
 		return p.WriteFile(rs, acl)
@@ -0,0 +1,91 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secrets
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/envelope"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestVFSSecretStoreEncrypted(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	dir, err := ioutil.TempDir("", "secretstore")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "kek")
+	if err := ioutil.WriteFile(keyPath, []byte(strings.Repeat("k", 32)), 0600); err != nil {
+		t.Fatalf("error writing key encryption key: %v", err)
+	}
+	encrypter, err := envelope.NewEncrypter("file://" + keyPath)
+	if err != nil {
+		t.Fatalf("error building encrypter: %v", err)
+	}
+
+	basePath, err := vfs.Context.BuildVfsPath("memfs://tests/secrets")
+	if err != nil {
+		t.Fatalf("error building vfspath: %v", err)
+	}
+
+	cluster := &kops.Cluster{}
+	s := NewEncryptedVFSSecretStore(cluster, basePath, encrypter)
+	if _, _, err := s.GetOrCreateSecret("admin", &fi.Secret{Data: []byte("password")}); err != nil {
+		t.Fatalf("error creating secret: %v", err)
+	}
+
+	data, err := basePath.Join("admin").ReadFile()
+	if err != nil {
+		t.Fatalf("error reading secret: %v", err)
+	}
+	if !envelope.IsEncrypted(data) || bytes.Contains(data, []byte("cGFzc3dvcmQ")) {
+		t.Fatalf("secret was not encrypted: %s", data)
+	}
+
+	// A store with the same key encryption key, like the one nodeup builds, can read the encrypted secret
+	secret, err := NewEncryptedVFSSecretStore(cluster, basePath, encrypter).FindSecret("admin")
+	if err != nil {
+		t.Fatalf("error reading secret: %v", err)
+	}
+	if secret == nil || string(secret.Data) != "password" {
+		t.Errorf("secret did not round-trip: %v", secret)
+	}
+
+	// A store that is not encrypted cannot
+	if _, err := NewVFSSecretStore(cluster, basePath).FindSecret("admin"); err == nil {
+		t.Errorf("expected error reading an encrypted secret from an unencrypted store")
+	}
+
+	// A plaintext secret is rejected by an encrypted store, because anyone who can write the store could have written it
+	if _, _, err := NewVFSSecretStore(cluster, basePath).GetOrCreateSecret("plaintext", &fi.Secret{Data: []byte("password")}); err != nil {
+		t.Fatalf("error creating secret: %v", err)
+	}
+	if _, err := s.FindSecret("plaintext"); err == nil {
+		t.Errorf("expected error reading a plaintext secret from an encrypted store")
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// SpecHash returns a hash of the specs of the cluster and its instance groups, which changes whenever the
+// configuration to apply changes.  Metadata and status are not part of the hash.
+func SpecHash(cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) (string, error) {
+	type instanceGroupSpec struct {
+		Name string                 `json:"name"`
+		Spec kops.InstanceGroupSpec `json:"spec"`
+	}
+	config := struct {
+		Cluster        kops.ClusterSpec    `json:"cluster"`
+		InstanceGroups []instanceGroupSpec `json:"instanceGroups"`
+	}{
+		Cluster: cluster.Spec,
+	}
+	for _, ig := range instanceGroups {
+		config.InstanceGroups = append(config.InstanceGroups, instanceGroupSpec{Name: ig.ObjectMeta.Name, Spec: ig.Spec})
+	}
+	sort.Slice(config.InstanceGroups, func(i, j int) bool { return config.InstanceGroups[i].Name < config.InstanceGroups[j].Name })
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("error serializing configuration of cluster %q: %v", cluster.ObjectMeta.Name, err)
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
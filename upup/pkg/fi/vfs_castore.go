@@ -34,6 +34,7 @@ import (
 	"k8s.io/kops/pkg/acls"
 	"k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/apis/kops/v1alpha2"
+	"k8s.io/kops/pkg/envelope"
 	"k8s.io/kops/pkg/kopscodecs"
 	"k8s.io/kops/pkg/pki"
 	"k8s.io/kops/pkg/sshcredentials"
@@ -51,6 +52,10 @@ type VFSCAStore struct {
 	// SerialGenerator is the function for generating certificate serial numbers
 	// It can be replaced for testing purposes.
 	SerialGenerator func() *big.Int
+
+	// Encrypter, if set, encrypts the private keys before they are written, and decrypts them when they are read.
+	// Private keys must be encrypted with the Encrypter's key encryption key if it is set, and must not be encrypted otherwise.
+	Encrypter *envelope.Encrypter
 }
 
 type cachedEntry struct {
@@ -243,10 +248,10 @@ func (c *VFSCAStore) parseKeysetYaml(data []byte) (*kops.Keyset, KeysetFormat, e
 	return keyset, KeysetFormat(gvk.Version), nil
 }
 
-// loadCertificatesBundle loads a keyset from the path
+// loadCertificatesBundle loads a keyset from the path, decrypting it if it holds private keys
 // Returns (nil, nil) if the file is not found
 // Bundles avoid the need for a list-files permission, which can be tricky on e.g. GCE
-func (c *VFSCAStore) loadKeysetBundle(p vfs.Path) (*keyset, error) {
+func (c *VFSCAStore) loadKeysetBundle(p vfs.Path, private bool) (*keyset, error) {
 	data, err := p.ReadFile()
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -256,6 +261,13 @@ func (c *VFSCAStore) loadKeysetBundle(p vfs.Path) (*keyset, error) {
 		}
 	}
 
+	if private {
+		data, err = envelope.DecryptStoreData(c.Encrypter, data)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting bundle %q: %v", p, err)
+		}
+	}
+
 	o, format, err := c.parseKeysetYaml(data)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing bundle %q: %v", p, err)
@@ -316,6 +328,13 @@ func (c *VFSCAStore) writeKeysetBundle(p vfs.Path, name string, keyset *keyset,
 		return err
 	}
 
+	if includePrivateKeyMaterial {
+		objectData, err = encryptPrivateKeyMaterial(c.Encrypter, objectData)
+		if err != nil {
+			return err
+		}
+	}
+
 	acl, err := acls.GetACL(p, c.cluster)
 	if err != nil {
 		return err
@@ -339,6 +358,18 @@ func serializeKeysetBundle(o *kops.Keyset) ([]byte, error) {
 	return objectData.Bytes(), nil
 }
 
+// encryptPrivateKeyMaterial encrypts data holding private keys with the encrypter, if it is not nil
+func encryptPrivateKeyMaterial(encrypter *envelope.Encrypter, data []byte) ([]byte, error) {
+	if encrypter == nil {
+		return data, nil
+	}
+	encrypted, err := encrypter.Encrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting private key material: %v", err)
+	}
+	return encrypted, nil
+}
+
 // removePrivateKeyMaterial returns a copy of the Keyset with the private key data removed
 func removePrivateKeyMaterial(o *kops.Keyset) *kops.Keyset {
 	copy := o.DeepCopy()
@@ -373,7 +404,7 @@ func (c *VFSCAStore) loadCertificates(p vfs.Path, useBundle bool) (*keyset, erro
 	// give on GCE / other clouds
 	if useBundle {
 		bundlePath := p.Join("keyset.yaml")
-		bundle, err := c.loadKeysetBundle(bundlePath)
+		bundle, err := c.loadKeysetBundle(bundlePath, false)
 		if !c.allowList {
 			return bundle, err
 		}
@@ -564,6 +595,11 @@ func (c *VFSCAStore) ListKeysets() ([]*kops.Keyset, error) {
 				continue
 			}
 
+			if strings.HasSuffix(tokens[1], ".yaml") {
+				// ignore bundle
+				continue
+			}
+
 			name := tokens[0]
 			keyset := keysets[name]
 			if keyset == nil {
@@ -637,7 +673,7 @@ func (c *VFSCAStore) MirrorTo(basedir vfs.Path) error {
 	}
 
 	for _, keyset := range keysets {
-		if err := mirrorKeyset(c.cluster, basedir, keyset); err != nil {
+		if err := mirrorKeyset(c.cluster, basedir, keyset, c.Encrypter); err != nil {
 			return err
 		}
 	}
@@ -656,8 +692,8 @@ func (c *VFSCAStore) MirrorTo(basedir vfs.Path) error {
 	return nil
 }
 
-// mirrorKeyset writes keyset bundles for the certificates & privatekeys
-func mirrorKeyset(cluster *kops.Cluster, basedir vfs.Path, keyset *kops.Keyset) error {
+// mirrorKeyset writes keyset bundles for the certificates & privatekeys, encrypting the privatekeys if encrypter is not nil
+func mirrorKeyset(cluster *kops.Cluster, basedir vfs.Path, keyset *kops.Keyset, encrypter *envelope.Encrypter) error {
 	primary := FindPrimary(keyset)
 	if primary == nil {
 		return fmt.Errorf("found keyset with no primary data: %s", keyset.Name)
@@ -687,6 +723,10 @@ func mirrorKeyset(cluster *kops.Cluster, basedir vfs.Path, keyset *kops.Keyset)
 			if err != nil {
 				return err
 			}
+			data, err = encryptPrivateKeyMaterial(encrypter, data)
+			if err != nil {
+				return err
+			}
 			p := basedir.Join("private", keyset.Name, "keyset.yaml")
 			acl, err := acls.GetACL(p, cluster)
 			if err != nil {
@@ -821,7 +861,7 @@ func (c *VFSCAStore) loadPrivateKeys(p vfs.Path, useBundle bool) (*keyset, error
 	// give on GCE / other clouds
 	if useBundle {
 		bundlePath := p.Join("keyset.yaml")
-		bundle, err := c.loadKeysetBundle(bundlePath)
+		bundle, err := c.loadKeysetBundle(bundlePath, true)
 
 		if !c.allowList {
 			return bundle, err
@@ -883,6 +923,10 @@ func (c *VFSCAStore) loadOnePrivateKey(p vfs.Path) (*pki.PrivateKey, error) {
 		}
 		return nil, err
 	}
+	data, err = envelope.DecryptStoreData(c.Encrypter, data)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting private key from %q: %v", p, err)
+	}
 	k, err := pki.ParsePEMPrivateKey(data)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing private key from %q: %v", p, err)
@@ -929,6 +973,10 @@ func (c *VFSCAStore) FindPrivateKeyset(name string) (*kops.Keyset, error) {
 		return nil, err
 	}
 
+	if keys == nil {
+		return nil, nil
+	}
+
 	o, err := keys.ToAPIObject(name, true)
 	if err != nil {
 		return nil, err
@@ -981,12 +1029,17 @@ func (c *VFSCAStore) storePrivateKey(name string, ki *keysetItem) error {
 			return err
 		}
 
+		encrypted, err := encryptPrivateKeyMaterial(c.Encrypter, data.Bytes())
+		if err != nil {
+			return err
+		}
+
 		p := c.buildPrivateKeyPath(name, ki.id)
 		acl, err := acls.GetACL(p, c.cluster)
 		if err != nil {
 			return err
 		}
-		return p.WriteFile(bytes.NewReader(data.Bytes()), acl)
+		return p.WriteFile(bytes.NewReader(encrypted), acl)
 	}
 }
 
@@ -1065,7 +1118,7 @@ func (c *VFSCAStore) deletePrivateKey(name string, id string) (bool, error) {
 func (c *VFSCAStore) deleteCertificate(name string, id string) (bool, error) {
 	// Update the bundle
 	{
-		p := c.buildPrivateKeyPoolPath(name)
+		p := c.buildCertificatePoolPath(name)
 		ks, err := c.loadCertificates(p, false)
 		if err != nil {
 			return false, err
@@ -1154,6 +1207,10 @@ func (c *VFSCAStore) loadData(p vfs.Path) (*pki.PrivateKey, error) {
 		}
 		return nil, err
 	}
+	data, err = envelope.DecryptStoreData(c.Encrypter, data)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting private key from %q: %v", p, err)
+	}
 	k, err := pki.ParsePEMPrivateKey(data)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing private key from %q: %v", p, err)
@@ -17,12 +17,17 @@ limitations under the License.
 package fi
 
 import (
+	"io/ioutil"
 	"math/big"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/envelope"
 	"k8s.io/kops/pkg/pki"
 	"k8s.io/kops/util/pkg/vfs"
 )
@@ -215,3 +220,100 @@ spec:
 	}
 
 }
+
+func TestVFSCAStoreEncrypted(t *testing.T) {
+	vfs.Context.ResetMemfsContext(true)
+
+	dir, err := ioutil.TempDir("", "castore")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "kek")
+	if err := ioutil.WriteFile(keyPath, []byte(strings.Repeat("k", 32)), 0600); err != nil {
+		t.Fatalf("error writing key encryption key: %v", err)
+	}
+	encrypter, err := envelope.NewEncrypter("file://" + keyPath)
+	if err != nil {
+		t.Fatalf("error building encrypter: %v", err)
+	}
+
+	basePath, err := vfs.Context.BuildVfsPath("memfs://tests")
+	if err != nil {
+		t.Fatalf("error building vfspath: %v", err)
+	}
+
+	cluster := &kops.Cluster{}
+	s := NewVFSCAStore(cluster, basePath, false)
+	s.Encrypter = encrypter
+
+	privateKey, err := pki.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("error generating private key: %v", err)
+	}
+	cert, err := pki.SignNewCertificate(privateKey, BuildCAX509Template(), nil, nil)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	if err := s.StoreKeypair("ca", cert, privateKey); err != nil {
+		t.Fatalf("error from StoreKeypair: %v", err)
+	}
+
+	mirrorPath, err := vfs.Context.BuildVfsPath("memfs://mirror")
+	if err != nil {
+		t.Fatalf("error building vfspath: %v", err)
+	}
+	if err := s.MirrorTo(mirrorPath); err != nil {
+		t.Fatalf("error from MirrorTo: %v", err)
+	}
+
+	// Private keys are encrypted, in the store and in the mirror; certificates are not
+	for _, base := range []vfs.Path{basePath, mirrorPath} {
+		paths, err := base.ReadTree()
+		if err != nil {
+			t.Fatalf("error from ReadTree: %v", err)
+		}
+		for _, p := range paths {
+			data, err := p.ReadFile()
+			if err != nil {
+				if os.IsNotExist(err) {
+					// A directory
+					continue
+				}
+				t.Fatalf("error reading %s: %v", p, err)
+			}
+			isPrivate := strings.Contains(p.Path(), "/private/")
+			if envelope.IsEncrypted(data) != isPrivate {
+				t.Errorf("expected encrypted=%v for %s", isPrivate, p)
+			}
+		}
+	}
+
+	// A store that is not encrypted cannot read the encrypted keys
+	if _, _, _, err := NewVFSCAStore(cluster, basePath, false).FindKeypair("ca"); err == nil {
+		t.Errorf("expected error reading an encrypted private key from an unencrypted store")
+	}
+
+	// A store with the same key encryption key, like the one nodeup builds, can
+	reader := NewVFSCAStore(cluster, basePath, false)
+	reader.Encrypter = encrypter
+	_, key, _, err := reader.FindKeypair("ca")
+	if err != nil {
+		t.Fatalf("error from FindKeypair: %v", err)
+	}
+	if key == nil {
+		t.Fatalf("private key not found")
+	}
+	expected, err := privateKey.AsString()
+	if err != nil {
+		t.Fatalf("error serializing private key: %v", err)
+	}
+	actual, err := key.AsString()
+	if err != nil {
+		t.Fatalf("error serializing private key: %v", err)
+	}
+	if actual != expected {
+		t.Errorf("private key did not round-trip")
+	}
+}
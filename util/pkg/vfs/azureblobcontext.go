@@ -0,0 +1,264 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// azureBlobAPIVersion is the version of the blob service REST API we use
+const azureBlobAPIVersion = "2017-07-29"
+
+var azureBlobBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   1.5,
+	Jitter:   0.1,
+	Steps:    5,
+}
+
+// AzureBlobClient is a client for the Azure Blob Storage REST API of a storage account
+type AzureBlobClient struct {
+	// endpoint is the blob service endpoint, normally https://<account>.blob.core.windows.net
+	endpoint *url.URL
+	account  string
+	// key is the decoded shared key of the account; if nil, sasToken is used
+	key []byte
+	// sasToken is a shared access signature, appended to every request
+	sasToken url.Values
+
+	httpClient *http.Client
+}
+
+// NewAzureBlobClient builds a client for the storage account in AZURE_STORAGE_ACCOUNT, authenticating with the
+// shared key in AZURE_STORAGE_KEY, or the shared access signature in AZURE_STORAGE_SAS_TOKEN.
+// The blob service endpoint can be overridden with AZURE_STORAGE_ENDPOINT, for example for sovereign clouds or the storage emulator.
+func NewAzureBlobClient() (*AzureBlobClient, error) {
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	if account == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT must be set to use azureblob:// paths")
+	}
+
+	endpoint := os.Getenv("AZURE_STORAGE_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://" + account + ".blob.core.windows.net"
+	}
+
+	return newAzureBlobClient(endpoint, account, os.Getenv("AZURE_STORAGE_KEY"), os.Getenv("AZURE_STORAGE_SAS_TOKEN"))
+}
+
+func newAzureBlobClient(endpoint string, account string, key string, sasToken string) (*AzureBlobClient, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid azure blob storage endpoint %q", endpoint)
+	}
+
+	c := &AzureBlobClient{
+		endpoint:   u,
+		account:    account,
+		httpClient: http.DefaultClient,
+	}
+
+	if key != "" {
+		c.key, err = base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("AZURE_STORAGE_KEY is not a valid base64 encoded key")
+		}
+	} else if sasToken != "" {
+		c.sasToken, err = url.ParseQuery(strings.TrimPrefix(sasToken, "?"))
+		if err != nil {
+			return nil, fmt.Errorf("AZURE_STORAGE_SAS_TOKEN is not a valid shared access signature: %v", err)
+		}
+	} else {
+		return nil, fmt.Errorf("AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN must be set to use azureblob:// paths")
+	}
+
+	return c, nil
+}
+
+// azureBlobError is an error response from the blob service
+type azureBlobError struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *azureBlobError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("azure blob storage returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("azure blob storage returned status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// azureBlobStatusCode returns the HTTP status code of an error response from the blob service, or 0
+func azureBlobStatusCode(err error) int {
+	if e, ok := err.(*azureBlobError); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// do performs a request against a container, or a blob if key is not empty, retrying on server errors.
+// A response with a status of 300 or above is returned as an *azureBlobError.
+func (c *AzureBlobClient) do(method string, container string, key string, query url.Values, header http.Header, body []byte) (*http.Response, []byte, error) {
+	u := *c.endpoint
+	u.Path = u.Path + "/" + container
+	if key != "" {
+		u.Path += "/" + key
+	}
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	for k, v := range c.sasToken {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	var response *http.Response
+	var responseBody []byte
+	done, err := RetryWithBackoff(azureBlobBackoff, func() (bool, error) {
+		req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			return true, err
+		}
+		req.ContentLength = int64(len(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+		req.Header.Set("x-ms-version", azureBlobAPIVersion)
+		if c.key != nil {
+			req.Header.Set("Authorization", "SharedKey "+c.account+":"+c.signature(req))
+		}
+
+		glog.V(8).Infof("Performing azure blob request %s %s", method, u.Path)
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return false, fmt.Errorf("error performing %s %s: %v", method, u.Path, err)
+		}
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return false, fmt.Errorf("error reading response to %s %s: %v", method, u.Path, err)
+		}
+
+		if resp.StatusCode >= 300 {
+			blobErr := &azureBlobError{StatusCode: resp.StatusCode}
+			if len(b) != 0 {
+				// The body is not always returned (for example on HEAD), so this is best-effort
+				xml.Unmarshal(b, blobErr)
+			}
+			if blobErr.Code == "" {
+				blobErr.Code = resp.Header.Get("x-ms-error-code")
+			}
+			if resp.StatusCode >= 500 {
+				return false, blobErr
+			}
+			return true, blobErr
+		}
+
+		response = resp
+		responseBody = b
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	} else if done {
+		return response, responseBody, nil
+	} else {
+		// Shouldn't happen - we always return a non-nil error with false
+		return nil, nil, wait.ErrWaitTimeout
+	}
+}
+
+// signature computes the Shared Key signature of the request, as described in
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (c *AzureBlobClient) signature(req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	h := req.Header
+	var b bytes.Buffer
+	for _, s := range []string{
+		req.Method,
+		h.Get("Content-Encoding"),
+		h.Get("Content-Language"),
+		contentLength,
+		h.Get("Content-MD5"),
+		h.Get("Content-Type"),
+		// Date is empty because we send x-ms-date
+		"",
+		h.Get("If-Modified-Since"),
+		h.Get("If-Match"),
+		h.Get("If-None-Match"),
+		h.Get("If-Unmodified-Since"),
+		h.Get("Range"),
+	} {
+		b.WriteString(s)
+		b.WriteString("\n")
+	}
+
+	// Canonicalized headers
+	var msHeaders []string
+	for k := range h {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-ms-") {
+			msHeaders = append(msHeaders, k)
+		}
+	}
+	sort.Strings(msHeaders)
+	for _, k := range msHeaders {
+		b.WriteString(k + ":" + strings.TrimSpace(h.Get(k)) + "\n")
+	}
+
+	// Canonicalized resource
+	b.WriteString("/" + c.account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	var names []string
+	for k := range query {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		values := query[k]
+		sort.Strings(values)
+		b.WriteString("\n" + strings.ToLower(k) + ":" + strings.Join(values, ","))
+	}
+
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(b.Bytes())
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
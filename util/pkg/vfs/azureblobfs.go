@@ -0,0 +1,303 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/util/pkg/hashing"
+)
+
+// AzureBlobPath is a vfs path for Azure Blob Storage, of the form azureblob://<container>/<key>
+type AzureBlobPath struct {
+	client    *AzureBlobClient
+	container string
+	key       string
+	// md5Hash is the base64 encoded MD5 of the contents, if known from a listing
+	md5Hash string
+}
+
+var _ Path = &AzureBlobPath{}
+var _ HasHash = &AzureBlobPath{}
+var _ VersionedPath = &AzureBlobPath{}
+
+// NewAzureBlobPath returns the path of a blob in a container
+func NewAzureBlobPath(client *AzureBlobClient, container string, key string) *AzureBlobPath {
+	container = strings.TrimSuffix(container, "/")
+	key = strings.TrimPrefix(key, "/")
+
+	return &AzureBlobPath{
+		client:    client,
+		container: container,
+		key:       key,
+	}
+}
+
+func (p *AzureBlobPath) Path() string {
+	return "azureblob://" + p.container + "/" + p.key
+}
+
+func (p *AzureBlobPath) Container() string {
+	return p.container
+}
+
+func (p *AzureBlobPath) Key() string {
+	return p.key
+}
+
+func (p *AzureBlobPath) String() string {
+	return p.Path()
+}
+
+func (p *AzureBlobPath) Remove() error {
+	glog.V(8).Infof("removing file %s", p)
+
+	_, _, err := p.client.do(http.MethodDelete, p.container, p.key, nil, nil, nil)
+	if err != nil {
+		if azureBlobStatusCode(err) == http.StatusNotFound {
+			return os.ErrNotExist
+		}
+		return fmt.Errorf("error deleting %s: %v", p, err)
+	}
+
+	return nil
+}
+
+func (p *AzureBlobPath) Join(relativePath ...string) Path {
+	args := []string{p.key}
+	args = append(args, relativePath...)
+	joined := path.Join(args...)
+	return &AzureBlobPath{
+		client:    p.client,
+		container: p.container,
+		key:       joined,
+	}
+}
+
+func (p *AzureBlobPath) WriteFile(data io.ReadSeeker, acl ACL) error {
+	_, err := p.WriteFileVersion(data, acl, "")
+	return err
+}
+
+// WriteFileVersion implements VersionedPath::WriteFileVersion; the version is the ETag of the blob,
+// which is sent as an If-Match precondition, or as If-None-Match: * for VersionNotExist
+func (p *AzureBlobPath) WriteFileVersion(data io.ReadSeeker, acl ACL, version string) (string, error) {
+	header := http.Header{}
+	if version == VersionNotExist {
+		header.Set("If-None-Match", "*")
+	} else if version != "" {
+		header.Set("If-Match", version)
+	}
+	etag, err := p.put(data, acl, header)
+	if err != nil {
+		if code := azureBlobStatusCode(err); version != "" && (code == http.StatusPreconditionFailed || code == http.StatusConflict) {
+			return "", &ConflictError{Path: p.Path()}
+		}
+		return "", fmt.Errorf("error writing %s: %v", p, err)
+	}
+	return etag, nil
+}
+
+// CreateFile implements Path::CreateFile; the blob service checks that the blob does not exist as part of the write
+func (p *AzureBlobPath) CreateFile(data io.ReadSeeker, acl ACL) error {
+	header := http.Header{}
+	header.Set("If-None-Match", "*")
+	if _, err := p.put(data, acl, header); err != nil {
+		if code := azureBlobStatusCode(err); code == http.StatusConflict || code == http.StatusPreconditionFailed {
+			return os.ErrExist
+		}
+		return fmt.Errorf("error writing %s: %v", p, err)
+	}
+	return nil
+}
+
+// put uploads the contents as a block blob in a single request, returning the ETag of the blob
+func (p *AzureBlobPath) put(data io.ReadSeeker, acl ACL, header http.Header) (string, error) {
+	if acl != nil {
+		// Blob storage has no per-blob ACLs; public access is configured on the container
+		return "", fmt.Errorf("write to %s with ACL of unexpected type %T", p, acl)
+	}
+
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", fmt.Errorf("error reading data: %v", err)
+	}
+
+	md5Hash := md5.Sum(b)
+	header.Set("x-ms-blob-type", "BlockBlob")
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Hash[:]))
+
+	glog.V(8).Infof("Writing azure blob Container=%q Key=%q", p.container, p.key)
+	response, _, err := p.client.do(http.MethodPut, p.container, p.key, nil, header, b)
+	if err != nil {
+		return "", err
+	}
+	return response.Header.Get("ETag"), nil
+}
+
+// ReadFile implements Path::ReadFile
+func (p *AzureBlobPath) ReadFile() ([]byte, error) {
+	data, _, err := p.ReadFileVersion()
+	return data, err
+}
+
+// ReadFileVersion implements VersionedPath::ReadFileVersion; the version is the ETag of the blob
+func (p *AzureBlobPath) ReadFileVersion() ([]byte, string, error) {
+	response, body, err := p.client.do(http.MethodGet, p.container, p.key, nil, nil, nil)
+	if err != nil {
+		if azureBlobStatusCode(err) == http.StatusNotFound {
+			return nil, "", os.ErrNotExist
+		}
+		return nil, "", fmt.Errorf("error reading %s: %v", p, err)
+	}
+	return body, response.Header.Get("ETag"), nil
+}
+
+// WriteTo implements io.WriterTo
+func (p *AzureBlobPath) WriteTo(out io.Writer) (int64, error) {
+	data, err := p.ReadFile()
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, bytes.NewReader(data))
+	return n, err
+}
+
+// ReadDir implements Path::ReadDir, listing the blobs directly under the path
+func (p *AzureBlobPath) ReadDir() ([]Path, error) {
+	prefix := p.key
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	paths, err := p.list(prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+	glog.V(8).Infof("Listed files in %v: %v", p, paths)
+	return paths, nil
+}
+
+// ReadTree implements Path::ReadTree, listing all the blobs under the path
+func (p *AzureBlobPath) ReadTree() ([]Path, error) {
+	prefix := p.key
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	// No delimiter for recursive search
+	return p.list(prefix, "")
+}
+
+// azureBlobList is the response to the List Blobs operation
+type azureBlobList struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			ContentMD5 string `xml:"Content-MD5"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// list returns the blobs with the prefix, following continuation markers
+func (p *AzureBlobPath) list(prefix string, delimiter string) ([]Path, error) {
+	glog.V(4).Infof("Listing blobs in azure container %q with prefix %q", p.container, prefix)
+
+	var paths []Path
+	marker := ""
+	for {
+		query := url.Values{}
+		query.Set("restype", "container")
+		query.Set("comp", "list")
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+
+		_, body, err := p.client.do(http.MethodGet, p.container, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %v", p, err)
+		}
+
+		list := &azureBlobList{}
+		if err := xml.Unmarshal(body, list); err != nil {
+			return nil, fmt.Errorf("error parsing listing of %s: %v", p, err)
+		}
+
+		for _, blob := range list.Blobs {
+			if blob.Name == prefix {
+				// Tolerate a directory that was created as a blob, as we do for S3
+				glog.V(4).Infof("Skipping read of directory: %q", blob.Name)
+				continue
+			}
+			paths = append(paths, &AzureBlobPath{
+				client:    p.client,
+				container: p.container,
+				key:       blob.Name,
+				md5Hash:   blob.Properties.ContentMD5,
+			})
+		}
+
+		if list.NextMarker == "" {
+			return paths, nil
+		}
+		marker = list.NextMarker
+	}
+}
+
+func (p *AzureBlobPath) Base() string {
+	return path.Base(p.key)
+}
+
+func (p *AzureBlobPath) PreferredHash() (*hashing.Hash, error) {
+	return p.Hash(hashing.HashAlgorithmMD5)
+}
+
+func (p *AzureBlobPath) Hash(a hashing.HashAlgorithm) (*hashing.Hash, error) {
+	if a != hashing.HashAlgorithmMD5 {
+		return nil, nil
+	}
+
+	if p.md5Hash == "" {
+		return nil, nil
+	}
+
+	md5Bytes, err := base64.StdEncoding.DecodeString(p.md5Hash)
+	if err != nil {
+		return nil, fmt.Errorf("Content-MD5 was not a valid MD5 sum: %q", p.md5Hash)
+	}
+
+	return &hashing.Hash{Algorithm: hashing.HashAlgorithmMD5, HashValue: md5Bytes}, nil
+}
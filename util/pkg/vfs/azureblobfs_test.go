@@ -0,0 +1,322 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testAzureKey = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+
+func TestAzureBlobSignature(t *testing.T) {
+	client, err := newAzureBlobClient("https://myaccount.blob.core.windows.net", "myaccount", testAzureKey, "")
+	if err != nil {
+		t.Fatalf("error building client: %v", err)
+	}
+
+	grid := []struct {
+		Method   string
+		URL      string
+		Header   map[string]string
+		Body     string
+		Expected string
+	}{
+		{
+			Method: "PUT",
+			URL:    "https://myaccount.blob.core.windows.net/mycontainer/cluster.example.com/config",
+			Header: map[string]string{
+				"Content-MD5":    "XrY7u+Ae7tCTyyK7j1rNww==",
+				"If-Match":       "\"0x1\"",
+				"x-ms-blob-type": "BlockBlob",
+			},
+			Body:     "hello world",
+			Expected: "gLR4zlCmgDrMu12fvsZnMZfsZDIECDKb+K8uedJKvEE=",
+		},
+		{
+			Method:   "GET",
+			URL:      "https://myaccount.blob.core.windows.net/mycontainer?restype=container&comp=list&prefix=cluster.example.com%2F&delimiter=%2F",
+			Expected: "2KWS5DjqHHQpjM8fLOah5Rwd+Xb6batO2wP+uUNWRCU=",
+		},
+	}
+
+	for _, g := range grid {
+		req, err := http.NewRequest(g.Method, g.URL, bytes.NewReader([]byte(g.Body)))
+		if err != nil {
+			t.Fatalf("error building request: %v", err)
+		}
+		for k, v := range g.Header {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("x-ms-date", "Mon, 02 Jan 2006 15:04:05 GMT")
+		req.Header.Set("x-ms-version", azureBlobAPIVersion)
+
+		if actual := client.signature(req); actual != g.Expected {
+			t.Errorf("signature of %s %s: expected %q, got %q", g.Method, g.URL, g.Expected, actual)
+		}
+	}
+}
+
+// fakeBlobService is a stand-in for the blob service REST API of a single storage account
+type fakeBlobService struct {
+	t      *testing.T
+	client *AzureBlobClient
+
+	mutex   sync.Mutex
+	blobs   map[string][]byte
+	etags   map[string]string
+	version int
+}
+
+type fakeBlob struct {
+	Name string `xml:"Name"`
+	MD5  string `xml:"Properties>Content-MD5"`
+}
+
+type fakeBlobList struct {
+	XMLName    xml.Name   `xml:"EnumerationResults"`
+	Blobs      []fakeBlob `xml:"Blobs>Blob"`
+	NextMarker string     `xml:"NextMarker"`
+}
+
+func (s *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	expected := "SharedKey myaccount:" + s.client.signature(r)
+	if r.Header.Get("Authorization") != expected {
+		s.t.Errorf("unexpected Authorization for %s %s: %q", r.Method, r.URL, r.Header.Get("Authorization"))
+		writeBlobError(w, http.StatusForbidden, "AuthenticationFailed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	etag := s.etags[name]
+
+	switch {
+	case r.Method == "GET" && query.Get("comp") == "list":
+		s.list(w, name, query.Get("prefix"), query.Get("delimiter"), query.Get("marker"))
+
+	case r.Method == "GET":
+		data, found := s.blobs[name]
+		if !found {
+			writeBlobError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(data)
+
+	case r.Method == "PUT":
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			writeBlobError(w, http.StatusBadRequest, "InvalidHeaderValue")
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && etag != "" {
+			writeBlobError(w, http.StatusConflict, "BlobAlreadyExists")
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != etag {
+			writeBlobError(w, http.StatusPreconditionFailed, "ConditionNotMet")
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeBlobError(w, http.StatusBadRequest, "InvalidInput")
+			return
+		}
+		hash := md5.Sum(data)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(hash[:]) {
+			writeBlobError(w, http.StatusBadRequest, "Md5Mismatch")
+			return
+		}
+		s.version++
+		s.blobs[name] = data
+		s.etags[name] = "\"0x" + strconv.Itoa(s.version) + "\""
+		w.Header().Set("ETag", s.etags[name])
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == "DELETE":
+		if _, found := s.blobs[name]; !found {
+			writeBlobError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		delete(s.blobs, name)
+		delete(s.etags, name)
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		writeBlobError(w, http.StatusMethodNotAllowed, "UnsupportedHttpVerb")
+	}
+}
+
+// list returns at most 2 blobs per page, to exercise continuation markers
+func (s *fakeBlobService) list(w http.ResponseWriter, container string, prefix string, delimiter string, marker string) {
+	var names []string
+	for name := range s.blobs {
+		if !strings.HasPrefix(name, container+"/") {
+			continue
+		}
+		key := strings.TrimPrefix(name, container+"/")
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+		if delimiter != "" && strings.Contains(strings.TrimPrefix(key, prefix), delimiter) {
+			continue
+		}
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	list := &fakeBlobList{}
+	for i, key := range names {
+		if i == 2 {
+			list.NextMarker = names[1]
+			break
+		}
+		hash := md5.Sum(s.blobs[container+"/"+key])
+		list.Blobs = append(list.Blobs, fakeBlob{Name: key, MD5: base64.StdEncoding.EncodeToString(hash[:])})
+	}
+
+	b, err := xml.Marshal(list)
+	if err != nil {
+		writeBlobError(w, http.StatusInternalServerError, "InternalError")
+		return
+	}
+	w.Write(b)
+}
+
+func writeBlobError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"utf-8\"?><Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func newFakeBlobService(t *testing.T) (*httptest.Server, *AzureBlobClient) {
+	fake := &fakeBlobService{
+		t:     t,
+		blobs: make(map[string][]byte),
+		etags: make(map[string]string),
+	}
+	server := httptest.NewServer(fake)
+
+	client, err := newAzureBlobClient(server.URL, "myaccount", testAzureKey, "")
+	if err != nil {
+		t.Fatalf("error building client: %v", err)
+	}
+	fake.client = client
+	return server, client
+}
+
+func TestAzureBlobPath(t *testing.T) {
+	server, client := newFakeBlobService(t)
+	defer server.Close()
+
+	base := NewAzureBlobPath(client, "container", "/cluster.example.com")
+	if base.Path() != "azureblob://container/cluster.example.com" {
+		t.Errorf("unexpected path %q", base.Path())
+	}
+
+	config := base.Join("config")
+	if _, err := config.ReadFile(); !os.IsNotExist(err) {
+		t.Errorf("expected not exist reading missing blob, got %v", err)
+	}
+
+	if err := config.CreateFile(bytes.NewReader([]byte("hello world")), nil); err != nil {
+		t.Fatalf("error creating blob: %v", err)
+	}
+	if err := config.CreateFile(bytes.NewReader([]byte("again")), nil); !os.IsExist(err) {
+		t.Errorf("expected exists creating blob twice, got %v", err)
+	}
+	data, err := config.ReadFile()
+	if err != nil {
+		t.Fatalf("error reading blob: %v", err)
+	}
+	if string(data) != "hello world" {
+		t.Errorf("unexpected contents %q", data)
+	}
+
+	for _, key := range []string{"instancegroup/nodes", "instancegroup/master-us-east-1a", "instancegroup/bastions", "pki/issued/ca/keyset.yaml"} {
+		if err := base.Join(key).WriteFile(bytes.NewReader([]byte(key)), nil); err != nil {
+			t.Fatalf("error writing %s: %v", key, err)
+		}
+	}
+
+	children, err := base.Join("instancegroup").ReadDir()
+	if err != nil {
+		t.Fatalf("error listing blobs: %v", err)
+	}
+	var names []string
+	for _, child := range children {
+		names = append(names, child.Base())
+	}
+	if strings.Join(names, ",") != "bastions,master-us-east-1a,nodes" {
+		t.Errorf("unexpected blobs listed: %v", names)
+	}
+
+	tree, err := base.ReadTree()
+	if err != nil {
+		t.Fatalf("error listing blobs: %v", err)
+	}
+	if len(tree) != 5 {
+		t.Errorf("expected 5 blobs in tree, got %v", tree)
+	}
+	for _, p := range tree {
+		if p.Path() != config.Path() {
+			continue
+		}
+		hash, err := p.(HasHash).PreferredHash()
+		if err != nil {
+			t.Fatalf("error getting hash: %v", err)
+		}
+		expected := md5.Sum([]byte("hello world"))
+		if hash == nil || !bytes.Equal(hash.HashValue, expected[:]) {
+			t.Errorf("unexpected hash of %s: %v", p, hash)
+		}
+	}
+
+	if err := config.WriteFile(bytes.NewReader(nil), &S3Acl{}); err == nil {
+		t.Errorf("expected error writing with an ACL")
+	}
+
+	if err := config.Remove(); err != nil {
+		t.Fatalf("error removing blob: %v", err)
+	}
+	if err := config.Remove(); !os.IsNotExist(err) {
+		t.Errorf("expected not exist removing missing blob, got %v", err)
+	}
+}
+
+func TestAzureBlobConditionalWrites(t *testing.T) {
+	server, client := newFakeBlobService(t)
+	defer server.Close()
+
+	testConditionalWrites(t, NewAzureBlobPath(client, "container", "cluster.example.com/config"))
+	testWritesAtVersionNotExist(t, NewAzureBlobPath(client, "container", "cluster.example.com/created"))
+}
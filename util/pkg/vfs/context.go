@@ -40,12 +40,14 @@ type VFSContext struct {
 	s3Context    *S3Context
 	k8sContext   *KubernetesContext
 	memfsContext *MemFSContext
-	// mutex guards gcsClient
+	// mutex guards gcsClient and azureBlobClient
 	mutex sync.Mutex
 	// The google cloud storage client, if initialized
 	gcsClient *storage.Service
 	// swiftClient is the openstack swift client
 	swiftClient *gophercloud.ServiceClient
+	// azureBlobClient is the azure blob storage client, if initialized
+	azureBlobClient *AzureBlobClient
 }
 
 var Context = VFSContext{
@@ -125,6 +127,10 @@ func (c *VFSContext) BuildVfsPath(p string) (Path, error) {
 		return c.buildOpenstackSwiftPath(p)
 	}
 
+	if strings.HasPrefix(p, "azureblob://") {
+		return c.buildAzureBlobPath(p)
+	}
+
 	return nil, fmt.Errorf("unknown / unhandled path type: %q", p)
 }
 
@@ -348,3 +354,44 @@ func (c *VFSContext) buildOpenstackSwiftPath(p string) (*SwiftPath, error) {
 
 	return NewSwiftPath(c.swiftClient, bucket, u.Path)
 }
+
+func (c *VFSContext) buildAzureBlobPath(p string) (*AzureBlobPath, error) {
+	u, err := url.Parse(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure blob storage path: %q", p)
+	}
+
+	if u.Scheme != "azureblob" {
+		return nil, fmt.Errorf("invalid azure blob storage path: %q", p)
+	}
+
+	container := strings.TrimSuffix(u.Host, "/")
+	if container == "" {
+		return nil, fmt.Errorf("invalid azure blob storage path: %q", p)
+	}
+
+	client, err := c.getAzureBlobClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAzureBlobPath(client, container, u.Path), nil
+}
+
+// getAzureBlobClient returns the azure blob storage client, caching it for future calls
+func (c *VFSContext) getAzureBlobClient() (*AzureBlobClient, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.azureBlobClient != nil {
+		return c.azureBlobClient, nil
+	}
+
+	client, err := NewAzureBlobClient()
+	if err != nil {
+		return nil, err
+	}
+
+	c.azureBlobClient = client
+	return client, nil
+}
@@ -17,12 +17,13 @@ limitations under the License.
 package vfs
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
-	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"k8s.io/kops/util/pkg/hashing"
@@ -34,6 +35,7 @@ type FSPath struct {
 
 var _ Path = &FSPath{}
 var _ HasHash = &FSPath{}
+var _ VersionedPath = &FSPath{}
 
 func NewFSPath(location string) *FSPath {
 	return &FSPath{location: location}
@@ -47,15 +49,30 @@ func (p *FSPath) Join(relativePath ...string) Path {
 }
 
 func (p *FSPath) WriteFile(data io.ReadSeeker, acl ACL) error {
+	tempfile, err := p.writeTempFile(data)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tempfile, p.location)
+	if err != nil {
+		err = fmt.Errorf("error during file write of %q: rename failed: %v", p.location, err)
+		removeTempFile(tempfile)
+	}
+	return err
+}
+
+// writeTempFile writes the data to a temp file in the directory of p, so that it can be renamed into place
+func (p *FSPath) writeTempFile(data io.Reader) (string, error) {
 	dir := path.Dir(p.location)
 	err := os.MkdirAll(dir, 0755)
 	if err != nil {
-		return fmt.Errorf("error creating directories %q: %v", dir, err)
+		return "", fmt.Errorf("error creating directories %q: %v", dir, err)
 	}
 
 	f, err := ioutil.TempFile(dir, "tmp")
 	if err != nil {
-		return fmt.Errorf("error creating temp file in %q: %v", dir, err)
+		return "", fmt.Errorf("error creating temp file in %q: %v", dir, err)
 	}
 
 	// Note from here on in we have to close f and delete or rename the temp file
@@ -67,46 +84,143 @@ func (p *FSPath) WriteFile(data io.ReadSeeker, acl ACL) error {
 		err = closeErr
 	}
 
-	if err == nil {
-		err = os.Rename(tempfile, p.location)
-		if err != nil {
-			err = fmt.Errorf("error during file write of %q: rename failed: %v", p.location, err)
-		}
+	if err != nil {
+		// Something went wrong; try to remove the temp file
+		removeTempFile(tempfile)
+		return "", fmt.Errorf("error writing temp file %q: %v", tempfile, err)
 	}
+	return tempfile, nil
+}
 
-	if err == nil {
-		return nil
+func removeTempFile(tempfile string) {
+	if err := os.Remove(tempfile); err != nil {
+		glog.Warningf("unable to remove temp file %q: %v", tempfile, err)
 	}
+}
 
-	// Something went wrong; try to remove the temp file
-	if removeErr := os.Remove(tempfile); removeErr != nil {
-		glog.Warningf("unable to remove temp file %q: %v", tempfile, removeErr)
+// CreateFile implements Path::CreateFile
+func (p *FSPath) CreateFile(data io.ReadSeeker, acl ACL) error {
+	_, err := p.WriteFileVersion(data, acl, VersionNotExist)
+	if IsConflict(err) {
+		return os.ErrExist
 	}
-
 	return err
 }
 
-// To prevent concurrent creates on the same file while maintaining atomicity of writes,
-// we take a process-wide lock during the operation.
-// Not a great approach, but fine for a single process (with low concurrency)
-// TODO: should we take a file lock or equivalent here?  Can we use RENAME_NOREPLACE ?
-var createFileLock sync.Mutex
+// fsLockWait is how long a conditional write waits for a concurrent conditional write of the same file
+const fsLockWait = 10 * time.Second
 
-func (p *FSPath) CreateFile(data io.ReadSeeker, acl ACL) error {
-	createFileLock.Lock()
-	defer createFileLock.Unlock()
+// fsLockStale is the age after which the lock file of a conditional write is assumed to have been left
+// behind by a writer that did not finish, and is removed
+const fsLockStale = time.Minute
 
-	// Check if exists
-	_, err := os.Stat(p.location)
-	if err == nil {
-		return os.ErrExist
+// lock takes the lock that serializes conditional writes of the file, which is a lock file next to it
+// that is created exclusively.  It returns a function that releases the lock.
+func (p *FSPath) lock() (func(), error) {
+	lockfile := p.location + ".lock"
+	dir := path.Dir(lockfile)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating directories %q: %v", dir, err)
 	}
 
-	if !os.IsNotExist(err) {
-		return err
+	deadline := time.Now().Add(fsLockWait)
+	for {
+		f, err := os.OpenFile(lockfile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			if err := f.Close(); err != nil {
+				glog.Warningf("error closing lock file %q: %v", lockfile, err)
+			}
+			return func() {
+				if err := os.Remove(lockfile); err != nil {
+					glog.Warningf("unable to remove lock file %q: %v", lockfile, err)
+				}
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("error creating lock file %q: %v", lockfile, err)
+		}
+
+		if stat, err := os.Stat(lockfile); err == nil && time.Since(stat.ModTime()) > fsLockStale {
+			glog.Warningf("removing stale lock file %q", lockfile)
+			if err := os.Remove(lockfile); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("error removing stale lock file %q: %v", lockfile, err)
+			}
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout waiting for lock file %q; remove it if no other write is in progress", lockfile)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// ReadFileVersion implements VersionedPath::ReadFileVersion
+// The version is the hash of the contents.
+func (p *FSPath) ReadFileVersion() ([]byte, string, error) {
+	data, err := p.ReadFile()
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentVersion(data), nil
+}
+
+// WriteFileVersion implements VersionedPath::WriteFileVersion
+// Conditional writes hold a lock file while they compare the version and rename the new contents into place,
+// and a file is created at VersionNotExist by hard-linking it, which fails if the file exists.
+func (p *FSPath) WriteFileVersion(data io.ReadSeeker, acl ACL, version string) (string, error) {
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", fmt.Errorf("error reading data: %v", err)
+	}
+
+	if version == "" {
+		if err := p.WriteFile(bytes.NewReader(b), acl); err != nil {
+			return "", err
+		}
+		return contentVersion(b), nil
+	}
+
+	unlock, err := p.lock()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	tempfile, err := p.writeTempFile(bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+
+	if version == VersionNotExist {
+		err := os.Link(tempfile, p.location)
+		removeTempFile(tempfile)
+		if err != nil {
+			if os.IsExist(err) {
+				return "", &ConflictError{Path: p.Path()}
+			}
+			return "", fmt.Errorf("error creating %q: %v", p.location, err)
+		}
+		return contentVersion(b), nil
 	}
 
-	return p.WriteFile(data, acl)
+	current, err := p.ReadFile()
+	if err == nil && contentVersion(current) != version {
+		err = &ConflictError{Path: p.Path()}
+	} else if os.IsNotExist(err) {
+		err = &ConflictError{Path: p.Path()}
+	}
+	if err == nil {
+		err = os.Rename(tempfile, p.location)
+		if err != nil {
+			err = fmt.Errorf("error during file write of %q: rename failed: %v", p.location, err)
+		}
+	}
+	if err != nil {
+		removeTempFile(tempfile)
+		return "", err
+	}
+	return contentVersion(b), nil
 }
 
 // ReadFile implements Path::ReadFile
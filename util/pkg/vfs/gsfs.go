@@ -25,6 +25,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -46,6 +47,7 @@ type GSPath struct {
 }
 
 var _ Path = &GSPath{}
+var _ VersionedPath = &GSPath{}
 var _ HasHash = &GSPath{}
 
 // gcsReadBackoff is the backoff strategy for GCS read retries
@@ -136,6 +138,23 @@ func (p *GSPath) Join(relativePath ...string) Path {
 }
 
 func (p *GSPath) WriteFile(data io.ReadSeeker, acl ACL) error {
+	_, err := p.WriteFileVersion(data, acl, "")
+	return err
+}
+
+// WriteFileVersion implements VersionedPath::WriteFileVersion; the version is the generation of the object,
+// which is passed as an ifGenerationMatch precondition.  A generation of 0 matches only if the object does not exist.
+func (p *GSPath) WriteFileVersion(data io.ReadSeeker, acl ACL, version string) (string, error) {
+	var generation int64
+	if version != "" && version != VersionNotExist {
+		g, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid generation %q for %s", version, p)
+		}
+		generation = g
+	}
+
+	var newVersion string
 	done, err := RetryWithBackoff(gcsWriteBackoff, func() (bool, error) {
 		glog.V(4).Infof("Writing file %q", p)
 
@@ -161,20 +180,29 @@ func (p *GSPath) WriteFile(data io.ReadSeeker, acl ACL) error {
 			return false, fmt.Errorf("error seeking to start of data stream for write to %s: %v", p, err)
 		}
 
-		_, err = p.client.Objects.Insert(p.bucket, obj).Media(data).Do()
+		call := p.client.Objects.Insert(p.bucket, obj).Media(data)
+		if version != "" {
+			call = call.IfGenerationMatch(generation)
+		}
+		written, err := call.Do()
 		if err != nil {
+			if version != "" && isGCSPreconditionFailed(err) {
+				// Not recoverable
+				return true, &ConflictError{Path: p.Path()}
+			}
 			return false, fmt.Errorf("error writing %s: %v", p, err)
 		}
+		newVersion = strconv.FormatInt(written.Generation, 10)
 
 		return true, nil
 	})
 	if err != nil {
-		return err
+		return "", err
 	} else if done {
-		return nil
+		return newVersion, nil
 	} else {
 		// Shouldn't happen - we always return a non-nil error with false
-		return wait.ErrWaitTimeout
+		return "", wait.ErrWaitTimeout
 	}
 }
 
@@ -227,23 +255,57 @@ func (p *GSPath) ReadFile() ([]byte, error) {
 	}
 }
 
+// ReadFileVersion implements VersionedPath::ReadFileVersion; the version is the generation of the object
+func (p *GSPath) ReadFileVersion() ([]byte, string, error) {
+	var b bytes.Buffer
+	var generation string
+	done, err := RetryWithBackoff(gcsReadBackoff, func() (bool, error) {
+		b.Reset()
+		g, _, err := p.read(&b)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Not recoverable
+				return true, err
+			}
+			return false, err
+		}
+		generation = g
+		return true, nil
+	})
+	if err != nil {
+		return nil, "", err
+	} else if done {
+		return b.Bytes(), generation, nil
+	} else {
+		// Shouldn't happen - we always return a non-nil error with false
+		return nil, "", wait.ErrWaitTimeout
+	}
+}
+
 // WriteTo implements io.WriterTo::WriteTo
 func (p *GSPath) WriteTo(out io.Writer) (int64, error) {
+	_, n, err := p.read(out)
+	return n, err
+}
+
+// read copies the contents of the object to out, returning the generation of the object
+func (p *GSPath) read(out io.Writer) (string, int64, error) {
 	glog.V(4).Infof("Reading file %q", p)
 
 	response, err := p.client.Objects.Get(p.bucket, p.key).Download()
 	if err != nil {
 		if isGCSNotFound(err) {
-			return 0, os.ErrNotExist
+			return "", 0, os.ErrNotExist
 		}
-		return 0, fmt.Errorf("error reading %s: %v", p, err)
+		return "", 0, fmt.Errorf("error reading %s: %v", p, err)
 	}
 	if response == nil {
-		return 0, fmt.Errorf("no response returned from reading %s", p)
+		return "", 0, fmt.Errorf("no response returned from reading %s", p)
 	}
 	defer response.Body.Close()
 
-	return io.Copy(out, response.Body)
+	n, err := io.Copy(out, response.Body)
+	return response.Header.Get("X-Goog-Generation"), n, err
 }
 
 // ReadDir implements Path::ReadDir
@@ -359,6 +421,14 @@ func (p *GSPath) Hash(a hashing.HashAlgorithm) (*hashing.Hash, error) {
 	return &hashing.Hash{Algorithm: hashing.HashAlgorithmMD5, HashValue: md5Bytes}, nil
 }
 
+func isGCSPreconditionFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+	ae, ok := err.(*googleapi.Error)
+	return ok && ae.Code == http.StatusPreconditionFailed
+}
+
 func isGCSNotFound(err error) bool {
 	if err == nil {
 		return false
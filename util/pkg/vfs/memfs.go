@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -33,9 +34,12 @@ type MemFSPath struct {
 	mutex    sync.Mutex
 	contents []byte
 	children map[string]*MemFSPath
+	// version is incremented each time the contents are written or removed
+	version int64
 }
 
 var _ Path = &MemFSPath{}
+var _ VersionedPath = &MemFSPath{}
 
 type MemFSContext struct {
 	clusterReadable bool
@@ -95,12 +99,41 @@ func (p *MemFSPath) Join(relativePath ...string) Path {
 }
 
 func (p *MemFSPath) WriteFile(r io.ReadSeeker, acl ACL) error {
+	_, err := p.WriteFileVersion(r, acl, "")
+	return err
+}
+
+// WriteFileVersion implements VersionedPath::WriteFileVersion
+func (p *MemFSPath) WriteFileVersion(r io.ReadSeeker, acl ACL, version string) (string, error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
-		return fmt.Errorf("error reading data: %v", err)
+		return "", fmt.Errorf("error reading data: %v", err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if version == VersionNotExist {
+		if p.contents != nil {
+			return "", &ConflictError{Path: p.Path()}
+		}
+	} else if version != "" && (p.contents == nil || version != strconv.FormatInt(p.version, 10)) {
+		return "", &ConflictError{Path: p.Path()}
 	}
 	p.contents = data
-	return nil
+	p.version++
+	return strconv.FormatInt(p.version, 10), nil
+}
+
+// ReadFileVersion implements VersionedPath::ReadFileVersion
+func (p *MemFSPath) ReadFileVersion() ([]byte, string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.contents == nil {
+		return nil, "", os.ErrNotExist
+	}
+	return p.contents, strconv.FormatInt(p.version, 10), nil
 }
 
 func (p *MemFSPath) CreateFile(data io.ReadSeeker, acl ACL) error {
@@ -166,6 +199,10 @@ func (p *MemFSPath) String() string {
 }
 
 func (p *MemFSPath) Remove() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
 	p.contents = nil
+	p.version++
 	return nil
 }
@@ -0,0 +1,328 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// fakeS3Server is a minimal S3-compatible store, addressed by path, as a stand-in for MinIO or Ceph RGW
+type fakeS3Server struct {
+	accessKeyID string
+
+	mutex    sync.Mutex
+	objects  map[string][]byte
+	requests []string
+}
+
+type fakeS3Contents struct {
+	Key  string `xml:"Key"`
+	ETag string `xml:"ETag"`
+	Size int    `xml:"Size"`
+}
+
+type fakeS3Prefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type fakeS3ListBucketResult struct {
+	XMLName        xml.Name         `xml:"ListBucketResult"`
+	Name           string           `xml:"Name"`
+	Prefix         string           `xml:"Prefix"`
+	IsTruncated    bool             `xml:"IsTruncated"`
+	Contents       []fakeS3Contents `xml:"Contents"`
+	CommonPrefixes []fakeS3Prefix   `xml:"CommonPrefixes"`
+}
+
+func fakeS3ETag(data []byte) string {
+	hash := md5.Sum(data)
+	return "\"" + hex.EncodeToString(hash[:]) + "\""
+}
+
+func (s *fakeS3Server) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (s *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.Host+r.URL.Path)
+
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+s.accessKeyID+"/") {
+		s.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	tokens := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := tokens[0]
+	key := ""
+	if len(tokens) == 2 {
+		key = tokens[1]
+	}
+
+	if key == "" && r.Method == http.MethodGet {
+		prefix := r.URL.Query().Get("prefix")
+		delimiter := r.URL.Query().Get("delimiter")
+		result := &fakeS3ListBucketResult{Name: bucket, Prefix: prefix}
+		prefixes := make(map[string]bool)
+		var keys []string
+		for k := range s.objects {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			name := strings.TrimPrefix(k, bucket+"/")
+			if !strings.HasPrefix(k, bucket+"/") || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if delimiter != "" {
+				if i := strings.Index(name[len(prefix):], delimiter); i != -1 {
+					prefixes[name[:len(prefix)+i+1]] = true
+					continue
+				}
+			}
+			result.Contents = append(result.Contents, fakeS3Contents{Key: name, ETag: fakeS3ETag(s.objects[k]), Size: len(s.objects[k])})
+		}
+		for p := range prefixes {
+			result.CommonPrefixes = append(result.CommonPrefixes, fakeS3Prefix{Prefix: p})
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(result)
+		return
+	}
+
+	name := bucket + "/" + key
+	switch r.Method {
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			s.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			if existing, found := s.objects[name]; !found || fakeS3ETag(existing) != ifMatch {
+				s.error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+				return
+			}
+		}
+		if r.Header.Get("If-None-Match") == "*" {
+			if _, found := s.objects[name]; found {
+				s.error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+				return
+			}
+		}
+		s.objects[name] = data
+		w.Header().Set("ETag", fakeS3ETag(data))
+
+	case http.MethodGet, http.MethodHead:
+		data, found := s.objects[name]
+		if !found {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			s.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", fakeS3ETag(data))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+
+	case http.MethodDelete:
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// setS3Env sets the S3-compatible store environment variables, returning a function that restores them
+func setS3Env(env map[string]string) func() {
+	previous := make(map[string]string)
+	for _, k := range []string{"S3_ENDPOINT", "S3_REGION", "S3_ACCESS_KEY_ID", "S3_SECRET_ACCESS_KEY", "S3_FORCE_PATH_STYLE", "S3_CA_BUNDLE"} {
+		previous[k] = os.Getenv(k)
+		os.Setenv(k, env[k])
+	}
+	return func() {
+		for k, v := range previous {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func TestS3CompatibleEndpoint(t *testing.T) {
+	fake := &fakeS3Server{accessKeyID: "minio", objects: make(map[string][]byte)}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "s3")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	caBundle := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatalf("error writing CA bundle: %v", err)
+	}
+
+	defer setS3Env(map[string]string{
+		"S3_ENDPOINT":          server.URL,
+		"S3_ACCESS_KEY_ID":     "minio",
+		"S3_SECRET_ACCESS_KEY": "minio123",
+		"S3_CA_BUNDLE":         caBundle,
+	})()
+
+	base := newS3Path(NewS3Context(), "state", "cluster.example.com")
+	p := base.Join("config")
+	if _, err := p.ReadFile(); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist reading %s, got %v", p, err)
+	}
+	if err := p.WriteFile(bytes.NewReader([]byte("cluster")), nil); err != nil {
+		t.Fatalf("error writing %s: %v", p, err)
+	}
+	if data, err := p.ReadFile(); err != nil || string(data) != "cluster" {
+		t.Fatalf("unexpected result reading %s: %q, %v", p, data, err)
+	}
+	if err := base.Join("instancegroup", "nodes").WriteFile(bytes.NewReader([]byte("nodes")), nil); err != nil {
+		t.Fatalf("error writing instance group: %v", err)
+	}
+
+	tree, err := base.ReadTree()
+	if err != nil {
+		t.Fatalf("error reading tree: %v", err)
+	}
+	var names []string
+	for _, f := range tree {
+		names = append(names, f.Path())
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "s3://state/cluster.example.com/config,s3://state/cluster.example.com/instancegroup/nodes" {
+		t.Errorf("unexpected tree %v", names)
+	}
+
+	testConditionalWrites(t, base.Join("versioned"))
+	testWritesAtVersionNotExist(t, base.Join("created"))
+
+	if err := p.Remove(); err != nil {
+		t.Fatalf("error removing %s: %v", p, err)
+	}
+
+	// Requests are addressed by path, to the configured endpoint
+	for _, request := range fake.requests {
+		if !strings.Contains(request, strings.TrimPrefix(server.URL, "https://")+"/state") {
+			t.Errorf("request was not addressed by path to the endpoint: %s", request)
+		}
+	}
+}
+
+func TestS3CompatibleEndpointCertificate(t *testing.T) {
+	fake := &fakeS3Server{accessKeyID: "minio", objects: make(map[string][]byte)}
+	server := httptest.NewUnstartedServer(fake)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	// Without the CA bundle, the certificate of the endpoint is not trusted
+	defer setS3Env(map[string]string{
+		"S3_ENDPOINT":          server.URL,
+		"S3_ACCESS_KEY_ID":     "minio",
+		"S3_SECRET_ACCESS_KEY": "minio123",
+	})()
+
+	p := newS3Path(NewS3Context(), "state", "config")
+	if _, err := p.ReadFile(); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("expected certificate error, got %v", err)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("requests were made over an untrusted connection: %v", fake.requests)
+	}
+}
+
+func TestCustomS3Config(t *testing.T) {
+	grid := []struct {
+		Env               map[string]string
+		ExpectedPathStyle bool
+		ExpectError       string
+	}{
+		{
+			Env:               map[string]string{"S3_ACCESS_KEY_ID": "a", "S3_SECRET_ACCESS_KEY": "b"},
+			ExpectedPathStyle: true,
+		},
+		{
+			Env:               map[string]string{"S3_ACCESS_KEY_ID": "a", "S3_SECRET_ACCESS_KEY": "b", "S3_FORCE_PATH_STYLE": "false"},
+			ExpectedPathStyle: false,
+		},
+		{
+			Env:         map[string]string{"S3_ACCESS_KEY_ID": "a", "S3_SECRET_ACCESS_KEY": "b", "S3_FORCE_PATH_STYLE": "sometimes"},
+			ExpectError: "S3_FORCE_PATH_STYLE",
+		},
+		{
+			Env:         map[string]string{"S3_SECRET_ACCESS_KEY": "b"},
+			ExpectError: "S3_ACCESS_KEY_ID",
+		},
+		{
+			Env:         map[string]string{"S3_ACCESS_KEY_ID": "a", "S3_SECRET_ACCESS_KEY": "b", "S3_CA_BUNDLE": "/does/not/exist"},
+			ExpectError: "S3_CA_BUNDLE",
+		},
+	}
+
+	for _, g := range grid {
+		restore := setS3Env(g.Env)
+		config, err := getCustomS3Config("https://s3.example.com", "us-east-1")
+		if err == nil {
+			_, err = getCustomS3CABundle()
+		}
+		restore()
+
+		if g.ExpectError != "" {
+			if err == nil || !strings.Contains(err.Error(), g.ExpectError) {
+				t.Errorf("expected error mentioning %s for %v, got %v", g.ExpectError, g.Env, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %v: %v", g.Env, err)
+			continue
+		}
+		if aws.BoolValue(config.S3ForcePathStyle) != g.ExpectedPathStyle {
+			t.Errorf("expected path style %v for %v", g.ExpectedPathStyle, g.Env)
+		}
+	}
+}
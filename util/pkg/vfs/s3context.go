@@ -17,9 +17,13 @@ limitations under the License.
 package vfs
 
 import (
+	"bytes"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"regexp"
+	"strconv"
 	"sync"
 	"time"
 
@@ -61,6 +65,7 @@ func (s *S3Context) getClient(region string) (*s3.S3, error) {
 	if s3Client == nil {
 		var config *aws.Config
 		var err error
+		var opts session.Options
 		endpoint := os.Getenv("S3_ENDPOINT")
 		if endpoint == "" {
 			config = aws.NewConfig().WithRegion(region)
@@ -72,9 +77,19 @@ func (s *S3Context) getClient(region string) (*s3.S3, error) {
 			if err != nil {
 				return nil, err
 			}
+
+			// The session option takes precedence over AWS_CA_BUNDLE, which is meant for the AWS endpoints
+			caBundle, err := getCustomS3CABundle()
+			if err != nil {
+				return nil, err
+			}
+			if caBundle != nil {
+				opts.CustomCABundle = bytes.NewReader(caBundle)
+			}
 		}
+		opts.Config.MergeIn(config)
 
-		sess, err := session.NewSession(config)
+		sess, err := session.NewSessionWithOptions(opts)
 		if err != nil {
 			return nil, fmt.Errorf("error starting new AWS session: %v", err)
 		}
@@ -95,17 +110,45 @@ func getCustomS3Config(endpoint string, region string) (*aws.Config, error) {
 		return nil, fmt.Errorf("S3_SECRET_ACCESS_KEY cannot be empty when S3_ENDPOINT is not empty")
 	}
 
+	// Most S3-compatible stores are addressed by path, as they do not have DNS entries for each bucket
+	forcePathStyle := true
+	if v := os.Getenv("S3_FORCE_PATH_STYLE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_FORCE_PATH_STYLE %q: expected true or false", v)
+		}
+		forcePathStyle = b
+	}
+
 	s3Config := &aws.Config{
 		Credentials:      credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
 		Endpoint:         aws.String(endpoint),
 		Region:           aws.String(region),
-		S3ForcePathStyle: aws.Bool(true),
+		S3ForcePathStyle: aws.Bool(forcePathStyle),
 	}
 	s3Config = s3Config.WithCredentialsChainVerboseErrors(true)
 
 	return s3Config, nil
 }
 
+// getCustomS3CABundle returns the PEM encoded certificate authorities in S3_CA_BUNDLE, which are trusted
+// for the user-defined S3 endpoint instead of the system certificate authorities, or nil if it is not set
+func getCustomS3CABundle() ([]byte, error) {
+	caBundle := os.Getenv("S3_CA_BUNDLE")
+	if caBundle == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(caBundle)
+	if err != nil {
+		return nil, fmt.Errorf("error reading S3_CA_BUNDLE %q: %v", caBundle, err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in S3_CA_BUNDLE %q", caBundle)
+	}
+	return data, nil
+}
+
 func (s *S3Context) getRegionForBucket(bucket string) (string, error) {
 	region := func() string {
 		s.mutex.Lock()
@@ -28,6 +28,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsrequest "github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/golang/glog"
 	"k8s.io/kops/util/pkg/hashing"
@@ -43,6 +44,7 @@ type S3Path struct {
 
 var _ Path = &S3Path{}
 var _ HasHash = &S3Path{}
+var _ VersionedPath = &S3Path{}
 
 // S3Acl is an ACL implementation for objects on S3
 type S3Acl struct {
@@ -110,9 +112,45 @@ func (p *S3Path) Join(relativePath ...string) Path {
 }
 
 func (p *S3Path) WriteFile(data io.ReadSeeker, aclObj ACL) error {
+	_, err := p.WriteFileVersion(data, aclObj, "")
+	return err
+}
+
+// WriteFileVersion implements VersionedPath::WriteFileVersion; the version is the ETag of the object.
+// The ETag is checked before writing, and is sent as an If-Match precondition, or as If-None-Match: * for
+// VersionNotExist, which S3 enforces atomically; S3-compatible stores that ignore the precondition still
+// get the check before writing.
+func (p *S3Path) WriteFileVersion(data io.ReadSeeker, aclObj ACL, version string) (string, error) {
 	client, err := p.client()
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	if version == VersionNotExist {
+		_, err := client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(p.bucket),
+			Key:    aws.String(p.key),
+		})
+		if err == nil {
+			return "", &ConflictError{Path: p.Path()}
+		}
+		if code := AWSErrorCode(err); code != "NotFound" && code != "NoSuchKey" {
+			return "", fmt.Errorf("error checking for %s: %v", p, err)
+		}
+	} else if version != "" {
+		head, err := client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(p.bucket),
+			Key:    aws.String(p.key),
+		})
+		if err != nil {
+			if code := AWSErrorCode(err); code == "NotFound" || code == "NoSuchKey" {
+				return "", &ConflictError{Path: p.Path()}
+			}
+			return "", fmt.Errorf("error checking version of %s: %v", p, err)
+		}
+		if aws.StringValue(head.ETag) != version {
+			return "", &ConflictError{Path: p.Path()}
+		}
 	}
 
 	glog.V(4).Infof("Writing file %q", p)
@@ -134,7 +172,7 @@ func (p *S3Path) WriteFile(data io.ReadSeeker, aclObj ACL) error {
 	} else if aclObj != nil {
 		s3Acl, ok := aclObj.(*S3Acl)
 		if !ok {
-			return fmt.Errorf("write to %s with ACL of unexpected type %T", p, aclObj)
+			return "", fmt.Errorf("write to %s with ACL of unexpected type %T", p, aclObj)
 		}
 		request.ACL = s3Acl.RequestACL
 	}
@@ -143,16 +181,30 @@ func (p *S3Path) WriteFile(data io.ReadSeeker, aclObj ACL) error {
 
 	glog.V(8).Infof("Calling S3 PutObject Bucket=%q Key=%q SSE=%q ACL=%q", p.bucket, p.key, sse, acl)
 
-	_, err = client.PutObject(request)
-	if err != nil {
+	req, response := client.PutObjectRequest(request)
+	if version != "" {
+		// PutObjectInput does not have fields for If-Match or If-None-Match, so we set the header directly
+		req.Handlers.Build.PushBack(func(r *awsrequest.Request) {
+			if version == VersionNotExist {
+				r.HTTPRequest.Header.Set("If-None-Match", "*")
+			} else {
+				r.HTTPRequest.Header.Set("If-Match", version)
+			}
+		})
+	}
+	if err := req.Send(); err != nil {
+		// S3 fails with ConditionalRequestConflict if a concurrent conditional write is in progress
+		if code := AWSErrorCode(err); version != "" && (code == "PreconditionFailed" || code == "ConditionalRequestConflict") {
+			return "", &ConflictError{Path: p.Path()}
+		}
 		if acl != "" {
-			return fmt.Errorf("error writing %s (with ACL=%q): %v", p, acl, err)
+			return "", fmt.Errorf("error writing %s (with ACL=%q): %v", p, acl, err)
 		} else {
-			return fmt.Errorf("error writing %s: %v", p, err)
+			return "", fmt.Errorf("error writing %s: %v", p, err)
 		}
 	}
 
-	return nil
+	return aws.StringValue(response.ETag), nil
 }
 
 // To prevent concurrent creates on the same file while maintaining atomicity of writes,
@@ -188,11 +240,27 @@ func (p *S3Path) ReadFile() ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// ReadFileVersion implements VersionedPath::ReadFileVersion; the version is the ETag of the object
+func (p *S3Path) ReadFileVersion() ([]byte, string, error) {
+	var b bytes.Buffer
+	etag, _, err := p.read(&b)
+	if err != nil {
+		return nil, "", err
+	}
+	return b.Bytes(), etag, nil
+}
+
 // WriteTo implements io.WriterTo
 func (p *S3Path) WriteTo(out io.Writer) (int64, error) {
+	_, n, err := p.read(out)
+	return n, err
+}
+
+// read copies the contents of the object to out, returning the ETag of the object
+func (p *S3Path) read(out io.Writer) (string, int64, error) {
 	client, err := p.client()
 	if err != nil {
-		return 0, err
+		return "", 0, err
 	}
 
 	glog.V(4).Infof("Reading file %q", p)
@@ -204,17 +272,17 @@ func (p *S3Path) WriteTo(out io.Writer) (int64, error) {
 	response, err := client.GetObject(request)
 	if err != nil {
 		if AWSErrorCode(err) == "NoSuchKey" {
-			return 0, os.ErrNotExist
+			return "", 0, os.ErrNotExist
 		}
-		return 0, fmt.Errorf("error fetching %s: %v", p, err)
+		return "", 0, fmt.Errorf("error fetching %s: %v", p, err)
 	}
 	defer response.Body.Close()
 
 	n, err := io.Copy(out, response.Body)
 	if err != nil {
-		return n, fmt.Errorf("error reading %s: %v", p, err)
+		return "", n, fmt.Errorf("error reading %s: %v", p, err)
 	}
-	return n, nil
+	return aws.StringValue(response.ETag), n, nil
 }
 
 func (p *S3Path) ReadDir() ([]Path, error) {
@@ -0,0 +1,487 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	crypto_rand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// SealManifestName is the name of the manifest, at the root of a sealed tree, that records the hashes of the sealed files
+const SealManifestName = "sealed-manifest"
+
+// sealManifestVersion identifies the format of the manifest and of the sealed files
+const sealManifestVersion = "kops/v1"
+
+// sealManifestAttempts is the number of times an update to the manifest is retried when it is changed concurrently
+const sealManifestAttempts = 10
+
+// SealKeys are the keys that files are sealed with
+type SealKeys struct {
+	// EncryptionKey is the AES-256 key that the contents of encrypted files are encrypted with, using AES-GCM
+	EncryptionKey []byte
+	// SigningKey is the key that the manifest is signed with, using HMAC-SHA256
+	SigningKey []byte
+}
+
+// NewSealKeys derives the encryption and signing keys from a secret
+func NewSealKeys(secret []byte) (*SealKeys, error) {
+	if len(secret) < 16 {
+		return nil, fmt.Errorf("seal secret must be at least 16 bytes, was %d", len(secret))
+	}
+	return &SealKeys{
+		EncryptionKey: deriveSealKey(secret, "kops seal encryption key"),
+		SigningKey:    deriveSealKey(secret, "kops seal signing key"),
+	}, nil
+}
+
+func deriveSealKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// IntegrityError is returned when a sealed file cannot be verified, because it was not sealed,
+// or because it or the manifest was changed by something that does not hold the keys
+type IntegrityError struct {
+	Path    string
+	Message string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("integrity check of %s failed: %s", e.Path, e.Message)
+}
+
+// IsIntegrityError returns true if the error is an *IntegrityError
+func IsIntegrityError(err error) bool {
+	_, ok := err.(*IntegrityError)
+	return ok
+}
+
+// sealManifest records the sealed files of a tree, and is signed so that they cannot be changed without the keys
+type sealManifest struct {
+	Version string                     `json:"version"`
+	Files   map[string]*sealedFileInfo `json:"files"`
+	// HMAC is the HMAC-SHA256 of the manifest without the HMAC, with the signing key
+	HMAC []byte `json:"hmac,omitempty"`
+}
+
+// sealedFileInfo is the manifest entry of a sealed file
+type sealedFileInfo struct {
+	// SHA256 is the hex encoded SHA256 hash of the file as stored
+	SHA256 string `json:"sha256"`
+	// Encrypted is true if the file is stored encrypted, as the AES-GCM nonce followed by the ciphertext
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// SealedPath wraps a Path, sealing the files that are written so that their integrity is verified when they are read.
+// The SHA256 hashes of the files are recorded in a manifest at the root of the sealed tree, signed with HMAC-SHA256,
+// and the contents of the files are optionally encrypted with AES-GCM.
+// Files are sealed under their path relative to the root, so they cannot be moved within the tree.
+// Integrity only holds against writers that do not hold the keys; if the secret that the keys are derived from
+// is kept in the same store, a writer that can also read the store can seal files of its own.
+type SealedPath struct {
+	root     Path
+	relative string
+	keys     *SealKeys
+	encrypt  bool
+}
+
+var _ Path = &SealedPath{}
+var _ HasClusterReadable = &SealedPath{}
+
+// NewSealedPath returns a SealedPath for the tree rooted at root.
+// If encrypt is false, files written through the path are signed but stored as plaintext,
+// so they can also be read without the keys; files are decrypted as they are read in either case.
+func NewSealedPath(root Path, keys *SealKeys, encrypt bool) *SealedPath {
+	return &SealedPath{
+		root:    root,
+		keys:    keys,
+		encrypt: encrypt,
+	}
+}
+
+// Inner returns the underlying path, where the sealed file is stored
+func (p *SealedPath) Inner() Path {
+	if p.relative == "" {
+		return p.root
+	}
+	return p.root.Join(p.relative)
+}
+
+func (p *SealedPath) manifestPath() Path {
+	return p.root.Join(SealManifestName)
+}
+
+func (p *SealedPath) Join(relativePath ...string) Path {
+	args := append([]string{p.relative}, relativePath...)
+	return &SealedPath{
+		root:     p.root,
+		relative: strings.TrimPrefix(path.Join(args...), "/"),
+		keys:     p.keys,
+		encrypt:  p.encrypt,
+	}
+}
+
+func (p *SealedPath) Base() string {
+	return p.Inner().Base()
+}
+
+func (p *SealedPath) Path() string {
+	return p.Inner().Path()
+}
+
+func (p *SealedPath) String() string {
+	return p.Path()
+}
+
+// IsClusterReadable implements HasClusterReadable::IsClusterReadable
+func (p *SealedPath) IsClusterReadable() bool {
+	return IsClusterReadable(p.Inner())
+}
+
+// ReadFile implements Path::ReadFile, returning an *IntegrityError unless the file is recorded in the manifest
+// and matches its hash, and decrypting the file if it is encrypted
+func (p *SealedPath) ReadFile() ([]byte, error) {
+	manifest, _, err := p.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, &IntegrityError{Path: p.Path(), Message: "the tree has not been sealed"}
+	}
+	info := manifest.Files[p.relative]
+
+	data, err := p.Inner().ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, &IntegrityError{Path: p.Path(), Message: "the file has not been sealed"}
+	}
+
+	if hash := sha256.Sum256(data); hex.EncodeToString(hash[:]) != info.SHA256 {
+		return nil, &IntegrityError{Path: p.Path(), Message: "the file has been changed since it was sealed"}
+	}
+
+	if !info.Encrypted {
+		return data, nil
+	}
+	plaintext, err := p.decrypt(data)
+	if err != nil {
+		return nil, &IntegrityError{Path: p.Path(), Message: err.Error()}
+	}
+	return plaintext, nil
+}
+
+func (p *SealedPath) WriteTo(out io.Writer) (int64, error) {
+	data, err := p.ReadFile()
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, bytes.NewReader(data))
+	return n, err
+}
+
+// WriteFile implements Path::WriteFile, writing the sealed file and recording it in the manifest
+func (p *SealedPath) WriteFile(data io.ReadSeeker, acl ACL) error {
+	sealed, info, err := p.seal(data)
+	if err != nil {
+		return err
+	}
+	if err := p.Inner().WriteFile(bytes.NewReader(sealed), acl); err != nil {
+		return err
+	}
+	return p.updateManifest(acl, func(files map[string]*sealedFileInfo) {
+		files[p.relative] = info
+	})
+}
+
+// CreateFile implements Path::CreateFile, writing the sealed file and recording it in the manifest
+func (p *SealedPath) CreateFile(data io.ReadSeeker, acl ACL) error {
+	sealed, info, err := p.seal(data)
+	if err != nil {
+		return err
+	}
+	if err := p.Inner().CreateFile(bytes.NewReader(sealed), acl); err != nil {
+		return err
+	}
+	return p.updateManifest(acl, func(files map[string]*sealedFileInfo) {
+		files[p.relative] = info
+	})
+}
+
+// Remove implements Path::Remove, removing the file and its entry in the manifest
+func (p *SealedPath) Remove() error {
+	if err := p.Inner().Remove(); err != nil {
+		return err
+	}
+	return p.updateManifest(nil, func(files map[string]*sealedFileInfo) {
+		delete(files, p.relative)
+	})
+}
+
+// ReadDir implements Path::ReadDir, omitting the manifest
+func (p *SealedPath) ReadDir() ([]Path, error) {
+	children, err := p.Inner().ReadDir()
+	if err != nil {
+		return nil, err
+	}
+	return p.wrap(children)
+}
+
+// ReadTree implements Path::ReadTree, omitting the manifest
+func (p *SealedPath) ReadTree() ([]Path, error) {
+	children, err := p.Inner().ReadTree()
+	if err != nil {
+		return nil, err
+	}
+	return p.wrap(children)
+}
+
+// VerifyTree verifies every file under the path that is recorded in the manifest,
+// returning an *IntegrityError if any of them cannot be verified or has been removed
+func (p *SealedPath) VerifyTree() error {
+	_, err := p.ReadSealedTree()
+	return err
+}
+
+// ReadSealedTree reads and verifies every file under the path that is recorded in the manifest,
+// returning their contents by path relative to this path, or an *IntegrityError if any of them cannot be verified or has been removed.
+// Files that are not recorded in the manifest are not read.
+func (p *SealedPath) ReadSealedTree() (map[string][]byte, error) {
+	manifest, _, err := p.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, &IntegrityError{Path: p.Path(), Message: "the tree has not been sealed"}
+	}
+
+	prefix := p.relative
+	if prefix != "" {
+		prefix += "/"
+	}
+	files := make(map[string][]byte)
+	for relative := range manifest.Files {
+		if !strings.HasPrefix(relative, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(relative, prefix)
+		child := p.Join(name)
+		data, err := child.ReadFile()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, &IntegrityError{Path: child.Path(), Message: "the file has been removed"}
+			}
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// wrap returns the SealedPaths of paths under the root, omitting the manifest
+func (p *SealedPath) wrap(children []Path) ([]Path, error) {
+	var paths []Path
+	for _, child := range children {
+		relative, err := RelativePath(p.root, child)
+		if err != nil {
+			return nil, err
+		}
+		if relative == SealManifestName {
+			continue
+		}
+		paths = append(paths, &SealedPath{
+			root:     p.root,
+			relative: relative,
+			keys:     p.keys,
+			encrypt:  p.encrypt,
+		})
+	}
+	return paths, nil
+}
+
+// seal returns the contents of the file as stored, and its manifest entry
+func (p *SealedPath) seal(data io.ReadSeeker) ([]byte, *sealedFileInfo, error) {
+	if p.relative == "" || p.relative == SealManifestName {
+		return nil, nil, fmt.Errorf("cannot write sealed file %s", p)
+	}
+
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading data: %v", err)
+	}
+
+	info := &sealedFileInfo{}
+	if p.encrypt {
+		b, err = p.encryptData(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.Encrypted = true
+	}
+
+	hash := sha256.Sum256(b)
+	info.SHA256 = hex.EncodeToString(hash[:])
+	return b, info, nil
+}
+
+// encryptData encrypts the contents with AES-GCM, authenticating the relative path
+// so that an encrypted file cannot be moved within the tree
+func (p *SealedPath) encryptData(plaintext []byte) ([]byte, error) {
+	gcm, err := newSealGCM(p.keys.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(crypto_rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(p.relative)), nil
+}
+
+func (p *SealedPath) decrypt(data []byte) ([]byte, error) {
+	gcm, err := newSealGCM(p.keys.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted file is truncated")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(p.relative))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting file: %v", err)
+	}
+	return plaintext, nil
+}
+
+func newSealGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error building cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error building cipher: %v", err)
+	}
+	return gcm, nil
+}
+
+// signature returns the HMAC of the manifest, without its HMAC
+func (p *SealedPath) signature(manifest *sealManifest) ([]byte, error) {
+	unsigned := &sealManifest{
+		Version: manifest.Version,
+		Files:   manifest.Files,
+	}
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing manifest: %v", err)
+	}
+	mac := hmac.New(sha256.New, p.keys.SigningKey)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// readManifest reads and verifies the manifest, and returns its version for a conditional update.
+// It returns a nil manifest if the tree has not been sealed.
+func (p *SealedPath) readManifest() (*sealManifest, string, error) {
+	manifestPath := p.manifestPath()
+	data, version, err := ReadFileVersion(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("error reading %s: %v", manifestPath, err)
+	}
+
+	manifest := &sealManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, "", &IntegrityError{Path: manifestPath.Path(), Message: fmt.Sprintf("error parsing manifest: %v", err)}
+	}
+	if manifest.Version != sealManifestVersion {
+		return nil, "", &IntegrityError{Path: manifestPath.Path(), Message: fmt.Sprintf("unknown manifest version %q", manifest.Version)}
+	}
+	expected, err := p.signature(manifest)
+	if err != nil {
+		return nil, "", err
+	}
+	if !hmac.Equal(manifest.HMAC, expected) {
+		return nil, "", &IntegrityError{Path: manifestPath.Path(), Message: "the manifest signature does not match; it was changed or signed with another key"}
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]*sealedFileInfo)
+	}
+	return manifest, version, nil
+}
+
+// updateManifest applies the change to the manifest, retrying if the manifest is changed concurrently
+func (p *SealedPath) updateManifest(acl ACL, change func(files map[string]*sealedFileInfo)) error {
+	manifestPath := p.manifestPath()
+	for attempt := 1; ; attempt++ {
+		manifest, version, err := p.readManifest()
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			manifest = &sealManifest{
+				Version: sealManifestVersion,
+				Files:   make(map[string]*sealedFileInfo),
+			}
+		}
+
+		change(manifest.Files)
+		manifest.HMAC, err = p.signature(manifest)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			return fmt.Errorf("error serializing manifest: %v", err)
+		}
+
+		if version == "" {
+			err = manifestPath.CreateFile(bytes.NewReader(data), acl)
+		} else {
+			_, err = WriteFileVersion(manifestPath, bytes.NewReader(data), acl, version)
+		}
+		if err == nil {
+			return nil
+		}
+		if !os.IsExist(err) && !IsConflict(err) {
+			return fmt.Errorf("error writing %s: %v", manifestPath, err)
+		}
+		if attempt >= sealManifestAttempts {
+			return fmt.Errorf("error writing %s: it was changed concurrently %d times", manifestPath, attempt)
+		}
+		glog.V(2).Infof("%s was changed concurrently; retrying", manifestPath)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func testSealKeys(t *testing.T, secret string) *SealKeys {
+	keys, err := NewSealKeys([]byte(secret))
+	if err != nil {
+		t.Fatalf("error building keys: %v", err)
+	}
+	return keys
+}
+
+func TestSealedPathRoundTrip(t *testing.T) {
+	context := NewMemFSContext()
+	root := NewMemFSPath(context, "cluster")
+	keys := testSealKeys(t, "0123456789abcdef0123456789abcdef")
+
+	encrypted := NewSealedPath(root, keys, true)
+	signed := NewSealedPath(root, keys, false)
+
+	if err := encrypted.Join("cluster.spec").WriteFile(bytes.NewReader([]byte("secret spec")), nil); err != nil {
+		t.Fatalf("error writing encrypted file: %v", err)
+	}
+	if err := signed.Join("addons", "bootstrap-channel.yaml").WriteFile(bytes.NewReader([]byte("channel")), nil); err != nil {
+		t.Fatalf("error writing signed file: %v", err)
+	}
+
+	stored, err := root.Join("cluster.spec").ReadFile()
+	if err != nil {
+		t.Fatalf("error reading stored file: %v", err)
+	}
+	if bytes.Contains(stored, []byte("secret spec")) {
+		t.Errorf("encrypted file is stored as plaintext: %q", stored)
+	}
+	if stored, _ := root.Join("addons", "bootstrap-channel.yaml").ReadFile(); string(stored) != "channel" {
+		t.Errorf("signed file is not stored as plaintext: %q", stored)
+	}
+
+	// Either path reads both files
+	for _, p := range []*SealedPath{encrypted, signed} {
+		if data, err := p.Join("cluster.spec").ReadFile(); err != nil || string(data) != "secret spec" {
+			t.Errorf("unexpected result reading encrypted file: %q, %v", data, err)
+		}
+		if data, err := p.Join("addons").Join("bootstrap-channel.yaml").ReadFile(); err != nil || string(data) != "channel" {
+			t.Errorf("unexpected result reading signed file: %q, %v", data, err)
+		}
+	}
+
+	tree, err := signed.ReadTree()
+	if err != nil {
+		t.Fatalf("error reading tree: %v", err)
+	}
+	if len(tree) != 2 {
+		t.Errorf("expected the tree to list the two sealed files, got %v", tree)
+	}
+	if err := signed.VerifyTree(); err != nil {
+		t.Errorf("error verifying tree: %v", err)
+	}
+
+	// An unsealed file is not read with the sealed tree
+	if err := root.Join("addons", "unsealed.yaml").WriteFile(bytes.NewReader([]byte("unsealed")), nil); err != nil {
+		t.Fatalf("error writing unsealed file: %v", err)
+	}
+	files, err := signed.Join("addons").(*SealedPath).ReadSealedTree()
+	if err != nil {
+		t.Fatalf("error reading sealed tree: %v", err)
+	}
+	if len(files) != 1 || string(files["bootstrap-channel.yaml"]) != "channel" {
+		t.Errorf("unexpected sealed tree: %q", files)
+	}
+	if err := root.Join("addons", "unsealed.yaml").Remove(); err != nil {
+		t.Fatalf("error removing unsealed file: %v", err)
+	}
+
+	if _, err := signed.Join("missing").ReadFile(); !os.IsNotExist(err) {
+		t.Errorf("expected not exist reading missing file, got %v", err)
+	}
+
+	if err := signed.Join("addons", "bootstrap-channel.yaml").Remove(); err != nil {
+		t.Fatalf("error removing file: %v", err)
+	}
+	if err := signed.VerifyTree(); err != nil {
+		t.Errorf("error verifying tree after removing a file: %v", err)
+	}
+}
+
+func TestSealedPathRefusesTampering(t *testing.T) {
+	context := NewMemFSContext()
+	root := NewMemFSPath(context, "cluster")
+	keys := testSealKeys(t, "0123456789abcdef0123456789abcdef")
+	sealed := NewSealedPath(root, keys, true)
+
+	if _, err := sealed.Join("config").ReadFile(); !IsIntegrityError(err) {
+		t.Errorf("expected integrity error reading from tree that was not sealed, got %v", err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if err := sealed.Join(name).WriteFile(bytes.NewReader([]byte("contents of "+name)), nil); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+
+	// A file written without the keys
+	if err := root.Join("unsealed").WriteFile(bytes.NewReader([]byte("unsealed")), nil); err != nil {
+		t.Fatalf("error writing unsealed file: %v", err)
+	}
+	if _, err := sealed.Join("unsealed").ReadFile(); !IsIntegrityError(err) {
+		t.Errorf("expected integrity error reading unsealed file, got %v", err)
+	}
+
+	// A file modified without the keys
+	stored, _ := root.Join("a").ReadFile()
+	tampered := append([]byte{}, stored...)
+	tampered[len(tampered)-1] ^= 0xff
+	if err := root.Join("a").WriteFile(bytes.NewReader(tampered), nil); err != nil {
+		t.Fatalf("error writing tampered file: %v", err)
+	}
+	if _, err := sealed.Join("a").ReadFile(); !IsIntegrityError(err) {
+		t.Errorf("expected integrity error reading tampered file, got %v", err)
+	}
+	if err := sealed.VerifyTree(); !IsIntegrityError(err) {
+		t.Errorf("expected integrity error verifying tree with tampered file, got %v", err)
+	}
+
+	// A file replaced by another sealed file
+	manifest, _ := root.Join(SealManifestName).ReadFile()
+	storedB, _ := root.Join("b").ReadFile()
+	if err := root.Join("a").WriteFile(bytes.NewReader(storedB), nil); err != nil {
+		t.Fatalf("error writing moved file: %v", err)
+	}
+	if _, err := sealed.Join("a").ReadFile(); !IsIntegrityError(err) {
+		t.Errorf("expected integrity error reading moved file, got %v", err)
+	}
+
+	// A manifest modified without the keys
+	tamperedManifest := bytes.Replace(manifest, []byte(`"a"`), []byte(`"c"`), 1)
+	if err := root.Join(SealManifestName).WriteFile(bytes.NewReader(tamperedManifest), nil); err != nil {
+		t.Fatalf("error writing tampered manifest: %v", err)
+	}
+	if _, err := sealed.Join("b").ReadFile(); !IsIntegrityError(err) {
+		t.Errorf("expected integrity error reading with tampered manifest, got %v", err)
+	}
+	if err := sealed.Join("d").WriteFile(bytes.NewReader([]byte("d")), nil); !IsIntegrityError(err) {
+		t.Errorf("expected integrity error updating tampered manifest, got %v", err)
+	}
+
+	// Files sealed with other keys
+	if err := root.Join(SealManifestName).WriteFile(bytes.NewReader(manifest), nil); err != nil {
+		t.Fatalf("error restoring manifest: %v", err)
+	}
+	other := NewSealedPath(root, testSealKeys(t, "fedcba9876543210fedcba9876543210"), true)
+	if _, err := other.Join("b").ReadFile(); !IsIntegrityError(err) {
+		t.Errorf("expected integrity error reading with other keys, got %v", err)
+	}
+}
+
+func TestSealedPathManifestUpdates(t *testing.T) {
+	context := NewMemFSContext()
+	root := NewMemFSPath(context, "cluster")
+	keys := testSealKeys(t, "0123456789abcdef0123456789abcdef")
+
+	// Each write reads the latest manifest, so no entries are lost
+	for i := 0; i < 5; i++ {
+		p := NewSealedPath(root, keys, false).Join("file", string('a'+rune(i)))
+		if err := p.WriteFile(bytes.NewReader([]byte("data")), nil); err != nil {
+			t.Fatalf("error writing %s: %v", p, err)
+		}
+	}
+	manifest, _, err := NewSealedPath(root, keys, false).readManifest()
+	if err != nil {
+		t.Fatalf("error reading manifest: %v", err)
+	}
+	if len(manifest.Files) != 5 {
+		t.Errorf("expected 5 files in manifest, got %v", manifest.Files)
+	}
+}
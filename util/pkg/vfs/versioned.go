@@ -0,0 +1,138 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// VersionedPath is implemented by paths that report a version of the file contents, and can write the file
+// only if it is still at the version that was read, so that concurrent changes are not silently overwritten
+type VersionedPath interface {
+	// ReadFileVersion returns the contents of the file, and an opaque version that changes each time the file is written.
+	// If the file did not exist, err = os.ErrNotExist
+	ReadFileVersion() ([]byte, string, error)
+
+	// WriteFileVersion writes the file contents if the file is still at version, returning the new version.
+	// If version is empty, the file is written unconditionally; if it is VersionNotExist, the file is only
+	// written if it does not exist, which the store checks atomically with the write.
+	// If the file has been changed or removed since version was read, or exists when writing at VersionNotExist,
+	// it returns a *ConflictError.
+	WriteFileVersion(data io.ReadSeeker, acl ACL, version string) (string, error)
+}
+
+// VersionNotExist is the version of a file that does not exist; writing at VersionNotExist creates the file
+// only if it does not exist
+const VersionNotExist = "*"
+
+// ConflictError is returned by a conditional write when the file has changed since it was read
+type ConflictError struct {
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s has been changed since it was read", e.Path)
+}
+
+// IsConflict returns true if the error is a *ConflictError
+func IsConflict(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+// ReadFileVersion reads the contents and the version of a file.
+// For paths that do not implement VersionedPath, the version is the hash of the contents.
+func ReadFileVersion(p Path) ([]byte, string, error) {
+	if vp, ok := p.(VersionedPath); ok {
+		return vp.ReadFileVersion()
+	}
+
+	data, err := p.ReadFile()
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentVersion(data), nil
+}
+
+// WriteFileVersion writes a file if it is still at version, as returned by ReadFileVersion, and returns the new version.
+// For paths that do not implement VersionedPath, the current contents are compared before writing,
+// which narrows but does not close the window for a concurrent write; those paths cannot be written
+// at VersionNotExist, because nothing would stop two writers from both creating the file.
+func WriteFileVersion(p Path, data io.ReadSeeker, acl ACL, version string) (string, error) {
+	if vp, ok := p.(VersionedPath); ok {
+		return vp.WriteFileVersion(data, acl, version)
+	}
+
+	if version == VersionNotExist {
+		return "", fmt.Errorf("%s does not support creating a file only if it does not exist", p)
+	}
+
+	if version != "" {
+		current, err := p.ReadFile()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return "", &ConflictError{Path: p.Path()}
+			}
+			return "", err
+		}
+		if contentVersion(current) != version {
+			return "", &ConflictError{Path: p.Path()}
+		}
+	}
+
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", fmt.Errorf("error reading data: %v", err)
+	}
+	if err := p.WriteFile(bytes.NewReader(b), acl); err != nil {
+		return "", err
+	}
+	return contentVersion(b), nil
+}
+
+// CreateFileVersion creates a file that must not exist, and returns its version.
+// For paths that do not implement VersionedPath, the file is created with CreateFile.
+func CreateFileVersion(p Path, data io.ReadSeeker, acl ACL) (string, error) {
+	if vp, ok := p.(VersionedPath); ok {
+		version, err := vp.WriteFileVersion(data, acl, VersionNotExist)
+		if IsConflict(err) {
+			return "", os.ErrExist
+		}
+		return version, err
+	}
+
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", fmt.Errorf("error reading data: %v", err)
+	}
+	if err := p.CreateFile(bytes.NewReader(b), acl); err != nil {
+		return "", err
+	}
+	return contentVersion(b), nil
+}
+
+// contentVersion is the version of a file for paths that do not implement VersionedPath
+func contentVersion(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func testConditionalWrites(t *testing.T, p Path) {
+	if _, _, err := ReadFileVersion(p); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist reading %s, got %v", p, err)
+	}
+
+	if err := p.WriteFile(bytes.NewReader([]byte("one")), nil); err != nil {
+		t.Fatalf("error writing %s: %v", p, err)
+	}
+	data, version, err := ReadFileVersion(p)
+	if err != nil {
+		t.Fatalf("error reading %s: %v", p, err)
+	}
+	if string(data) != "one" || version == "" {
+		t.Fatalf("unexpected contents %q at version %q", data, version)
+	}
+
+	newVersion, err := WriteFileVersion(p, bytes.NewReader([]byte("two")), nil, version)
+	if err != nil {
+		t.Fatalf("error writing %s at version %q: %v", p, version, err)
+	}
+	if newVersion == version {
+		t.Errorf("version was not changed by write: %q", version)
+	}
+
+	// A write at the version that was replaced is a conflict
+	if _, err := WriteFileVersion(p, bytes.NewReader([]byte("three")), nil, version); !IsConflict(err) {
+		t.Errorf("expected conflict writing at stale version, got %v", err)
+	}
+	if data, _ := p.ReadFile(); string(data) != "two" {
+		t.Errorf("conflicting write changed contents to %q", data)
+	}
+
+	// An unconditional write always succeeds
+	if _, err := WriteFileVersion(p, bytes.NewReader([]byte("three")), nil, ""); err != nil {
+		t.Errorf("unexpected error writing unconditionally: %v", err)
+	}
+
+	// A write to a removed file is a conflict
+	_, version, err = ReadFileVersion(p)
+	if err != nil {
+		t.Fatalf("error reading %s: %v", p, err)
+	}
+	if err := p.Remove(); err != nil {
+		t.Fatalf("error removing %s: %v", p, err)
+	}
+	if _, err := WriteFileVersion(p, bytes.NewReader([]byte("four")), nil, version); !IsConflict(err) {
+		t.Errorf("expected conflict writing removed file, got %v", err)
+	}
+}
+
+func testWritesAtVersionNotExist(t *testing.T, p Path) {
+	version, err := WriteFileVersion(p, bytes.NewReader([]byte("one")), nil, VersionNotExist)
+	if err != nil {
+		t.Fatalf("error creating %s: %v", p, err)
+	}
+	if version == "" || version == VersionNotExist {
+		t.Errorf("unexpected version %q after creating %s", version, p)
+	}
+
+	// The file now exists, so it is not created again
+	if _, err := WriteFileVersion(p, bytes.NewReader([]byte("two")), nil, VersionNotExist); !IsConflict(err) {
+		t.Errorf("expected conflict creating existing file, got %v", err)
+	}
+	if data, _ := p.ReadFile(); string(data) != "one" {
+		t.Errorf("conflicting write changed contents to %q", data)
+	}
+}
+
+func TestMemFSConditionalWrites(t *testing.T) {
+	Context.ResetMemfsContext(true)
+	p, err := Context.BuildVfsPath("memfs://bucket/config")
+	if err != nil {
+		t.Fatalf("error building path: %v", err)
+	}
+	testConditionalWrites(t, p)
+	testWritesAtVersionNotExist(t, p.Join("created"))
+}
+
+func TestFSConditionalWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "versioned")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testConditionalWrites(t, NewFSPath(filepath.Join(dir, "config")))
+	testWritesAtVersionNotExist(t, NewFSPath(filepath.Join(dir, "created")))
+
+	// Only one of concurrent writers creates the file
+	p := NewFSPath(filepath.Join(dir, "concurrent"))
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := WriteFileVersion(p, bytes.NewReader([]byte(fmt.Sprintf("writer %d", i))), nil, VersionNotExist)
+			results <- err
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+	created := 0
+	for err := range results {
+		if err == nil {
+			created++
+		} else if !IsConflict(err) {
+			t.Errorf("unexpected error creating %s: %v", p, err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("expected exactly one writer to create %s, got %d", p, created)
+	}
+}